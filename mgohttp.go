@@ -0,0 +1,781 @@
+// Package mgohttp is version 1 of the mgohttp API, the SessionHandler injecting the sessions of
+// a request into its context, and the traced wrappers of mgo behind the MongoSession
+// interfaces.
+//
+// It's implemented by v2, github.com/Clever/mgohttp/v2: the types of this package are
+// aliases of v2's, its errors and constants are the same values and its functions call v2's,
+// so both import paths can be used side by side while a service migrates to v2's New.
+package mgohttp
+
+import (
+	"context"
+	"crypto/tls"
+	"net/http"
+	"time"
+
+	v2 "github.com/Clever/mgohttp/v2"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.mongodb.org/mongo-driver/mongo"
+	mgo "gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+type CollectionStats = v2.CollectionStats
+
+type (
+	BatchWriterConfig = v2.BatchWriterConfig
+	BatchWriter       = v2.BatchWriter
+)
+
+var ErrBatchWriterClosed = v2.ErrBatchWriterClosed
+
+// NewBatchWriter starts a BatchWriter.
+func NewBatchWriter(cfg BatchWriterConfig) *BatchWriter {
+	return v2.NewBatchWriter(cfg)
+}
+
+var ErrBudgetExpired = v2.ErrBudgetExpired
+
+// BudgetExpired reports whether the request of ctx hit the SessionHandler's timeout.
+func BudgetExpired(ctx context.Context) bool {
+	return v2.BudgetExpired(ctx)
+}
+
+type (
+	CappedDocumentTooLargeError = v2.CappedDocumentTooLargeError
+	CappedOverflowError         = v2.CappedOverflowError
+	CappedStats                 = v2.CappedStats
+	CappedWrite                 = v2.CappedWrite
+	CappedWriter                = v2.CappedWriter
+	CappedTail                  = v2.CappedTail
+)
+
+var (
+	ErrNotCapped              = v2.ErrNotCapped
+	ErrCappedDocumentTooLarge = v2.ErrCappedDocumentTooLarge
+	ErrCappedOverflow         = v2.ErrCappedOverflow
+)
+
+// GetCappedStats returns the stats of collection with the collStats command, ErrNotCapped if
+// it isn't capped.
+func GetCappedStats(db MongoDatabase, collection string) (CappedStats, error) {
+	return v2.GetCappedStats(db, collection)
+}
+
+// NewCappedWriter returns a CappedWriter for collection. refreshEvery defaults to 10s.
+func NewCappedWriter(collection string, refreshEvery time.Duration) *CappedWriter {
+	return v2.NewCappedWriter(collection, refreshEvery)
+}
+
+// TailCapped returns a CappedTail of collection from the document after lastID, or from the
+// start of the collection when it's empty.
+func TailCapped(db MongoDatabase, collection string, lastID bson.ObjectId, timeout time.Duration) *CappedTail {
+	return v2.TailCapped(db, collection, lastID, timeout)
+}
+
+// NewChildSession returns a session of database for a goroutine of the request of ctx, along
+// with the func closing it.
+func NewChildSession(ctx context.Context, database string) (MongoSession, func()) {
+	return v2.NewChildSession(ctx, database)
+}
+
+type RequestAbortedError = v2.RequestAbortedError
+
+var ErrClientDisconnected = v2.ErrClientDisconnected
+
+// IsNotFound reports whether err is, or wraps, mgo.ErrNotFound: the query matched no document.
+func IsNotFound(err error) bool {
+	return v2.IsNotFound(err)
+}
+
+// IsDuplicateKey reports whether err is, or wraps, a duplicate key error of a write, an Apply
+// or a bulk operation.
+func IsDuplicateKey(err error) bool {
+	return v2.IsDuplicateKey(err)
+}
+
+// IsTimeout reports whether err is a timeout: the SessionHandler's own, see ErrRequestTimeout
+// and ErrBudgetExpired, a socket timeout, the deadline of a context, or the server's time
+// limit of a query with SetMaxTime, or a timeout of the official driver.
+func IsTimeout(err error) bool {
+	return v2.IsTimeout(err)
+}
+
+// IsNetworkError reports whether err is a failure to reach the server or to talk to it, rather
+// than an error answered by the server, so the operation may succeed if retried.
+func IsNetworkError(err error) bool {
+	return v2.IsNetworkError(err)
+}
+
+type (
+	Collation               = v2.Collation
+	UnsupportedFeatureError = v2.UnsupportedFeatureError
+)
+
+type PayloadCompactor = v2.PayloadCompactor
+
+// TruncatePayload keeps the start of payload, and marks how much was cut.
+func TruncatePayload(payload string, max int) string {
+	return v2.TruncatePayload(payload, max)
+}
+
+// HashPayload replaces payload with its hash and size, so identical payloads can still be
+// correlated across spans.
+func HashPayload(payload string, max int) string {
+	return v2.HashPayload(payload, max)
+}
+
+type ConsistencyOverride = v2.ConsistencyOverride
+
+const DefaultConsistencyHeader = v2.DefaultConsistencyHeader
+
+var DefaultConsistencyModes = v2.DefaultConsistencyModes
+
+const (
+	DecisionSessionWait     = v2.DecisionSessionWait
+	DecisionSessionRejected = v2.DecisionSessionRejected
+	DecisionShed            = v2.DecisionShed
+	DecisionOptionalSkipped = v2.DecisionOptionalSkipped
+)
+
+type DialOption = v2.DialOption
+
+// WithDialTimeout bounds the connection to the servers, 10s by default.
+func WithDialTimeout(d time.Duration) DialOption {
+	return v2.WithDialTimeout(d)
+}
+
+// WithTLS connects to the servers over TLS with cfg, or with the system's CAs when nil.
+func WithTLS(cfg *tls.Config) DialOption {
+	return v2.WithTLS(cfg)
+}
+
+// WithCA connects to the servers over TLS, trusting the CA certificates of pem on top of those
+// of the TLS config, e.g. the CA of a managed cluster.
+func WithCA(pem []byte) DialOption {
+	return v2.WithCA(pem)
+}
+
+// WithCAFile is WithCA with the certificates read from path.
+func WithCAFile(path string) DialOption {
+	return v2.WithCAFile(path)
+}
+
+// WithCredentials authenticates with SCRAM-SHA-1 as username, defined in the source database,
+// "admin" when empty.
+func WithCredentials(username, password, source string) DialOption {
+	return v2.WithCredentials(username, password, source)
+}
+
+// Dial connects to the servers of url, a mongodb:// or mongodb+srv:// connection string, with
+// the options.
+func Dial(rawURL string, opts ...DialOption) (*mgo.Session, error) {
+	return v2.Dial(rawURL, opts...)
+}
+
+// NewSessionHandlerFromURL dials url with the options, see Dial, and returns the
+// SessionHandler of cfg with the session as its parent session, in place of cfg.Sess.
+func NewSessionHandlerFromURL(rawURL string, cfg SessionHandlerConfig, opts ...DialOption) (http.Handler, error) {
+	return v2.NewSessionHandlerFromURL(rawURL, cfg, opts...)
+}
+
+type (
+	DocumentTooLargeError = v2.DocumentTooLargeError
+	DocumentSizeCheck     = v2.DocumentSizeCheck
+)
+
+const MaxDocumentBytes = v2.MaxDocumentBytes
+
+var ErrDocumentTooLarge = v2.ErrDocumentTooLarge
+
+// EstimateDocumentSize returns the size of doc once encoded to BSON.
+func EstimateDocumentSize(doc interface{}) (int, error) {
+	return v2.EstimateDocumentSize(doc)
+}
+
+// EstimateUpdateGrowth returns an upper bound of the bytes update adds to the document it's
+// applied to: the size of the values it sets, pushes or adds, as if none of them replaced an
+// existing one.
+func EstimateUpdateGrowth(update interface{}) (int, error) {
+	return v2.EstimateUpdateGrowth(update)
+}
+
+type (
+	Driver        = v2.Driver
+	DriverSession = v2.DriverSession
+)
+
+type ErrorMapper = v2.ErrorMapper
+
+var ErrRequestTimeout = v2.ErrRequestTimeout
+
+// DefaultErrorMapper maps duplicate keys to 409, missing documents to 404, rejected selectors
+// and invalid page tokens to 400, documents outgrowing the size limit to 413, timeouts,
+// disabled collections, throttling and shutdowns to 503 and anything else to 500.
+func DefaultErrorMapper(err error) (int, []byte) {
+	return v2.DefaultErrorMapper(err)
+}
+
+// WriteError answers the request with the status and body the ErrorMapper of the request's
+// SessionHandler maps err to, or DefaultErrorMapper's, so handlers answer their own Mongo
+// errors consistently.
+func WriteError(w http.ResponseWriter, r *http.Request, err error) {
+	v2.WriteError(w, r, err)
+}
+
+type (
+	ExportSink     = v2.ExportSink
+	ExportOptions  = v2.ExportOptions
+	ExportProgress = v2.ExportProgress
+)
+
+// Export hands every document of collection matching query to sink, in batches sorted by _id.
+func Export(ctx context.Context, collection MongoCollection, query bson.M, sink ExportSink, opts ExportOptions) (ExportProgress, error) {
+	return v2.Export(ctx, collection, query, sink, opts)
+}
+
+type (
+	ExtJSONMode = v2.ExtJSONMode
+	ExtJSON     = v2.ExtJSON
+)
+
+const (
+	ExtJSONRelaxed   = v2.ExtJSONRelaxed
+	ExtJSONCanonical = v2.ExtJSONCanonical
+)
+
+// MarshalExtJSON returns v as MongoDB Extended JSON (v2), in place of the custom MarshalJSON
+// methods documents with ObjectIds, dates or decimals otherwise need. v is anything the
+// wrappers return: a document (bson.M, bson.D, bson.Raw or a struct with bson tags), or a
+// slice of them as filled by All.
+func MarshalExtJSON(v interface{}, mode ExtJSONMode) ([]byte, error) {
+	return v2.MarshalExtJSON(v, mode)
+}
+
+// QueryFingerprint returns a stable identifier of the shape of an operation: the operation,
+// the collection, and the fields and operators of its selector, without their values.
+func QueryFingerprint(op, collection string, selector interface{}) string {
+	return v2.QueryFingerprint(op, collection, selector)
+}
+
+type (
+	SelectorTooComplexError = v2.SelectorTooComplexError
+	SelectorLimits          = v2.SelectorLimits
+)
+
+var ErrSelectorTooComplex = v2.ErrSelectorTooComplex
+
+type (
+	HealthMonitorConfig = v2.HealthMonitorConfig
+	HealthMonitor       = v2.HealthMonitor
+	HealthSnapshot      = v2.HealthSnapshot
+	ShedRule            = v2.ShedRule
+)
+
+// NewHealthMonitor returns a HealthMonitor, set it as SessionHandlerConfig.HealthMonitor to
+// feed it.
+func NewHealthMonitor(cfg HealthMonitorConfig) *HealthMonitor {
+	return v2.NewHealthMonitor(cfg)
+}
+
+// PathPrefix returns a ShedRule matcher for requests whose path starts with one of prefixes.
+func PathPrefix(prefixes ...string) func(r *http.Request) bool {
+	return v2.PathPrefix(prefixes...)
+}
+
+type (
+	HealthHandlerOptions = v2.HealthHandlerOptions
+	HealthReport         = v2.HealthReport
+)
+
+// NewHealthHandler returns a handler that pings Mongo on a copy of sess and reports the
+// outcome as a HealthReport, with status 200 when the server answered and 503 otherwise.
+func NewHealthHandler(sess *mgo.Session, opts HealthHandlerOptions) http.Handler {
+	return v2.NewHealthHandler(sess, opts)
+}
+
+const EventIterHeartbeat = v2.EventIterHeartbeat
+
+type InvalidIDError = v2.InvalidIDError
+
+var ErrInvalidID = v2.ErrInvalidID
+
+// ParseID parses the hex representation of an ObjectId, e.g. from a URL.
+func ParseID(s string) (bson.ObjectId, error) {
+	return v2.ParseID(s)
+}
+
+// IsValidID is whether s is the hex representation of an ObjectId.
+func IsValidID(s string) bool {
+	return v2.IsValidID(s)
+}
+
+type (
+	IndexBuildDeferredError = v2.IndexBuildDeferredError
+	IndexPolicy             = v2.IndexPolicy
+)
+
+var ErrIndexBuildDeferred = v2.ErrIndexBuildDeferred
+
+// EnsureIndexes builds indexes, by collection, in the background on database, one at a time.
+func EnsureIndexes(sess *mgo.Session, database string, indexes map[string][]mgo.Index) error {
+	return v2.EnsureIndexes(sess, database, indexes)
+}
+
+type (
+	OpInfo      = v2.OpInfo
+	Interceptor = v2.Interceptor
+)
+
+type (
+	MongoSession    = v2.MongoSession
+	MongoDatabase   = v2.MongoDatabase
+	MongoGridFS     = v2.MongoGridFS
+	MongoGridFile   = v2.MongoGridFile
+	MongoCollection = v2.MongoCollection
+	MongoPipe       = v2.MongoPipe
+	MongoBulk       = v2.MongoBulk
+	MongoQuery      = v2.MongoQuery
+	MongoIter       = v2.MongoIter
+	ChangeStream    = v2.ChangeStream
+)
+
+type CollectionDisabledError = v2.CollectionDisabledError
+
+var ErrCollectionDisabled = v2.ErrCollectionDisabled
+
+// DisableCollection turns off all access to a collection through the traced wrappers.
+func DisableCollection(database, collection string) {
+	v2.DisableCollection(database, collection)
+}
+
+// EnableCollection reverses DisableCollection.
+func EnableCollection(database, collection string) {
+	v2.EnableCollection(database, collection)
+}
+
+// IsCollectionDisabled reports whether DisableCollection is in effect for a collection.
+func IsCollectionDisabled(database, collection string) bool {
+	return v2.IsCollectionDisabled(database, collection)
+}
+
+// DisabledCollections lists the currently disabled collections as "database.collection".
+func DisabledCollections() []string {
+	return v2.DisabledCollections()
+}
+
+type (
+	UnboundedQueryError = v2.UnboundedQueryError
+	LimitPolicy         = v2.LimitPolicy
+)
+
+var ErrUnboundedQuery = v2.ErrUnboundedQuery
+
+type Metrics = v2.Metrics
+
+// NewMetrics registers the mgohttp metrics with reg.
+func NewMetrics(reg prometheus.Registerer) (*Metrics, error) {
+	return v2.NewMetrics(reg)
+}
+
+type (
+	MirrorConfig = v2.MirrorConfig
+	MirrorStats  = v2.MirrorStats
+	Mirror       = v2.Mirror
+)
+
+// NewMirror starts the workers of a Mirror.
+func NewMirror(cfg MirrorConfig) *Mirror {
+	return v2.NewMirror(cfg)
+}
+
+// WithMode sets the consistency mode of the request's session for the sessions retrieved with
+// FromContext(ctx, ...), e.g. mgo.SecondaryPreferred for endpoints that can read from
+// secondaries.
+func WithMode(ctx context.Context, mode mgo.Mode) context.Context {
+	return v2.WithMode(ctx, mode)
+}
+
+var ErrGridFSUnsupported = v2.ErrGridFSUnsupported
+
+// NewMongoDriver returns the Driver opening the sessions of a SessionHandler's databases on
+// client, a client of the official driver (go.mongodb.org/mongo-driver), so the handlers
+// written against the MongoSession interfaces can move off mgo one database at a time.
+func NewMongoDriver(client *mongo.Client) Driver {
+	return v2.NewMongoDriver(client)
+}
+
+type (
+	NearestReadsConfig = v2.NearestReadsConfig
+	NearestRouterStats = v2.NearestRouterStats
+	NearestRouter      = v2.NearestRouter
+)
+
+// NewNearestRouter starts probing the members of the replica set behind cfg.Sess.
+func NewNearestRouter(cfg NearestReadsConfig) *NearestRouter {
+	return v2.NewNearestRouter(cfg)
+}
+
+var ErrNopSession = v2.ErrNopSession
+
+// NopSession returns a MongoSession that never touches a database: databases, collections and
+// queries can be derived from it as usual, but every operation fails with ErrNopSession.
+func NopSession() MongoSession {
+	return v2.NopSession()
+}
+
+type OpError = v2.OpError
+
+type (
+	OpLimitError    = v2.OpLimitError
+	OpLimit         = v2.OpLimit
+	OpLimiterConfig = v2.OpLimiterConfig
+	OpLimiter       = v2.OpLimiter
+)
+
+var ErrOpLimited = v2.ErrOpLimited
+
+// NewOpLimiter returns an OpLimiter enforcing cfg.
+func NewOpLimiter(cfg OpLimiterConfig) *OpLimiter {
+	return v2.NewOpLimiter(cfg)
+}
+
+// Optional runs fn, a nice-to-have lookup such as an enrichment, on the request's Database
+// only when it isn't likely to hurt the request, and reports whether it ran and succeeded.
+func Optional(ctx context.Context, fn func(db MongoDatabase) error) bool {
+	return v2.Optional(ctx, fn)
+}
+
+type (
+	InvalidPageTokenError = v2.InvalidPageTokenError
+	PageToken             = v2.PageToken
+	PageTokenSigner       = v2.PageTokenSigner
+)
+
+var ErrInvalidPageToken = v2.ErrInvalidPageToken
+
+// NewPageTokenSigner returns a PageTokenSigner signing with key.
+func NewPageTokenSigner(key []byte, previous ...[]byte) *PageTokenSigner {
+	return v2.NewPageTokenSigner(key, previous...)
+}
+
+type PageOptions = v2.PageOptions
+
+// Page is a page of Paginate. It's a type of its own rather than an alias of v2's Page, as
+// the aliases of generic types take Go 1.24.
+type Page[T any] v2.Page[T]
+
+const DefaultPageLimit = v2.DefaultPageLimit
+
+// Paginate returns the page of the documents of query after opts.After, decoded as Ts.
+func Paginate[T any](ctx context.Context, query MongoQuery, opts PageOptions) (Page[T], error) {
+	page, err := v2.Paginate[T](ctx, query, opts)
+	return Page[T](page), err
+}
+
+type DriverPanicError = v2.DriverPanicError
+
+var ErrDriverPanic = v2.ErrDriverPanic
+
+type PingInfo = v2.PingInfo
+
+type (
+	SessionPoolConfig = v2.SessionPoolConfig
+	SessionPool       = v2.SessionPool
+	SessionPoolStats  = v2.SessionPoolStats
+)
+
+// NewSessionPool fills a SessionPool with copies of parent.
+func NewSessionPool(parent *mgo.Session, cfg SessionPoolConfig) *SessionPool {
+	return v2.NewSessionPool(parent, cfg)
+}
+
+type QueryBudgetExceededError = v2.QueryBudgetExceededError
+
+var ErrQueryBudgetExceeded = v2.ErrQueryBudgetExceeded
+
+type (
+	QueryLogMode = v2.QueryLogMode
+	QueryLogging = v2.QueryLogging
+)
+
+const (
+	QueryLogKeys   = v2.QueryLogKeys
+	QueryLogValues = v2.QueryLogValues
+	QueryLogHashed = v2.QueryLogHashed
+)
+
+// WithQueryTag returns a copy of ctx whose Mongo operations are tagged with key and value,
+// e.g. WithQueryTag(ctx, "feature", "report-export"), so database load can be attributed to
+// product features.
+func WithQueryTag(ctx context.Context, key, value string) context.Context {
+	return v2.WithQueryTag(ctx, key, value)
+}
+
+type ReadOnlyRoutes = v2.ReadOnlyRoutes
+
+type (
+	ReadTags       = v2.ReadTags
+	ReadPreference = v2.ReadPreference
+)
+
+// WithRequestReadPreference routes the reads of the sessions retrieved with FromContext(ctx,
+// ...) to the replica set members matching p, overriding the handler's ReadPreference, e.g.
+// ReadTags{"workload": "analytics"} for reporting endpoints.
+func WithRequestReadPreference(ctx context.Context, p ReadPreference) context.Context {
+	return v2.WithRequestReadPreference(ctx, p)
+}
+
+type (
+	RepairRule       = v2.RepairRule
+	ReadRepairConfig = v2.ReadRepairConfig
+	ReadRepairStats  = v2.ReadRepairStats
+	ReadRepairer     = v2.ReadRepairer
+)
+
+// NewReadRepairer starts the workers of a ReadRepairer.
+func NewReadRepairer(cfg ReadRepairConfig) *ReadRepairer {
+	return v2.NewReadRepairer(cfg)
+}
+
+type (
+	OpStats      = v2.OpStats
+	OpKey        = v2.OpKey
+	RequestStats = v2.RequestStats
+)
+
+// WithStats returns a context collecting the RequestStats of the request it's the context of,
+// for middlewares wrapping the SessionHandler, which can't see the context it gives the
+// handlers.
+func WithStats(ctx context.Context) context.Context {
+	return v2.WithStats(ctx)
+}
+
+// StatsFromContext returns the counts and cumulative durations of the operations the request
+// of ctx ran so far, by collection and operation, to spot N+1 query patterns.
+func StatsFromContext(ctx context.Context) RequestStats {
+	return v2.StatsFromContext(ctx)
+}
+
+type (
+	Rollout  = v2.Rollout
+	Rollouts = v2.Rollouts
+)
+
+const (
+	RolloutDeferUntilSession   = v2.RolloutDeferUntilSession
+	RolloutInSplit             = v2.RolloutInSplit
+	RolloutExplainSlowQueries  = v2.RolloutExplainSlowQueries
+	RolloutRecoverDriverPanics = v2.RolloutRecoverDriverPanics
+)
+
+// NewRollouts returns Rollouts applying each behavior to percent (0 to 100) of the requests.
+func NewRollouts(percent map[Rollout]int) *Rollouts {
+	return v2.NewRollouts(percent)
+}
+
+type (
+	SessionHandlerConfig = v2.SessionHandlerConfig
+	DatabaseConfig       = v2.DatabaseConfig
+	SessionHandler       = v2.SessionHandler
+	SessionHandlerStats  = v2.SessionHandlerStats
+)
+
+// NewSessionHandler returns a new SessionHandler, the http.Handler injecting the sessions of
+// cfg's databases into the context of the requests.
+func NewSessionHandler(cfg SessionHandlerConfig) http.Handler {
+	return v2.NewSessionHandler(cfg)
+}
+
+// FromContext retrieves a *mgo.Session from the request context.
+func FromContext(ctx context.Context, database string) MongoSession {
+	return v2.FromContext(ctx, database)
+}
+
+var ErrTooManySessions = v2.ErrTooManySessions
+
+var ErrShuttingDown = v2.ErrShuttingDown
+
+var ErrSnapshotReadsUnsupported = v2.ErrSnapshotReadsUnsupported
+
+// WithSnapshotReads asks for every query of the sessions retrieved with FromContext(ctx, ...)
+// to read from the same snapshot, e.g. for reports that need a consistent view across
+// collections.
+func WithSnapshotReads(ctx context.Context) context.Context {
+	return v2.WithSnapshotReads(ctx)
+}
+
+// WithSRVRefresh re-resolves the SRV records of a mongodb+srv URL every interval with
+// NewSessionHandlerFromURL, and dials a new parent session for the handler when the hosts
+// change, e.g. when the mongos of a sharded cluster are replaced. mgo discovers the changes of
+// a replica set's members on its own, as long as one of the hosts it knows is up.
+func WithSRVRefresh(interval time.Duration) DialOption {
+	return v2.WithSRVRefresh(interval)
+}
+
+const (
+	TagCollection               = v2.TagCollection
+	TagDatabase                 = v2.TagDatabase
+	TagAccessMethod             = v2.TagAccessMethod
+	TagSort                     = v2.TagSort
+	TagCollation                = v2.TagCollation
+	TagCollectionDisabled       = v2.TagCollectionDisabled
+	TagInSplitChunks            = v2.TagInSplitChunks
+	TagInSplitSkipped           = v2.TagInSplitSkipped
+	TagSelectorTooComplex       = v2.TagSelectorTooComplex
+	TagSelectorTooComplexReason = v2.TagSelectorTooComplexReason
+	TagSelectorUnsupported      = v2.TagSelectorUnsupported
+	TagUnanchoredRegex          = v2.TagUnanchoredRegex
+	TagServerAddress            = v2.TagServerAddress
+	TagServerState              = v2.TagServerState
+	TagServerVersion            = v2.TagServerVersion
+	TagReadMode                 = v2.TagReadMode
+	TagWriteConcern             = v2.TagWriteConcern
+	TagReadTags                 = v2.TagReadTags
+	TagReadMember               = v2.TagReadMember
+	TagDefaultLimit             = v2.TagDefaultLimit
+	TagUnboundedQuery           = v2.TagUnboundedQuery
+	TagExplainPlan              = v2.TagExplainPlan
+	TagExplainDocsExamined      = v2.TagExplainDocsExamined
+	TagExplainKeysExamined      = v2.TagExplainKeysExamined
+	TagExplainReturned          = v2.TagExplainReturned
+	TagCancelled                = v2.TagCancelled
+	TagCancellationReason       = v2.TagCancellationReason
+	TagBufferedResponseBytes    = v2.TagBufferedResponseBytes
+	TagSessionThrottled         = v2.TagSessionThrottled
+	TagOpLimited                = v2.TagOpLimited
+	TagBulkUnordered            = v2.TagBulkUnordered
+	TagRepairField              = v2.TagRepairField
+	TagReadConcern              = v2.TagReadConcern
+	TagReadConsistency          = v2.TagReadConsistency
+	TagRolloutsExcluded         = v2.TagRolloutsExcluded
+	TagIndexForcedBackground    = v2.TagIndexForcedBackground
+	TagQueryFingerprint         = v2.TagQueryFingerprint
+	TagDocumentNearLimit        = v2.TagDocumentNearLimit
+	TagCursorID                 = v2.TagCursorID
+	TagCursorGetMores           = v2.TagCursorGetMores
+	TagCursorAvgBatch           = v2.TagCursorAvgBatch
+	TagCursorDocs               = v2.TagCursorDocs
+	TagCursorLifetimeMs         = v2.TagCursorLifetimeMs
+	TagCursorGetMoresEstimated  = v2.TagCursorGetMoresEstimated
+	TagIndexBuildDeferred       = v2.TagIndexBuildDeferred
+	TagOpComment                = v2.TagOpComment
+	TagOpSpansSampledOut        = v2.TagOpSpansSampledOut
+	TagDebug                    = v2.TagDebug
+	TagReadOnlyRoute            = v2.TagReadOnlyRoute
+	TagQueryBudgetExceeded      = v2.TagQueryBudgetExceeded
+	TagSessionRefreshed         = v2.TagSessionRefreshed
+	TagChildSession             = v2.TagChildSession
+	TagPageLimit                = v2.TagPageLimit
+	TagPageSort                 = v2.TagPageSort
+	TagPageResumed              = v2.TagPageResumed
+	TagPageDocs                 = v2.TagPageDocs
+	TagPageHasNext              = v2.TagPageHasNext
+	TagDBSystem                 = v2.TagDBSystem
+	TagDBName                   = v2.TagDBName
+	TagDBOperation              = v2.TagDBOperation
+	TagDBMongoDBCollection      = v2.TagDBMongoDBCollection
+	LogSelector                 = v2.LogSelector
+	LogUpdate                   = v2.LogUpdate
+	LogSelect                   = v2.LogSelect
+	LogHintPrefix               = v2.LogHintPrefix
+	LogQueryLimit               = v2.LogQueryLimit
+	LogQuerySkip                = v2.LogQuerySkip
+	LogQueryBatch               = v2.LogQueryBatch
+	LogQueryPrefetch            = v2.LogQueryPrefetch
+	LogQueryMaxTimeMillis       = v2.LogQueryMaxTimeMillis
+	LogTailTimeoutMillis        = v2.LogTailTimeoutMillis
+	LogSocketTimeoutMillis      = v2.LogSocketTimeoutMillis
+	LogTailTimeouts             = v2.LogTailTimeouts
+	LogTransactionAttempts      = v2.LogTransactionAttempts
+	LogNumDocs                  = v2.LogNumDocs
+	LogCommand                  = v2.LogCommand
+	LogRTTMillis                = v2.LogRTTMillis
+	LogCollationStrength        = v2.LogCollationStrength
+	LogRemove                   = v2.LogRemove
+	LogReturnNew                = v2.LogReturnNew
+	LogUpsert                   = v2.LogUpsert
+	LogBulkOps                  = v2.LogBulkOps
+	LogBulkOpsPrefix            = v2.LogBulkOpsPrefix
+	LogBulkMatched              = v2.LogBulkMatched
+	LogBulkModified             = v2.LogBulkModified
+	LogIterDocs                 = v2.LogIterDocs
+	LogIterElapsedMillis        = v2.LogIterElapsedMillis
+	LogBatchDocs                = v2.LogBatchDocs
+	LogResultBytes              = v2.LogResultBytes
+	LogDecisionReason           = v2.LogDecisionReason
+	LogIndexKey                 = v2.LogIndexKey
+	LogIndexName                = v2.LogIndexName
+	LogIndexUnique              = v2.LogIndexUnique
+	LogIndexSparse              = v2.LogIndexSparse
+	LogIndexBackground          = v2.LogIndexBackground
+	LogIndexExpireAfter         = v2.LogIndexExpireAfter
+	LogNumIndexes               = v2.LogNumIndexes
+	LogFileName                 = v2.LogFileName
+	LogBytesRead                = v2.LogBytesRead
+	LogBytesWritten             = v2.LogBytesWritten
+	LogNumCollections           = v2.LogNumCollections
+	LogCappedMaxBytes           = v2.LogCappedMaxBytes
+	LogCappedMaxDocs            = v2.LogCappedMaxDocs
+	LogCollectionCount          = v2.LogCollectionCount
+	LogCollectionSize           = v2.LogCollectionSize
+	LogError                    = v2.LogError
+)
+
+var (
+	ErrCollatedTail    = v2.ErrCollatedTail
+	ErrReadConcernTail = v2.ErrReadConcernTail
+)
+
+// WithRequestTimeout overrides the SessionHandler's Timeout for the request of ctx.
+func WithRequestTimeout(ctx context.Context, d time.Duration) context.Context {
+	return v2.WithRequestTimeout(ctx, d)
+}
+
+var (
+	ErrTransactionsUnsupported = v2.ErrTransactionsUnsupported
+	ErrNestedTransaction       = v2.ErrNestedTransaction
+)
+
+type UsageReport = v2.UsageReport
+
+// StartUsageRecording turns on the usage analyzer and resets any previously recorded usage.
+func StartUsageRecording() {
+	v2.StartUsageRecording()
+}
+
+// StopUsageRecording turns off the usage analyzer and returns the final report.
+func StopUsageRecording() UsageReport {
+	return v2.StopUsageRecording()
+}
+
+// CurrentUsageReport returns a snapshot of the usage recorded so far.
+func CurrentUsageReport() UsageReport {
+	return v2.CurrentUsageReport()
+}
+
+// UsageReportHandler serves the current usage report as JSON, so it can be mounted on an
+// internal route and scraped at the end of a soak window.
+func UsageReportHandler() http.Handler {
+	return v2.UsageReportHandler()
+}
+
+type ServerFeature = v2.ServerFeature
+
+var (
+	FeatureMaxTimeMS     = v2.FeatureMaxTimeMS
+	FeatureReadConcern   = v2.FeatureReadConcern
+	FeatureCollation     = v2.FeatureCollation
+	FeatureExpr          = v2.FeatureExpr
+	FeatureTransactions  = v2.FeatureTransactions
+	FeatureSnapshotReads = v2.FeatureSnapshotReads
+)
+
+type (
+	ResumeToken         = v2.ResumeToken
+	ChangeEvent         = v2.ChangeEvent
+	UpdateDescription   = v2.UpdateDescription
+	ChangeStreamOptions = v2.ChangeStreamOptions
+)
+
+var ErrWatchPipelineUnsupported = v2.ErrWatchPipelineUnsupported
@@ -0,0 +1,48 @@
+package mgohttp_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Clever/mgohttp"
+	"github.com/Clever/mgohttp/mgohttptest"
+	v2 "github.com/Clever/mgohttp/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/mgo.v2/bson"
+)
+
+func TestV1SessionsAreV2Sessions(t *testing.T) {
+	fake := mgohttptest.NewFakeMongo()
+	h, err := v2.New(v2.Sessions(func(ctx context.Context, database string) mgohttp.MongoSession {
+		return fake.Session()
+	}), "test")
+	require.NoError(t, err)
+
+	var count int
+	h.Wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, v2.FromContext(r.Context(), "test").DB("test").C("users").Insert(bson.M{"name": "a"}))
+		// v1's FromContext finds the same sessions
+		var err error
+		count, err = mgohttp.FromContext(r.Context(), "test").DB("test").C("users").Find(nil).Count()
+		require.NoError(t, err)
+	})).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	assert.Equal(t, 1, count)
+
+	// and the contexts of v1's mgohttptest hold v2 sessions
+	db := mgohttptest.MakeContext(context.Background(), mgohttptest.Config{Name: "test", Fake: fake})
+	defer db.Close()
+	n, err := v2.FromContext(db, "test").DB("test").C("users").Find(nil).Count()
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+}
+
+func TestV1ErrorsAreV2Errors(t *testing.T) {
+	assert.True(t, errors.Is(mgohttp.ErrRequestTimeout, v2.ErrRequestTimeout))
+	assert.True(t, mgohttp.IsTimeout(v2.ErrBudgetExpired))
+	var disabled v2.CollectionDisabledError
+	assert.True(t, errors.As(mgohttp.CollectionDisabledError{Database: "app", Collection: "users"}, &disabled))
+}
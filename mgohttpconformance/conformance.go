@@ -0,0 +1,17 @@
+// Package mgohttpconformance is the test suite asserting the behavioral contract of the
+// mgohttp interfaces, v2's github.com/Clever/mgohttp/v2/mgohttpconformance: a backend of
+// either version runs it from one of its tests with Run.
+package mgohttpconformance
+
+import (
+	"testing"
+
+	v2 "github.com/Clever/mgohttp/v2/mgohttpconformance"
+)
+
+type Factory = v2.Factory
+
+// Run runs the conformance suite against the backend returned by newBackend, as subtests of t.
+func Run(t *testing.T, newBackend Factory) {
+	v2.Run(t, newBackend)
+}
@@ -0,0 +1,104 @@
+// Package mgohttptest provides the context, fakes and servers for testing the handlers using
+// mgohttp. It's implemented by v2's, github.com/Clever/mgohttp/v2/mgohttptest, whose types
+// these are aliases of, so it works with the sessions of both versions.
+package mgohttptest
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	v2 "github.com/Clever/mgohttp/v2/mgohttptest"
+	"github.com/opentracing/opentracing-go/mocktracer"
+	mgo "gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+type FakeMongo = v2.FakeMongo
+
+var ErrFakeUnsupported = v2.ErrFakeUnsupported
+
+// NewFakeMongo returns an empty FakeMongo.
+func NewFakeMongo() *FakeMongo {
+	return v2.NewFakeMongo()
+}
+
+type Operation = v2.Operation
+
+// Fields lists the fields of a selector or update, dotted and sorted, e.g. Fields of
+// bson.M{"$set": bson.M{"name": "ada"}} is ["$set.name"], to assert on the shape of an
+// operation rather than on its values.
+func Fields(doc interface{}) []string {
+	return v2.Fields(doc)
+}
+
+// Seed loads fixtures in the database cfg describes, on its session or its fake, for the tests
+// that set up their context without MakeContext.
+func Seed(t testing.TB, cfg Config, fixtures Fixtures) {
+	v2.Seed(t, cfg, fixtures)
+}
+
+type (
+	Fixtures       = v2.Fixtures
+	HandlerFactory = v2.HandlerFactory
+	MongoServer    = v2.MongoServer
+)
+
+const DefaultMongoURL = v2.DefaultMongoURL
+
+// ServeWithMongo stands up the handler built by newHandler on a fresh database of the server
+// at MONGO_URL, holding fixtures, for end-to-end tests of handlers and their middleware,
+// timeouts included.
+func ServeWithMongo(t testing.TB, newHandler HandlerFactory, fixtures Fixtures) *MongoServer {
+	return v2.ServeWithMongo(t, newHandler, fixtures)
+}
+
+// SlowSelector returns a selector matching every document that makes the server spend about d
+// on each document it examines, to test timeouts against a real server.
+func SlowSelector(d time.Duration) bson.M {
+	return v2.SlowSelector(d)
+}
+
+// EnsureDocument inserts a document in the collection unless it already holds one, so
+// SlowSelector has something to examine.
+func EnsureDocument(c *mgo.Collection) error {
+	return v2.EnsureDocument(c)
+}
+
+// BlockCommands makes the server hold every one of the commands (e.g. "find", "insert") for d
+// before running it, with the failCommand fail point.
+func BlockCommands(sess *mgo.Session, d time.Duration, commands ...string) (func() error, error) {
+	return v2.BlockCommands(sess, d, commands...)
+}
+
+// FinishedSpans returns the spans finished on tracer with the operation name, e.g. "find".
+func FinishedSpans(tracer *mocktracer.MockTracer, operationName string) []*mocktracer.MockSpan {
+	return v2.FinishedSpans(tracer, operationName)
+}
+
+// SpansWithTag returns the spans finished on tracer that carry the tag key with value, e.g.
+// SpansWithTag(tracer, mgohttp.TagCollection, "users").
+func SpansWithTag(tracer *mocktracer.MockTracer, key string, value interface{}) []*mocktracer.MockSpan {
+	return v2.SpansWithTag(tracer, key, value)
+}
+
+// Tag returns the value of the tag key on sp.
+func Tag(sp *mocktracer.MockSpan, key string) (interface{}, bool) {
+	return v2.Tag(sp, key)
+}
+
+// LogValue returns the value of the last log field key on sp, e.g. LogValue(sp,
+// mgohttp.LogSelector). mocktracer records log values as strings.
+func LogValue(sp *mocktracer.MockSpan, key string) (string, bool) {
+	return v2.LogValue(sp, key)
+}
+
+type (
+	Config    = v2.Config
+	DbHandler = v2.DbHandler
+)
+
+// MakeContext creates a new Context that contains mgohttp database connections.
+func MakeContext(ctx context.Context, cfgs ...Config) DbHandler {
+	return v2.MakeContext(ctx, cfgs...)
+}
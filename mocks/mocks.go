@@ -0,0 +1,19 @@
+// Package mocks provides mocks of the mgohttp interfaces, for unit testing the code that
+// uses them. They're v2's, github.com/Clever/mgohttp/v2/mocks, which implement the interfaces
+// of both versions.
+package mocks
+
+import v2 "github.com/Clever/mgohttp/v2/mocks"
+
+type (
+	MongoSession    = v2.MongoSession
+	MongoDatabase   = v2.MongoDatabase
+	MongoCollection = v2.MongoCollection
+	MongoQuery      = v2.MongoQuery
+	MongoPipe       = v2.MongoPipe
+	MongoIter       = v2.MongoIter
+	ChangeStream    = v2.ChangeStream
+	MongoBulk       = v2.MongoBulk
+	MongoGridFS     = v2.MongoGridFS
+	MongoGridFile   = v2.MongoGridFile
+)
@@ -0,0 +1,99 @@
+package mgohttp
+
+import (
+	opentracinglog "github.com/opentracing/opentracing-go/log"
+	mgo "gopkg.in/mgo.v2"
+	bson "gopkg.in/mgo.v2/bson"
+)
+
+func (t tracedMgoDatabase) CollectionNames() (names []string, err error) {
+	recordUsage("MongoDatabase.CollectionNames")
+	sp, _ := startOp(t.ctx, "collection-names", "")
+	defer sp.Finish()
+	defer sp.recoverPanic(&err)
+
+	err = sp.intercept(OpInfo{}, func(*OpInfo) (err error) {
+		names, err = t.db.CollectionNames()
+		return err
+	})
+	sp.LogFields(opentracinglog.Int(LogNumCollections, len(names)))
+	return names, sp.done(err)
+}
+
+func (t tracedMgoDatabase) DropDatabase() (err error) {
+	recordUsage("MongoDatabase.DropDatabase")
+	sp, _ := startOp(t.ctx, "drop-database", "")
+	defer sp.Finish()
+	defer sp.recoverPanic(&err)
+
+	return sp.done(sp.intercept(OpInfo{}, func(*OpInfo) error { return t.db.DropDatabase() }))
+}
+
+func (tc tracedMgoCollection) DropCollection() (err error) {
+	recordUsage("MongoCollection.DropCollection")
+	sp, _ := startOp(tc.ctx, "drop-collection", tc.collectionName)
+	defer sp.Finish()
+	defer sp.recoverPanic(&err)
+	if err := tc.guard(sp, nil); err != nil {
+		return logAndReturnErr(sp, err)
+	}
+
+	return sp.done(sp.intercept(OpInfo{}, func(*OpInfo) error { return tc.collection.DropCollection() }))
+}
+
+func (tc tracedMgoCollection) Create(info *mgo.CollectionInfo) (err error) {
+	recordUsage("MongoCollection.Create")
+	sp, _ := startOp(tc.ctx, "create-collection", tc.collectionName)
+	defer sp.Finish()
+	defer sp.recoverPanic(&err)
+	if info.Capped {
+		sp.LogFields(
+			opentracinglog.Int(LogCappedMaxBytes, info.MaxBytes),
+			opentracinglog.Int(LogCappedMaxDocs, info.MaxDocs),
+		)
+	}
+	if err := tc.guard(sp, nil); err != nil {
+		return logAndReturnErr(sp, err)
+	}
+
+	return sp.done(sp.intercept(OpInfo{}, func(*OpInfo) error { return tc.collection.Create(info) }))
+}
+
+// CollectionStats are the size and limits of a collection, as reported by collStats.
+type CollectionStats struct {
+	// Count is the number of documents, Size their size and AvgObjSize their average size,
+	// in bytes.
+	Count      int64 `bson:"count"`
+	Size       int64 `bson:"size"`
+	AvgObjSize int64 `bson:"avgObjSize"`
+	// StorageSize is the space allocated to the documents, TotalIndexSize and IndexSizes
+	// the size of the indexes, in bytes.
+	StorageSize    int64            `bson:"storageSize"`
+	NumIndexes     int              `bson:"nindexes"`
+	TotalIndexSize int64            `bson:"totalIndexSize"`
+	IndexSizes     map[string]int64 `bson:"indexSizes"`
+	// Capped is set for a capped collection, of MaxSize bytes and MaxDocs documents, zero
+	// for no limit.
+	Capped  bool  `bson:"capped"`
+	MaxSize int64 `bson:"maxSize"`
+	MaxDocs int64 `bson:"max"`
+}
+
+func (tc tracedMgoCollection) Stats() (stats CollectionStats, err error) {
+	recordUsage("MongoCollection.Stats")
+	sp, _ := startOp(tc.ctx, "coll-stats", tc.collectionName)
+	defer sp.Finish()
+	defer sp.recoverPanic(&err)
+	if err := tc.guard(sp, nil); err != nil {
+		return CollectionStats{}, logAndReturnErr(sp, err)
+	}
+
+	err = sp.intercept(OpInfo{}, func(*OpInfo) error {
+		return tc.collection.Database.Run(bson.D{{Name: "collStats", Value: tc.collection.Name}}, &stats)
+	})
+	if err != nil {
+		return CollectionStats{}, sp.done(err)
+	}
+	sp.LogFields(opentracinglog.Int64(LogCollectionCount, stats.Count), opentracinglog.Int64(LogCollectionSize, stats.Size))
+	return stats, sp.done(nil)
+}
@@ -0,0 +1,74 @@
+package mgohttp_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Clever/mgohttp/v2"
+	"github.com/Clever/mgohttp/v2/mgohttptest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	mgo "gopkg.in/mgo.v2"
+	bson "gopkg.in/mgo.v2/bson"
+)
+
+func TestSessionsBackend(t *testing.T) {
+	fake := mgohttptest.NewFakeMongo()
+	h, err := mgohttp.New(mgohttp.Sessions(func(ctx context.Context, database string) mgohttp.MongoSession {
+		return fake.Session()
+	}), "test", mgohttp.WithDatabases(mgohttp.DatabaseConfig{Database: "other"}))
+	require.NoError(t, err)
+
+	var count int
+	h.Wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, mgohttp.FromContext(r.Context(), "test").DB("test").C("users").Insert(bson.M{"name": "a"}))
+		var err error
+		count, err = mgohttp.FromContext(r.Context(), "test").DB("test").C("users").Find(nil).Count()
+		require.NoError(t, err)
+		assert.NotNil(t, mgohttp.FromContext(r.Context(), "other"))
+	})).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	assert.Equal(t, 1, count)
+}
+
+// fakeDriver opens sessions of a FakeMongo, recording the databases.
+type fakeDriver struct {
+	fake   *mgohttptest.FakeMongo
+	opened []string
+}
+
+func (d *fakeDriver) NewSession(ctx context.Context, database string, safe *mgo.Safe) (mgohttp.DriverSession, error) {
+	d.opened = append(d.opened, database)
+	return fakeDriverSession{d.fake}, nil
+}
+
+type fakeDriverSession struct {
+	fake *mgohttptest.FakeMongo
+}
+
+func (s fakeDriverSession) Session(ctx context.Context, pref *mgohttp.ReadPreference) mgohttp.MongoSession {
+	return s.fake.Session()
+}
+
+func (s fakeDriverSession) Close() {}
+
+func TestDriverBackend(t *testing.T) {
+	driver := &fakeDriver{fake: mgohttptest.NewFakeMongo()}
+	_, err := mgohttp.New(mgohttp.DriverBackend(driver), "test", mgohttp.WithHealthCheck("/healthz", time.Second))
+	assert.Error(t, err, "the driver has no mgo session to ping")
+
+	h, err := mgohttp.New(mgohttp.DriverBackend(driver), "test", mgohttp.WithDatabases(mgohttp.DatabaseConfig{Database: "other"}))
+	require.NoError(t, err)
+	var count int
+	h.Wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, mgohttp.FromContext(r.Context(), "test").DB("test").C("users").Insert(bson.M{"name": "a"}))
+		var err error
+		count, err = mgohttp.FromContext(r.Context(), "test").DB("test").C("users").Find(nil).Count()
+		require.NoError(t, err)
+		mgohttp.FromContext(r.Context(), "other")
+	})).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	assert.Equal(t, 1, count)
+	assert.Equal(t, []string{"test", "other"}, driver.opened)
+}
@@ -0,0 +1,179 @@
+package mgohttp
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	opentracing "github.com/opentracing/opentracing-go"
+	opentracinglog "github.com/opentracing/opentracing-go/log"
+	"gopkg.in/Clever/kayvee-go.v6/logger"
+	mgo "gopkg.in/mgo.v2"
+)
+
+// ErrBatchWriterClosed is returned by BatchWriter.Insert after Close.
+var ErrBatchWriterClosed = errors.New("mgohttp: batch writer closed")
+
+// BatchWriterConfig configures a BatchWriter.
+type BatchWriterConfig struct {
+	Sess       *mgo.Session
+	Database   string
+	Collection string
+	// MaxDocs flushes the batch once it holds this many documents.
+	MaxDocs int
+	// MaxLatency flushes the batch once its oldest document has waited this long.
+	MaxLatency time.Duration
+	// OnError is called with the documents of a batch that failed to insert. Errors are
+	// always logged.
+	OnError func(err error, docs []interface{})
+}
+
+// BatchWriter accumulates inserts from many requests and writes them in unordered bulk
+// inserts on a background goroutine. It's meant for high volume, loss tolerant collections
+// (event logs and the like) where per-request inserts would dominate the load on Mongo.
+//
+// Insert only enqueues the documents: write errors are reported through OnError rather than
+// to the caller.
+type BatchWriter struct {
+	cfg BatchWriterConfig
+	// insert writes a batch, it's only overridden by the tests.
+	insert func(docs []interface{}) error
+
+	mu       sync.RWMutex
+	closed   bool
+	docs     chan interface{}
+	flushReq chan chan struct{}
+	done     chan struct{}
+}
+
+// NewBatchWriter starts a BatchWriter. Call Close on shutdown to flush pending documents.
+func NewBatchWriter(cfg BatchWriterConfig) *BatchWriter {
+	if cfg.MaxDocs <= 0 {
+		cfg.MaxDocs = 1000
+	}
+	if cfg.MaxLatency <= 0 {
+		cfg.MaxLatency = time.Second
+	}
+	w := &BatchWriter{
+		cfg:      cfg,
+		docs:     make(chan interface{}, cfg.MaxDocs),
+		flushReq: make(chan chan struct{}),
+		done:     make(chan struct{}),
+	}
+	w.insert = w.bulkInsert
+	go w.run()
+	return w
+}
+
+// Insert enqueues documents for the next batch. It blocks only when the writer is a full
+// batch behind.
+func (w *BatchWriter) Insert(docs ...interface{}) error {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	if w.closed {
+		return ErrBatchWriterClosed
+	}
+	for _, doc := range docs {
+		w.docs <- doc
+	}
+	return nil
+}
+
+// Flush writes out everything enqueued so far and waits for it to complete.
+func (w *BatchWriter) Flush() {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	if w.closed {
+		return
+	}
+	ack := make(chan struct{})
+	w.flushReq <- ack
+	<-ack
+}
+
+// Close stops accepting documents, flushes the pending batch and waits for it to be written.
+func (w *BatchWriter) Close() {
+	w.mu.Lock()
+	if !w.closed {
+		w.closed = true
+		close(w.docs)
+	}
+	w.mu.Unlock()
+	<-w.done
+}
+
+func (w *BatchWriter) run() {
+	defer close(w.done)
+
+	batch := []interface{}{}
+	var timer *time.Timer
+	var timerC <-chan time.Time
+	flush := func() {
+		if timer != nil {
+			timer.Stop()
+			timer, timerC = nil, nil
+		}
+		if len(batch) == 0 {
+			return
+		}
+		w.write(batch)
+		batch = []interface{}{}
+	}
+
+	for {
+		select {
+		case doc, ok := <-w.docs:
+			if !ok {
+				flush()
+				return
+			}
+			batch = append(batch, doc)
+			if len(batch) == 1 {
+				timer = time.NewTimer(w.cfg.MaxLatency)
+				timerC = timer.C
+			}
+			if len(batch) >= w.cfg.MaxDocs {
+				flush()
+			}
+		case <-timerC:
+			flush()
+		case ack := <-w.flushReq:
+			// drain whatever was enqueued before the Flush call
+			for len(w.docs) > 0 {
+				batch = append(batch, <-w.docs)
+			}
+			flush()
+			close(ack)
+		}
+	}
+}
+
+func (w *BatchWriter) write(docs []interface{}) {
+	sp := opentracing.StartSpan("batch-insert")
+	defer sp.Finish()
+	sp.SetTag(TagCollection, w.cfg.Collection)
+	sp.LogFields(opentracinglog.Int(LogNumDocs, len(docs)))
+
+	if err := logAndReturnErr(sp, w.insert(docs)); err != nil {
+		logger.New("mgohttp").ErrorD("mgohttp-batch-insert-failed", logger.M{
+			"database":   w.cfg.Database,
+			"collection": w.cfg.Collection,
+			"num-docs":   len(docs),
+			"error":      err.Error(),
+		})
+		if w.cfg.OnError != nil {
+			w.cfg.OnError(err, docs)
+		}
+	}
+}
+
+func (w *BatchWriter) bulkInsert(docs []interface{}) error {
+	sess := w.cfg.Sess.Copy()
+	defer sess.Close()
+
+	bulk := sess.DB(w.cfg.Database).C(w.cfg.Collection).Bulk()
+	bulk.Unordered()
+	bulk.Insert(docs...)
+	_, err := bulk.Run()
+	return err
+}
@@ -0,0 +1,52 @@
+package mgohttp
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// newTestBatchWriter returns a BatchWriter that records its batches instead of writing them.
+func newTestBatchWriter(cfg BatchWriterConfig) (*BatchWriter, func() [][]interface{}) {
+	w := NewBatchWriter(cfg)
+	var mu sync.Mutex
+	batches := [][]interface{}{}
+	w.insert = func(docs []interface{}) error {
+		mu.Lock()
+		defer mu.Unlock()
+		batches = append(batches, docs)
+		return nil
+	}
+	return w, func() [][]interface{} {
+		mu.Lock()
+		defer mu.Unlock()
+		return batches
+	}
+}
+
+func TestBatchWriterFlushesOnSize(t *testing.T) {
+	w, batches := newTestBatchWriter(BatchWriterConfig{MaxDocs: 2, MaxLatency: time.Hour})
+	assert.NoError(t, w.Insert(1, 2, 3))
+	w.Flush()
+	assert.Equal(t, [][]interface{}{{1, 2}, {3}}, batches())
+	w.Close()
+}
+
+func TestBatchWriterFlushesOnLatency(t *testing.T) {
+	w, batches := newTestBatchWriter(BatchWriterConfig{MaxDocs: 100, MaxLatency: 10 * time.Millisecond})
+	defer w.Close()
+	assert.NoError(t, w.Insert(1))
+	assert.Eventually(t, func() bool { return len(batches()) == 1 }, time.Second, time.Millisecond)
+}
+
+func TestBatchWriterFlushesOnClose(t *testing.T) {
+	w, batches := newTestBatchWriter(BatchWriterConfig{MaxDocs: 100, MaxLatency: time.Hour})
+	assert.NoError(t, w.Insert(1, 2))
+	w.Close()
+	assert.Equal(t, [][]interface{}{{1, 2}}, batches())
+	assert.Equal(t, ErrBatchWriterClosed, w.Insert(3))
+	w.Flush() // no-op once closed
+	w.Close() // idempotent
+}
@@ -0,0 +1,81 @@
+package mgohttp
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	opentracing "github.com/opentracing/opentracing-go"
+	mgo "gopkg.in/mgo.v2"
+)
+
+var benchmarkBody = make([]byte, 4<<10)
+
+// benchmarkHandler serves requests that never ask for a session, so only the overhead of
+// the SessionHandler itself is measured. The timeout is long enough that a timer which isn't
+// stopped stays pending for the whole benchmark.
+func benchmarkHandler() *SessionHandler {
+	return NewSessionHandler(SessionHandlerConfig{
+		Database: testDBName,
+		Timeout:  time.Minute,
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write(benchmarkBody)
+		}),
+	}).(*SessionHandler)
+}
+
+func BenchmarkServeHTTP(b *testing.B) {
+	handler := benchmarkHandler()
+	req := httptest.NewRequest("GET", "/", nil)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+	}
+}
+
+func BenchmarkServeHTTPParallel(b *testing.B) {
+	handler := benchmarkHandler()
+	b.ReportAllocs()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		req := httptest.NewRequest("GET", "/", nil)
+		for pb.Next() {
+			handler.ServeHTTP(httptest.NewRecorder(), req)
+		}
+	})
+}
+
+func BenchmarkServeHTTPDeferUntilSession(b *testing.B) {
+	handler := benchmarkHandler()
+	handler.cfg.DeferUntilSession = true
+	req := httptest.NewRequest("GET", "/", nil)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+	}
+}
+
+// BenchmarkWrapperChain looks up a collection through its session and database, as handlers
+// do for every operation, with the wrappers memoized by the session and created every time.
+func BenchmarkWrapperChain(b *testing.B) {
+	ctx := opentracing.ContextWithSpan(context.Background(), opentracing.NoopTracer{}.StartSpan("caller"))
+	for _, bench := range []struct {
+		name      string
+		databases *wrapperCache[MongoDatabase]
+	}{
+		{"Memoized", newWrapperCache[MongoDatabase]()},
+		{"Uncached", nil},
+	} {
+		b.Run(bench.name, func(b *testing.B) {
+			sess := tracedMgoSession{sess: &mgo.Session{}, ctx: ctx, databases: bench.databases}
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				sess.DB(testDBName).C("users")
+			}
+		})
+	}
+}
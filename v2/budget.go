@@ -0,0 +1,60 @@
+package mgohttp
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"time"
+
+	mgo "gopkg.in/mgo.v2"
+)
+
+// ErrBudgetExpired is returned by MongoIter.Close and Err when the iteration was cut short
+// because the request's budget expired, see SessionHandlerConfig.PartialResponseGrace.
+var ErrBudgetExpired = errors.New("mgohttp: request budget expired")
+
+// requestBudget records whether a request ran out of time.
+type requestBudget struct {
+	expired atomic.Bool
+	// deadline is when the request times out, in Unix nanoseconds, zero until the timeout
+	// starts
+	deadline atomic.Int64
+}
+
+// remaining returns the time left until the request times out, if its timeout started.
+func (b *requestBudget) remaining() (time.Duration, bool) {
+	deadline := b.deadline.Load()
+	if deadline == 0 {
+		return 0, false
+	}
+	return time.Until(time.Unix(0, deadline)), true
+}
+
+type budgetKeyType struct{}
+
+var budgetKey = budgetKeyType{}
+
+// BudgetExpired reports whether the request of ctx hit the SessionHandler's timeout. With
+// SessionHandlerConfig.PartialResponseGrace set, handlers can check it to answer with the
+// results they have so far, flagged as truncated, rather than fail the request, e.g.
+//
+//	for iter.Next(&doc) {
+//		docs = append(docs, doc)
+//	}
+//	if err := iter.Close(); err != nil && !mgohttp.BudgetExpired(ctx) {
+//		return err
+//	}
+//	writeJSON(w, listResponse{Docs: docs, Truncated: mgohttp.BudgetExpired(ctx)})
+func BudgetExpired(ctx context.Context) bool {
+	b, _ := ctx.Value(budgetKey).(*requestBudget)
+	return b != nil && b.expired.Load()
+}
+
+// budgetErr returns ErrBudgetExpired in place of a nil err when the iteration of i was cut
+// short by the expired budget.
+func budgetErr(ctx context.Context, i *mgo.Iter, err error) error {
+	if err == nil && BudgetExpired(ctx) && !i.Done() {
+		return ErrBudgetExpired
+	}
+	return err
+}
@@ -0,0 +1,50 @@
+package mgohttp
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPartialResponse(t *testing.T) {
+	for _, deferred := range []bool{false, true} {
+		handler := newLeakTestHandler(func(w http.ResponseWriter, r *http.Request) {
+			FromContext(r.Context(), testDBName)
+			for !BudgetExpired(r.Context()) {
+				time.Sleep(time.Millisecond)
+			}
+			w.Write([]byte("truncated"))
+		})
+		handler.parentSession = fakeCopier{}
+		handler.cfg.DeferUntilSession = deferred
+		handler.cfg.PartialResponseGrace = time.Second
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, "truncated", rec.Body.String())
+		assert.Equal(t, int64(0), handler.Stats().TimedOut)
+	}
+}
+
+func TestPartialResponseGraceExpires(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+	handler := newLeakTestHandler(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	})
+	handler.cfg.PartialResponseGrace = handlerTimeout
+	rec := httptest.NewRecorder()
+	start := time.Now()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+	assert.Equal(t, testingStatusCode, rec.Code)
+	assert.True(t, time.Since(start) >= 2*handlerTimeout)
+	assert.Equal(t, int64(1), handler.Stats().TimedOut)
+}
+
+func TestBudgetExpiredWithoutHandler(t *testing.T) {
+	assert.False(t, BudgetExpired(context.Background()))
+}
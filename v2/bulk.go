@@ -0,0 +1,121 @@
+package mgohttp
+
+import (
+	opentracinglog "github.com/opentracing/opentracing-go/log"
+	mgo "gopkg.in/mgo.v2"
+)
+
+// tracedMgoBulk queues operations and traces them as a single "bulk" span when they're run on
+// an mgo.Bulk. The mgo.Bulk is only created by Run, on the collection the write concern
+// of the collection calls for.
+type tracedMgoBulk struct {
+	queue     []func(bulk *mgo.Bulk)
+	tc        tracedMgoCollection
+	ops       map[string]int // number of queued operations per kind
+	selectors []interface{}  // the selectors of the queued operations, for the pre-flight checks
+	unordered bool
+}
+
+func (tc tracedMgoCollection) Bulk() MongoBulk {
+	recordUsage("MongoCollection.Bulk")
+	return &tracedMgoBulk{
+		tc:  tc,
+		ops: map[string]int{},
+	}
+}
+
+func (b *tracedMgoBulk) Insert(docs ...interface{}) {
+	recordUsage("MongoBulk.Insert")
+	b.queue = append(b.queue, func(bulk *mgo.Bulk) { bulk.Insert(docs...) })
+	b.ops["insert"] += len(docs)
+}
+
+// queuePairs records the selectors of selector/update pairs.
+func (b *tracedMgoBulk) queuePairs(kind string, pairs []interface{}) {
+	for i := 0; i+1 < len(pairs); i += 2 {
+		b.selectors = append(b.selectors, pairs[i])
+	}
+	b.ops[kind] += len(pairs) / 2
+}
+
+func (b *tracedMgoBulk) Update(pairs ...interface{}) {
+	recordSelectorUsage("MongoBulk.Update", pairs...)
+	b.queue = append(b.queue, func(bulk *mgo.Bulk) { bulk.Update(pairs...) })
+	b.queuePairs("update", pairs)
+}
+
+func (b *tracedMgoBulk) UpdateAll(pairs ...interface{}) {
+	recordSelectorUsage("MongoBulk.UpdateAll", pairs...)
+	b.queue = append(b.queue, func(bulk *mgo.Bulk) { bulk.UpdateAll(pairs...) })
+	b.queuePairs("update-all", pairs)
+}
+
+func (b *tracedMgoBulk) Upsert(pairs ...interface{}) {
+	recordSelectorUsage("MongoBulk.Upsert", pairs...)
+	b.queue = append(b.queue, func(bulk *mgo.Bulk) { bulk.Upsert(pairs...) })
+	b.queuePairs("upsert", pairs)
+}
+
+func (b *tracedMgoBulk) Remove(selectors ...interface{}) {
+	recordSelectorUsage("MongoBulk.Remove", selectors...)
+	b.queue = append(b.queue, func(bulk *mgo.Bulk) { bulk.Remove(selectors...) })
+	b.selectors = append(b.selectors, selectors...)
+	b.ops["remove"] += len(selectors)
+}
+
+func (b *tracedMgoBulk) RemoveAll(selectors ...interface{}) {
+	recordSelectorUsage("MongoBulk.RemoveAll", selectors...)
+	b.queue = append(b.queue, func(bulk *mgo.Bulk) { bulk.RemoveAll(selectors...) })
+	b.selectors = append(b.selectors, selectors...)
+	b.ops["removeall"] += len(selectors)
+}
+
+func (b *tracedMgoBulk) Unordered() {
+	recordUsage("MongoBulk.Unordered")
+	b.unordered = true
+}
+
+func (b *tracedMgoBulk) Run() (res *mgo.BulkResult, err error) {
+	recordUsage("MongoBulk.Run")
+	sp, _ := startOp(b.tc.ctx, "bulk", b.tc.collectionName)
+	defer sp.Finish()
+	defer sp.recoverPanic(&err)
+	sp.SetTag(TagBulkUnordered, b.unordered)
+	total := 0
+	fields := []opentracinglog.Field{}
+	for kind, n := range b.ops {
+		total += n
+		fields = append(fields, opentracinglog.Int(LogBulkOpsPrefix+kind, n))
+	}
+	sp.LogFields(append(fields, opentracinglog.Int(LogBulkOps, total))...)
+
+	if err := b.tc.guard(sp, nil); err != nil {
+		return nil, logAndReturnErr(sp, err)
+	}
+	for _, selector := range b.selectors {
+		if err := b.tc.guard(sp, selector); err != nil {
+			return nil, logAndReturnErr(sp, err)
+		}
+	}
+
+	c, release := b.tc.writer(sp)
+	defer release()
+	bulk := c.Bulk()
+	if b.unordered {
+		bulk.Unordered()
+	}
+	for _, queued := range b.queue {
+		queued(bulk)
+	}
+	err = sp.intercept(OpInfo{}, func(*OpInfo) (err error) {
+		res, err = bulk.Run()
+		return err
+	})
+	if res != nil {
+		sp.LogFields(
+			opentracinglog.Int(LogBulkMatched, res.Matched),
+			opentracinglog.Int(LogBulkModified, res.Modified),
+		)
+	}
+	return res, sp.done(err)
+}
@@ -0,0 +1,54 @@
+package mgohttp
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	opentracing "github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/mocktracer"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	mgo "gopkg.in/mgo.v2"
+	bson "gopkg.in/mgo.v2/bson"
+)
+
+func TestBulkTracesQueuedOps(t *testing.T) {
+	DisableCollection(testDBName, "events")
+	defer EnableCollection(testDBName, "events")
+
+	tracer := mocktracer.New()
+	opentracing.SetGlobalTracer(tracer)
+	defer opentracing.SetGlobalTracer(opentracing.NoopTracer{})
+	c := tracedMgoCollection{
+		collectionName: "events",
+		collection:     &mgo.Collection{Name: "events", Database: &mgo.Database{Name: testDBName}},
+		ctx:            context.Background(),
+	}
+
+	bulk := c.Bulk()
+	bulk.Unordered()
+	bulk.Insert(bson.M{"a": 1}, bson.M{"a": 2})
+	bulk.Update(bson.M{"a": 1}, bson.M{"$set": bson.M{"b": 1}})
+	bulk.RemoveAll(bson.M{"a": 3})
+	_, err := bulk.Run()
+	assert.True(t, errors.Is(err, ErrCollectionDisabled))
+
+	spans := tracer.FinishedSpans()
+	require.Len(t, spans, 1)
+	sp := spans[0]
+	assert.Equal(t, "bulk", sp.OperationName)
+	assert.Equal(t, true, sp.Tag(TagBulkUnordered))
+	assert.Equal(t, "events", sp.Tag(TagCollection))
+
+	logged := map[string]string{}
+	for _, record := range sp.Logs() {
+		for _, field := range record.Fields {
+			logged[field.Key] = field.ValueString
+		}
+	}
+	assert.Equal(t, "4", logged[LogBulkOps])
+	assert.Equal(t, "2", logged[LogBulkOpsPrefix+"insert"])
+	assert.Equal(t, "1", logged[LogBulkOpsPrefix+"update"])
+	assert.Equal(t, "1", logged[LogBulkOpsPrefix+"removeall"])
+}
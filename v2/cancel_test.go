@@ -0,0 +1,65 @@
+package mgohttp
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	opentracing "github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/mocktracer"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClientDisconnectTagsRootSpan(t *testing.T) {
+	tracer := mocktracer.New()
+	root := tracer.StartSpan("GET /")
+	ctx, cancel := context.WithCancel(opentracing.ContextWithSpan(context.Background(), root))
+
+	release := make(chan struct{})
+	defer close(release)
+	handler := newLeakTestHandler(func(w http.ResponseWriter, r *http.Request) {
+		cancel()
+		<-release
+	})
+	handler.cfg.Timeout = time.Minute
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/", nil).WithContext(ctx))
+
+	tags := root.(*mocktracer.MockSpan).Tags()
+	assert.Equal(t, true, tags[TagCancelled])
+	assert.Equal(t, "client-disconnect", tags[TagCancellationReason])
+	assert.NotContains(t, tags, "error")
+	assert.Equal(t, int64(1), handler.Stats().Cancelled)
+	assert.Equal(t, int64(0), handler.Stats().TimedOut)
+}
+
+func TestClientDisconnectClosesSessions(t *testing.T) {
+	tracer := mocktracer.New()
+	ctx, cancel := context.WithCancel(context.Background())
+	var err error
+	sessionSpanFinished := false
+	handler := newDeferredTestHandler(func(w http.ResponseWriter, r *http.Request) {
+		FromContext(r.Context(), testDBName)
+		cancel()
+		// the sessions are closed while the handler is still running
+		sessionSpanFinished = assert.Eventually(t, func() bool {
+			for _, sp := range tracer.FinishedSpans() {
+				if sp.OperationName == "mgohttp" {
+					return true
+				}
+			}
+			return false
+		}, time.Second, time.Millisecond)
+		err = FromContext(r.Context(), testDBName).Ping()
+	})
+	handler.cfg.Tracer = tracer
+	handler.cfg.Timeout = time.Minute
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil).WithContext(ctx))
+
+	assert.True(t, sessionSpanFinished)
+	assert.True(t, errors.Is(err, ErrClientDisconnected))
+	assert.Equal(t, int64(1), handler.Stats().Cancelled)
+}
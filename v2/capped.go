@@ -0,0 +1,344 @@
+package mgohttp
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	mgo "gopkg.in/mgo.v2"
+	bson "gopkg.in/mgo.v2/bson"
+)
+
+// ErrNotCapped is returned by the capped collection helpers for a collection that isn't
+// capped.
+var ErrNotCapped = errors.New("mgohttp: collection isn't capped")
+
+// ErrCappedDocumentTooLarge is the sentinel wrapped by every CappedDocumentTooLargeError.
+var ErrCappedDocumentTooLarge = errors.New("document larger than the capped collection")
+
+// CappedDocumentTooLargeError is returned by CappedWriter.Insert for a document that can't
+// fit in the capped collection at all.
+type CappedDocumentTooLargeError struct {
+	Collection string
+	// Size is the BSON size of the document, MaxSize the size of the collection, in bytes.
+	Size    int
+	MaxSize int
+}
+
+func (e CappedDocumentTooLargeError) Error() string {
+	return fmt.Sprintf("mgohttp: %s: %d bytes in %s of %d bytes", ErrCappedDocumentTooLarge, e.Size, e.Collection, e.MaxSize)
+}
+
+// Unwrap allows errors.Is(err, ErrCappedDocumentTooLarge).
+func (e CappedDocumentTooLargeError) Unwrap() error {
+	return ErrCappedDocumentTooLarge
+}
+
+// ErrCappedOverflow is the sentinel wrapped by every CappedOverflowError.
+var ErrCappedOverflow = errors.New("capped collection rolled over the reader")
+
+// CappedOverflowError is returned by a CappedTail whose position was overwritten: the writers
+// rolled the capped collection over the last document it read, so the documents written
+// after it were lost before it could read them.
+type CappedOverflowError struct {
+	Collection string
+	// LastID is the last document read, OldestID the oldest one left in the collection, when
+	// known.
+	LastID   bson.ObjectId
+	OldestID bson.ObjectId
+}
+
+func (e CappedOverflowError) Error() string {
+	return fmt.Sprintf("mgohttp: %s: %s rolled over past %s", ErrCappedOverflow, e.Collection, e.LastID.Hex())
+}
+
+// Unwrap allows errors.Is(err, ErrCappedOverflow).
+func (e CappedOverflowError) Unwrap() error {
+	return ErrCappedOverflow
+}
+
+// CappedStats are the size and limits of a capped collection.
+type CappedStats struct {
+	// Size is the size of the documents, MaxSize the size they're capped to, in bytes.
+	Size    int64 `bson:"size"`
+	MaxSize int64 `bson:"maxSize"`
+	// Count is the number of documents, MaxDocs the number they're capped to, zero for none.
+	Count   int64 `bson:"count"`
+	MaxDocs int64 `bson:"max"`
+	Capped  bool  `bson:"capped"`
+}
+
+// full reports whether inserting a document of size bytes evicts the oldest documents.
+func (s CappedStats) full(size int) bool {
+	return s.Size+int64(size) > s.MaxSize || (s.MaxDocs > 0 && s.Count+1 > s.MaxDocs)
+}
+
+// GetCappedStats returns the stats of collection with the collStats command, ErrNotCapped if
+// it isn't capped.
+func GetCappedStats(db MongoDatabase, collection string) (CappedStats, error) {
+	var stats CappedStats
+	if err := db.Run(bson.D{{Name: "collStats", Value: collection}}, &stats); err != nil {
+		return CappedStats{}, err
+	}
+	if !stats.Capped {
+		return CappedStats{}, ErrNotCapped
+	}
+	return stats, nil
+}
+
+// CappedWrite is the outcome of a CappedWriter.Insert.
+type CappedWrite struct {
+	// ID is the _id of the document inserted.
+	ID bson.ObjectId
+	// Evicted is set when the collection was full, so the insert evicted its oldest
+	// documents: the readers lagging behind them lose documents.
+	Evicted bool
+}
+
+// CappedWriter inserts documents into a capped collection, checking they fit in it and
+// detecting when it's full, so the inserts roll it over. It's shared by the requests, so the
+// size of the collection is fetched with collStats every refreshEvery, and tracked from its
+// own inserts in between: the inserts of other writers are only seen on refresh.
+type CappedWriter struct {
+	collection   string
+	refreshEvery time.Duration
+
+	mu      sync.Mutex
+	stats   CappedStats
+	fetched time.Time
+}
+
+// NewCappedWriter returns a CappedWriter for collection. refreshEvery defaults to 10s.
+func NewCappedWriter(collection string, refreshEvery time.Duration) *CappedWriter {
+	if refreshEvery <= 0 {
+		refreshEvery = 10 * time.Second
+	}
+	return &CappedWriter{collection: collection, refreshEvery: refreshEvery}
+}
+
+// Insert inserts doc into the collection of db. Documents without an _id get a new ObjectId,
+// which CappedTail resumes from. It fails with a CappedDocumentTooLargeError, without writing,
+// for a document that can't fit in the collection, and with ErrNotCapped for a collection
+// that isn't capped.
+func (w *CappedWriter) Insert(db MongoDatabase, doc interface{}) (CappedWrite, error) {
+	d, id, err := withObjectID(doc)
+	if err != nil {
+		return CappedWrite{}, err
+	}
+	data, err := bson.Marshal(d)
+	if err != nil {
+		return CappedWrite{}, err
+	}
+	stats, err := w.currentStats(db)
+	if err != nil {
+		return CappedWrite{}, err
+	}
+	if int64(len(data)) > stats.MaxSize {
+		return CappedWrite{}, CappedDocumentTooLargeError{Collection: w.collection, Size: len(data), MaxSize: int(stats.MaxSize)}
+	}
+	if err := db.C(w.collection).Insert(d); err != nil {
+		return CappedWrite{}, err
+	}
+	return CappedWrite{ID: id, Evicted: w.inserted(len(data))}, nil
+}
+
+// currentStats returns the stats of the collection, refreshed if they're stale.
+func (w *CappedWriter) currentStats(db MongoDatabase) (CappedStats, error) {
+	w.mu.Lock()
+	stats, fresh := w.stats, time.Since(w.fetched) < w.refreshEvery
+	w.mu.Unlock()
+	if fresh {
+		return stats, nil
+	}
+	stats, err := GetCappedStats(db, w.collection)
+	if err != nil {
+		return CappedStats{}, err
+	}
+	w.mu.Lock()
+	w.stats, w.fetched = stats, time.Now()
+	w.mu.Unlock()
+	return stats, nil
+}
+
+// inserted tracks an insert of size bytes, and reports whether it evicted documents. Once
+// the collection is full, its size stays at its cap.
+func (w *CappedWriter) inserted(size int) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	evicted := w.stats.full(size)
+	if w.stats.Size += int64(size); w.stats.Size > w.stats.MaxSize {
+		w.stats.Size = w.stats.MaxSize
+	}
+	if w.stats.Count++; w.stats.MaxDocs > 0 && w.stats.Count > w.stats.MaxDocs {
+		w.stats.Count = w.stats.MaxDocs
+	}
+	return evicted
+}
+
+// withObjectID returns doc as a bson.D with an _id, a new ObjectId if it had none, and the
+// _id. CappedTail only resumes from ObjectIds.
+func withObjectID(doc interface{}) (bson.D, bson.ObjectId, error) {
+	data, err := bson.Marshal(doc)
+	if err != nil {
+		return nil, "", err
+	}
+	var d bson.D
+	if err := bson.Unmarshal(data, &d); err != nil {
+		return nil, "", err
+	}
+	for _, e := range d {
+		if e.Name == "_id" {
+			id, ok := e.Value.(bson.ObjectId)
+			if !ok {
+				return nil, "", fmt.Errorf("mgohttp: the _id of a capped document must be an ObjectId, not %T", e.Value)
+			}
+			return d, id, nil
+		}
+	}
+	id := bson.NewObjectId()
+	return append(bson.D{{Name: "_id", Value: id}}, d...), id, nil
+}
+
+// cappedReopenDelay is the time a CappedTail waits before reopening a cursor that died
+// without error, as those on empty collections do at once.
+const cappedReopenDelay = 100 * time.Millisecond
+
+// CappedTail tails a capped collection from the document after the last one it read, for
+// lightweight messaging through capped collections. It reopens its tailable cursor when the
+// server drops it, and fails with a CappedOverflowError when the writers rolled the
+// collection over the last document read, rather than silently skipping the documents lost.
+// Resuming relies on _ids that are ObjectIds increasing in insertion order, as those of
+// CappedWriter, when writers' clocks agree.
+//
+//	tail := mgohttp.TailCapped(db, "messages", lastID, 5*time.Second)
+//	defer tail.Close()
+//	for {
+//		for tail.Next(&msg) {
+//			...
+//		}
+//		if tail.Err() != nil {
+//			break
+//		}
+//	}
+type CappedTail struct {
+	db         MongoDatabase
+	collection string
+	timeout    time.Duration
+
+	it       MongoIter
+	lastID   bson.ObjectId
+	timedOut bool
+	err      error
+}
+
+// TailCapped returns a CappedTail of collection from the document after lastID, or from the
+// start of the collection when it's empty. Next waits up to timeout for new documents, a
+// negative timeout waits forever.
+func TailCapped(db MongoDatabase, collection string, lastID bson.ObjectId, timeout time.Duration) *CappedTail {
+	return &CappedTail{db: db, collection: collection, timeout: timeout, lastID: lastID}
+}
+
+// Next reads the next document into result. It returns false when the cursor timed out
+// waiting for documents, see Timeout, when it was reopened, or on failure, see Err: the loop
+// reading the tail keeps calling Next until Err is set.
+func (t *CappedTail) Next(result interface{}) bool {
+	t.timedOut = false
+	if t.err != nil {
+		return false
+	}
+	if t.it == nil {
+		if t.err = t.open(); t.err != nil {
+			return false
+		}
+	}
+	var raw bson.Raw
+	if t.it.Next(&raw) {
+		var doc struct {
+			ID bson.ObjectId `bson:"_id"`
+		}
+		if t.err = raw.Unmarshal(&doc); t.err == nil {
+			t.lastID = doc.ID
+			t.err = raw.Unmarshal(result)
+		}
+		return t.err == nil
+	}
+	if t.it.Timeout() {
+		t.timedOut = true
+		return false
+	}
+	err := t.it.Close()
+	t.it = nil
+	switch {
+	case isCappedPositionLost(err):
+		t.err = CappedOverflowError{Collection: t.collection, LastID: t.lastID}
+	case err != nil:
+		t.err = err
+	default:
+		// the server dropped the cursor, reopen it on the next call
+		time.Sleep(cappedReopenDelay)
+	}
+	return false
+}
+
+// open opens the tailable cursor after the last document read, once checked it's still in
+// the collection.
+func (t *CappedTail) open() error {
+	c := t.db.C(t.collection)
+	var selector interface{}
+	if t.lastID != "" {
+		var oldest struct {
+			ID bson.ObjectId `bson:"_id"`
+		}
+		err := c.Find(nil).Sort("$natural").Select(bson.M{"_id": 1}).One(&oldest)
+		switch {
+		case IsNotFound(err):
+		case err != nil:
+			return err
+		case oldest.ID > t.lastID:
+			return CappedOverflowError{Collection: t.collection, LastID: t.lastID, OldestID: oldest.ID}
+		}
+		selector = bson.M{"_id": bson.M{"$gt": t.lastID}}
+	}
+	t.it = c.Find(selector).Sort("$natural").Tail(t.timeout)
+	return nil
+}
+
+// isCappedPositionLost reports whether err is the failure of a tailable cursor whose position
+// was overwritten.
+func isCappedPositionLost(err error) bool {
+	var qerr *mgo.QueryError
+	if errors.As(err, &qerr) && qerr.Code == 136 {
+		// CappedPositionLost
+		return true
+	}
+	return err != nil && strings.Contains(err.Error(), "position in capped collection being deleted")
+}
+
+// LastID returns the _id of the last document read, to resume the tail from.
+func (t *CappedTail) LastID() bson.ObjectId {
+	return t.lastID
+}
+
+// Timeout reports whether the last Next returned false because the cursor timed out waiting
+// for documents.
+func (t *CappedTail) Timeout() bool {
+	return t.timedOut
+}
+
+// Err returns the failure of the tail, a CappedOverflowError when it lost documents.
+func (t *CappedTail) Err() error {
+	return t.err
+}
+
+// Close closes the cursor, and returns the failure of the tail.
+func (t *CappedTail) Close() error {
+	if t.it != nil {
+		if err := t.it.Close(); err != nil && t.err == nil {
+			t.err = err
+		}
+		t.it = nil
+	}
+	return t.err
+}
@@ -0,0 +1,54 @@
+package mgohttp
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	mgo "gopkg.in/mgo.v2"
+	bson "gopkg.in/mgo.v2/bson"
+)
+
+func TestWithObjectID(t *testing.T) {
+	d, id, err := withObjectID(bson.M{"a": 1})
+	require.NoError(t, err)
+	assert.True(t, id.Valid())
+	assert.Equal(t, bson.D{{Name: "_id", Value: id}, {Name: "a", Value: 1}}, d)
+
+	existing := bson.NewObjectId()
+	d, id, err = withObjectID(bson.D{{Name: "a", Value: 1}, {Name: "_id", Value: existing}})
+	require.NoError(t, err)
+	assert.Equal(t, existing, id)
+	assert.Len(t, d, 2)
+
+	_, _, err = withObjectID(bson.M{"_id": "a"})
+	assert.Error(t, err, "the tail resumes from ObjectIds")
+}
+
+func TestCappedWriterTracksEvictions(t *testing.T) {
+	w := NewCappedWriter("messages", 0)
+	w.stats = CappedStats{Size: 800, MaxSize: 1000, MaxDocs: 3, Capped: true}
+	assert.False(t, w.inserted(100))
+	assert.Equal(t, CappedStats{Size: 900, MaxSize: 1000, Count: 1, MaxDocs: 3, Capped: true}, w.stats)
+	assert.True(t, w.inserted(200), "past the size")
+	assert.Equal(t, int64(1000), w.stats.Size)
+	assert.True(t, w.inserted(1), "the collection stays full")
+
+	w.stats = CappedStats{MaxSize: 1000, Count: 2, MaxDocs: 3, Capped: true}
+	assert.False(t, w.inserted(10))
+	assert.True(t, w.inserted(10), "past the documents")
+	assert.Equal(t, int64(3), w.stats.Count)
+}
+
+func TestCappedErrors(t *testing.T) {
+	assert.True(t, errors.Is(CappedOverflowError{Collection: "messages", LastID: bson.NewObjectId()}, ErrCappedOverflow))
+	assert.True(t, errors.Is(CappedDocumentTooLargeError{Collection: "messages", Size: 2, MaxSize: 1}, ErrCappedDocumentTooLarge))
+
+	assert.True(t, isCappedPositionLost(&mgo.QueryError{Code: 136}))
+	assert.True(t, isCappedPositionLost(&mgo.QueryError{
+		Message: "CollectionScan died due to position in capped collection being deleted",
+	}))
+	assert.False(t, isCappedPositionLost(&mgo.QueryError{Code: 50}))
+	assert.False(t, isCappedPositionLost(nil))
+}
@@ -0,0 +1,78 @@
+package mgohttp
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	opentracing "github.com/opentracing/opentracing-go"
+	mgo "gopkg.in/mgo.v2"
+)
+
+// NewChildSession returns a session of database for a goroutine of the request of ctx, along
+// with the func closing it. The request's session is shared by its callers, so queries fanned
+// out from a handler queue on its socket: a child session is a copy of it, with the same
+// mode, write concern and socket timeout, on a socket of its own. It takes one of the
+// handler's MaxConcurrentSessions, and its operations hang off a caller span of their own.
+//
+// Close the child session once the goroutine is done with it; it's closed with the request's
+// sessions otherwise. Outside of a SessionHandler, e.g. with mgohttptest, and for the databases
+// with a Driver, whose sessions don't hold on to a socket, it's the session of FromContext.
+func NewChildSession(ctx context.Context, database string) (MongoSession, func()) {
+	recordUsage("NewChildSession")
+	sess := FromContext(ctx, database)
+	ts, ok := sess.(tracedMgoSession)
+	s, _ := ctx.Value(requestSessionKey).(*requestSession)
+	if !ok || s == nil {
+		return sess, func() {}
+	}
+	return s.child(ts, database)
+}
+
+// childSession is a session of NewChildSession.
+type childSession struct {
+	sess *mgo.Session
+	once sync.Once
+	c    *SessionHandler
+}
+
+func (cs *childSession) close() {
+	cs.once.Do(func() {
+		cs.sess.Close()
+		cs.c.cfg.Metrics.sessionClosed()
+		cs.c.releaseSession()
+		cs.c.sessionTracker.done()
+	})
+}
+
+// child copies the request's session ts of database for NewChildSession.
+func (s *requestSession) child(ts tracedMgoSession, database string) (MongoSession, func()) {
+	c := s.c
+	err := c.sessionTracker.add()
+	if err == nil {
+		if err = c.acquireSession(ts.ctx, s.deadline, s.libSpan); err != nil {
+			c.sessionTracker.done()
+		}
+	}
+	if err != nil {
+		return failedSession{err: fmt.Errorf("mgohttp: creating child session for %s: %w", database, err)}, func() {}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		c.releaseSession()
+		c.sessionTracker.done()
+		return failedSession{err: fmt.Errorf("mgohttp: creating child session for %s: the request's sessions are closed", database)}, func() {}
+	}
+	cs := &childSession{sess: ts.sess.Copy(), c: c}
+	s.children = append(s.children, cs)
+	c.cfg.Metrics.sessionOpened()
+	ctx := s.startCallerSpan(ts.ctx)
+	opentracing.SpanFromContext(ctx).SetTag(TagChildSession, true)
+	return tracedMgoSession{
+		sess:      cs.sess,
+		ctx:       withOpSession(ctx, cs.sess),
+		databases: newWrapperCache[MongoDatabase](),
+	}, cs.close
+}
@@ -0,0 +1,45 @@
+package mgohttp
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewChildSessionCountsAgainstMaxConcurrentSessions(t *testing.T) {
+	var child MongoSession
+	handler := sessionLimitTestHandler(true, time.Second, nil, make(chan error, 1))
+	inner := handler.cfg.Handler
+	handler.cfg.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		inner.ServeHTTP(w, r)
+		var close func()
+		child, close = NewChildSession(r.Context(), testDBName)
+		close()
+	})
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+
+	failed, ok := child.(failedSession)
+	require.True(t, ok, "the request's session holds the only slot")
+	assert.True(t, errors.Is(failed.err, ErrTooManySessions))
+	assert.Empty(t, handler.sessionSlots, "the slot is released with the request")
+}
+
+func TestNewChildSessionFailedRequestSession(t *testing.T) {
+	var child MongoSession
+	handler := sessionLimitTestHandler(true, time.Second, nil, make(chan error, 1))
+	handler.sessionSlots <- struct{}{}
+	handler.cfg.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		child, _ = NewChildSession(r.Context(), testDBName)
+	})
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+
+	failed, ok := child.(failedSession)
+	require.True(t, ok)
+	assert.True(t, errors.Is(failed.err, ErrTooManySessions), "the request's own error")
+	assert.Len(t, handler.sessionSlots, 1)
+}
@@ -0,0 +1,154 @@
+package mgohttp
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/x/mongo/driver/topology"
+	mgo "gopkg.in/mgo.v2"
+)
+
+// mgo reports the failures of its connections with errors that aren't exported.
+var mgoNetworkErrors = map[string]bool{
+	"no reachable servers":                true,
+	"server was closed":                   true,
+	"server not available":                true,
+	"Closed explicitly":                   true,
+	"per-server connection limit reached": true,
+	"opcode != 1, corrupted data?":        true,
+	"Session already closed":              true,
+}
+
+// IsNotFound reports whether err is, or wraps, mgo.ErrNotFound: the query matched no
+// document.
+func IsNotFound(err error) bool {
+	return errors.Is(err, mgo.ErrNotFound)
+}
+
+// IsDuplicateKey reports whether err is, or wraps, a duplicate key error of a write, an
+// Apply or a bulk operation. Unlike mgo.IsDup, it sees through the errors of the wrappers.
+func IsDuplicateKey(err error) bool {
+	var lerr *mgo.LastError
+	var qerr *mgo.QueryError
+	var berr *mgo.BulkError
+	switch {
+	case errors.As(err, &lerr):
+		return mgo.IsDup(lerr)
+	case errors.As(err, &qerr):
+		return mgo.IsDup(qerr)
+	case errors.As(err, &berr):
+		return mgo.IsDup(berr)
+	}
+	return false
+}
+
+// IsTimeout reports whether err is a timeout: the SessionHandler's own, see
+// ErrRequestTimeout and ErrBudgetExpired, a socket timeout, the deadline of a context, or the
+// server's time limit of a query with SetMaxTime, or a timeout of the official driver.
+func IsTimeout(err error) bool {
+	var nerr net.Error
+	var qerr *mgo.QueryError
+	switch {
+	case errors.Is(err, ErrRequestTimeout),
+		errors.Is(err, ErrBudgetExpired),
+		errors.Is(err, context.DeadlineExceeded),
+		errors.As(err, &nerr) && nerr.Timeout(),
+		mongo.IsTimeout(err):
+		return true
+	case errors.As(err, &qerr):
+		// ExceededTimeLimit
+		return qerr.Code == 50
+	}
+	return false
+}
+
+// IsNetworkError reports whether err is a failure to reach the server or to talk to it,
+// rather than an error answered by the server, so the operation may succeed if retried.
+func IsNetworkError(err error) bool {
+	var nerr net.Error
+	if errors.As(err, &nerr) && !errors.Is(err, context.DeadlineExceeded) {
+		// context.DeadlineExceeded is a net.Error too
+		return true
+	}
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return true
+	}
+	// the official driver's, see NewMongoDriver
+	var serr topology.ServerSelectionError
+	if errors.As(err, &serr) || mongo.IsNetworkError(err) {
+		return true
+	}
+	var perr DriverPanicError
+	if errors.As(err, &perr) {
+		s, _ := perr.Value.(string)
+		return mgoNetworkErrors[s]
+	}
+	return anyError(err, func(err error) bool { return mgoNetworkErrors[err.Error()] })
+}
+
+// anyError reports whether match holds for err or any of the errors it wraps.
+func anyError(err error, match func(error) bool) bool {
+	if err == nil {
+		return false
+	}
+	if match(err) {
+		return true
+	}
+	switch u := err.(type) {
+	case interface{ Unwrap() error }:
+		return anyError(u.Unwrap(), match)
+	case interface{ Unwrap() []error }:
+		for _, err := range u.Unwrap() {
+			if anyError(err, match) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// ErrClientDisconnected is the Cause of the RequestAbortedErrors of the requests whose client
+// went away, and is returned in place of their sessions once it did.
+var ErrClientDisconnected = errors.New("mgohttp: client disconnected")
+
+// RequestAbortedError is returned by the operations that failed because their request was
+// aborted, rather than on their own: the SessionHandler closes the sessions of the requests
+// that hit its timeout or whose client disconnected. Both errors.Is(err, Cause) and the
+// error of the driver hold.
+type RequestAbortedError struct {
+	// Cause is ErrRequestTimeout or ErrClientDisconnected.
+	Cause error
+	Err   error
+}
+
+func (e RequestAbortedError) Error() string {
+	return e.Cause.Error() + ": " + e.Err.Error()
+}
+
+// Unwrap allows errors.Is(err, ErrRequestTimeout) or errors.Is(err, ErrClientDisconnected),
+// as well as the error of the driver.
+func (e RequestAbortedError) Unwrap() []error {
+	return []error{e.Cause, e.Err}
+}
+
+// abortedErr wraps err in a RequestAbortedError when the request of ctx was aborted, and err
+// is a failure of the connection or a timeout, as closing the request's sessions causes.
+func abortedErr(ctx context.Context, err error) error {
+	if err == nil || errors.As(err, &RequestAbortedError{}) || !(IsNetworkError(err) || IsTimeout(err)) {
+		return err
+	}
+	if errors.Is(ctx.Err(), context.Canceled) {
+		return RequestAbortedError{Cause: ErrClientDisconnected, Err: err}
+	}
+	b, _ := ctx.Value(budgetKey).(*requestBudget)
+	if b == nil {
+		return err
+	}
+	if remaining, ok := b.remaining(); !ok || remaining > 0 {
+		return err
+	}
+	return RequestAbortedError{Cause: ErrRequestTimeout, Err: err}
+}
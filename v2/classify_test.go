@@ -0,0 +1,82 @@
+package mgohttp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	mgo "gopkg.in/mgo.v2"
+)
+
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+var _ net.Error = timeoutError{}
+
+func TestErrorClassification(t *testing.T) {
+	wrap := func(err error) error {
+		return OpError{Op: "find", Database: "app", Collection: "users", Err: err}
+	}
+	for _, test := range []struct {
+		err                                   error
+		notFound, dup, timeout, networkFailed bool
+	}{
+		{err: nil},
+		{err: wrap(mgo.ErrNotFound), notFound: true},
+		{err: wrap(&mgo.LastError{Code: 11000}), dup: true},
+		{err: wrap(&mgo.QueryError{Code: 11001}), dup: true},
+		{err: wrap(&mgo.QueryError{Code: 50}), timeout: true},
+		{err: wrap(&mgo.QueryError{Code: 2})},
+		{err: wrap(ErrRequestTimeout), timeout: true},
+		{err: ErrBudgetExpired, timeout: true},
+		{err: wrap(context.DeadlineExceeded), timeout: true},
+		{err: wrap(timeoutError{}), timeout: true, networkFailed: true},
+		{err: wrap(io.EOF), networkFailed: true},
+		{err: wrap(errors.New("no reachable servers")), networkFailed: true},
+		{err: fmt.Errorf("listing: %w", wrap(errors.New("Closed explicitly"))), networkFailed: true},
+		{err: wrap(DriverPanicError{Op: "find", Value: "Session already closed"}), networkFailed: true},
+		{err: wrap(DriverPanicError{Op: "find", Value: "index out of range"})},
+		{err: wrap(errors.New("something else"))},
+	} {
+		assert.Equal(t, test.notFound, IsNotFound(test.err), "IsNotFound(%v)", test.err)
+		assert.Equal(t, test.dup, IsDuplicateKey(test.err), "IsDuplicateKey(%v)", test.err)
+		assert.Equal(t, test.timeout, IsTimeout(test.err), "IsTimeout(%v)", test.err)
+		assert.Equal(t, test.networkFailed, IsNetworkError(test.err), "IsNetworkError(%v)", test.err)
+	}
+}
+
+func TestAbortedErr(t *testing.T) {
+	closed := errors.New("Closed explicitly")
+	assert.Equal(t, closed, abortedErr(context.Background(), closed), "not in a request")
+
+	budget := &requestBudget{}
+	ctx := context.WithValue(context.Background(), budgetKey, budget)
+	assert.Equal(t, closed, abortedErr(ctx, closed), "the timeout didn't start")
+	budget.deadline.Store(time.Now().Add(time.Minute).UnixNano())
+	assert.Equal(t, closed, abortedErr(ctx, closed), "the request has time left")
+
+	budget.deadline.Store(time.Now().Add(-time.Millisecond).UnixNano())
+	assert.Equal(t, mgo.ErrNotFound, abortedErr(ctx, mgo.ErrNotFound), "the server answered")
+	err := wrapOpErr(ctx, "find", "users", abortedErr(ctx, closed))
+	assert.True(t, errors.Is(err, ErrRequestTimeout))
+	assert.True(t, errors.Is(err, closed))
+	assert.True(t, IsTimeout(err))
+	assert.True(t, IsNetworkError(err))
+	status, _ := DefaultErrorMapper(err)
+	assert.Equal(t, 503, status)
+
+	disconnected, cancel := context.WithCancel(ctx)
+	cancel()
+	err = abortedErr(disconnected, closed)
+	assert.True(t, errors.Is(err, ErrClientDisconnected))
+	assert.False(t, errors.Is(err, ErrRequestTimeout))
+	assert.True(t, errors.Is(err, closed))
+}
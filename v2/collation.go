@@ -0,0 +1,349 @@
+package mgohttp
+
+import (
+	"fmt"
+	"time"
+
+	mgo "gopkg.in/mgo.v2"
+	bson "gopkg.in/mgo.v2/bson"
+)
+
+// Collation specifies language-specific string comparison rules for a query, see
+// https://docs.mongodb.com/manual/reference/collation/. A case-insensitive match on an
+// index with the same collation is e.g. Collation{Locale: "en", Strength: 2}.
+type Collation struct {
+	Locale          string `bson:"locale"`
+	CaseLevel       bool   `bson:"caseLevel,omitempty"`
+	CaseFirst       string `bson:"caseFirst,omitempty"`
+	Strength        int    `bson:"strength,omitempty"`
+	NumericOrdering bool   `bson:"numericOrdering,omitempty"`
+	Alternate       string `bson:"alternate,omitempty"`
+	MaxVariable     string `bson:"maxVariable,omitempty"`
+	Normalization   bool   `bson:"normalization,omitempty"`
+	Backwards       bool   `bson:"backwards,omitempty"`
+}
+
+// UnsupportedFeatureError is returned when a query uses a feature the server is too old for.
+type UnsupportedFeatureError struct {
+	Feature ServerFeature
+	Version string
+}
+
+func (e UnsupportedFeatureError) Error() string {
+	return fmt.Sprintf("mgohttp: %s requires MongoDB %d.%d, server is %s",
+		e.Feature.Name, e.Feature.Major, e.Feature.Minor, e.Version)
+}
+
+// querySpec records what a MongoQuery was built from, for the access methods that have to be
+// emulated with database commands because mgo has no native support for them.
+type querySpec struct {
+	collection  *mgo.Collection
+	filter      interface{}
+	projection  interface{}
+	sort        []string
+	hint        []string
+	limit       int
+	skip        int
+	batch       int
+	prefetch    *float64
+	maxTime     time.Duration
+	collation   *Collation
+	readPref    *ReadPreference
+	snapshot    bool
+	readConcern string
+	comment     string
+	// atClusterTime is the time snapshot reads read at, the server's choice when zero
+	atClusterTime bson.MongoTimestamp
+	// run runs the commands of the emulated access methods, the Run of the collection's
+	// database when nil
+	run func(cmd, result interface{}) error
+}
+
+// query rebuilds the mgo query described by the spec.
+func (s querySpec) query() *mgo.Query {
+	q := s.collection.Find(s.filter)
+	if s.projection != nil {
+		q.Select(s.projection)
+	}
+	if len(s.sort) > 0 {
+		q.Sort(s.sort...)
+	}
+	if len(s.hint) > 0 {
+		q.Hint(s.hint...)
+	}
+	if s.limit != 0 {
+		q.Limit(s.limit)
+	}
+	if s.skip != 0 {
+		q.Skip(s.skip)
+	}
+	if s.batch != 0 {
+		q.Batch(s.batch)
+	}
+	if s.prefetch != nil {
+		q.Prefetch(*s.prefetch)
+	}
+	if s.maxTime != 0 {
+		q.SetMaxTime(s.maxTime)
+	}
+	if s.comment != "" {
+		q.Comment(s.comment)
+	}
+	return q
+}
+
+// runCommand runs cmd for an emulated access method.
+func (s querySpec) runCommand(cmd, result interface{}) error {
+	if s.run != nil {
+		return s.run(cmd, result)
+	}
+	return s.collection.Database.Run(cmd, result)
+}
+
+// fieldsDoc converts mgo style field lists ("-created", "+name") into an ordered key document.
+func fieldsDoc(fields []string) bson.D {
+	doc := bson.D{}
+	for _, field := range fields {
+		n := 1
+		if field != "" {
+			switch field[0] {
+			case '+':
+				field = field[1:]
+			case '-':
+				n = -1
+				field = field[1:]
+			}
+		}
+		doc = append(doc, bson.DocElem{Name: field, Value: n})
+	}
+	return doc
+}
+
+// findCommand builds the find command equivalent to the query.
+func (s querySpec) findCommand(limit int, singleBatch bool) bson.D {
+	filter := s.filter
+	if filter == nil {
+		filter = bson.M{}
+	}
+	cmd := bson.D{
+		{Name: "find", Value: s.collection.Name},
+		{Name: "filter", Value: filter},
+	}
+	if s.projection != nil {
+		cmd = append(cmd, bson.DocElem{Name: "projection", Value: s.projection})
+	}
+	if len(s.sort) > 0 {
+		cmd = append(cmd, bson.DocElem{Name: "sort", Value: fieldsDoc(s.sort)})
+	}
+	if len(s.hint) > 0 {
+		cmd = append(cmd, bson.DocElem{Name: "hint", Value: fieldsDoc(s.hint)})
+	}
+	if s.skip > 0 {
+		cmd = append(cmd, bson.DocElem{Name: "skip", Value: s.skip})
+	}
+	if limit > 0 {
+		cmd = append(cmd, bson.DocElem{Name: "limit", Value: limit})
+	}
+	if s.batch > 0 && !singleBatch {
+		cmd = append(cmd, bson.DocElem{Name: "batchSize", Value: s.batch})
+	}
+	if s.maxTime > 0 {
+		cmd = append(cmd, bson.DocElem{Name: "maxTimeMS", Value: s.maxTime.Milliseconds()})
+	}
+	if singleBatch {
+		cmd = append(cmd, bson.DocElem{Name: "singleBatch", Value: true})
+	}
+	if s.collation != nil {
+		cmd = append(cmd, bson.DocElem{Name: "collation", Value: s.collation})
+	}
+	if s.comment != "" {
+		cmd = append(cmd, bson.DocElem{Name: "comment", Value: s.comment})
+	}
+	return s.withReadConcern(cmd)
+}
+
+// withReadConcern adds the query's read concern, if any, to the read command cmd.
+func (s querySpec) withReadConcern(cmd bson.D) bson.D {
+	if s.readConcern == "" {
+		return cmd
+	}
+	concern := bson.M{"level": s.readConcern}
+	if s.atClusterTime != 0 {
+		concern["atClusterTime"] = s.atClusterTime
+	}
+	return append(cmd, bson.DocElem{Name: "readConcern", Value: concern})
+}
+
+type cursorResult struct {
+	Cursor struct {
+		FirstBatch []bson.Raw `bson:"firstBatch"`
+		ID         int64      `bson:"id"`
+	} `bson:"cursor"`
+}
+
+// iter runs the find command and returns an iterator over its cursor, along with the func
+// closing the session it's read with once it's done. mgo can only read the cursor of a
+// command with a session holding on to the socket it ran on, which sessions in Eventual mode
+// don't: the command then runs on a copy of the session in Monotonic mode, which reads from
+// the same members but keeps its socket.
+func (s querySpec) iter() (*mgo.Iter, func()) {
+	collection, done := s.collection, func() {}
+	if sess := collection.Database.Session; sess.Mode() == mgo.Eventual {
+		sess = sess.Copy()
+		sess.SetMode(mgo.Monotonic, false)
+		collection, done = collection.With(sess), sess.Close
+	}
+	var res cursorResult
+	err := collection.Database.Run(s.findCommand(s.limit, false), &res)
+	return collection.NewIter(nil, res.Cursor.FirstBatch, res.Cursor.ID, err), done
+}
+
+func (s querySpec) all(result interface{}) error {
+	i, done := s.iter()
+	defer done()
+	return i.All(result)
+}
+
+func (s querySpec) one(result interface{}) error {
+	var res cursorResult
+	if err := s.runCommand(s.findCommand(1, true), &res); err != nil {
+		return err
+	}
+	if len(res.Cursor.FirstBatch) == 0 {
+		return mgo.ErrNotFound
+	}
+	return res.Cursor.FirstBatch[0].Unmarshal(result)
+}
+
+func (s querySpec) count() (int, error) {
+	if s.readConcern == "snapshot" {
+		return s.aggregateCount()
+	}
+	cmd := bson.D{
+		{Name: "count", Value: s.collection.Name},
+		{Name: "query", Value: s.filter},
+	}
+	if s.limit > 0 {
+		cmd = append(cmd, bson.DocElem{Name: "limit", Value: s.limit})
+	}
+	if s.skip > 0 {
+		cmd = append(cmd, bson.DocElem{Name: "skip", Value: s.skip})
+	}
+	if s.maxTime > 0 {
+		cmd = append(cmd, bson.DocElem{Name: "maxTimeMS", Value: s.maxTime.Milliseconds()})
+	}
+	if len(s.hint) > 0 {
+		cmd = append(cmd, bson.DocElem{Name: "hint", Value: fieldsDoc(s.hint)})
+	}
+	if s.collation != nil {
+		cmd = append(cmd, bson.DocElem{Name: "collation", Value: s.collation})
+	}
+	var res struct {
+		N int `bson:"n"`
+	}
+	err := s.runCommand(s.withReadConcern(cmd), &res)
+	return res.N, err
+}
+
+// aggregateCount counts the documents with the aggregate command, for the snapshot reads the
+// count command doesn't take.
+func (s querySpec) aggregateCount() (int, error) {
+	filter := s.filter
+	if filter == nil {
+		filter = bson.M{}
+	}
+	pipeline := []bson.M{{"$match": filter}}
+	if s.skip > 0 {
+		pipeline = append(pipeline, bson.M{"$skip": s.skip})
+	}
+	if s.limit > 0 {
+		pipeline = append(pipeline, bson.M{"$limit": s.limit})
+	}
+	pipeline = append(pipeline, bson.M{"$count": "n"})
+	cmd := bson.D{
+		{Name: "aggregate", Value: s.collection.Name},
+		{Name: "pipeline", Value: pipeline},
+		{Name: "cursor", Value: bson.M{}},
+	}
+	if s.maxTime > 0 {
+		cmd = append(cmd, bson.DocElem{Name: "maxTimeMS", Value: s.maxTime.Milliseconds()})
+	}
+	if len(s.hint) > 0 {
+		cmd = append(cmd, bson.DocElem{Name: "hint", Value: fieldsDoc(s.hint)})
+	}
+	if s.collation != nil {
+		cmd = append(cmd, bson.DocElem{Name: "collation", Value: s.collation})
+	}
+	var res cursorResult
+	if err := s.runCommand(s.withReadConcern(cmd), &res); err != nil {
+		return 0, err
+	}
+	if len(res.Cursor.FirstBatch) == 0 {
+		// $count outputs nothing when nothing matched
+		return 0, nil
+	}
+	var count struct {
+		N int `bson:"n"`
+	}
+	err := res.Cursor.FirstBatch[0].Unmarshal(&count)
+	return count.N, err
+}
+
+func (s querySpec) apply(change mgo.Change, result interface{}) (*mgo.ChangeInfo, error) {
+	cmd := bson.D{
+		{Name: "findAndModify", Value: s.collection.Name},
+		{Name: "query", Value: s.filter},
+	}
+	if len(s.sort) > 0 {
+		cmd = append(cmd, bson.DocElem{Name: "sort", Value: fieldsDoc(s.sort)})
+	}
+	if change.Remove {
+		cmd = append(cmd, bson.DocElem{Name: "remove", Value: true})
+	} else {
+		cmd = append(cmd,
+			bson.DocElem{Name: "update", Value: change.Update},
+			bson.DocElem{Name: "new", Value: change.ReturnNew},
+			bson.DocElem{Name: "upsert", Value: change.Upsert},
+		)
+	}
+	if s.projection != nil {
+		cmd = append(cmd, bson.DocElem{Name: "fields", Value: s.projection})
+	}
+	if s.collation != nil {
+		cmd = append(cmd, bson.DocElem{Name: "collation", Value: s.collation})
+	}
+
+	var res struct {
+		Value     bson.Raw `bson:"value"`
+		LastError struct {
+			N               int         `bson:"n"`
+			UpdatedExisting bool        `bson:"updatedExisting"`
+			Upserted        interface{} `bson:"upserted"`
+		} `bson:"lastErrorObject"`
+	}
+	if err := s.runCommand(cmd, &res); err != nil {
+		return nil, err
+	}
+	if res.Value.Kind == 0x0A || res.Value.Kind == 0 {
+		// mgo reports a findAndModify that matched nothing as not found
+		if !change.Upsert || change.Remove {
+			return nil, mgo.ErrNotFound
+		}
+	} else if result != nil {
+		if err := res.Value.Unmarshal(result); err != nil {
+			return nil, err
+		}
+	}
+	info := &mgo.ChangeInfo{}
+	lerr := res.LastError
+	if lerr.UpdatedExisting {
+		info.Updated = lerr.N
+		info.Matched = lerr.N
+	} else if change.Remove {
+		info.Removed = lerr.N
+		info.Matched = lerr.N
+	} else if change.Upsert {
+		info.UpsertedId = lerr.Upserted
+	}
+	return info, nil
+}
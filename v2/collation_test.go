@@ -0,0 +1,53 @@
+package mgohttp
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	mgo "gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+func TestQuerySpecFindCommand(t *testing.T) {
+	c := &Collation{Locale: "en", Strength: 2}
+	spec := querySpec{
+		collection: &mgo.Collection{Name: "users"},
+		filter:     bson.M{"email": "A@example.com"},
+		projection: bson.M{"email": 1},
+		sort:       []string{"-created", "+name"},
+		limit:      5,
+		collation:  c,
+	}
+
+	assert.Equal(t, bson.D{
+		{Name: "find", Value: "users"},
+		{Name: "filter", Value: bson.M{"email": "A@example.com"}},
+		{Name: "projection", Value: bson.M{"email": 1}},
+		{Name: "sort", Value: bson.D{{Name: "created", Value: -1}, {Name: "name", Value: 1}}},
+		{Name: "limit", Value: 1},
+		{Name: "singleBatch", Value: true},
+		{Name: "collation", Value: c},
+	}, spec.findCommand(1, true))
+
+	spec = querySpec{collection: &mgo.Collection{Name: "users"}}
+	assert.Equal(t, bson.D{
+		{Name: "find", Value: "users"},
+		{Name: "filter", Value: bson.M{}},
+	}, spec.findCommand(0, false))
+
+	spec = querySpec{
+		collection: &mgo.Collection{Name: "users"},
+		skip:       20,
+		batch:      100,
+		maxTime:    2 * time.Second,
+	}
+	assert.Equal(t, bson.D{
+		{Name: "find", Value: "users"},
+		{Name: "filter", Value: bson.M{}},
+		{Name: "skip", Value: 20},
+		{Name: "limit", Value: 10},
+		{Name: "batchSize", Value: 100},
+		{Name: "maxTimeMS", Value: int64(2000)},
+	}, spec.findCommand(10, false))
+}
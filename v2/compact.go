@@ -0,0 +1,60 @@
+package mgohttp
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// PayloadCompactor shortens a selector, update or projection logged on a span that's longer
+// than max bytes, see QueryLogging.MaxPayloadBytes. The result should make it clear the
+// payload was compacted.
+type PayloadCompactor func(payload string, max int) string
+
+// TruncatePayload keeps the start of payload, and marks how much was cut. It's the default
+// PayloadCompactor.
+func TruncatePayload(payload string, max int) string {
+	return truncatePayload(payload, max, defaultTruncationMarker)
+}
+
+const defaultTruncationMarker = "...[truncated %d bytes]"
+
+// truncatePayload is TruncatePayload with marker, in which %d is the size of payload.
+func truncatePayload(payload string, max int, marker string) string {
+	if strings.Contains(marker, "%d") {
+		marker = fmt.Sprintf(marker, len(payload))
+	}
+	keep := max - len(marker)
+	if keep < 0 {
+		keep = 0
+	}
+	// don't cut a rune in half
+	for keep > 0 && !utf8.RuneStart(payload[keep]) {
+		keep--
+	}
+	return payload[:keep] + marker
+}
+
+// HashPayload replaces payload with its hash and size, so identical payloads can still be
+// correlated across spans.
+func HashPayload(payload string, max int) string {
+	sum := sha256.Sum256([]byte(payload))
+	return fmt.Sprintf("sha256:%s[%d bytes]", hex.EncodeToString(sum[:8]), len(payload))
+}
+
+// compact caps payload according to l.
+func (l *QueryLogging) compact(payload string) string {
+	if l == nil || l.MaxPayloadBytes <= 0 || len(payload) <= l.MaxPayloadBytes {
+		return payload
+	}
+	if l.Compactor != nil {
+		return l.Compactor(payload, l.MaxPayloadBytes)
+	}
+	marker := l.TruncationMarker
+	if marker == "" {
+		marker = defaultTruncationMarker
+	}
+	return truncatePayload(payload, l.MaxPayloadBytes, marker)
+}
@@ -0,0 +1,40 @@
+package mgohttp
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	bson "gopkg.in/mgo.v2/bson"
+)
+
+func TestCompactPayload(t *testing.T) {
+	payload := "ids=" + strings.Repeat("x", 200)
+	truncated := TruncatePayload(payload, 64)
+	assert.Len(t, truncated, 64)
+	assert.True(t, strings.HasPrefix(truncated, "ids=xxx"))
+	assert.True(t, strings.HasSuffix(truncated, "...[truncated 204 bytes]"))
+
+	// runes aren't cut in half
+	assert.Equal(t, "é...[truncated 10 bytes]", TruncatePayload("ééééé", 26))
+
+	hashed := HashPayload(payload, 64)
+	assert.Equal(t, hashed, HashPayload(payload, 64))
+	assert.True(t, strings.HasPrefix(hashed, "sha256:"))
+	assert.True(t, strings.HasSuffix(hashed, "[204 bytes]"))
+
+	var l *QueryLogging
+	assert.Equal(t, payload, l.compact(payload))
+	l = &QueryLogging{Mode: QueryLogValues, MaxPayloadBytes: 64}
+	assert.Equal(t, "name=ada", l.compact("name=ada"))
+	assert.Equal(t, truncated, l.compact(payload))
+	l.TruncationMarker = "…(%d bytes)"
+	assert.True(t, strings.HasSuffix(l.compact(payload), "x…(204 bytes)"))
+	assert.Len(t, l.compact(payload), 64)
+	l.Compactor = HashPayload
+	assert.Equal(t, hashed, l.compact(payload))
+
+	ctx := context.WithValue(context.Background(), handlerKey, &SessionHandler{cfg: SessionHandlerConfig{QueryLogging: l}})
+	assert.Equal(t, hashed, bsonToKeys(ctx, LogSelector, bson.M{"ids": strings.Repeat("x", 200)}).Value())
+}
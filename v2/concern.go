@@ -0,0 +1,41 @@
+package mgohttp
+
+import (
+	opentracing "github.com/opentracing/opentracing-go"
+	mgo "gopkg.in/mgo.v2"
+)
+
+// writeConcern is the write concern of a collection returned by WithWriteConcern. A nil safe
+// is a valid concern, unacknowledged writes.
+type writeConcern struct {
+	safe *mgo.Safe
+}
+
+func (tc tracedMgoCollection) WithWriteConcern(safe *mgo.Safe) MongoCollection {
+	recordUsage("MongoCollection.WithWriteConcern")
+	tc.concern = &writeConcern{safe: safe}
+	return tc
+}
+
+// writer returns the collection a write goes to, along with a func to release it. With a
+// write concern, it's bound to a copy of the session set to that concern, since mgo only
+// knows of session-wide write concerns.
+func (tc tracedMgoCollection) writer(sp opentracing.Span) (*mgo.Collection, func()) {
+	if tc.concern == nil {
+		return tc.collection, func() {}
+	}
+	sp.SetTag(TagWriteConcern, safeName(tc.concern.safe))
+	sess := tc.collection.Database.Session.Copy()
+	sess.SetSafe(tc.concern.safe)
+	return tc.collection.With(sess), sess.Close
+}
+
+func (q tracedMongoQuery) WithReadConcern(level string) MongoQuery {
+	recordUsage("MongoQuery.WithReadConcern")
+	if level == "snapshot" {
+		return q.WithSnapshot()
+	}
+	q.op.SetTag(TagReadConcern, level)
+	q.spec.readConcern = level
+	return q
+}
@@ -0,0 +1,65 @@
+package mgohttp
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/opentracing/opentracing-go/mocktracer"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	mgo "gopkg.in/mgo.v2"
+	bson "gopkg.in/mgo.v2/bson"
+)
+
+func TestWithReadConcern(t *testing.T) {
+	spec := querySpec{collection: &mgo.Collection{Name: "users"}, readConcern: "majority"}
+	assert.Equal(t, bson.D{
+		{Name: "find", Value: "users"},
+		{Name: "filter", Value: bson.M{}},
+		{Name: "readConcern", Value: bson.M{"level": "majority"}},
+	}, spec.findCommand(0, false))
+
+	tracer := mocktracer.New()
+	ctx := context.WithValue(context.Background(), handlerKey, &SessionHandler{cfg: SessionHandlerConfig{Tracer: tracer}})
+	db := tracedMgoDatabase{db: &mgo.Database{Name: testDBName, Session: &mgo.Session{}}, ctx: ctx}
+	q := db.C("users").Find(nil).WithReadConcern("majority").(tracedMongoQuery)
+	assert.Equal(t, "majority", q.spec.readConcern)
+	q.op.Finish()
+	spans := tracer.FinishedSpans()
+	require.Len(t, spans, 1)
+	assert.Equal(t, "majority", spans[0].Tag(TagReadConcern))
+
+	// "snapshot" takes the logical sessions mgo doesn't have
+	err := db.C("users").Find(nil).WithReadConcern("snapshot").One(&bson.M{})
+	assert.True(t, errors.Is(err, ErrSnapshotReadsUnsupported))
+}
+
+func TestWithWriteConcern(t *testing.T) {
+	tracer := mocktracer.New()
+	ctx := context.WithValue(context.Background(), handlerKey, &SessionHandler{cfg: SessionHandlerConfig{Tracer: tracer, RecoverDriverPanics: true}})
+	// the sessions aren't connected, so copying them for the write concern panics, leaving
+	// them locked
+	collection := func(safe *mgo.Safe) MongoCollection {
+		db := tracedMgoDatabase{db: &mgo.Database{Name: testDBName, Session: &mgo.Session{}}, ctx: ctx}
+		return db.C("events").WithWriteConcern(safe)
+	}
+
+	majority := &mgo.Safe{WMode: "majority"}
+	assert.True(t, errors.Is(collection(majority).Insert(bson.M{"a": 1}), ErrDriverPanic))
+	bulk := collection(majority).Bulk()
+	bulk.Insert(bson.M{"a": 1})
+	_, err := bulk.Run()
+	assert.True(t, errors.Is(err, ErrDriverPanic))
+	_, err = collection(nil).RemoveAll(bson.M{"a": 1})
+	assert.True(t, errors.Is(err, ErrDriverPanic))
+
+	concerns := []interface{}{}
+	for _, sp := range tracer.FinishedSpans() {
+		concerns = append(concerns, sp.Tag(TagWriteConcern))
+	}
+	assert.Equal(t, []interface{}{"w=majority", "w=majority", "unacknowledged"}, concerns)
+
+	failed := failedCollection{err: errors.New("no session")}
+	assert.Equal(t, failed, failed.WithWriteConcern(nil))
+}
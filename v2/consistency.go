@@ -0,0 +1,49 @@
+package mgohttp
+
+import (
+	"net/http"
+	"strings"
+
+	mgo "gopkg.in/mgo.v2"
+)
+
+// DefaultConsistencyHeader is the header read by ConsistencyOverride when none is configured.
+const DefaultConsistencyHeader = "X-Read-Consistency"
+
+// DefaultConsistencyModes are the header values ConsistencyOverride accepts when no Modes are
+// configured.
+var DefaultConsistencyModes = map[string]mgo.Mode{
+	"strong":    mgo.Strong,
+	"monotonic": mgo.Monotonic,
+	"eventual":  mgo.Eventual,
+}
+
+// ConsistencyOverride lets the caller of an endpoint choose the consistency mode of the
+// request's session with a header, e.g. "X-Read-Consistency: eventual" for feed endpoints and
+// "strong" for account endpoints of the same service. It's meant for internal callers such as
+// a BFF: only allow it on handlers that aren't reachable from the outside.
+type ConsistencyOverride struct {
+	// Header is the request header to read, DefaultConsistencyHeader when empty.
+	Header string
+	// Modes maps the allowed header values (case-insensitive) to session modes,
+	// DefaultConsistencyModes when nil. Other values are ignored.
+	Modes map[string]mgo.Mode
+}
+
+// mode returns the mode requested by r, if it's allowed.
+func (o ConsistencyOverride) mode(r *http.Request) (string, mgo.Mode, bool) {
+	header := o.Header
+	if header == "" {
+		header = DefaultConsistencyHeader
+	}
+	value := strings.ToLower(strings.TrimSpace(r.Header.Get(header)))
+	if value == "" {
+		return "", 0, false
+	}
+	modes := o.Modes
+	if modes == nil {
+		modes = DefaultConsistencyModes
+	}
+	mode, ok := modes[value]
+	return value, mode, ok
+}
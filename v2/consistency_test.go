@@ -0,0 +1,29 @@
+package mgohttp
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	mgo "gopkg.in/mgo.v2"
+)
+
+func TestConsistencyOverrideMode(t *testing.T) {
+	r := httptest.NewRequest("GET", "/feed", nil)
+	_, _, ok := ConsistencyOverride{}.mode(r)
+	assert.False(t, ok, "no header")
+
+	r.Header.Set("X-Read-Consistency", "Eventual")
+	value, mode, ok := ConsistencyOverride{}.mode(r)
+	assert.True(t, ok)
+	assert.Equal(t, "eventual", value)
+	assert.Equal(t, mgo.Eventual, mode)
+
+	_, _, ok = ConsistencyOverride{Modes: map[string]mgo.Mode{"strong": mgo.Strong}}.mode(r)
+	assert.False(t, ok, "eventual isn't allowed")
+
+	r.Header.Set("X-Consistency", "nearest")
+	_, mode, ok = ConsistencyOverride{Header: "X-Consistency", Modes: map[string]mgo.Mode{"nearest": mgo.Nearest}}.mode(r)
+	assert.True(t, ok)
+	assert.Equal(t, mgo.Nearest, mode)
+}
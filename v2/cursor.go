@@ -0,0 +1,113 @@
+package mgohttp
+
+import (
+	"context"
+	"reflect"
+	"sync"
+	"time"
+
+	opentracing "github.com/opentracing/opentracing-go"
+)
+
+// cursorStats tracks the round trips of a cursor, from its first batch until it's closed, and
+// reports them on the cursor's span and to the handler's Metrics, to tune the batch sizes of
+// the scans.
+type cursorStats struct {
+	ctx        context.Context
+	collection string
+	start      time.Time
+
+	mu sync.Mutex
+	// docs counts the documents received, for the cursors of pipelines, or read, for those of
+	// queries
+	docs int64
+	// getMores counts the getMore round trips after the first batch, -1 when the driver
+	// doesn't expose them
+	getMores int
+	// batch is the batch size of a query, to estimate its getMores from the documents read
+	batch    int
+	reported bool
+}
+
+// newPipeCursorStats returns the stats of a pipeline's cursor, whose getMores are counted
+// exactly since mgohttp issues them.
+func newPipeCursorStats(ctx context.Context, collection string) *cursorStats {
+	return &cursorStats{ctx: ctx, collection: collection, start: time.Now()}
+}
+
+// newQueryCursorStats returns the stats of a query's cursor. mgo issues its getMores, so they
+// are estimated from the documents read when the query has a batch size, and not reported
+// otherwise.
+func newQueryCursorStats(ctx context.Context, collection string, batch int) *cursorStats {
+	return &cursorStats{ctx: ctx, collection: collection, start: time.Now(), getMores: -1, batch: batch}
+}
+
+// received counts a batch of n documents, either the first one or a getMore's.
+func (c *cursorStats) received(n int, getMore bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.docs += int64(n)
+	if getMore {
+		c.getMores++
+	}
+}
+
+// read counts the documents read by the cursor of a query.
+func (c *cursorStats) read(n int) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	c.docs += int64(n)
+	c.mu.Unlock()
+}
+
+// readAll counts the documents read into result, a pointer to a slice, by All.
+func (c *cursorStats) readAll(result interface{}) {
+	if v := reflect.ValueOf(result); v.Kind() == reflect.Ptr && v.Elem().Kind() == reflect.Slice {
+		c.read(v.Elem().Len())
+	}
+}
+
+// report tags the cursor's span and records the metrics, once, when the cursor is closed.
+func (c *cursorStats) report() {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	if c.reported {
+		c.mu.Unlock()
+		return
+	}
+	c.reported = true
+	docs, getMores := c.docs, c.getMores
+	c.mu.Unlock()
+
+	estimated := false
+	if getMores < 0 && c.batch > 0 {
+		getMores, estimated = int((docs+int64(c.batch)-1)/int64(c.batch))-1, true
+		if getMores < 0 {
+			getMores = 0
+		}
+	}
+	lifetime := time.Since(c.start)
+	sp := opentracing.SpanFromContext(c.ctx)
+	if sp != nil {
+		sp.SetTag(TagCursorDocs, docs)
+		sp.SetTag(TagCursorLifetimeMs, lifetime.Milliseconds())
+	}
+	avgBatch := -1.0
+	if getMores >= 0 {
+		avgBatch = float64(docs) / float64(getMores+1)
+		if sp != nil {
+			sp.SetTag(TagCursorGetMores, getMores)
+			sp.SetTag(TagCursorAvgBatch, avgBatch)
+			if estimated {
+				sp.SetTag(TagCursorGetMoresEstimated, true)
+			}
+		}
+	}
+	if h := handlerFromContext(c.ctx); h != nil {
+		h.cfg.Metrics.observeCursor(c.collection, getMores, avgBatch, lifetime)
+	}
+}
@@ -0,0 +1,62 @@
+package mgohttp
+
+import (
+	"context"
+	"testing"
+
+	opentracing "github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/mocktracer"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCursorStats(t *testing.T) {
+	metrics, err := NewMetrics(prometheus.NewRegistry())
+	require.NoError(t, err)
+	tracer := mocktracer.New()
+	ctx := context.WithValue(context.Background(), handlerKey, &SessionHandler{cfg: SessionHandlerConfig{Tracer: tracer, Metrics: metrics}})
+	cursor := func() (*mocktracer.MockSpan, context.Context) {
+		sp := tracer.StartSpan("cursor").(*mocktracer.MockSpan)
+		return sp, opentracing.ContextWithSpan(ctx, sp)
+	}
+
+	sp, spCtx := cursor()
+	pipe := newPipeCursorStats(spCtx, "events")
+	pipe.received(100, false)
+	pipe.received(100, true)
+	pipe.received(50, true)
+	pipe.report()
+	pipe.report()
+	assert.Equal(t, int64(250), sp.Tag(TagCursorDocs))
+	assert.Equal(t, 2, sp.Tag(TagCursorGetMores))
+	assert.InDelta(t, 250.0/3, sp.Tag(TagCursorAvgBatch), 0.001)
+	assert.NotNil(t, sp.Tag(TagCursorLifetimeMs))
+	assert.Nil(t, sp.Tag(TagCursorGetMoresEstimated))
+
+	sp, spCtx = cursor()
+	query := newQueryCursorStats(spCtx, "events", 100)
+	query.read(1)
+	query.readAll(&[]int{1, 2, 3})
+	query.read(200)
+	query.report()
+	assert.Equal(t, int64(204), sp.Tag(TagCursorDocs))
+	assert.Equal(t, 2, sp.Tag(TagCursorGetMores))
+	assert.Equal(t, true, sp.Tag(TagCursorGetMoresEstimated))
+
+	sp, spCtx = cursor()
+	unbatched := newQueryCursorStats(spCtx, "events", 0)
+	unbatched.read(10)
+	unbatched.report()
+	assert.Equal(t, int64(10), sp.Tag(TagCursorDocs))
+	assert.Nil(t, sp.Tag(TagCursorGetMores), "mgo doesn't expose the getMores")
+
+	assert.Equal(t, 1, testutil.CollectAndCount(metrics.cursorGetMores, "mgohttp_cursor_getmores"))
+	assert.Equal(t, 1, testutil.CollectAndCount(metrics.cursorBatchDocs, "mgohttp_cursor_batch_docs"))
+	assert.Equal(t, 1, testutil.CollectAndCount(metrics.cursorLifetime, "mgohttp_cursor_lifetime_seconds"))
+
+	var stats *cursorStats
+	stats.read(1)
+	stats.report()
+}
@@ -0,0 +1,68 @@
+package mgohttp
+
+import (
+	"context"
+	"crypto/subtle"
+	"net/http"
+	"time"
+
+	"gopkg.in/Clever/kayvee-go.v6/logger"
+)
+
+type debugKeyType struct{}
+
+// debugKey marks the operations of the requests with verbose diagnostics, see
+// SessionHandlerConfig.DebugHeader.
+var debugKey = debugKeyType{}
+
+func debugging(ctx context.Context) bool {
+	debug, _ := ctx.Value(debugKey).(bool)
+	return debug
+}
+
+// debugRequested reports whether r asks for verbose diagnostics with one of the handler's
+// DebugTokens.
+func (c *SessionHandler) debugRequested(r *http.Request) bool {
+	if c.cfg.DebugHeader == "" {
+		return false
+	}
+	token := r.Header.Get(c.cfg.DebugHeader)
+	if token == "" {
+		return false
+	}
+	for _, allowed := range c.cfg.DebugTokens {
+		if subtle.ConstantTimeCompare([]byte(token), []byte(allowed)) == 1 {
+			return true
+		}
+	}
+	return false
+}
+
+// debugQueryLogging is the QueryLogging of the requests with verbose diagnostics: every
+// value is logged, within the payload limits of the handler's QueryLogging l.
+func debugQueryLogging(l *QueryLogging) *QueryLogging {
+	d := &QueryLogging{Mode: QueryLogValues}
+	if l != nil {
+		d.MaxPayloadBytes, d.Compactor = l.MaxPayloadBytes, l.Compactor
+	}
+	return d
+}
+
+// logDebug logs an operation of a request with verbose diagnostics.
+func (o *opSpan) logDebug(elapsed time.Duration, err error) {
+	data := logger.M{
+		"op":          o.name,
+		"collection":  o.collection,
+		"duration-ms": elapsed.Milliseconds(),
+	}
+	if o.fingerprint != "" {
+		data["fingerprint"] = o.fingerprint
+	}
+	if err != nil {
+		data["error"] = err.Error()
+	}
+	for k, v := range queryTags(o.ctx) {
+		data[k] = v
+	}
+	logger.FromContext(o.ctx).InfoD("mgohttp-debug-op", data)
+}
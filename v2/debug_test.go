@@ -0,0 +1,75 @@
+package mgohttp
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/opentracing/opentracing-go/mocktracer"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/Clever/kayvee-go.v6/logger"
+	mgo "gopkg.in/mgo.v2"
+	bson "gopkg.in/mgo.v2/bson"
+)
+
+func TestDebugHeader(t *testing.T) {
+	serve := func(token string) ([]*mocktracer.MockSpan, string) {
+		tracer := mocktracer.New()
+		handler := NewSessionHandler(SessionHandlerConfig{
+			Database:   testDBName,
+			Timeout:    handlerTimeout,
+			NewSession: func(ctx context.Context) (*mgo.Session, error) { return &mgo.Session{}, nil },
+			// the session isn't connected, the update must not reach it
+			Interceptors: []Interceptor{func(ctx context.Context, op *OpInfo, next func() error) error {
+				return errors.New("rejected")
+			}},
+			Tracer:         tracer,
+			DisableOpSpans: true,
+			DebugHeader:    "X-Mgohttp-Debug",
+			DebugTokens:    []string{"s3cret"},
+			Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				FromContext(r.Context(), testDBName).DB("app").C("users").
+					Update(bson.M{"email": "a@example.com"}, bson.M{"$set": bson.M{"name": "A"}})
+			}),
+		})
+		var logs bytes.Buffer
+		log := logger.New("mgohttp-test")
+		log.SetOutput(&logs)
+		r := httptest.NewRequest("GET", "/", nil)
+		r = r.WithContext(logger.NewContext(r.Context(), log))
+		if token != "" {
+			r.Header.Set("X-Mgohttp-Debug", token)
+		}
+		handler.ServeHTTP(httptest.NewRecorder(), r)
+		return tracer.FinishedSpans(), logs.String()
+	}
+
+	for _, token := range []string{"", "guess"} {
+		spans, logs := serve(token)
+		assert.Len(t, spans, 1, "only the root span")
+		assert.Nil(t, spans[0].Tag(TagDebug))
+		assert.NotContains(t, logs, "mgohttp-debug-op")
+	}
+
+	spans, logs := serve("s3cret")
+	ops := map[string]*mocktracer.MockSpan{}
+	for _, sp := range spans {
+		ops[sp.OperationName] = sp
+	}
+	assert.Equal(t, true, ops["mgohttp"].Tag(TagDebug))
+	if assert.Contains(t, ops, "update", "debug requests get op spans whatever the sampling") {
+		logged := []string{}
+		for _, rec := range ops["update"].Logs() {
+			for _, f := range rec.Fields {
+				logged = append(logged, f.ValueString)
+			}
+		}
+		assert.Contains(t, strings.Join(logged, " "), "email=a@example.com")
+	}
+	assert.Contains(t, logs, `"title":"mgohttp-debug-op"`)
+	assert.Contains(t, logs, `"error":"rejected"`)
+}
@@ -0,0 +1,34 @@
+package mgohttp
+
+import (
+	opentracing "github.com/opentracing/opentracing-go"
+	opentracinglog "github.com/opentracing/opentracing-go/log"
+)
+
+// Decisions logged as span events when mgohttp changes the path of a request, so trace viewers
+// show why it took that path. The event is logged under the "event" key, along with
+// LogDecisionReason.
+const (
+	// DecisionSessionWait is logged when a request waits for a session because of
+	// SessionHandlerConfig.MaxConcurrentSessions.
+	DecisionSessionWait = "session-wait"
+	// DecisionSessionRejected is logged when a request doesn't get a session because of
+	// SessionHandlerConfig.MaxConcurrentSessions.
+	DecisionSessionRejected = "session-rejected"
+	// DecisionShed is logged when HealthMonitor.Middleware rejects a request while Mongo is
+	// degraded.
+	DecisionShed = "shed"
+	// DecisionOptionalSkipped is logged when Optional skips its query.
+	DecisionOptionalSkipped = "optional-skipped"
+)
+
+// logDecision logs decision on sp with its reason.
+func logDecision(sp opentracing.Span, decision, reason string) {
+	if sp == nil {
+		return
+	}
+	sp.LogFields(
+		opentracinglog.String("event", decision),
+		opentracinglog.String(LogDecisionReason, reason),
+	)
+}
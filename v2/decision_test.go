@@ -0,0 +1,60 @@
+package mgohttp
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	opentracing "github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/mocktracer"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// decisions returns the decisions logged on sp with their reason.
+func decisions(sp *mocktracer.MockSpan) map[string]string {
+	logged := map[string]string{}
+	for _, record := range sp.Logs() {
+		fields := map[string]string{}
+		for _, field := range record.Fields {
+			fields[field.Key] = field.ValueString
+		}
+		if event, ok := fields["event"]; ok {
+			logged[event] = fields[LogDecisionReason]
+		}
+	}
+	return logged
+}
+
+func TestDecisionShed(t *testing.T) {
+	m := NewHealthMonitor(HealthMonitorConfig{MinSamples: 1})
+	m.Observe(time.Millisecond, io.EOF)
+	handler := m.Middleware(http.NotFoundHandler(), ShedRule{Match: PathPrefix("/"), StatusCode: http.StatusServiceUnavailable})
+
+	sp := mocktracer.New().StartSpan("request").(*mocktracer.MockSpan)
+	r := httptest.NewRequest("GET", "/", nil)
+	handler.ServeHTTP(httptest.NewRecorder(), r.WithContext(opentracing.ContextWithSpan(r.Context(), sp)))
+	assert.Equal(t, map[string]string{DecisionShed: "mongo degraded, status 503"}, decisions(sp))
+}
+
+func TestDecisionSessionRejected(t *testing.T) {
+	tracer := mocktracer.New()
+	errs := make(chan error, 1)
+	handler := sessionLimitTestHandler(true, handlerTimeout, nil, errs)
+	handler.cfg.Tracer = tracer
+	handler.sessionSlots <- struct{}{}
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	require.True(t, errors.Is(<-errs, ErrTooManySessions))
+
+	var root *mocktracer.MockSpan
+	for _, sp := range tracer.FinishedSpans() {
+		if sp.OperationName == "mgohttp" {
+			root = sp
+		}
+	}
+	require.NotNil(t, root)
+	assert.Equal(t, map[string]string{DecisionSessionRejected: "max concurrent sessions reached, failing fast"}, decisions(root))
+}
@@ -0,0 +1,75 @@
+package mgohttp
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/goleak"
+	mgo "gopkg.in/mgo.v2"
+)
+
+// fakeCopier hands out sessions that are never connected, for tests that don't talk to Mongo.
+type fakeCopier struct{}
+
+func (fakeCopier) Copy() *mgo.Session { return &mgo.Session{} }
+
+func newDeferredTestHandler(h http.HandlerFunc) *SessionHandler {
+	handler := NewSessionHandler(SessionHandlerConfig{
+		Database:          testDBName,
+		Timeout:           handlerTimeout,
+		Handler:           h,
+		DeferUntilSession: true,
+	}).(*SessionHandler)
+	handler.parentSession = fakeCopier{}
+	handler.errorCode = testingStatusCode
+	return handler
+}
+
+func TestDeferUntilSessionWithoutSession(t *testing.T) {
+	defer goleak.VerifyNone(t, goleak.IgnoreCurrent())
+
+	handler := newDeferredTestHandler(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Test", "yes")
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte("ok"))
+	})
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+	assert.Equal(t, http.StatusCreated, rec.Code)
+	assert.Equal(t, "yes", rec.Header().Get("X-Test"))
+	assert.Equal(t, "ok", rec.Body.String())
+	assert.Equal(t, SessionHandlerStats{}, handler.Stats())
+}
+
+func TestDeferUntilSessionTimeout(t *testing.T) {
+	defer goleak.VerifyNone(t, goleak.IgnoreCurrent())
+
+	var writeErr error
+	handler := newDeferredTestHandler(func(w http.ResponseWriter, r *http.Request) {
+		FromContext(r.Context(), testDBName)
+		time.Sleep(2 * handlerTimeout)
+		_, writeErr = w.Write([]byte("too late"))
+	})
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+	assert.Equal(t, testingStatusCode, rec.Code)
+	assert.Equal(t, http.ErrHandlerTimeout, writeErr)
+	assert.Empty(t, rec.Body.String())
+	assert.Equal(t, SessionHandlerStats{TimedOut: 1}, handler.Stats())
+}
+
+func TestDeferUntilSessionBeforeTimeout(t *testing.T) {
+	handler := newDeferredTestHandler(func(w http.ResponseWriter, r *http.Request) {
+		FromContext(r.Context(), testDBName)
+		w.Write([]byte("ok"))
+	})
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+	time.Sleep(2 * handlerTimeout)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "ok", rec.Body.String())
+	assert.Equal(t, SessionHandlerStats{}, handler.Stats())
+}
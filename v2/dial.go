@@ -0,0 +1,245 @@
+package mgohttp
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	mgo "gopkg.in/mgo.v2"
+)
+
+// defaultDialTimeout bounds the connection to the servers when Dial has no WithDialTimeout.
+const defaultDialTimeout = 10 * time.Second
+
+// DialOption configures Dial.
+type DialOption func(*dialConfig)
+
+type dialConfig struct {
+	timeout time.Duration
+	tls     *tls.Config
+	// caPEMs are the certificates of the CAs trusted on top of the TLS config's
+	caPEMs [][]byte
+	caFile string
+	// username, password and source are the SCRAM credentials, source the database they're
+	// defined in
+	username string
+	password string
+	source   string
+	// srvRefresh is the interval of the resolutions of a mongodb+srv URL, see WithSRVRefresh
+	srvRefresh time.Duration
+	resolver   srvResolver
+}
+
+// WithDialTimeout bounds the connection to the servers, 10s by default. It's also the timeout
+// of the socket of the sessions, until the SessionHandler sets the requests' own.
+func WithDialTimeout(d time.Duration) DialOption {
+	return func(c *dialConfig) { c.timeout = d }
+}
+
+// WithTLS connects to the servers over TLS with cfg, or with the system's CAs when nil. The
+// URL option tls=true (or ssl=true) does the same.
+func WithTLS(cfg *tls.Config) DialOption {
+	return func(c *dialConfig) {
+		if cfg == nil {
+			cfg = &tls.Config{}
+		}
+		c.tls = cfg.Clone()
+	}
+}
+
+// WithCA connects to the servers over TLS, trusting the CA certificates of pem on top of
+// those of the TLS config, e.g. the CA of a managed cluster.
+func WithCA(pem []byte) DialOption {
+	return func(c *dialConfig) { c.caPEMs = append(c.caPEMs, pem) }
+}
+
+// WithCAFile is WithCA with the certificates read from path. The URL option tlsCAFile does
+// the same.
+func WithCAFile(path string) DialOption {
+	return func(c *dialConfig) { c.caFile = path }
+}
+
+// WithCredentials authenticates with SCRAM-SHA-1 as username, defined in the source database,
+// "admin" when empty. They take precedence over the credentials of the URL.
+func WithCredentials(username, password, source string) DialOption {
+	return func(c *dialConfig) {
+		c.username, c.password, c.source = username, password, source
+	}
+}
+
+// Dial connects to the servers of url, a mongodb:// or mongodb+srv:// connection string, with
+// the options. On top of the URL options mgo supports, it accepts tls (or ssl), tlsCAFile and
+// connectTimeoutMS, which the options override. The session is meant to be the Sess of a
+// SessionHandler, see NewSessionHandlerFromURL.
+func Dial(rawURL string, opts ...DialOption) (*mgo.Session, error) {
+	info, err := dialInfo(rawURL, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return mgo.DialWithInfo(info)
+}
+
+// NewSessionHandlerFromURL dials url with the options, see Dial, and returns the
+// SessionHandler of cfg with the session as its parent session, in place of cfg.Sess. Unlike
+// a SessionHandlerConfig.URL, it fails when the servers can't be reached. Its Shutdown closes
+// the session.
+func NewSessionHandlerFromURL(rawURL string, cfg SessionHandlerConfig, opts ...DialOption) (http.Handler, error) {
+	cfg.Sess, cfg.URL, cfg.DialOptions = nil, rawURL, opts
+	h := NewSessionHandler(cfg).(*SessionHandler)
+	parent := h.parentSession.(*dialedParent)
+	if err := parent.connect(); err != nil {
+		parent.Close()
+		return nil, err
+	}
+	return h, nil
+}
+
+func newDialConfig(opts []DialOption) dialConfig {
+	cfg := dialConfig{resolver: net.DefaultResolver}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	return cfg
+}
+
+// dialInfo returns the DialInfo of url with the options.
+func dialInfo(rawURL string, opts ...DialOption) (*mgo.DialInfo, error) {
+	info, _, err := dialInfoHosts(rawURL, opts...)
+	return info, err
+}
+
+// dialInfoHosts is dialInfo, also returning the hosts a mongodb+srv URL resolved to.
+func dialInfoHosts(rawURL string, opts ...DialOption) (*mgo.DialInfo, []string, error) {
+	cfg := newDialConfig(opts)
+	var hosts []string
+	if isSRVURL(rawURL) {
+		timeout := cfg.timeout
+		if timeout <= 0 {
+			timeout = defaultDialTimeout
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+		var err error
+		if rawURL, hosts, err = expandSRV(ctx, cfg.resolver, rawURL); err != nil {
+			return nil, nil, err
+		}
+	}
+	mgoURL, err := cfg.parseURLOptions(rawURL)
+	if err != nil {
+		return nil, nil, err
+	}
+	info, err := mgo.ParseURL(mgoURL)
+	if err != nil {
+		return nil, nil, fmt.Errorf("mgohttp: parsing the dial URL: %w", err)
+	}
+	info.Timeout = cfg.timeout
+	if info.Timeout <= 0 {
+		info.Timeout = defaultDialTimeout
+	}
+	if cfg.username != "" {
+		info.Username, info.Password, info.Source = cfg.username, cfg.password, cfg.source
+		info.Mechanism = "SCRAM-SHA-1"
+	}
+	tlsConfig, err := cfg.tlsConfig()
+	if err != nil {
+		return nil, nil, err
+	}
+	if tlsConfig != nil {
+		timeout := info.Timeout
+		info.DialServer = func(addr *mgo.ServerAddr) (net.Conn, error) {
+			return tls.DialWithDialer(&net.Dialer{Timeout: timeout}, "tcp", addr.String(), tlsConfig)
+		}
+	}
+	return info, hosts, nil
+}
+
+// parseURLOptions applies the URL options mgo doesn't support, unless the DialOptions set
+// them, and returns the URL without them.
+func (c *dialConfig) parseURLOptions(rawURL string) (string, error) {
+	base, query, ok := strings.Cut(rawURL, "?")
+	if !ok {
+		return rawURL, nil
+	}
+	values, err := url.ParseQuery(query)
+	if err != nil {
+		return "", fmt.Errorf("mgohttp: parsing the options of the dial URL: %w", err)
+	}
+	for _, key := range []string{"tls", "ssl"} {
+		if v := values.Get(key); v != "" {
+			enabled, err := strconv.ParseBool(v)
+			if err != nil {
+				return "", fmt.Errorf("mgohttp: bad value for %s: %s", key, v)
+			}
+			if enabled && c.tls == nil {
+				c.tls = &tls.Config{}
+			}
+			values.Del(key)
+		}
+	}
+	if v := values.Get("tlsCAFile"); v != "" {
+		if c.caFile == "" {
+			c.caFile = v
+		}
+		values.Del("tlsCAFile")
+	}
+	if v := values.Get("connectTimeoutMS"); v != "" {
+		ms, err := strconv.Atoi(v)
+		if err != nil {
+			return "", fmt.Errorf("mgohttp: bad value for connectTimeoutMS: %s", v)
+		}
+		if c.timeout == 0 {
+			c.timeout = time.Duration(ms) * time.Millisecond
+		}
+		values.Del("connectTimeoutMS")
+	}
+	if len(values) == 0 {
+		return base, nil
+	}
+	return base + "?" + values.Encode(), nil
+}
+
+// tlsConfig returns the TLS config to dial with, nil without TLS.
+func (c *dialConfig) tlsConfig() (*tls.Config, error) {
+	pems := c.caPEMs
+	if c.caFile != "" {
+		pem, err := os.ReadFile(c.caFile)
+		if err != nil {
+			return nil, fmt.Errorf("mgohttp: reading the CA file: %w", err)
+		}
+		pems = append(pems, pem)
+	}
+	if c.tls == nil && len(pems) == 0 {
+		return nil, nil
+	}
+	cfg := c.tls.Clone()
+	if cfg == nil {
+		cfg = &tls.Config{}
+	}
+	if len(pems) > 0 {
+		if cfg.RootCAs == nil {
+			pool, err := x509.SystemCertPool()
+			if err != nil {
+				pool = x509.NewCertPool()
+			}
+			cfg.RootCAs = pool
+		} else {
+			// the pool of WithTLS's config belongs to the caller
+			cfg.RootCAs = cfg.RootCAs.Clone()
+		}
+		for _, pem := range pems {
+			if !cfg.RootCAs.AppendCertsFromPEM(pem) {
+				return nil, errors.New("mgohttp: no CA certificate found in the PEM")
+			}
+		}
+	}
+	return cfg, nil
+}
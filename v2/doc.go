@@ -0,0 +1,11 @@
+// Package mgohttp is version 2 of the mgohttp API: a single constructor, New, configured with
+// options and a pluggable Backend, mgo or another Driver such as the official driver's, in
+// place of the config structs of NewSessionHandler and NewHealthHandler.
+//
+// It holds the implementation of both versions: the package of v1 (github.com/Clever/mgohttp)
+// declares aliases of the types of v2, and its errors are the same values, so both import
+// paths can be used side by side while a service migrates: a session from v1's FromContext is
+// a v2 MongoSession, errors.Is matches the errors of either, and mgohttptest and mocks work
+// with both. NewSessionHandler and the other constructors of v1 remain for the services that
+// haven't moved to New yet.
+package mgohttp
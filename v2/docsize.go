@@ -0,0 +1,223 @@
+package mgohttp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	opentracing "github.com/opentracing/opentracing-go"
+	"gopkg.in/Clever/kayvee-go.v6/logger"
+	bson "gopkg.in/mgo.v2/bson"
+)
+
+// MaxDocumentBytes is the largest document Mongo stores.
+const MaxDocumentBytes = 16 * 1024 * 1024
+
+// ErrDocumentTooLarge is the sentinel wrapped by every DocumentTooLargeError.
+var ErrDocumentTooLarge = errors.New("document would exceed the size limit")
+
+// DocumentTooLargeError is returned by an update the DocumentSizeCheck rejected because the
+// document it updates would outgrow the limit. DefaultErrorMapper maps it to 413.
+type DocumentTooLargeError struct {
+	Collection string
+	// EstimatedBytes is the estimated size of the updated document.
+	EstimatedBytes int
+	Limit          int
+}
+
+func (e DocumentTooLargeError) Error() string {
+	return fmt.Sprintf("mgohttp: update %s: %s (about %d bytes, limit %d)",
+		e.Collection, ErrDocumentTooLarge, e.EstimatedBytes, e.Limit)
+}
+
+// Unwrap allows errors.Is(err, ErrDocumentTooLarge).
+func (e DocumentTooLargeError) Unwrap() error {
+	return ErrDocumentTooLarge
+}
+
+// DocumentSizeCheck checks, before they're sent, that the updates of MongoCollection.Update,
+// UpdateId and Upsert don't grow their document past Mongo's limit, which the server reports
+// with an obscure error. See SessionHandlerConfig.DocumentSizeCheck.
+type DocumentSizeCheck struct {
+	// MinGrowth is the growth, as estimated by EstimateUpdateGrowth, from which an update is
+	// checked: the document it updates is fetched to measure it. Defaults to 64KB, so small
+	// updates don't pay for the read.
+	MinGrowth int
+	// WarnBytes is the size above which the update is tagged with TagDocumentNearLimit and
+	// logged as mgohttp-document-near-limit, so documents are caught while they still fit.
+	// Defaults to 3/4 of MaxBytes.
+	WarnBytes int
+	// MaxBytes is the size above which the update is rejected with a DocumentTooLargeError.
+	// Defaults to MaxDocumentBytes.
+	MaxBytes int
+}
+
+func (c *DocumentSizeCheck) minGrowth() int {
+	if c.MinGrowth > 0 {
+		return c.MinGrowth
+	}
+	return 64 * 1024
+}
+
+func (c *DocumentSizeCheck) maxBytes() int {
+	if c.MaxBytes > 0 {
+		return c.MaxBytes
+	}
+	return MaxDocumentBytes
+}
+
+func (c *DocumentSizeCheck) warnBytes() int {
+	if c.WarnBytes > 0 {
+		return c.WarnBytes
+	}
+	return c.maxBytes() / 4 * 3
+}
+
+// estimate returns the estimated size of the document once update is applied, measuring the
+// current document with current when the update grows it enough to matter. It's zero when
+// the update isn't worth checking.
+func (c *DocumentSizeCheck) estimate(update interface{}, current func() (int, error)) (int, error) {
+	if c == nil {
+		return 0, nil
+	}
+	if isReplacement(update) {
+		return EstimateDocumentSize(update)
+	}
+	growth, err := EstimateUpdateGrowth(update)
+	if err != nil || growth < c.minGrowth() {
+		return 0, err
+	}
+	size, err := current()
+	if err != nil {
+		return 0, err
+	}
+	return size + growth, nil
+}
+
+// EstimateDocumentSize returns the size of doc once encoded to BSON.
+func EstimateDocumentSize(doc interface{}) (int, error) {
+	raw, err := bson.Marshal(doc)
+	return len(raw), err
+}
+
+// EstimateUpdateGrowth returns an upper bound of the bytes update adds to the document it's
+// applied to: the size of the values it sets, pushes or adds, as if none of them replaced an
+// existing one. Operators that don't grow documents, such as $unset, $pull or $inc, count
+// for nothing. For a replacement document, it's its size.
+func EstimateUpdateGrowth(update interface{}) (int, error) {
+	if update == nil {
+		return 0, nil
+	}
+	if isReplacement(update) {
+		return EstimateDocumentSize(update)
+	}
+	m, err := toBsonM(update)
+	if err != nil {
+		return 0, err
+	}
+	growth := 0
+	for op, arg := range m {
+		switch op {
+		case "$set", "$setOnInsert", "$push", "$addToSet", "$max", "$min":
+		default:
+			continue
+		}
+		fields, err := toBsonM(arg)
+		if err != nil {
+			return 0, err
+		}
+		for field, value := range fields {
+			if each, ok := eachValues(op, value); ok {
+				value = each
+			}
+			// a value is encoded as a one element document: type, name and terminator
+			size, err := EstimateDocumentSize(bson.M{field: value})
+			if err != nil {
+				return 0, err
+			}
+			growth += size - 5
+		}
+	}
+	return growth, nil
+}
+
+// eachValues returns the values of the $each modifier of a $push or $addToSet.
+func eachValues(op string, value interface{}) (interface{}, bool) {
+	if op != "$push" && op != "$addToSet" {
+		return nil, false
+	}
+	m, err := toBsonM(value)
+	if err != nil {
+		return nil, false
+	}
+	each, ok := m["$each"]
+	return each, ok
+}
+
+// isReplacement reports whether update is a replacement document rather than operators.
+func isReplacement(update interface{}) bool {
+	m, err := toBsonM(update)
+	if err != nil {
+		return false
+	}
+	for k := range m {
+		return !strings.HasPrefix(k, "$")
+	}
+	return false
+}
+
+// toBsonM returns v as a bson.M, converting bson.D and structs.
+func toBsonM(v interface{}) (bson.M, error) {
+	switch val := v.(type) {
+	case bson.M:
+		return val, nil
+	case map[string]interface{}:
+		return bson.M(val), nil
+	case bson.D:
+		return val.Map(), nil
+	}
+	raw, err := bson.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	m := bson.M{}
+	return m, bson.Unmarshal(raw, m)
+}
+
+// checkSize runs the handler's DocumentSizeCheck on an update of the documents matching
+// selector.
+func (tc tracedMgoCollection) checkSize(sp opentracing.Span, selector, update interface{}) error {
+	return checkDocumentSize(tc.ctx, sp, tc.collectionName, update, func() (int, error) {
+		var raw bson.Raw
+		if err := tc.collection.Find(selector).One(&raw); err != nil {
+			return 0, err
+		}
+		return len(raw.Data), nil
+	})
+}
+
+// checkDocumentSize runs the handler's DocumentSizeCheck on an update of collection, with
+// current measuring the document it updates.
+func checkDocumentSize(ctx context.Context, sp opentracing.Span, collection string, update interface{}, current func() (int, error)) error {
+	h := handlerFromContext(ctx)
+	if h == nil || h.cfg.DocumentSizeCheck == nil {
+		return nil
+	}
+	check := h.cfg.DocumentSizeCheck
+	size, err := check.estimate(update, current)
+	if err != nil || size <= check.warnBytes() {
+		// the update is sent as is when it can't be measured, e.g. an upsert inserting
+		return nil
+	}
+	sp.SetTag(TagDocumentNearLimit, size)
+	if size > check.maxBytes() {
+		return DocumentTooLargeError{Collection: collection, EstimatedBytes: size, Limit: check.maxBytes()}
+	}
+	logger.FromContext(ctx).WarnD("mgohttp-document-near-limit", logger.M{
+		"collection":      collection,
+		"estimated-bytes": size,
+		"limit":           check.maxBytes(),
+	})
+	return nil
+}
@@ -0,0 +1,78 @@
+package mgohttp
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	opentracing "github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/mocktracer"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	bson "gopkg.in/mgo.v2/bson"
+)
+
+func TestEstimateUpdateGrowth(t *testing.T) {
+	blob := strings.Repeat("x", 1000)
+	for _, test := range []struct {
+		name   string
+		update interface{}
+		min    int
+		max    int
+	}{
+		{"nil", nil, 0, 0},
+		{"shrinking operators", bson.M{"$unset": bson.M{"a": ""}, "$inc": bson.M{"n": 1}, "$pull": bson.M{"tags": "x"}}, 0, 0},
+		{"$set", bson.M{"$set": bson.M{"bio": blob}}, 1000, 1020},
+		{"$push with $each", bson.D{{Name: "$push", Value: bson.M{"log": bson.M{"$each": []string{blob, blob}}}}}, 2000, 2040},
+		{"replacement", bson.M{"bio": blob}, 1000, 1020},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			growth, err := EstimateUpdateGrowth(test.update)
+			require.NoError(t, err)
+			assert.True(t, growth >= test.min && growth <= test.max, "growth %d not in [%d, %d]", growth, test.min, test.max)
+		})
+	}
+}
+
+func TestDocumentSizeCheckEstimate(t *testing.T) {
+	check := &DocumentSizeCheck{MinGrowth: 100}
+	fetched := false
+	current := func() (int, error) {
+		fetched = true
+		return 1000, nil
+	}
+
+	size, err := check.estimate(bson.M{"$set": bson.M{"a": 1}}, current)
+	require.NoError(t, err)
+	assert.Zero(t, size)
+	assert.False(t, fetched, "small updates shouldn't fetch the document")
+
+	size, err = check.estimate(bson.M{"$set": bson.M{"bio": strings.Repeat("x", 500)}}, current)
+	require.NoError(t, err)
+	assert.True(t, fetched)
+	assert.InDelta(t, 1500, size, 20)
+
+	assert.Equal(t, MaxDocumentBytes, check.maxBytes())
+	assert.Equal(t, MaxDocumentBytes/4*3, check.warnBytes())
+}
+
+func TestCheckSize(t *testing.T) {
+	tracer := mocktracer.New()
+	h := &SessionHandler{cfg: SessionHandlerConfig{DocumentSizeCheck: &DocumentSizeCheck{WarnBytes: 1000, MaxBytes: 2000}}}
+	tc := tracedMgoCollection{collectionName: "users", ctx: context.WithValue(context.Background(), handlerKey, h)}
+
+	// replacements are measured without reading the document
+	sp := tracer.StartSpan("update")
+	assert.NoError(t, tc.checkSize(sp, bson.M{"_id": 1}, bson.M{"bio": "short"}))
+	assert.NoError(t, tc.checkSize(sp, bson.M{"_id": 1}, bson.M{"bio": strings.Repeat("x", 1500)}))
+	sp.Finish()
+	assert.NotNil(t, tracer.FinishedSpans()[0].Tag(TagDocumentNearLimit))
+
+	err := tc.checkSize(opentracing.NoopTracer{}.StartSpan("update"), bson.M{"_id": 1}, bson.M{"bio": strings.Repeat("x", 2500)})
+	assert.True(t, errors.Is(err, ErrDocumentTooLarge), "got %v", err)
+	var tooLarge DocumentTooLargeError
+	require.True(t, errors.As(err, &tooLarge))
+	assert.Equal(t, "users", tooLarge.Collection)
+	assert.Equal(t, 2000, tooLarge.Limit)
+}
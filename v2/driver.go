@@ -0,0 +1,157 @@
+package mgohttp
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/Clever/mgohttp/v2/internal"
+	opentracing "github.com/opentracing/opentracing-go"
+	mgo "gopkg.in/mgo.v2"
+)
+
+// Driver opens the sessions of the databases a SessionHandler serves with another driver than
+// mgo, e.g. the official one with NewMongoDriver, see SessionHandlerConfig.Driver. The handler
+// keeps managing the requests' sessions: their timeout, root span and caller spans, and their
+// share of MaxConcurrentSessions.
+type Driver interface {
+	// NewSession opens the session of a request on database, the first time the request asks
+	// for it. ctx carries the request's root span and is done once the request times out or
+	// is done: the operations of the session can't outlive it. safe is the write concern of
+	// the database, see SessionHandlerConfig.Safe, nil for the driver's default.
+	NewSession(ctx context.Context, database string, safe *mgo.Safe) (DriverSession, error)
+}
+
+// DriverSession is the session of a request opened by a Driver.
+type DriverSession interface {
+	// Session returns the session handed out to a caller of FromContext. Its operations are
+	// traced under ctx, which carries the caller's span, and read according to pref, nil for
+	// the primary.
+	Session(ctx context.Context, pref *ReadPreference) MongoSession
+	// Close ends the session once the request is done.
+	Close()
+}
+
+// driverSession is the session of a request on a database with a Driver.
+type driverSession struct {
+	sess   DriverSession
+	cancel context.CancelFunc
+	// pref is the read preference of the session, which sticks like the mode of an mgo session
+	pref *ReadPreference
+}
+
+// getDriver is injected into the Context for the databases with a Driver, like get: repeated
+// calls by the same request share the same session.
+func (s *requestSession) getDriver(ctx context.Context, db handlerDatabase) MongoSession {
+	c := s.c
+	ctx = context.WithValue(ctx, handlerKey, c)
+	ctx = context.WithValue(ctx, rolloutKey, s.rollouts)
+	if s.r.Context().Err() == context.Canceled {
+		return failedSession{err: fmt.Errorf("mgohttp: creating session for %s: %w", db.name, ErrClientDisconnected)}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.waitCreating(db.name)
+	if err := s.errs[db.name]; err != nil {
+		return failedSession{err: err}
+	}
+	if ds := s.drivers[db.name]; ds != nil {
+		ctx = s.startCallerSpan(ctx)
+		return ds.session(s.opContext(ctx, db.name))
+	}
+
+	ctx = s.startLibSpan(ctx)
+	deadline := s.sessionDeadline()
+	life, cancel := context.WithDeadline(context.WithoutCancel(s.opContext(ctx, db.name)), deadline)
+	var sess DriverSession
+	err := s.acquire(ctx, db, deadline, func() (err error) {
+		sess, err = db.driver.NewSession(life, db.name, db.safe)
+		return err
+	})
+	if err == nil && s.closed {
+		// the request's sessions were closed while it was being created
+		sess.Close()
+		cancel()
+		c.releaseSession()
+		c.sessionTracker.done()
+		return failedSession{err: fmt.Errorf("mgohttp: creating session for %s: the request's sessions are closed", db.name)}
+	}
+	if err != nil {
+		cancel()
+		return failedSession{err: s.createFailed(ctx, db, err)}
+	}
+	ds := &driverSession{sess: sess, cancel: cancel, pref: s.readPreference()}
+	if s.drivers == nil {
+		s.drivers = map[string]*driverSession{}
+	}
+	s.drivers[db.name] = ds
+	s.opened()
+	ctx = s.startCallerSpan(ctx)
+	if db.safe != nil {
+		opentracing.SpanFromContext(ctx).SetTag(TagWriteConcern, safeName(db.safe))
+	}
+	return ds.session(s.opContext(ctx, db.name))
+}
+
+// readPreference is the read preference the request's driver sessions start with: the
+// handler's, in the mode of its ReadOnlyRoutes or ConsistencyOverride for the request, if
+// any. It's recorded on the root span.
+func (s *requestSession) readPreference() *ReadPreference {
+	c := s.c
+	var pref *ReadPreference
+	if c.cfg.ReadPreference != nil {
+		p := *c.cfg.ReadPreference
+		pref = &p
+		pref.tag(s.libSpan)
+	}
+	setMode := func(mode mgo.Mode) {
+		if pref == nil {
+			pref = &ReadPreference{}
+		}
+		pref.Mode = mode
+		s.libSpan.SetTag(TagReadMode, modeName(mode))
+	}
+	if c.cfg.ReadOnlyRoutes != nil && c.cfg.ReadOnlyRoutes.readOnly(s.r) {
+		setMode(c.cfg.ReadOnlyRoutes.Mode)
+		s.libSpan.SetTag(TagReadOnlyRoute, true)
+	}
+	if c.cfg.ConsistencyOverride != nil {
+		if value, mode, ok := c.cfg.ConsistencyOverride.mode(s.r); ok {
+			setMode(mode)
+			s.libSpan.SetTag(TagReadConsistency, value)
+		}
+	}
+	return pref
+}
+
+// session hands the session out to the caller of ctx, with the read preference or mode the
+// caller set with WithRequestReadPreference or WithMode, which stick to the session.
+func (ds *driverSession) session(ctx context.Context) MongoSession {
+	sp := opentracing.SpanFromContext(ctx)
+	if p := readPreferenceFromContext(ctx); p != nil {
+		ds.pref = p
+		p.tag(sp)
+	}
+	if mode, ok := ctx.Value(modeKey).(mgo.Mode); ok && (ds.pref == nil || ds.pref.Mode != mode) {
+		p := ReadPreference{Mode: mode}
+		if ds.pref != nil {
+			p.TagSets = ds.pref.TagSets
+		}
+		ds.pref = &p
+		sp.SetTag(TagReadMode, modeName(mode))
+	}
+	return ds.sess.Session(ctx, ds.pref)
+}
+
+// close closes the session and ends its context.
+func (ds *driverSession) close() {
+	ds.sess.Close()
+	ds.cancel()
+}
+
+// newDriverContext injects the getter of db, a database with a Driver, into ctx.
+func (s *requestSession) newDriverContext(ctx context.Context, db handlerDatabase) context.Context {
+	return internal.NewProviderContext(ctx, db.name, func(ctx context.Context) interface{} {
+		return s.getDriver(ctx, db)
+	})
+}
@@ -0,0 +1,118 @@
+package mgohttp
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/opentracing/opentracing-go/mocktracer"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	mgo "gopkg.in/mgo.v2"
+)
+
+// fakeDriver records the sessions it opens, whose MongoSessions are NopSessions.
+type fakeDriver struct {
+	err      error
+	opened   []string
+	safes    []*mgo.Safe
+	sessions []*fakeDriverSession
+}
+
+func (d *fakeDriver) NewSession(ctx context.Context, database string, safe *mgo.Safe) (DriverSession, error) {
+	if d.err != nil {
+		return nil, d.err
+	}
+	d.opened = append(d.opened, database)
+	d.safes = append(d.safes, safe)
+	s := &fakeDriverSession{life: ctx}
+	d.sessions = append(d.sessions, s)
+	return s, nil
+}
+
+type fakeDriverSession struct {
+	life   context.Context
+	prefs  []*ReadPreference
+	closed bool
+}
+
+func (s *fakeDriverSession) Session(ctx context.Context, pref *ReadPreference) MongoSession {
+	s.prefs = append(s.prefs, pref)
+	return NopSession()
+}
+
+func (s *fakeDriverSession) Close() { s.closed = true }
+
+func TestDriver(t *testing.T) {
+	driver := &fakeDriver{}
+	safe := &mgo.Safe{WMode: "majority"}
+	var alive bool
+	handler := NewSessionHandler(SessionHandlerConfig{
+		Database: testDBName,
+		Timeout:  handlerTimeout,
+		Driver:   driver,
+		Safe:     safe,
+		Databases: []DatabaseConfig{
+			{Database: "other"},
+			{Database: "legacy", NewSession: func(ctx context.Context) (*mgo.Session, error) { return &mgo.Session{}, nil }},
+		},
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			FromContext(r.Context(), testDBName)
+			ctx := WithRequestReadPreference(r.Context(), ReadPreference{Mode: mgo.SecondaryPreferred})
+			FromContext(ctx, testDBName)
+			// the read preference sticks to the session
+			FromContext(r.Context(), testDBName)
+			FromContext(r.Context(), "other")
+			_, isMgo := FromContext(r.Context(), "legacy").(tracedMgoSession)
+			assert.True(t, isMgo)
+			alive = driver.sessions[0].life.Err() == nil
+		}),
+	})
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+
+	// one session per database and request, closed once it's done
+	assert.Equal(t, []string{testDBName, "other"}, driver.opened)
+	assert.Equal(t, []*mgo.Safe{safe, safe}, driver.safes)
+	assert.True(t, alive)
+	for _, s := range driver.sessions {
+		assert.True(t, s.closed)
+		assert.Error(t, s.life.Err())
+	}
+	secondary := &ReadPreference{Mode: mgo.SecondaryPreferred}
+	assert.Equal(t, []*ReadPreference{nil, secondary, secondary}, driver.sessions[0].prefs)
+}
+
+func TestDriverReadOnlyRoutes(t *testing.T) {
+	driver := &fakeDriver{}
+	handler := NewSessionHandler(SessionHandlerConfig{
+		Database:       testDBName,
+		Timeout:        handlerTimeout,
+		Driver:         driver,
+		ReadOnlyRoutes: &ReadOnlyRoutes{Mode: mgo.Secondary},
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			FromContext(r.Context(), testDBName)
+		}),
+	})
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	require.Len(t, driver.sessions, 1)
+	assert.Equal(t, []*ReadPreference{{Mode: mgo.Secondary}}, driver.sessions[0].prefs)
+}
+
+func TestDriverNewSessionError(t *testing.T) {
+	errNoCredentials := errors.New("no credentials for tenant")
+	tracer := mocktracer.New()
+	var opErr error
+	handler := NewSessionHandler(SessionHandlerConfig{
+		Database: testDBName,
+		Timeout:  handlerTimeout,
+		Tracer:   tracer,
+		Driver:   &fakeDriver{err: errNoCredentials},
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			opErr = FromContext(r.Context(), testDBName).Ping()
+		}),
+	})
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	assert.True(t, errors.Is(opErr, errNoCredentials))
+}
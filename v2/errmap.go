@@ -0,0 +1,65 @@
+package mgohttp
+
+import (
+	"errors"
+	"net/http"
+)
+
+// ErrRequestTimeout is passed to the ErrorMapper when a request hits the SessionHandler's
+// timeout.
+var ErrRequestTimeout = errors.New("mgohttp: request timed out")
+
+// ErrorMapper maps an error to the status and body of the response. It's used when the
+// SessionHandler has to answer a request itself, and by WriteError.
+type ErrorMapper func(err error) (status int, body []byte)
+
+// DefaultErrorMapper maps duplicate keys to 409, missing documents to 404, rejected selectors
+// and invalid page tokens to 400, documents outgrowing the size limit to 413, timeouts,
+// disabled collections, throttling and shutdowns to 503 and anything else to 500. The body is
+// the status text.
+func DefaultErrorMapper(err error) (int, []byte) {
+	status := http.StatusInternalServerError
+	switch {
+	case IsNotFound(err):
+		status = http.StatusNotFound
+	case IsDuplicateKey(err):
+		status = http.StatusConflict
+	case errors.Is(err, ErrSelectorTooComplex), errors.Is(err, ErrInvalidPageToken):
+		status = http.StatusBadRequest
+	case errors.Is(err, ErrDocumentTooLarge):
+		status = http.StatusRequestEntityTooLarge
+	case IsTimeout(err),
+		errors.Is(err, ErrCollectionDisabled),
+		errors.Is(err, ErrTooManySessions),
+		errors.Is(err, ErrOpLimited),
+		errors.Is(err, ErrShuttingDown):
+		status = http.StatusServiceUnavailable
+	}
+	return status, []byte(http.StatusText(status))
+}
+
+// WriteError answers the request with the status and body the ErrorMapper of the request's
+// SessionHandler maps err to, or DefaultErrorMapper's, so handlers answer their own Mongo
+// errors consistently.
+func WriteError(w http.ResponseWriter, r *http.Request, err error) {
+	mapper := DefaultErrorMapper
+	if h := handlerFromContext(r.Context()); h != nil && h.cfg.ErrorMapper != nil {
+		mapper = h.cfg.ErrorMapper
+	}
+	writeMappedError(w, mapper, err)
+}
+
+func writeMappedError(w http.ResponseWriter, mapper ErrorMapper, err error) {
+	status, body := mapper(err)
+	w.WriteHeader(status)
+	w.Write(body)
+}
+
+// writeError answers a request the handler failed itself, with the ErrorMapper if set.
+func (c *SessionHandler) writeError(w http.ResponseWriter, err error) {
+	if c.cfg.ErrorMapper == nil {
+		w.WriteHeader(c.errorCode)
+		return
+	}
+	writeMappedError(w, c.cfg.ErrorMapper, err)
+}
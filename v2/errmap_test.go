@@ -0,0 +1,70 @@
+package mgohttp
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	mgo "gopkg.in/mgo.v2"
+)
+
+func TestDefaultErrorMapper(t *testing.T) {
+	for _, tc := range []struct {
+		err    error
+		status int
+	}{
+		{OpError{Op: "find", Collection: "users", Err: mgo.ErrNotFound}, http.StatusNotFound},
+		{OpError{Op: "insert", Collection: "users", Err: &mgo.LastError{Code: 11000}}, http.StatusConflict},
+		{SelectorTooComplexError{Collection: "users", Reason: "too deep"}, http.StatusBadRequest},
+		{DocumentTooLargeError{Collection: "users", EstimatedBytes: 17 << 20, Limit: 16 << 20}, http.StatusRequestEntityTooLarge},
+		{ErrRequestTimeout, http.StatusServiceUnavailable},
+		{CollectionDisabledError{Database: "app", Collection: "users"}, http.StatusServiceUnavailable},
+		{context.DeadlineExceeded, http.StatusServiceUnavailable},
+		{errors.New("boom"), http.StatusInternalServerError},
+	} {
+		status, body := DefaultErrorMapper(tc.err)
+		assert.Equal(t, tc.status, status, tc.err.Error())
+		assert.Equal(t, http.StatusText(tc.status), string(body))
+	}
+}
+
+func TestErrorMapper(t *testing.T) {
+	mapper := func(err error) (int, []byte) {
+		if errors.Is(err, ErrRequestTimeout) {
+			return http.StatusGatewayTimeout, []byte(`{"error":"timeout"}`)
+		}
+		return http.StatusBadGateway, []byte(err.Error())
+	}
+	release := make(chan struct{})
+	defer close(release)
+	slow := NewSessionHandler(SessionHandlerConfig{
+		Database:    testDBName,
+		Timeout:     handlerTimeout,
+		ErrorMapper: mapper,
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			<-release
+		}),
+	})
+	rec := httptest.NewRecorder()
+	slow.ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+	assert.Equal(t, http.StatusGatewayTimeout, rec.Code)
+	assert.Equal(t, `{"error":"timeout"}`, rec.Body.String())
+
+	// handlers answer their own errors with the handler's mapper
+	failing := NewSessionHandler(SessionHandlerConfig{
+		Database:    testDBName,
+		Timeout:     time.Second,
+		ErrorMapper: mapper,
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			WriteError(w, r, errors.New("boom"))
+		}),
+	})
+	rec = httptest.NewRecorder()
+	failing.ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+	assert.Equal(t, http.StatusBadGateway, rec.Code)
+	assert.Equal(t, "boom", rec.Body.String())
+}
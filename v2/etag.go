@@ -0,0 +1,202 @@
+package mgohttp
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"hash"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+
+	bson "gopkg.in/mgo.v2/bson"
+)
+
+// resultDigest accumulates the digests of the results read by a request, for the weak ETag
+// of its response, see SessionHandlerConfig.ETagRoutes. The reads are digested separately
+// and sorted, so concurrent queries give the same ETag whatever the order they finish in.
+type resultDigest struct {
+	mu    sync.Mutex
+	reads [][sha256.Size]byte
+	// invalid is set once the request ran an operation whose result isn't digested, e.g. a
+	// write or a command, so its response can't be told apart by the digest
+	invalid bool
+	// openIters counts the iterators not closed yet, whose documents aren't all digested
+	openIters int
+}
+
+type resultDigestKeyType struct{}
+
+var resultDigestKey = resultDigestKeyType{}
+
+func digestFromContext(ctx context.Context) *resultDigest {
+	d, _ := ctx.Value(resultDigestKey).(*resultDigest)
+	return d
+}
+
+// digestedReads are the access methods of find whose results are digested.
+var digestedReads = map[string]bool{"One": true, "All": true, "Count": true, "Iter": true}
+
+// check invalidates the digest for the operations whose results aren't digested.
+func (d *resultDigest) check(op OpInfo) {
+	if d == nil || op.Op == "ping" || (op.Op == "find" && digestedReads[op.Method]) {
+		return
+	}
+	d.invalidate()
+}
+
+func (d *resultDigest) invalidate() {
+	d.mu.Lock()
+	d.invalid = true
+	d.mu.Unlock()
+}
+
+// add digests a read of collection: the documents read into result, or the count.
+func (d *resultDigest) add(collection, method string, result interface{}, err error) {
+	if d == nil {
+		return
+	}
+	h := newReadHash(collection, method)
+	if !writeResult(h, result, err) {
+		d.invalidate()
+		return
+	}
+	d.addSum(h)
+}
+
+func (d *resultDigest) addSum(h hash.Hash) {
+	var sum [sha256.Size]byte
+	h.Sum(sum[:0])
+	d.mu.Lock()
+	d.reads = append(d.reads, sum)
+	d.mu.Unlock()
+}
+
+func newReadHash(collection, method string) hash.Hash {
+	h := sha256.New()
+	h.Write([]byte(collection + "\x00" + method + "\x00"))
+	return h
+}
+
+// writeResult writes the result of a read to h. It reports false when the result can't be
+// digested: the read failed, other than finding no document, or result can't be marshaled.
+func writeResult(h hash.Hash, result interface{}, err error) bool {
+	switch {
+	case IsNotFound(err):
+		h.Write([]byte("not-found"))
+		return true
+	case err != nil:
+		// the response is an error anyway
+		return false
+	}
+	data, err := bson.Marshal(bson.M{"r": result})
+	if err != nil {
+		return false
+	}
+	h.Write(data)
+	return true
+}
+
+// iterDigest digests the documents of an iterator in order, as one read added to the
+// request's digest when the iterator is closed.
+type iterDigest struct {
+	d      *resultDigest
+	h      hash.Hash
+	closed bool
+}
+
+// iter starts the digest of an iterator of collection. The request gets no ETag until it's
+// closed.
+func (d *resultDigest) iter(collection string) *iterDigest {
+	if d == nil {
+		return nil
+	}
+	d.mu.Lock()
+	d.openIters++
+	d.mu.Unlock()
+	return &iterDigest{d: d, h: newReadHash(collection, "Iter")}
+}
+
+// next digests the documents read into result.
+func (i *iterDigest) next(result interface{}) {
+	if i != nil && !writeResult(i.h, result, nil) {
+		i.d.invalidate()
+	}
+}
+
+// close adds the iterator's digest to the request's, unless it failed with err.
+func (i *iterDigest) close(err error) {
+	if i == nil {
+		return
+	}
+	i.d.mu.Lock()
+	if i.closed {
+		i.d.mu.Unlock()
+		return
+	}
+	i.closed = true
+	i.d.openIters--
+	i.d.mu.Unlock()
+	if err != nil {
+		i.d.invalidate()
+		return
+	}
+	i.d.addSum(i.h)
+}
+
+// etag returns the weak ETag of the reads, or "" when the request read nothing or ran an
+// operation that isn't digested.
+func (d *resultDigest) etag() string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.invalid || d.openIters > 0 || len(d.reads) == 0 {
+		return ""
+	}
+	sort.Slice(d.reads, func(i, j int) bool { return bytes.Compare(d.reads[i][:], d.reads[j][:]) < 0 })
+	h := sha256.New()
+	for _, sum := range d.reads {
+		h.Write(sum[:])
+	}
+	return `W/"` + hex.EncodeToString(h.Sum(nil)[:16]) + `"`
+}
+
+// etagMatches reports whether the If-None-Match header matches etag, with the weak comparison.
+func etagMatches(ifNoneMatch, etag string) bool {
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == strings.TrimPrefix(etag, "W/") {
+			return true
+		}
+	}
+	return false
+}
+
+// digestsResults reports whether the response to r gets the ETag of its reads.
+func (c *SessionHandler) digestsResults(r *http.Request) bool {
+	return c.cfg.ETagRoutes != nil && !c.cfg.StreamResponses &&
+		(r.Method == http.MethodGet || r.Method == http.MethodHead) && c.cfg.ETagRoutes(r)
+}
+
+// applyETag sets the ETag of the buffered response, unless the handler set its own, and turns
+// it into a 304 when the request's If-None-Match matches. Only successful responses that
+// weren't streamed get one.
+func (tw *timeoutWriter) applyETag(r *http.Request, etag string) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	if etag == "" || tw.streaming || tw.hijacked || (tw.wroteHeader && tw.code != http.StatusOK) ||
+		tw.h.Get("ETag") != "" {
+		return
+	}
+	tw.h.Set("ETag", etag)
+	if !etagMatches(r.Header.Get("If-None-Match"), etag) {
+		return
+	}
+	tw.wroteHeader = true
+	tw.code = http.StatusNotModified
+	tw.wbuf = bytes.Buffer{}
+	for _, h := range []string{"Content-Length", "Content-Type"} {
+		tw.h.Del(h)
+	}
+}
@@ -0,0 +1,113 @@
+package mgohttp
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	mgo "gopkg.in/mgo.v2"
+	bson "gopkg.in/mgo.v2/bson"
+)
+
+func TestResultDigest(t *testing.T) {
+	d1, d2 := &resultDigest{}, &resultDigest{}
+	d1.add("users", "One", &bson.M{"a": 1}, nil)
+	d1.add("orgs", "Count", 3, nil)
+	// concurrent reads may finish in any order
+	d2.add("orgs", "Count", 3, nil)
+	d2.add("users", "One", &bson.M{"a": 1}, nil)
+	assert.NotEmpty(t, d1.etag())
+	assert.Equal(t, d1.etag(), d2.etag())
+
+	d3 := &resultDigest{}
+	d3.add("users", "One", &bson.M{"a": 2}, nil)
+	d3.add("orgs", "Count", 3, nil)
+	assert.NotEqual(t, d1.etag(), d3.etag())
+
+	notFound := &resultDigest{}
+	notFound.add("users", "One", &bson.M{}, mgo.ErrNotFound)
+	assert.NotEmpty(t, notFound.etag())
+
+	assert.Empty(t, (&resultDigest{}).etag(), "nothing was read")
+
+	failed := &resultDigest{}
+	failed.add("users", "One", &bson.M{}, errors.New("boom"))
+	assert.Empty(t, failed.etag())
+
+	written := &resultDigest{}
+	written.add("users", "One", &bson.M{"a": 1}, nil)
+	written.check(OpInfo{Op: "find", Method: "One"})
+	assert.NotEmpty(t, written.etag())
+	written.check(OpInfo{Op: "update"})
+	assert.Empty(t, written.etag())
+}
+
+func TestResultDigestIterOrder(t *testing.T) {
+	iterate := func(docs ...bson.M) string {
+		d := &resultDigest{}
+		it := d.iter("users")
+		for _, doc := range docs {
+			it.next(&doc)
+		}
+		assert.Empty(t, d.etag(), "the iterator isn't closed")
+		it.close(nil)
+		it.close(nil)
+		return d.etag()
+	}
+	assert.NotEmpty(t, iterate(bson.M{"a": 1}, bson.M{"a": 2}))
+	assert.Equal(t, iterate(bson.M{"a": 1}, bson.M{"a": 2}), iterate(bson.M{"a": 1}, bson.M{"a": 2}))
+	assert.NotEqual(t, iterate(bson.M{"a": 1}, bson.M{"a": 2}), iterate(bson.M{"a": 2}, bson.M{"a": 1}))
+}
+
+func TestETagMatches(t *testing.T) {
+	assert.True(t, etagMatches(`W/"abc"`, `W/"abc"`))
+	assert.True(t, etagMatches(`"xyz", "abc"`, `W/"abc"`))
+	assert.True(t, etagMatches(`*`, `W/"abc"`))
+	assert.False(t, etagMatches(`W/"xyz"`, `W/"abc"`))
+	assert.False(t, etagMatches(``, `W/"abc"`))
+}
+
+func TestETagRoutes(t *testing.T) {
+	status := http.StatusOK
+	handler := newLeakTestHandler(func(w http.ResponseWriter, r *http.Request) {
+		// stands in for a query
+		digestFromContext(r.Context()).add("users", "One", &bson.M{"name": "a"}, nil)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		w.Write([]byte(`{"name":"a"}`))
+	})
+	handler.cfg.ETagRoutes = PathPrefix("/users")
+
+	serve := func(method, path, ifNoneMatch string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, path, nil)
+		if ifNoneMatch != "" {
+			r.Header.Set("If-None-Match", ifNoneMatch)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w
+	}
+
+	first := serve("GET", "/users/1", "")
+	assert.Equal(t, http.StatusOK, first.Code)
+	etag := first.Header().Get("ETag")
+	require.NotEmpty(t, etag)
+
+	again := serve("GET", "/users/1", etag)
+	assert.Equal(t, http.StatusNotModified, again.Code)
+	assert.Empty(t, again.Body.String())
+	assert.Equal(t, etag, again.Header().Get("ETag"))
+	assert.Empty(t, again.Header().Get("Content-Type"))
+
+	assert.Equal(t, http.StatusOK, serve("GET", "/users/1", `W/"stale"`).Code)
+	assert.Empty(t, serve("POST", "/users/1", "").Header().Get("ETag"))
+	assert.Empty(t, serve("GET", "/orgs/1", "").Header().Get("ETag"))
+
+	status = http.StatusAccepted
+	accepted := serve("GET", "/users/1", etag)
+	assert.Equal(t, http.StatusAccepted, accepted.Code)
+	assert.Empty(t, accepted.Header().Get("ETag"))
+}
@@ -0,0 +1,136 @@
+package mgohttp
+
+import (
+	"strings"
+
+	"gopkg.in/Clever/kayvee-go.v6/logger"
+	bson "gopkg.in/mgo.v2/bson"
+)
+
+func (q tracedMongoQuery) Explain(result interface{}) (err error) {
+	recordUsage("MongoQuery.Explain")
+	q, release, err := q.routed()
+	if err != nil {
+		defer q.op.Finish()
+		return logAndReturnErr(q.op, err)
+	}
+	defer release()
+	sp := q.op
+	defer sp.Finish()
+	defer sp.recoverPanic(&err)
+	// no point explaining a slow explain
+	sp.spec = nil
+
+	sp.SetTag(TagAccessMethod, "Explain")
+	return sp.done(q.intercept("Explain", nil, func(q tracedMongoQuery, _ *OpInfo) error {
+		if emulated, err := q.emulated(); emulated {
+			if err == nil {
+				err = q.spec.explain(result)
+			}
+			return err
+		}
+		return q.q.Explain(result)
+	}))
+}
+
+// explain runs the explain command for the find command equivalent to the query. The read
+// concern is left out, explain doesn't accept one.
+func (s querySpec) explain(result interface{}) error {
+	s.readConcern = ""
+	cmd := bson.D{{Name: "explain", Value: s.findCommand(s.limit, false)}}
+	return s.runCommand(cmd, result)
+}
+
+// planSummary is the gist of an explain result.
+type planSummary struct {
+	// plan lists the scans of the winning plan, e.g. "IXSCAN org_1_created_-1".
+	plan         string
+	docsExamined int
+	keysExamined int
+	returned     int
+}
+
+// summarizePlan extracts the plan summary from an explain result, in the format of MongoDB
+// 3.0 and later or in the legacy format.
+func summarizePlan(doc bson.M) planSummary {
+	if cursor, ok := doc["cursor"].(string); ok {
+		return planSummary{
+			plan:         cursor,
+			docsExamined: toInt(doc["nscannedObjects"]),
+			keysExamined: toInt(doc["nscanned"]),
+			returned:     toInt(doc["n"]),
+		}
+	}
+
+	s := planSummary{}
+	if planner, ok := doc["queryPlanner"].(bson.M); ok {
+		if winning, ok := planner["winningPlan"].(bson.M); ok {
+			s.plan = strings.Join(planScans(winning), ",")
+		}
+	}
+	if stats, ok := doc["executionStats"].(bson.M); ok {
+		s.docsExamined = toInt(stats["totalDocsExamined"])
+		s.keysExamined = toInt(stats["totalKeysExamined"])
+		s.returned = toInt(stats["nReturned"])
+	}
+	return s
+}
+
+// planScans lists the collection and index scans of a plan stage and its inputs.
+func planScans(stage bson.M) []string {
+	scans := []string{}
+	switch stage["stage"] {
+	case "COLLSCAN":
+		scans = append(scans, "COLLSCAN")
+	case "IXSCAN":
+		name, _ := stage["indexName"].(string)
+		scans = append(scans, "IXSCAN "+name)
+	}
+	if input, ok := stage["inputStage"].(bson.M); ok {
+		scans = append(scans, planScans(input)...)
+	}
+	if inputs, ok := stage["inputStages"].([]interface{}); ok {
+		for _, input := range inputs {
+			if input, ok := input.(bson.M); ok {
+				scans = append(scans, planScans(input)...)
+			}
+		}
+	}
+	return scans
+}
+
+func toInt(v interface{}) int {
+	switch n := v.(type) {
+	case int:
+		return n
+	case int64:
+		return int(n)
+	case float64:
+		return int(n)
+	}
+	return 0
+}
+
+// explainSlow runs explain for the query of a slow operation, or of any operation of a request
+// with verbose diagnostics, and tags the span with the plan summary.
+func (o *opSpan) explainSlow() {
+	var doc bson.M
+	var err error
+	if o.spec.collation != nil {
+		err = o.spec.explain(&doc)
+	} else {
+		err = o.spec.query().Explain(&doc)
+	}
+	if err != nil {
+		logger.FromContext(o.ctx).WarnD("mgohttp-explain-failed", logger.M{
+			"collection": o.collection,
+			"error":      err.Error(),
+		})
+		return
+	}
+	s := summarizePlan(doc)
+	o.SetTag(TagExplainPlan, s.plan)
+	o.SetTag(TagExplainDocsExamined, s.docsExamined)
+	o.SetTag(TagExplainKeysExamined, s.keysExamined)
+	o.SetTag(TagExplainReturned, s.returned)
+}
@@ -0,0 +1,42 @@
+package mgohttp
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	bson "gopkg.in/mgo.v2/bson"
+)
+
+func TestSummarizePlan(t *testing.T) {
+	assert.Equal(t, planSummary{
+		plan:         "IXSCAN org_1,IXSCAN email_1",
+		docsExamined: 120,
+		keysExamined: 130,
+		returned:     20,
+	}, summarizePlan(bson.M{
+		"queryPlanner": bson.M{
+			"winningPlan": bson.M{
+				"stage": "FETCH",
+				"inputStage": bson.M{
+					"stage": "OR",
+					"inputStages": []interface{}{
+						bson.M{"stage": "IXSCAN", "indexName": "org_1"},
+						bson.M{"stage": "IXSCAN", "indexName": "email_1"},
+					},
+				},
+			},
+		},
+		"executionStats": bson.M{
+			"totalDocsExamined": 120,
+			"totalKeysExamined": int64(130),
+			"nReturned":         20.0,
+		},
+	}))
+
+	assert.Equal(t, planSummary{plan: "COLLSCAN"}, summarizePlan(bson.M{
+		"queryPlanner": bson.M{"winningPlan": bson.M{"stage": "COLLSCAN"}},
+	}))
+
+	assert.Equal(t, planSummary{plan: "BasicCursor", docsExamined: 500, keysExamined: 500, returned: 3},
+		summarizePlan(bson.M{"cursor": "BasicCursor", "nscannedObjects": 500, "nscanned": 500, "n": 3}))
+}
@@ -0,0 +1,130 @@
+package mgohttp
+
+import (
+	"context"
+	"time"
+
+	bson "gopkg.in/mgo.v2/bson"
+)
+
+// ExportSink receives the documents of an export, one batch at a time in _id order.
+type ExportSink func(docs []bson.Raw) error
+
+// ExportOptions configures Export.
+type ExportOptions struct {
+	// BatchSize is the number of documents fetched, and handed to the sink, at once. Defaults
+	// to 1000.
+	BatchSize int
+	// ResumeAfter is the _id of the last document of a previous, interrupted export, as
+	// passed to Checkpoint. The export starts from the beginning when it's nil.
+	ResumeAfter interface{}
+	// Checkpoint, when set, is called with the _id of the last document of every batch the
+	// sink accepted. Persist it to resume the export with ResumeAfter. An error stops the
+	// export.
+	Checkpoint func(lastID interface{}) error
+	// MaxDocsPerSecond, when set, paces the export to at most this many documents per
+	// second, so a backfill doesn't compete with the live traffic.
+	MaxDocsPerSecond float64
+	// Progress, when set, is called after every batch.
+	Progress func(ExportProgress)
+}
+
+// ExportProgress describes how far an export got.
+type ExportProgress struct {
+	Docs    int64
+	Batches int64
+	// LastID is the _id of the last exported document.
+	LastID  interface{}
+	Elapsed time.Duration
+}
+
+// DocsPerSecond is the average export rate so far.
+func (p ExportProgress) DocsPerSecond() float64 {
+	if p.Elapsed <= 0 {
+		return 0
+	}
+	return float64(p.Docs) / p.Elapsed.Seconds()
+}
+
+// Export hands every document of collection matching query to sink, in batches sorted by
+// _id. Each batch is a separate, short query resuming after the last _id of the previous one,
+// so exports can run for hours without holding a cursor open, and be resumed from a
+// checkpoint after a failure. It returns when every document was exported, the sink or
+// checkpoint fails, or ctx is done.
+func Export(ctx context.Context, collection MongoCollection, query bson.M, sink ExportSink, opts ExportOptions) (ExportProgress, error) {
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = 1000
+	}
+	start := time.Now()
+	progress := ExportProgress{LastID: opts.ResumeAfter}
+	for {
+		if err := ctx.Err(); err != nil {
+			return progress, err
+		}
+
+		docs := []bson.Raw{}
+		err := collection.Find(exportFilter(query, progress.LastID)).
+			Sort("_id").
+			Limit(opts.BatchSize).
+			All(&docs)
+		if err != nil {
+			return progress, err
+		}
+		if len(docs) == 0 {
+			return progress, nil
+		}
+		if err := sink(docs); err != nil {
+			return progress, err
+		}
+
+		var last struct {
+			ID interface{} `bson:"_id"`
+		}
+		if err := docs[len(docs)-1].Unmarshal(&last); err != nil {
+			return progress, err
+		}
+		progress.LastID = last.ID
+		progress.Docs += int64(len(docs))
+		progress.Batches++
+		progress.Elapsed = time.Since(start)
+		if opts.Checkpoint != nil {
+			if err := opts.Checkpoint(last.ID); err != nil {
+				return progress, err
+			}
+		}
+		if opts.Progress != nil {
+			opts.Progress(progress)
+		}
+		if len(docs) < opts.BatchSize {
+			return progress, nil
+		}
+
+		if opts.MaxDocsPerSecond > 0 {
+			ahead := time.Duration(float64(progress.Docs)/opts.MaxDocsPerSecond*float64(time.Second)) - time.Since(start)
+			if ahead > 0 {
+				timer := time.NewTimer(ahead)
+				select {
+				case <-timer.C:
+				case <-ctx.Done():
+					timer.Stop()
+					return progress, ctx.Err()
+				}
+			}
+		}
+	}
+}
+
+// exportFilter restricts query to the documents after lastID.
+func exportFilter(query bson.M, lastID interface{}) bson.M {
+	if lastID == nil {
+		if query == nil {
+			return bson.M{}
+		}
+		return query
+	}
+	after := bson.M{"_id": bson.M{"$gt": lastID}}
+	if len(query) == 0 {
+		return after
+	}
+	return bson.M{"$and": []bson.M{query, after}}
+}
@@ -0,0 +1,101 @@
+package mgohttp
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	bson "gopkg.in/mgo.v2/bson"
+)
+
+// exportCollection serves Find queries on _id ranges from memory.
+type exportCollection struct {
+	MongoCollection
+	ids []int
+}
+
+type exportQuery struct {
+	MongoQuery
+	c     *exportCollection
+	after interface{}
+	limit int
+}
+
+func (c *exportCollection) Find(selector interface{}) MongoQuery {
+	q := &exportQuery{c: c}
+	if and, ok := selector.(bson.M)["$and"]; ok {
+		selector = and.([]bson.M)[1]
+	}
+	if id, ok := selector.(bson.M)["_id"]; ok {
+		q.after = id.(bson.M)["$gt"]
+	}
+	return q
+}
+
+func (q *exportQuery) Sort(fields ...string) MongoQuery { return q }
+func (q *exportQuery) Limit(n int) MongoQuery           { q.limit = n; return q }
+func (q *exportQuery) All(result interface{}) error {
+	docs := []bson.Raw{}
+	for _, id := range q.c.ids {
+		if q.after != nil && id <= q.after.(int) {
+			continue
+		}
+		if len(docs) == q.limit {
+			break
+		}
+		data, _ := bson.Marshal(bson.M{"_id": id})
+		docs = append(docs, bson.Raw{Kind: 3, Data: data})
+	}
+	reflect.ValueOf(result).Elem().Set(reflect.ValueOf(docs))
+	return nil
+}
+
+func TestExportCheckpointsAndResumes(t *testing.T) {
+	c := &exportCollection{ids: []int{1, 2, 3, 4, 5}}
+	sinkErr := errors.New("sink full")
+	exported := 0
+	checkpoints := []interface{}{}
+	sink := func(docs []bson.Raw) error {
+		if exported >= 4 {
+			return sinkErr
+		}
+		exported += len(docs)
+		return nil
+	}
+	opts := ExportOptions{
+		BatchSize: 2,
+		Checkpoint: func(lastID interface{}) error {
+			checkpoints = append(checkpoints, lastID)
+			return nil
+		},
+	}
+
+	progress, err := Export(context.Background(), c, bson.M{"kind": "a"}, sink, opts)
+	assert.Equal(t, sinkErr, err)
+	assert.Equal(t, []interface{}{2, 4}, checkpoints)
+	assert.Equal(t, int64(4), progress.Docs)
+
+	exported = 0
+	opts.ResumeAfter = checkpoints[len(checkpoints)-1]
+	progress, err = Export(context.Background(), c, nil, sink, opts)
+	require.NoError(t, err)
+	assert.Equal(t, 1, exported)
+	assert.Equal(t, int64(1), progress.Batches)
+	assert.Equal(t, 5, progress.LastID)
+}
+
+func TestExportStopsWhenContextDone(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := Export(ctx, &exportCollection{ids: []int{1}}, nil, func([]bson.Raw) error { return nil }, ExportOptions{})
+	assert.Equal(t, context.Canceled, err)
+}
+
+func TestExportFilter(t *testing.T) {
+	assert.Equal(t, bson.M{}, exportFilter(nil, nil))
+	assert.Equal(t, bson.M{"_id": bson.M{"$gt": 3}}, exportFilter(nil, 3))
+	assert.Equal(t, bson.M{"$and": []bson.M{{"a": 1}, {"_id": bson.M{"$gt": 3}}}}, exportFilter(bson.M{"a": 1}, 3))
+}
@@ -0,0 +1,227 @@
+package mgohttp
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	bson "gopkg.in/mgo.v2/bson"
+)
+
+// ExtJSONMode is the flavor of MongoDB Extended JSON written by MarshalExtJSON.
+type ExtJSONMode int
+
+const (
+	// ExtJSONRelaxed writes numbers as plain JSON numbers and dates as ISO-8601 strings, so
+	// responses read naturally, at the cost of the exact BSON types.
+	ExtJSONRelaxed ExtJSONMode = iota
+	// ExtJSONCanonical keeps every BSON type, e.g. {"$numberLong": "1"}, so the JSON can be
+	// turned back into the same document.
+	ExtJSONCanonical
+)
+
+// MarshalExtJSON returns v as MongoDB Extended JSON (v2), in place of the custom MarshalJSON
+// methods documents with ObjectIds, dates or decimals otherwise need. v is anything the
+// wrappers return: a document (bson.M, bson.D, bson.Raw or a struct with bson tags), or a
+// slice of them as filled by All. Fields keep the order of their BSON encoding.
+func MarshalExtJSON(v interface{}, mode ExtJSONMode) ([]byte, error) {
+	// encode and decode v through BSON, so bson tags, Getters and bson.Raw are honored and
+	// every value is one of the types the bson package decodes to
+	raw, err := bson.Marshal(bson.D{{Name: "v", Value: v}})
+	if err != nil {
+		return nil, err
+	}
+	var doc bson.D
+	if err := bson.Unmarshal(raw, &doc); err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if err := writeExtJSON(&buf, doc[0].Value, mode); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// ExtJSON is a value marshaled to JSON by MarshalExtJSON, to embed documents in a response
+// encoded with encoding/json:
+//
+//	json.NewEncoder(w).Encode(map[string]interface{}{
+//		"user": mgohttp.ExtJSON{Value: user},
+//	})
+type ExtJSON struct {
+	Value interface{}
+	Mode  ExtJSONMode
+}
+
+// MarshalJSON implements json.Marshaler.
+func (e ExtJSON) MarshalJSON() ([]byte, error) {
+	return MarshalExtJSON(e.Value, e.Mode)
+}
+
+// writeExtJSON writes v, as decoded by the bson package, to buf.
+func writeExtJSON(buf *bytes.Buffer, v interface{}, mode ExtJSONMode) error {
+	canonical := mode == ExtJSONCanonical
+	switch val := v.(type) {
+	case nil:
+		buf.WriteString("null")
+	case bool, string:
+		return writeJSON(buf, val)
+	case int:
+		if canonical {
+			return writeWrapped(buf, "$numberInt", strconv.Itoa(val))
+		}
+		buf.WriteString(strconv.Itoa(val))
+	case int64:
+		if canonical {
+			return writeWrapped(buf, "$numberLong", strconv.FormatInt(val, 10))
+		}
+		buf.WriteString(strconv.FormatInt(val, 10))
+	case float64:
+		s := formatDouble(val)
+		if canonical || math.IsNaN(val) || math.IsInf(val, 0) {
+			return writeWrapped(buf, "$numberDouble", s)
+		}
+		buf.WriteString(s)
+	case bson.Decimal128:
+		return writeWrapped(buf, "$numberDecimal", val.String())
+	case bson.ObjectId:
+		return writeWrapped(buf, "$oid", val.Hex())
+	case time.Time:
+		ms := val.UnixNano() / int64(time.Millisecond)
+		if canonical || val.Year() < 1970 || val.Year() > 9999 {
+			buf.WriteString(`{"$date":`)
+			if err := writeWrapped(buf, "$numberLong", strconv.FormatInt(ms, 10)); err != nil {
+				return err
+			}
+			buf.WriteString("}")
+			return nil
+		}
+		return writeWrapped(buf, "$date", val.UTC().Format("2006-01-02T15:04:05.999Z07:00"))
+	case []byte:
+		return writeBinary(buf, 0x00, val)
+	case bson.Binary:
+		return writeBinary(buf, val.Kind, val.Data)
+	case bson.RegEx:
+		return writeDoc(buf, bson.D{{Name: "$regularExpression", Value: bson.D{
+			{Name: "pattern", Value: val.Pattern},
+			{Name: "options", Value: val.Options},
+		}}}, mode)
+	case bson.MongoTimestamp:
+		fmt.Fprintf(buf, `{"$timestamp":{"t":%d,"i":%d}}`, uint64(val)>>32, uint32(val))
+	case bson.JavaScript:
+		doc := bson.D{{Name: "$code", Value: val.Code}}
+		if val.Scope != nil {
+			doc = append(doc, bson.DocElem{Name: "$scope", Value: val.Scope})
+		}
+		return writeDoc(buf, doc, mode)
+	case bson.Symbol:
+		return writeWrapped(buf, "$symbol", string(val))
+	case bson.DBPointer:
+		return writeDoc(buf, bson.D{{Name: "$dbPointer", Value: bson.D{
+			{Name: "$ref", Value: val.Namespace},
+			{Name: "$id", Value: val.Id},
+		}}}, mode)
+	case bson.D:
+		return writeDoc(buf, val, mode)
+	case bson.M:
+		keys := make([]string, 0, len(val))
+		for k := range val {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		doc := make(bson.D, 0, len(val))
+		for _, k := range keys {
+			doc = append(doc, bson.DocElem{Name: k, Value: val[k]})
+		}
+		return writeDoc(buf, doc, mode)
+	case []interface{}:
+		buf.WriteString("[")
+		for i, elem := range val {
+			if i > 0 {
+				buf.WriteString(",")
+			}
+			if err := writeExtJSON(buf, elem, mode); err != nil {
+				return err
+			}
+		}
+		buf.WriteString("]")
+	default:
+		switch v {
+		case bson.MinKey:
+			buf.WriteString(`{"$minKey":1}`)
+		case bson.MaxKey:
+			buf.WriteString(`{"$maxKey":1}`)
+		case bson.Undefined:
+			buf.WriteString(`{"$undefined":true}`)
+		default:
+			return fmt.Errorf("mgohttp: can't write %T as extended JSON", v)
+		}
+	}
+	return nil
+}
+
+func writeDoc(buf *bytes.Buffer, doc bson.D, mode ExtJSONMode) error {
+	buf.WriteString("{")
+	for i, elem := range doc {
+		if i > 0 {
+			buf.WriteString(",")
+		}
+		if err := writeJSON(buf, elem.Name); err != nil {
+			return err
+		}
+		buf.WriteString(":")
+		if err := writeExtJSON(buf, elem.Value, mode); err != nil {
+			return err
+		}
+	}
+	buf.WriteString("}")
+	return nil
+}
+
+// writeWrapped writes the one field document {key: s}, as the extended JSON of most types.
+func writeWrapped(buf *bytes.Buffer, key, s string) error {
+	buf.WriteString(`{"` + key + `":`)
+	if err := writeJSON(buf, s); err != nil {
+		return err
+	}
+	buf.WriteString("}")
+	return nil
+}
+
+func writeBinary(buf *bytes.Buffer, kind byte, data []byte) error {
+	buf.WriteString(`{"$binary":{"base64":`)
+	if err := writeJSON(buf, base64.StdEncoding.EncodeToString(data)); err != nil {
+		return err
+	}
+	fmt.Fprintf(buf, `,"subType":"%02x"}}`, kind)
+	return nil
+}
+
+func writeJSON(buf *bytes.Buffer, v interface{}) error {
+	b, err := json.Marshal(v)
+	buf.Write(b)
+	return err
+}
+
+// formatDouble formats f so it still reads as a double, e.g. 1 as "1.0".
+func formatDouble(f float64) string {
+	switch {
+	case math.IsNaN(f):
+		return "NaN"
+	case math.IsInf(f, 1):
+		return "Infinity"
+	case math.IsInf(f, -1):
+		return "-Infinity"
+	}
+	s := strconv.FormatFloat(f, 'g', -1, 64)
+	if !strings.ContainsAny(s, ".eE") {
+		s += ".0"
+	}
+	return s
+}
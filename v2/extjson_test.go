@@ -0,0 +1,64 @@
+package mgohttp
+
+import (
+	"encoding/json"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	bson "gopkg.in/mgo.v2/bson"
+)
+
+func TestMarshalExtJSON(t *testing.T) {
+	id := bson.ObjectIdHex("5f1e3c2b9d1e8a0001a2b3c4")
+	price, err := bson.ParseDecimal128("9.99")
+	require.NoError(t, err)
+	doc := bson.D{
+		{Name: "_id", Value: id},
+		{Name: "count", Value: 3},
+		{Name: "total", Value: int64(42)},
+		{Name: "ratio", Value: 1.0},
+		{Name: "price", Value: price},
+		{Name: "created", Value: time.Date(2020, 7, 27, 10, 30, 0, 500*int(time.Millisecond), time.UTC)},
+		{Name: "tags", Value: []string{"a"}},
+		{Name: "data", Value: []byte("hi")},
+		{Name: "none", Value: nil},
+	}
+
+	relaxed, err := MarshalExtJSON(doc, ExtJSONRelaxed)
+	require.NoError(t, err)
+	assert.Equal(t, `{"_id":{"$oid":"5f1e3c2b9d1e8a0001a2b3c4"},"count":3,"total":42,"ratio":1.0,`+
+		`"price":{"$numberDecimal":"9.99"},"created":{"$date":"2020-07-27T10:30:00.5Z"},"tags":["a"],`+
+		`"data":{"$binary":{"base64":"aGk=","subType":"00"}},"none":null}`, string(relaxed))
+
+	canonical, err := MarshalExtJSON(doc, ExtJSONCanonical)
+	require.NoError(t, err)
+	assert.Equal(t, `{"_id":{"$oid":"5f1e3c2b9d1e8a0001a2b3c4"},"count":{"$numberInt":"3"},`+
+		`"total":{"$numberLong":"42"},"ratio":{"$numberDouble":"1.0"},"price":{"$numberDecimal":"9.99"},`+
+		`"created":{"$date":{"$numberLong":"1595845800500"}},"tags":["a"],`+
+		`"data":{"$binary":{"base64":"aGk=","subType":"00"}},"none":null}`, string(canonical))
+}
+
+func TestMarshalExtJSONResults(t *testing.T) {
+	type user struct {
+		ID   bson.ObjectId `bson:"_id"`
+		Name string        `bson:"name"`
+		Skip string        `bson:"-"`
+	}
+	id := bson.ObjectIdHex("5f1e3c2b9d1e8a0001a2b3c4")
+	out, err := MarshalExtJSON([]user{{ID: id, Name: "ada", Skip: "x"}}, ExtJSONRelaxed)
+	require.NoError(t, err)
+	assert.Equal(t, `[{"_id":{"$oid":"5f1e3c2b9d1e8a0001a2b3c4"},"name":"ada"}]`, string(out))
+
+	raw, err := bson.Marshal(bson.M{"n": math.Inf(1)})
+	require.NoError(t, err)
+	out, err = MarshalExtJSON(bson.Raw{Kind: 0x03, Data: raw}, ExtJSONRelaxed)
+	require.NoError(t, err)
+	assert.Equal(t, `{"n":{"$numberDouble":"Infinity"}}`, string(out), "non-finite doubles can't be plain numbers")
+
+	out, err = json.Marshal(map[string]interface{}{"user": ExtJSON{Value: bson.M{"_id": id}}})
+	require.NoError(t, err)
+	assert.Equal(t, `{"user":{"_id":{"$oid":"5f1e3c2b9d1e8a0001a2b3c4"}}}`, string(out))
+}
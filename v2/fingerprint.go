@@ -0,0 +1,148 @@
+package mgohttp
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/opentracing/opentracing-go/ext"
+	bson "gopkg.in/mgo.v2/bson"
+)
+
+// QueryFingerprint returns a stable identifier of the shape of an operation: the operation,
+// the collection, and the fields and operators of its selector, without their values. Every
+// instance of the same query has the same fingerprint whatever the values it's run with, e.g.
+// {"email": "a@b.c"} and {"email": "d@e.f"}, and so does a $in whatever the length of its
+// list. It tags the spans (TagQueryFingerprint), the slow query logs and the OpErrors of
+// the operation, so log aggregation can group them.
+func QueryFingerprint(op, collection string, selector interface{}) string {
+	return shapeFingerprint(op, collection, selectorShape(selector))
+}
+
+// shapeFingerprint is QueryFingerprint with the shape of the selector.
+func shapeFingerprint(op, collection, shape string) string {
+	sum := sha256.Sum256([]byte(op + "\x00" + collection + "\x00" + shape))
+	return hex.EncodeToString(sum[:8])
+}
+
+// selectorShape renders the fields and operators of a selector with its values redacted, the
+// fields sorted so their order doesn't matter.
+func selectorShape(v interface{}) string {
+	switch val := v.(type) {
+	case nil:
+		return ""
+	case bson.M:
+		return shapeOfFields(len(val), func(yield func(string, interface{})) {
+			for k, v := range val {
+				yield(k, v)
+			}
+		})
+	case map[string]interface{}:
+		return selectorShape(bson.M(val))
+	case bson.D:
+		return shapeOfFields(len(val), func(yield func(string, interface{})) {
+			for _, elem := range val {
+				yield(elem.Name, elem.Value)
+			}
+		})
+	case []interface{}:
+		return shapeOfList(len(val), func(i int) interface{} { return val[i] })
+	case bson.RegEx, bson.ObjectId, string, []byte, time.Time:
+		return "?"
+	}
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Ptr:
+		if rv.IsNil() {
+			return "?"
+		}
+		if rv.Elem().Kind() == reflect.Struct {
+			return selectorShape(structToM(v))
+		}
+	case reflect.Struct:
+		return selectorShape(structToM(v))
+	case reflect.Map:
+		if rv.Type().Key().Kind() == reflect.String {
+			m := bson.M{}
+			for _, k := range rv.MapKeys() {
+				m[k.String()] = rv.MapIndex(k).Interface()
+			}
+			return selectorShape(m)
+		}
+	case reflect.Slice, reflect.Array:
+		return shapeOfList(rv.Len(), func(i int) interface{} { return rv.Index(i).Interface() })
+	}
+	return "?"
+}
+
+func shapeOfFields(n int, each func(yield func(string, interface{}))) string {
+	fields := make([]string, 0, n)
+	each(func(k string, v interface{}) {
+		fields = append(fields, k+":"+selectorShape(v))
+	})
+	sort.Strings(fields)
+	return "{" + strings.Join(fields, ",") + "}"
+}
+
+// shapeOfList renders the distinct shapes of the elements of a list, so lists of values of
+// the same kinds have the same shape whatever their length.
+func shapeOfList(n int, elem func(i int) interface{}) string {
+	seen := map[string]bool{}
+	shapes := []string{}
+	for i := 0; i < n; i++ {
+		shape := selectorShape(elem(i))
+		if !seen[shape] {
+			seen[shape] = true
+			shapes = append(shapes, shape)
+		}
+	}
+	sort.Strings(shapes)
+	return "[" + strings.Join(shapes, ",") + "]"
+}
+
+// structToM converts a struct selector to a bson.M, following its bson tags. A struct that
+// doesn't marshal has the shape of a value.
+func structToM(v interface{}) interface{} {
+	raw, err := bson.Marshal(v)
+	if err != nil {
+		return "?"
+	}
+	m := bson.M{}
+	if err := bson.Unmarshal(raw, m); err != nil {
+		return "?"
+	}
+	return m
+}
+
+// logSelector logs the fields of the operation's selector and tags the span with the
+// fingerprint of the operation.
+func (o *opSpan) logSelector(selector interface{}) {
+	o.LogFields(bsonToKeys(o.ctx, LogSelector, selector))
+	o.setFingerprint(selector)
+}
+
+// setFingerprint tags the span with the fingerprint of the operation run with selector, or
+// pipeline for aggregations, and with its redacted db.statement.
+func (o *opSpan) setFingerprint(selector interface{}) {
+	name := o.name
+	if name == "getmore" {
+		// the batches of a cursor share the fingerprint of the command that opened it
+		name = "aggregate"
+	}
+	shape := selectorShape(selector)
+	o.fingerprint = shapeFingerprint(name, o.collection, shape)
+	o.SetTag(TagQueryFingerprint, o.fingerprint)
+	ext.DBStatement.Set(o.Span, queryLogging(o.ctx).compact(dbStatement(o.name, o.collection, shape)))
+}
+
+// withFingerprint sets the fingerprint of the OpError err, if it's one without.
+func withFingerprint(err error, fingerprint string) error {
+	if opErr, ok := err.(OpError); ok && opErr.Fingerprint == "" {
+		opErr.Fingerprint = fingerprint
+		return opErr
+	}
+	return err
+}
@@ -0,0 +1,78 @@
+package mgohttp
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	opentracing "github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/mocktracer"
+	"github.com/stretchr/testify/assert"
+	mgo "gopkg.in/mgo.v2"
+	bson "gopkg.in/mgo.v2/bson"
+)
+
+func TestQueryFingerprint(t *testing.T) {
+	fp := QueryFingerprint("find", "users", bson.M{"email": "a@b.c", "age": bson.M{"$gt": 30}})
+	assert.Len(t, fp, 16)
+
+	type byEmail struct {
+		Email string `bson:"email"`
+	}
+	for _, test := range []struct {
+		name string
+		a, b string
+		same bool
+	}{
+		{"values don't matter",
+			fp, QueryFingerprint("find", "users", bson.M{"email": "d@e.f", "age": bson.M{"$gt": 12.5}}), true},
+		{"field order doesn't matter",
+			QueryFingerprint("find", "users", bson.D{{Name: "a", Value: 1}, {Name: "b", Value: 2}}),
+			QueryFingerprint("find", "users", bson.D{{Name: "b", Value: 3}, {Name: "a", Value: 4}}), true},
+		{"$in lengths don't matter",
+			QueryFingerprint("find", "users", bson.M{"_id": bson.M{"$in": []bson.ObjectId{bson.NewObjectId()}}}),
+			QueryFingerprint("find", "users", bson.M{"_id": bson.M{"$in": []bson.ObjectId{bson.NewObjectId(), bson.NewObjectId()}}}), true},
+		{"structs are their fields",
+			QueryFingerprint("find", "users", byEmail{Email: "a@b.c"}),
+			QueryFingerprint("find", "users", bson.M{"email": "d@e.f"}), true},
+		{"operators matter",
+			QueryFingerprint("find", "users", bson.M{"age": bson.M{"$gt": 30}}),
+			QueryFingerprint("find", "users", bson.M{"age": bson.M{"$lt": 30}}), false},
+		{"fields matter",
+			QueryFingerprint("find", "users", bson.M{"email": "a@b.c"}),
+			QueryFingerprint("find", "users", bson.M{"name": "a@b.c"}), false},
+		{"operations matter",
+			QueryFingerprint("find", "users", bson.M{"email": "a@b.c"}),
+			QueryFingerprint("remove", "users", bson.M{"email": "a@b.c"}), false},
+		{"collections matter",
+			QueryFingerprint("find", "users", bson.M{"email": "a@b.c"}),
+			QueryFingerprint("find", "admins", bson.M{"email": "a@b.c"}), false},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			if test.same {
+				assert.Equal(t, test.a, test.b)
+			} else {
+				assert.NotEqual(t, test.a, test.b)
+			}
+		})
+	}
+}
+
+func TestOpFingerprint(t *testing.T) {
+	tracer := mocktracer.New()
+	opentracing.SetGlobalTracer(tracer)
+	defer opentracing.SetGlobalTracer(opentracing.NoopTracer{})
+
+	selector := bson.M{"email": "a@b.c"}
+	sp, _ := startOp(context.Background(), "remove", "users")
+	sp.logSelector(selector)
+	err := sp.done(mgo.ErrNotFound)
+	sp.Finish()
+
+	fp := QueryFingerprint("remove", "users", selector)
+	assert.Equal(t, fp, tracer.FinishedSpans()[0].Tags()[TagQueryFingerprint])
+	var opErr OpError
+	if assert.True(t, errors.As(err, &opErr)) {
+		assert.Equal(t, fp, opErr.Fingerprint)
+	}
+}
@@ -0,0 +1,155 @@
+package mgohttp
+
+import (
+	"time"
+
+	opentracinglog "github.com/opentracing/opentracing-go/log"
+	mgo "gopkg.in/mgo.v2"
+)
+
+type tracedMgoGridFS struct {
+	gfs    *mgo.GridFS
+	prefix string
+	db     tracedMgoDatabase
+}
+
+func (t tracedMgoDatabase) GridFS(prefix string) MongoGridFS {
+	recordUsage("MongoDatabase.GridFS")
+	return tracedMgoGridFS{
+		gfs:    t.db.GridFS(prefix),
+		prefix: prefix,
+		db:     t,
+	}
+}
+
+// files is the collection holding the file documents, for the pre-flight checks and Find.
+func (g tracedMgoGridFS) files() tracedMgoCollection {
+	return tracedMgoCollection{
+		collectionName: g.gfs.Files.Name,
+		collection:     g.gfs.Files,
+		ctx:            g.db.ctx,
+	}
+}
+
+// open starts the span of a file, which is finished when the file is closed.
+func (g tracedMgoGridFS) open(name string, fn func() (*mgo.GridFile, error)) (MongoGridFile, error) {
+	sp, _ := startOp(g.db.ctx, name, g.prefix)
+	if err := g.files().guard(sp, nil); err != nil {
+		logAndReturnErr(sp, err)
+		sp.Finish()
+		return nil, err
+	}
+	var file *mgo.GridFile
+	err := sp.intercept(OpInfo{}, func(*OpInfo) (err error) {
+		file, err = fn()
+		return err
+	})
+	if err != nil {
+		sp.done(err)
+		sp.Finish()
+		return nil, err
+	}
+	sp.LogFields(opentracinglog.String(LogFileName, file.Name()))
+	return &tracedMgoGridFile{file: file, op: sp}, nil
+}
+
+func (g tracedMgoGridFS) Create(name string) (MongoGridFile, error) {
+	recordUsage("MongoGridFS.Create")
+	return g.open("gridfs-create", func() (*mgo.GridFile, error) {
+		return g.gfs.Create(name)
+	})
+}
+
+func (g tracedMgoGridFS) Open(name string) (MongoGridFile, error) {
+	recordUsage("MongoGridFS.Open")
+	return g.open("gridfs-open", func() (*mgo.GridFile, error) {
+		return g.gfs.Open(name)
+	})
+}
+
+func (g tracedMgoGridFS) OpenId(id interface{}) (MongoGridFile, error) {
+	recordUsage("MongoGridFS.OpenId")
+	return g.open("gridfs-open", func() (*mgo.GridFile, error) {
+		return g.gfs.OpenId(id)
+	})
+}
+
+func (g tracedMgoGridFS) Remove(name string) (err error) {
+	recordUsage("MongoGridFS.Remove")
+	sp, _ := startOp(g.db.ctx, "gridfs-remove", g.prefix)
+	defer sp.Finish()
+	defer sp.recoverPanic(&err)
+	sp.LogFields(opentracinglog.String(LogFileName, name))
+	if err := g.files().guard(sp, nil); err != nil {
+		return logAndReturnErr(sp, err)
+	}
+
+	return sp.done(sp.intercept(OpInfo{}, func(*OpInfo) error { return g.gfs.Remove(name) }))
+}
+
+func (g tracedMgoGridFS) RemoveId(id interface{}) (err error) {
+	recordUsage("MongoGridFS.RemoveId")
+	sp, _ := startOp(g.db.ctx, "gridfs-remove", g.prefix)
+	defer sp.Finish()
+	defer sp.recoverPanic(&err)
+	if err := g.files().guard(sp, nil); err != nil {
+		return logAndReturnErr(sp, err)
+	}
+
+	return sp.done(sp.intercept(OpInfo{}, func(*OpInfo) error { return g.gfs.RemoveId(id) }))
+}
+
+func (g tracedMgoGridFS) Find(query interface{}) MongoQuery {
+	recordUsage("MongoGridFS.Find")
+	return g.files().Find(query)
+}
+
+// tracedMgoGridFile counts the bytes read from or written to a file, and logs them on the
+// file's span when it's closed.
+type tracedMgoGridFile struct {
+	file    *mgo.GridFile
+	op      *opSpan
+	read    int64
+	written int64
+}
+
+func (f *tracedMgoGridFile) Read(b []byte) (int, error) {
+	n, err := f.file.Read(b)
+	f.read += int64(n)
+	return n, err
+}
+
+func (f *tracedMgoGridFile) Write(data []byte) (int, error) {
+	n, err := f.file.Write(data)
+	f.written += int64(n)
+	return n, err
+}
+
+func (f *tracedMgoGridFile) Seek(offset int64, whence int) (int64, error) {
+	return f.file.Seek(offset, whence)
+}
+
+func (f *tracedMgoGridFile) Close() (err error) {
+	defer f.op.Finish()
+	defer f.op.recoverPanic(&err)
+	f.op.LogFields(
+		opentracinglog.Int64(LogBytesRead, f.read),
+		opentracinglog.Int64(LogBytesWritten, f.written),
+	)
+	return f.op.done(f.file.Close())
+}
+
+func (f *tracedMgoGridFile) Abort()                           { f.file.Abort() }
+func (f *tracedMgoGridFile) Id() interface{}                  { return f.file.Id() }
+func (f *tracedMgoGridFile) SetId(id interface{})             { f.file.SetId(id) }
+func (f *tracedMgoGridFile) Name() string                     { return f.file.Name() }
+func (f *tracedMgoGridFile) SetName(name string)              { f.file.SetName(name) }
+func (f *tracedMgoGridFile) ContentType() string              { return f.file.ContentType() }
+func (f *tracedMgoGridFile) SetContentType(ctype string)      { f.file.SetContentType(ctype) }
+func (f *tracedMgoGridFile) GetMeta(result interface{}) error { return f.file.GetMeta(result) }
+func (f *tracedMgoGridFile) SetMeta(metadata interface{})     { f.file.SetMeta(metadata) }
+func (f *tracedMgoGridFile) Size() int64                      { return f.file.Size() }
+func (f *tracedMgoGridFile) MD5() string                      { return f.file.MD5() }
+func (f *tracedMgoGridFile) UploadDate() time.Time            { return f.file.UploadDate() }
+func (f *tracedMgoGridFile) SetUploadDate(t time.Time)        { f.file.SetUploadDate(t) }
+func (f *tracedMgoGridFile) SetChunkSize(bytes int)           { f.file.SetChunkSize(bytes) }
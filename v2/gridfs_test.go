@@ -0,0 +1,32 @@
+package mgohttp
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	opentracing "github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/mocktracer"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	mgo "gopkg.in/mgo.v2"
+)
+
+func TestGridFSGuardsFilesCollection(t *testing.T) {
+	DisableCollection(testDBName, "reports.files")
+	defer EnableCollection(testDBName, "reports.files")
+
+	tracer := mocktracer.New()
+	opentracing.SetGlobalTracer(tracer)
+	defer opentracing.SetGlobalTracer(opentracing.NoopTracer{})
+	db := tracedMgoDatabase{db: &mgo.Database{Name: testDBName}, ctx: context.Background()}
+
+	file, err := db.GridFS("reports").Create("export.csv")
+	assert.Nil(t, file)
+	assert.True(t, errors.Is(err, ErrCollectionDisabled))
+
+	spans := tracer.FinishedSpans()
+	require.Len(t, spans, 1)
+	assert.Equal(t, "gridfs-create", spans[0].OperationName)
+	assert.Equal(t, "reports", spans[0].Tag(TagCollection))
+}
@@ -0,0 +1,226 @@
+package mgohttp
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+
+	opentracing "github.com/opentracing/opentracing-go"
+	"gopkg.in/Clever/kayvee-go.v6/logger"
+	bson "gopkg.in/mgo.v2/bson"
+)
+
+// ErrSelectorTooComplex is the sentinel wrapped by every SelectorTooComplexError.
+var ErrSelectorTooComplex = errors.New("selector too complex")
+
+// SelectorTooComplexError is returned when a selector exceeds the configured SelectorLimits
+// and the guard is set to reject.
+type SelectorTooComplexError struct {
+	Collection string
+	Reason     string
+}
+
+func (e SelectorTooComplexError) Error() string {
+	return fmt.Sprintf("mgohttp: %s: %s: %s", e.Collection, ErrSelectorTooComplex, e.Reason)
+}
+
+// Unwrap allows errors.Is(err, ErrSelectorTooComplex).
+func (e SelectorTooComplexError) Unwrap() error {
+	return ErrSelectorTooComplex
+}
+
+// SelectorLimits configures the selector complexity guard. Selectors that are deeply nested
+// or carry huge $in arrays regularly cause query planner blowups, so we'd rather catch them in
+// the wrapper. A zero limit disables that check.
+type SelectorLimits struct {
+	// MaxLogicalDepth is the maximum nesting of $or/$and/$nor clauses.
+	MaxLogicalDepth int
+	// MaxInElements is the maximum number of elements in any $in/$nin/$all array.
+	MaxInElements int
+	// Reject makes violating operations fail with a SelectorTooComplexError. Otherwise
+	// violations are only tagged on the span and logged as a warning.
+	Reject bool
+}
+
+func (l SelectorLimits) enabled() bool {
+	return l.MaxLogicalDepth > 0 || l.MaxInElements > 0
+}
+
+// selectorComplexity measures the deepest $or/$and/$nor nesting and the largest
+// $in/$nin/$all array in a selector.
+func selectorComplexity(selector interface{}) (logicalDepth int, inElements int) {
+	var walk func(v interface{}, depth int)
+	visit := func(k string, v interface{}, depth int) {
+		switch k {
+		case "$or", "$and", "$nor":
+			depth++
+			if depth > logicalDepth {
+				logicalDepth = depth
+			}
+		case "$in", "$nin", "$all":
+			if rv := reflect.ValueOf(v); rv.Kind() == reflect.Slice || rv.Kind() == reflect.Array {
+				if rv.Len() > inElements {
+					inElements = rv.Len()
+				}
+			}
+		}
+		walk(v, depth)
+	}
+	walk = func(v interface{}, depth int) {
+		switch val := v.(type) {
+		case bson.M:
+			for k, sub := range val {
+				visit(k, sub, depth)
+			}
+		case map[string]interface{}:
+			for k, sub := range val {
+				visit(k, sub, depth)
+			}
+		case bson.D:
+			for _, elem := range val {
+				visit(elem.Name, elem.Value, depth)
+			}
+		case []bson.M:
+			for _, sub := range val {
+				walk(sub, depth)
+			}
+		case []bson.D:
+			for _, sub := range val {
+				walk(sub, depth)
+			}
+		case []interface{}:
+			for _, sub := range val {
+				walk(sub, depth)
+			}
+		}
+	}
+	walk(selector, 0)
+	return logicalDepth, inElements
+}
+
+// usesOperator reports whether op appears as a key anywhere in the selector.
+func usesOperator(selector interface{}, op string) bool {
+	for _, o := range selectorOperators(selector) {
+		if o == "operator:"+op {
+			return true
+		}
+	}
+	return false
+}
+
+// checkSelector applies the handler's SelectorLimits to selector. It returns an error only
+// when the selector should be rejected.
+func (tc tracedMgoCollection) checkSelector(sp opentracing.Span, selector interface{}) error {
+	if selector == nil {
+		return nil
+	}
+
+	// $expr is only understood from 3.6 on, older servers reject it with an unhelpful
+	// "unknown top level operator" error.
+	if usesOperator(selector, "$expr") && tc.collection.Database.Session != nil {
+		if err := checkServerFeature(tc.ctx, tc.collection.Database.Session, FeatureExpr); err != nil {
+			sp.SetTag(TagSelectorUnsupported, "$expr")
+			return err
+		}
+	}
+
+	h := handlerFromContext(tc.ctx)
+	if h == nil || !h.cfg.SelectorLimits.enabled() {
+		return nil
+	}
+	limits := h.cfg.SelectorLimits
+
+	depth, inElements := selectorComplexity(selector)
+	reason := ""
+	switch {
+	case limits.MaxLogicalDepth > 0 && depth > limits.MaxLogicalDepth:
+		reason = fmt.Sprintf("logical operator depth %d exceeds %d", depth, limits.MaxLogicalDepth)
+	case limits.MaxInElements > 0 && inElements > limits.MaxInElements:
+		reason = fmt.Sprintf("$in with %d elements exceeds %d", inElements, limits.MaxInElements)
+	default:
+		return nil
+	}
+
+	sp.SetTag(TagSelectorTooComplex, true)
+	sp.SetTag(TagSelectorTooComplexReason, reason)
+	if !limits.Reject {
+		logger.FromContext(tc.ctx).WarnD("mgohttp-selector-too-complex", logger.M{
+			"collection": tc.collectionName,
+			"reason":     reason,
+			"caller":     handlerFromContext(tc.ctx).callerName(),
+		})
+		return nil
+	}
+	return SelectorTooComplexError{Collection: tc.collectionName, Reason: reason}
+}
+
+// unanchoredRegexFields returns the fields of a selector matched with a case-insensitive regex
+// that isn't anchored to the start of the string. Such a regex can't use an index, so it
+// scans every document (or index key) of the collection.
+func unanchoredRegexFields(selector interface{}) []string {
+	fields := []string{}
+	isBad := func(pattern, options string) bool {
+		return strings.Contains(options, "i") && !strings.HasPrefix(pattern, "^")
+	}
+	var walk func(field string, v interface{})
+	visit := func(field, k string, v interface{}) {
+		if !strings.HasPrefix(k, "$") {
+			field = k
+		}
+		walk(field, v)
+	}
+	walk = func(field string, v interface{}) {
+		switch val := v.(type) {
+		case bson.RegEx:
+			if isBad(val.Pattern, val.Options) {
+				fields = append(fields, field)
+			}
+		case bson.M:
+			if pattern, ok := val["$regex"].(string); ok {
+				options, _ := val["$options"].(string)
+				if isBad(pattern, options) {
+					fields = append(fields, field)
+				}
+				return
+			}
+			for k, sub := range val {
+				visit(field, k, sub)
+			}
+		case bson.D:
+			for _, elem := range val {
+				visit(field, elem.Name, elem.Value)
+			}
+		case []bson.M:
+			for _, sub := range val {
+				walk(field, sub)
+			}
+		case []interface{}:
+			for _, sub := range val {
+				walk(field, sub)
+			}
+		}
+	}
+	walk("", selector)
+	return fields
+}
+
+// checkRegex tags the span when the selector uses an unindexable regex, and logs a warning
+// with the caller if the handler asks for it.
+func (tc tracedMgoCollection) checkRegex(sp opentracing.Span, selector interface{}) {
+	if selector == nil {
+		return
+	}
+	fields := unanchoredRegexFields(selector)
+	if len(fields) == 0 {
+		return
+	}
+	sp.SetTag(TagUnanchoredRegex, strings.Join(fields, "|"))
+	if h := handlerFromContext(tc.ctx); h != nil && h.cfg.WarnOnUnanchoredRegex {
+		logger.FromContext(tc.ctx).WarnD("mgohttp-unanchored-regex", logger.M{
+			"collection": tc.collectionName,
+			"fields":     strings.Join(fields, "|"),
+			"caller":     handlerFromContext(tc.ctx).callerName(),
+		})
+	}
+}
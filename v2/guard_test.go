@@ -0,0 +1,87 @@
+package mgohttp
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	opentracing "github.com/opentracing/opentracing-go"
+	"github.com/stretchr/testify/assert"
+	mgo "gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+func TestSelectorComplexity(t *testing.T) {
+	depth, in := selectorComplexity(bson.M{
+		"$or": []bson.M{
+			{"a": 1},
+			{"$and": []interface{}{
+				bson.M{"b": bson.M{"$in": []int{1, 2, 3}}},
+				bson.D{{Name: "$or", Value: []bson.M{{"c": bson.M{"$nin": []string{"x", "y"}}}}}},
+			}},
+		},
+	})
+	assert.Equal(t, 3, depth)
+	assert.Equal(t, 3, in)
+
+	depth, in = selectorComplexity(bson.M{"_id": bson.M{"$in": make([]bson.ObjectId, 500)}})
+	assert.Equal(t, 0, depth)
+	assert.Equal(t, 500, in)
+}
+
+func TestSelectorGuard(t *testing.T) {
+	h := &SessionHandler{cfg: SessionHandlerConfig{SelectorLimits: SelectorLimits{MaxInElements: 10, Reject: true}}}
+	c := tracedMgoCollection{
+		collectionName: "users",
+		// The collection has no session behind it, so only rejected calls are safe to make.
+		collection: &mgo.Collection{Name: "users", Database: &mgo.Database{Name: testDBName}},
+		ctx:        context.WithValue(context.Background(), handlerKey, h),
+	}
+
+	err := c.Remove(bson.M{"_id": bson.M{"$in": make([]int, 11)}})
+	assert.True(t, errors.Is(err, ErrSelectorTooComplex))
+	assert.Equal(t, "users", err.(SelectorTooComplexError).Collection)
+
+	var result bson.M
+	err = c.Find(bson.M{"_id": bson.M{"$in": make([]int, 11)}}).One(&result)
+	assert.True(t, errors.Is(err, ErrSelectorTooComplex))
+
+	sp := opentracing.NoopTracer{}.StartSpan("test")
+	assert.NoError(t, c.checkSelector(sp, bson.M{"_id": bson.M{"$in": make([]int, 10)}}))
+
+	h.cfg.SelectorLimits.Reject = false
+	assert.NoError(t, c.checkSelector(sp, bson.M{"_id": bson.M{"$in": make([]int, 11)}}),
+		"only warn when not rejecting")
+}
+
+func TestExprGuard(t *testing.T) {
+	h := &SessionHandler{}
+	// a 3.2 server, cached: the collection has no session behind it
+	h.buildInfo.info = mgo.BuildInfo{Version: "3.2.20", VersionArray: []int{3, 2, 20, 0}}
+	h.buildInfo.fetched = time.Now()
+	c := tracedMgoCollection{
+		collectionName: "users",
+		collection:     &mgo.Collection{Name: "users", Database: &mgo.Database{Name: testDBName, Session: &mgo.Session{}}},
+		ctx:            context.WithValue(context.Background(), handlerKey, h),
+	}
+
+	err := c.Find(bson.M{"$expr": bson.M{"$eq": []interface{}{"$a", "$b"}}}).One(&bson.M{})
+	var unsupported UnsupportedFeatureError
+	assert.True(t, errors.As(err, &unsupported), "%v", err)
+	assert.Equal(t, UnsupportedFeatureError{Feature: FeatureExpr, Version: "3.2.20"}, unsupported)
+	assert.False(t, errors.Is(err, ErrSelectorTooComplex))
+}
+
+func TestUnanchoredRegexFields(t *testing.T) {
+	assert.Equal(t, []string{"name"}, unanchoredRegexFields(bson.M{"name": bson.RegEx{Pattern: "smith", Options: "i"}}))
+	assert.Equal(t, []string{"email"}, unanchoredRegexFields(bson.M{
+		"$or": []bson.M{
+			{"email": bson.M{"$regex": "@example.com", "$options": "i"}},
+			{"email": bson.M{"$regex": "^admin", "$options": "i"}},
+		},
+	}))
+	assert.Empty(t, unanchoredRegexFields(bson.M{"name": bson.RegEx{Pattern: "^smith", Options: "i"}}), "anchored")
+	assert.Empty(t, unanchoredRegexFields(bson.M{"name": bson.RegEx{Pattern: "smith"}}), "case sensitive")
+	assert.Empty(t, unanchoredRegexFields(bson.M{"name": "smith"}))
+}
@@ -0,0 +1,344 @@
+package mgohttp
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/Clever/mgohttp/v2/internal"
+	opentracing "github.com/opentracing/opentracing-go"
+	"go.mongodb.org/mongo-driver/mongo"
+	mgo "gopkg.in/mgo.v2"
+)
+
+// Backend provides the sessions of the requests served by a Handler. Mgo, SessionFunc, Pool
+// and URL create them with the mgo driver, DriverBackend with a Driver, e.g. the official
+// driver's of MongoDriver, and Sessions hands out ready-made ones, e.g. the fake of
+// mgohttptest.
+type Backend interface {
+	// Wrap returns the middleware serving next with the sessions of cfg.Database and
+	// cfg.Databases.
+	Wrap(next http.Handler, cfg Config) http.Handler
+}
+
+// Config is the configuration New builds with its options and hands to its Backend.
+type Config = SessionHandlerConfig
+
+// pinger is implemented by the backends the health check can ping.
+type pinger interface {
+	session() *mgo.Session
+}
+
+type mgoBackend struct {
+	sess *mgo.Session
+}
+
+// Mgo is the Backend copying sess for every request, as SessionHandlerConfig.Sess.
+func Mgo(sess *mgo.Session) Backend {
+	return mgoBackend{sess: sess}
+}
+
+func (b mgoBackend) Wrap(next http.Handler, cfg Config) http.Handler {
+	cfg.Sess, cfg.Handler = b.sess, next
+	return NewSessionHandler(cfg)
+}
+
+func (b mgoBackend) session() *mgo.Session { return b.sess }
+
+type sessionFuncBackend func(ctx context.Context) (*mgo.Session, error)
+
+// SessionFunc is the Backend creating the session of every request with newSession, as
+// SessionHandlerConfig.NewSession.
+func SessionFunc(newSession func(ctx context.Context) (*mgo.Session, error)) Backend {
+	return sessionFuncBackend(newSession)
+}
+
+func (b sessionFuncBackend) Wrap(next http.Handler, cfg Config) http.Handler {
+	cfg.NewSession, cfg.Handler = b, next
+	return NewSessionHandler(cfg)
+}
+
+type poolBackend struct {
+	parent *mgo.Session
+	pool   *SessionPool
+}
+
+// Pool is the Backend checking the sessions of the requests out of a pool of copies of parent,
+// as SessionHandlerConfig.SessionPool.
+func Pool(parent *mgo.Session, cfg SessionPoolConfig) Backend {
+	return poolBackend{parent: parent, pool: NewSessionPool(parent, cfg)}
+}
+
+func (b poolBackend) Wrap(next http.Handler, cfg Config) http.Handler {
+	cfg.Sess, cfg.SessionPool, cfg.Handler = b.parent, b.pool, next
+	return NewSessionHandler(cfg)
+}
+
+func (b poolBackend) session() *mgo.Session { return b.parent }
+
+type urlBackend struct {
+	rawURL string
+	opts   []DialOption
+}
+
+// URL is the Backend dialing rawURL with opts on the first request, and re-dialing it when
+// the operations keep losing their connection, as SessionHandlerConfig.URL. It has no
+// session for WithHealthCheck to ping.
+func URL(rawURL string, opts ...DialOption) Backend {
+	return urlBackend{rawURL: rawURL, opts: opts}
+}
+
+func (b urlBackend) Wrap(next http.Handler, cfg Config) http.Handler {
+	cfg.Sess, cfg.URL, cfg.DialOptions, cfg.Handler = nil, b.rawURL, b.opts, next
+	return NewSessionHandler(cfg)
+}
+
+type driverBackend struct {
+	driver Driver
+}
+
+// DriverBackend is the Backend opening the sessions of the requests with driver in place of
+// mgo, as SessionHandlerConfig.Driver. The databases of WithDatabases use it too, unless
+// their DatabaseConfig has a Sess, NewSession or Driver of its own. It has no session for
+// WithHealthCheck to ping.
+func DriverBackend(driver Driver) Backend {
+	return driverBackend{driver: driver}
+}
+
+func (b driverBackend) Wrap(next http.Handler, cfg Config) http.Handler {
+	cfg.Driver, cfg.Handler = b.driver, next
+	return NewSessionHandler(cfg)
+}
+
+// MongoDriver is the DriverBackend of the official driver, go.mongodb.org/mongo-driver,
+// connected with client, see NewMongoDriver.
+func MongoDriver(client *mongo.Client) Backend {
+	return DriverBackend(NewMongoDriver(client))
+}
+
+type sessionsBackend func(ctx context.Context, database string) MongoSession
+
+// Sessions is the Backend handing out the sessions returned by session, e.g. those of
+// mgohttptest.FakeMongo. The options configuring the mgo sessions, such as the timeout and
+// the tracer, don't apply to them.
+func Sessions(session func(ctx context.Context, database string) MongoSession) Backend {
+	return sessionsBackend(session)
+}
+
+func (b sessionsBackend) Wrap(next http.Handler, cfg Config) http.Handler {
+	databases := []string{cfg.Database}
+	for _, db := range cfg.Databases {
+		databases = append(databases, db.Database)
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		for _, database := range databases {
+			database := database
+			ctx = internal.NewProviderContext(ctx, database, func(ctx context.Context) interface{} {
+				return b(ctx, database)
+			})
+		}
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// Option configures a Handler.
+type Option func(h *Handler)
+
+// DefaultTimeout bounds each request's use of Mongo when there's no WithTimeout.
+const DefaultTimeout = 10 * time.Second
+
+// WithTimeout bounds each request's use of Mongo, see Config.Timeout. It's DefaultTimeout
+// when not set.
+func WithTimeout(d time.Duration) Option {
+	return func(h *Handler) { h.cfg.Timeout = d }
+}
+
+// WithDatabases serves additional databases alongside the Handler's, see Config.Databases.
+func WithDatabases(databases ...DatabaseConfig) Option {
+	return func(h *Handler) { h.cfg.Databases = append(h.cfg.Databases, databases...) }
+}
+
+// WithTracer records the spans of the sessions with tracer in place of the global tracer.
+func WithTracer(tracer opentracing.Tracer) Option {
+	return func(h *Handler) { h.cfg.Tracer = tracer }
+}
+
+// WithMetrics exports Prometheus metrics for the sessions and operations.
+func WithMetrics(metrics *Metrics) Option {
+	return func(h *Handler) { h.cfg.Metrics = metrics }
+}
+
+// WithErrorMapper writes the responses of the requests the Handler answers itself, see
+// Config.ErrorMapper.
+func WithErrorMapper(mapper ErrorMapper) Option {
+	return func(h *Handler) { h.cfg.ErrorMapper = mapper }
+}
+
+// WithInterceptors runs interceptors around every operation, after those of earlier options.
+func WithInterceptors(interceptors ...Interceptor) Option {
+	return func(h *Handler) { h.cfg.Interceptors = append(h.cfg.Interceptors, interceptors...) }
+}
+
+// WithHealthMonitor feeds monitor the latency and outcome of every operation. The health
+// check reports its snapshot.
+func WithHealthMonitor(monitor *HealthMonitor) Option {
+	return func(h *Handler) {
+		h.cfg.HealthMonitor = monitor
+		h.healthOpts.Monitor = monitor
+	}
+}
+
+// WithSafe sets the write concern of the sessions, see Config.Safe.
+func WithSafe(safe *mgo.Safe) Option {
+	return func(h *Handler) { h.cfg.Safe = safe }
+}
+
+// WithPartialResponseGrace lets handlers answer with partial results when the timeout hits,
+// see Config.PartialResponseGrace.
+func WithPartialResponseGrace(grace time.Duration) Option {
+	return func(h *Handler) { h.cfg.PartialResponseGrace = grace }
+}
+
+// WithHealthCheck serves the health check of NewHealthHandler on path, in front of the
+// middleware. Its Monitor is the one of WithHealthMonitor. The Backend must be Mgo or Pool.
+func WithHealthCheck(path string, timeout time.Duration) Option {
+	return func(h *Handler) {
+		h.healthPath = path
+		h.healthOpts.Timeout = timeout
+	}
+}
+
+// WithSpanNamer names the span of each caller of FromContext after the request, e.g. its
+// route, see Config.SpanNamer.
+func WithSpanNamer(namer func(r *http.Request) string) Option {
+	return func(h *Handler) { h.cfg.SpanNamer = namer }
+}
+
+// WithCallerSkipPrefixes skips the functions with one of prefixes when naming the callers of
+// mgohttp, e.g. a service's own helpers around it, see Config.CallerSkipPrefixes.
+func WithCallerSkipPrefixes(prefixes ...string) Option {
+	return func(h *Handler) { h.cfg.CallerSkipPrefixes = append(h.cfg.CallerSkipPrefixes, prefixes...) }
+}
+
+// WithTraceSampling gives spans to the operations of a share of the requests, from 0 to 1,
+// the others only get their "mgohttp" span. 0 records no operation spans, see
+// Config.OpSpanSampling.
+func WithTraceSampling(rate float64) Option {
+	return func(h *Handler) {
+		h.cfg.OpSpanSampling = rate
+		h.cfg.DisableOpSpans = rate <= 0
+	}
+}
+
+// WithReadPreference routes the reads of every session to the replica set members matching
+// p, see Config.ReadPreference.
+func WithReadPreference(p ReadPreference) Option {
+	return func(h *Handler) { h.cfg.ReadPreference = &p }
+}
+
+// WithReadOnlyRoutes gives the sessions of the GET and HEAD requests whose path has one of
+// pathPrefixes the consistency mode mode, e.g. mgo.SecondaryPreferred, see
+// Config.ReadOnlyRoutes.
+func WithReadOnlyRoutes(pathPrefixes []string, mode mgo.Mode) Option {
+	return func(h *Handler) {
+		h.cfg.ReadOnlyRoutes = &ReadOnlyRoutes{PathPrefixes: pathPrefixes, Mode: mode}
+	}
+}
+
+// WithMaxQueriesPerRequest logs and tags the requests running more than n operations, see
+// Config.MaxQueriesPerRequest. With abort, the operations over n fail with a
+// QueryBudgetExceededError.
+func WithMaxQueriesPerRequest(n int, abort bool) Option {
+	return func(h *Handler) {
+		h.cfg.MaxQueriesPerRequest = n
+		h.cfg.AbortOverQueryBudget = abort
+	}
+}
+
+// WithRefreshOnSocketErrors refreshes the sessions of the requests after their operations
+// lost their socket, see Config.RefreshOnSocketErrors.
+func WithRefreshOnSocketErrors() Option {
+	return func(h *Handler) { h.cfg.RefreshOnSocketErrors = true }
+}
+
+// WithRequestComment tags the operations of a request with the comment returned for it, e.g.
+// its request ID, see Config.RequestComment.
+func WithRequestComment(comment func(r *http.Request) string) Option {
+	return func(h *Handler) { h.cfg.RequestComment = comment }
+}
+
+// WithoutOpSpans only records the "mgohttp" span of the requests, see Config.DisableOpSpans.
+func WithoutOpSpans() Option {
+	return func(h *Handler) { h.cfg.DisableOpSpans = true }
+}
+
+// WithDebugHeader turns on verbose diagnostics for the requests whose header carries one of
+// tokens, see Config.DebugHeader.
+func WithDebugHeader(header string, tokens ...string) Option {
+	return func(h *Handler) {
+		h.cfg.DebugHeader = header
+		h.cfg.DebugTokens = tokens
+	}
+}
+
+// WithConfig changes the Config directly, for the settings without an option of their own.
+func WithConfig(configure func(cfg *Config)) Option {
+	return func(h *Handler) { configure(&h.cfg) }
+}
+
+// Handler is the middleware injecting the sessions of a Backend into the context of the
+// requests, in place of SessionHandler and NewHealthHandler.
+type Handler struct {
+	backend    Backend
+	cfg        Config
+	healthPath string
+	healthOpts HealthHandlerOptions
+	health     http.Handler
+}
+
+// New returns a Handler serving database with the sessions of backend. It fails when the
+// options don't make sense together.
+func New(backend Backend, database string, opts ...Option) (*Handler, error) {
+	if backend == nil {
+		return nil, errors.New("mgohttp: no backend")
+	}
+	if database == "" {
+		return nil, errors.New("mgohttp: no database")
+	}
+	h := &Handler{backend: backend, cfg: Config{Database: database}}
+	for _, opt := range opts {
+		opt(h)
+	}
+	if h.cfg.Timeout < 0 {
+		return nil, errors.New("mgohttp: negative timeout")
+	}
+	if h.cfg.Timeout == 0 {
+		// NewSessionHandler would time every request out right away
+		h.cfg.Timeout = DefaultTimeout
+	}
+	if h.healthPath != "" {
+		p, ok := backend.(pinger)
+		if !ok {
+			return nil, errors.New("mgohttp: the backend has no session for the health check to ping")
+		}
+		h.health = NewHealthHandler(p.session(), h.healthOpts)
+	}
+	return h, nil
+}
+
+// Wrap returns next served with the Handler's sessions, and the health check on its path.
+func (h *Handler) Wrap(next http.Handler) http.Handler {
+	wrapped := h.backend.Wrap(next, h.cfg)
+	if h.health == nil {
+		return wrapped
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == h.healthPath {
+			h.health.ServeHTTP(w, r)
+			return
+		}
+		wrapped.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,56 @@
+package mgohttp
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewValidates(t *testing.T) {
+	backend := Sessions(func(ctx context.Context, database string) MongoSession { return NopSession() })
+
+	_, err := New(nil, "test")
+	assert.Error(t, err)
+	_, err = New(backend, "")
+	assert.Error(t, err)
+	_, err = New(backend, "test", WithTimeout(-1))
+	assert.Error(t, err)
+	_, err = New(backend, "test", WithHealthCheck("/healthz", 0))
+	assert.Error(t, err, "the backend has no session to ping")
+
+	h, err := New(backend, "test")
+	require.NoError(t, err)
+	assert.Equal(t, DefaultTimeout, h.cfg.Timeout)
+	h, err = New(backend, "test", WithTimeout(time.Second))
+	require.NoError(t, err)
+	assert.Equal(t, time.Second, h.cfg.Timeout)
+}
+
+func TestOptions(t *testing.T) {
+	interceptor := func(ctx context.Context, op *OpInfo, next func() error) error { return next() }
+	monitor := NewHealthMonitor(HealthMonitorConfig{})
+	h, err := New(SessionFunc(nil), "test",
+		WithInterceptors(interceptor),
+		WithInterceptors(interceptor),
+		WithHealthMonitor(monitor),
+		WithCallerSkipPrefixes("github.com/acme/db."),
+		WithTraceSampling(0.1),
+		WithConfig(func(cfg *Config) { cfg.InSplitSize = 100 }),
+	)
+	require.NoError(t, err)
+	assert.Len(t, h.cfg.Interceptors, 2)
+	assert.Equal(t, monitor, h.cfg.HealthMonitor)
+	assert.Equal(t, monitor, h.healthOpts.Monitor)
+	assert.Equal(t, 100, h.cfg.InSplitSize)
+	assert.Equal(t, []string{"github.com/acme/db."}, h.cfg.CallerSkipPrefixes)
+	assert.Equal(t, 0.1, h.cfg.OpSpanSampling)
+	assert.False(t, h.cfg.DisableOpSpans)
+
+	h, err = New(SessionFunc(nil), "test", WithTraceSampling(0))
+	require.NoError(t, err)
+	assert.True(t, h.cfg.DisableOpSpans)
+	assert.Equal(t, "test", h.cfg.Database)
+}
@@ -0,0 +1,221 @@
+package mgohttp
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	opentracing "github.com/opentracing/opentracing-go"
+	mgo "gopkg.in/mgo.v2"
+)
+
+// healthBuckets is the number of buckets the rolling window is divided into.
+const healthBuckets = 10
+
+// HealthMonitorConfig configures when a HealthMonitor reports Mongo as degraded.
+type HealthMonitorConfig struct {
+	// Window is the rolling window that latencies and errors are evaluated over. Defaults
+	// to 30s, and can't be shorter than 10ns, one per bucket.
+	Window time.Duration
+	// SlowThreshold is the latency above which an operation counts as slow. Defaults to 1s.
+	SlowThreshold time.Duration
+	// MaxSlowRatio is the share of slow operations in the window above which Mongo is
+	// degraded. Defaults to 0.2.
+	MaxSlowRatio float64
+	// MaxErrorRatio is the share of failed operations in the window above which Mongo is
+	// degraded. Defaults to 0.1.
+	MaxErrorRatio float64
+	// MinSamples is the number of operations the window needs before it can be degraded,
+	// so a handful of slow queries on an idle service don't trip it. Defaults to 20.
+	MinSamples int
+}
+
+type healthBucket struct {
+	start  time.Time
+	total  int
+	slow   int
+	errors int
+}
+
+// HealthMonitor derives a health signal from the latency and errors of the Mongo operations
+// issued through the SessionHandlers it's configured on. It's meant to let upstream load
+// balancers back off before the database tips over, see Middleware.
+type HealthMonitor struct {
+	cfg HealthMonitorConfig
+
+	mu      sync.Mutex
+	buckets [healthBuckets]healthBucket
+}
+
+// NewHealthMonitor returns a HealthMonitor, set it as SessionHandlerConfig.HealthMonitor to
+// feed it. One monitor can be shared by several handlers.
+func NewHealthMonitor(cfg HealthMonitorConfig) *HealthMonitor {
+	if cfg.Window <= 0 {
+		cfg.Window = 30 * time.Second
+	} else if cfg.Window < healthBuckets {
+		// the buckets divide the window, a bucket can't be shorter than a nanosecond
+		cfg.Window = healthBuckets
+	}
+	if cfg.SlowThreshold <= 0 {
+		cfg.SlowThreshold = time.Second
+	}
+	if cfg.MaxSlowRatio <= 0 {
+		cfg.MaxSlowRatio = 0.2
+	}
+	if cfg.MaxErrorRatio <= 0 {
+		cfg.MaxErrorRatio = 0.1
+	}
+	if cfg.MinSamples <= 0 {
+		cfg.MinSamples = 20
+	}
+	return &HealthMonitor{cfg: cfg}
+}
+
+// bucket returns the bucket for now, resetting it if it holds data from a previous window.
+func (m *HealthMonitor) bucket(now time.Time) *healthBucket {
+	width := m.cfg.Window / healthBuckets
+	start := now.Truncate(width)
+	b := &m.buckets[(start.UnixNano()/int64(width))%healthBuckets]
+	if !b.start.Equal(start) {
+		*b = healthBucket{start: start}
+	}
+	return b
+}
+
+// Observe records the outcome of a single operation.
+func (m *HealthMonitor) Observe(latency time.Duration, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	b := m.bucket(time.Now())
+	b.total++
+	if latency > m.cfg.SlowThreshold {
+		b.slow++
+	}
+	if isHealthError(err) {
+		b.errors++
+	}
+}
+
+// HealthSnapshot summarizes the operations in the current window.
+type HealthSnapshot struct {
+	Total    int  `json:"total"`
+	Slow     int  `json:"slow"`
+	Errors   int  `json:"errors"`
+	Degraded bool `json:"degraded"`
+}
+
+// Snapshot returns the counts of the current window.
+func (m *HealthMonitor) Snapshot() HealthSnapshot {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := time.Now()
+	snap := HealthSnapshot{}
+	for _, b := range m.buckets {
+		if now.Sub(b.start) >= m.cfg.Window {
+			continue
+		}
+		snap.Total += b.total
+		snap.Slow += b.slow
+		snap.Errors += b.errors
+	}
+	if snap.Total >= m.cfg.MinSamples {
+		snap.Degraded = float64(snap.Slow)/float64(snap.Total) > m.cfg.MaxSlowRatio ||
+			float64(snap.Errors)/float64(snap.Total) > m.cfg.MaxErrorRatio
+	}
+	return snap
+}
+
+// Degraded reports whether Mongo is currently too slow or failing too often.
+func (m *HealthMonitor) Degraded() bool {
+	return m.Snapshot().Degraded
+}
+
+// ShedRule selects requests to reject while Mongo is degraded.
+type ShedRule struct {
+	// Match selects the requests the rule applies to, e.g. PathPrefix("/reports").
+	Match func(r *http.Request) bool
+	// StatusCode is returned to matched requests, usually 429 or 503.
+	StatusCode int
+	// RetryAfter is sent as the Retry-After header when set.
+	RetryAfter time.Duration
+}
+
+// PathPrefix returns a ShedRule matcher for requests whose path starts with one of prefixes.
+func PathPrefix(prefixes ...string) func(r *http.Request) bool {
+	return func(r *http.Request) bool {
+		for _, p := range prefixes {
+			if strings.HasPrefix(r.URL.Path, p) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// Middleware rejects requests matched by one of rules while the monitor is degraded, with
+// the status code of the first matching rule. Other requests are always served.
+func (m *HealthMonitor) Middleware(next http.Handler, rules ...ShedRule) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if m.Degraded() {
+			for _, rule := range rules {
+				if !rule.Match(r) {
+					continue
+				}
+				logDecision(opentracing.SpanFromContext(r.Context()), DecisionShed,
+					"mongo degraded, status "+strconv.Itoa(rule.StatusCode))
+				if rule.RetryAfter > 0 {
+					w.Header().Set("Retry-After", strconv.Itoa(int(rule.RetryAfter.Seconds())))
+				}
+				w.WriteHeader(rule.StatusCode)
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// healthErrorCodes are the codes of the server errors that say it's overloaded or failing
+// over: ExceededTimeLimit, WriteConcernFailed (a wtimeout), NetworkTimeout, ShutdownInProgress,
+// PrimarySteppedDown, InterruptedAtShutdown, InterruptedDueToReplStateChange, NotMaster and
+// NotMasterNoSlaveOk.
+var healthErrorCodes = map[int]bool{
+	50: true, 64: true, 89: true, 91: true, 189: true, 11600: true, 11602: true, 10107: true,
+	13435: true,
+}
+
+// isHealthError reports whether err says something about the health of the database: a
+// failure to reach it, a timeout, or a server error in healthErrorCodes. The other errors
+// are normal outcomes of the operation (not found, duplicate key, a failed validation), or
+// rejections by the wrappers themselves.
+func isHealthError(err error) bool {
+	if err == nil || errors.Is(err, ErrClientDisconnected) {
+		// the client's sockets were closed by the request, not by the server
+		return false
+	}
+	if IsNetworkError(err) {
+		return true
+	}
+	if IsTimeout(err) {
+		// but the iterations cut short by the wrappers, as the request ran out of time
+		return !errors.Is(err, ErrBudgetExpired)
+	}
+	var qerr *mgo.QueryError
+	var lerr *mgo.LastError
+	var berr *mgo.BulkError
+	switch {
+	case errors.As(err, &qerr):
+		return healthErrorCodes[qerr.Code]
+	case errors.As(err, &lerr):
+		return healthErrorCodes[lerr.Code] || lerr.WTimeout
+	case errors.As(err, &berr):
+		for _, c := range berr.Cases() {
+			if isHealthError(c.Err) {
+				return true
+			}
+		}
+	}
+	return false
+}
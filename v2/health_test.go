@@ -0,0 +1,89 @@
+package mgohttp
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	mgo "gopkg.in/mgo.v2"
+)
+
+func TestHealthMonitor(t *testing.T) {
+	m := NewHealthMonitor(HealthMonitorConfig{MinSamples: 10, SlowThreshold: 100 * time.Millisecond})
+	for i := 0; i < 9; i++ {
+		m.Observe(time.Second, errors.New("no reachable servers"))
+	}
+	assert.False(t, m.Degraded(), "not enough samples")
+
+	m.Observe(time.Millisecond, nil)
+	assert.True(t, m.Degraded())
+	assert.Equal(t, HealthSnapshot{Total: 10, Slow: 9, Errors: 9, Degraded: true}, m.Snapshot())
+
+	healthy := NewHealthMonitor(HealthMonitorConfig{MinSamples: 10})
+	for i := 0; i < 10; i++ {
+		// not found and duplicates are normal outcomes, not a sign of an unhealthy database
+		healthy.Observe(time.Millisecond, mgo.ErrNotFound)
+		healthy.Observe(time.Millisecond, &mgo.LastError{Code: 11000})
+		// nor are the writes the server rejects, e.g. failing validation or changing _id
+		healthy.Observe(time.Millisecond, &mgo.LastError{Code: 121})
+		healthy.Observe(time.Millisecond, &mgo.LastError{Code: 66})
+		// nor are the operations a request runs over its query budget
+		healthy.Observe(time.Millisecond, QueryBudgetExceededError{Op: "find", Collection: "users", Max: 2})
+	}
+	assert.False(t, healthy.Degraded())
+
+	// a window too short to divide into buckets is stretched to one nanosecond per bucket
+	short := NewHealthMonitor(HealthMonitorConfig{Window: time.Nanosecond})
+	assert.Equal(t, 10*time.Nanosecond, short.cfg.Window)
+	assert.NotPanics(t, func() { short.Observe(time.Millisecond, nil) })
+}
+
+func TestIsHealthError(t *testing.T) {
+	for _, err := range []error{
+		io.EOF,
+		errors.New("no reachable servers"),
+		&mgo.QueryError{Code: 50, Message: "operation exceeded time limit"},
+		&mgo.LastError{Code: 91, Err: "interrupted at shutdown"},
+		&mgo.LastError{Code: 100, WTimeout: true},
+		RequestAbortedError{Cause: ErrRequestTimeout, Err: io.EOF},
+	} {
+		assert.True(t, isHealthError(err), "%v", err)
+	}
+	for _, err := range []error{
+		nil,
+		mgo.ErrNotFound,
+		&mgo.QueryError{Code: 2, Message: "bad query"},
+		&mgo.LastError{Code: 121, Err: "Document failed validation"},
+		errors.New("some other error"),
+		RequestAbortedError{Cause: ErrClientDisconnected, Err: io.EOF},
+		ErrBudgetExpired,
+		ErrCollectionDisabled,
+	} {
+		assert.False(t, isHealthError(err), "%v", err)
+	}
+}
+
+func TestHealthMonitorMiddleware(t *testing.T) {
+	m := NewHealthMonitor(HealthMonitorConfig{MinSamples: 1})
+	handler := m.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}), ShedRule{Match: PathPrefix("/reports"), StatusCode: http.StatusTooManyRequests, RetryAfter: 5 * time.Second})
+
+	serve := func(path string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest("GET", path, nil))
+		return rec
+	}
+
+	assert.Equal(t, http.StatusOK, serve("/reports/1").Code)
+
+	m.Observe(time.Millisecond, io.EOF)
+	rec := serve("/reports/1")
+	assert.Equal(t, http.StatusTooManyRequests, rec.Code)
+	assert.Equal(t, "5", rec.Header().Get("Retry-After"))
+	assert.Equal(t, http.StatusOK, serve("/accounts/1").Code, "only matched routes are shed")
+}
@@ -0,0 +1,95 @@
+package mgohttp
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	mgo "gopkg.in/mgo.v2"
+)
+
+// HealthHandlerOptions configures the handler returned by NewHealthHandler.
+type HealthHandlerOptions struct {
+	// Timeout bounds each check, so a health check never hangs on an unreachable server.
+	// Defaults to 2s.
+	Timeout time.Duration
+	// Monitor, when set, adds the operation counts of the HealthMonitor to the report. It
+	// doesn't change the status: a degraded database still answers pings.
+	Monitor *HealthMonitor
+}
+
+// HealthReport is the JSON body written by the handler returned by NewHealthHandler.
+type HealthReport struct {
+	// Status is "ok" when the server answered the ping, "unavailable" otherwise.
+	Status string `json:"status"`
+	// Error is why the ping failed.
+	Error string `json:"error,omitempty"`
+	// LatencyMillis is the round trip time of the ping.
+	LatencyMillis float64 `json:"latency_ms"`
+	// Address, State and ReplicaSet describe the server that answered, see PingInfo.
+	Address    string `json:"address,omitempty"`
+	State      string `json:"state,omitempty"`
+	ReplicaSet string `json:"replica_set,omitempty"`
+	// Operations is the snapshot of HealthHandlerOptions.Monitor, if set.
+	Operations *HealthSnapshot `json:"operations,omitempty"`
+}
+
+// NewHealthHandler returns a handler that pings Mongo on a copy of sess and reports the
+// outcome as a HealthReport, with status 200 when the server answered and 503 otherwise. It's
+// meant to be mounted on e.g. /healthz, outside of the SessionHandler.
+func NewHealthHandler(sess *mgo.Session, opts HealthHandlerOptions) http.Handler {
+	if opts.Timeout <= 0 {
+		opts.Timeout = 2 * time.Second
+	}
+	return healthHandler{
+		opts: opts,
+		ping: func() (PingInfo, error) {
+			copied := sess.Copy()
+			defer copied.Close()
+			copied.SetSocketTimeout(opts.Timeout)
+			return pingWithInfo(copied)
+		},
+	}
+}
+
+type healthHandler struct {
+	opts HealthHandlerOptions
+	ping func() (PingInfo, error)
+}
+
+func (h healthHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), h.opts.Timeout)
+	defer cancel()
+
+	infos := make(chan PingInfo, 1)
+	start := time.Now()
+	err := runWithContext(ctx, func() error {
+		info, err := h.ping()
+		infos <- info
+		return err
+	})
+	report := HealthReport{Status: "ok"}
+	status := http.StatusOK
+	if err != nil {
+		report.Status = "unavailable"
+		report.Error = err.Error()
+		report.LatencyMillis = float64(time.Since(start).Microseconds()) / 1000
+		status = http.StatusServiceUnavailable
+	} else {
+		info := <-infos
+		report.LatencyMillis = float64(info.RTT.Microseconds()) / 1000
+		report.Address = info.Address
+		report.State = info.State
+		report.ReplicaSet = info.ReplicaSet
+	}
+	if h.opts.Monitor != nil {
+		snap := h.opts.Monitor.Snapshot()
+		report.Operations = &snap
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(report)
+}
@@ -0,0 +1,64 @@
+package mgohttp
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func serveHealth(t *testing.T, h healthHandler) (int, HealthReport) {
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("GET", "/healthz", nil))
+	var report HealthReport
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&report))
+	assert.Equal(t, "application/json", rec.Header().Get("Content-Type"))
+	return rec.Code, report
+}
+
+func TestHealthHandler(t *testing.T) {
+	monitor := NewHealthMonitor(HealthMonitorConfig{})
+	monitor.Observe(time.Millisecond, nil)
+	code, report := serveHealth(t, healthHandler{
+		opts: HealthHandlerOptions{Timeout: time.Second, Monitor: monitor},
+		ping: func() (PingInfo, error) {
+			return PingInfo{RTT: 1500 * time.Microsecond, Address: "db1:27017", State: "primary", ReplicaSet: "rs0"}, nil
+		},
+	})
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, HealthReport{
+		Status:        "ok",
+		LatencyMillis: 1.5,
+		Address:       "db1:27017",
+		State:         "primary",
+		ReplicaSet:    "rs0",
+		Operations:    &HealthSnapshot{Total: 1},
+	}, report)
+}
+
+func TestHealthHandlerUnavailable(t *testing.T) {
+	code, report := serveHealth(t, healthHandler{
+		opts: HealthHandlerOptions{Timeout: time.Second},
+		ping: func() (PingInfo, error) { return PingInfo{}, errors.New("no reachable servers") },
+	})
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Equal(t, "unavailable", report.Status)
+	assert.Equal(t, "no reachable servers", report.Error)
+
+	release := make(chan struct{})
+	defer close(release)
+	code, report = serveHealth(t, healthHandler{
+		opts: HealthHandlerOptions{Timeout: 10 * time.Millisecond},
+		ping: func() (PingInfo, error) {
+			<-release
+			return PingInfo{}, nil
+		},
+	})
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Equal(t, "context deadline exceeded", report.Error)
+}
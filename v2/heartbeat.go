@@ -0,0 +1,59 @@
+package mgohttp
+
+import (
+	"context"
+	"time"
+
+	opentracing "github.com/opentracing/opentracing-go"
+	opentracinglog "github.com/opentracing/opentracing-go/log"
+	"gopkg.in/Clever/kayvee-go.v6/logger"
+)
+
+// EventIterHeartbeat is the span event logged by the heartbeats of long iterations, see
+// SessionHandlerConfig.IterationHeartbeat.
+const EventIterHeartbeat = "iter-heartbeat"
+
+// iterHeartbeat tracks the progress of a cursor to log it at regular intervals.
+type iterHeartbeat struct {
+	every time.Duration
+	start time.Time
+	next  time.Time
+	docs  int64
+}
+
+// newIterHeartbeat returns the heartbeat of a cursor opened now, or nil when the handler
+// doesn't log heartbeats.
+func newIterHeartbeat(ctx context.Context) *iterHeartbeat {
+	h := handlerFromContext(ctx)
+	if h == nil || h.cfg.IterationHeartbeat <= 0 {
+		return nil
+	}
+	now := time.Now()
+	return &iterHeartbeat{every: h.cfg.IterationHeartbeat, start: now, next: now.Add(h.cfg.IterationHeartbeat)}
+}
+
+// read counts a document read by the cursor of the query of collection with fingerprint, and
+// logs a heartbeat on the cursor's span, in ctx, if one is due.
+func (hb *iterHeartbeat) read(ctx context.Context, collection, fingerprint string) {
+	if hb == nil {
+		return
+	}
+	hb.docs++
+	now := time.Now()
+	if now.Before(hb.next) {
+		return
+	}
+	hb.next = now.Add(hb.every)
+	elapsed := now.Sub(hb.start).Milliseconds()
+	opentracing.SpanFromContext(ctx).LogFields(
+		opentracinglog.String("event", EventIterHeartbeat),
+		opentracinglog.Int64(LogIterDocs, hb.docs),
+		opentracinglog.Int64(LogIterElapsedMillis, elapsed),
+	)
+	logger.FromContext(ctx).InfoD("mgohttp-iteration-heartbeat", logger.M{
+		"collection":  collection,
+		"fingerprint": fingerprint,
+		"docs":        hb.docs,
+		"elapsed-ms":  elapsed,
+	})
+}
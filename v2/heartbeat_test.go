@@ -0,0 +1,42 @@
+package mgohttp
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	opentracing "github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/mocktracer"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIterHeartbeat(t *testing.T) {
+	assert.Nil(t, newIterHeartbeat(context.Background()))
+	assert.Nil(t, newIterHeartbeat(context.WithValue(context.Background(), handlerKey, &SessionHandler{})))
+
+	tracer := mocktracer.New()
+	sp := tracer.StartSpan("iter")
+	ctx := context.WithValue(context.Background(), handlerKey, &SessionHandler{cfg: SessionHandlerConfig{IterationHeartbeat: 20 * time.Millisecond}})
+	ctx = opentracing.ContextWithSpan(ctx, sp)
+	it := tracedMongoIter{ctx: ctx, collection: "events", heartbeat: newIterHeartbeat(ctx)}
+	require.NotNil(t, it.heartbeat)
+
+	// reads within the interval don't log anything
+	it.heartbeat.read(it.ctx, it.collection, it.fingerprint)
+	it.heartbeat.read(it.ctx, it.collection, it.fingerprint)
+	time.Sleep(30 * time.Millisecond)
+	it.heartbeat.read(it.ctx, it.collection, it.fingerprint)
+	it.heartbeat.read(it.ctx, it.collection, it.fingerprint)
+	sp.Finish()
+
+	logs := tracer.FinishedSpans()[0].Logs()
+	require.Len(t, logs, 1)
+	fields := map[string]interface{}{}
+	for _, f := range logs[0].Fields {
+		fields[f.Key] = f.ValueString
+	}
+	assert.Equal(t, EventIterHeartbeat, fields["event"])
+	assert.Equal(t, "3", fields[LogIterDocs])
+	assert.NotEmpty(t, fields[LogIterElapsedMillis])
+}
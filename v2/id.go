@@ -0,0 +1,50 @@
+package mgohttp
+
+import (
+	"errors"
+	"fmt"
+
+	bson "gopkg.in/mgo.v2/bson"
+)
+
+// ErrInvalidID is the sentinel wrapped by every InvalidIDError.
+var ErrInvalidID = errors.New("invalid object id")
+
+// InvalidIDError is returned by ParseID for a string that isn't the hex representation of an
+// ObjectId.
+type InvalidIDError struct {
+	ID string
+}
+
+func (e InvalidIDError) Error() string {
+	return fmt.Sprintf("mgohttp: %q: %s", e.ID, ErrInvalidID)
+}
+
+// Unwrap allows errors.Is(err, ErrInvalidID).
+func (e InvalidIDError) Unwrap() error {
+	return ErrInvalidID
+}
+
+// ParseID parses the hex representation of an ObjectId, e.g. from a URL. Unlike
+// bson.ObjectIdHex, it returns an InvalidIDError rather than panicking on user input.
+func ParseID(s string) (bson.ObjectId, error) {
+	if !bson.IsObjectIdHex(s) {
+		return "", InvalidIDError{ID: s}
+	}
+	return bson.ObjectIdHex(s), nil
+}
+
+// IsValidID is whether s is the hex representation of an ObjectId.
+func IsValidID(s string) bool {
+	return bson.IsObjectIdHex(s)
+}
+
+// normalizeID converts id from its hex representation, when the handler is configured to and
+// id was built from a hex string with bson.ObjectId(s) rather than parsed.
+func (tc tracedMgoCollection) normalizeID(id bson.ObjectId) bson.ObjectId {
+	h := handlerFromContext(tc.ctx)
+	if h == nil || !h.cfg.ConvertHexIDs || !bson.IsObjectIdHex(string(id)) {
+		return id
+	}
+	return bson.ObjectIdHex(string(id))
+}
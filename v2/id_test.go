@@ -0,0 +1,36 @@
+package mgohttp
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	bson "gopkg.in/mgo.v2/bson"
+)
+
+func TestParseID(t *testing.T) {
+	id := bson.NewObjectId()
+	parsed, err := ParseID(id.Hex())
+	require.NoError(t, err)
+	assert.Equal(t, id, parsed)
+	assert.True(t, IsValidID(id.Hex()))
+
+	for _, s := range []string{"", "nope", id.Hex()[1:], string(id)} {
+		_, err := ParseID(s)
+		assert.True(t, errors.Is(err, ErrInvalidID), s)
+		assert.Equal(t, InvalidIDError{ID: s}, err)
+		assert.False(t, IsValidID(s))
+	}
+}
+
+func TestConvertHexIDs(t *testing.T) {
+	id := bson.NewObjectId()
+	c := tracedMgoCollection{ctx: context.WithValue(context.Background(), handlerKey, &SessionHandler{cfg: SessionHandlerConfig{ConvertHexIDs: true}})}
+	assert.Equal(t, id, c.normalizeID(bson.ObjectId(id.Hex())))
+	assert.Equal(t, id, c.normalizeID(id))
+
+	c.ctx = context.WithValue(context.Background(), handlerKey, &SessionHandler{})
+	assert.Equal(t, bson.ObjectId(id.Hex()), c.normalizeID(bson.ObjectId(id.Hex())))
+}
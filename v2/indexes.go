@@ -0,0 +1,98 @@
+package mgohttp
+
+import (
+	"strings"
+
+	opentracinglog "github.com/opentracing/opentracing-go/log"
+	mgo "gopkg.in/mgo.v2"
+)
+
+// indexFields describes the key and options of index for the span.
+func indexFields(index mgo.Index) []opentracinglog.Field {
+	fields := []opentracinglog.Field{
+		opentracinglog.String(LogIndexKey, strings.Join(index.Key, "|")),
+	}
+	if index.Name != "" {
+		fields = append(fields, opentracinglog.String(LogIndexName, index.Name))
+	}
+	if index.Unique {
+		fields = append(fields, opentracinglog.Bool(LogIndexUnique, true))
+	}
+	if index.Sparse {
+		fields = append(fields, opentracinglog.Bool(LogIndexSparse, true))
+	}
+	if index.Background {
+		fields = append(fields, opentracinglog.Bool(LogIndexBackground, true))
+	}
+	if index.ExpireAfter > 0 {
+		fields = append(fields, opentracinglog.String(LogIndexExpireAfter, index.ExpireAfter.String()))
+	}
+	return fields
+}
+
+func (tc tracedMgoCollection) EnsureIndex(index mgo.Index) (err error) {
+	recordUsage("MongoCollection.EnsureIndex")
+	sp, _ := startOp(tc.ctx, "ensure-index", tc.collectionName)
+	defer sp.Finish()
+	defer sp.recoverPanic(&err)
+	if err := tc.guard(sp, nil); err != nil {
+		sp.LogFields(indexFields(index)...)
+		return logAndReturnErr(sp, err)
+	}
+	release, err := tc.applyIndexPolicy(sp, &index)
+	sp.LogFields(indexFields(index)...)
+	if err != nil {
+		return logAndReturnErr(sp, err)
+	}
+	defer release()
+
+	return sp.done(sp.intercept(OpInfo{}, func(*OpInfo) error { return tc.collection.EnsureIndex(index) }))
+}
+
+func (tc tracedMgoCollection) EnsureIndexKey(key ...string) error {
+	recordUsage("MongoCollection.EnsureIndexKey")
+	return tc.EnsureIndex(mgo.Index{Key: key})
+}
+
+func (tc tracedMgoCollection) DropIndex(key ...string) (err error) {
+	recordUsage("MongoCollection.DropIndex")
+	sp, _ := startOp(tc.ctx, "drop-index", tc.collectionName)
+	defer sp.Finish()
+	defer sp.recoverPanic(&err)
+	sp.LogFields(opentracinglog.String(LogIndexKey, strings.Join(key, "|")))
+	if err := tc.guard(sp, nil); err != nil {
+		return logAndReturnErr(sp, err)
+	}
+
+	return sp.done(sp.intercept(OpInfo{}, func(*OpInfo) error { return tc.collection.DropIndex(key...) }))
+}
+
+func (tc tracedMgoCollection) DropIndexName(name string) (err error) {
+	recordUsage("MongoCollection.DropIndexName")
+	sp, _ := startOp(tc.ctx, "drop-index", tc.collectionName)
+	defer sp.Finish()
+	defer sp.recoverPanic(&err)
+	sp.LogFields(opentracinglog.String(LogIndexName, name))
+	if err := tc.guard(sp, nil); err != nil {
+		return logAndReturnErr(sp, err)
+	}
+
+	return sp.done(sp.intercept(OpInfo{}, func(*OpInfo) error { return tc.collection.DropIndexName(name) }))
+}
+
+func (tc tracedMgoCollection) Indexes() (indexes []mgo.Index, err error) {
+	recordUsage("MongoCollection.Indexes")
+	sp, _ := startOp(tc.ctx, "indexes", tc.collectionName)
+	defer sp.Finish()
+	defer sp.recoverPanic(&err)
+	if err := tc.guard(sp, nil); err != nil {
+		return nil, logAndReturnErr(sp, err)
+	}
+
+	err = sp.intercept(OpInfo{}, func(*OpInfo) (err error) {
+		indexes, err = tc.collection.Indexes()
+		return err
+	})
+	sp.LogFields(opentracinglog.Int(LogNumIndexes, len(indexes)))
+	return indexes, sp.done(err)
+}
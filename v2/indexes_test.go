@@ -0,0 +1,110 @@
+package mgohttp
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	opentracing "github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/mocktracer"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	mgo "gopkg.in/mgo.v2"
+)
+
+func TestEnsureIndexLogsKeyAndOptions(t *testing.T) {
+	DisableCollection(testDBName, "events")
+	defer EnableCollection(testDBName, "events")
+
+	tracer := mocktracer.New()
+	opentracing.SetGlobalTracer(tracer)
+	defer opentracing.SetGlobalTracer(opentracing.NoopTracer{})
+	c := tracedMgoCollection{
+		collectionName: "events",
+		collection:     &mgo.Collection{Name: "events", Database: &mgo.Database{Name: testDBName}},
+		ctx:            context.Background(),
+	}
+
+	err := c.EnsureIndex(mgo.Index{Key: []string{"org", "-created"}, Unique: true, ExpireAfter: time.Hour})
+	assert.True(t, errors.Is(err, ErrCollectionDisabled))
+
+	spans := tracer.FinishedSpans()
+	require.Len(t, spans, 1)
+	assert.Equal(t, "ensure-index", spans[0].OperationName)
+	logged := map[string]string{}
+	for _, record := range spans[0].Logs() {
+		for _, field := range record.Fields {
+			logged[field.Key] = field.ValueString
+		}
+	}
+	assert.Equal(t, "org|-created", logged[LogIndexKey])
+	assert.Equal(t, "true", logged[LogIndexUnique])
+	assert.Equal(t, "1h0m0s", logged[LogIndexExpireAfter])
+	assert.NotContains(t, logged, LogIndexSparse)
+}
+
+func indexPolicyTestCollection(policy *IndexPolicy, tracer opentracing.Tracer) tracedMgoCollection {
+	h := &SessionHandler{cfg: SessionHandlerConfig{IndexPolicy: policy, Tracer: tracer, RecoverDriverPanics: true}}
+	return tracedMgoCollection{
+		collectionName: "events",
+		collection: &mgo.Collection{Name: "events", Database: &mgo.Database{
+			Name:    testDBName,
+			Session: &mgo.Session{},
+		}},
+		ctx: context.WithValue(context.Background(), handlerKey, h),
+	}
+}
+
+func TestIndexPolicyDeferToStartup(t *testing.T) {
+	tracer := mocktracer.New()
+	c := indexPolicyTestCollection(&IndexPolicy{DeferToStartup: true}, tracer)
+	err := c.EnsureIndexKey("org")
+	assert.True(t, errors.Is(err, ErrIndexBuildDeferred))
+	assert.Equal(t, IndexBuildDeferredError{Collection: "events", Key: []string{"org"}}, err)
+
+	spans := tracer.FinishedSpans()
+	require.Len(t, spans, 1)
+	assert.Equal(t, true, spans[0].Tag(TagIndexBuildDeferred))
+}
+
+func TestIndexPolicyForcesBackground(t *testing.T) {
+	tracer := mocktracer.New()
+	c := indexPolicyTestCollection(&IndexPolicy{}, tracer)
+	// the session isn't connected, so the build fails with a DriverPanicError
+	assert.True(t, errors.Is(c.EnsureIndexKey("org"), ErrDriverPanic))
+
+	spans := tracer.FinishedSpans()
+	require.Len(t, spans, 1)
+	assert.Equal(t, true, spans[0].Tag(TagIndexForcedBackground))
+	logged := map[string]string{}
+	for _, record := range spans[0].Logs() {
+		for _, field := range record.Fields {
+			logged[field.Key] = field.ValueString
+		}
+	}
+	assert.Equal(t, "true", logged[LogIndexBackground])
+
+	tracer.Reset()
+	c = indexPolicyTestCollection(&IndexPolicy{AllowForeground: true}, tracer)
+	c.EnsureIndexKey("org")
+	spans = tracer.FinishedSpans()
+	require.Len(t, spans, 1)
+	assert.Nil(t, spans[0].Tag(TagIndexForcedBackground))
+}
+
+func TestIndexPolicyMaxConcurrentBuilds(t *testing.T) {
+	p := &IndexPolicy{MaxConcurrentBuilds: 1}
+	release, err := p.acquire(context.Background())
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err = p.acquire(ctx)
+	assert.Equal(t, context.DeadlineExceeded, err)
+
+	release()
+	release, err = p.acquire(context.Background())
+	require.NoError(t, err)
+	release()
+}
@@ -0,0 +1,102 @@
+package mgohttp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	opentracing "github.com/opentracing/opentracing-go"
+	mgo "gopkg.in/mgo.v2"
+)
+
+// ErrIndexBuildDeferred is the sentinel wrapped by every IndexBuildDeferredError.
+var ErrIndexBuildDeferred = errors.New("index builds are deferred to startup")
+
+// IndexBuildDeferredError is returned by EnsureIndex during a request when the IndexPolicy
+// defers index builds to startup.
+type IndexBuildDeferredError struct {
+	Collection string
+	Key        []string
+}
+
+func (e IndexBuildDeferredError) Error() string {
+	return fmt.Sprintf("mgohttp: %s %s: %s", e.Collection, strings.Join(e.Key, "|"), ErrIndexBuildDeferred)
+}
+
+// Unwrap allows errors.Is(err, ErrIndexBuildDeferred).
+func (e IndexBuildDeferredError) Unwrap() error {
+	return ErrIndexBuildDeferred
+}
+
+// IndexPolicy guards the index builds started with MongoCollection.EnsureIndex during
+// requests, so a deploy can't block a large collection with a foreground build.
+type IndexPolicy struct {
+	// AllowForeground lets builds run in the foreground when the index asks for it. Otherwise
+	// every build is forced to run in the background.
+	AllowForeground bool
+	// DeferToStartup rejects EnsureIndex during requests with an IndexBuildDeferredError.
+	// The indexes are then built before serving, e.g. with EnsureIndexes.
+	DeferToStartup bool
+	// MaxConcurrentBuilds, when set, limits the builds running at once across the handler's
+	// requests. Further builds wait for one to finish, or until the request is done.
+	MaxConcurrentBuilds int
+
+	once  sync.Once
+	slots chan struct{}
+}
+
+// acquire waits for a build slot, and returns the function releasing it.
+func (p *IndexPolicy) acquire(ctx context.Context) (func(), error) {
+	if p.MaxConcurrentBuilds <= 0 {
+		return func() {}, nil
+	}
+	p.once.Do(func() { p.slots = make(chan struct{}, p.MaxConcurrentBuilds) })
+	select {
+	case p.slots <- struct{}{}:
+		return func() { <-p.slots }, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// applyIndexPolicy applies the handler's IndexPolicy to index before it's built. The returned
+// function releases the build slot once the build is over.
+func (tc tracedMgoCollection) applyIndexPolicy(sp opentracing.Span, index *mgo.Index) (func(), error) {
+	h := handlerFromContext(tc.ctx)
+	if h == nil || h.cfg.IndexPolicy == nil {
+		return func() {}, nil
+	}
+	p := h.cfg.IndexPolicy
+	if p.DeferToStartup {
+		sp.SetTag(TagIndexBuildDeferred, true)
+		return nil, IndexBuildDeferredError{Collection: tc.collectionName, Key: index.Key}
+	}
+	if !p.AllowForeground && !index.Background {
+		sp.SetTag(TagIndexForcedBackground, true)
+		index.Background = true
+	}
+	return p.acquire(tc.ctx)
+}
+
+// EnsureIndexes builds indexes, by collection, in the background on database, one at a time.
+// It's meant to run at startup, before serving requests, with IndexPolicy.DeferToStartup.
+func EnsureIndexes(sess *mgo.Session, database string, indexes map[string][]mgo.Index) error {
+	collections := make([]string, 0, len(indexes))
+	for collection := range indexes {
+		collections = append(collections, collection)
+	}
+	sort.Strings(collections)
+	db := sess.DB(database)
+	for _, collection := range collections {
+		for _, index := range indexes[collection] {
+			index.Background = true
+			if err := db.C(collection).EnsureIndex(index); err != nil {
+				return fmt.Errorf("mgohttp: ensuring index %s on %s: %w", strings.Join(index.Key, "|"), collection, err)
+			}
+		}
+	}
+	return nil
+}
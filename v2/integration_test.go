@@ -0,0 +1,787 @@
+//go:build integration
+
+package mgohttp_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Clever/mgohttp/v2"
+	"github.com/Clever/mgohttp/v2/mgohttptest"
+	"github.com/opentracing/opentracing-go/mocktracer"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	driverbson "go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	mgo "gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// The tests in this file run against a real server, at MONGO_URL or else
+// mgohttptest.DefaultMongoURL:
+//
+//	go test -tags integration ./...
+//
+// They're meant to pass against every supported version, MongoDB 3.2 through 4.4 on mgo, and
+// later ones on the official driver, by probing the server and skipping what it doesn't
+// support rather than failing.
+
+const (
+	testDBName        = "mgohttp-test"
+	handlerTimeout    = 50 * time.Millisecond
+	testingStatusCode = http.StatusTeapot
+	sleepCollection   = "sleep"
+	// mgoMaxWireVersion is the wire version of MongoDB 5.0, the last server mgo can run
+	// commands on: later ones dropped the OP_QUERY opcode it sends them with, and are only
+	// supported through NewMongoDriver.
+	mgoMaxWireVersion = 13
+)
+
+// dialTestMongo connects to the test server and returns its build info.
+func dialTestMongo(t *testing.T) (*mgo.Session, mgo.BuildInfo) {
+	url := os.Getenv("MONGO_URL")
+	if url == "" {
+		url = mgohttptest.DefaultMongoURL + "/mgosessionpool-test"
+	}
+	session, err := mgo.Dial(url)
+	require.NoError(t, err)
+	// isMaster is the one command the later servers still take from mgo
+	var hello struct {
+		MaxWireVersion int `bson:"maxWireVersion"`
+	}
+	require.NoError(t, session.Run("isMaster", &hello))
+	if hello.MaxWireVersion > mgoMaxWireVersion {
+		session.Close()
+		t.Skipf("mgo doesn't support MongoDB 5.1 and later (wire version %d)", hello.MaxWireVersion)
+	}
+	info, err := session.BuildInfo()
+	require.NoError(t, err)
+	t.Logf("testing against MongoDB %s", info.Version)
+	return session, info
+}
+
+// requireServerFeature skips the test on servers that don't support f.
+func requireServerFeature(t *testing.T, info mgo.BuildInfo, f mgohttp.ServerFeature) {
+	if !f.SupportedBy(info) {
+		t.Skipf("MongoDB %s doesn't support %s", info.Version, f.Name)
+	}
+}
+
+// requireServerJavaScript skips the test when server-side JavaScript, which
+// mgohttptest.SlowSelector relies on, is disabled. It also seeds the collection SlowSelector
+// runs against.
+func requireServerJavaScript(t *testing.T, session *mgo.Session) {
+	c := session.DB("test").C(sleepCollection)
+	require.NoError(t, mgohttptest.EnsureDocument(c))
+	if err := c.Find(mgohttptest.SlowSelector(0)).One(&bson.M{}); err != nil {
+		t.Skipf("server-side JavaScript is unavailable: %s", err)
+	}
+}
+
+func TestMongoSessionInjector(t *testing.T) {
+	session, _ := dialTestMongo(t)
+	defer session.Close()
+	requireServerJavaScript(t, session)
+
+	testCases := []struct {
+		desc       string
+		handler    http.HandlerFunc
+		assertions func(*testing.T, *http.Response)
+	}{
+		{
+			desc: "simple ping twice",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				sess := mgohttp.FromContext(r.Context(), testDBName)
+				if sess.Ping() != nil {
+					w.WriteHeader(http.StatusInternalServerError)
+					return
+				}
+
+				sess2 := mgohttp.FromContext(r.Context(), testDBName)
+				if sess2.Ping() != nil {
+					w.WriteHeader(http.StatusInternalServerError)
+					return
+				}
+
+				w.WriteHeader(http.StatusOK)
+			},
+			assertions: func(t *testing.T, resp *http.Response) {
+				// we expect to finish both of our queries just fine
+				assert.Equal(t, http.StatusOK, resp.StatusCode)
+			},
+		},
+		{
+			desc: "endpoint timeout for single query",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				sess := mgohttp.FromContext(r.Context(), testDBName)
+				// try to sleep for 10sec
+				err := sess.DB("test").C(sleepCollection).Find(mgohttptest.SlowSelector(10 * time.Second)).One(&bson.M{})
+				if err != nil {
+					// NOTE: using 500 to differentiate from the injector's 503's
+					w.WriteHeader(http.StatusInternalServerError)
+					return
+				}
+				// this should not be reached
+				w.WriteHeader(http.StatusOK)
+			},
+			assertions: func(t *testing.T, resp *http.Response) {
+				// we expect our query to time out and receive the error from the session handler
+				assert.Equal(t, testingStatusCode, resp.StatusCode)
+			},
+		},
+		{
+			desc: "endpoint timeout with many queries",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				// try to small query many times
+				for i := 0; i < 1000; i++ {
+					sess := mgohttp.FromContext(r.Context(), testDBName)
+					err := sess.DB("test").C(sleepCollection).Find(mgohttptest.SlowSelector(10 * time.Millisecond)).One(&bson.M{})
+					if err != nil {
+						// NOTE: using 500 to differentiate from the injector's 503's
+						w.WriteHeader(http.StatusInternalServerError)
+						return
+					}
+				}
+				// this should not be reached
+				w.WriteHeader(http.StatusOK)
+			},
+			assertions: func(t *testing.T, resp *http.Response) {
+				// we expect our queries to time out and receive the error from the session handler
+				assert.Equal(t, testingStatusCode, resp.StatusCode)
+			},
+		},
+		{
+			desc: "handler wrapped in http.TimeoutHandler",
+			handler: http.TimeoutHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				sess := mgohttp.FromContext(r.Context(), testDBName)
+				// try to sleep for 10sec
+				err := sess.DB("test").C(sleepCollection).Find(mgohttptest.SlowSelector(10 * time.Second)).One(&bson.M{})
+				if err != nil {
+					// NOTE: using 500 to differentiate from the injector's 503's
+					w.WriteHeader(http.StatusInternalServerError)
+					return
+				}
+				// this should not be reached
+				w.WriteHeader(http.StatusOK)
+			}), handlerTimeout, "timed out").ServeHTTP,
+			assertions: func(t *testing.T, resp *http.Response) {
+				// we expect our query to timeout, this just checks that we're fully compatible
+				// with http.TimeoutHandler
+				assert.Equal(t, testingStatusCode, resp.StatusCode)
+			},
+		},
+		{
+			desc: "a stricter http.TimeoutHandler will supercede us",
+			handler: http.TimeoutHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				sess := mgohttp.FromContext(r.Context(), testDBName)
+				// try to sleep for 10sec
+				err := sess.DB("test").C(sleepCollection).Find(mgohttptest.SlowSelector(10 * time.Second)).One(&bson.M{})
+				if err != nil {
+					// NOTE: using 500 to differentiate from the injector's 503's
+					w.WriteHeader(http.StatusInternalServerError)
+					return
+				}
+				// this should not be reached
+				w.WriteHeader(http.StatusOK)
+			}), handlerTimeout/2, "timed out").ServeHTTP,
+			assertions: func(t *testing.T, resp *http.Response) {
+				// after giving http.TimeoutHandler half the time window that we time out
+				// mgo session, we expect the TimeoutHandler to return early
+				assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+			},
+		},
+	}
+
+	for _, spec := range testCases {
+		t.Run(spec.desc, func(t *testing.T) {
+			injector := mgohttp.NewSessionHandler(mgohttp.SessionHandlerConfig{
+				Sess:     session,
+				Database: testDBName,
+				Timeout:  handlerTimeout,
+				Handler:  spec.handler,
+				// Override the error status code for testing. This allows us to
+				// differentiate between our error status code and the 503 from
+				// http.TimeoutHandler.
+				TimeoutStatus: testingStatusCode,
+			})
+
+			testServer := httptest.NewServer(injector)
+			defer testServer.Close()
+
+			resp, err := http.Get(testServer.URL)
+			require.NoError(t, err)
+			spec.assertions(t, resp)
+		})
+	}
+}
+
+func TestKillOpsOnTimeout(t *testing.T) {
+	session, _ := dialTestMongo(t)
+	defer session.Close()
+	requireServerJavaScript(t, session)
+
+	tracer := mocktracer.New()
+	injector := mgohttp.NewSessionHandler(mgohttp.SessionHandlerConfig{
+		Sess:     session,
+		Database: testDBName,
+		Timeout:  handlerTimeout,
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			sess := mgohttp.FromContext(r.Context(), testDBName)
+			sess.DB("test").C(sleepCollection).Find(mgohttptest.SlowSelector(10 * time.Second)).One(&bson.M{})
+		}),
+		Tracer:           tracer,
+		KillOpsOnTimeout: true,
+	})
+	testServer := httptest.NewServer(injector)
+	defer testServer.Close()
+
+	resp, err := http.Get(testServer.URL)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+
+	var comment interface{}
+	require.Eventually(t, func() bool {
+		for _, sp := range tracer.FinishedSpans() {
+			if sp.OperationName == "mgohttp" {
+				comment = sp.Tag(mgohttp.TagOpComment)
+				return true
+			}
+		}
+		return false
+	}, time.Second, 10*time.Millisecond)
+	require.NotNil(t, comment)
+
+	// the query would run for 10s, it's killed well before
+	assert.Eventually(t, func() bool {
+		var ops struct {
+			InProg []bson.M `bson:"inprog"`
+		}
+		err := session.DB("admin").Run(bson.D{
+			{Name: "currentOp", Value: 1},
+			{Name: "$or", Value: []bson.M{
+				{"query.$comment": comment},
+				{"query.comment": comment},
+				{"command.comment": comment},
+			}},
+		}, &ops)
+		return err == nil && len(ops.InProg) == 0
+	}, 2*time.Second, 50*time.Millisecond)
+}
+
+func TestServerFeatures(t *testing.T) {
+	session, info := dialTestMongo(t)
+	defer session.Close()
+	c := session.DB(testDBName).C("features")
+	require.NoError(t, mgohttptest.EnsureDocument(c))
+
+	run := func(t *testing.T, handler http.HandlerFunc) {
+		injector := mgohttp.NewSessionHandler(mgohttp.SessionHandlerConfig{
+			Sess:     session,
+			Database: testDBName,
+			Timeout:  time.Second,
+			Handler:  handler,
+		})
+		rec := httptest.NewRecorder()
+		injector.ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+		assert.Equal(t, http.StatusOK, rec.Code)
+	}
+	features := func(r *http.Request) mgohttp.MongoCollection {
+		return mgohttp.FromContext(r.Context(), testDBName).DB(testDBName).C("features")
+	}
+
+	t.Run("maxTimeMS", func(t *testing.T) {
+		requireServerFeature(t, info, mgohttp.FeatureMaxTimeMS)
+		run(t, func(w http.ResponseWriter, r *http.Request) {
+			assert.NoError(t, features(r).Find(nil).SetMaxTime(time.Second).One(&bson.M{}))
+		})
+	})
+	t.Run("collation", func(t *testing.T) {
+		requireServerFeature(t, info, mgohttp.FeatureCollation)
+		run(t, func(w http.ResponseWriter, r *http.Request) {
+			var docs []bson.M
+			err := features(r).Find(nil).WithCollation(mgohttp.Collation{Locale: "en", Strength: 2}).All(&docs)
+			assert.NoError(t, err)
+			assert.NotEmpty(t, docs)
+		})
+	})
+	t.Run("collation in Eventual mode", func(t *testing.T) {
+		requireServerFeature(t, info, mgohttp.FeatureCollation)
+		injector := mgohttp.NewSessionHandler(mgohttp.SessionHandlerConfig{
+			Sess:                session,
+			Database:            testDBName,
+			Timeout:             time.Second,
+			ConsistencyOverride: &mgohttp.ConsistencyOverride{Modes: map[string]mgo.Mode{"eventual": mgo.Eventual}},
+			Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				// the cursor of the find command isn't on a socket the session holds on to
+				var docs []bson.M
+				err := features(r).Find(nil).WithCollation(mgohttp.Collation{Locale: "en", Strength: 2}).Batch(1).All(&docs)
+				assert.NoError(t, err)
+				assert.NotEmpty(t, docs)
+			}),
+		})
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set(mgohttp.DefaultConsistencyHeader, "eventual")
+		injector.ServeHTTP(rec, req)
+		assert.Equal(t, http.StatusOK, rec.Code)
+	})
+	t.Run("$expr", func(t *testing.T) {
+		run(t, func(w http.ResponseWriter, r *http.Request) {
+			err := features(r).Find(bson.M{"$expr": bson.M{"$eq": []interface{}{1, 1}}}).One(&bson.M{})
+			if mgohttp.FeatureExpr.SupportedBy(info) {
+				assert.NoError(t, err)
+			} else {
+				// older servers are rejected by the guard with a clear error
+				assert.True(t, errors.As(err, &mgohttp.UnsupportedFeatureError{}), "%v", err)
+			}
+		})
+	})
+}
+
+// TestMongoDriverServerFeatures runs the version dependent queries on the official driver,
+// which also supports the servers too recent for mgo.
+func TestMongoDriverServerFeatures(t *testing.T) {
+	client := dialTestDriver(t)
+	info, _ := driverServerInfo(t, client)
+	ctx := context.Background()
+	c := client.Database(testDBName).Collection("features")
+	_, err := c.InsertOne(ctx, driverbson.D{{Key: "name", Value: "ada"}})
+	require.NoError(t, err)
+	defer c.Drop(ctx)
+
+	handler := mgohttp.NewSessionHandler(mgohttp.SessionHandlerConfig{
+		Database: testDBName,
+		Driver:   mgohttp.NewMongoDriver(client),
+		Timeout:  time.Second,
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			sess := mgohttp.FromContext(r.Context(), testDBName)
+			version, err := sess.ServerVersion(r.Context())
+			require.NoError(t, err)
+			assert.Equal(t, info.Version, version.Version)
+
+			features := sess.DB(testDBName).C("features")
+			assert.NoError(t, features.Find(nil).SetMaxTime(time.Second).One(&bson.M{}))
+			assert.NoError(t, features.Find(bson.M{"name": "ADA"}).WithCollation(mgohttp.Collation{Locale: "en", Strength: 2}).One(&bson.M{}))
+			assert.NoError(t, features.Find(bson.M{"$expr": bson.M{"$eq": []interface{}{1, 1}}}).One(&bson.M{}))
+			assert.NoError(t, features.Find(nil).WithReadConcern("majority").One(&bson.M{}))
+		}),
+	})
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+}
+
+func TestSessionPoolAgainstServer(t *testing.T) {
+	session, _ := dialTestMongo(t)
+	defer session.Close()
+	pool := mgohttp.NewSessionPool(session, mgohttp.SessionPoolConfig{Size: 2, Warm: true})
+	defer pool.Close()
+
+	handler := mgohttp.NewSessionHandler(mgohttp.SessionHandlerConfig{
+		Database:    testDBName,
+		Timeout:     time.Second,
+		SessionPool: pool,
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			assert.NoError(t, mgohttp.FromContext(r.Context(), testDBName).Ping())
+		}),
+	})
+	for i := 0; i < 5; i++ {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+		assert.Equal(t, http.StatusOK, rec.Code)
+	}
+	assert.Equal(t, mgohttp.SessionPoolStats{Idle: 2, Checkouts: 5}, pool.Stats())
+}
+
+func TestWatch(t *testing.T) {
+	session, _ := dialTestMongo(t)
+	defer session.Close()
+	if err := session.DB("local").C("oplog.rs").Find(nil).One(&bson.M{}); err != nil {
+		t.Skipf("the server has no oplog to watch: %s", err)
+	}
+	c := session.DB(testDBName).C("watched")
+	defer c.DropCollection()
+
+	handler := mgohttp.NewSessionHandler(mgohttp.SessionHandlerConfig{
+		Sess:     session,
+		Database: testDBName,
+		Timeout:  5 * time.Second,
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			watched := mgohttp.FromContext(r.Context(), testDBName).DB(testDBName).C("watched")
+			stream := watched.Watch([]bson.M{{"$match": bson.M{"operationType": "insert"}}}, mgohttp.ChangeStreamOptions{
+				MaxAwaitTime: 100 * time.Millisecond,
+			})
+			defer func() { assert.NoError(t, stream.Close()) }()
+
+			id := bson.NewObjectId()
+			require.NoError(t, c.Insert(bson.M{"_id": id, "n": 1}))
+			require.NoError(t, c.UpdateId(id, bson.M{"$set": bson.M{"n": 2}}))
+			var event mgohttp.ChangeEvent
+			for !stream.Next(&event) {
+				require.NoError(t, stream.Err())
+				require.True(t, stream.Timeout())
+			}
+			assert.Equal(t, "insert", event.OperationType)
+			assert.Equal(t, bson.M{"_id": id}, event.DocumentKey)
+			assert.Equal(t, event.ID, stream.ResumeToken())
+
+			// the update isn't an insert, the stream skips it
+			assert.False(t, stream.Next(&event))
+			assert.True(t, stream.Timeout())
+			assert.NotEqual(t, event.ID, stream.ResumeToken(), "past the update")
+		}),
+	})
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+}
+
+func TestCollectionCreateAndStats(t *testing.T) {
+	session, _ := dialTestMongo(t)
+	defer session.Close()
+	defer session.DB(testDBName).C("capped-stats").DropCollection()
+
+	handler := mgohttp.NewSessionHandler(mgohttp.SessionHandlerConfig{
+		Sess:     session,
+		Database: testDBName,
+		Timeout:  5 * time.Second,
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			c := mgohttp.FromContext(r.Context(), testDBName).DB(testDBName).C("capped-stats")
+			c.DropCollection()
+			require.NoError(t, c.Create(&mgo.CollectionInfo{Capped: true, MaxBytes: 4096, MaxDocs: 3}))
+			require.NoError(t, c.Insert(bson.M{"n": 1}))
+
+			stats, err := c.Stats()
+			require.NoError(t, err)
+			assert.Equal(t, int64(1), stats.Count)
+			assert.True(t, stats.Capped)
+			assert.Equal(t, int64(3), stats.MaxDocs)
+			assert.GreaterOrEqual(t, stats.MaxSize, int64(4096), "rounded up by the server")
+		}),
+	})
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+}
+
+func TestCappedMessaging(t *testing.T) {
+	session, _ := dialTestMongo(t)
+	defer session.Close()
+	c := session.DB(testDBName).C("capped-messages")
+	c.DropCollection()
+	require.NoError(t, c.Create(&mgo.CollectionInfo{Capped: true, MaxBytes: 4096, MaxDocs: 3}))
+	defer c.DropCollection()
+
+	var lastID bson.ObjectId
+	handler := mgohttp.NewSessionHandler(mgohttp.SessionHandlerConfig{
+		Sess:     session,
+		Database: testDBName,
+		Timeout:  5 * time.Second,
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			db := mgohttp.FromContext(r.Context(), testDBName).DB(testDBName)
+			writer := mgohttp.NewCappedWriter("capped-messages", time.Minute)
+			_, err := writer.Insert(db, bson.M{"payload": strings.Repeat("x", 8192)})
+			assert.True(t, errors.Is(err, mgohttp.ErrCappedDocumentTooLarge))
+
+			var evicted []bool
+			for i := 0; i < 5; i++ {
+				res, err := writer.Insert(db, bson.M{"n": i})
+				require.NoError(t, err)
+				evicted = append(evicted, res.Evicted)
+				if i == 0 {
+					lastID = res.ID
+				}
+			}
+			assert.Equal(t, []bool{false, false, false, true, true}, evicted)
+
+			// the first message was read, the next one was evicted before it could be
+			tail := mgohttp.TailCapped(db, "capped-messages", lastID, 100*time.Millisecond)
+			assert.False(t, tail.Next(&bson.M{}))
+			var overflow mgohttp.CappedOverflowError
+			require.True(t, errors.As(tail.Close(), &overflow))
+			assert.Equal(t, lastID, overflow.LastID)
+
+			tail = mgohttp.TailCapped(db, "capped-messages", "", 100*time.Millisecond)
+			var msg struct {
+				N int `bson:"n"`
+			}
+			var read []int
+			for tail.Next(&msg) {
+				read = append(read, msg.N)
+			}
+			assert.True(t, tail.Timeout())
+			assert.NoError(t, tail.Close())
+			assert.Equal(t, []int{2, 3, 4}, read)
+		}),
+	})
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+}
+
+func TestNewChildSession(t *testing.T) {
+	session, _ := dialTestMongo(t)
+	defer session.Close()
+
+	handler := mgohttp.NewSessionHandler(mgohttp.SessionHandlerConfig{
+		Sess:     session,
+		Database: testDBName,
+		Timeout:  5 * time.Second,
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var wg sync.WaitGroup
+			errs := make(chan error, 4)
+			for i := 0; i < 4; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					sess, closeSession := mgohttp.NewChildSession(r.Context(), testDBName)
+					defer closeSession()
+					errs <- sess.DB("test").C("children").Find(bson.M{}).All(&[]bson.M{})
+				}()
+			}
+			wg.Wait()
+			close(errs)
+			for err := range errs {
+				assert.NoError(t, err)
+			}
+		}),
+	})
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+}
+
+func TestSessionWithTimeout(t *testing.T) {
+	session, _ := dialTestMongo(t)
+	defer session.Close()
+	requireServerJavaScript(t, session)
+
+	handler := mgohttp.NewSessionHandler(mgohttp.SessionHandlerConfig{
+		Sess:     session,
+		Database: testDBName,
+		Timeout:  5 * time.Second,
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			sess := mgohttp.FromContext(r.Context(), testDBName)
+			c := sess.WithTimeout(50 * time.Millisecond).DB("test").C(sleepCollection)
+			err := c.Find(mgohttptest.SlowSelector(time.Second)).One(&bson.M{})
+			assert.True(t, mgohttp.IsTimeout(err), "the derived session times out first: %v", err)
+
+			// the request's session keeps its own timeout
+			assert.NoError(t, sess.DB("test").C(sleepCollection).Find(mgohttptest.SlowSelector(100*time.Millisecond)).One(&bson.M{}))
+		}),
+	})
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+}
+
+func TestOpLimiterIterAll(t *testing.T) {
+	session, _ := dialTestMongo(t)
+	defer session.Close()
+
+	handler := mgohttp.NewSessionHandler(mgohttp.SessionHandlerConfig{
+		Sess:      session,
+		Database:  testDBName,
+		Timeout:   5 * time.Second,
+		OpLimiter: mgohttp.NewOpLimiter(mgohttp.OpLimiterConfig{Limits: []mgohttp.OpLimit{{Op: "find", Collection: "limited", Max: 1}}}),
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			c := mgohttp.FromContext(r.Context(), testDBName).DB("test").C("limited")
+			for i := 0; i < 3; i++ {
+				// All gives the cursor's slot back, without a Close
+				assert.NoError(t, c.Find(bson.M{}).Iter().All(&[]bson.M{}))
+			}
+			it := c.Find(bson.M{}).Iter()
+			for it.Next(&bson.M{}) {
+			}
+			assert.NoError(t, c.Find(bson.M{}).Iter().All(&[]bson.M{}), "so does the last Next")
+			assert.NoError(t, it.Close())
+		}),
+	})
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+}
+
+func TestInSplitCount(t *testing.T) {
+	session, _ := dialTestMongo(t)
+	defer session.Close()
+	defer session.DB(testDBName).C("in-split").DropCollection()
+
+	handler := mgohttp.NewSessionHandler(mgohttp.SessionHandlerConfig{
+		Sess:        session,
+		Database:    testDBName,
+		Timeout:     5 * time.Second,
+		InSplitSize: 2,
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			c := mgohttp.FromContext(r.Context(), testDBName).DB(testDBName).C("in-split")
+			c.DropCollection()
+			require.NoError(t, c.Insert(
+				bson.M{"_id": 1, "tags": []string{"a", "c"}},
+				bson.M{"_id": 2, "tags": []string{"b"}},
+				bson.M{"_id": 3, "tags": []string{"a", "b", "c", "d"}},
+			))
+
+			// the chunks of ["a", "b"] and ["c", "d"] both match documents 1 and 3
+			n, err := c.Find(bson.M{"tags": bson.M{"$in": []string{"a", "b", "c", "d"}}}).Count()
+			require.NoError(t, err)
+			assert.Equal(t, 3, n)
+
+			n, err = c.Find(bson.M{"_id": bson.M{"$in": []int{1, 2, 3, 4}}}).Count()
+			require.NoError(t, err)
+			assert.Equal(t, 3, n)
+		}),
+	})
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+}
+
+// dialTestDriver connects the official driver to the test server, for the handlers with a
+// Driver, see NewMongoDriver.
+func dialTestDriver(t *testing.T) *mongo.Client {
+	url := os.Getenv("MONGO_URL")
+	if url == "" {
+		url = mgohttptest.DefaultMongoURL + "/mgosessionpool-test"
+	}
+	if !strings.HasPrefix(url, "mongodb://") {
+		url = "mongodb://" + url
+	}
+	client, err := mongo.Connect(context.Background(), options.Client().ApplyURI(url))
+	require.NoError(t, err)
+	t.Cleanup(func() { client.Disconnect(context.Background()) })
+	return client
+}
+
+// driverServerInfo returns the build info of the test server and the name of its replica set,
+// through the official driver, which unlike mgo supports every version from MongoDB 3.6 on.
+func driverServerInfo(t *testing.T, client *mongo.Client) (mgo.BuildInfo, string) {
+	admin := client.Database("admin")
+	var info struct {
+		Version      string `bson:"version"`
+		VersionArray []int  `bson:"versionArray"`
+	}
+	require.NoError(t, admin.RunCommand(context.Background(), driverbson.D{{Key: "buildInfo", Value: 1}}).Decode(&info))
+	var hello struct {
+		SetName string `bson:"setName"`
+	}
+	require.NoError(t, admin.RunCommand(context.Background(), driverbson.D{{Key: "isMaster", Value: 1}}).Decode(&hello))
+	t.Logf("testing the official driver against MongoDB %s", info.Version)
+	return mgo.BuildInfo{Version: info.Version, VersionArray: info.VersionArray}, hello.SetName
+}
+
+// requireReplicaSet skips the test on servers that don't support f, or that aren't a replica
+// set, e.g. for transactions.
+func requireReplicaSet(t *testing.T, info mgo.BuildInfo, setName string, f mgohttp.ServerFeature) {
+	requireServerFeature(t, info, f)
+	if setName == "" {
+		t.Skipf("%s take a replica set", f.Name)
+	}
+}
+
+func TestMongoDriverTransaction(t *testing.T) {
+	client := dialTestDriver(t)
+	info, setName := driverServerInfo(t, client)
+	requireReplicaSet(t, info, setName, mgohttp.FeatureTransactions)
+	ctx := context.Background()
+	c := client.Database(testDBName).Collection("transactions")
+	c.Drop(ctx)
+	// collections can't be created in the transactions of MongoDB 4.0
+	require.NoError(t, client.Database(testDBName).CreateCollection(ctx, "transactions"))
+	defer c.Drop(ctx)
+	count := func() int {
+		n, err := c.CountDocuments(ctx, driverbson.D{})
+		require.NoError(t, err)
+		return int(n)
+	}
+
+	tracer := mocktracer.New()
+	errAborted := errors.New("aborted")
+	handler := mgohttp.NewSessionHandler(mgohttp.SessionHandlerConfig{
+		Database: testDBName,
+		Driver:   mgohttp.NewMongoDriver(client),
+		Safe:     &mgo.Safe{WMode: "majority"},
+		Timeout:  5 * time.Second,
+		Tracer:   tracer,
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			sess := mgohttp.FromContext(r.Context(), testDBName)
+			err := sess.WithTransaction(r.Context(), func(tx mgohttp.MongoSession) error {
+				txc := tx.DB(testDBName).C("transactions")
+				if err := txc.Insert(bson.M{"_id": 1}, bson.M{"_id": 2}); err != nil {
+					return err
+				}
+				// the transaction's writes are only visible within it
+				n, err := txc.Find(nil).Count()
+				require.NoError(t, err)
+				assert.Equal(t, 2, n)
+				n, err = sess.DB(testDBName).C("transactions").Find(nil).Count()
+				require.NoError(t, err)
+				assert.Equal(t, 0, n)
+				return errAborted
+			})
+			assert.Equal(t, errAborted, err)
+			assert.Equal(t, 0, count(), "the transaction is aborted")
+
+			require.NoError(t, sess.WithTransaction(r.Context(), func(tx mgohttp.MongoSession) error {
+				return tx.DB(testDBName).C("transactions").Insert(bson.M{"_id": 1}, bson.M{"_id": 2})
+			}))
+			assert.Equal(t, 2, count(), "the transaction is committed")
+		}),
+	})
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	transactions := 0
+	for _, sp := range tracer.FinishedSpans() {
+		if sp.OperationName == "transaction" {
+			transactions++
+		}
+	}
+	assert.Equal(t, 2, transactions)
+}
+
+func TestMongoDriverSnapshotReads(t *testing.T) {
+	client := dialTestDriver(t)
+	info, setName := driverServerInfo(t, client)
+	requireReplicaSet(t, info, setName, mgohttp.FeatureSnapshotReads)
+	ctx := context.Background()
+	c := client.Database(testDBName).Collection("snapshots")
+	c.Drop(ctx)
+	defer c.Drop(ctx)
+	_, err := c.InsertOne(ctx, driverbson.D{{Key: "_id", Value: 1}})
+	require.NoError(t, err)
+
+	handler := mgohttp.NewSessionHandler(mgohttp.SessionHandlerConfig{
+		Database: testDBName,
+		Driver:   mgohttp.NewMongoDriver(client),
+		Safe:     &mgo.Safe{WMode: "majority"},
+		Timeout:  5 * time.Second,
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := mgohttp.WithSnapshotReads(r.Context())
+			snapshots := mgohttp.FromContext(ctx, testDBName).DB(testDBName).C("snapshots")
+			n, err := snapshots.Find(nil).Count()
+			require.NoError(t, err)
+			assert.Equal(t, 1, n)
+
+			// the writes after the snapshot aren't read
+			require.NoError(t, mgohttp.FromContext(r.Context(), testDBName).DB(testDBName).C("snapshots").Insert(bson.M{"_id": 2}))
+			var docs []bson.M
+			require.NoError(t, snapshots.Find(nil).All(&docs))
+			assert.Len(t, docs, 1)
+			n, err = snapshots.Find(nil).Count()
+			require.NoError(t, err)
+			assert.Equal(t, 1, n)
+		}),
+	})
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+}
@@ -0,0 +1,73 @@
+package mgohttp
+
+import (
+	"context"
+	"reflect"
+)
+
+// OpInfo describes an operation to the Interceptors of a SessionHandler.
+type OpInfo struct {
+	// Op is the name of the operation's span, e.g. "update" or "find".
+	Op         string
+	Database   string
+	Collection string
+	// Method is the access method of queries, e.g. "All" or "Count".
+	Method string
+	// Selector is the selector of the operations that have one, and the pipeline of
+	// aggregations.
+	Selector interface{}
+	// Update is the update of Update, UpdateAll, Upsert and Apply.
+	Update interface{}
+	// Docs are the documents of Insert.
+	Docs []interface{}
+	// Command is the command of MongoDatabase.Run.
+	Command interface{}
+}
+
+// Interceptor runs around an operation of the traced wrappers, after the wrappers' own checks
+// and within its span: it calls next to run the operation, or returns an error to fail it
+// without reaching Mongo, e.g. to authorize the operation's collection. Changes to the
+// Selector, Update, Docs or Command of op before next is called are sent in place of the
+// operation's own, to rewrite queries.
+type Interceptor func(ctx context.Context, op *OpInfo, next func() error) error
+
+// intercept runs the operation described by info through the handler's Interceptors. run
+// sends the operation as described by the info it's passed.
+func (o *opSpan) intercept(info OpInfo, run func(info *OpInfo) error) error {
+	if err := o.countQuery(); err != nil {
+		return err
+	}
+	info.Op, info.Database, info.Collection = o.name, databaseFromContext(o.ctx), o.collection
+	digestFromContext(o.ctx).check(info)
+	h := handlerFromContext(o.ctx)
+	if h == nil || len(h.cfg.Interceptors) == 0 {
+		return run(&info)
+	}
+	var next func(i int) error
+	next = func(i int) error {
+		if i == len(h.cfg.Interceptors) {
+			return run(&info)
+		}
+		return h.cfg.Interceptors[i](o.ctx, &info, func() error { return next(i + 1) })
+	}
+	return next(0)
+}
+
+// intercept runs an access method of the query through the handler's Interceptors, with
+// the query rebuilt on the selector they rewrote, if they did.
+func (q tracedMongoQuery) intercept(method string, update interface{}, run func(q tracedMongoQuery, op *OpInfo) error) error {
+	info := OpInfo{Method: method, Selector: q.spec.filter, Update: update}
+	return q.op.intercept(info, func(op *OpInfo) error {
+		if !sameSelector(op.Selector, q.spec.filter) {
+			q.spec.filter = op.Selector
+			q.q = q.spec.query()
+			q.split = nil
+		}
+		return run(q, op)
+	})
+}
+
+// sameSelector reports whether the Interceptors left selector as is.
+func sameSelector(rewritten, selector interface{}) bool {
+	return reflect.DeepEqual(rewritten, selector)
+}
@@ -0,0 +1,79 @@
+package mgohttp
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	mgo "gopkg.in/mgo.v2"
+	bson "gopkg.in/mgo.v2/bson"
+)
+
+func TestInterceptors(t *testing.T) {
+	errDenied := errors.New("denied")
+	var calls []string
+	var seen []OpInfo
+	h := &SessionHandler{cfg: SessionHandlerConfig{Interceptors: []Interceptor{
+		func(ctx context.Context, op *OpInfo, next func() error) error {
+			calls = append(calls, "outer")
+			if op.Selector != nil {
+				op.Selector = bson.M{"org": "o1", "$and": []interface{}{op.Selector}}
+			}
+			return next()
+		},
+		func(ctx context.Context, op *OpInfo, next func() error) error {
+			calls = append(calls, "inner")
+			seen = append(seen, *op)
+			// the collection has no session behind it: reaching mgo would panic
+			return errDenied
+		},
+	}}}
+	ctx := context.WithValue(context.Background(), handlerKey, h)
+	ctx = context.WithValue(ctx, databaseKey, testDBName)
+	c := tracedMgoCollection{
+		collectionName: "users",
+		collection:     &mgo.Collection{Name: "users", Database: &mgo.Database{Name: testDBName, Session: &mgo.Session{}}},
+		ctx:            ctx,
+	}
+
+	err := c.Insert(bson.M{"a": 1})
+	assert.True(t, errors.Is(err, errDenied))
+	assert.Equal(t, []string{"outer", "inner"}, calls)
+	assert.Equal(t, OpInfo{Op: "insert", Database: testDBName, Collection: "users", Docs: []interface{}{bson.M{"a": 1}}}, seen[0])
+
+	_, err = c.UpdateAll(bson.M{"a": 1}, bson.M{"$set": bson.M{"b": 2}})
+	assert.True(t, errors.Is(err, errDenied))
+	assert.Equal(t, bson.M{"org": "o1", "$and": []interface{}{bson.M{"a": 1}}}, seen[1].Selector, "rewritten by the outer interceptor")
+	assert.Equal(t, bson.M{"$set": bson.M{"b": 2}}, seen[1].Update)
+
+	n, err := c.Find(bson.M{"a": 1}).Count()
+	assert.True(t, errors.Is(err, errDenied))
+	assert.Zero(t, n)
+	assert.Equal(t, "find", seen[2].Op)
+	assert.Equal(t, "Count", seen[2].Method)
+}
+
+func TestQueryInterceptorRewrite(t *testing.T) {
+	h := &SessionHandler{cfg: SessionHandlerConfig{Interceptors: []Interceptor{
+		func(ctx context.Context, op *OpInfo, next func() error) error {
+			op.Selector = bson.M{"org": "o1"}
+			return next()
+		},
+	}}}
+	c := tracedMgoCollection{
+		collectionName: "users",
+		collection:     &mgo.Collection{Name: "users", Database: &mgo.Database{Name: testDBName, Session: &mgo.Session{}}},
+		ctx:            context.WithValue(context.Background(), handlerKey, h),
+	}
+	q := c.Find(bson.M{"a": 1}).Sort("a").(tracedMongoQuery)
+	defer q.op.Finish()
+	err := q.intercept("All", nil, func(rq tracedMongoQuery, op *OpInfo) error {
+		assert.Equal(t, bson.M{"org": "o1"}, rq.spec.filter)
+		assert.NotSame(t, q.q, rq.q, "the query is rebuilt on the rewritten selector")
+		assert.Equal(t, []string{"a"}, rq.spec.sort)
+		return nil
+	})
+	require.NoError(t, err)
+}
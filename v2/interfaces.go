@@ -0,0 +1,240 @@
+package mgohttp
+
+import (
+	"context"
+	"io"
+	"time"
+
+	mgo "gopkg.in/mgo.v2"
+	bson "gopkg.in/mgo.v2/bson"
+)
+
+// MongoSession wraps a subset of the session interface to Mongo for tracing purposes
+type MongoSession interface {
+	DB(name string) MongoDatabase
+	Ping() error
+	// PingWithInfo is a Ping bounded by ctx that also reports the round trip time and which
+	// server answered.
+	PingWithInfo(ctx context.Context) (PingInfo, error)
+	// ServerVersion returns the server's build info, cached per parent session. Use
+	// ServerFeature.SupportedBy to check for version dependent behavior.
+	ServerVersion(ctx context.Context) (mgo.BuildInfo, error)
+	// SetSafe changes the write concern of the session, for the rest of the request. See
+	// mgo.Session.SetSafe: nil disables the acknowledgement of writes.
+	SetSafe(safe *mgo.Safe)
+	// WithTimeout returns the session with a socket timeout of d, tighter or looser than the
+	// request's, for operations with their own budget, e.g. one known-slow query. It runs on
+	// its own copy of the session, one per d, which takes one of the handler's
+	// MaxConcurrentSessions and is closed with the request's. The operations still can't
+	// outlive the request's timeout: raise it for the route with WithRequestTimeout. A d of
+	// zero or less returns the session as is.
+	WithTimeout(d time.Duration) MongoSession
+	// WithTransaction runs fn in a multi-document transaction, with the operations of tx bound
+	// to it, under a single span: it's committed when fn returns nil and aborted otherwise,
+	// and retried on transient transaction errors. It takes MongoDB 4.0 and the official
+	// driver, see NewMongoDriver: older servers fail with an UnsupportedFeatureError, and the
+	// mgo sessions with ErrTransactionsUnsupported, without running fn.
+	WithTransaction(ctx context.Context, fn func(tx MongoSession) error) error
+}
+
+// MongoDatabase wraps a subset of the Database interface to Mongo for tracing purposes
+type MongoDatabase interface {
+	C(collection string) MongoCollection
+	Run(cmd interface{}, result interface{}) error
+	// GridFS returns the GridFS stored in the prefix.files and prefix.chunks collections.
+	GridFS(prefix string) MongoGridFS
+	CollectionNames() (names []string, err error)
+	DropDatabase() error
+	// Watch returns the changes of the documents of every collection of the database, see
+	// MongoCollection.Watch. On the sessions of NewMongoDriver, it takes MongoDB 4.0.
+	Watch(pipeline interface{}, opts ChangeStreamOptions) ChangeStream
+}
+
+// MongoGridFS wraps the GridFS interface to Mongo for tracing purposes. Files are traced from
+// the time they're created or opened until they're closed.
+type MongoGridFS interface {
+	Create(name string) (MongoGridFile, error)
+	Open(name string) (MongoGridFile, error)
+	OpenId(id interface{}) (MongoGridFile, error)
+	Remove(name string) error
+	RemoveId(id interface{}) error
+	// Find queries the file documents of the GridFS.
+	Find(query interface{}) MongoQuery
+}
+
+// MongoGridFile wraps the GridFile interface to Mongo for tracing purposes. The bytes read
+// and written are logged when the file is closed.
+type MongoGridFile interface {
+	io.ReadWriteSeeker
+	io.Closer
+	Abort()
+	Id() interface{}
+	SetId(id interface{})
+	Name() string
+	SetName(name string)
+	ContentType() string
+	SetContentType(ctype string)
+	GetMeta(result interface{}) error
+	SetMeta(metadata interface{})
+	Size() int64
+	MD5() string
+	UploadDate() time.Time
+	SetUploadDate(t time.Time)
+	SetChunkSize(bytes int)
+}
+
+// MongoCollection wraps a subset of the Collection interface to Mongo for tracing purposes
+type MongoCollection interface {
+	Find(query interface{}) MongoQuery
+	FindId(id bson.ObjectId) MongoQuery
+	Insert(docs ...interface{}) error
+	Remove(selector interface{}) error
+	RemoveId(id bson.ObjectId) error
+	RemoveAll(selector interface{}) (info *mgo.ChangeInfo, err error)
+	Update(selector interface{}, update interface{}) error
+	UpdateId(id bson.ObjectId, update interface{}) error
+	UpdateAll(selector interface{}, update interface{}) (info *mgo.ChangeInfo, err error)
+	Upsert(selector interface{}, update interface{}) (info *mgo.ChangeInfo, err error)
+	// Bulk queues several write operations to be sent together, see mgo.Collection.Bulk.
+	Bulk() MongoBulk
+	EnsureIndex(index mgo.Index) error
+	EnsureIndexKey(key ...string) error
+	DropIndex(key ...string) error
+	DropIndexName(name string) error
+	Indexes() (indexes []mgo.Index, err error)
+	DropCollection() error
+	Create(info *mgo.CollectionInfo) error
+	// Stats returns the size and limits of the collection, with the collStats command.
+	Stats() (CollectionStats, error)
+	// Watch returns the changes of the documents of the collection, from the end of the oplog
+	// or after opts.ResumeAfter. pipeline may only hold $match stages on operationType. mgo
+	// doesn't implement change streams, so on its sessions the changes are read by tailing the
+	// oplog, which takes a replica set and the privilege to read the local database. The
+	// sessions of NewMongoDriver open MongoDB's change streams instead, which take a replica
+	// set and MongoDB 3.6, and return the same events and resume tokens.
+	Watch(pipeline interface{}, opts ChangeStreamOptions) ChangeStream
+	// WithWriteConcern returns the collection with its writes acknowledged according to safe,
+	// overriding the session's, see mgo.Session.SetSafe: nil disables the acknowledgement.
+	// Each write runs on its own copy of the session.
+	WithWriteConcern(safe *mgo.Safe) MongoCollection
+	// Pipe prepares an aggregation pipeline, see mgo.Collection.Pipe. It runs as the aggregate
+	// command, and its cursor is driven by getMore commands. Requires MongoDB 3.2.
+	Pipe(pipeline interface{}) MongoPipe
+}
+
+// MongoPipe wraps the Pipe interface to Mongo for tracing purposes. The cursor of Iter is
+// traced per batch rather than per document: the aggregate command and each getMore are
+// spans of their own, tagged with the cursor id (TagCursorID), so long aggregations can be
+// correlated with the server's currentOp.
+type MongoPipe interface {
+	All(result interface{}) error
+	One(result interface{}) error
+	Iter() MongoIter
+	Explain(result interface{}) error
+	// AllowDiskUse lets the stages of the pipeline write temporary files, to exceed their
+	// memory limit.
+	AllowDiskUse() MongoPipe
+	// Batch sets the number of documents per batch fetched by the cursor.
+	Batch(n int) MongoPipe
+}
+
+// MongoBulk wraps the Bulk interface to Mongo for tracing purposes. The queued operations
+// are traced as a single span when Run is called.
+type MongoBulk interface {
+	Insert(docs ...interface{})
+	Update(pairs ...interface{})
+	UpdateAll(pairs ...interface{})
+	Upsert(pairs ...interface{})
+	Remove(selectors ...interface{})
+	RemoveAll(selectors ...interface{})
+	Unordered()
+	Run() (*mgo.BulkResult, error)
+}
+
+// MongoQuery wraps a subset of the Query interface to Mongo for tracing purposes
+type MongoQuery interface {
+	All(result interface{}) error
+	Apply(change mgo.Change, result interface{}) (info *mgo.ChangeInfo, err error)
+	Count() (n int, err error)
+	Hint(indexKey ...string) MongoQuery
+	Iter() MongoIter
+	Limit(n int) MongoQuery
+	Skip(n int) MongoQuery
+	// Batch sets the number of documents per batch fetched by the cursor.
+	Batch(n int) MongoQuery
+	// Prefetch sets when the next batch is requested, as the share of the current batch
+	// that is left.
+	Prefetch(p float64) MongoQuery
+	// SetMaxTime limits the time the server spends executing the query, complementing the
+	// socket timeout. Requires MongoDB 2.6: older servers fail the query with an
+	// UnsupportedFeatureError.
+	SetMaxTime(d time.Duration) MongoQuery
+	One(result interface{}) (err error)
+	// OneRaw returns the first document of the query as raw BSON, for proxy-style endpoints
+	// that re-serialize documents as is, skipping their decoding. mgo.ErrNotFound when there's
+	// none.
+	OneRaw() (bson.Raw, error)
+	// AllRaw returns the documents of the query as raw BSON, like OneRaw.
+	AllRaw() ([]bson.Raw, error)
+	Select(selector interface{}) MongoQuery
+	Sort(fields ...string) MongoQuery
+	// And narrows the query to the documents that also match selector, combining the
+	// selectors with $and, e.g. to resume after a PageToken.
+	And(selector interface{}) MongoQuery
+	// Explain returns the server's query plan for the query.
+	Explain(result interface{}) error
+	// Tail returns a tailable cursor on a capped collection, see mgo.Query.Tail. Next waits
+	// up to timeout for new documents, a negative timeout waits forever. The cursor is traced
+	// as a single span that's finished by Close. It fails with ErrCollatedTail with a
+	// collation, and on the mgo sessions with ErrReadConcernTail with a read concern.
+	Tail(timeout time.Duration) MongoIter
+	// WithCollation applies collation rules (e.g. case-insensitive matching) to the query.
+	// mgo has no native support for collations, so collated queries are run as database
+	// commands. Requires MongoDB 3.4.
+	WithCollation(c Collation) MongoQuery
+	// WithSnapshot reads from a snapshot (readConcern "snapshot"), the request's, see
+	// WithSnapshotReads. mgo doesn't support it: the access methods fail with
+	// ErrSnapshotReadsUnsupported.
+	WithSnapshot() MongoQuery
+	// WithReadConcern sets the read concern of the query, e.g. "majority" to only read
+	// writes acknowledged by a majority of the replica set. mgo has no native support for
+	// read concerns, so the access methods are run as database commands. Requires MongoDB
+	// 3.2, and "majority" requires it to be enabled on the server. "snapshot" is the same as
+	// WithSnapshot.
+	WithReadConcern(level string) MongoQuery
+	// WithReadPreference routes the query to the replica set members matching p, overriding
+	// the handler's ReadPreference. The query runs on a copy of the session: within a request,
+	// the queries with the same preference share one, which takes one of the handler's
+	// MaxConcurrentSessions.
+	WithReadPreference(p ReadPreference) MongoQuery
+}
+
+// MongoIter wraps the non-deprecated methods of an `mgo.Iter` for tracing purposes
+type MongoIter interface {
+	All(result interface{}) error
+	Close() error
+	Done() bool
+	Err() error
+	Next(result interface{}) bool
+	// Timeout reports whether the last Next returned false because a tailable cursor timed
+	// out waiting for documents, rather than because the cursor is done.
+	Timeout() bool
+}
+
+// ChangeStream is the change stream of Watch, traced as a single span from Watch to Close.
+type ChangeStream interface {
+	// Next reads the next change into event, waiting up to the MaxAwaitTime of the stream. It
+	// returns false when the stream failed, see Err, or timed out, see Timeout.
+	Next(event *ChangeEvent) bool
+	Err() error
+	// Timeout reports whether the last Next returned false because no change came in time:
+	// the stream can be read further.
+	Timeout() bool
+	// ResumeToken is the position of the stream, to resume it with
+	// ChangeStreamOptions.ResumeAfter. It's past the changes Next returned, and on mgo's
+	// sessions the entries of the oplog it skipped. The sessions of NewMongoDriver filter the
+	// changes on the server, so their token only moves with the changes Next returns: a
+	// stream resumed after a quiet period may go over the entries it filtered out again.
+	ResumeToken() ResumeToken
+	Close() error
+}
@@ -0,0 +1,77 @@
+// Package internal exists so that we can share the Context key functions between
+// mgohttp & mgohttptest without making them public.
+//
+// The NewContext function is intentionally kept private to prevent accidental misuses
+// of the mgohttp package. The `NewSessionHandler` function is the only inteded interface.
+// Testing capabilities are available via the `mgohttptest` subpackage. It's kept seperate as
+// its use should be intentional and look out of place in non-test code, just like use of
+// the net/http/httptest package outside of tests would be wrong.
+package internal
+
+import (
+	"context"
+	"sync"
+
+	mgo "gopkg.in/mgo.v2"
+)
+
+type mgoSessionKeyType struct {
+	database string
+}
+
+var mgoSessionKey = mgoSessionKeyType{}
+
+// GetMgoSessionKey returns a new object for use as a Context object key.
+func GetMgoSessionKey(db string) interface{} {
+	return mgoSessionKeyType{database: db}
+}
+
+// SessionGetter is the function type definition used to enforce that we're populating the
+// Context value with the correct function type.
+// The error is set when the session couldn't be created.
+type SessionGetter func(context.Context) (*mgo.Session, context.Context, error)
+
+// NewContext creates a new context object containing a new mgo session getter.
+func NewContext(ctx context.Context, dbName string, getter SessionGetter) context.Context {
+	return context.WithValue(ctx, GetMgoSessionKey(dbName), getter)
+}
+
+// SessionProvider is the function type of the Context values that provide a ready-made session
+// in place of an mgo session, e.g. the in-memory fake of mgohttptest. It returns an
+// interface{} holding an mgohttp.MongoSession, since this package can't depend on mgohttp.
+type SessionProvider func(context.Context) interface{}
+
+// NewProviderContext creates a new context object containing a session provider.
+func NewProviderContext(ctx context.Context, dbName string, provider SessionProvider) context.Context {
+	return context.WithValue(ctx, GetMgoSessionKey(dbName), provider)
+}
+
+type sessionCacheKeyType struct{}
+
+var sessionCacheKey = sessionCacheKeyType{}
+
+// SessionCache holds what mgohttp caches about the session of a getter outside of a
+// SessionHandler, e.g. the version of its server. Its value is an mgohttp type, which this
+// package can't depend on.
+type SessionCache struct {
+	once  sync.Once
+	value interface{}
+}
+
+// Load returns the cached value, made by create the first time.
+func (c *SessionCache) Load(create func() interface{}) interface{} {
+	c.once.Do(func() { c.value = create() })
+	return c.value
+}
+
+// WithSessionCache returns a copy of ctx carrying c, for the getters to return along with the
+// session c belongs to.
+func WithSessionCache(ctx context.Context, c *SessionCache) context.Context {
+	return context.WithValue(ctx, sessionCacheKey, c)
+}
+
+// SessionCacheFromContext returns the SessionCache of ctx, if any.
+func SessionCacheFromContext(ctx context.Context) *SessionCache {
+	c, _ := ctx.Value(sessionCacheKey).(*SessionCache)
+	return c
+}
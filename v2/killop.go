@@ -0,0 +1,106 @@
+package mgohttp
+
+import (
+	"context"
+	"time"
+
+	"gopkg.in/Clever/kayvee-go.v6/logger"
+	mgo "gopkg.in/mgo.v2"
+	bson "gopkg.in/mgo.v2/bson"
+)
+
+// killOpsTimeout bounds the currentOp and killOp commands run for a request that timed out.
+const killOpsTimeout = 5 * time.Second
+
+type opCommentKeyType struct{}
+
+var opCommentKey = opCommentKeyType{}
+
+// withOpComment has the queries of the sessions got from ctx carry comment, if set.
+func withOpComment(ctx context.Context, comment string) context.Context {
+	if comment == "" {
+		return ctx
+	}
+	return context.WithValue(ctx, opCommentKey, comment)
+}
+
+func opCommentFromContext(ctx context.Context) string {
+	comment, _ := ctx.Value(opCommentKey).(string)
+	return comment
+}
+
+// newOpComment returns a comment unique to a request.
+func newOpComment() string {
+	return "mgohttp-" + bson.NewObjectId().Hex()
+}
+
+// currentOpCommand returns the currentOp command listing the operations that carry comment:
+// queries and their getMores, as reported by servers before and after 3.6.
+func currentOpCommand(comment string) bson.D {
+	return bson.D{
+		{Name: "currentOp", Value: 1},
+		{Name: "$or", Value: []bson.M{
+			{"query.$comment": comment},
+			{"query.comment": comment},
+			{"command.comment": comment},
+			{"originatingCommand.comment": comment},
+		}},
+	}
+}
+
+type currentOpResult struct {
+	InProg []struct {
+		// OpID is a number, or a "shard:number" string on mongos
+		OpID interface{} `bson:"opid"`
+	} `bson:"inprog"`
+}
+
+// killOps kills, in the background, the operations the request's queries left running, once
+// it timed out. It copies the request's sessions, so it must run before they're closed.
+func (s *requestSession) killOps() {
+	s.mu.Lock()
+	if !s.c.cfg.KillOpsOnTimeout || s.opComment == "" || s.closed {
+		s.mu.Unlock()
+		return
+	}
+	comment := s.opComment
+	sessions := make([]*mgo.Session, 0, len(s.sessions))
+	for _, sess := range s.sessions {
+		sessions = append(sessions, sess.Copy())
+	}
+	s.mu.Unlock()
+
+	log := logger.FromContext(s.r.Context())
+	go func() {
+		for _, sess := range sessions {
+			sess.SetSocketTimeout(killOpsTimeout)
+			killed, err := killCommentedOps(sess, comment)
+			sess.Close()
+			if err != nil {
+				log.ErrorD("mgohttp-kill-ops-failed", logger.M{"comment": comment, "error": err.Error()})
+				continue
+			}
+			if killed > 0 {
+				log.InfoD("mgohttp-killed-ops", logger.M{"comment": comment, "killed": killed})
+			}
+		}
+	}()
+}
+
+// killCommentedOps kills the operations that carry comment on the server of sess, and returns
+// how many it killed.
+func killCommentedOps(sess *mgo.Session, comment string) (int, error) {
+	admin := sess.DB("admin")
+	var ops currentOpResult
+	if err := admin.Run(currentOpCommand(comment), &ops); err != nil {
+		return 0, err
+	}
+	killed := 0
+	for _, op := range ops.InProg {
+		if err := admin.Run(bson.D{{Name: "killOp", Value: 1}, {Name: "op", Value: op.OpID}}, nil); err != nil {
+			return killed, err
+		}
+		killed++
+	}
+	return killed, nil
+}
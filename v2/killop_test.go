@@ -0,0 +1,59 @@
+package mgohttp
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/opentracing/opentracing-go/mocktracer"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	bson "gopkg.in/mgo.v2/bson"
+)
+
+func TestKillOpsOnTimeoutTagsQueries(t *testing.T) {
+	tracer := mocktracer.New()
+	var queries []tracedMongoQuery
+	handler := newDeferredTestHandler(func(w http.ResponseWriter, r *http.Request) {
+		for i := 0; i < 2; i++ {
+			c := FromContext(r.Context(), testDBName).DB(testDBName).C("users")
+			queries = append(queries, c.Find(bson.M{"a": 1}).(tracedMongoQuery))
+		}
+	})
+	handler.cfg.Tracer = tracer
+	handler.cfg.KillOpsOnTimeout = true
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+
+	require.Len(t, queries, 2)
+	comment := queries[0].spec.comment
+	assert.True(t, strings.HasPrefix(comment, "mgohttp-"))
+	assert.Equal(t, comment, queries[1].spec.comment, "the request's queries share its comment")
+	assert.Contains(t, queries[0].spec.findCommand(0, false), bson.DocElem{Name: "comment", Value: comment})
+
+	var libSpan *mocktracer.MockSpan
+	for _, sp := range tracer.FinishedSpans() {
+		if sp.OperationName == "mgohttp" {
+			libSpan = sp
+		}
+	}
+	require.NotNil(t, libSpan)
+	assert.Equal(t, comment, libSpan.Tag(TagOpComment))
+}
+
+func TestKillOpsOnTimeoutDisabled(t *testing.T) {
+	var q tracedMongoQuery
+	handler := newDeferredTestHandler(func(w http.ResponseWriter, r *http.Request) {
+		q = FromContext(r.Context(), testDBName).DB(testDBName).C("users").Find(nil).(tracedMongoQuery)
+	})
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	assert.Empty(t, q.spec.comment)
+	assert.NotContains(t, q.spec.findCommand(0, false), bson.DocElem{Name: "comment", Value: ""})
+}
+
+func TestCurrentOpCommand(t *testing.T) {
+	cmd := currentOpCommand("mgohttp-1")
+	assert.Equal(t, "currentOp", cmd[0].Name)
+	assert.Contains(t, cmd[1].Value, bson.M{"command.comment": "mgohttp-1"})
+	assert.Contains(t, cmd[1].Value, bson.M{"originatingCommand.comment": "mgohttp-1"})
+}
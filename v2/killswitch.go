@@ -0,0 +1,69 @@
+package mgohttp
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// ErrCollectionDisabled is the sentinel wrapped by every CollectionDisabledError, so callers
+// can check for it with errors.Is.
+var ErrCollectionDisabled = errors.New("collection disabled")
+
+// CollectionDisabledError is returned by operations against a collection that an operator
+// has turned off with DisableCollection.
+type CollectionDisabledError struct {
+	Database   string
+	Collection string
+}
+
+func (e CollectionDisabledError) Error() string {
+	return fmt.Sprintf("mgohttp: %s.%s: %s", e.Database, e.Collection, ErrCollectionDisabled)
+}
+
+// Unwrap allows errors.Is(err, ErrCollectionDisabled).
+func (e CollectionDisabledError) Unwrap() error {
+	return ErrCollectionDisabled
+}
+
+// disabledCollections is the process-wide kill switch registry, keyed by "database.collection".
+var disabledCollections = struct {
+	sync.RWMutex
+	m map[string]struct{}
+}{m: map[string]struct{}{}}
+
+// DisableCollection turns off all access to a collection through the traced wrappers.
+// Operations against it fail fast with a CollectionDisabledError instead of reaching Mongo.
+// This is intended to be flipped at runtime (e.g. from an admin endpoint) to shed a single
+// workload during an incident without deploying code.
+func DisableCollection(database, collection string) {
+	disabledCollections.Lock()
+	defer disabledCollections.Unlock()
+	disabledCollections.m[database+"."+collection] = struct{}{}
+}
+
+// EnableCollection reverses DisableCollection.
+func EnableCollection(database, collection string) {
+	disabledCollections.Lock()
+	defer disabledCollections.Unlock()
+	delete(disabledCollections.m, database+"."+collection)
+}
+
+// IsCollectionDisabled reports whether DisableCollection is in effect for a collection.
+func IsCollectionDisabled(database, collection string) bool {
+	disabledCollections.RLock()
+	defer disabledCollections.RUnlock()
+	_, ok := disabledCollections.m[database+"."+collection]
+	return ok
+}
+
+// DisabledCollections lists the currently disabled collections as "database.collection".
+func DisabledCollections() []string {
+	disabledCollections.RLock()
+	defer disabledCollections.RUnlock()
+	names := make([]string, 0, len(disabledCollections.m))
+	for name := range disabledCollections.m {
+		names = append(names, name)
+	}
+	return names
+}
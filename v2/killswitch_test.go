@@ -0,0 +1,46 @@
+package mgohttp
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	mgo "gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+func TestCollectionKillSwitch(t *testing.T) {
+	DisableCollection(testDBName, "events")
+	defer EnableCollection(testDBName, "events")
+
+	assert.True(t, IsCollectionDisabled(testDBName, "events"))
+	assert.False(t, IsCollectionDisabled(testDBName, "users"))
+	assert.Equal(t, []string{testDBName + ".events"}, DisabledCollections())
+
+	// The collection has no session behind it: any call that reaches mgo would panic.
+	c := tracedMgoCollection{
+		collectionName: "events",
+		collection:     &mgo.Collection{Name: "events", Database: &mgo.Database{Name: testDBName}},
+		ctx:            context.Background(),
+	}
+
+	err := c.Insert(bson.M{"a": 1})
+	assert.True(t, errors.Is(err, ErrCollectionDisabled))
+	assert.Equal(t, CollectionDisabledError{Database: testDBName, Collection: "events"}, err)
+
+	_, err = c.UpdateAll(bson.M{}, bson.M{"$set": bson.M{"a": 2}})
+	assert.True(t, errors.Is(err, ErrCollectionDisabled))
+
+	var result []bson.M
+	err = c.Find(bson.M{"a": 1}).Sort("a").Limit(10).All(&result)
+	assert.True(t, errors.Is(err, ErrCollectionDisabled))
+
+	iter := c.Find(nil).Iter()
+	assert.False(t, iter.Next(&result))
+	assert.True(t, errors.Is(iter.Close(), ErrCollectionDisabled))
+
+	EnableCollection(testDBName, "events")
+	assert.False(t, IsCollectionDisabled(testDBName, "events"))
+	assert.Empty(t, DisabledCollections())
+}
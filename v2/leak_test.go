@@ -0,0 +1,92 @@
+package mgohttp
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/goleak"
+)
+
+func newLeakTestHandler(h http.HandlerFunc) *SessionHandler {
+	handler := NewSessionHandler(SessionHandlerConfig{
+		Database: testDBName,
+		Timeout:  handlerTimeout,
+		Handler:  h,
+	}).(*SessionHandler)
+	handler.errorCode = testingStatusCode
+	return handler
+}
+
+func TestServeHTTPNoLeakOnSuccess(t *testing.T) {
+	defer goleak.VerifyNone(t, goleak.IgnoreCurrent())
+
+	handler := newLeakTestHandler(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+	})
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+	assert.Equal(t, http.StatusCreated, rec.Code)
+	assert.Equal(t, SessionHandlerStats{}, handler.Stats())
+}
+
+func TestServeHTTPNoLeakOnTimeout(t *testing.T) {
+	defer goleak.VerifyNone(t, goleak.IgnoreCurrent())
+
+	release := make(chan struct{})
+	handler := newLeakTestHandler(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	})
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+	assert.Equal(t, testingStatusCode, rec.Code)
+	assert.Equal(t, SessionHandlerStats{TimedOut: 1, Abandoned: 1}, handler.Stats())
+
+	close(release)
+	assert.Eventually(t, func() bool {
+		return handler.Stats().Abandoned == 0
+	}, time.Second, time.Millisecond)
+}
+
+func TestServeHTTPNoLeakOnClientAbort(t *testing.T) {
+	defer goleak.VerifyNone(t, goleak.IgnoreCurrent())
+
+	handler := newLeakTestHandler(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/", nil).WithContext(ctx))
+	assert.Equal(t, int64(0), handler.Stats().InFlight)
+}
+
+func TestServeHTTPNoLeakOnPanic(t *testing.T) {
+	defer goleak.VerifyNone(t, goleak.IgnoreCurrent())
+
+	handler := newLeakTestHandler(func(w http.ResponseWriter, r *http.Request) {
+		panic("boom")
+	})
+	assert.PanicsWithValue(t, "boom", func() {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	})
+	assert.Equal(t, SessionHandlerStats{}, handler.Stats())
+}
+
+func TestServeHTTPSessionClosedPanicDoesNotWaitForTimeout(t *testing.T) {
+	defer goleak.VerifyNone(t, goleak.IgnoreCurrent())
+
+	handler := newLeakTestHandler(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusAccepted)
+		panic("Session already closed")
+	})
+	handler.cfg.Timeout = time.Minute
+	rec := httptest.NewRecorder()
+	start := time.Now()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+	assert.Less(t, int64(time.Since(start)), int64(time.Second))
+	assert.Equal(t, http.StatusAccepted, rec.Code)
+}
@@ -0,0 +1,75 @@
+package mgohttp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// ErrUnboundedQuery is the sentinel wrapped by every UnboundedQueryError.
+var ErrUnboundedQuery = errors.New("query has no limit")
+
+// UnboundedQueryError is returned by All when the LimitPolicy requires a limit the query
+// doesn't have.
+type UnboundedQueryError struct {
+	Collection string
+}
+
+func (e UnboundedQueryError) Error() string {
+	return fmt.Sprintf("mgohttp: %s: %s", e.Collection, ErrUnboundedQuery)
+}
+
+// Unwrap allows errors.Is(err, ErrUnboundedQuery).
+func (e UnboundedQueryError) Unwrap() error {
+	return ErrUnboundedQuery
+}
+
+// LimitPolicy requires a Limit on the Find().All() queries of large collections, guarding
+// against accidentally loading the whole collection into memory.
+type LimitPolicy struct {
+	// Collections the policy applies to, every collection when empty.
+	Collections []string
+	// DefaultLimit, when set, is applied to queries without a limit instead of rejecting
+	// them with an UnboundedQueryError. The span is tagged either way.
+	DefaultLimit int
+}
+
+func (p LimitPolicy) appliesTo(collection string) bool {
+	if len(p.Collections) == 0 {
+		return true
+	}
+	for _, c := range p.Collections {
+		if c == collection {
+			return true
+		}
+	}
+	return false
+}
+
+// enforceLimit applies the handler's LimitPolicy to a query about to be run with All.
+func (q tracedMongoQuery) enforceLimit() (tracedMongoQuery, error) {
+	n, err := enforcedLimit(q.ctx, q.op, q.spec)
+	if n != 0 {
+		return q.Limit(n).(tracedMongoQuery), nil
+	}
+	return q, err
+}
+
+// enforcedLimit returns the limit the handler's LimitPolicy sets on the query of spec, traced
+// by op, zero when it sets none, or an UnboundedQueryError when it rejects the query.
+func enforcedLimit(ctx context.Context, op *opSpan, spec querySpec) (int, error) {
+	h := handlerFromContext(ctx)
+	if h == nil || h.cfg.LimitPolicy == nil || spec.limit != 0 {
+		return 0, nil
+	}
+	collection := spec.collection.Name
+	if !h.cfg.LimitPolicy.appliesTo(collection) {
+		return 0, nil
+	}
+	if h.cfg.LimitPolicy.DefaultLimit > 0 {
+		op.SetTag(TagDefaultLimit, h.cfg.LimitPolicy.DefaultLimit)
+		return h.cfg.LimitPolicy.DefaultLimit, nil
+	}
+	op.SetTag(TagUnboundedQuery, true)
+	return 0, UnboundedQueryError{Collection: collection}
+}
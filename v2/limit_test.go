@@ -0,0 +1,49 @@
+package mgohttp
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	mgo "gopkg.in/mgo.v2"
+	bson "gopkg.in/mgo.v2/bson"
+)
+
+func limitTestCollection(policy *LimitPolicy, name string) tracedMgoCollection {
+	h := &SessionHandler{cfg: SessionHandlerConfig{LimitPolicy: policy}}
+	return tracedMgoCollection{
+		collectionName: name,
+		collection: &mgo.Collection{Name: name, Database: &mgo.Database{
+			Name:    testDBName,
+			Session: &mgo.Session{},
+		}},
+		ctx: context.WithValue(context.Background(), handlerKey, h),
+	}
+}
+
+func TestLimitPolicyRejects(t *testing.T) {
+	policy := &LimitPolicy{Collections: []string{"events"}}
+	var docs []bson.M
+	err := limitTestCollection(policy, "events").Find(bson.M{"org": 1}).All(&docs)
+	assert.True(t, errors.Is(err, ErrUnboundedQuery))
+	assert.Equal(t, UnboundedQueryError{Collection: "events"}, err)
+	assert.False(t, isHealthError(err))
+
+	q := limitTestCollection(policy, "users").Find(nil).(tracedMongoQuery)
+	_, err = q.enforceLimit()
+	assert.NoError(t, err, "users isn't covered by the policy")
+
+	q = limitTestCollection(policy, "events").Find(nil).Limit(10).(tracedMongoQuery)
+	_, err = q.enforceLimit()
+	assert.NoError(t, err)
+}
+
+func TestLimitPolicyDefaultLimit(t *testing.T) {
+	policy := &LimitPolicy{DefaultLimit: 500}
+	q := limitTestCollection(policy, "events").Find(nil).(tracedMongoQuery)
+	q, err := q.enforceLimit()
+	require.NoError(t, err)
+	assert.Equal(t, 500, q.spec.limit)
+}
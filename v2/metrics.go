@@ -0,0 +1,176 @@
+package mgohttp
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Metrics exports Prometheus metrics for the sessions and operations of the SessionHandlers
+// it's set on, see SessionHandlerConfig.Metrics. Several handlers can share one Metrics.
+type Metrics struct {
+	sessionsOpened    prometheus.Counter
+	sessionTimeouts   prometheus.Counter
+	inflightSessions  prometheus.Gauge
+	queryDuration     *prometheus.HistogramVec
+	bufferedResponse  prometheus.Histogram
+	sessionsThrottled *prometheus.CounterVec
+	mirroredReads     *prometheus.CounterVec
+	cursorGetMores    *prometheus.HistogramVec
+	cursorBatchDocs   *prometheus.HistogramVec
+	cursorLifetime    *prometheus.HistogramVec
+	parentRedials     *prometheus.CounterVec
+}
+
+// NewMetrics registers the mgohttp metrics with reg:
+//
+//   - mgohttp_sessions_opened_total counts the sessions copied for requests.
+//   - mgohttp_session_timeouts_total counts the requests that hit the handler's timeout.
+//   - mgohttp_inflight_sessions is the number of request sessions currently open.
+//   - mgohttp_query_duration_seconds{collection,operation} is the latency of the operations.
+//   - mgohttp_sessions_throttled_total{outcome} counts the requests beyond
+//     MaxConcurrentSessions, that "waited" for a session or were "rejected".
+//   - mgohttp_buffered_response_bytes is the size of the response bodies buffered by the
+//     handlers, which don't stream them.
+//   - mgohttp_mirrored_reads_total{outcome} counts the reads sampled by the handler's Mirror,
+//     that the shadow cluster answered ("ok"), "failed", or that were "dropped".
+//   - mgohttp_cursor_getmores{collection} is the number of getMore round trips of the
+//     cursors, and mgohttp_cursor_batch_docs{collection} their average batch size, for the
+//     cursors whose getMores are known, see TagCursorGetMores.
+//   - mgohttp_cursor_lifetime_seconds{collection} is the time the cursors were open.
+//   - mgohttp_parent_redials_total{outcome} counts the parent sessions dialed from a URL
+//     that were "redialed", or "failed" to, after their operations kept losing their
+//     connection, see SessionHandlerConfig.URL.
+func NewMetrics(reg prometheus.Registerer) (*Metrics, error) {
+	m := &Metrics{
+		sessionsOpened: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: "mgohttp",
+			Name:      "sessions_opened_total",
+			Help:      "Sessions copied for requests.",
+		}),
+		sessionTimeouts: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: "mgohttp",
+			Name:      "session_timeouts_total",
+			Help:      "Requests that hit the session handler's timeout.",
+		}),
+		inflightSessions: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: "mgohttp",
+			Name:      "inflight_sessions",
+			Help:      "Request sessions currently open.",
+		}),
+		queryDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: "mgohttp",
+			Name:      "query_duration_seconds",
+			Help:      "Latency of the Mongo operations.",
+			Buckets:   prometheus.ExponentialBuckets(0.001, 2, 15),
+		}, []string{"collection", "operation"}),
+		bufferedResponse: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Namespace: "mgohttp",
+			Name:      "buffered_response_bytes",
+			Help:      "Size of the response bodies buffered by the session handlers.",
+			Buckets:   prometheus.ExponentialBuckets(256, 4, 10),
+		}),
+		sessionsThrottled: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "mgohttp",
+			Name:      "sessions_throttled_total",
+			Help:      "Requests beyond the session handler's MaxConcurrentSessions.",
+		}, []string{"outcome"}),
+		mirroredReads: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "mgohttp",
+			Name:      "mirrored_reads_total",
+			Help:      "Reads mirrored to the shadow cluster of the session handler's Mirror.",
+		}, []string{"outcome"}),
+		cursorGetMores: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: "mgohttp",
+			Name:      "cursor_getmores",
+			Help:      "GetMore round trips of the cursors after their first batch.",
+			Buckets:   append([]float64{0}, prometheus.ExponentialBuckets(1, 2, 12)...),
+		}, []string{"collection"}),
+		cursorBatchDocs: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: "mgohttp",
+			Name:      "cursor_batch_docs",
+			Help:      "Average number of documents per batch of the cursors.",
+			Buckets:   prometheus.ExponentialBuckets(1, 2, 18),
+		}, []string{"collection"}),
+		cursorLifetime: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: "mgohttp",
+			Name:      "cursor_lifetime_seconds",
+			Help:      "Time the cursors were open.",
+			Buckets:   prometheus.ExponentialBuckets(0.001, 2, 18),
+		}, []string{"collection"}),
+		parentRedials: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "mgohttp",
+			Name:      "parent_redials_total",
+			Help:      "Re-dials of the parent sessions whose operations kept losing their connection.",
+		}, []string{"outcome"}),
+	}
+	for _, c := range []prometheus.Collector{m.sessionsOpened, m.sessionTimeouts, m.inflightSessions, m.queryDuration, m.bufferedResponse, m.sessionsThrottled, m.mirroredReads, m.cursorGetMores, m.cursorBatchDocs, m.cursorLifetime, m.parentRedials} {
+		if err := reg.Register(c); err != nil {
+			return nil, err
+		}
+	}
+	return m, nil
+}
+
+// The recording methods are safe to call on nil Metrics, for handlers without metrics.
+
+func (m *Metrics) sessionOpened() {
+	if m != nil {
+		m.sessionsOpened.Inc()
+		m.inflightSessions.Inc()
+	}
+}
+
+func (m *Metrics) sessionClosed() {
+	if m != nil {
+		m.inflightSessions.Dec()
+	}
+}
+
+func (m *Metrics) sessionTimedOut() {
+	if m != nil {
+		m.sessionTimeouts.Inc()
+	}
+}
+
+func (m *Metrics) observeOp(collection, op string, elapsed time.Duration) {
+	if m != nil {
+		m.queryDuration.WithLabelValues(collection, op).Observe(elapsed.Seconds())
+	}
+}
+
+func (m *Metrics) sessionThrottled(outcome string) {
+	if m != nil {
+		m.sessionsThrottled.WithLabelValues(outcome).Inc()
+	}
+}
+
+func (m *Metrics) observeBufferedResponse(n int) {
+	if m != nil {
+		m.bufferedResponse.Observe(float64(n))
+	}
+}
+
+func (m *Metrics) mirroredRead(outcome string) {
+	if m != nil {
+		m.mirroredReads.WithLabelValues(outcome).Inc()
+	}
+}
+
+func (m *Metrics) parentRedialed(outcome string) {
+	if m != nil {
+		m.parentRedials.WithLabelValues(outcome).Inc()
+	}
+}
+
+// observeCursor records the stats of a closed cursor, getMores is negative when unknown.
+func (m *Metrics) observeCursor(collection string, getMores int, avgBatch float64, lifetime time.Duration) {
+	if m == nil {
+		return
+	}
+	m.cursorLifetime.WithLabelValues(collection).Observe(lifetime.Seconds())
+	if getMores >= 0 {
+		m.cursorGetMores.WithLabelValues(collection).Observe(float64(getMores))
+		m.cursorBatchDocs.WithLabelValues(collection).Observe(avgBatch)
+	}
+}
@@ -0,0 +1,91 @@
+package mgohttp
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/opentracing/opentracing-go/mocktracer"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	mgo "gopkg.in/mgo.v2"
+	bson "gopkg.in/mgo.v2/bson"
+)
+
+func TestMetrics(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	metrics, err := NewMetrics(reg)
+	require.NoError(t, err)
+	_, err = NewMetrics(reg)
+	assert.Error(t, err, "metrics can only be registered once")
+
+	release := make(chan struct{})
+	defer close(release)
+	handler := NewSessionHandler(SessionHandlerConfig{
+		Database: testDBName,
+		Timeout:  handlerTimeout,
+		NewSession: func(ctx context.Context) (*mgo.Session, error) {
+			return &mgo.Session{}, nil
+		},
+		// the session isn't connected, so the insert fails with a DriverPanicError
+		RecoverDriverPanics: true,
+		Metrics:             metrics,
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			FromContext(r.Context(), testDBName).DB(testDBName).C("users").Insert(bson.M{"a": 1})
+			if r.URL.Path == "/slow" {
+				<-release
+			}
+		}),
+	})
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/slow", nil))
+
+	assert.Equal(t, 2.0, testutil.ToFloat64(metrics.sessionsOpened))
+	assert.Equal(t, 1.0, testutil.ToFloat64(metrics.sessionTimeouts))
+	assert.Equal(t, 0.0, testutil.ToFloat64(metrics.inflightSessions))
+
+	ctx := context.WithValue(context.Background(), handlerKey, handler)
+	sp, _ := startOp(ctx, "find", "users")
+	sp.done(nil)
+	sp.Finish()
+	assert.Equal(t, 1, testutil.CollectAndCount(metrics.queryDuration, "mgohttp_query_duration_seconds"))
+}
+
+func TestMetricsBufferedResponse(t *testing.T) {
+	metrics, err := NewMetrics(prometheus.NewRegistry())
+	require.NoError(t, err)
+	tracer := mocktracer.New()
+	handler := NewSessionHandler(SessionHandlerConfig{
+		Database: testDBName,
+		Timeout:  handlerTimeout,
+		NewSession: func(ctx context.Context) (*mgo.Session, error) {
+			return &mgo.Session{}, nil
+		},
+		Metrics: metrics,
+		Tracer:  tracer,
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			FromContext(r.Context(), testDBName)
+			w.Write([]byte(strings.Repeat("a", 1000)))
+		}),
+	})
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+
+	m := &dto.Metric{}
+	require.NoError(t, metrics.bufferedResponse.Write(m))
+	assert.Equal(t, uint64(1), m.GetHistogram().GetSampleCount())
+	assert.Equal(t, 1000.0, m.GetHistogram().GetSampleSum())
+
+	var root *mocktracer.MockSpan
+	for _, sp := range tracer.FinishedSpans() {
+		if sp.OperationName == "mgohttp" {
+			root = sp
+		}
+	}
+	require.NotNil(t, root)
+	assert.Equal(t, 1000, root.Tag(TagBufferedResponseBytes))
+}
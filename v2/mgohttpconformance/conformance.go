@@ -0,0 +1,275 @@
+// Package mgohttpconformance is a test suite asserting the behavioral contract of the mgohttp
+// interfaces, MongoSession, MongoDatabase, MongoCollection, MongoQuery and MongoIter, so that
+// every backend behind them, the mgo wrappers and the fakes alike, behaves the same way.
+//
+// A backend runs the suite from one of its tests:
+//
+//	func TestConformance(t *testing.T) {
+//		mgohttpconformance.Run(t, func(t *testing.T) (mgohttp.MongoSession, string) {
+//			return newBackendSession(t), "conformance"
+//		})
+//	}
+package mgohttpconformance
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/Clever/mgohttp/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	mgo "gopkg.in/mgo.v2"
+	bson "gopkg.in/mgo.v2/bson"
+)
+
+// Factory returns a session of the backend under test along with the name of a database
+// that's empty, and that no other test uses. It's called once per test of the suite, and
+// should clean up after the test with t.Cleanup.
+type Factory func(t *testing.T) (sess mgohttp.MongoSession, database string)
+
+type doc struct {
+	ID    bson.ObjectId `bson:"_id"`
+	Name  string        `bson:"name"`
+	Order int           `bson:"order"`
+	Tag   string        `bson:"tag,omitempty"`
+}
+
+// seed inserts n documents, ordered by their order field, in the collection "docs".
+func seed(t *testing.T, c mgohttp.MongoCollection, n int) []doc {
+	docs := make([]doc, n)
+	inserts := make([]interface{}, n)
+	for i := range docs {
+		docs[i] = doc{ID: bson.NewObjectId(), Name: string(rune('a' + i)), Order: i}
+		inserts[i] = docs[i]
+	}
+	require.NoError(t, c.Insert(inserts...))
+	return docs
+}
+
+// Run runs the conformance suite against the backend returned by newBackend, as subtests of
+// t.
+func Run(t *testing.T, newBackend Factory) {
+	collection := func(t *testing.T) (mgohttp.MongoSession, mgohttp.MongoCollection) {
+		sess, database := newBackend(t)
+		return sess, sess.DB(database).C("docs")
+	}
+	for _, test := range []struct {
+		name string
+		run  func(t *testing.T, sess mgohttp.MongoSession, c mgohttp.MongoCollection)
+	}{
+		{"Session/Ping", testPing},
+		{"Collection/InsertAndFindId", testInsertAndFindId},
+		{"Collection/DuplicateKey", testDuplicateKey},
+		{"Collection/NotFound", testNotFound},
+		{"Collection/Update", testUpdate},
+		{"Collection/Upsert", testUpsert},
+		{"Collection/Remove", testRemove},
+		{"Collection/Stats", testCollectionStats},
+		{"Query/Chaining", testQueryChaining},
+		{"Query/Count", testQueryCount},
+		{"Query/Apply", testQueryApply},
+		{"Query/Raw", testQueryRaw},
+		{"Query/Paginate", testPaginate},
+		{"Iter/Protocol", testIterProtocol},
+		{"Iter/All", testIterAll},
+	} {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			sess, c := collection(t)
+			test.run(t, sess, c)
+		})
+	}
+}
+
+func testPing(t *testing.T, sess mgohttp.MongoSession, c mgohttp.MongoCollection) {
+	assert.NoError(t, sess.Ping())
+}
+
+func testInsertAndFindId(t *testing.T, sess mgohttp.MongoSession, c mgohttp.MongoCollection) {
+	docs := seed(t, c, 2)
+	var found doc
+	require.NoError(t, c.FindId(docs[1].ID).One(&found))
+	assert.Equal(t, docs[1], found)
+}
+
+func testDuplicateKey(t *testing.T, sess mgohttp.MongoSession, c mgohttp.MongoCollection) {
+	docs := seed(t, c, 1)
+	err := c.Insert(docs[0])
+	require.Error(t, err)
+	// the wrappers wrap the driver errors, which mgo.IsDup doesn't see through
+	var lerr *mgo.LastError
+	require.True(t, errors.As(err, &lerr), "duplicate key errors unwrap to *mgo.LastError, got %T", err)
+	assert.Equal(t, 11000, lerr.Code)
+}
+
+func testNotFound(t *testing.T, sess mgohttp.MongoSession, c mgohttp.MongoCollection) {
+	seed(t, c, 1)
+	missing := bson.NewObjectId()
+	assert.True(t, errors.Is(c.FindId(missing).One(&doc{}), mgo.ErrNotFound))
+	assert.True(t, errors.Is(c.Find(bson.M{"name": "missing"}).One(&doc{}), mgo.ErrNotFound))
+	assert.True(t, errors.Is(c.UpdateId(missing, bson.M{"$set": bson.M{"tag": "x"}}), mgo.ErrNotFound))
+	assert.True(t, errors.Is(c.RemoveId(missing), mgo.ErrNotFound))
+
+	var docs []doc
+	require.NoError(t, c.Find(bson.M{"name": "missing"}).All(&docs))
+	assert.Empty(t, docs, "All with no match leaves an empty result")
+}
+
+func testUpdate(t *testing.T, sess mgohttp.MongoSession, c mgohttp.MongoCollection) {
+	docs := seed(t, c, 3)
+	require.NoError(t, c.UpdateId(docs[0].ID, bson.M{"$set": bson.M{"tag": "first"}}))
+	var found doc
+	require.NoError(t, c.FindId(docs[0].ID).One(&found))
+	assert.Equal(t, "first", found.Tag)
+
+	info, err := c.UpdateAll(bson.M{"order": bson.M{"$gte": 1}}, bson.M{"$set": bson.M{"tag": "rest"}})
+	require.NoError(t, err)
+	assert.Equal(t, 2, info.Matched)
+	n, err := c.Find(bson.M{"tag": "rest"}).Count()
+	require.NoError(t, err)
+	assert.Equal(t, 2, n)
+}
+
+func testUpsert(t *testing.T, sess mgohttp.MongoSession, c mgohttp.MongoCollection) {
+	info, err := c.Upsert(bson.M{"name": "new"}, bson.M{"$set": bson.M{"order": 7}})
+	require.NoError(t, err)
+	assert.NotNil(t, info.UpsertedId)
+
+	info, err = c.Upsert(bson.M{"name": "new"}, bson.M{"$set": bson.M{"order": 8}})
+	require.NoError(t, err)
+	assert.Nil(t, info.UpsertedId)
+	assert.Equal(t, 1, info.Matched)
+	var found doc
+	require.NoError(t, c.Find(bson.M{"name": "new"}).One(&found))
+	assert.Equal(t, 8, found.Order)
+}
+
+func testRemove(t *testing.T, sess mgohttp.MongoSession, c mgohttp.MongoCollection) {
+	docs := seed(t, c, 4)
+	require.NoError(t, c.Remove(bson.M{"_id": docs[0].ID}))
+	info, err := c.RemoveAll(bson.M{"order": bson.M{"$gte": 2}})
+	require.NoError(t, err)
+	assert.Equal(t, 2, info.Removed)
+	n, err := c.Find(nil).Count()
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+}
+
+func testQueryChaining(t *testing.T, sess mgohttp.MongoSession, c mgohttp.MongoCollection) {
+	docs := seed(t, c, 5)
+	var found []doc
+	require.NoError(t, c.Find(nil).Sort("-order").Skip(1).Limit(2).All(&found))
+	assert.Equal(t, []doc{docs[3], docs[2]}, found)
+
+	// each modifier returns the query, in any order
+	var projected []bson.M
+	require.NoError(t, c.Find(bson.M{"order": bson.M{"$lt": 2}}).Limit(5).Select(bson.M{"name": 1, "_id": 0}).Sort("order").All(&projected))
+	assert.Equal(t, []bson.M{{"name": "a"}, {"name": "b"}}, projected)
+
+	require.NoError(t, c.Find(bson.M{"order": bson.M{"$gt": 0}}).And(bson.M{"order": bson.M{"$lt": 3}}).Sort("order").All(&found))
+	assert.Equal(t, []doc{docs[1], docs[2]}, found)
+	require.NoError(t, c.Find(nil).And(bson.M{"order": 4}).All(&found))
+	assert.Equal(t, []doc{docs[4]}, found)
+}
+
+func testPaginate(t *testing.T, sess mgohttp.MongoSession, c mgohttp.MongoCollection) {
+	docs := seed(t, c, 5)
+	signer := mgohttp.NewPageTokenSigner([]byte("key"))
+	pages := func(opts mgohttp.PageOptions) [][]doc {
+		var pages [][]doc
+		for {
+			page, err := mgohttp.Paginate[doc](context.Background(), c.Find(bson.M{"order": bson.M{"$gte": 0}}), opts)
+			require.NoError(t, err)
+			pages = append(pages, page.Items)
+			if page.NextToken == "" {
+				return pages
+			}
+			opts.After = page.NextToken
+		}
+	}
+	assert.Equal(t, [][]doc{{docs[0], docs[1]}, {docs[2], docs[3]}, {docs[4]}},
+		pages(mgohttp.PageOptions{Limit: 2, SortField: "order", Signer: signer}))
+	assert.Equal(t, [][]doc{{docs[4], docs[3], docs[2]}, {docs[1], docs[0]}},
+		pages(mgohttp.PageOptions{Limit: 3, SortField: "order", Descending: true}))
+	assert.Equal(t, [][]doc{docs}, pages(mgohttp.PageOptions{}), "sorted on _id, ObjectIds increase")
+
+	_, err := mgohttp.Paginate[doc](context.Background(), c.Find(nil), mgohttp.PageOptions{After: "forged", Signer: signer})
+	assert.True(t, errors.Is(err, mgohttp.ErrInvalidPageToken))
+}
+
+func testCollectionStats(t *testing.T, sess mgohttp.MongoSession, c mgohttp.MongoCollection) {
+	seed(t, c, 3)
+	stats, err := c.Stats()
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), stats.Count)
+	assert.Positive(t, stats.Size)
+	assert.GreaterOrEqual(t, stats.NumIndexes, 1, "the _id index")
+	assert.False(t, stats.Capped)
+}
+
+func testQueryCount(t *testing.T, sess mgohttp.MongoSession, c mgohttp.MongoCollection) {
+	seed(t, c, 5)
+	n, err := c.Find(bson.M{"order": bson.M{"$gt": 1}}).Count()
+	require.NoError(t, err)
+	assert.Equal(t, 3, n)
+	n, err = c.Find(nil).Limit(2).Count()
+	require.NoError(t, err)
+	assert.Equal(t, 2, n, "Count honors Limit")
+}
+
+func testQueryApply(t *testing.T, sess mgohttp.MongoSession, c mgohttp.MongoCollection) {
+	docs := seed(t, c, 2)
+	var found doc
+	info, err := c.FindId(docs[0].ID).Apply(mgo.Change{Update: bson.M{"$set": bson.M{"tag": "applied"}}, ReturnNew: true}, &found)
+	require.NoError(t, err)
+	assert.Equal(t, 1, info.Updated)
+	assert.Equal(t, "applied", found.Tag)
+
+	_, err = c.FindId(bson.NewObjectId()).Apply(mgo.Change{Update: bson.M{"$set": bson.M{"tag": "x"}}}, &found)
+	assert.True(t, errors.Is(err, mgo.ErrNotFound))
+}
+
+func testQueryRaw(t *testing.T, sess mgohttp.MongoSession, c mgohttp.MongoCollection) {
+	docs := seed(t, c, 3)
+	raw, err := c.FindId(docs[1].ID).OneRaw()
+	require.NoError(t, err)
+	var found doc
+	require.NoError(t, raw.Unmarshal(&found))
+	assert.Equal(t, docs[1], found)
+
+	raws, err := c.Find(nil).Sort("order").AllRaw()
+	require.NoError(t, err)
+	require.Len(t, raws, 3)
+	require.NoError(t, raws[2].Unmarshal(&found))
+	assert.Equal(t, docs[2], found)
+
+	_, err = c.FindId(bson.NewObjectId()).OneRaw()
+	assert.True(t, errors.Is(err, mgo.ErrNotFound))
+	raws, err = c.Find(bson.M{"order": 10}).AllRaw()
+	require.NoError(t, err)
+	assert.Empty(t, raws)
+}
+
+func testIterProtocol(t *testing.T, sess mgohttp.MongoSession, c mgohttp.MongoCollection) {
+	docs := seed(t, c, 3)
+	iter := c.Find(nil).Sort("order").Batch(2).Iter()
+	var found []doc
+	var d doc
+	for iter.Next(&d) {
+		found = append(found, d)
+	}
+	assert.Equal(t, docs, found)
+	assert.True(t, iter.Done(), "Done once Next returned false")
+	assert.False(t, iter.Timeout())
+	assert.NoError(t, iter.Err())
+	assert.NoError(t, iter.Close())
+	assert.False(t, iter.Next(&d), "Next after Close")
+}
+
+func testIterAll(t *testing.T, sess mgohttp.MongoSession, c mgohttp.MongoCollection) {
+	docs := seed(t, c, 3)
+	var found []doc
+	require.NoError(t, c.Find(nil).Sort("order").Iter().All(&found))
+	assert.Equal(t, docs, found)
+}
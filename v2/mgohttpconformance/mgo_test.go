@@ -0,0 +1,49 @@
+//go:build integration
+
+package mgohttpconformance_test
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/Clever/mgohttp/v2"
+	"github.com/Clever/mgohttp/v2/mgohttpconformance"
+	"github.com/Clever/mgohttp/v2/mgohttptest"
+	"github.com/stretchr/testify/require"
+	mgo "gopkg.in/mgo.v2"
+	bson "gopkg.in/mgo.v2/bson"
+)
+
+// TestMgoConformance runs the suite against the mgo wrappers and the server at MONGO_URL, up to
+// MongoDB 5.0:
+//
+//	go test -tags integration ./mgohttpconformance
+func TestMgoConformance(t *testing.T) {
+	url := os.Getenv("MONGO_URL")
+	if url == "" {
+		url = mgohttptest.DefaultMongoURL
+	}
+	parent, err := mgo.Dial(url)
+	require.NoError(t, err)
+	defer parent.Close()
+	var hello struct {
+		MaxWireVersion int `bson:"maxWireVersion"`
+	}
+	require.NoError(t, parent.Run("isMaster", &hello))
+	// MongoDB 5.1 (wire version 14) dropped the OP_QUERY opcode mgo runs commands with
+	if hello.MaxWireVersion > 13 {
+		t.Skipf("mgo doesn't support MongoDB 5.1 and later (wire version %d)", hello.MaxWireVersion)
+	}
+
+	mgohttpconformance.Run(t, func(t *testing.T) (mgohttp.MongoSession, string) {
+		database := fmt.Sprintf("mgohttpconformance-%s", bson.NewObjectId().Hex())
+		ctx := mgohttptest.MakeContext(context.Background(), mgohttptest.Config{Name: database, Sess: parent})
+		t.Cleanup(func() {
+			parent.DB(database).DropDatabase()
+			ctx.Close()
+		})
+		return mgohttp.FromContext(ctx, database), database
+	})
+}
@@ -0,0 +1,53 @@
+//go:build integration
+
+package mgohttpconformance_test
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/Clever/mgohttp/v2"
+	"github.com/Clever/mgohttp/v2/mgohttpconformance"
+	"github.com/Clever/mgohttp/v2/mgohttptest"
+	opentracing "github.com/opentracing/opentracing-go"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	mgo "gopkg.in/mgo.v2"
+	bson "gopkg.in/mgo.v2/bson"
+)
+
+// TestMongoDriverConformance runs the suite against the sessions of NewMongoDriver and the
+// server at MONGO_URL, which must be MongoDB 3.6 or later:
+//
+//	go test -tags integration ./mgohttpconformance
+func TestMongoDriverConformance(t *testing.T) {
+	url := os.Getenv("MONGO_URL")
+	if url == "" {
+		url = mgohttptest.DefaultMongoURL
+	}
+	if !strings.HasPrefix(url, "mongodb://") {
+		url = "mongodb://" + url
+	}
+	client, err := mongo.Connect(context.Background(), options.Client().ApplyURI(url))
+	require.NoError(t, err)
+	defer client.Disconnect(context.Background())
+	driver := mgohttp.NewMongoDriver(client)
+
+	mgohttpconformance.Run(t, func(t *testing.T) (mgohttp.MongoSession, string) {
+		database := fmt.Sprintf("mgohttpconformance-%s", bson.NewObjectId().Hex())
+		_, ctx := opentracing.StartSpanFromContext(context.Background(), "test")
+		ctx, cancel := context.WithCancel(ctx)
+		sess, err := driver.NewSession(ctx, database, &mgo.Safe{})
+		require.NoError(t, err)
+		t.Cleanup(func() {
+			client.Database(database).Drop(context.Background())
+			sess.Close()
+			cancel()
+		})
+		return sess.Session(ctx, nil), database
+	})
+}
@@ -0,0 +1,611 @@
+package mgohttptest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Clever/mgohttp/v2"
+	mgo "gopkg.in/mgo.v2"
+	bson "gopkg.in/mgo.v2/bson"
+)
+
+// ErrFakeUnsupported is returned by the operations FakeMongo doesn't implement, e.g. GridFS,
+// tailable cursors, change streams, collations, and selectors or updates with operators it
+// doesn't know.
+var ErrFakeUnsupported = errors.New("mgohttptest: not supported by FakeMongo")
+
+// unsupported returns an error wrapping ErrFakeUnsupported that says what isn't supported.
+func unsupported(format string, args ...interface{}) error {
+	return fmt.Errorf("%w: %s", ErrFakeUnsupported, fmt.Sprintf(format, args...))
+}
+
+// FakeMongo is an in-memory stand-in for a Mongo server, for the unit tests of handlers that
+// don't need a real one. Inject it with Config.Fake. It implements the basics:
+//
+//   - selectors with equality on (dotted) fields, the comparison operators, $in, $nin,
+//     $exists, $regex, $size, $all, $and, $or and $nor
+//   - inserts, removes, and updates with replacement documents, $set, $unset, $inc, $push,
+//     $addToSet, $pull and $setOnInsert, including upserts and Apply
+//   - finds with Sort, Skip, Limit, Select and Count
+//   - unique indexes
+//
+// Anything else fails with ErrFakeUnsupported rather than behave differently from Mongo. Like
+// Mongo, it stores copies: changing a document after it's inserted doesn't change the
+// stored one. It's safe for concurrent use.
+type FakeMongo struct {
+	mu        sync.Mutex
+	databases map[string]map[string]*fakeCollectionData
+}
+
+type fakeCollectionData struct {
+	docs    []bson.M
+	indexes []mgo.Index
+	info    mgo.CollectionInfo // set by Create
+}
+
+// NewFakeMongo returns an empty FakeMongo.
+func NewFakeMongo() *FakeMongo {
+	return &FakeMongo{databases: map[string]map[string]*fakeCollectionData{}}
+}
+
+// Session returns a session on the fake. All its sessions share the same data.
+func (f *FakeMongo) Session() mgohttp.MongoSession {
+	return fakeSession{f: f}
+}
+
+// collection returns the data of a collection, creating it if create is set. It must be
+// called with f.mu held.
+func (f *FakeMongo) collection(database, name string, create bool) *fakeCollectionData {
+	db := f.databases[database]
+	if db == nil {
+		if !create {
+			return nil
+		}
+		db = map[string]*fakeCollectionData{}
+		f.databases[database] = db
+	}
+	c := db[name]
+	if c == nil && create {
+		c = &fakeCollectionData{}
+		db[name] = c
+	}
+	return c
+}
+
+type fakeSession struct {
+	f *FakeMongo
+}
+
+func (s fakeSession) DB(name string) mgohttp.MongoDatabase {
+	return fakeDatabase{f: s.f, name: name}
+}
+func (s fakeSession) Ping() error { return nil }
+func (s fakeSession) PingWithInfo(ctx context.Context) (mgohttp.PingInfo, error) {
+	return mgohttp.PingInfo{Address: "fake", State: "standalone"}, nil
+}
+func (s fakeSession) ServerVersion(ctx context.Context) (mgo.BuildInfo, error) {
+	return mgo.BuildInfo{Version: "4.4.0", VersionArray: []int{4, 4, 0}}, nil
+}
+func (s fakeSession) SetSafe(safe *mgo.Safe) {}
+
+// WithTimeout returns the session as is, the fake has no timeouts.
+func (s fakeSession) WithTimeout(d time.Duration) mgohttp.MongoSession { return s }
+
+// WithTransaction fails like the mgo sessions, see mgohttp.ErrTransactionsUnsupported.
+func (s fakeSession) WithTransaction(ctx context.Context, fn func(tx mgohttp.MongoSession) error) error {
+	return mgohttp.ErrTransactionsUnsupported
+}
+
+type fakeDatabase struct {
+	f    *FakeMongo
+	name string
+}
+
+func (d fakeDatabase) C(name string) mgohttp.MongoCollection {
+	return fakeCollection{f: d.f, database: d.name, name: name}
+}
+
+// Run only supports the ping command.
+func (d fakeDatabase) Run(cmd interface{}, result interface{}) error {
+	switch c := cmd.(type) {
+	case string:
+		if c == "ping" {
+			return nil
+		}
+	case bson.D:
+		if len(c) > 0 && c[0].Name == "ping" {
+			return nil
+		}
+	case bson.M:
+		if _, ok := c["ping"]; ok && len(c) == 1 {
+			return nil
+		}
+	}
+	return unsupported("command %v", cmd)
+}
+
+func (d fakeDatabase) GridFS(prefix string) mgohttp.MongoGridFS {
+	return fakeGridFS{}
+}
+
+func (d fakeDatabase) CollectionNames() ([]string, error) {
+	d.f.mu.Lock()
+	defer d.f.mu.Unlock()
+	names := []string{}
+	for name := range d.f.databases[d.name] {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+func (d fakeDatabase) DropDatabase() error {
+	d.f.mu.Lock()
+	defer d.f.mu.Unlock()
+	delete(d.f.databases, d.name)
+	return nil
+}
+
+func (d fakeDatabase) Watch(pipeline interface{}, opts mgohttp.ChangeStreamOptions) mgohttp.ChangeStream {
+	return failedChangeStream{err: unsupported("change streams")}
+}
+
+// failedChangeStream is the change stream of Watch, which the fake doesn't implement.
+type failedChangeStream struct {
+	err error
+}
+
+func (s failedChangeStream) Next(event *mgohttp.ChangeEvent) bool { return false }
+func (s failedChangeStream) Err() error                           { return s.err }
+func (s failedChangeStream) Timeout() bool                        { return false }
+func (s failedChangeStream) ResumeToken() mgohttp.ResumeToken     { return mgohttp.ResumeToken{} }
+func (s failedChangeStream) Close() error                         { return s.err }
+
+type fakeCollection struct {
+	f        *FakeMongo
+	database string
+	name     string
+}
+
+// write runs fn on a copy of the collection's documents, and keeps its changes unless they
+// violate a unique index.
+func (c fakeCollection) write(fn func(data *fakeCollectionData, docs []bson.M) ([]bson.M, error)) error {
+	c.f.mu.Lock()
+	defer c.f.mu.Unlock()
+	data := c.f.collection(c.database, c.name, true)
+	docs, err := fn(data, append([]bson.M(nil), data.docs...))
+	if err != nil {
+		return err
+	}
+	if err := data.checkUnique(docs); err != nil {
+		return err
+	}
+	data.docs = docs
+	return nil
+}
+
+// read returns the documents matching selector, in their natural order.
+func (c fakeCollection) read(selector interface{}) ([]bson.M, error) {
+	sel, err := toM(selector)
+	if err != nil {
+		return nil, err
+	}
+	c.f.mu.Lock()
+	defer c.f.mu.Unlock()
+	data := c.f.collection(c.database, c.name, false)
+	if data == nil {
+		return nil, nil
+	}
+	return filter(data.docs, sel)
+}
+
+func (c fakeCollection) Find(query interface{}) mgohttp.MongoQuery {
+	return fakeQuery{c: c, selector: query}
+}
+
+func (c fakeCollection) FindId(id bson.ObjectId) mgohttp.MongoQuery {
+	return c.Find(bson.M{"_id": id})
+}
+
+func (c fakeCollection) Insert(docs ...interface{}) error {
+	for _, doc := range docs {
+		m, err := toM(doc)
+		if err != nil {
+			return err
+		}
+		if _, ok := m["_id"]; !ok {
+			m["_id"] = bson.NewObjectId()
+		}
+		// inserts are ordered, the documents before a failing one stay inserted
+		if err := c.write(func(data *fakeCollectionData, stored []bson.M) ([]bson.M, error) {
+			return append(stored, m), nil
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c fakeCollection) Remove(selector interface{}) error {
+	info, err := c.remove(selector, false)
+	if err == nil && info.Removed == 0 {
+		return mgo.ErrNotFound
+	}
+	return err
+}
+
+func (c fakeCollection) RemoveId(id bson.ObjectId) error {
+	return c.Remove(bson.M{"_id": id})
+}
+
+func (c fakeCollection) RemoveAll(selector interface{}) (*mgo.ChangeInfo, error) {
+	return c.remove(selector, true)
+}
+
+func (c fakeCollection) remove(selector interface{}, all bool) (*mgo.ChangeInfo, error) {
+	sel, err := toM(selector)
+	if err != nil {
+		return nil, err
+	}
+	info := &mgo.ChangeInfo{}
+	err = c.write(func(data *fakeCollectionData, docs []bson.M) ([]bson.M, error) {
+		kept := docs[:0:0]
+		for _, doc := range docs {
+			matched := false
+			if all || info.Removed == 0 {
+				if matched, err = matches(doc, sel); err != nil {
+					return nil, err
+				}
+			}
+			if matched {
+				info.Removed++
+				continue
+			}
+			kept = append(kept, doc)
+		}
+		return kept, nil
+	})
+	info.Matched = info.Removed
+	return info, err
+}
+
+func (c fakeCollection) Update(selector interface{}, update interface{}) error {
+	info, err := c.update(selector, update, false, false)
+	if err == nil && info.Matched == 0 {
+		return mgo.ErrNotFound
+	}
+	return err
+}
+
+func (c fakeCollection) UpdateId(id bson.ObjectId, update interface{}) error {
+	return c.Update(bson.M{"_id": id}, update)
+}
+
+func (c fakeCollection) UpdateAll(selector interface{}, update interface{}) (*mgo.ChangeInfo, error) {
+	return c.update(selector, update, true, false)
+}
+
+func (c fakeCollection) Upsert(selector interface{}, update interface{}) (*mgo.ChangeInfo, error) {
+	return c.update(selector, update, false, true)
+}
+
+func (c fakeCollection) update(selector, update interface{}, all, upsert bool) (*mgo.ChangeInfo, error) {
+	sel, err := toM(selector)
+	if err != nil {
+		return nil, err
+	}
+	upd, err := toM(update)
+	if err != nil {
+		return nil, err
+	}
+	info := &mgo.ChangeInfo{}
+	err = c.write(func(data *fakeCollectionData, docs []bson.M) ([]bson.M, error) {
+		for i, doc := range docs {
+			if !all && info.Matched > 0 {
+				break
+			}
+			matched, err := matches(doc, sel)
+			if err != nil {
+				return nil, err
+			}
+			if !matched {
+				continue
+			}
+			updated, err := applyUpdate(doc, upd, false)
+			if err != nil {
+				return nil, err
+			}
+			info.Matched++
+			if !valuesEqual(doc, updated) {
+				info.Updated++
+			}
+			docs[i] = updated
+		}
+		if info.Matched > 0 || !upsert {
+			return docs, nil
+		}
+		inserted, err := upsertDoc(sel, upd)
+		if err != nil {
+			return nil, err
+		}
+		info.UpsertedId = inserted["_id"]
+		return append(docs, inserted), nil
+	})
+	return info, err
+}
+
+func (c fakeCollection) Bulk() mgohttp.MongoBulk {
+	return &fakeBulk{c: c}
+}
+
+func (c fakeCollection) Pipe(pipeline interface{}) mgohttp.MongoPipe {
+	return fakePipe{}
+}
+
+func (c fakeCollection) EnsureIndex(index mgo.Index) error {
+	if index.Name == "" {
+		index.Name = indexName(index.Key)
+	}
+	return c.write(func(data *fakeCollectionData, docs []bson.M) ([]bson.M, error) {
+		indexes := []mgo.Index{}
+		for _, existing := range data.indexes {
+			if existing.Name != index.Name {
+				indexes = append(indexes, existing)
+			}
+		}
+		// the index must hold for the existing documents before it's kept
+		previous := data.indexes
+		data.indexes = append(indexes, index)
+		if err := data.checkUnique(docs); err != nil {
+			data.indexes = previous
+			return nil, err
+		}
+		return docs, nil
+	})
+}
+
+func (c fakeCollection) EnsureIndexKey(key ...string) error {
+	return c.EnsureIndex(mgo.Index{Key: key})
+}
+
+func (c fakeCollection) DropIndex(key ...string) error {
+	return c.DropIndexName(indexName(key))
+}
+
+func (c fakeCollection) DropIndexName(name string) error {
+	return c.write(func(data *fakeCollectionData, docs []bson.M) ([]bson.M, error) {
+		for i, index := range data.indexes {
+			if index.Name == name {
+				data.indexes = append(data.indexes[:i:i], data.indexes[i+1:]...)
+				return docs, nil
+			}
+		}
+		return nil, &mgo.QueryError{Code: 27, Message: fmt.Sprintf("index not found with name [%s]", name)}
+	})
+}
+
+func (c fakeCollection) Indexes() ([]mgo.Index, error) {
+	c.f.mu.Lock()
+	defer c.f.mu.Unlock()
+	indexes := []mgo.Index{{Key: []string{"_id"}, Name: "_id_"}}
+	if data := c.f.collection(c.database, c.name, false); data != nil {
+		indexes = append(indexes, data.indexes...)
+	}
+	sort.SliceStable(indexes[1:], func(i, j int) bool { return indexes[i+1].Name < indexes[j+1].Name })
+	return indexes, nil
+}
+
+func (c fakeCollection) DropCollection() error {
+	c.f.mu.Lock()
+	defer c.f.mu.Unlock()
+	if c.f.collection(c.database, c.name, false) == nil {
+		return &mgo.QueryError{Code: 26, Message: "ns not found"}
+	}
+	delete(c.f.databases[c.database], c.name)
+	return nil
+}
+
+func (c fakeCollection) Create(info *mgo.CollectionInfo) error {
+	c.f.mu.Lock()
+	defer c.f.mu.Unlock()
+	if c.f.collection(c.database, c.name, false) != nil {
+		return &mgo.QueryError{Code: 48, Message: "collection already exists"}
+	}
+	data := c.f.collection(c.database, c.name, true)
+	if info != nil {
+		data.info = *info
+	}
+	return nil
+}
+
+func (c fakeCollection) Watch(pipeline interface{}, opts mgohttp.ChangeStreamOptions) mgohttp.ChangeStream {
+	return failedChangeStream{err: unsupported("change streams")}
+}
+
+// Stats reports the count and BSON size of the documents. The limits of a capped collection
+// are those it was created with, the fake doesn't enforce them.
+func (c fakeCollection) Stats() (mgohttp.CollectionStats, error) {
+	c.f.mu.Lock()
+	defer c.f.mu.Unlock()
+	data := c.f.collection(c.database, c.name, false)
+	if data == nil {
+		return mgohttp.CollectionStats{}, &mgo.QueryError{Code: 26, Message: "ns not found"}
+	}
+	stats := mgohttp.CollectionStats{
+		Count:      int64(len(data.docs)),
+		NumIndexes: 1 + len(data.indexes),
+		Capped:     data.info.Capped,
+		MaxSize:    int64(data.info.MaxBytes),
+		MaxDocs:    int64(data.info.MaxDocs),
+	}
+	for _, doc := range data.docs {
+		raw, err := bson.Marshal(doc)
+		if err != nil {
+			return mgohttp.CollectionStats{}, err
+		}
+		stats.Size += int64(len(raw))
+	}
+	if stats.Count > 0 {
+		stats.AvgObjSize = stats.Size / stats.Count
+	}
+	stats.StorageSize = stats.Size
+	return stats, nil
+}
+
+func (c fakeCollection) WithWriteConcern(safe *mgo.Safe) mgohttp.MongoCollection {
+	return c
+}
+
+// indexName is the name Mongo gives an index on key by default, e.g. "org_1_created_-1".
+func indexName(key []string) string {
+	parts := []string{}
+	for _, field := range key {
+		dir := "1"
+		switch {
+		case strings.HasPrefix(field, "-"):
+			field, dir = field[1:], "-1"
+		case strings.HasPrefix(field, "+"):
+			field = field[1:]
+		}
+		parts = append(parts, field, dir)
+	}
+	return strings.Join(parts, "_")
+}
+
+// checkUnique returns a duplicate key error when docs violate the _id index or a unique index.
+func (d *fakeCollectionData) checkUnique(docs []bson.M) error {
+	indexes := append([]mgo.Index{{Key: []string{"_id"}, Name: "_id_", Unique: true}}, d.indexes...)
+	for _, index := range indexes {
+		if !index.Unique {
+			continue
+		}
+		seen := map[string]bool{}
+		for _, doc := range docs {
+			key := bson.D{}
+			missing := 0
+			for _, field := range index.Key {
+				field = strings.TrimLeft(field, "+-")
+				v, ok := getPath(doc, field)
+				if !ok {
+					missing++
+				}
+				key = append(key, bson.DocElem{Name: field, Value: v})
+			}
+			if index.Sparse && missing == len(index.Key) {
+				continue
+			}
+			raw, err := bson.Marshal(bson.M{"k": key})
+			if err != nil {
+				return err
+			}
+			if seen[string(raw)] {
+				return &mgo.LastError{
+					Code: 11000,
+					Err:  fmt.Sprintf("E11000 duplicate key error index: %s dup key: %v", index.Name, key),
+				}
+			}
+			seen[string(raw)] = true
+		}
+	}
+	return nil
+}
+
+// fakeBulk runs the queued operations one at a time.
+type fakeBulk struct {
+	c         fakeCollection
+	queue     []func(res *mgo.BulkResult) error
+	unordered bool
+}
+
+func (b *fakeBulk) Insert(docs ...interface{}) {
+	b.queue = append(b.queue, func(res *mgo.BulkResult) error { return b.c.Insert(docs...) })
+}
+
+// queuePairs queues an update for each selector/update pair.
+func (b *fakeBulk) queuePairs(pairs []interface{}, all, upsert bool) {
+	for i := 0; i+1 < len(pairs); i += 2 {
+		selector, update := pairs[i], pairs[i+1]
+		b.queue = append(b.queue, func(res *mgo.BulkResult) error {
+			info, err := b.c.update(selector, update, all, upsert)
+			if err == nil {
+				res.Matched += info.Matched
+				res.Modified += info.Updated
+			}
+			return err
+		})
+	}
+}
+
+func (b *fakeBulk) Update(pairs ...interface{})    { b.queuePairs(pairs, false, false) }
+func (b *fakeBulk) UpdateAll(pairs ...interface{}) { b.queuePairs(pairs, true, false) }
+func (b *fakeBulk) Upsert(pairs ...interface{})    { b.queuePairs(pairs, false, true) }
+
+func (b *fakeBulk) queueRemoves(selectors []interface{}, all bool) {
+	for _, selector := range selectors {
+		selector := selector
+		b.queue = append(b.queue, func(res *mgo.BulkResult) error {
+			info, err := b.c.remove(selector, all)
+			if err == nil {
+				res.Matched += info.Removed
+			}
+			return err
+		})
+	}
+}
+
+func (b *fakeBulk) Remove(selectors ...interface{})    { b.queueRemoves(selectors, false) }
+func (b *fakeBulk) RemoveAll(selectors ...interface{}) { b.queueRemoves(selectors, true) }
+func (b *fakeBulk) Unordered()                         { b.unordered = true }
+
+// Run runs the queued operations in order. Ordered bulks stop at the first error, unordered
+// ones run every operation and return the first error.
+func (b *fakeBulk) Run() (*mgo.BulkResult, error) {
+	res := &mgo.BulkResult{}
+	var first error
+	for _, op := range b.queue {
+		if err := op(res); err != nil {
+			if !b.unordered {
+				return res, err
+			}
+			if first == nil {
+				first = err
+			}
+		}
+	}
+	return res, first
+}
+
+// fakeGridFS fails every operation with ErrFakeUnsupported.
+type fakeGridFS struct{}
+
+func (fakeGridFS) Create(name string) (mgohttp.MongoGridFile, error) {
+	return nil, unsupported("GridFS")
+}
+func (fakeGridFS) Open(name string) (mgohttp.MongoGridFile, error) {
+	return nil, unsupported("GridFS")
+}
+func (fakeGridFS) OpenId(id interface{}) (mgohttp.MongoGridFile, error) {
+	return nil, unsupported("GridFS")
+}
+func (fakeGridFS) Remove(name string) error      { return unsupported("GridFS") }
+func (fakeGridFS) RemoveId(id interface{}) error { return unsupported("GridFS") }
+func (fakeGridFS) Find(query interface{}) mgohttp.MongoQuery {
+	return fakeQuery{err: unsupported("GridFS")}
+}
+
+// fakePipe fails every operation with ErrFakeUnsupported.
+type fakePipe struct{}
+
+func (fakePipe) All(result interface{}) error     { return unsupported("aggregation pipelines") }
+func (fakePipe) One(result interface{}) error     { return unsupported("aggregation pipelines") }
+func (fakePipe) Explain(result interface{}) error { return unsupported("aggregation pipelines") }
+func (fakePipe) Iter() mgohttp.MongoIter {
+	return &fakeIter{err: unsupported("aggregation pipelines")}
+}
+func (p fakePipe) AllowDiskUse() mgohttp.MongoPipe { return p }
+func (p fakePipe) Batch(n int) mgohttp.MongoPipe   { return p }
@@ -0,0 +1,117 @@
+package mgohttptest
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/Clever/mgohttp/v2"
+	"github.com/Clever/mgohttp/v2/mgohttpconformance"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	mgo "gopkg.in/mgo.v2"
+	bson "gopkg.in/mgo.v2/bson"
+)
+
+func TestFakeMongoConformance(t *testing.T) {
+	mgohttpconformance.Run(t, func(t *testing.T) (mgohttp.MongoSession, string) {
+		return NewFakeMongo().Session(), "conformance"
+	})
+}
+
+func TestFakeMongoCappedStats(t *testing.T) {
+	c := NewFakeMongo().Session().DB("app").C("events")
+	_, err := c.Stats()
+	assert.Error(t, err, "the collection doesn't exist")
+
+	require.NoError(t, c.Create(&mgo.CollectionInfo{Capped: true, MaxBytes: 4096, MaxDocs: 10}))
+	require.NoError(t, c.Insert(bson.M{"n": 1}, bson.M{"n": 2}))
+	stats, err := c.Stats()
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), stats.Count)
+	assert.Equal(t, stats.Size/2, stats.AvgObjSize)
+	assert.True(t, stats.Capped)
+	assert.Equal(t, int64(4096), stats.MaxSize)
+	assert.Equal(t, int64(10), stats.MaxDocs)
+}
+
+func TestMakeContextFake(t *testing.T) {
+	fake := NewFakeMongo()
+	ctx := MakeContext(context.Background(), Config{Name: "app", Fake: fake})
+	defer ctx.Close()
+
+	c := mgohttp.FromContext(ctx, "app").DB("app").C("users")
+	require.NoError(t, c.Insert(bson.M{"name": "ada"}))
+
+	// every session of the fake shares its data
+	n, err := fake.Session().DB("app").C("users").Find(bson.M{"name": "ada"}).Count()
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+}
+
+func TestFakeMongoSelectors(t *testing.T) {
+	c := NewFakeMongo().Session().DB("app").C("users")
+	require.NoError(t, c.Insert(
+		bson.M{"_id": 1, "name": "ada", "age": 36, "tags": []string{"math", "poetry"}, "address": bson.M{"city": "London"}},
+		bson.M{"_id": 2, "name": "alan", "age": 41, "tags": []string{"math"}},
+		bson.M{"_id": 3, "name": "grace", "age": 85.5},
+	))
+
+	for _, test := range []struct {
+		name     string
+		selector bson.M
+		ids      []int
+	}{
+		{"equality", bson.M{"name": "ada"}, []int{1}},
+		{"array element", bson.M{"tags": "math"}, []int{1, 2}},
+		{"dotted", bson.M{"address.city": "London"}, []int{1}},
+		{"numbers of different types", bson.M{"age": bson.M{"$gte": 41.0}}, []int{2, 3}},
+		{"$in and $nin", bson.M{"name": bson.M{"$in": []string{"ada", "grace"}, "$nin": []string{"grace"}}}, []int{1}},
+		{"$exists", bson.M{"tags": bson.M{"$exists": false}}, []int{3}},
+		{"$regex", bson.M{"name": bson.M{"$regex": "^A", "$options": "i"}}, []int{1, 2}},
+		{"regex value", bson.M{"name": bson.RegEx{Pattern: "ce$"}}, []int{3}},
+		{"$size and $all", bson.M{"tags": bson.M{"$size": 2, "$all": []string{"poetry"}}}, []int{1}},
+		{"$or", bson.M{"$or": []bson.M{{"_id": 1}, {"age": bson.M{"$gt": 80}}}}, []int{1, 3}},
+		{"$nor", bson.M{"$nor": []bson.M{{"_id": 1}, {"_id": 2}}}, []int{3}},
+		{"null matches missing", bson.M{"address": nil}, []int{2, 3}},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			var docs []struct {
+				ID int `bson:"_id"`
+			}
+			require.NoError(t, c.Find(test.selector).Sort("_id").All(&docs))
+			ids := []int{}
+			for _, doc := range docs {
+				ids = append(ids, doc.ID)
+			}
+			assert.Equal(t, test.ids, ids)
+		})
+	}
+
+	err := c.Find(bson.M{"$where": "true"}).One(&bson.M{})
+	assert.True(t, errors.Is(err, ErrFakeUnsupported), "got %v", err)
+}
+
+func TestFakeMongoUpdates(t *testing.T) {
+	c := NewFakeMongo().Session().DB("app").C("counters")
+	require.NoError(t, c.Insert(bson.M{"_id": "a", "n": 1, "seen": []string{"x"}}))
+
+	require.NoError(t, c.Update(bson.M{"_id": "a"}, bson.M{
+		"$inc":      bson.M{"n": 2},
+		"$addToSet": bson.M{"seen": bson.M{"$each": []string{"x", "y"}}},
+		"$set":      bson.M{"meta.updated": true},
+	}))
+	var doc bson.M
+	require.NoError(t, c.Find(bson.M{"_id": "a"}).One(&doc))
+	assert.Equal(t, bson.M{"_id": "a", "n": 3, "seen": []interface{}{"x", "y"}, "meta": bson.M{"updated": true}}, doc)
+
+	info, err := c.Upsert(bson.M{"_id": "b"}, bson.M{"$setOnInsert": bson.M{"n": 0}, "$inc": bson.M{"hits": 1}})
+	require.NoError(t, err)
+	assert.Equal(t, "b", info.UpsertedId)
+	require.NoError(t, c.Find(bson.M{"_id": "b"}).One(&doc))
+	assert.Equal(t, bson.M{"_id": "b", "n": 0, "hits": 1}, doc)
+
+	require.NoError(t, c.EnsureIndex(mgo.Index{Key: []string{"n"}, Unique: true}))
+	err = c.Update(bson.M{"_id": "b"}, bson.M{"$set": bson.M{"n": 3}})
+	assert.True(t, mgo.IsDup(err), "got %v", err)
+}
@@ -0,0 +1,715 @@
+package mgohttptest
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	mgo "gopkg.in/mgo.v2"
+	bson "gopkg.in/mgo.v2/bson"
+)
+
+// toM converts a document, a bson.M, a bson.D or a struct, to a bson.M by a round trip through
+// BSON, so the fake stores and compares the same values a server would.
+func toM(v interface{}) (bson.M, error) {
+	if v == nil {
+		return bson.M{}, nil
+	}
+	raw, err := bson.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	m := bson.M{}
+	if err := bson.Unmarshal(raw, m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// filter returns the documents matching sel.
+func filter(docs []bson.M, sel bson.M) ([]bson.M, error) {
+	out := []bson.M{}
+	for _, doc := range docs {
+		matched, err := matches(doc, sel)
+		if err != nil {
+			return nil, err
+		}
+		if matched {
+			out = append(out, doc)
+		}
+	}
+	return out, nil
+}
+
+// matches reports whether doc matches the selector sel.
+func matches(doc bson.M, sel bson.M) (bool, error) {
+	for key, cond := range sel {
+		var matched bool
+		var err error
+		switch key {
+		case "$and", "$or", "$nor":
+			matched, err = matchLogical(doc, key, cond)
+		case "$comment":
+			matched = true
+		default:
+			if strings.HasPrefix(key, "$") {
+				return false, unsupported("selector operator %s", key)
+			}
+			values, found := lookup(doc, strings.Split(key, "."))
+			matched, err = matchCond(values, found, cond)
+		}
+		if err != nil || !matched {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+// matchLogical evaluates the clauses of $and, $or or $nor.
+func matchLogical(doc bson.M, op string, cond interface{}) (bool, error) {
+	clauses, ok := cond.([]interface{})
+	if !ok || len(clauses) == 0 {
+		return false, fmt.Errorf("mgohttptest: %s must be a nonempty array", op)
+	}
+	for _, clause := range clauses {
+		sel, ok := clause.(bson.M)
+		if !ok {
+			return false, fmt.Errorf("mgohttptest: the clauses of %s must be documents", op)
+		}
+		matched, err := matches(doc, sel)
+		if err != nil {
+			return false, err
+		}
+		switch {
+		case op == "$and" && !matched:
+			return false, nil
+		case op == "$or" && matched:
+			return true, nil
+		case op == "$nor" && matched:
+			return false, nil
+		}
+	}
+	return op != "$or", nil
+}
+
+// matchCond reports whether the values of a field, found or not, satisfy cond: either a
+// value they must equal, or a document of operators.
+func matchCond(values []interface{}, found bool, cond interface{}) (bool, error) {
+	ops, ok := cond.(bson.M)
+	if !ok || !isOperators(ops) {
+		if re, ok := cond.(bson.RegEx); ok {
+			return matchRegex(values, re)
+		}
+		return equals(values, found, cond), nil
+	}
+	for op, arg := range ops {
+		var matched bool
+		var err error
+		switch op {
+		case "$eq":
+			matched = equals(values, found, arg)
+		case "$ne":
+			matched = !equals(values, found, arg)
+		case "$gt", "$gte", "$lt", "$lte":
+			matched = compares(values, op, arg)
+		case "$in", "$nin":
+			matched, err = in(values, found, arg)
+			if op == "$nin" {
+				matched = !matched
+			}
+		case "$exists":
+			matched = truthy(arg) == found
+		case "$regex":
+			re := bson.RegEx{}
+			switch pattern := arg.(type) {
+			case string:
+				re.Pattern = pattern
+			case bson.RegEx:
+				re = pattern
+			default:
+				return false, fmt.Errorf("mgohttptest: $regex has to be a string")
+			}
+			if options, ok := ops["$options"].(string); ok {
+				re.Options = options
+			}
+			matched, err = matchRegex(values, re)
+		case "$options":
+			matched = true
+		case "$size":
+			n, _ := toFloat(arg)
+			for _, v := range values {
+				if arr, ok := v.([]interface{}); ok && float64(len(arr)) == n {
+					matched = true
+				}
+			}
+		case "$all":
+			all, ok := arg.([]interface{})
+			if !ok {
+				return false, fmt.Errorf("mgohttptest: $all needs an array")
+			}
+			matched = len(all) > 0
+			for _, v := range all {
+				if !equals(values, found, v) {
+					matched = false
+				}
+			}
+		case "$elemMatch":
+			matched, err = elemMatch(values, arg)
+		case "$not":
+			matched, err = matchCond(values, found, arg)
+			matched = !matched
+		default:
+			return false, unsupported("selector operator %s", op)
+		}
+		if err != nil || !matched {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+// isOperators reports whether the document m is made of operators, rather than a document
+// to compare against.
+func isOperators(m bson.M) bool {
+	for key := range m {
+		return strings.HasPrefix(key, "$")
+	}
+	return false
+}
+
+// expand returns values along with the elements of the arrays among them, as a selector
+// on a field matches either.
+func expand(values []interface{}) []interface{} {
+	out := append([]interface{}(nil), values...)
+	for _, v := range values {
+		if arr, ok := v.([]interface{}); ok {
+			out = append(out, arr...)
+		}
+	}
+	return out
+}
+
+// equals reports whether one of the values equals v. A null v also matches missing fields.
+func equals(values []interface{}, found bool, v interface{}) bool {
+	if v == nil && !found {
+		return true
+	}
+	for _, value := range expand(values) {
+		if valuesEqual(value, v) {
+			return true
+		}
+	}
+	return false
+}
+
+// compares reports whether one of the values compares to arg as op requires. Like Mongo,
+// only values of the same type are compared.
+func compares(values []interface{}, op string, arg interface{}) bool {
+	for _, value := range expand(values) {
+		if typeRank(value) != typeRank(arg) {
+			continue
+		}
+		cmp := compareValues(value, arg)
+		if (op == "$gt" && cmp > 0) || (op == "$gte" && cmp >= 0) ||
+			(op == "$lt" && cmp < 0) || (op == "$lte" && cmp <= 0) {
+			return true
+		}
+	}
+	return false
+}
+
+func in(values []interface{}, found bool, arg interface{}) (bool, error) {
+	candidates, ok := arg.([]interface{})
+	if !ok {
+		return false, fmt.Errorf("mgohttptest: $in needs an array")
+	}
+	for _, candidate := range candidates {
+		if re, ok := candidate.(bson.RegEx); ok {
+			matched, err := matchRegex(values, re)
+			if err != nil || matched {
+				return matched, err
+			}
+			continue
+		}
+		if equals(values, found, candidate) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func matchRegex(values []interface{}, re bson.RegEx) (bool, error) {
+	flags := ""
+	for _, option := range re.Options {
+		switch option {
+		case 'i', 'm', 's':
+			flags += string(option)
+		default:
+			return false, unsupported("regex option %c", option)
+		}
+	}
+	pattern := re.Pattern
+	if flags != "" {
+		pattern = "(?" + flags + ")" + pattern
+	}
+	compiled, err := regexp.Compile(pattern)
+	if err != nil {
+		return false, err
+	}
+	for _, value := range expand(values) {
+		if s, ok := value.(string); ok && compiled.MatchString(s) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// elemMatch reports whether an element of one of the arrays among values matches cond, a
+// selector for documents or operators for other values.
+func elemMatch(values []interface{}, cond interface{}) (bool, error) {
+	sel, ok := cond.(bson.M)
+	if !ok {
+		return false, fmt.Errorf("mgohttptest: $elemMatch needs a document")
+	}
+	for _, value := range values {
+		arr, ok := value.([]interface{})
+		if !ok {
+			continue
+		}
+		for _, elem := range arr {
+			var matched bool
+			var err error
+			if doc, ok := elem.(bson.M); ok && !isOperators(sel) {
+				matched, err = matches(doc, sel)
+			} else {
+				matched, err = matchCond([]interface{}{elem}, true, sel)
+			}
+			if err != nil || matched {
+				return matched, err
+			}
+		}
+	}
+	return false, nil
+}
+
+// lookup returns the values at path in v, following arrays of documents like Mongo does.
+func lookup(v interface{}, path []string) ([]interface{}, bool) {
+	if len(path) == 0 {
+		return []interface{}{v}, true
+	}
+	switch t := v.(type) {
+	case bson.M:
+		child, ok := t[path[0]]
+		if !ok {
+			return nil, false
+		}
+		return lookup(child, path[1:])
+	case []interface{}:
+		var values []interface{}
+		found := false
+		if i, err := strconv.Atoi(path[0]); err == nil && i >= 0 && i < len(t) {
+			values, found = lookup(t[i], path[1:])
+		}
+		for _, elem := range t {
+			if doc, ok := elem.(bson.M); ok {
+				elemValues, elemFound := lookup(doc, path)
+				values = append(values, elemValues...)
+				found = found || elemFound
+			}
+		}
+		return values, found
+	}
+	return nil, false
+}
+
+// getPath returns the value at the dotted path in doc, without following arrays of
+// documents.
+func getPath(doc bson.M, path string) (interface{}, bool) {
+	var v interface{} = doc
+	for _, part := range strings.Split(path, ".") {
+		switch t := v.(type) {
+		case bson.M:
+			child, ok := t[part]
+			if !ok {
+				return nil, false
+			}
+			v = child
+		case []interface{}:
+			i, err := strconv.Atoi(part)
+			if err != nil || i < 0 || i >= len(t) {
+				return nil, false
+			}
+			v = t[i]
+		default:
+			return nil, false
+		}
+	}
+	return v, true
+}
+
+// setPath sets the value at the dotted path in doc, creating the documents on the way.
+func setPath(doc bson.M, path string, value interface{}) error {
+	parts := strings.Split(path, ".")
+	var parent interface{} = doc
+	for i, part := range parts {
+		last := i == len(parts)-1
+		switch t := parent.(type) {
+		case bson.M:
+			if last {
+				t[part] = value
+				return nil
+			}
+			child, ok := t[part]
+			if !ok {
+				child = bson.M{}
+				t[part] = child
+			}
+			parent = child
+		case []interface{}:
+			n, err := strconv.Atoi(part)
+			if err != nil || n < 0 || n >= len(t) {
+				return unsupported("setting %s", path)
+			}
+			if last {
+				t[n] = value
+				return nil
+			}
+			parent = t[n]
+		default:
+			return &mgo.LastError{Code: 28, Err: fmt.Sprintf("cannot create field %q in %v", part, parent)}
+		}
+	}
+	return nil
+}
+
+// unsetPath removes the value at the dotted path in doc, if any.
+func unsetPath(doc bson.M, path string) {
+	i := strings.LastIndex(path, ".")
+	if i < 0 {
+		delete(doc, path)
+		return
+	}
+	parent, ok := getPath(doc, path[:i])
+	if !ok {
+		return
+	}
+	switch t := parent.(type) {
+	case bson.M:
+		delete(t, path[i+1:])
+	case []interface{}:
+		// like Mongo, unsetting an array element sets it to null
+		if n, err := strconv.Atoi(path[i+1:]); err == nil && n >= 0 && n < len(t) {
+			t[n] = nil
+		}
+	}
+}
+
+// applyUpdate returns doc updated by upd, a replacement document or a document of update
+// operators. $setOnInsert only applies when inserting. doc isn't modified.
+func applyUpdate(doc bson.M, upd bson.M, inserting bool) (bson.M, error) {
+	if !isOperators(upd) {
+		for key := range upd {
+			if strings.HasPrefix(key, "$") {
+				return nil, fmt.Errorf("mgohttptest: a replacement document can't hold operators")
+			}
+		}
+		out, err := toM(upd)
+		if err != nil {
+			return nil, err
+		}
+		if id, ok := doc["_id"]; ok {
+			out["_id"] = id
+		}
+		return out, nil
+	}
+	out, err := toM(doc)
+	if err != nil {
+		return nil, err
+	}
+	for op, arg := range upd {
+		fields, ok := arg.(bson.M)
+		if !ok {
+			return nil, fmt.Errorf("mgohttptest: %s needs a document", op)
+		}
+		for path, value := range fields {
+			if err := applyOp(out, op, path, value, inserting); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return out, nil
+}
+
+func applyOp(doc bson.M, op, path string, value interface{}, inserting bool) error {
+	current, exists := getPath(doc, path)
+	switch op {
+	case "$set":
+		return setPath(doc, path, value)
+	case "$setOnInsert":
+		if inserting {
+			return setPath(doc, path, value)
+		}
+	case "$unset":
+		unsetPath(doc, path)
+	case "$inc":
+		if !exists {
+			return setPath(doc, path, value)
+		}
+		sum, ok := addNumbers(current, value)
+		if !ok {
+			return &mgo.LastError{Code: 14, Err: fmt.Sprintf("Cannot apply $inc to %s, a value of non-numeric type", path)}
+		}
+		return setPath(doc, path, sum)
+	case "$push", "$addToSet":
+		arr, ok := current.([]interface{})
+		if exists && !ok {
+			return &mgo.LastError{Code: 2, Err: fmt.Sprintf("The field '%s' must be an array", path)}
+		}
+		elems := []interface{}{value}
+		if m, ok := value.(bson.M); ok && isOperators(m) {
+			each, ok := m["$each"].([]interface{})
+			if !ok || len(m) > 1 {
+				return unsupported("%s modifiers other than $each", op)
+			}
+			elems = each
+		}
+		for _, elem := range elems {
+			if op == "$addToSet" && equals(arr, true, elem) {
+				continue
+			}
+			arr = append(arr, elem)
+		}
+		if arr == nil {
+			arr = []interface{}{}
+		}
+		return setPath(doc, path, arr)
+	case "$pull":
+		arr, ok := current.([]interface{})
+		if !ok {
+			return nil
+		}
+		kept := []interface{}{}
+		for _, elem := range arr {
+			var matched bool
+			var err error
+			sel, isDoc := value.(bson.M)
+			elemDoc, elemIsDoc := elem.(bson.M)
+			switch {
+			case isDoc && elemIsDoc && !isOperators(sel):
+				matched, err = matches(elemDoc, sel)
+			case isDoc && isOperators(sel):
+				matched, err = matchCond([]interface{}{elem}, true, sel)
+			default:
+				matched = valuesEqual(elem, value)
+			}
+			if err != nil {
+				return err
+			}
+			if !matched {
+				kept = append(kept, elem)
+			}
+		}
+		return setPath(doc, path, kept)
+	default:
+		return unsupported("update operator %s", op)
+	}
+	return nil
+}
+
+// upsertDoc returns the document an upsert inserts: the equality fields of the selector,
+// updated by upd.
+func upsertDoc(sel bson.M, upd bson.M) (bson.M, error) {
+	base := bson.M{}
+	for key, cond := range sel {
+		if strings.HasPrefix(key, "$") {
+			continue
+		}
+		if ops, ok := cond.(bson.M); ok && isOperators(ops) {
+			eq, ok := ops["$eq"]
+			if !ok {
+				continue
+			}
+			cond = eq
+		}
+		if err := setPath(base, key, cond); err != nil {
+			return nil, err
+		}
+	}
+	doc, err := applyUpdate(base, upd, true)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := doc["_id"]; !ok {
+		doc["_id"] = bson.NewObjectId()
+	}
+	return doc, nil
+}
+
+// toFloat returns the value of a number.
+func toFloat(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case int:
+		return float64(n), true
+	case int32:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case float32:
+		return float64(n), true
+	case float64:
+		return n, true
+	}
+	return 0, false
+}
+
+// addNumbers adds two numbers, keeping the widest of their types like Mongo does.
+func addNumbers(a, b interface{}) (interface{}, bool) {
+	af, aok := toFloat(a)
+	bf, bok := toFloat(b)
+	if !aok || !bok {
+		return nil, false
+	}
+	_, aFloat := a.(float64)
+	_, bFloat := b.(float64)
+	_, aLong := a.(int64)
+	_, bLong := b.(int64)
+	switch {
+	case aFloat || bFloat:
+		return af + bf, true
+	case aLong || bLong:
+		return int64(af) + int64(bf), true
+	}
+	return int(af) + int(bf), true
+}
+
+// typeRank orders the BSON types the way Mongo sorts them.
+func typeRank(v interface{}) int {
+	if _, ok := toFloat(v); ok {
+		return 2
+	}
+	switch v.(type) {
+	case nil:
+		return 1
+	case string, bson.Symbol:
+		return 3
+	case bson.M, bson.D:
+		return 4
+	case []interface{}:
+		return 5
+	case []byte, bson.Binary:
+		return 6
+	case bson.ObjectId:
+		return 7
+	case bool:
+		return 8
+	case time.Time:
+		return 9
+	case bson.MongoTimestamp:
+		return 10
+	case bson.RegEx:
+		return 11
+	}
+	return 12
+}
+
+// compareValues returns -1, 0 or 1 as a sorts before, with or after b.
+func compareValues(a, b interface{}) int {
+	ra, rb := typeRank(a), typeRank(b)
+	if ra != rb {
+		return sign(ra - rb)
+	}
+	switch av := a.(type) {
+	case string:
+		return strings.Compare(av, b.(string))
+	case bson.ObjectId:
+		return strings.Compare(string(av), string(b.(bson.ObjectId)))
+	case bool:
+		bv := b.(bool)
+		switch {
+		case av == bv:
+			return 0
+		case bv:
+			return -1
+		}
+		return 1
+	case time.Time:
+		bv := b.(time.Time)
+		switch {
+		case av.Before(bv):
+			return -1
+		case av.After(bv):
+			return 1
+		}
+		return 0
+	case []interface{}:
+		bv := b.([]interface{})
+		for i := 0; i < len(av) && i < len(bv); i++ {
+			if cmp := compareValues(av[i], bv[i]); cmp != 0 {
+				return cmp
+			}
+		}
+		return sign(len(av) - len(bv))
+	}
+	if af, ok := toFloat(a); ok {
+		bf, _ := toFloat(b)
+		switch {
+		case af < bf:
+			return -1
+		case af > bf:
+			return 1
+		}
+		return 0
+	}
+	return strings.Compare(fmt.Sprint(a), fmt.Sprint(b))
+}
+
+func sign(n int) int {
+	switch {
+	case n < 0:
+		return -1
+	case n > 0:
+		return 1
+	}
+	return 0
+}
+
+// valuesEqual reports whether a and b are the same value, comparing numbers by value
+// whatever their types.
+func valuesEqual(a, b interface{}) bool {
+	if af, ok := toFloat(a); ok {
+		bf, ok := toFloat(b)
+		return ok && af == bf
+	}
+	switch av := a.(type) {
+	case bson.M:
+		bv, ok := b.(bson.M)
+		if !ok || len(av) != len(bv) {
+			return false
+		}
+		for key, value := range av {
+			other, ok := bv[key]
+			if !ok || !valuesEqual(value, other) {
+				return false
+			}
+		}
+		return true
+	case []interface{}:
+		bv, ok := b.([]interface{})
+		if !ok || len(av) != len(bv) {
+			return false
+		}
+		for i := range av {
+			if !valuesEqual(av[i], bv[i]) {
+				return false
+			}
+		}
+		return true
+	case time.Time:
+		bv, ok := b.(time.Time)
+		return ok && av.Equal(bv)
+	}
+	return reflect.DeepEqual(a, b)
+}
@@ -0,0 +1,393 @@
+package mgohttptest
+
+import (
+	"errors"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Clever/mgohttp/v2"
+	mgo "gopkg.in/mgo.v2"
+	bson "gopkg.in/mgo.v2/bson"
+)
+
+// fakeQuery is a query on a fakeCollection. Like mgo.Query, its modifiers return the query.
+type fakeQuery struct {
+	c          fakeCollection
+	selector   interface{}
+	sort       []string
+	skip       int
+	limit      int
+	projection interface{}
+	// err fails the access methods, for the modifiers the fake doesn't support.
+	err error
+}
+
+func (q fakeQuery) Hint(indexKey ...string) mgohttp.MongoQuery                     { return q }
+func (q fakeQuery) Batch(n int) mgohttp.MongoQuery                                 { return q }
+func (q fakeQuery) Prefetch(p float64) mgohttp.MongoQuery                          { return q }
+func (q fakeQuery) SetMaxTime(d time.Duration) mgohttp.MongoQuery                  { return q }
+func (q fakeQuery) WithReadConcern(level string) mgohttp.MongoQuery                { return q }
+func (q fakeQuery) WithReadPreference(p mgohttp.ReadPreference) mgohttp.MongoQuery { return q }
+
+func (q fakeQuery) Limit(n int) mgohttp.MongoQuery {
+	// like mgo, a negative limit is a single batch of -n documents
+	if n < 0 {
+		n = -n
+	}
+	q.limit = n
+	return q
+}
+
+func (q fakeQuery) Skip(n int) mgohttp.MongoQuery {
+	q.skip = n
+	return q
+}
+
+func (q fakeQuery) Sort(fields ...string) mgohttp.MongoQuery {
+	q.sort = fields
+	return q
+}
+
+func (q fakeQuery) And(selector interface{}) mgohttp.MongoQuery {
+	if q.selector == nil {
+		q.selector = selector
+	} else {
+		q.selector = bson.M{"$and": []interface{}{q.selector, selector}}
+	}
+	return q
+}
+
+func (q fakeQuery) Select(selector interface{}) mgohttp.MongoQuery {
+	q.projection = selector
+	return q
+}
+
+func (q fakeQuery) WithCollation(c mgohttp.Collation) mgohttp.MongoQuery {
+	if q.err == nil {
+		q.err = unsupported("collations")
+	}
+	return q
+}
+
+func (q fakeQuery) WithSnapshot() mgohttp.MongoQuery {
+	if q.err == nil {
+		q.err = mgohttp.ErrSnapshotReadsUnsupported
+	}
+	return q
+}
+
+func (q fakeQuery) Explain(result interface{}) error {
+	return unsupported("Explain")
+}
+
+func (q fakeQuery) Tail(timeout time.Duration) mgohttp.MongoIter {
+	return &fakeIter{err: unsupported("tailable cursors")}
+}
+
+func (q fakeQuery) OneRaw() (bson.Raw, error) {
+	var raw bson.Raw
+	err := q.One(&raw)
+	return raw, err
+}
+
+func (q fakeQuery) AllRaw() ([]bson.Raw, error) {
+	docs := []bson.Raw{}
+	if err := q.All(&docs); err != nil {
+		return nil, err
+	}
+	return docs, nil
+}
+
+// run returns the documents of the query, sorted, skipped, limited and projected.
+func (q fakeQuery) run() ([]bson.M, error) {
+	if q.err != nil {
+		return nil, q.err
+	}
+	docs, err := q.c.read(q.selector)
+	if err != nil {
+		return nil, err
+	}
+	if err := sortDocs(docs, q.sort); err != nil {
+		return nil, err
+	}
+	docs = window(docs, q.skip, q.limit)
+	if q.projection == nil {
+		return docs, nil
+	}
+	projection, err := toM(q.projection)
+	if err != nil {
+		return nil, err
+	}
+	for i, doc := range docs {
+		if docs[i], err = project(doc, projection); err != nil {
+			return nil, err
+		}
+	}
+	return docs, nil
+}
+
+func (q fakeQuery) All(result interface{}) error {
+	docs, err := q.run()
+	if err != nil {
+		return err
+	}
+	return decodeAll(docs, result)
+}
+
+func (q fakeQuery) One(result interface{}) error {
+	q.limit = 1
+	docs, err := q.run()
+	if err != nil {
+		return err
+	}
+	if len(docs) == 0 {
+		return mgo.ErrNotFound
+	}
+	if result == nil {
+		return nil
+	}
+	return decode(docs[0], result)
+}
+
+// Count counts the documents of the query, honoring Skip and Limit like mgo does.
+func (q fakeQuery) Count() (int, error) {
+	q.projection = nil
+	docs, err := q.run()
+	return len(docs), err
+}
+
+func (q fakeQuery) Iter() mgohttp.MongoIter {
+	docs, err := q.run()
+	return &fakeIter{docs: docs, err: err}
+}
+
+// Apply runs change on the first document of the query, like findAndModify.
+func (q fakeQuery) Apply(change mgo.Change, result interface{}) (*mgo.ChangeInfo, error) {
+	if q.err != nil {
+		return nil, q.err
+	}
+	sel, err := toM(q.selector)
+	if err != nil {
+		return nil, err
+	}
+	var upd bson.M
+	if !change.Remove {
+		if upd, err = toM(change.Update); err != nil {
+			return nil, err
+		}
+	}
+	info := &mgo.ChangeInfo{}
+	var value bson.M
+	err = q.c.write(func(data *fakeCollectionData, docs []bson.M) ([]bson.M, error) {
+		first := -1
+		for i, doc := range docs {
+			matched, err := matches(doc, sel)
+			if err != nil {
+				return nil, err
+			}
+			if matched && (first < 0 || (len(q.sort) > 0 && lessDocs(doc, docs[first], q.sort))) {
+				first = i
+			}
+		}
+		switch {
+		case first < 0 && change.Upsert && !change.Remove:
+			inserted, err := upsertDoc(sel, upd)
+			if err != nil {
+				return nil, err
+			}
+			info.UpsertedId = inserted["_id"]
+			if change.ReturnNew {
+				value = inserted
+			}
+			return append(docs, inserted), nil
+		case first < 0:
+			return nil, mgo.ErrNotFound
+		case change.Remove:
+			value = docs[first]
+			info.Removed, info.Matched = 1, 1
+			return append(docs[:first:first], docs[first+1:]...), nil
+		}
+		updated, err := applyUpdate(docs[first], upd, false)
+		if err != nil {
+			return nil, err
+		}
+		value = docs[first]
+		if change.ReturnNew {
+			value = updated
+		}
+		info.Updated, info.Matched = 1, 1
+		docs[first] = updated
+		return docs, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if value != nil && result != nil {
+		if q.projection != nil {
+			projection, err := toM(q.projection)
+			if err != nil {
+				return nil, err
+			}
+			if value, err = project(value, projection); err != nil {
+				return nil, err
+			}
+		}
+		if err := decode(value, result); err != nil {
+			return nil, err
+		}
+	}
+	return info, nil
+}
+
+// fakeIter iterates over the documents of a query, as they were when it was run.
+type fakeIter struct {
+	docs   []bson.M
+	err    error
+	closed bool
+}
+
+func (it *fakeIter) Next(result interface{}) bool {
+	if it.closed || it.err != nil || len(it.docs) == 0 {
+		return false
+	}
+	doc := it.docs[0]
+	it.docs = it.docs[1:]
+	if err := decode(doc, result); err != nil {
+		it.err = err
+		return false
+	}
+	return true
+}
+
+func (it *fakeIter) All(result interface{}) error {
+	if it.closed {
+		return it.err
+	}
+	docs := it.docs
+	it.docs = nil
+	if it.err == nil {
+		it.err = decodeAll(docs, result)
+	}
+	return it.Close()
+}
+
+func (it *fakeIter) Close() error {
+	it.closed = true
+	it.docs = nil
+	return it.err
+}
+
+func (it *fakeIter) Done() bool {
+	return it.closed || it.err != nil || len(it.docs) == 0
+}
+
+func (it *fakeIter) Err() error    { return it.err }
+func (it *fakeIter) Timeout() bool { return false }
+
+// sortDocs sorts docs by fields, in the format of mgo.Query.Sort.
+func sortDocs(docs []bson.M, fields []string) error {
+	for _, field := range fields {
+		if strings.HasPrefix(strings.TrimLeft(field, "+-"), "$") {
+			return unsupported("sorting on %s", field)
+		}
+	}
+	if len(fields) > 0 {
+		sort.SliceStable(docs, func(i, j int) bool { return lessDocs(docs[i], docs[j], fields) })
+	}
+	return nil
+}
+
+// lessDocs reports whether a sorts before b by fields.
+func lessDocs(a, b bson.M, fields []string) bool {
+	for _, field := range fields {
+		desc := strings.HasPrefix(field, "-")
+		field = strings.TrimLeft(field, "+-")
+		av, _ := getPath(a, field)
+		bv, _ := getPath(b, field)
+		if cmp := compareValues(av, bv); cmp != 0 {
+			return (cmp < 0) != desc
+		}
+	}
+	return false
+}
+
+// window returns the documents left once skip are skipped, at most limit of them, when set.
+func window(docs []bson.M, skip, limit int) []bson.M {
+	if skip >= len(docs) {
+		return nil
+	}
+	if skip > 0 {
+		docs = docs[skip:]
+	}
+	if limit > 0 && limit < len(docs) {
+		docs = docs[:limit]
+	}
+	return docs
+}
+
+// project applies a projection on top-level fields, including or excluding them. _id is
+// included unless it's excluded.
+func project(doc bson.M, projection bson.M) (bson.M, error) {
+	include := false
+	for field, v := range projection {
+		if strings.ContainsAny(field, ".$") {
+			return nil, unsupported("projection on %s", field)
+		}
+		if field != "_id" && truthy(v) {
+			include = true
+		}
+	}
+	out := bson.M{}
+	for field, v := range doc {
+		p, listed := projection[field]
+		keep := !listed || truthy(p)
+		if include && !listed && field != "_id" {
+			keep = false
+		}
+		if keep {
+			out[field] = v
+		}
+	}
+	return out, nil
+}
+
+// truthy reports whether the projection value v includes its field.
+func truthy(v interface{}) bool {
+	if b, ok := v.(bool); ok {
+		return b
+	}
+	if n, ok := toFloat(v); ok {
+		return n != 0
+	}
+	return v != nil
+}
+
+// decode unmarshals doc into result, which can be anything bson.Unmarshal accepts.
+func decode(doc bson.M, result interface{}) error {
+	raw, err := bson.Marshal(doc)
+	if err != nil {
+		return err
+	}
+	return bson.Unmarshal(raw, result)
+}
+
+// decodeAll unmarshals docs into result, a pointer to a slice, like mgo.Iter.All.
+func decodeAll(docs []bson.M, result interface{}) error {
+	resultv := reflect.ValueOf(result)
+	if resultv.Kind() != reflect.Ptr || resultv.Elem().Kind() != reflect.Slice {
+		return errors.New("result argument must be a slice address")
+	}
+	slicev := resultv.Elem().Slice(0, 0)
+	elemt := slicev.Type().Elem()
+	for _, doc := range docs {
+		elemp := reflect.New(elemt)
+		if err := decode(doc, elemp.Interface()); err != nil {
+			return err
+		}
+		slicev = reflect.Append(slicev, elemp.Elem())
+	}
+	resultv.Elem().Set(slicev)
+	return nil
+}
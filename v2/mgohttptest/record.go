@@ -0,0 +1,444 @@
+package mgohttptest
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/Clever/mgohttp/v2"
+	mgo "gopkg.in/mgo.v2"
+	bson "gopkg.in/mgo.v2/bson"
+)
+
+// Operation is an operation recorded by the DbHandler of a Config with Record set.
+type Operation struct {
+	// Op is the method of MongoCollection that ran the operation, e.g. "Update", or "Run" for
+	// commands. The shortcuts on ids are recorded as the methods they stand for: FindId as
+	// Find, UpdateId as Update and RemoveId as Remove, with a selector on _id.
+	Op         string
+	Database   string
+	Collection string
+	// Method is the access method of the queries of Find and the pipes of Pipe, e.g. "One"
+	// or "Count".
+	Method string
+	// Selector is the selector of Find, Update, UpdateAll, Upsert, Remove and RemoveAll.
+	Selector interface{}
+	// Update is the update of Update, UpdateAll, Upsert, and of Find's Apply.
+	Update interface{}
+	// Docs are the documents of Insert.
+	Docs []interface{}
+	// Sort, Skip and Limit are the modifiers of the queries of Find.
+	Sort  []string
+	Skip  int
+	Limit int
+	// Pipeline is the pipeline of Pipe.
+	Pipeline interface{}
+	// Command is the command of Run.
+	Command interface{}
+	// Bulk is set on the operations queued on a MongoBulk, recorded when it's run.
+	Bulk bool
+}
+
+// Fields lists the fields of a selector or update, dotted and sorted, e.g. Fields of
+// bson.M{"$set": bson.M{"name": "ada"}} is ["$set.name"], to assert on the shape of an
+// operation rather than on its values.
+func Fields(doc interface{}) []string {
+	m, err := toM(doc)
+	if err != nil {
+		return nil
+	}
+	fields := []string{}
+	var walk func(prefix string, m bson.M)
+	walk = func(prefix string, m bson.M) {
+		for k, v := range m {
+			if sub, ok := v.(bson.M); ok && len(sub) > 0 {
+				walk(prefix+k+".", sub)
+				continue
+			}
+			fields = append(fields, prefix+k)
+		}
+	}
+	walk("", m)
+	sort.Strings(fields)
+	return fields
+}
+
+// recorder records the operations of the sessions it wraps.
+type recorder struct {
+	mu  sync.Mutex
+	ops []Operation
+}
+
+func (r *recorder) record(op Operation) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.ops = append(r.ops, op)
+}
+
+func (r *recorder) operations() []Operation {
+	if r == nil {
+		return nil
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]Operation(nil), r.ops...)
+}
+
+// wrap returns sess with its operations recorded.
+func (r *recorder) wrap(sess mgohttp.MongoSession) mgohttp.MongoSession {
+	return recordingSession{MongoSession: sess, r: r}
+}
+
+type recordingSession struct {
+	mgohttp.MongoSession
+	r *recorder
+}
+
+func (s recordingSession) DB(name string) mgohttp.MongoDatabase {
+	return recordingDatabase{MongoDatabase: s.MongoSession.DB(name), r: s.r, name: name}
+}
+
+type recordingDatabase struct {
+	mgohttp.MongoDatabase
+	r    *recorder
+	name string
+}
+
+func (d recordingDatabase) C(name string) mgohttp.MongoCollection {
+	return recordingCollection{MongoCollection: d.MongoDatabase.C(name), r: d.r, database: d.name, name: name}
+}
+
+func (d recordingDatabase) Run(cmd interface{}, result interface{}) error {
+	d.r.record(Operation{Op: "Run", Database: d.name, Command: cmd})
+	return d.MongoDatabase.Run(cmd, result)
+}
+
+type recordingCollection struct {
+	mgohttp.MongoCollection
+	r        *recorder
+	database string
+	name     string
+}
+
+// operation returns an Operation on the collection.
+func (c recordingCollection) operation(op string) Operation {
+	return Operation{Op: op, Database: c.database, Collection: c.name}
+}
+
+func (c recordingCollection) Find(query interface{}) mgohttp.MongoQuery {
+	op := c.operation("Find")
+	op.Selector = query
+	return recordingQuery{MongoQuery: c.MongoCollection.Find(query), r: c.r, op: op}
+}
+
+func (c recordingCollection) FindId(id bson.ObjectId) mgohttp.MongoQuery {
+	op := c.operation("Find")
+	op.Selector = bson.M{"_id": id}
+	return recordingQuery{MongoQuery: c.MongoCollection.FindId(id), r: c.r, op: op}
+}
+
+func (c recordingCollection) Pipe(pipeline interface{}) mgohttp.MongoPipe {
+	op := c.operation("Pipe")
+	op.Pipeline = pipeline
+	return recordingPipe{MongoPipe: c.MongoCollection.Pipe(pipeline), r: c.r, op: op}
+}
+
+func (c recordingCollection) Insert(docs ...interface{}) error {
+	op := c.operation("Insert")
+	op.Docs = docs
+	c.r.record(op)
+	return c.MongoCollection.Insert(docs...)
+}
+
+// recordChange records an operation with a selector and an update.
+func (c recordingCollection) recordChange(name string, selector, update interface{}) {
+	op := c.operation(name)
+	op.Selector = selector
+	op.Update = update
+	c.r.record(op)
+}
+
+func (c recordingCollection) Remove(selector interface{}) error {
+	c.recordChange("Remove", selector, nil)
+	return c.MongoCollection.Remove(selector)
+}
+
+func (c recordingCollection) RemoveId(id bson.ObjectId) error {
+	c.recordChange("Remove", bson.M{"_id": id}, nil)
+	return c.MongoCollection.RemoveId(id)
+}
+
+func (c recordingCollection) RemoveAll(selector interface{}) (*mgo.ChangeInfo, error) {
+	c.recordChange("RemoveAll", selector, nil)
+	return c.MongoCollection.RemoveAll(selector)
+}
+
+func (c recordingCollection) Update(selector interface{}, update interface{}) error {
+	c.recordChange("Update", selector, update)
+	return c.MongoCollection.Update(selector, update)
+}
+
+func (c recordingCollection) UpdateId(id bson.ObjectId, update interface{}) error {
+	c.recordChange("Update", bson.M{"_id": id}, update)
+	return c.MongoCollection.UpdateId(id, update)
+}
+
+func (c recordingCollection) UpdateAll(selector interface{}, update interface{}) (*mgo.ChangeInfo, error) {
+	c.recordChange("UpdateAll", selector, update)
+	return c.MongoCollection.UpdateAll(selector, update)
+}
+
+func (c recordingCollection) Upsert(selector interface{}, update interface{}) (*mgo.ChangeInfo, error) {
+	c.recordChange("Upsert", selector, update)
+	return c.MongoCollection.Upsert(selector, update)
+}
+
+func (c recordingCollection) Bulk() mgohttp.MongoBulk {
+	return &recordingBulk{MongoBulk: c.MongoCollection.Bulk(), c: c}
+}
+
+func (c recordingCollection) WithWriteConcern(safe *mgo.Safe) mgohttp.MongoCollection {
+	c.MongoCollection = c.MongoCollection.WithWriteConcern(safe)
+	return c
+}
+
+// recordingQuery records its query when an access method runs it.
+type recordingQuery struct {
+	mgohttp.MongoQuery
+	r  *recorder
+	op Operation
+}
+
+func (q recordingQuery) record(method string) {
+	op := q.op
+	op.Method = method
+	q.r.record(op)
+}
+
+func (q recordingQuery) All(result interface{}) error {
+	q.record("All")
+	return q.MongoQuery.All(result)
+}
+
+func (q recordingQuery) One(result interface{}) error {
+	q.record("One")
+	return q.MongoQuery.One(result)
+}
+
+func (q recordingQuery) OneRaw() (bson.Raw, error) {
+	q.record("OneRaw")
+	return q.MongoQuery.OneRaw()
+}
+
+func (q recordingQuery) AllRaw() ([]bson.Raw, error) {
+	q.record("AllRaw")
+	return q.MongoQuery.AllRaw()
+}
+
+func (q recordingQuery) Count() (int, error) {
+	q.record("Count")
+	return q.MongoQuery.Count()
+}
+
+func (q recordingQuery) Iter() mgohttp.MongoIter {
+	q.record("Iter")
+	return q.MongoQuery.Iter()
+}
+
+func (q recordingQuery) Tail(timeout time.Duration) mgohttp.MongoIter {
+	q.record("Tail")
+	return q.MongoQuery.Tail(timeout)
+}
+
+func (q recordingQuery) Explain(result interface{}) error {
+	q.record("Explain")
+	return q.MongoQuery.Explain(result)
+}
+
+func (q recordingQuery) Apply(change mgo.Change, result interface{}) (*mgo.ChangeInfo, error) {
+	q.op.Update = change.Update
+	q.record("Apply")
+	return q.MongoQuery.Apply(change, result)
+}
+
+func (q recordingQuery) Limit(n int) mgohttp.MongoQuery {
+	q.op.Limit = n
+	q.MongoQuery = q.MongoQuery.Limit(n)
+	return q
+}
+
+func (q recordingQuery) Skip(n int) mgohttp.MongoQuery {
+	q.op.Skip = n
+	q.MongoQuery = q.MongoQuery.Skip(n)
+	return q
+}
+
+func (q recordingQuery) Sort(fields ...string) mgohttp.MongoQuery {
+	q.op.Sort = fields
+	q.MongoQuery = q.MongoQuery.Sort(fields...)
+	return q
+}
+
+func (q recordingQuery) And(selector interface{}) mgohttp.MongoQuery {
+	if q.op.Selector == nil {
+		q.op.Selector = selector
+	} else {
+		q.op.Selector = bson.M{"$and": []interface{}{q.op.Selector, selector}}
+	}
+	q.MongoQuery = q.MongoQuery.And(selector)
+	return q
+}
+
+func (q recordingQuery) Hint(indexKey ...string) mgohttp.MongoQuery {
+	q.MongoQuery = q.MongoQuery.Hint(indexKey...)
+	return q
+}
+
+func (q recordingQuery) Batch(n int) mgohttp.MongoQuery {
+	q.MongoQuery = q.MongoQuery.Batch(n)
+	return q
+}
+
+func (q recordingQuery) Prefetch(p float64) mgohttp.MongoQuery {
+	q.MongoQuery = q.MongoQuery.Prefetch(p)
+	return q
+}
+
+func (q recordingQuery) SetMaxTime(d time.Duration) mgohttp.MongoQuery {
+	q.MongoQuery = q.MongoQuery.SetMaxTime(d)
+	return q
+}
+
+func (q recordingQuery) Select(selector interface{}) mgohttp.MongoQuery {
+	q.MongoQuery = q.MongoQuery.Select(selector)
+	return q
+}
+
+func (q recordingQuery) WithCollation(c mgohttp.Collation) mgohttp.MongoQuery {
+	q.MongoQuery = q.MongoQuery.WithCollation(c)
+	return q
+}
+
+func (q recordingQuery) WithSnapshot() mgohttp.MongoQuery {
+	q.MongoQuery = q.MongoQuery.WithSnapshot()
+	return q
+}
+
+func (q recordingQuery) WithReadConcern(level string) mgohttp.MongoQuery {
+	q.MongoQuery = q.MongoQuery.WithReadConcern(level)
+	return q
+}
+
+func (q recordingQuery) WithReadPreference(p mgohttp.ReadPreference) mgohttp.MongoQuery {
+	q.MongoQuery = q.MongoQuery.WithReadPreference(p)
+	return q
+}
+
+// recordingPipe records its pipeline when an access method runs it.
+type recordingPipe struct {
+	mgohttp.MongoPipe
+	r  *recorder
+	op Operation
+}
+
+func (p recordingPipe) record(method string) {
+	op := p.op
+	op.Method = method
+	p.r.record(op)
+}
+
+func (p recordingPipe) All(result interface{}) error {
+	p.record("All")
+	return p.MongoPipe.All(result)
+}
+
+func (p recordingPipe) One(result interface{}) error {
+	p.record("One")
+	return p.MongoPipe.One(result)
+}
+
+func (p recordingPipe) Iter() mgohttp.MongoIter {
+	p.record("Iter")
+	return p.MongoPipe.Iter()
+}
+
+func (p recordingPipe) Explain(result interface{}) error {
+	p.record("Explain")
+	return p.MongoPipe.Explain(result)
+}
+
+func (p recordingPipe) AllowDiskUse() mgohttp.MongoPipe {
+	p.MongoPipe = p.MongoPipe.AllowDiskUse()
+	return p
+}
+
+func (p recordingPipe) Batch(n int) mgohttp.MongoPipe {
+	p.MongoPipe = p.MongoPipe.Batch(n)
+	return p
+}
+
+// recordingBulk records the queued operations when the bulk is run.
+type recordingBulk struct {
+	mgohttp.MongoBulk
+	c      recordingCollection
+	queued []Operation
+}
+
+func (b *recordingBulk) queue(name string, selector, update interface{}) {
+	op := b.c.operation(name)
+	op.Selector = selector
+	op.Update = update
+	op.Bulk = true
+	b.queued = append(b.queued, op)
+}
+
+func (b *recordingBulk) queuePairs(name string, pairs []interface{}) {
+	for i := 0; i+1 < len(pairs); i += 2 {
+		b.queue(name, pairs[i], pairs[i+1])
+	}
+}
+
+func (b *recordingBulk) Insert(docs ...interface{}) {
+	op := b.c.operation("Insert")
+	op.Docs = docs
+	op.Bulk = true
+	b.queued = append(b.queued, op)
+	b.MongoBulk.Insert(docs...)
+}
+
+func (b *recordingBulk) Update(pairs ...interface{}) {
+	b.queuePairs("Update", pairs)
+	b.MongoBulk.Update(pairs...)
+}
+
+func (b *recordingBulk) UpdateAll(pairs ...interface{}) {
+	b.queuePairs("UpdateAll", pairs)
+	b.MongoBulk.UpdateAll(pairs...)
+}
+
+func (b *recordingBulk) Upsert(pairs ...interface{}) {
+	b.queuePairs("Upsert", pairs)
+	b.MongoBulk.Upsert(pairs...)
+}
+
+func (b *recordingBulk) Remove(selectors ...interface{}) {
+	for _, selector := range selectors {
+		b.queue("Remove", selector, nil)
+	}
+	b.MongoBulk.Remove(selectors...)
+}
+
+func (b *recordingBulk) RemoveAll(selectors ...interface{}) {
+	for _, selector := range selectors {
+		b.queue("RemoveAll", selector, nil)
+	}
+	b.MongoBulk.RemoveAll(selectors...)
+}
+
+func (b *recordingBulk) Run() (*mgo.BulkResult, error) {
+	for _, op := range b.queued {
+		b.c.r.record(op)
+	}
+	b.queued = nil
+	return b.MongoBulk.Run()
+}
@@ -0,0 +1,51 @@
+package mgohttptest
+
+import (
+	"context"
+	"testing"
+
+	"github.com/Clever/mgohttp/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	bson "gopkg.in/mgo.v2/bson"
+)
+
+func TestRecord(t *testing.T) {
+	ctx := MakeContext(context.Background(),
+		Config{Name: "app", Fake: NewFakeMongo(), Record: true},
+		Config{Name: "other", Fake: NewFakeMongo()},
+	)
+	defer ctx.Close()
+
+	users := mgohttp.FromContext(ctx, "app").DB("app").C("users")
+	id := bson.NewObjectId()
+	require.NoError(t, users.Insert(bson.M{"_id": id, "name": "ada"}))
+	require.NoError(t, users.UpdateId(id, bson.M{"$set": bson.M{"name": "grace"}}))
+	var found []bson.M
+	require.NoError(t, users.Find(bson.M{"name": "grace"}).Sort("-name").Limit(5).All(&found))
+	bulk := users.Bulk()
+	bulk.Remove(bson.M{"_id": id})
+	_, err := bulk.Run()
+	require.NoError(t, err)
+	// the databases without Record aren't recorded
+	require.NoError(t, mgohttp.FromContext(ctx, "other").DB("other").C("users").Insert(bson.M{}))
+
+	ops := ctx.Operations()
+	require.Len(t, ops, 4)
+	assert.Equal(t, "Insert", ops[0].Op)
+	assert.Len(t, ops[0].Docs, 1)
+
+	assert.Equal(t, Operation{
+		Op: "Update", Database: "app", Collection: "users",
+		Selector: bson.M{"_id": id}, Update: bson.M{"$set": bson.M{"name": "grace"}},
+	}, ops[1])
+	assert.Equal(t, []string{"$set.name"}, Fields(ops[1].Update))
+
+	assert.Equal(t, "Find", ops[2].Op)
+	assert.Equal(t, "All", ops[2].Method)
+	assert.Equal(t, []string{"-name"}, ops[2].Sort)
+	assert.Equal(t, 5, ops[2].Limit)
+
+	assert.Equal(t, "Remove", ops[3].Op)
+	assert.True(t, ops[3].Bulk)
+}
@@ -0,0 +1,86 @@
+package mgohttptest
+
+import (
+	"fmt"
+	"sort"
+	"testing"
+
+	mgo "gopkg.in/mgo.v2"
+)
+
+// seedCollection is the subset of *mgo.Collection and mgohttp.MongoCollection used to seed
+// fixtures.
+type seedCollection interface {
+	Insert(docs ...interface{}) error
+	DropCollection() error
+}
+
+// collection returns the collection of the database c describes, and the function that
+// releases it.
+func (c Config) collection(name string) (seedCollection, func()) {
+	if c.Fake != nil {
+		return c.Fake.Session().DB(c.Name).C(name), func() {}
+	}
+	sess := c.Sess.Copy()
+	return sess.DB(c.Name).C(name), sess.Close
+}
+
+// dropCollection drops a collection, if it exists.
+func (c Config) dropCollection(name string) error {
+	coll, release := c.collection(name)
+	defer release()
+	err := coll.DropCollection()
+	if qerr, ok := err.(*mgo.QueryError); ok && (qerr.Code == 26 || qerr.Message == "ns not found") {
+		return nil
+	}
+	return err
+}
+
+// seed replaces the collections of fixtures with their documents, in the order of their
+// names.
+func (c Config) seed(fixtures Fixtures) error {
+	for _, name := range fixtures.collections() {
+		if err := c.dropCollection(name); err != nil {
+			return fmt.Errorf("mgohttptest: dropping %s: %w", name, err)
+		}
+		docs := fixtures[name]
+		if len(docs) == 0 {
+			continue
+		}
+		coll, release := c.collection(name)
+		err := coll.Insert(docs...)
+		release()
+		if err != nil {
+			return fmt.Errorf("mgohttptest: inserting the fixtures of %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// collections returns the names of the collections of the fixtures, sorted.
+func (f Fixtures) collections() []string {
+	names := make([]string, 0, len(f))
+	for name := range f {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Seed loads fixtures in the database cfg describes, on its session or its fake, for the
+// tests that set up their context without MakeContext. Each collection of fixtures is
+// dropped first, so the test starts from its fixtures alone, and again when the test ends. A
+// collection with no documents is only dropped.
+func Seed(t testing.TB, cfg Config, fixtures Fixtures) {
+	t.Helper()
+	if err := cfg.seed(fixtures); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		for _, name := range fixtures.collections() {
+			if err := cfg.dropCollection(name); err != nil {
+				t.Errorf("mgohttptest: dropping %s: %s", name, err)
+			}
+		}
+	})
+}
@@ -0,0 +1,54 @@
+package mgohttptest
+
+import (
+	"context"
+	"testing"
+
+	"github.com/Clever/mgohttp/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	bson "gopkg.in/mgo.v2/bson"
+)
+
+func TestSeed(t *testing.T) {
+	fake := NewFakeMongo()
+	db := fake.Session().DB("app")
+	require.NoError(t, db.C("users").Insert(bson.M{"name": "stale"}))
+	require.NoError(t, db.C("audit").Insert(bson.M{"event": "kept"}))
+
+	t.Run("seeded", func(t *testing.T) {
+		Seed(t, Config{Name: "app", Fake: fake}, Fixtures{
+			"users":  {bson.M{"name": "ada"}, bson.M{"name": "grace"}},
+			"orders": {},
+		})
+		n, err := db.C("users").Find(bson.M{"name": "stale"}).Count()
+		require.NoError(t, err)
+		assert.Zero(t, n, "the collection wasn't emptied first")
+		n, err = db.C("users").Find(nil).Count()
+		require.NoError(t, err)
+		assert.Equal(t, 2, n)
+	})
+
+	names, err := db.CollectionNames()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"audit"}, names, "the seeded collections weren't dropped")
+}
+
+func TestMakeContextFixtures(t *testing.T) {
+	fake := NewFakeMongo()
+	ctx := MakeContext(context.Background(), Config{
+		Name:     "app",
+		Fake:     fake,
+		Fixtures: Fixtures{"users": {bson.M{"name": "ada"}}},
+	})
+	var user struct {
+		Name string `bson:"name"`
+	}
+	require.NoError(t, mgohttp.FromContext(ctx, "app").DB("app").C("users").Find(nil).One(&user))
+	assert.Equal(t, "ada", user.Name)
+
+	ctx.Close()
+	names, err := fake.Session().DB("app").CollectionNames()
+	require.NoError(t, err)
+	assert.Empty(t, names)
+}
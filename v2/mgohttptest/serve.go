@@ -0,0 +1,74 @@
+package mgohttptest
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	mgo "gopkg.in/mgo.v2"
+	bson "gopkg.in/mgo.v2/bson"
+)
+
+// DefaultMongoURL is the server ServeWithMongo connects to when MONGO_URL isn't set.
+const DefaultMongoURL = "127.0.0.1:27017"
+
+// Fixtures are the documents to insert before a test, by collection.
+type Fixtures map[string][]interface{}
+
+// HandlerFactory builds the handler under test around the test database, typically the
+// service's own SessionHandler:
+//
+//	func(sess *mgo.Session, database string) http.Handler {
+//		return mgohttp.NewSessionHandler(mgohttp.SessionHandlerConfig{
+//			Sess:     sess,
+//			Database: database,
+//			Timeout:  100 * time.Millisecond,
+//			Handler:  routes(),
+//		})
+//	}
+type HandlerFactory func(sess *mgo.Session, database string) http.Handler
+
+// MongoServer is an HTTP server running a handler against a test database.
+type MongoServer struct {
+	*httptest.Server
+	// Session is connected to the server, e.g. to check the documents written by a request.
+	Session *mgo.Session
+	// Database is the name of the test database, unique to the test.
+	Database string
+}
+
+// DB returns the test database on Session.
+func (s *MongoServer) DB() *mgo.Database {
+	return s.Session.DB(s.Database)
+}
+
+// ServeWithMongo stands up the handler built by newHandler on a fresh database of the server
+// at MONGO_URL, holding fixtures, for end-to-end tests of handlers and their middleware,
+// timeouts included. The database is dropped and the server closed when the test ends.
+func ServeWithMongo(t testing.TB, newHandler HandlerFactory, fixtures Fixtures) *MongoServer {
+	t.Helper()
+	url := os.Getenv("MONGO_URL")
+	if url == "" {
+		url = DefaultMongoURL
+	}
+	sess, err := mgo.DialWithTimeout(url, 5*time.Second)
+	if err != nil {
+		t.Fatalf("mgohttptest: dialing %s: %s", url, err)
+	}
+	database := fmt.Sprintf("mgohttptest-%s", bson.NewObjectId().Hex())
+	t.Cleanup(func() {
+		sess.DB(database).DropDatabase()
+		sess.Close()
+	})
+
+	if err := (Config{Name: database, Sess: sess}).seed(fixtures); err != nil {
+		t.Fatal(err)
+	}
+
+	server := httptest.NewServer(newHandler(sess, database))
+	t.Cleanup(server.Close)
+	return &MongoServer{Server: server, Session: sess, Database: database}
+}
@@ -0,0 +1,60 @@
+//go:build integration
+
+package mgohttptest_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/Clever/mgohttp/v2"
+	"github.com/Clever/mgohttp/v2/mgohttptest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	mgo "gopkg.in/mgo.v2"
+	bson "gopkg.in/mgo.v2/bson"
+)
+
+func TestServeWithMongo(t *testing.T) {
+	var database string
+	server := mgohttptest.ServeWithMongo(t, func(sess *mgo.Session, db string) http.Handler {
+		database = db
+		return mgohttp.NewSessionHandler(mgohttp.SessionHandlerConfig{
+			Sess:     sess,
+			Database: db,
+			Timeout:  200 * time.Millisecond,
+			Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				c := mgohttp.FromContext(r.Context(), db).DB(db).C("users")
+				if r.URL.Path == "/slow" {
+					c.Find(mgohttptest.SlowSelector(time.Second)).One(&bson.M{})
+					return
+				}
+				var users []bson.M
+				if err := c.Find(nil).All(&users); err != nil {
+					mgohttp.WriteError(w, r, err)
+					return
+				}
+				json.NewEncoder(w).Encode(users)
+			}),
+		})
+	}, mgohttptest.Fixtures{"users": {bson.M{"name": "ada"}, bson.M{"name": "grace"}}})
+	assert.Equal(t, database, server.Database)
+
+	res, err := http.Get(server.URL)
+	require.NoError(t, err)
+	defer res.Body.Close()
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+	var users []bson.M
+	require.NoError(t, json.NewDecoder(res.Body).Decode(&users))
+	assert.Len(t, users, 2)
+
+	n, err := server.DB().C("users").Count()
+	require.NoError(t, err)
+	assert.Equal(t, 2, n)
+
+	res, err = http.Get(server.URL + "/slow")
+	require.NoError(t, err)
+	res.Body.Close()
+	assert.Equal(t, http.StatusServiceUnavailable, res.StatusCode)
+}
@@ -0,0 +1,54 @@
+package mgohttptest
+
+import (
+	"fmt"
+	"time"
+
+	mgo "gopkg.in/mgo.v2"
+	bson "gopkg.in/mgo.v2/bson"
+)
+
+// SlowSelector returns a selector matching every document that makes the server spend about
+// d on each document it examines, to test timeouts against a real server. It relies on $where
+// rather than the eval command, which MongoDB 4.2 removed, so it needs server-side JavaScript
+// but works on every version. Query a collection holding a single document, see
+// EnsureDocument.
+func SlowSelector(d time.Duration) bson.M {
+	return bson.M{"$where": fmt.Sprintf("sleep(%d) || true", d.Milliseconds())}
+}
+
+// EnsureDocument inserts a document in the collection unless it already holds one, so
+// SlowSelector has something to examine.
+func EnsureDocument(c *mgo.Collection) error {
+	n, err := c.Count()
+	if err != nil || n > 0 {
+		return err
+	}
+	return c.Insert(bson.M{"_id": bson.NewObjectId()})
+}
+
+// BlockCommands makes the server hold every one of the commands (e.g. "find", "insert") for
+// d before running it, with the failCommand fail point. It doesn't need JavaScript, but the
+// server must run with enableTestCommands and be MongoDB 4.2.9 or later. Call the returned
+// function to turn the fail point off.
+func BlockCommands(sess *mgo.Session, d time.Duration, commands ...string) (func() error, error) {
+	admin := sess.DB("admin")
+	err := admin.Run(bson.D{
+		{Name: "configureFailPoint", Value: "failCommand"},
+		{Name: "mode", Value: "alwaysOn"},
+		{Name: "data", Value: bson.M{
+			"failCommands":    commands,
+			"blockConnection": true,
+			"blockTimeMS":     d.Milliseconds(),
+		}},
+	}, nil)
+	if err != nil {
+		return nil, err
+	}
+	return func() error {
+		return admin.Run(bson.D{
+			{Name: "configureFailPoint", Value: "failCommand"},
+			{Name: "mode", Value: "off"},
+		}, nil)
+	}, nil
+}
@@ -0,0 +1,13 @@
+package mgohttptest
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	bson "gopkg.in/mgo.v2/bson"
+)
+
+func TestSlowSelector(t *testing.T) {
+	assert.Equal(t, bson.M{"$where": "sleep(1500) || true"}, SlowSelector(1500*time.Millisecond))
+}
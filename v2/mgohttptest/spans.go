@@ -0,0 +1,48 @@
+package mgohttptest
+
+import (
+	"github.com/opentracing/opentracing-go/mocktracer"
+)
+
+// FinishedSpans returns the spans finished on tracer with the operation name, e.g. "find".
+func FinishedSpans(tracer *mocktracer.MockTracer, operationName string) []*mocktracer.MockSpan {
+	spans := []*mocktracer.MockSpan{}
+	for _, sp := range tracer.FinishedSpans() {
+		if sp.OperationName == operationName {
+			spans = append(spans, sp)
+		}
+	}
+	return spans
+}
+
+// SpansWithTag returns the spans finished on tracer that carry the tag key with value, e.g.
+// SpansWithTag(tracer, mgohttp.TagCollection, "users").
+func SpansWithTag(tracer *mocktracer.MockTracer, key string, value interface{}) []*mocktracer.MockSpan {
+	spans := []*mocktracer.MockSpan{}
+	for _, sp := range tracer.FinishedSpans() {
+		if v, ok := Tag(sp, key); ok && v == value {
+			spans = append(spans, sp)
+		}
+	}
+	return spans
+}
+
+// Tag returns the value of the tag key on sp.
+func Tag(sp *mocktracer.MockSpan, key string) (interface{}, bool) {
+	v, ok := sp.Tags()[key]
+	return v, ok
+}
+
+// LogValue returns the value of the last log field key on sp, e.g.
+// LogValue(sp, mgohttp.LogSelector). mocktracer records log values as strings.
+func LogValue(sp *mocktracer.MockSpan, key string) (string, bool) {
+	value, found := "", false
+	for _, record := range sp.Logs() {
+		for _, field := range record.Fields {
+			if field.Key == key {
+				value, found = field.ValueString, true
+			}
+		}
+	}
+	return value, found
+}
@@ -0,0 +1,33 @@
+package mgohttptest
+
+import (
+	"testing"
+
+	"github.com/Clever/mgohttp/v2"
+	opentracinglog "github.com/opentracing/opentracing-go/log"
+	"github.com/opentracing/opentracing-go/mocktracer"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSpanHelpers(t *testing.T) {
+	tracer := mocktracer.New()
+	sp := tracer.StartSpan("find")
+	sp.SetTag(mgohttp.TagCollection, "users")
+	sp.LogFields(opentracinglog.String(mgohttp.LogSelector, "_id"))
+	sp.Finish()
+	tracer.StartSpan("update").Finish()
+
+	assert.Len(t, FinishedSpans(tracer, "find"), 1)
+	spans := SpansWithTag(tracer, mgohttp.TagCollection, "users")
+	assert.Len(t, spans, 1)
+
+	v, ok := Tag(spans[0], mgohttp.TagCollection)
+	assert.True(t, ok)
+	assert.Equal(t, "users", v)
+	_, ok = Tag(spans[0], mgohttp.TagAccessMethod)
+	assert.False(t, ok)
+
+	selector, ok := LogValue(spans[0], mgohttp.LogSelector)
+	assert.True(t, ok)
+	assert.Equal(t, "_id", selector)
+}
@@ -0,0 +1,117 @@
+package mgohttptest
+
+import (
+	"context"
+
+	"github.com/Clever/mgohttp/v2"
+	"github.com/Clever/mgohttp/v2/internal"
+	opentracing "github.com/opentracing/opentracing-go"
+	mgo "gopkg.in/mgo.v2"
+)
+
+// Config describes a mongo database that will be injected to the context
+type Config struct {
+	Name string
+	Sess *mgo.Session
+	// Fake, when set, is injected in place of Sess: mgohttp.FromContext returns a session on
+	// the in-memory FakeMongo, and no Mongo server is needed.
+	Fake *FakeMongo
+	// Fixtures are loaded by MakeContext, each of their collections dropped first, and dropped
+	// again by Close, so every test starts from a clean database. See Seed.
+	Fixtures Fixtures
+	// Record has the operations run on the database recorded, see DbHandler.Operations.
+	Record bool
+}
+
+// DbHandler manages our interaction with the testing Context.
+type DbHandler interface {
+	context.Context
+	Close()
+	// Operations returns the operations run so far on the databases of the Configs with
+	// Record set, in the order they ran, e.g. to assert that a handler issued a single Update:
+	//
+	//	ops := ctx.Operations()
+	//	require.Len(t, ops, 1)
+	//	assert.Equal(t, "Update", ops[0].Op)
+	//	assert.Equal(t, []string{"$set.name"}, mgohttptest.Fields(ops[0].Update))
+	Operations() []Operation
+}
+
+// testContext embeds a context and tracks open sessions so then can be cleared out on Close.
+type testContext struct {
+	context.Context
+	sessions []*mgo.Session
+	seeded   []Config
+	recorder *recorder
+}
+
+// Close drops the collections of the fixtures, and calls Close on all tracked *mgo.Session's
+func (t testContext) Close() {
+	for _, c := range t.seeded {
+		for _, name := range c.Fixtures.collections() {
+			c.dropCollection(name)
+		}
+	}
+	for _, s := range t.sessions {
+		s.Close()
+	}
+}
+
+func (t testContext) Operations() []Operation {
+	return t.recorder.operations()
+}
+
+// MakeContext creates a new Context that contains mgohttp database connections. It panics if
+// the Fixtures can't be loaded.
+func MakeContext(ctx context.Context, cfgs ...Config) DbHandler {
+	// We track all sessions created so that we can close them
+	sessions := []*mgo.Session{}
+	seeded := []Config{}
+	var rec *recorder
+
+	_, ctx = opentracing.StartSpanFromContext(ctx, "test")
+
+	for _, c := range cfgs {
+		if len(c.Fixtures) > 0 {
+			if err := c.seed(c.Fixtures); err != nil {
+				panic(err)
+			}
+			seeded = append(seeded, c)
+		}
+		if c.Record && rec == nil {
+			rec = &recorder{}
+		}
+		if c.Fake != nil {
+			fake, record := c.Fake, c.Record
+			ctx = internal.NewProviderContext(ctx, c.Name, func(context.Context) interface{} {
+				if record {
+					return rec.wrap(fake.Session())
+				}
+				return fake.Session()
+			})
+			continue
+		}
+		newSess := c.Sess.Copy()
+		sessions = append(sessions, newSess)
+		cache := &internal.SessionCache{}
+		var getSession internal.SessionGetter = func(ctx context.Context) (*mgo.Session, context.Context, error) {
+			return newSess, internal.WithSessionCache(ctx, cache), nil
+		}
+		if !c.Record {
+			ctx = internal.NewContext(ctx, c.Name, getSession)
+			continue
+		}
+		name := c.Name
+		ctx = internal.NewProviderContext(ctx, name, func(ctx context.Context) interface{} {
+			// the traced session is built from the getter, which shadows the provider
+			return rec.wrap(mgohttp.FromContext(internal.NewContext(ctx, name, getSession), name))
+		})
+	}
+
+	return testContext{
+		Context:  ctx,
+		sessions: sessions,
+		seeded:   seeded,
+		recorder: rec,
+	}
+}
@@ -0,0 +1,1011 @@
+package mgohttp
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	opentracing "github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/ext"
+	opentracinglog "github.com/opentracing/opentracing-go/log"
+	mgo "gopkg.in/mgo.v2"
+	bson "gopkg.in/mgo.v2/bson"
+)
+
+type tracedMgoSession struct {
+	sess      *mgo.Session
+	ctx       context.Context
+	databases *wrapperCache[MongoDatabase]
+}
+
+func (ts tracedMgoSession) DB(name string) MongoDatabase {
+	recordUsage("MongoSession.DB")
+	opentracing.SpanFromContext(ts.ctx).SetTag(TagDatabase, name)
+	return ts.databases.get(name, func() MongoDatabase {
+		return tracedMgoDatabase{
+			db:          ts.sess.DB(name),
+			ctx:         context.WithValue(ts.ctx, databaseKey, name),
+			collections: newWrapperCache[MongoCollection](),
+		}
+	})
+}
+
+func (ts tracedMgoSession) Ping() (err error) {
+	recordUsage("MongoSession.Ping")
+	sp, _ := startOp(ts.ctx, "ping", "")
+	defer sp.Finish()
+	defer sp.recoverPanic(&err)
+
+	return sp.done(sp.intercept(OpInfo{}, func(*OpInfo) error { return ts.sess.Ping() }))
+}
+
+func (ts tracedMgoSession) PingWithInfo(ctx context.Context) (PingInfo, error) {
+	recordUsage("MongoSession.PingWithInfo")
+	sp, _ := startSpan(ts.ctx, "ping")
+	defer sp.Finish()
+
+	// the ping may outlive this call if ctx is done first, so hand the result back over a
+	// channel rather than sharing a variable with it
+	infos := make(chan PingInfo, 1)
+	err := runWithContext(ctx, func() error {
+		info, err := pingWithInfo(ts.sess)
+		infos <- info
+		return err
+	})
+	var info PingInfo
+	if err == nil {
+		info = <-infos
+		sp.SetTag(TagServerAddress, info.Address)
+		sp.SetTag(TagServerState, info.State)
+		sp.LogFields(opentracinglog.Int64(LogRTTMillis, info.RTT.Milliseconds()))
+	}
+	return info, logAndReturnErr(sp, err)
+}
+
+func (ts tracedMgoSession) ServerVersion(ctx context.Context) (mgo.BuildInfo, error) {
+	recordUsage("MongoSession.ServerVersion")
+	sp, _ := startSpan(ts.ctx, "server-version")
+	defer sp.Finish()
+
+	infos := make(chan mgo.BuildInfo, 1)
+	err := runWithContext(ctx, func() error {
+		info, err := serverBuildInfo(ts.ctx, ts.sess)
+		infos <- info
+		return err
+	})
+	var info mgo.BuildInfo
+	if err == nil {
+		info = <-infos
+		sp.SetTag(TagServerVersion, info.Version)
+	}
+	return info, logAndReturnErr(sp, err)
+}
+
+func (ts tracedMgoSession) SetSafe(safe *mgo.Safe) {
+	recordUsage("MongoSession.SetSafe")
+	ts.sess.SetSafe(safe)
+	if sp := opentracing.SpanFromContext(ts.ctx); sp != nil {
+		sp.SetTag(TagWriteConcern, safeName(safe))
+	}
+}
+
+type tracedMgoDatabase struct {
+	db          *mgo.Database
+	ctx         context.Context
+	collections *wrapperCache[MongoCollection]
+}
+
+func (t tracedMgoDatabase) C(collection string) MongoCollection {
+	recordUsage("MongoDatabase.C")
+	return t.collections.get(collection, func() MongoCollection {
+		return tracedMgoCollection{
+			collectionName: collection,
+			collection:     t.db.C(collection),
+			ctx:            t.ctx,
+		}
+	})
+}
+
+func (t tracedMgoDatabase) Run(cmd interface{}, result interface{}) (err error) {
+	recordCommandUsage(cmd)
+	sp, _ := startOp(t.ctx, "run", "")
+	defer sp.Finish()
+	defer sp.recoverPanic(&err)
+	sp.LogKV(opentracinglog.String(LogCommand, fmt.Sprintf("%#v", cmd)))
+	release, err := sp.limit(commandTarget(cmd))
+	if err != nil {
+		return logAndReturnErr(sp, err)
+	}
+	defer release()
+
+	return sp.done(sp.intercept(OpInfo{Command: cmd}, func(op *OpInfo) error {
+		return t.db.Run(op.Command, result)
+	}))
+}
+
+type tracedMgoCollection struct {
+	collectionName string
+	collection     *mgo.Collection
+	ctx            context.Context
+	concern        *writeConcern // set by WithWriteConcern
+}
+
+func (tc tracedMgoCollection) UpdateId(id bson.ObjectId, update interface{}) error {
+	recordUsage("MongoCollection.UpdateId")
+	return tc.Update(bson.M{"_id": tc.normalizeID(id)}, update)
+}
+
+func (tc tracedMgoCollection) Update(selector interface{}, update interface{}) (err error) {
+	recordSelectorUsage("MongoCollection.Update", selector, update)
+	sp, _ := startOp(tc.ctx, "update", tc.collectionName)
+	sp.logSelector(selector)
+	sp.LogFields(bsonToKeys(tc.ctx, LogUpdate, update))
+	defer sp.Finish()
+	defer sp.recoverPanic(&err)
+	if err := tc.guard(sp, selector); err != nil {
+		return logAndReturnErr(sp, err)
+	}
+	if err := tc.checkSize(sp, selector, update); err != nil {
+		return logAndReturnErr(sp, err)
+	}
+
+	c, release := tc.writer(sp)
+	defer release()
+	return sp.done(sp.intercept(OpInfo{Selector: selector, Update: update}, func(op *OpInfo) error {
+		return c.Update(commentSelector(tc.ctx, op.Selector), op.Update)
+	}))
+}
+
+func (tc tracedMgoCollection) UpdateAll(selector interface{}, update interface{}) (info *mgo.ChangeInfo, err error) {
+	recordSelectorUsage("MongoCollection.UpdateAll", selector, update)
+	sp, _ := startOp(tc.ctx, "update-all", tc.collectionName)
+	sp.logSelector(selector)
+	sp.LogFields(bsonToKeys(tc.ctx, LogUpdate, update))
+	defer sp.Finish()
+	defer sp.recoverPanic(&err)
+	chunks := tc.inChunks(sp, selector)
+	if err := tc.guard(sp, guardedSelector(selector, chunks)); err != nil {
+		return nil, logAndReturnErr(sp, err)
+	}
+
+	c, release := tc.writer(sp)
+	defer release()
+	err = sp.intercept(OpInfo{Selector: selector, Update: update}, func(op *OpInfo) (err error) {
+		if chunks != nil && sameSelector(op.Selector, selector) {
+			info, err = splitChanges(chunks, func(chunk interface{}) (*mgo.ChangeInfo, error) {
+				return c.UpdateAll(commentSelector(tc.ctx, chunk), op.Update)
+			})
+			return err
+		}
+		info, err = c.UpdateAll(commentSelector(tc.ctx, op.Selector), op.Update)
+		return err
+	})
+	return info, sp.done(err)
+}
+
+func (tc tracedMgoCollection) Insert(docs ...interface{}) (err error) {
+	recordUsage("MongoCollection.Insert")
+	sp, _ := startOp(tc.ctx, "insert", tc.collectionName)
+	sp.LogFields(opentracinglog.Int(LogNumDocs, len(docs)))
+	defer sp.Finish()
+	defer sp.recoverPanic(&err)
+	if err := tc.guard(sp, nil); err != nil {
+		return logAndReturnErr(sp, err)
+	}
+
+	c, release := tc.writer(sp)
+	defer release()
+	return sp.done(sp.intercept(OpInfo{Docs: docs}, func(op *OpInfo) error {
+		return c.Insert(op.Docs...)
+	}))
+}
+
+func (tc tracedMgoCollection) Upsert(selector interface{}, update interface{}) (info *mgo.ChangeInfo, err error) {
+	recordSelectorUsage("MongoCollection.Upsert", selector, update)
+	sp, _ := startOp(tc.ctx, "upsert", tc.collectionName)
+	sp.logSelector(selector)
+	sp.LogFields(bsonToKeys(tc.ctx, LogUpdate, update))
+	defer sp.Finish()
+	defer sp.recoverPanic(&err)
+	if err := tc.guard(sp, selector); err != nil {
+		return nil, logAndReturnErr(sp, err)
+	}
+	if err := tc.checkSize(sp, selector, update); err != nil {
+		return nil, logAndReturnErr(sp, err)
+	}
+
+	c, release := tc.writer(sp)
+	defer release()
+	err = sp.intercept(OpInfo{Selector: selector, Update: update}, func(op *OpInfo) (err error) {
+		info, err = c.Upsert(commentSelector(tc.ctx, op.Selector), op.Update)
+		return err
+	})
+	return info, sp.done(err)
+}
+
+func (tc tracedMgoCollection) FindId(id bson.ObjectId) MongoQuery {
+	recordUsage("MongoCollection.FindId")
+	return tc.Find(bson.M{"_id": tc.normalizeID(id)})
+}
+
+func (tc tracedMgoCollection) Find(selector interface{}) MongoQuery {
+	recordSelectorUsage("MongoCollection.Find", selector)
+	sp, ctx := startOp(tc.ctx, "find", tc.collectionName)
+
+	// NOTE: Find just starts the trace, the finishing call on the MongoQuery must
+	// finish it.
+	sp.logSelector(selector)
+	chunks := tc.inChunks(sp, selector)
+	if err := tc.guard(sp, guardedSelector(selector, chunks)); err != nil {
+		logAndReturnErr(sp, err)
+		sp.Finish()
+		return failedMongoQuery{err: err}
+	}
+	comment := opCommentFromContext(ctx)
+	q := tracedMongoQuery{
+		q:    tc.collection.Find(selector),
+		ctx:  ctx,
+		op:   sp,
+		spec: querySpec{collection: tc.collection, filter: selector, comment: comment},
+	}
+	if chunks != nil {
+		q.split = &inSplit{chunks: chunks}
+		for _, chunk := range chunks {
+			q.split.queries = append(q.split.queries, tc.collection.Find(chunk))
+		}
+	}
+	if comment != "" {
+		q.q.Comment(comment)
+		if q.split != nil {
+			q.split.modify(func(sq *mgo.Query) { sq.Comment(comment) })
+		}
+	}
+	return q
+}
+
+func (tc tracedMgoCollection) RemoveId(id bson.ObjectId) error {
+	recordUsage("MongoCollection.RemoveId")
+	return tc.Remove(bson.M{"_id": tc.normalizeID(id)})
+}
+
+func (tc tracedMgoCollection) Remove(selector interface{}) (err error) {
+	recordSelectorUsage("MongoCollection.Remove", selector)
+	sp, _ := startOp(tc.ctx, "remove", tc.collectionName)
+	sp.logSelector(selector)
+	defer sp.Finish()
+	defer sp.recoverPanic(&err)
+	if err := tc.guard(sp, selector); err != nil {
+		return logAndReturnErr(sp, err)
+	}
+
+	c, release := tc.writer(sp)
+	defer release()
+	return sp.done(sp.intercept(OpInfo{Selector: selector}, func(op *OpInfo) error {
+		return c.Remove(commentSelector(tc.ctx, op.Selector))
+	}))
+}
+
+func (tc tracedMgoCollection) RemoveAll(selector interface{}) (info *mgo.ChangeInfo, err error) {
+	recordSelectorUsage("MongoCollection.RemoveAll", selector)
+	sp, _ := startOp(tc.ctx, "removeall", tc.collectionName)
+	sp.logSelector(selector)
+	defer sp.Finish()
+	defer sp.recoverPanic(&err)
+	chunks := tc.inChunks(sp, selector)
+	if err := tc.guard(sp, guardedSelector(selector, chunks)); err != nil {
+		return nil, logAndReturnErr(sp, err)
+	}
+
+	c, release := tc.writer(sp)
+	defer release()
+	err = sp.intercept(OpInfo{Selector: selector}, func(op *OpInfo) (err error) {
+		if chunks != nil && sameSelector(op.Selector, selector) {
+			info, err = splitChanges(chunks, func(chunk interface{}) (*mgo.ChangeInfo, error) {
+				return c.RemoveAll(commentSelector(tc.ctx, chunk))
+			})
+			return err
+		}
+		info, err = c.RemoveAll(commentSelector(tc.ctx, op.Selector))
+		return err
+	})
+	return info, sp.done(err)
+}
+
+// guard runs the pre-flight checks shared by every collection operation.
+func (tc tracedMgoCollection) guard(sp opentracing.Span, selector interface{}) error {
+	if err := tc.checkDisabled(sp); err != nil {
+		return err
+	}
+	tc.checkRegex(sp, selector)
+	return tc.checkSelector(sp, selector)
+}
+
+// inChunks returns the chunks to run selector in when the handler splits large $in queries,
+// or nil when selector should be sent as is.
+func (tc tracedMgoCollection) inChunks(sp opentracing.Span, selector interface{}) []bson.M {
+	h := handlerFromContext(tc.ctx)
+	if h == nil || !rolledOut(tc.ctx, RolloutInSplit) {
+		return nil
+	}
+	chunks := splitIn(selector, h.cfg.InSplitSize)
+	if chunks != nil {
+		sp.SetTag(TagInSplitChunks, len(chunks))
+	}
+	return chunks
+}
+
+// guardedSelector is the selector the pre-flight checks should see: each chunk of a split
+// query is sent on its own, so the first one stands in for all of them.
+func guardedSelector(selector interface{}, chunks []bson.M) interface{} {
+	if chunks != nil {
+		return chunks[0]
+	}
+	return selector
+}
+
+// checkDisabled returns a CollectionDisabledError, and tags the span, when the kill switch
+// is in effect for this collection.
+func (tc tracedMgoCollection) checkDisabled(sp opentracing.Span) error {
+	database := tc.collection.Database.Name
+	if !IsCollectionDisabled(database, tc.collectionName) {
+		return nil
+	}
+	sp.SetTag(TagCollectionDisabled, true)
+	return CollectionDisabledError{Database: database, Collection: tc.collectionName}
+}
+
+type tracedMongoQuery struct {
+	q     *mgo.Query
+	ctx   context.Context
+	op    *opSpan // started by Find, finished by the access method
+	spec  querySpec
+	split *inSplit // set when the selector's $in was split into chunks
+}
+
+// routed returns the query bound to the session that reads according to the query's read
+// preference, along with a func to release it. Within a request, that's a copy of the request's
+// session made once per preference, or of the connection to the member picked by the handler's
+// NearestRouter, see routedSession.
+func (q tracedMongoQuery) routed() (rq tracedMongoQuery, release func(), err error) {
+	defer func() { rq.op.spec = &rq.spec }()
+	h := handlerFromContext(q.ctx)
+	pref := q.spec.readPref
+	if pref == nil {
+		pref = readPreferenceFromContext(q.ctx)
+	}
+	if pref == nil && h != nil {
+		pref = h.cfg.ReadPreference
+	}
+	s, _ := q.ctx.Value(requestSessionKey).(*requestSession)
+	if pref != nil && pref.Mode == mgo.Nearest && h != nil && h.cfg.NearestRouter != nil && s != nil {
+		if member, addr := h.cfg.NearestRouter.member(pref.TagSets); member != nil {
+			sess, err := s.routedSession(q.ctx, member, nil)
+			if err != nil {
+				return q, nil, err
+			}
+			q.op.SetTag(TagReadMember, addr)
+			ext.PeerAddress.Set(q.op, addr)
+			return q.rebind(sess), func() {}, nil
+		}
+	}
+
+	if q.spec.readPref == nil {
+		return q, func() {}, nil
+	}
+	if s != nil {
+		sess, err := s.routedSession(q.ctx, q.spec.collection.Database.Session, q.spec.readPref)
+		if err != nil {
+			return q, nil, err
+		}
+		return q.rebind(sess), func() {}, nil
+	}
+	sess := q.spec.collection.Database.Session.Copy()
+	q.spec.readPref.apply(sess)
+	return q.rebind(sess), sess.Close, nil
+}
+
+// admit checks the query can run, and takes a slot of the handler's OpLimiter for it. When
+// it's rejected, the query's span is finished with the error.
+func (q tracedMongoQuery) admit() (func(), error) {
+	if q.snapshotReads() {
+		q.op.SetTag(TagReadConcern, "snapshot")
+		err := logAndReturnErr(q.op, ErrSnapshotReadsUnsupported)
+		q.op.Finish()
+		return nil, err
+	}
+	if q.spec.maxTime != 0 {
+		if err := checkServerFeature(q.ctx, q.spec.collection.Database.Session, FeatureMaxTimeMS); err != nil {
+			err = logAndReturnErr(q.op, err)
+			q.op.Finish()
+			return nil, err
+		}
+	}
+	release, err := q.op.limit(q.op.name, q.spec.collection.Name)
+	if err != nil {
+		err = logAndReturnErr(q.op, err)
+		q.op.Finish()
+		return nil, err
+	}
+	return release, nil
+}
+
+// rebind rebuilds the query, and its chunks if it's split, on sess.
+func (q tracedMongoQuery) rebind(sess *mgo.Session) tracedMongoQuery {
+	q.op.sess = sess
+	q.spec.collection = q.spec.collection.With(sess)
+	q.q = q.spec.query()
+	if q.split != nil {
+		split := *q.split
+		split.queries = nil
+		for _, chunk := range q.split.chunks {
+			spec := q.spec
+			spec.filter = chunk
+			split.queries = append(split.queries, spec.query())
+		}
+		q.split = &split
+	}
+	return q
+}
+
+// emulated reports whether the access method must be emulated with a database command to
+// honor a collation or a read concern, which mgo doesn't support natively.
+func (q tracedMongoQuery) emulated() (bool, error) {
+	if q.spec.collation == nil && q.spec.readConcern == "" {
+		return false, nil
+	}
+	info, err := serverBuildInfo(q.ctx, q.spec.collection.Database.Session)
+	if err != nil {
+		return true, nil
+	}
+	if q.spec.collation != nil && !FeatureCollation.SupportedBy(info) {
+		return true, UnsupportedFeatureError{Feature: FeatureCollation, Version: info.Version}
+	}
+	if q.spec.readConcern != "" && !FeatureReadConcern.SupportedBy(info) {
+		return true, UnsupportedFeatureError{Feature: FeatureReadConcern, Version: info.Version}
+	}
+	return true, nil
+}
+
+// useSplit reports whether the access method should run the chunked queries.
+func (q tracedMongoQuery) useSplit(sp opentracing.Span) bool {
+	if q.split == nil {
+		return false
+	}
+	if q.split.unsplittable != "" {
+		sp.SetTag(TagInSplitSkipped, q.split.unsplittable)
+		return false
+	}
+	return true
+}
+
+func (q tracedMongoQuery) All(result interface{}) (err error) {
+	recordUsage("MongoQuery.All")
+	q, err = q.enforceLimit()
+	if err != nil {
+		defer q.op.Finish()
+		return logAndReturnErr(q.op, err)
+	}
+	unlimit, err := q.admit()
+	if err != nil {
+		return err
+	}
+	defer unlimit()
+	q, release, err := q.routed()
+	if err != nil {
+		defer q.op.Finish()
+		return logAndReturnErr(q.op, err)
+	}
+	defer release()
+	sp := q.op
+	defer sp.Finish()
+	defer sp.recoverPanic(&err)
+
+	sp.SetTag(TagAccessMethod, "All")
+	defer logResultBytes(sp, result)
+	err = q.intercept("All", nil, func(q tracedMongoQuery, _ *OpInfo) error {
+		q.mirror("All")
+		if emulated, err := q.emulated(); emulated {
+			if err == nil {
+				err = q.spec.all(result)
+			}
+			return err
+		}
+		if q.useSplit(sp) {
+			return q.split.all(result)
+		}
+		return q.q.All(result)
+	})
+	digestFromContext(q.ctx).add(q.spec.collection.Name, "All", result, err)
+	return sp.done(err)
+}
+
+func (q tracedMongoQuery) One(result interface{}) (err error) {
+	recordUsage("MongoQuery.One")
+	unlimit, err := q.admit()
+	if err != nil {
+		return err
+	}
+	defer unlimit()
+	q, release, err := q.routed()
+	if err != nil {
+		defer q.op.Finish()
+		return logAndReturnErr(q.op, err)
+	}
+	defer release()
+	sp := q.op
+	defer sp.Finish()
+	defer sp.recoverPanic(&err)
+
+	sp.SetTag(TagAccessMethod, "One")
+	defer logResultBytes(sp, result)
+	err = q.intercept("One", nil, func(q tracedMongoQuery, _ *OpInfo) error {
+		q.mirror("One")
+		if emulated, err := q.emulated(); emulated {
+			if err == nil {
+				err = q.spec.one(result)
+			}
+			return err
+		}
+		if q.useSplit(sp) {
+			return q.split.one(result)
+		}
+		return q.q.One(result)
+	})
+	digestFromContext(q.ctx).add(q.spec.collection.Name, "One", result, err)
+	return sp.done(err)
+}
+
+func (q tracedMongoQuery) Count() (n int, err error) {
+	recordUsage("MongoQuery.Count")
+	unlimit, err := q.admit()
+	if err != nil {
+		return 0, err
+	}
+	defer unlimit()
+	q, release, err := q.routed()
+	if err != nil {
+		defer q.op.Finish()
+		return 0, logAndReturnErr(q.op, err)
+	}
+	defer release()
+	sp := q.op
+	defer sp.Finish()
+	defer sp.recoverPanic(&err)
+
+	sp.SetTag(TagAccessMethod, "Count")
+	err = q.intercept("Count", nil, func(q tracedMongoQuery, _ *OpInfo) (err error) {
+		q.mirror("Count")
+		if emulated, err := q.emulated(); emulated {
+			if err == nil {
+				n, err = q.spec.count()
+			}
+			return err
+		}
+		if q.useSplit(sp) {
+			n, err = q.split.count()
+			return err
+		}
+		n, err = q.q.Count()
+		return err
+	})
+	digestFromContext(q.ctx).add(q.spec.collection.Name, "Count", n, err)
+	return n, sp.done(err)
+}
+
+func (q tracedMongoQuery) Limit(n int) MongoQuery {
+	recordUsage("MongoQuery.Limit")
+	// NOTE: this function just modifies the query, we will rely on
+	// One/All to terminate the span.
+
+	sp := opentracing.SpanFromContext(q.ctx)
+	sp.LogFields(opentracinglog.Int(LogQueryLimit, n))
+	q.q = q.q.Limit(n)
+	q.spec.limit = n
+	if q.split != nil {
+		q.split.limit = n
+		q.split.modify(func(sq *mgo.Query) { sq.Limit(n) })
+	}
+	q.ctx = opentracing.ContextWithSpan(q.ctx, sp)
+	return q
+}
+
+func (q tracedMongoQuery) Select(selector interface{}) MongoQuery {
+	recordUsage("MongoQuery.Select")
+	// NOTE: this function just modifies the query, we will rely on
+	// One/All to terminate the span.
+
+	sp := opentracing.SpanFromContext(q.ctx)
+	sp.LogFields(bsonToKeys(q.ctx, LogSelect, selector))
+	q.q = q.q.Select(selector)
+	q.spec.projection = selector
+	if q.split != nil {
+		q.split.modify(func(sq *mgo.Query) { sq.Select(selector) })
+	}
+	q.ctx = opentracing.ContextWithSpan(q.ctx, sp)
+	return q
+}
+
+func (q tracedMongoQuery) Hint(indexKey ...string) MongoQuery {
+	recordUsage("MongoQuery.Hint")
+	// NOTE: this function just modifies the query, we will rely on
+	// One/All to terminate the span.
+
+	sp := opentracing.SpanFromContext(q.ctx)
+	for i, hint := range indexKey {
+		sp.LogFields(opentracinglog.String(fmt.Sprintf(LogHintPrefix+"%d", i), hint))
+	}
+
+	q.q = q.q.Hint(indexKey...)
+	q.spec.hint = indexKey
+	if q.split != nil {
+		q.split.modify(func(sq *mgo.Query) { sq.Hint(indexKey...) })
+	}
+	q.ctx = opentracing.ContextWithSpan(q.ctx, sp)
+	return q
+}
+
+func (q tracedMongoQuery) Sort(fields ...string) MongoQuery {
+	recordUsage("MongoQuery.Sort")
+	// NOTE: this function just modifies the query, we will rely on
+	// One/All to terminate the span.
+
+	sp := opentracing.SpanFromContext(q.ctx)
+	sp.SetTag(TagSort, strings.Join(fields, "|"))
+	q.q = q.q.Sort(fields...)
+	q.spec.sort = fields
+	if q.split != nil {
+		q.split.unsplittable = "sorted"
+	}
+	q.ctx = opentracing.ContextWithSpan(q.ctx, sp)
+	return q
+}
+
+func (q tracedMongoQuery) And(selector interface{}) MongoQuery {
+	recordUsage("MongoQuery.And")
+	q.spec.filter = andSelectors(q.spec.filter, selector)
+	q.q = q.spec.query()
+	q.split = nil
+	return q
+}
+
+func (q tracedMongoQuery) Skip(n int) MongoQuery {
+	recordUsage("MongoQuery.Skip")
+	// NOTE: this function just modifies the query, we will rely on
+	// One/All to terminate the span.
+
+	sp := opentracing.SpanFromContext(q.ctx)
+	sp.LogFields(opentracinglog.Int(LogQuerySkip, n))
+	q.q = q.q.Skip(n)
+	q.spec.skip = n
+	if q.split != nil {
+		q.split.unsplittable = "skip"
+	}
+	q.ctx = opentracing.ContextWithSpan(q.ctx, sp)
+	return q
+}
+
+func (q tracedMongoQuery) Batch(n int) MongoQuery {
+	recordUsage("MongoQuery.Batch")
+	// NOTE: this function just modifies the query, we will rely on
+	// One/All to terminate the span.
+
+	sp := opentracing.SpanFromContext(q.ctx)
+	sp.LogFields(opentracinglog.Int(LogQueryBatch, n))
+	q.q = q.q.Batch(n)
+	q.spec.batch = n
+	if q.split != nil {
+		q.split.modify(func(sq *mgo.Query) { sq.Batch(n) })
+	}
+	q.ctx = opentracing.ContextWithSpan(q.ctx, sp)
+	return q
+}
+
+func (q tracedMongoQuery) Prefetch(p float64) MongoQuery {
+	recordUsage("MongoQuery.Prefetch")
+	// NOTE: this function just modifies the query, we will rely on
+	// One/All to terminate the span.
+
+	sp := opentracing.SpanFromContext(q.ctx)
+	sp.LogFields(opentracinglog.Float64(LogQueryPrefetch, p))
+	q.q = q.q.Prefetch(p)
+	q.spec.prefetch = &p
+	if q.split != nil {
+		q.split.modify(func(sq *mgo.Query) { sq.Prefetch(p) })
+	}
+	q.ctx = opentracing.ContextWithSpan(q.ctx, sp)
+	return q
+}
+
+func (q tracedMongoQuery) SetMaxTime(d time.Duration) MongoQuery {
+	recordUsage("MongoQuery.SetMaxTime")
+	// NOTE: this function just modifies the query, we will rely on
+	// One/All to terminate the span.
+
+	sp := opentracing.SpanFromContext(q.ctx)
+	sp.LogFields(opentracinglog.Int64(LogQueryMaxTimeMillis, d.Milliseconds()))
+	q.q = q.q.SetMaxTime(d)
+	q.spec.maxTime = d
+	if q.split != nil {
+		q.split.modify(func(sq *mgo.Query) { sq.SetMaxTime(d) })
+	}
+	q.ctx = opentracing.ContextWithSpan(q.ctx, sp)
+	return q
+}
+
+func (q tracedMongoQuery) Apply(change mgo.Change, result interface{}) (info *mgo.ChangeInfo, err error) {
+	recordApplyUsage(change)
+	unlimit, err := q.admit()
+	if err != nil {
+		return nil, err
+	}
+	defer unlimit()
+	sp := q.op
+	defer sp.Finish()
+	defer sp.recoverPanic(&err)
+
+	sp.SetTag(TagAccessMethod, "apply")
+	sp.LogFields(bsonToKeys(q.ctx, LogUpdate, change.Update))
+	sp.LogFields(
+		opentracinglog.Bool(LogRemove, change.Remove),
+		opentracinglog.Bool(LogReturnNew, change.ReturnNew),
+		opentracinglog.Bool(LogUpsert, change.Upsert),
+	)
+
+	err = q.intercept("Apply", change.Update, func(q tracedMongoQuery, op *OpInfo) (err error) {
+		change.Update = op.Update
+		if emulated, err := q.emulated(); emulated {
+			if err == nil {
+				info, err = q.spec.apply(change, result)
+			}
+			return err
+		}
+		info, err = q.q.Apply(change, result)
+		return err
+	})
+	return info, sp.done(err)
+}
+
+func (q tracedMongoQuery) Iter() MongoIter {
+	recordUsage("MongoQuery.Iter")
+	sp, ctx := startSpan(q.ctx, "iter")
+	unlimit, err := q.admit()
+	if err != nil {
+		logAndReturnErr(sp, err)
+		sp.Finish()
+		return failedMongoIter{err: err}
+	}
+	q, routedRelease, err := q.routed()
+	if err != nil {
+		unlimit()
+		logAndReturnErr(sp, err)
+		sp.Finish()
+		return failedMongoIter{err: err}
+	}
+	var i *mgo.Iter
+	iterDone := func() {}
+	release := func() {
+		iterDone()
+		routedRelease()
+		unlimit()
+	}
+	err = q.intercept("Iter", nil, func(q tracedMongoQuery, _ *OpInfo) error {
+		if emulated, err := q.emulated(); emulated {
+			if err != nil {
+				return err
+			}
+			i, iterDone = q.spec.iter()
+			return nil
+		}
+		i = q.q.Iter()
+		return nil
+	})
+	if err != nil {
+		release()
+		logAndReturnErr(sp, err)
+		sp.Finish()
+		return failedMongoIter{err: err}
+	}
+	return tracedMongoIter{
+		i:           i,
+		ctx:         ctx,
+		collection:  q.spec.collection.Name,
+		fingerprint: q.op.fingerprint,
+		release:     sync.OnceFunc(release),
+		ended:       new(sync.Once),
+		heartbeat:   newIterHeartbeat(ctx),
+		digest:      digestFromContext(ctx).iter(q.spec.collection.Name),
+		stats:       newQueryCursorStats(ctx, q.spec.collection.Name, q.spec.batch),
+	}
+}
+
+func (q tracedMongoQuery) WithReadPreference(p ReadPreference) MongoQuery {
+	recordUsage("MongoQuery.WithReadPreference")
+	// NOTE: this function just modifies the query, we will rely on
+	// One/All to terminate the span.
+
+	sp := opentracing.SpanFromContext(q.ctx)
+	p.tag(sp)
+	q.spec.readPref = &p
+	q.ctx = opentracing.ContextWithSpan(q.ctx, sp)
+	return q
+}
+
+func (q tracedMongoQuery) WithCollation(c Collation) MongoQuery {
+	recordUsage("MongoQuery.WithCollation")
+	// NOTE: this function just modifies the query, we will rely on
+	// One/All to terminate the span.
+
+	sp := opentracing.SpanFromContext(q.ctx)
+	sp.SetTag(TagCollation, c.Locale)
+	sp.LogFields(opentracinglog.Int(LogCollationStrength, c.Strength))
+	q.spec.collation = &c
+	q.ctx = opentracing.ContextWithSpan(q.ctx, sp)
+	return q
+}
+
+func (q tracedMongoQuery) WithSnapshot() MongoQuery {
+	recordUsage("MongoQuery.WithSnapshot")
+	q.spec.snapshot = true
+	return q
+}
+
+type tracedMongoIter struct {
+	i           *mgo.Iter
+	ctx         context.Context
+	collection  string
+	fingerprint string
+	// release gives back the op limiter slot and the session copy of a routed query, once the
+	// cursor is read: by All, Close or the last Next
+	release   func()
+	ended     *sync.Once // finishes the span of the cursor, by All or Close
+	heartbeat *iterHeartbeat
+	digest    *iterDigest // nil unless the request's results are digested
+	stats     *cursorStats
+}
+
+func (t tracedMongoIter) All(result interface{}) error {
+	recordUsage("MongoIter.All")
+	sp, _ := startSpan(t.ctx, "iter-all")
+	err := t.i.All(result)
+	if err == nil {
+		t.digest.next(result)
+		t.stats.readAll(result)
+	}
+	err = logAndReturnErr(sp, t.wrapErr(err))
+	sp.Finish()
+	// All closed the cursor
+	return t.end(err)
+}
+
+func (t tracedMongoIter) Close() error {
+	recordUsage("MongoIter.Close")
+	err := budgetErr(t.ctx, t.i, t.i.Close())
+	return t.end(t.wrapErr(err))
+}
+
+// end releases the cursor, and reports it and finishes its span the first time it's called:
+// a Close after All returns err without tracing it twice.
+func (t tracedMongoIter) end(err error) error {
+	t.done()
+	if t.ended == nil {
+		return err
+	}
+	t.ended.Do(func() {
+		t.digest.close(err)
+		t.stats.report()
+		sp := opentracing.SpanFromContext(t.ctx)
+		logAndReturnErr(sp, err)
+		sp.Finish()
+	})
+	return err
+}
+
+// done gives back the op limiter slot and the session of the cursor.
+func (t tracedMongoIter) done() {
+	if t.release != nil {
+		t.release()
+	}
+}
+
+func (t tracedMongoIter) Done() bool {
+	recordUsage("MongoIter.Done")
+	return t.i.Done()
+
+}
+func (t tracedMongoIter) Err() error {
+	recordUsage("MongoIter.Err")
+	err := budgetErr(t.ctx, t.i, t.i.Err())
+	return logAndReturnErr(opentracing.SpanFromContext(t.ctx), t.wrapErr(err))
+}
+
+// wrapErr wraps the errors of the cursor in an OpError.
+func (t tracedMongoIter) wrapErr(err error) error {
+	return withFingerprint(wrapOpErr(t.ctx, "iter", t.collection, err), t.fingerprint)
+}
+
+func (t tracedMongoIter) Timeout() bool {
+	recordUsage("MongoIter.Timeout")
+	return t.i.Timeout()
+}
+
+func (t tracedMongoIter) Next(result interface{}) bool {
+	recordUsage("MongoIter.Next")
+	if BudgetExpired(t.ctx) {
+		// stop handing out documents so the handler can answer with what it has
+		return false
+	}
+	sp, _ := startSpan(t.ctx, "iter-next")
+	defer sp.Finish()
+	if !t.i.Next(result) {
+		// the cursor is exhausted or failed: kill what's left of it while its session is still
+		// open, Close and Err report the same error afterwards
+		t.i.Close()
+		t.done()
+		return false
+	}
+	t.digest.next(result)
+	t.stats.read(1)
+	t.heartbeat.read(t.ctx, t.collection, t.fingerprint)
+	return true
+}
+
+// failedMongoQuery is returned in place of a real query when the query can't be issued at
+// all. Modifiers are no-ops and every access method returns err.
+type failedMongoQuery struct {
+	err error
+}
+
+func (q failedMongoQuery) All(result interface{}) error { return q.err }
+func (q failedMongoQuery) Apply(change mgo.Change, result interface{}) (*mgo.ChangeInfo, error) {
+	return nil, q.err
+}
+func (q failedMongoQuery) Count() (int, error)                     { return 0, q.err }
+func (q failedMongoQuery) Explain(result interface{}) error        { return q.err }
+func (q failedMongoQuery) Tail(timeout time.Duration) MongoIter    { return failedMongoIter{err: q.err} }
+func (q failedMongoQuery) Hint(indexKey ...string) MongoQuery      { return q }
+func (q failedMongoQuery) Iter() MongoIter                         { return failedMongoIter{err: q.err} }
+func (q failedMongoQuery) Limit(n int) MongoQuery                  { return q }
+func (q failedMongoQuery) Skip(n int) MongoQuery                   { return q }
+func (q failedMongoQuery) Batch(n int) MongoQuery                  { return q }
+func (q failedMongoQuery) Prefetch(p float64) MongoQuery           { return q }
+func (q failedMongoQuery) SetMaxTime(d time.Duration) MongoQuery   { return q }
+func (q failedMongoQuery) One(result interface{}) error            { return q.err }
+func (q failedMongoQuery) OneRaw() (bson.Raw, error)               { return bson.Raw{}, q.err }
+func (q failedMongoQuery) AllRaw() ([]bson.Raw, error)             { return nil, q.err }
+func (q failedMongoQuery) Select(selector interface{}) MongoQuery  { return q }
+func (q failedMongoQuery) Sort(fields ...string) MongoQuery        { return q }
+func (q failedMongoQuery) And(selector interface{}) MongoQuery     { return q }
+func (q failedMongoQuery) WithCollation(c Collation) MongoQuery    { return q }
+func (q failedMongoQuery) WithSnapshot() MongoQuery                { return q }
+func (q failedMongoQuery) WithReadConcern(level string) MongoQuery { return q }
+func (q failedMongoQuery) WithReadPreference(p ReadPreference) MongoQuery {
+	return q
+}
+
+// failedMongoIter is the MongoIter counterpart of failedMongoQuery.
+type failedMongoIter struct {
+	err error
+}
+
+func (t failedMongoIter) All(result interface{}) error { return t.err }
+func (t failedMongoIter) Close() error                 { return t.err }
+func (t failedMongoIter) Done() bool                   { return true }
+func (t failedMongoIter) Err() error                   { return t.err }
+func (t failedMongoIter) Next(result interface{}) bool { return false }
+func (t failedMongoIter) Timeout() bool                { return false }
+
+// logAndReturnErr is a tiny helper for adding the error to a log inline.
+func logAndReturnErr(sp opentracing.Span, err error) error {
+	sp.LogFields(opentracinglog.Error(err))
+	return err
+}
+
+// bsonToKeys transforms an arbitrary mgo arg, a bson.M, a bson.D or a struct, into a log
+// field listing its fields, with the values logged according to the handler's QueryLogging.
+func bsonToKeys(ctx context.Context, name string, query interface{}) opentracinglog.Field {
+	l := queryLogging(ctx)
+	queryFields := getFields(l, "", query)
+	return opentracinglog.String(name, l.compact(strings.Join(queryFields, "|")))
+}
@@ -0,0 +1,227 @@
+package mgohttp
+
+import (
+	"math/rand"
+	"sync"
+	"time"
+
+	opentracing "github.com/opentracing/opentracing-go"
+	mgo "gopkg.in/mgo.v2"
+	bson "gopkg.in/mgo.v2/bson"
+)
+
+// MirrorConfig configures a Mirror.
+type MirrorConfig struct {
+	// Sess is copied to run the mirrored reads against the shadow cluster.
+	Sess *mgo.Session
+	// Database is the database of the shadow cluster the reads are mirrored to. Defaults to
+	// the database they were read from.
+	Database string
+	// Percent is the share of the reads mirrored, from 0 to 100.
+	Percent float64
+	// Timeout bounds each mirrored read. Defaults to 10s.
+	Timeout time.Duration
+	// MaxConcurrent is the number of reads mirrored at once. Defaults to 4.
+	MaxConcurrent int
+	// QueueSize is the number of reads waiting to be mirrored, further reads aren't mirrored
+	// until the queue drains. Defaults to 1000.
+	QueueSize int
+}
+
+// MirrorStats counts the reads of a Mirror.
+type MirrorStats struct {
+	// Mirrored counts the reads the shadow cluster answered, Failed those it failed.
+	Mirrored int64
+	Failed   int64
+	// Dropped counts the sampled reads not queued because the queue was full.
+	Dropped int64
+	// Pending is the number of reads queued.
+	Pending int64
+}
+
+type mirrorJob struct {
+	spec       querySpec
+	method     string
+	database   string
+	collection string
+	// read is the span of the operation mirrored.
+	read    opentracing.SpanContext
+	metrics *Metrics
+}
+
+// Mirror replays a sample of the reads of the requests, the One, All and Count of queries,
+// on a shadow cluster in the background, to test it with the production query patterns. The
+// results are discarded: the requests never wait for the shadow cluster nor see its errors,
+// which are only counted. See SessionHandlerConfig.Mirror.
+type Mirror struct {
+	cfg MirrorConfig
+	// run mirrors a read, it's only overridden by the tests.
+	run func(job mirrorJob) error
+
+	mu     sync.Mutex
+	stats  MirrorStats
+	closed bool
+	jobs   chan mirrorJob
+	wg     sync.WaitGroup
+}
+
+// NewMirror starts the workers of a Mirror. Call Close on shutdown to let the queued reads
+// finish.
+func NewMirror(cfg MirrorConfig) *Mirror {
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 10 * time.Second
+	}
+	if cfg.MaxConcurrent <= 0 {
+		cfg.MaxConcurrent = 4
+	}
+	if cfg.QueueSize <= 0 {
+		cfg.QueueSize = 1000
+	}
+	m := &Mirror{
+		cfg:  cfg,
+		jobs: make(chan mirrorJob, cfg.QueueSize),
+	}
+	m.run = m.mirrorRead
+	for i := 0; i < cfg.MaxConcurrent; i++ {
+		m.wg.Add(1)
+		go m.work()
+	}
+	return m
+}
+
+// Stats returns the current mirror counts.
+func (m *Mirror) Stats() MirrorStats {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	stats := m.stats
+	stats.Pending = int64(len(m.jobs))
+	return stats
+}
+
+// Close stops accepting reads and waits for the queued ones to be mirrored.
+func (m *Mirror) Close() {
+	m.mu.Lock()
+	if !m.closed {
+		m.closed = true
+		close(m.jobs)
+	}
+	m.mu.Unlock()
+	m.wg.Wait()
+}
+
+// sampled reports whether a read is picked to be mirrored.
+func (m *Mirror) sampled() bool {
+	return m.cfg.Percent >= 100 || rand.Float64()*100 < m.cfg.Percent
+}
+
+func (m *Mirror) enqueue(job mirrorJob) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.closed {
+		return
+	}
+	select {
+	case m.jobs <- job:
+	default:
+		m.stats.Dropped++
+		job.metrics.mirroredRead("dropped")
+	}
+}
+
+func (m *Mirror) work() {
+	defer m.wg.Done()
+	for job := range m.jobs {
+		outcome := "ok"
+		err := m.run(job)
+		m.mu.Lock()
+		if err != nil {
+			m.stats.Failed++
+			outcome = "failed"
+		} else {
+			m.stats.Mirrored++
+		}
+		m.mu.Unlock()
+		job.metrics.mirroredRead(outcome)
+	}
+}
+
+// mirrorRead runs the read of job on a copy of the shadow session.
+func (m *Mirror) mirrorRead(job mirrorJob) (err error) {
+	opts := []opentracing.StartSpanOption{}
+	if job.read != nil {
+		// the mirrored read outlives the request, which doesn't wait for it
+		opts = append(opts, opentracing.FollowsFrom(job.read))
+	}
+	sp := opentracing.StartSpan("mirror", opts...)
+	defer sp.Finish()
+	sp.SetTag(TagCollection, job.collection)
+	sp.SetTag(TagAccessMethod, job.method)
+	defer func() {
+		if err != nil {
+			logAndReturnErr(sp, err)
+		}
+	}()
+
+	sess := m.cfg.Sess.Copy()
+	defer sess.Close()
+	sess.SetSocketTimeout(m.cfg.Timeout)
+	database := m.cfg.Database
+	if database == "" {
+		database = job.database
+	}
+	spec := job.spec
+	spec.collection = sess.DB(database).C(job.collection)
+	// the commands of collations and read concerns, the query otherwise
+	commands := spec.collation != nil || spec.readConcern != ""
+
+	switch job.method {
+	case "One":
+		if commands {
+			err = spec.one(&bson.Raw{})
+		} else {
+			err = spec.query().One(&bson.Raw{})
+		}
+		if err == mgo.ErrNotFound {
+			err = nil
+		}
+	case "All":
+		var it *mgo.Iter
+		done := func() {}
+		if commands {
+			it, done = spec.iter()
+		} else {
+			it = spec.query().Iter()
+		}
+		for it.Next(&bson.Raw{}) {
+		}
+		err = it.Close()
+		done()
+	case "Count":
+		if commands {
+			_, err = spec.count()
+		} else {
+			_, err = spec.query().Count()
+		}
+	}
+	return err
+}
+
+// mirror queues the query's read with the handler's Mirror, if it has one and the read is
+// sampled.
+func (q tracedMongoQuery) mirror(method string) {
+	h := handlerFromContext(q.ctx)
+	if h == nil || h.cfg.Mirror == nil || !h.cfg.Mirror.sampled() {
+		return
+	}
+	job := mirrorJob{
+		spec:       q.spec,
+		method:     method,
+		database:   q.spec.collection.Database.Name,
+		collection: q.spec.collection.Name,
+		metrics:    h.cfg.Metrics,
+	}
+	if sp := opentracing.SpanFromContext(q.ctx); sp != nil {
+		job.read = sp.Context()
+	}
+	h.cfg.Mirror.enqueue(job)
+}
@@ -0,0 +1,85 @@
+package mgohttp
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	mgo "gopkg.in/mgo.v2"
+	bson "gopkg.in/mgo.v2/bson"
+)
+
+func mirroredQuery(m *Mirror, selector interface{}) tracedMongoQuery {
+	return tracedMongoQuery{
+		ctx: context.WithValue(context.Background(), handlerKey, &SessionHandler{cfg: SessionHandlerConfig{Mirror: m}}),
+		spec: querySpec{
+			collection: &mgo.Collection{Name: "users", Database: &mgo.Database{Name: testDBName}},
+			filter:     selector,
+		},
+	}
+}
+
+func TestMirrorQueuesReads(t *testing.T) {
+	m := NewMirror(MirrorConfig{Percent: 100})
+	var jobs []mirrorJob
+	m.run = func(job mirrorJob) error {
+		jobs = append(jobs, job)
+		if job.method == "Count" {
+			return errors.New("shadow cluster down")
+		}
+		return nil
+	}
+
+	mirroredQuery(m, bson.M{"a": 1}).mirror("One")
+	mirroredQuery(m, nil).mirror("Count")
+	m.Close()
+
+	require.Len(t, jobs, 2)
+	assert.Equal(t, "One", jobs[0].method)
+	assert.Equal(t, testDBName, jobs[0].database)
+	assert.Equal(t, "users", jobs[0].collection)
+	assert.Equal(t, bson.M{"a": 1}, jobs[0].spec.filter)
+	assert.Equal(t, MirrorStats{Mirrored: 1, Failed: 1}, m.Stats())
+}
+
+func TestMirrorSamples(t *testing.T) {
+	m := NewMirror(MirrorConfig{Percent: 0})
+	m.run = func(job mirrorJob) error {
+		t.Error("no read should be mirrored")
+		return nil
+	}
+	for i := 0; i < 100; i++ {
+		mirroredQuery(m, nil).mirror("All")
+	}
+	m.Close()
+	assert.Equal(t, MirrorStats{}, m.Stats())
+
+	// handlers without a Mirror don't mirror
+	mirroredQuery(nil, nil).mirror("All")
+}
+
+func TestMirrorDropsWhenQueueFull(t *testing.T) {
+	m := NewMirror(MirrorConfig{Percent: 100, MaxConcurrent: 1, QueueSize: 1})
+	started, release := make(chan struct{}), make(chan struct{})
+	m.run = func(job mirrorJob) error {
+		if job.method == "One" {
+			close(started)
+			<-release
+		}
+		return nil
+	}
+
+	mirroredQuery(m, nil).mirror("One")
+	<-started
+	mirroredQuery(m, nil).mirror("All")
+	mirroredQuery(m, nil).mirror("All")
+	assert.Equal(t, MirrorStats{Dropped: 1, Pending: 1}, m.Stats())
+
+	close(release)
+	m.Close()
+	assert.Equal(t, MirrorStats{Mirrored: 2, Dropped: 1}, m.Stats())
+	// reads after Close aren't mirrored
+	mirroredQuery(m, nil).mirror("All")
+}
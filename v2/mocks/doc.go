@@ -0,0 +1,14 @@
+// Package mocks provides mocks of the mgohttp interfaces, for unit testing the code that
+// uses them, its error paths in particular:
+//
+//	coll := &mocks.MongoCollection{
+//		UpdateFunc: func(selector, update interface{}) error {
+//			return &mgo.LastError{Code: 11000}
+//		},
+//	}
+//
+// The mocks are generated from the interfaces by go generate, so they don't drift when the
+// interfaces grow.
+package mocks
+
+//go:generate go run ./gen
@@ -0,0 +1,282 @@
+// Command gen generates the mocks of the mocks package from the interfaces of mgohttp. It's
+// run by go generate in the mocks directory:
+//
+//	go generate ./mocks
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"log"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/Clever/mgohttp/v2"
+)
+
+// interfaces are the interfaces to mock, in the order of the generated file.
+var interfaces = []reflect.Type{
+	reflect.TypeOf((*mgohttp.MongoSession)(nil)).Elem(),
+	reflect.TypeOf((*mgohttp.MongoDatabase)(nil)).Elem(),
+	reflect.TypeOf((*mgohttp.MongoCollection)(nil)).Elem(),
+	reflect.TypeOf((*mgohttp.MongoQuery)(nil)).Elem(),
+	reflect.TypeOf((*mgohttp.MongoPipe)(nil)).Elem(),
+	reflect.TypeOf((*mgohttp.MongoIter)(nil)).Elem(),
+	reflect.TypeOf((*mgohttp.ChangeStream)(nil)).Elem(),
+	reflect.TypeOf((*mgohttp.MongoBulk)(nil)).Elem(),
+	reflect.TypeOf((*mgohttp.MongoGridFS)(nil)).Elem(),
+	reflect.TypeOf((*mgohttp.MongoGridFile)(nil)).Elem(),
+}
+
+func main() {
+	src, err := generate("..")
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := os.WriteFile("mocks.go", src, 0644); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// generate returns the source of the mocks, taking the names of the parameters from the
+// interfaces.go file of the mgohttp package in root.
+func generate(root string) ([]byte, error) {
+	params, err := paramNames(filepath.Join(root, "interfaces.go"))
+	if err != nil {
+		return nil, err
+	}
+	g := generator{imports: map[string]string{"github.com/Clever/mgohttp/v2": "mgohttp"}}
+	for _, iface := range interfaces {
+		g.mock(iface, params)
+	}
+
+	var out bytes.Buffer
+	out.WriteString("// Code generated by mocks/gen. DO NOT EDIT.\n\n")
+	out.WriteString("package mocks\n\nimport (\n")
+	paths := make([]string, 0, len(g.imports))
+	for path := range g.imports {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	// the standard library first
+	sort.SliceStable(paths, func(i, j int) bool { return isStd(paths[i]) && !isStd(paths[j]) })
+	for i, path := range paths {
+		if i > 0 && isStd(paths[i-1]) && !isStd(path) {
+			out.WriteString("\n")
+		}
+		if name := g.imports[path]; name != filepath.Base(path) {
+			fmt.Fprintf(&out, "\t%s %q\n", name, path)
+		} else {
+			fmt.Fprintf(&out, "\t%q\n", path)
+		}
+	}
+	out.WriteString(")\n\n")
+	out.WriteString("var (\n")
+	for _, iface := range interfaces {
+		fmt.Fprintf(&out, "\t_ mgohttp.%s = (*%s)(nil)\n", iface.Name(), iface.Name())
+	}
+	out.WriteString(")\n")
+	out.Write(g.body.Bytes())
+	return format.Source(out.Bytes())
+}
+
+// isStd reports whether path is a package of the standard library.
+func isStd(path string) bool {
+	return !strings.Contains(strings.Split(path, "/")[0], ".")
+}
+
+// comment wraps text in a doc comment of lines up to 95 columns.
+func comment(text string) string {
+	var out, line strings.Builder
+	for _, word := range strings.Fields(text) {
+		if line.Len() > 0 && line.Len()+1+len(word) > 92 {
+			out.WriteString("// " + line.String() + "\n")
+			line.Reset()
+		}
+		if line.Len() > 0 {
+			line.WriteString(" ")
+		}
+		line.WriteString(word)
+	}
+	out.WriteString("// " + line.String() + "\n")
+	return out.String()
+}
+
+// paramNames returns the names of the parameters of the methods declared in file, by
+// "Interface.Method".
+func paramNames(file string) (map[string][]string, error) {
+	f, err := parser.ParseFile(token.NewFileSet(), file, nil, 0)
+	if err != nil {
+		return nil, err
+	}
+	names := map[string][]string{}
+	ast.Inspect(f, func(n ast.Node) bool {
+		spec, ok := n.(*ast.TypeSpec)
+		if !ok {
+			return true
+		}
+		iface, ok := spec.Type.(*ast.InterfaceType)
+		if !ok {
+			return false
+		}
+		for _, method := range iface.Methods.List {
+			fn, ok := method.Type.(*ast.FuncType)
+			if !ok || len(method.Names) == 0 {
+				continue
+			}
+			params := []string{}
+			for _, field := range fn.Params.List {
+				for _, name := range field.Names {
+					params = append(params, name.Name)
+				}
+			}
+			names[spec.Name.Name+"."+method.Names[0].Name] = params
+		}
+		return false
+	})
+	return names, nil
+}
+
+type generator struct {
+	// imports maps the paths of the packages the mocks use to their names.
+	imports map[string]string
+	body    bytes.Buffer
+}
+
+// mock writes the mock of iface.
+func (g *generator) mock(iface reflect.Type, params map[string][]string) {
+	name := iface.Name()
+	first := iface.Method(0).Name
+	doc := fmt.Sprintf("%s is a mock of mgohttp.%s. Each method calls the function of its Func field, "+
+		"e.g. %sFunc for %s, and returns zero values when it's nil", name, name, first, first)
+	if g.hasSelfMethods(iface) {
+		doc += ", or the mock itself for the methods returning a " + name
+	}
+	g.body.WriteString("\n" + comment(doc+"."))
+	fmt.Fprintf(&g.body, "type %s struct {\n", name)
+	for i := 0; i < iface.NumMethod(); i++ {
+		m := iface.Method(i)
+		fmt.Fprintf(&g.body, "\t%sFunc func%s\n", m.Name, g.signature(m.Type, params[name+"."+m.Name]))
+	}
+	g.body.WriteString("}\n")
+
+	for i := 0; i < iface.NumMethod(); i++ {
+		m := iface.Method(i)
+		names := argNames(m.Type, params[name+"."+m.Name])
+		fmt.Fprintf(&g.body, "\n// %s calls %sFunc.\n", m.Name, m.Name)
+		fmt.Fprintf(&g.body, "func (m *%s) %s%s {\n", name, m.Name, g.signature(m.Type, params[name+"."+m.Name]))
+		fmt.Fprintf(&g.body, "\tif m.%sFunc == nil {\n", m.Name)
+		switch {
+		case m.Type.NumOut() == 1 && m.Type.Out(0) == iface:
+			g.body.WriteString("\t\treturn m\n")
+		case m.Type.NumOut() > 0:
+			zeros := []string{}
+			for o := 0; o < m.Type.NumOut(); o++ {
+				zeros = append(zeros, g.zero(m.Type.Out(o)))
+			}
+			fmt.Fprintf(&g.body, "\t\treturn %s\n", strings.Join(zeros, ", "))
+		default:
+			g.body.WriteString("\t\treturn\n")
+		}
+		g.body.WriteString("\t}\n\t")
+		if m.Type.NumOut() > 0 {
+			g.body.WriteString("return ")
+		}
+		args := append([]string(nil), names...)
+		if m.Type.IsVariadic() {
+			args[len(args)-1] += "..."
+		}
+		fmt.Fprintf(&g.body, "m.%sFunc(%s)\n}\n", m.Name, strings.Join(args, ", "))
+	}
+}
+
+// hasSelfMethods reports whether iface has methods returning an iface.
+func (g *generator) hasSelfMethods(iface reflect.Type) bool {
+	for i := 0; i < iface.NumMethod(); i++ {
+		m := iface.Method(i).Type
+		if m.NumOut() == 1 && m.Out(0) == iface {
+			return true
+		}
+	}
+	return false
+}
+
+// argNames returns the names of the parameters of fn, from names when they're known.
+func argNames(fn reflect.Type, names []string) []string {
+	if len(names) == fn.NumIn() {
+		return names
+	}
+	args := make([]string, fn.NumIn())
+	for i := range args {
+		args[i] = fmt.Sprintf("a%d", i)
+	}
+	return args
+}
+
+// signature renders the parameters and results of fn.
+func (g *generator) signature(fn reflect.Type, names []string) string {
+	args := argNames(fn, names)
+	params := []string{}
+	for i := 0; i < fn.NumIn(); i++ {
+		t := g.typeName(fn.In(i))
+		if fn.IsVariadic() && i == fn.NumIn()-1 {
+			t = "..." + g.typeName(fn.In(i).Elem())
+		}
+		params = append(params, args[i]+" "+t)
+	}
+	results := []string{}
+	for i := 0; i < fn.NumOut(); i++ {
+		results = append(results, g.typeName(fn.Out(i)))
+	}
+	s := "(" + strings.Join(params, ", ") + ")"
+	switch len(results) {
+	case 0:
+	case 1:
+		s += " " + results[0]
+	default:
+		s += " (" + strings.Join(results, ", ") + ")"
+	}
+	return s
+}
+
+// typeName renders t, adding the packages of the named types it refers to to the imports.
+func (g *generator) typeName(t reflect.Type) string {
+	if t.Name() != "" && t.PkgPath() != "" {
+		pkg := strings.SplitN(t.String(), ".", 2)[0]
+		g.imports[t.PkgPath()] = pkg
+		return t.String()
+	}
+	switch t.Kind() {
+	case reflect.Ptr:
+		return "*" + g.typeName(t.Elem())
+	case reflect.Slice:
+		return "[]" + g.typeName(t.Elem())
+	case reflect.Map:
+		return "map[" + g.typeName(t.Key()) + "]" + g.typeName(t.Elem())
+	}
+	return t.String()
+}
+
+// zero renders the zero value of t.
+func (g *generator) zero(t reflect.Type) string {
+	switch t.Kind() {
+	case reflect.Bool:
+		return "false"
+	case reflect.String:
+		return `""`
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return "0"
+	case reflect.Struct, reflect.Array:
+		return g.typeName(t) + "{}"
+	}
+	return "nil"
+}
@@ -0,0 +1,17 @@
+package main
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMocksUpToDate(t *testing.T) {
+	want, err := generate("../..")
+	require.NoError(t, err)
+	got, err := os.ReadFile("../mocks.go")
+	require.NoError(t, err)
+	assert.Equal(t, string(want), string(got), "the mocks are out of date, run go generate ./mocks")
+}
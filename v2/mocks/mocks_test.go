@@ -0,0 +1,33 @@
+package mocks
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/Clever/mgohttp/v2"
+	"github.com/stretchr/testify/assert"
+	mgo "gopkg.in/mgo.v2"
+)
+
+func TestMongoQuery(t *testing.T) {
+	var limit int
+	q := &MongoQuery{
+		LimitFunc: func(n int) mgohttp.MongoQuery {
+			limit = n
+			return nil
+		},
+		OneFunc: func(result interface{}) error { return mgo.ErrNotFound },
+	}
+	coll := &MongoCollection{FindFunc: func(query interface{}) mgohttp.MongoQuery { return q }}
+
+	// the modifiers without a function return the mock
+	err := coll.Find(nil).Sort("-created").Skip(10).One(nil)
+	assert.True(t, errors.Is(err, mgo.ErrNotFound))
+	assert.Nil(t, coll.Find(nil).Limit(5))
+	assert.Equal(t, 5, limit)
+
+	// the methods without a function return zero values
+	n, err := q.Count()
+	assert.NoError(t, err)
+	assert.Zero(t, n)
+}
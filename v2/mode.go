@@ -0,0 +1,33 @@
+package mgohttp
+
+import (
+	"context"
+
+	opentracing "github.com/opentracing/opentracing-go"
+	mgo "gopkg.in/mgo.v2"
+)
+
+type modeKeyType struct{}
+
+var modeKey = modeKeyType{}
+
+// WithMode sets the consistency mode of the request's session for the sessions retrieved with
+// FromContext(ctx, ...), e.g. mgo.SecondaryPreferred for endpoints that can read from
+// secondaries. Only the request's copy is changed, never the parent session. The mode sticks
+// to the request's session: later calls to FromContext without it keep using it.
+func WithMode(ctx context.Context, mode mgo.Mode) context.Context {
+	return context.WithValue(ctx, modeKey, mode)
+}
+
+// applyMode sets the mode chosen with WithMode on sess, if any, and records it on the caller's
+// span.
+func applyMode(ctx context.Context, sess *mgo.Session) {
+	mode, ok := ctx.Value(modeKey).(mgo.Mode)
+	if !ok || sess.Mode() == mode {
+		return
+	}
+	sess.SetMode(mode, true)
+	if sp := opentracing.SpanFromContext(ctx); sp != nil {
+		sp.SetTag(TagReadMode, modeName(mode))
+	}
+}
@@ -0,0 +1,430 @@
+package mgohttp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	opentracing "github.com/opentracing/opentracing-go"
+	opentracinglog "github.com/opentracing/opentracing-go/log"
+	driverbson "go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/mongo/writeconcern"
+	mgo "gopkg.in/mgo.v2"
+	bson "gopkg.in/mgo.v2/bson"
+)
+
+// ErrGridFSUnsupported is returned by the GridFS of the sessions of NewMongoDriver, which the
+// MongoGridFS interface, shaped after mgo's, isn't implemented with yet.
+var ErrGridFSUnsupported = errors.New("mgohttp: GridFS isn't supported by the mongo driver backend")
+
+// NewMongoDriver returns the Driver opening the sessions of a SessionHandler's databases on
+// client, a client of the official driver (go.mongodb.org/mongo-driver), so the handlers
+// written against the MongoSession interfaces can move off mgo one database at a time. The
+// documents, selectors and results are still the ones of mgo's bson package: they're
+// converted to and from the driver's, and so are the errors, e.g. mgo.ErrNotFound when no
+// document matched. The operations are traced like the ones of mgo's sessions, and bounded by
+// the request's timeout through their context. GridFS isn't supported, see
+// ErrGridFSUnsupported. Shutdown leaves the client connected: disconnect it once the handler
+// is shut down.
+func NewMongoDriver(client *mongo.Client) Driver {
+	return &mongoDriver{client: client}
+}
+
+// mongoDriver is the Driver of NewMongoDriver.
+type mongoDriver struct {
+	client    *mongo.Client
+	buildInfo buildInfoCache
+}
+
+func (d *mongoDriver) NewSession(ctx context.Context, database string, safe *mgo.Safe) (DriverSession, error) {
+	s := &mongoDriverSession{d: d, life: ctx}
+	if safe != nil {
+		s.wc = driverWriteConcern(safe)
+	}
+	return s, nil
+}
+
+// mongoDriverSession is the session of a request opened by a mongoDriver. The client pools
+// its connections itself: the session is a handle on the client, bound to the request.
+type mongoDriverSession struct {
+	d *mongoDriver
+	// life is done once the request is, cancelling the operations still running
+	life context.Context
+
+	mu sync.Mutex
+	wc *writeconcern.WriteConcern // nil for the client's
+
+	snapshotMu sync.Mutex
+	// snapshot is the time the snapshot reads of the request read at, once one ran
+	snapshot bson.MongoTimestamp
+}
+
+func (s *mongoDriverSession) Session(ctx context.Context, pref *ReadPreference) MongoSession {
+	return tracedDriverSession{s: s, ctx: ctx, pref: pref}
+}
+
+func (s *mongoDriverSession) Close() {}
+
+// writeConcern returns the write concern of the session, nil for the client's.
+func (s *mongoDriverSession) writeConcern() *writeconcern.WriteConcern {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.wc
+}
+
+// snapshotTime returns the time the snapshot reads of the request read at: the time of the
+// majority committed writes when the first one runs, so every query of the request on the
+// database reads from the same snapshot.
+func (s *mongoDriverSession) snapshotTime(ctx context.Context, ts tracedDriverSession) (bson.MongoTimestamp, error) {
+	s.snapshotMu.Lock()
+	defer s.snapshotMu.Unlock()
+	if s.snapshot != 0 {
+		return s.snapshot, nil
+	}
+	if err := ts.checkServerFeature(ctx, FeatureSnapshotReads); err != nil {
+		return 0, err
+	}
+	var res struct {
+		LastWrite struct {
+			MajorityOpTime struct {
+				TS bson.MongoTimestamp `bson:"ts"`
+			} `bson:"majorityOpTime"`
+		} `bson:"lastWrite"`
+		// mongos doesn't report the last writes, the time of its reply is the last one it saw
+		OperationTime bson.MongoTimestamp `bson:"operationTime"`
+	}
+	if err := ts.runCommand(ctx, "admin", bson.D{{Name: "isMaster", Value: 1}}, &res); err != nil {
+		return 0, err
+	}
+	s.snapshot = res.LastWrite.MajorityOpTime.TS
+	if s.snapshot == 0 {
+		s.snapshot = res.OperationTime
+	}
+	return s.snapshot, nil
+}
+
+// bound returns the context the operation started with ctx runs with: cancelled once the
+// request is done, and timing out with it, or after timeout when it's positive and earlier.
+func (s *mongoDriverSession) bound(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	deadline, ok := s.life.Deadline()
+	if timeout > 0 && (!ok || time.Until(deadline) > timeout) {
+		deadline, ok = time.Now().Add(timeout), true
+	}
+	var cancel context.CancelFunc
+	if ok {
+		ctx, cancel = context.WithDeadline(ctx, deadline)
+	} else {
+		ctx, cancel = context.WithCancel(ctx)
+	}
+	stop := context.AfterFunc(s.life, cancel)
+	return ctx, func() {
+		stop()
+		cancel()
+	}
+}
+
+type tracedDriverSession struct {
+	s    *mongoDriverSession
+	ctx  context.Context
+	pref *ReadPreference
+	// timeout is the one of WithTimeout, zero for the request's
+	timeout time.Duration
+	// txn is the driver's session of the transaction of WithTransaction the operations run
+	// in, nil outside of one
+	txn mongo.Session
+}
+
+// opContext returns the context of an operation traced with ctx, bound to the session's
+// transaction, if any.
+func (ts tracedDriverSession) opContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	ctx, cancel := ts.s.bound(ctx, ts.timeout)
+	if ts.txn != nil {
+		ctx = mongo.NewSessionContext(ctx, ts.txn)
+	}
+	return ctx, cancel
+}
+
+// database returns the driver's handle on the database name, reading according to the
+// session's read preference and writing with its write concern.
+func (ts tracedDriverSession) database(name string) (*mongo.Database, error) {
+	rp, err := driverReadPref(ts.pref)
+	if err != nil {
+		return nil, err
+	}
+	opts := options.Database().SetReadPreference(rp)
+	if wc := ts.s.writeConcern(); wc != nil {
+		opts.SetWriteConcern(wc)
+	}
+	return ts.s.d.client.Database(name, opts), nil
+}
+
+func (ts tracedDriverSession) DB(name string) MongoDatabase {
+	recordUsage("MongoSession.DB")
+	opentracing.SpanFromContext(ts.ctx).SetTag(TagDatabase, name)
+	return tracedDriverDatabase{
+		ts:   ts,
+		name: name,
+		ctx:  context.WithValue(ts.ctx, databaseKey, name),
+	}
+}
+
+func (ts tracedDriverSession) Ping() (err error) {
+	recordUsage("MongoSession.Ping")
+	sp, ctx := startOp(ts.ctx, "ping", "")
+	defer sp.Finish()
+	defer sp.recoverPanic(&err)
+	ctx, cancel := ts.opContext(ctx)
+	defer cancel()
+
+	return sp.done(sp.intercept(OpInfo{}, func(*OpInfo) error {
+		rp, err := driverReadPref(ts.pref)
+		if err != nil {
+			return err
+		}
+		return mgoError(ts.s.d.client.Ping(ctx, rp))
+	}))
+}
+
+func (ts tracedDriverSession) PingWithInfo(ctx context.Context) (PingInfo, error) {
+	recordUsage("MongoSession.PingWithInfo")
+	sp, opCtx := startSpan(ts.ctx, "ping")
+	defer sp.Finish()
+	opCtx, cancel := ts.opContext(opCtx)
+	defer cancel()
+	stop := context.AfterFunc(ctx, cancel)
+	defer stop()
+
+	var res isMasterResult
+	start := time.Now()
+	err := ts.runCommand(opCtx, "admin", bson.D{{Name: "isMaster", Value: 1}}, &res)
+	if ctx.Err() != nil {
+		return PingInfo{}, logAndReturnErr(sp, ctx.Err())
+	}
+	if err != nil {
+		return PingInfo{}, logAndReturnErr(sp, err)
+	}
+	// standalone servers and mongos don't report "me", and the driver doesn't tell which
+	// server answered: their Address is empty
+	info := PingInfo{
+		RTT:        time.Since(start),
+		Address:    res.Me,
+		State:      res.state(),
+		ReplicaSet: res.SetName,
+	}
+	sp.SetTag(TagServerAddress, info.Address)
+	sp.SetTag(TagServerState, info.State)
+	sp.LogFields(opentracinglog.Int64(LogRTTMillis, info.RTT.Milliseconds()))
+	return info, nil
+}
+
+func (ts tracedDriverSession) ServerVersion(ctx context.Context) (mgo.BuildInfo, error) {
+	recordUsage("MongoSession.ServerVersion")
+	sp, opCtx := startSpan(ts.ctx, "server-version")
+	defer sp.Finish()
+
+	infos := make(chan mgo.BuildInfo, 1)
+	err := runWithContext(ctx, func() error {
+		info, err := ts.buildInfo(opCtx)
+		infos <- info
+		return err
+	})
+	var info mgo.BuildInfo
+	if err == nil {
+		info = <-infos
+		sp.SetTag(TagServerVersion, info.Version)
+	}
+	return info, logAndReturnErr(sp, err)
+}
+
+// buildInfo returns the server's build info, from the cache of the driver.
+func (ts tracedDriverSession) buildInfo(ctx context.Context) (mgo.BuildInfo, error) {
+	return ts.s.d.buildInfo.load(func() (info mgo.BuildInfo, err error) {
+		// the cache outlives the request
+		ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), time.Until(deadlineOf(ts.s.life)))
+		defer cancel()
+		err = ts.runCommand(ctx, "admin", bson.D{{Name: "buildInfo", Value: 1}}, &info)
+		return info, err
+	})
+}
+
+// checkServerFeature returns an UnsupportedFeatureError when the server doesn't support f,
+// and like the mgo sessions' checkServerFeature, nil when its version can't be determined.
+func (ts tracedDriverSession) checkServerFeature(ctx context.Context, f ServerFeature) error {
+	info, err := ts.buildInfo(ctx)
+	if err != nil || f.SupportedBy(info) {
+		return nil
+	}
+	return UnsupportedFeatureError{Feature: f, Version: info.Version}
+}
+
+// deadlineOf returns the deadline of ctx, in an hour when it has none.
+func deadlineOf(ctx context.Context) time.Time {
+	if deadline, ok := ctx.Deadline(); ok {
+		return deadline
+	}
+	return time.Now().Add(time.Hour)
+}
+
+func (ts tracedDriverSession) SetSafe(safe *mgo.Safe) {
+	recordUsage("MongoSession.SetSafe")
+	ts.s.mu.Lock()
+	ts.s.wc = driverWriteConcern(safe)
+	ts.s.mu.Unlock()
+	if sp := opentracing.SpanFromContext(ts.ctx); sp != nil {
+		sp.SetTag(TagWriteConcern, safeName(safe))
+	}
+}
+
+func (ts tracedDriverSession) WithTimeout(d time.Duration) MongoSession {
+	recordUsage("MongoSession.WithTimeout")
+	if d <= 0 {
+		return ts
+	}
+	if sp := opentracing.SpanFromContext(ts.ctx); sp != nil {
+		sp.LogFields(opentracinglog.Int64(LogSocketTimeoutMillis, d.Milliseconds()))
+	}
+	ts.timeout = d
+	return ts
+}
+
+// WithTransaction runs fn in a transaction of a session of the driver, with the driver's
+// WithTransaction, which retries fn on transient transaction errors and the commit on
+// unknown commit results until the request's timeout. The transaction reads from the primary,
+// whatever the session's read preference.
+func (ts tracedDriverSession) WithTransaction(ctx context.Context, fn func(tx MongoSession) error) (err error) {
+	recordUsage("MongoSession.WithTransaction")
+	sp, spCtx := startSpan(ts.ctx, "transaction")
+	defer sp.Finish()
+	if ts.txn != nil {
+		return logAndReturnErr(sp, ErrNestedTransaction)
+	}
+	txCtx, cancel := ts.opContext(spCtx)
+	defer cancel()
+	stop := context.AfterFunc(ctx, cancel)
+	defer stop()
+	if err := ts.checkServerFeature(txCtx, FeatureTransactions); err != nil {
+		return logAndReturnErr(sp, err)
+	}
+
+	txn, err := ts.s.d.client.StartSession()
+	if err != nil {
+		return logAndReturnErr(sp, mgoError(err))
+	}
+	defer txn.EndSession(context.WithoutCancel(txCtx))
+	tx := ts
+	tx.ctx, tx.pref, tx.txn = spCtx, nil, txn
+	attempts := 0
+	_, err = txn.WithTransaction(txCtx, func(mongo.SessionContext) (interface{}, error) {
+		attempts++
+		return nil, fn(tx)
+	})
+	sp.LogFields(opentracinglog.Int(LogTransactionAttempts, attempts))
+	if ctx.Err() != nil && err != nil {
+		return logAndReturnErr(sp, ctx.Err())
+	}
+	return logAndReturnErr(sp, mgoError(err))
+}
+
+// runCommand runs cmd, a command of mgo's bson, on database and unmarshals its reply into
+// result, unless it's nil.
+func (ts tracedDriverSession) runCommand(ctx context.Context, database string, cmd, result interface{}) error {
+	if name, ok := cmd.(string); ok {
+		cmd = bson.D{{Name: name, Value: 1}}
+	}
+	doc, err := driverDoc(cmd)
+	if err != nil {
+		return err
+	}
+	db, err := ts.database(database)
+	if err != nil {
+		return err
+	}
+	rp, err := driverReadPref(ts.pref)
+	if err != nil {
+		return err
+	}
+	reply, err := db.RunCommand(ctx, doc, options.RunCmd().SetReadPreference(rp)).Raw()
+	if err != nil || result == nil {
+		return mgoError(err)
+	}
+	return unmarshalDriverDoc(reply, result)
+}
+
+type tracedDriverDatabase struct {
+	ts   tracedDriverSession
+	name string
+	ctx  context.Context
+}
+
+func (t tracedDriverDatabase) C(collection string) MongoCollection {
+	recordUsage("MongoDatabase.C")
+	return tracedDriverCollection{db: t, name: collection, ctx: t.ctx}
+}
+
+func (t tracedDriverDatabase) Run(cmd interface{}, result interface{}) (err error) {
+	recordCommandUsage(cmd)
+	sp, ctx := startOp(t.ctx, "run", "")
+	defer sp.Finish()
+	defer sp.recoverPanic(&err)
+	sp.LogKV(opentracinglog.String(LogCommand, fmt.Sprintf("%#v", cmd)))
+	release, err := sp.limit(commandTarget(cmd))
+	if err != nil {
+		return logAndReturnErr(sp, err)
+	}
+	defer release()
+	ctx, cancel := t.ts.opContext(ctx)
+	defer cancel()
+
+	return sp.done(sp.intercept(OpInfo{Command: cmd}, func(op *OpInfo) error {
+		return t.ts.runCommand(ctx, t.name, op.Command, result)
+	}))
+}
+
+func (t tracedDriverDatabase) GridFS(prefix string) MongoGridFS {
+	recordUsage("MongoDatabase.GridFS")
+	return failedGridFS{err: ErrGridFSUnsupported}
+}
+
+func (t tracedDriverDatabase) CollectionNames() (names []string, err error) {
+	recordUsage("MongoDatabase.CollectionNames")
+	sp, ctx := startOp(t.ctx, "collection-names", "")
+	defer sp.Finish()
+	defer sp.recoverPanic(&err)
+	ctx, cancel := t.ts.opContext(ctx)
+	defer cancel()
+
+	err = sp.intercept(OpInfo{}, func(*OpInfo) error {
+		db, err := t.ts.database(t.name)
+		if err != nil {
+			return err
+		}
+		names, err = db.ListCollectionNames(ctx, driverbson.D{})
+		// sorted, like mgo's
+		sort.Strings(names)
+		return mgoError(err)
+	})
+	sp.LogFields(opentracinglog.Int(LogNumCollections, len(names)))
+	return names, sp.done(err)
+}
+
+func (t tracedDriverDatabase) DropDatabase() (err error) {
+	recordUsage("MongoDatabase.DropDatabase")
+	sp, ctx := startOp(t.ctx, "drop-database", "")
+	defer sp.Finish()
+	defer sp.recoverPanic(&err)
+	ctx, cancel := t.ts.opContext(ctx)
+	defer cancel()
+
+	return sp.done(sp.intercept(OpInfo{}, func(*OpInfo) error {
+		db, err := t.ts.database(t.name)
+		if err != nil {
+			return err
+		}
+		return mgoError(db.Drop(ctx))
+	}))
+}
@@ -0,0 +1,221 @@
+package mgohttp
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	opentracing "github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/mocktracer"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	driverbson "go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
+	"go.mongodb.org/mongo-driver/mongo/writeconcern"
+	mgo "gopkg.in/mgo.v2"
+	bson "gopkg.in/mgo.v2/bson"
+)
+
+func TestDriverDoc(t *testing.T) {
+	id := bson.NewObjectId()
+	doc, err := driverDoc(bson.D{{Name: "_id", Value: id}, {Name: "n", Value: 2}})
+	require.NoError(t, err)
+	var got driverbson.D
+	require.NoError(t, driverbson.Unmarshal(doc, &got))
+	assert.Equal(t, driverbson.D{{Key: "_id", Value: primitive.ObjectID([]byte(id))}, {Key: "n", Value: int32(2)}}, got)
+
+	doc, err = driverDoc(nil)
+	require.NoError(t, err)
+	assert.Equal(t, driverbson.Raw(emptyDoc), doc)
+
+	_, err = driverDoc(42)
+	assert.Error(t, err)
+
+	var back bson.M
+	require.NoError(t, unmarshalDriverDoc(doc, &back))
+	assert.Empty(t, back)
+}
+
+func TestDriverPipeline(t *testing.T) {
+	p, err := driverPipeline([]bson.M{{"$match": bson.M{"n": 1}}})
+	require.NoError(t, err)
+	values, err := p.Values()
+	require.NoError(t, err)
+	assert.Len(t, values, 1)
+
+	_, err = driverPipeline(bson.M{"$match": bson.M{}})
+	assert.Error(t, err)
+}
+
+func TestIsUpdateDoc(t *testing.T) {
+	update, _ := driverDoc(bson.M{"$set": bson.M{"n": 1}})
+	assert.True(t, isUpdateDoc(update))
+	replacement, _ := driverDoc(bson.M{"n": 1})
+	assert.False(t, isUpdateDoc(replacement))
+	assert.False(t, isUpdateDoc(driverbson.Raw(emptyDoc)))
+}
+
+func TestMgoValue(t *testing.T) {
+	oid := primitive.NewObjectID()
+	v, err := mgoValue(oid)
+	require.NoError(t, err)
+	assert.Equal(t, bson.ObjectId(oid[:]), v)
+	v, err = mgoValue(nil)
+	assert.NoError(t, err)
+	assert.Nil(t, v)
+}
+
+func TestMgoError(t *testing.T) {
+	assert.NoError(t, mgoError(nil))
+	assert.Equal(t, mgo.ErrNotFound, mgoError(mongo.ErrNoDocuments))
+
+	dup := mongo.WriteException{WriteErrors: mongo.WriteErrors{{Code: 11000, Message: "E11000 duplicate key error"}}}
+	err := mgoError(dup)
+	assert.True(t, IsDuplicateKey(err))
+	// the driver's helpers see through it too
+	assert.True(t, mongo.IsDuplicateKeyError(err))
+
+	wtimeout := mongo.WriteException{WriteConcernError: &mongo.WriteConcernError{Code: 64, Message: "waiting for replication timed out"}}
+	var lerr *mgo.LastError
+	require.True(t, errors.As(mgoError(wtimeout), &lerr))
+	assert.True(t, lerr.WTimeout)
+
+	bulk := mongo.BulkWriteException{WriteErrors: []mongo.BulkWriteError{{WriteError: mongo.WriteError{Code: 11000}}}}
+	assert.True(t, IsDuplicateKey(mgoError(bulk)))
+
+	var qerr *mgo.QueryError
+	require.True(t, errors.As(mgoError(mongo.CommandError{Code: 50, Message: "operation exceeded time limit"}), &qerr))
+	assert.Equal(t, 50, qerr.Code)
+	assert.True(t, IsTimeout(mgoError(mongo.CommandError{Code: 50})))
+
+	other := errors.New("other")
+	assert.Equal(t, other, mgoError(other))
+}
+
+func TestDriverReadPref(t *testing.T) {
+	rp, err := driverReadPref(nil)
+	require.NoError(t, err)
+	assert.Equal(t, readpref.PrimaryMode, rp.Mode())
+
+	for mode, want := range map[mgo.Mode]readpref.Mode{
+		mgo.Primary:            readpref.PrimaryMode,
+		mgo.PrimaryPreferred:   readpref.PrimaryPreferredMode,
+		mgo.Secondary:          readpref.SecondaryMode,
+		mgo.SecondaryPreferred: readpref.SecondaryPreferredMode,
+		mgo.Monotonic:          readpref.SecondaryPreferredMode,
+		mgo.Nearest:            readpref.NearestMode,
+		mgo.Eventual:           readpref.NearestMode,
+	} {
+		rp, err := driverReadPref(&ReadPreference{Mode: mode})
+		require.NoError(t, err)
+		assert.Equal(t, want, rp.Mode(), "mode %d", mode)
+	}
+
+	rp, err = driverReadPref(&ReadPreference{Mode: mgo.Secondary, TagSets: []ReadTags{{"region": "us-east-1"}}})
+	require.NoError(t, err)
+	require.Len(t, rp.TagSets(), 1)
+	assert.Equal(t, "us-east-1", rp.TagSets()[0][0].Value)
+}
+
+func TestDriverWriteConcern(t *testing.T) {
+	assert.False(t, driverWriteConcern(nil).Acknowledged())
+
+	wc := driverWriteConcern(&mgo.Safe{WMode: "majority", J: true, WTimeout: 500})
+	assert.Equal(t, "majority", wc.W)
+	require.NotNil(t, wc.Journal)
+	assert.True(t, *wc.Journal)
+	assert.Equal(t, 500*time.Millisecond, wc.WTimeout)
+
+	assert.Equal(t, 2, driverWriteConcern(&mgo.Safe{W: 2}).W)
+	assert.Equal(t, &writeconcern.WriteConcern{W: 1}, driverWriteConcern(&mgo.Safe{}))
+}
+
+func TestIndexSpec(t *testing.T) {
+	for _, index := range []mgo.Index{
+		{Key: []string{"a", "-b"}, Unique: true, Name: "a_1_b_-1"},
+		{Key: []string{"$2dsphere:loc"}, Name: "loc_2dsphere"},
+		{Key: []string{"created"}, Name: "created_1", ExpireAfter: time.Hour, Sparse: true},
+		{Key: []string{"name"}, Name: "name_1", Collation: &mgo.Collation{Locale: "en", Strength: 2}},
+	} {
+		spec, err := newIndexSpec(index)
+		require.NoError(t, err)
+		assert.Equal(t, index.Name, spec.Name)
+		assert.Equal(t, index, spec.index())
+	}
+
+	spec, err := newIndexSpec(mgo.Index{Key: []string{"$text:title", "$text:body"}, Weights: map[string]int{"title": 3}})
+	require.NoError(t, err)
+	assert.Equal(t, "title_text_body_text", spec.Name)
+	assert.Equal(t, bson.D{{Name: "_fts", Value: "text"}, {Name: "_ftsx", Value: 1}}, spec.Key)
+	assert.Equal(t, bson.D{{Name: "title", Value: 3}, {Name: "body", Value: 1}}, spec.Weights)
+
+	_, err = newIndexSpec(mgo.Index{Key: []string{"$text:title"}, Weights: map[string]int{"body": 3}})
+	assert.Error(t, err)
+	_, err = newIndexSpec(mgo.Index{Key: []string{"$:title"}})
+	assert.Error(t, err)
+	_, err = newIndexSpec(mgo.Index{})
+	assert.Error(t, err)
+}
+
+func TestCreateCommand(t *testing.T) {
+	cmd, err := createCommand("events", &mgo.CollectionInfo{Capped: true, MaxBytes: 1 << 20, MaxDocs: 100})
+	require.NoError(t, err)
+	assert.Equal(t, bson.D{
+		{Name: "create", Value: "events"},
+		{Name: "capped", Value: true},
+		{Name: "size", Value: 1 << 20},
+		{Name: "max", Value: 100},
+	}, cmd)
+	_, err = createCommand("events", &mgo.CollectionInfo{Capped: true})
+	assert.Error(t, err)
+}
+
+// unreachableDriverSession returns a session of NewMongoDriver on a server that doesn't
+// exist, whose operations fail once they time out selecting it.
+func unreachableDriverSession(t *testing.T, tracer *mocktracer.MockTracer) MongoSession {
+	client, err := mongo.Connect(context.Background(), options.Client().
+		ApplyURI("mongodb://127.0.0.1:1").
+		SetServerSelectionTimeout(50*time.Millisecond))
+	require.NoError(t, err)
+	t.Cleanup(func() { client.Disconnect(context.Background()) })
+	ctx := context.WithValue(context.Background(), handlerKey, &SessionHandler{cfg: SessionHandlerConfig{Tracer: tracer}})
+	// the caller span of FromContext
+	ctx = opentracing.ContextWithSpan(ctx, tracer.StartSpan("caller"))
+	ds, err := NewMongoDriver(client).NewSession(ctx, testDBName, &mgo.Safe{})
+	require.NoError(t, err)
+	return ds.Session(ctx, nil)
+}
+
+func TestMongoDriverUnreachable(t *testing.T) {
+	tracer := mocktracer.New()
+	sess := unreachableDriverSession(t, tracer)
+	c := sess.DB(testDBName).C("users")
+
+	err := c.Find(bson.M{"name": "ada"}).One(&bson.M{})
+	assert.True(t, IsNetworkError(err), "%v", err)
+	assert.True(t, IsNetworkError(c.Insert(bson.M{"name": "ada"})))
+	assert.True(t, IsNetworkError(sess.Ping()))
+
+	spans := tracer.FinishedSpans()
+	require.Len(t, spans, 3)
+	assert.Equal(t, "find", spans[0].OperationName)
+	assert.Equal(t, "users", spans[0].Tag(TagCollection))
+	logged := false
+	for _, l := range spans[0].Logs() {
+		for _, f := range l.Fields {
+			logged = logged || f.Key == "error"
+		}
+	}
+	assert.True(t, logged)
+	assert.Equal(t, "insert", spans[1].OperationName)
+}
+
+func TestMongoDriverGridFS(t *testing.T) {
+	sess := unreachableDriverSession(t, mocktracer.New())
+	_, err := sess.DB(testDBName).GridFS("fs").Open("report.csv")
+	assert.Equal(t, ErrGridFSUnsupported, err)
+}
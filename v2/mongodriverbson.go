@@ -0,0 +1,204 @@
+package mgohttp
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	driverbson "go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/bsontype"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
+	"go.mongodb.org/mongo-driver/mongo/writeconcern"
+	"go.mongodb.org/mongo-driver/tag"
+	"go.mongodb.org/mongo-driver/x/bsonx/bsoncore"
+	mgo "gopkg.in/mgo.v2"
+	bson "gopkg.in/mgo.v2/bson"
+)
+
+// The documents, selectors and results of the sessions of NewMongoDriver are those of mgo's
+// bson package, like the ones of mgo's sessions: they're marshalled with it, and the bytes are
+// handed to the official driver as is, and the other way around for results.
+
+// emptyDoc is the BSON of the empty document.
+var emptyDoc = []byte{5, 0, 0, 0, 0}
+
+// driverValue converts v, a value of mgo's bson, to the official driver's.
+func driverValue(v interface{}) (driverbson.RawValue, error) {
+	data, err := bson.Marshal(bson.D{{Name: "v", Value: v}})
+	if err != nil {
+		return driverbson.RawValue{}, err
+	}
+	return driverbson.Raw(data).LookupErr("v")
+}
+
+// driverDoc converts doc, a document of mgo's bson, to the official driver's. A nil doc is the
+// empty document, like mgo's nil selectors.
+func driverDoc(doc interface{}) (driverbson.Raw, error) {
+	if doc == nil {
+		return driverbson.Raw(emptyDoc), nil
+	}
+	v, err := driverValue(doc)
+	if err != nil {
+		return nil, err
+	}
+	raw, ok := v.DocumentOK()
+	if !ok {
+		return nil, fmt.Errorf("mgohttp: %T isn't a document", doc)
+	}
+	return raw, nil
+}
+
+// driverPipeline converts pipeline, a slice of stages of mgo's bson, to the official driver's.
+func driverPipeline(pipeline interface{}) (bsoncore.Array, error) {
+	if pipeline == nil {
+		return bsoncore.Array(emptyDoc), nil
+	}
+	v, err := driverValue(pipeline)
+	if err != nil {
+		return nil, err
+	}
+	if v.Type != bsontype.Array {
+		return nil, fmt.Errorf("mgohttp: %T isn't a pipeline", pipeline)
+	}
+	return bsoncore.Array(v.Value), nil
+}
+
+// isUpdateDoc reports whether update, converted with driverDoc, is made of update operators
+// rather than a replacement document. mgo sends both with the same methods, the driver has
+// its own for each.
+func isUpdateDoc(update driverbson.Raw) bool {
+	elem, err := update.IndexErr(0)
+	return err == nil && len(elem.Key()) > 0 && elem.Key()[0] == '$'
+}
+
+// unmarshalDriverDoc unmarshals doc, a document returned by the official driver, into result
+// with mgo's bson. The document is copied first: the driver reuses its buffers.
+func unmarshalDriverDoc(doc driverbson.Raw, result interface{}) error {
+	return bson.Unmarshal(append([]byte(nil), doc...), result)
+}
+
+// mgoValue converts v, a value returned by the official driver such as an upserted id, to
+// mgo's bson.
+func mgoValue(v interface{}) (interface{}, error) {
+	if v == nil {
+		return nil, nil
+	}
+	data, err := driverbson.Marshal(driverbson.D{{Key: "v", Value: v}})
+	if err != nil {
+		return nil, err
+	}
+	var doc struct {
+		V interface{} `bson:"v"`
+	}
+	err = bson.Unmarshal(data, &doc)
+	return doc.V, err
+}
+
+// driverError is an error of the official driver along with its mgo equivalent, so the errors
+// of the sessions of both drivers are told apart alike, e.g. with IsDuplicateKey, while the
+// official driver's helpers, e.g. mongo.IsDuplicateKeyError, still see through it.
+type driverError struct {
+	err error
+	mgo error
+}
+
+func (e driverError) Error() string { return e.err.Error() }
+
+// Unwrap allows errors.As(err, &mgoErr) for both the mgo error and the driver's.
+func (e driverError) Unwrap() []error { return []error{e.mgo, e.err} }
+
+// mgoError converts err, returned by the official driver, to its mgo equivalent: a
+// *mgo.LastError for write errors, a *mgo.QueryError for command errors, and mgo.ErrNotFound
+// when no document matched.
+func mgoError(err error) error {
+	var werr mongo.WriteException
+	var berr mongo.BulkWriteException
+	var cerr mongo.CommandError
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, mongo.ErrNoDocuments):
+		return mgo.ErrNotFound
+	case errors.As(err, &werr):
+		if len(werr.WriteErrors) > 0 {
+			return driverError{err: err, mgo: &mgo.LastError{Code: werr.WriteErrors[0].Code, Err: werr.WriteErrors[0].Message}}
+		}
+		if wce := werr.WriteConcernError; wce != nil {
+			return driverError{err: err, mgo: writeConcernLastError(wce)}
+		}
+	case errors.As(err, &berr):
+		if len(berr.WriteErrors) > 0 {
+			return driverError{err: err, mgo: &mgo.LastError{Code: berr.WriteErrors[0].Code, Err: berr.WriteErrors[0].Message}}
+		}
+		if wce := berr.WriteConcernError; wce != nil {
+			return driverError{err: err, mgo: writeConcernLastError(wce)}
+		}
+	case errors.As(err, &cerr):
+		return driverError{err: err, mgo: &mgo.QueryError{Code: int(cerr.Code), Message: cerr.Message}}
+	}
+	return err
+}
+
+// writeConcernLastError is the mgo equivalent of a write concern error.
+func writeConcernLastError(wce *mongo.WriteConcernError) *mgo.LastError {
+	// WriteConcernFailed, the write concern timed out
+	return &mgo.LastError{Code: wce.Code, Err: wce.Message, WTimeout: wce.Code == 64}
+}
+
+// driverReadPref converts p to the official driver's read preference, the primary for nil.
+// Like mgo's, Eventual reads from the nearest member, and Monotonic from the secondaries when
+// there are any, although the driver doesn't move its reads to the primary after a write.
+func driverReadPref(p *ReadPreference) (*readpref.ReadPref, error) {
+	if p == nil {
+		return readpref.Primary(), nil
+	}
+	var mode readpref.Mode
+	switch p.Mode {
+	case mgo.Primary:
+		return readpref.Primary(), nil
+	case mgo.PrimaryPreferred:
+		mode = readpref.PrimaryPreferredMode
+	case mgo.Secondary:
+		mode = readpref.SecondaryMode
+	case mgo.SecondaryPreferred, mgo.Monotonic:
+		mode = readpref.SecondaryPreferredMode
+	case mgo.Nearest, mgo.Eventual:
+		mode = readpref.NearestMode
+	default:
+		return nil, fmt.Errorf("mgohttp: unknown read mode %d", p.Mode)
+	}
+	sets := make([]tag.Set, 0, len(p.TagSets))
+	for _, t := range p.TagSets {
+		set := tag.Set{}
+		for _, elem := range t.doc() {
+			set = append(set, tag.Tag{Name: elem.Name, Value: elem.Value.(string)})
+		}
+		sets = append(sets, set)
+	}
+	return readpref.New(mode, readpref.WithTagSets(sets...))
+}
+
+// driverWriteConcern converts safe to the official driver's write concern. Like mgo's, a nil
+// safe doesn't acknowledge the writes. The driver has no fsync option: FSync waits for the
+// journal instead.
+func driverWriteConcern(safe *mgo.Safe) *writeconcern.WriteConcern {
+	if safe == nil {
+		return writeconcern.Unacknowledged()
+	}
+	wc := &writeconcern.WriteConcern{W: 1}
+	switch {
+	case safe.WMode != "":
+		wc.W = safe.WMode
+	case safe.W > 0:
+		wc.W = safe.W
+	}
+	if safe.J || safe.FSync {
+		journal := true
+		wc.Journal = &journal
+	}
+	if safe.WTimeout > 0 {
+		wc.WTimeout = time.Duration(safe.WTimeout) * time.Millisecond
+	}
+	return wc
+}
@@ -0,0 +1,881 @@
+package mgohttp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	opentracing "github.com/opentracing/opentracing-go"
+	opentracinglog "github.com/opentracing/opentracing-go/log"
+	driverbson "go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	mgo "gopkg.in/mgo.v2"
+	bson "gopkg.in/mgo.v2/bson"
+)
+
+type tracedDriverCollection struct {
+	db      tracedDriverDatabase
+	name    string
+	ctx     context.Context
+	concern *writeConcern // set by WithWriteConcern
+}
+
+// checks returns the collection as seen by the pre-flight checks shared with mgo's sessions,
+// which only look at its name: it has no session.
+func (tc tracedDriverCollection) checks() tracedMgoCollection {
+	db := &mgo.Database{Name: tc.db.name}
+	return tracedMgoCollection{collectionName: tc.name, collection: db.C(tc.name), ctx: tc.ctx}
+}
+
+// collection returns the driver's handle on the collection, writing with the write concern
+// of WithWriteConcern, if any, or else the session's.
+func (tc tracedDriverCollection) collection(sp opentracing.Span) (*mongo.Collection, error) {
+	db, err := tc.db.ts.database(tc.db.name)
+	if err != nil {
+		return nil, err
+	}
+	opts := options.Collection()
+	if tc.concern != nil {
+		sp.SetTag(TagWriteConcern, safeName(tc.concern.safe))
+		opts.SetWriteConcern(driverWriteConcern(tc.concern.safe))
+	}
+	return db.Collection(tc.name, opts), nil
+}
+
+// selector converts selector, with the $comment of the operation, to the driver's.
+func (tc tracedDriverCollection) selector(selector interface{}) (driverbson.Raw, error) {
+	return driverDoc(commentSelector(tc.ctx, selector))
+}
+
+// unacknowledged reports whether err is the driver's way of telling the write wasn't
+// acknowledged: mgo returns no error, and no result, for those.
+func unacknowledged(err error) bool {
+	return errors.Is(err, mongo.ErrUnacknowledgedWrite)
+}
+
+func (tc tracedDriverCollection) WithWriteConcern(safe *mgo.Safe) MongoCollection {
+	recordUsage("MongoCollection.WithWriteConcern")
+	tc.concern = &writeConcern{safe: safe}
+	return tc
+}
+
+func (tc tracedDriverCollection) UpdateId(id bson.ObjectId, update interface{}) error {
+	recordUsage("MongoCollection.UpdateId")
+	return tc.Update(bson.M{"_id": tc.checks().normalizeID(id)}, update)
+}
+
+// update runs a single update of the documents matching selector, with update operators or a
+// replacement document alike.
+func (tc tracedDriverCollection) update(ctx context.Context, c *mongo.Collection, selector, update interface{}, upsert bool) (*mongo.UpdateResult, error) {
+	filter, err := tc.selector(selector)
+	if err != nil {
+		return nil, err
+	}
+	doc, err := driverDoc(update)
+	if err != nil {
+		return nil, err
+	}
+	if isUpdateDoc(doc) {
+		return c.UpdateOne(ctx, filter, doc, options.Update().SetUpsert(upsert))
+	}
+	return c.ReplaceOne(ctx, filter, doc, options.Replace().SetUpsert(upsert))
+}
+
+// currentSize returns a func measuring the document matching selector, for the
+// DocumentSizeCheck.
+func (tc tracedDriverCollection) currentSize(ctx context.Context, c *mongo.Collection, selector interface{}) func() (int, error) {
+	return func() (int, error) {
+		filter, err := driverDoc(selector)
+		if err != nil {
+			return 0, err
+		}
+		raw, err := c.FindOne(ctx, filter).Raw()
+		return len(raw), mgoError(err)
+	}
+}
+
+func (tc tracedDriverCollection) Update(selector interface{}, update interface{}) (err error) {
+	recordSelectorUsage("MongoCollection.Update", selector, update)
+	sp, ctx := startOp(tc.ctx, "update", tc.name)
+	sp.logSelector(selector)
+	sp.LogFields(bsonToKeys(tc.ctx, LogUpdate, update))
+	defer sp.Finish()
+	defer sp.recoverPanic(&err)
+	if err := tc.checks().guard(sp, selector); err != nil {
+		return logAndReturnErr(sp, err)
+	}
+	ctx, cancel := tc.db.ts.opContext(ctx)
+	defer cancel()
+	c, err := tc.collection(sp)
+	if err != nil {
+		return logAndReturnErr(sp, err)
+	}
+	if err := checkDocumentSize(tc.ctx, sp, tc.name, update, tc.currentSize(ctx, c, selector)); err != nil {
+		return logAndReturnErr(sp, err)
+	}
+
+	return sp.done(sp.intercept(OpInfo{Selector: selector, Update: update}, func(op *OpInfo) error {
+		res, err := tc.update(ctx, c, op.Selector, op.Update, false)
+		if unacknowledged(err) {
+			return nil
+		}
+		if err != nil {
+			return mgoError(err)
+		}
+		if res.MatchedCount == 0 {
+			return mgo.ErrNotFound
+		}
+		return nil
+	}))
+}
+
+func (tc tracedDriverCollection) UpdateAll(selector interface{}, update interface{}) (info *mgo.ChangeInfo, err error) {
+	recordSelectorUsage("MongoCollection.UpdateAll", selector, update)
+	sp, ctx := startOp(tc.ctx, "update-all", tc.name)
+	sp.logSelector(selector)
+	sp.LogFields(bsonToKeys(tc.ctx, LogUpdate, update))
+	defer sp.Finish()
+	defer sp.recoverPanic(&err)
+	if err := tc.checks().guard(sp, selector); err != nil {
+		return nil, logAndReturnErr(sp, err)
+	}
+	ctx, cancel := tc.db.ts.opContext(ctx)
+	defer cancel()
+	c, err := tc.collection(sp)
+	if err != nil {
+		return nil, logAndReturnErr(sp, err)
+	}
+
+	err = sp.intercept(OpInfo{Selector: selector, Update: update}, func(op *OpInfo) error {
+		filter, err := tc.selector(op.Selector)
+		if err != nil {
+			return err
+		}
+		doc, err := driverDoc(op.Update)
+		if err != nil {
+			return err
+		}
+		res, err := c.UpdateMany(ctx, filter, doc)
+		if unacknowledged(err) {
+			return nil
+		}
+		if err != nil {
+			return mgoError(err)
+		}
+		info = &mgo.ChangeInfo{Updated: int(res.ModifiedCount), Matched: int(res.MatchedCount)}
+		return nil
+	})
+	return info, sp.done(err)
+}
+
+func (tc tracedDriverCollection) Insert(docs ...interface{}) (err error) {
+	recordUsage("MongoCollection.Insert")
+	sp, ctx := startOp(tc.ctx, "insert", tc.name)
+	sp.LogFields(opentracinglog.Int(LogNumDocs, len(docs)))
+	defer sp.Finish()
+	defer sp.recoverPanic(&err)
+	if err := tc.checks().guard(sp, nil); err != nil {
+		return logAndReturnErr(sp, err)
+	}
+	ctx, cancel := tc.db.ts.opContext(ctx)
+	defer cancel()
+	c, err := tc.collection(sp)
+	if err != nil {
+		return logAndReturnErr(sp, err)
+	}
+
+	return sp.done(sp.intercept(OpInfo{Docs: docs}, func(op *OpInfo) error {
+		converted := make([]interface{}, len(op.Docs))
+		for i, doc := range op.Docs {
+			raw, err := driverDoc(doc)
+			if err != nil {
+				return err
+			}
+			converted[i] = raw
+		}
+		_, err := c.InsertMany(ctx, converted)
+		if unacknowledged(err) {
+			return nil
+		}
+		return mgoError(err)
+	}))
+}
+
+func (tc tracedDriverCollection) Upsert(selector interface{}, update interface{}) (info *mgo.ChangeInfo, err error) {
+	recordSelectorUsage("MongoCollection.Upsert", selector, update)
+	sp, ctx := startOp(tc.ctx, "upsert", tc.name)
+	sp.logSelector(selector)
+	sp.LogFields(bsonToKeys(tc.ctx, LogUpdate, update))
+	defer sp.Finish()
+	defer sp.recoverPanic(&err)
+	if err := tc.checks().guard(sp, selector); err != nil {
+		return nil, logAndReturnErr(sp, err)
+	}
+	ctx, cancel := tc.db.ts.opContext(ctx)
+	defer cancel()
+	c, err := tc.collection(sp)
+	if err != nil {
+		return nil, logAndReturnErr(sp, err)
+	}
+	if err := checkDocumentSize(tc.ctx, sp, tc.name, update, tc.currentSize(ctx, c, selector)); err != nil {
+		return nil, logAndReturnErr(sp, err)
+	}
+
+	err = sp.intercept(OpInfo{Selector: selector, Update: update}, func(op *OpInfo) error {
+		res, err := tc.update(ctx, c, op.Selector, op.Update, true)
+		if unacknowledged(err) {
+			return nil
+		}
+		if err != nil {
+			return mgoError(err)
+		}
+		info = &mgo.ChangeInfo{Updated: int(res.ModifiedCount), Matched: int(res.MatchedCount)}
+		if res.UpsertedID != nil {
+			info.UpsertedId, err = mgoValue(res.UpsertedID)
+		}
+		return err
+	})
+	return info, sp.done(err)
+}
+
+func (tc tracedDriverCollection) FindId(id bson.ObjectId) MongoQuery {
+	recordUsage("MongoCollection.FindId")
+	return tc.Find(bson.M{"_id": tc.checks().normalizeID(id)})
+}
+
+func (tc tracedDriverCollection) RemoveId(id bson.ObjectId) error {
+	recordUsage("MongoCollection.RemoveId")
+	return tc.Remove(bson.M{"_id": tc.checks().normalizeID(id)})
+}
+
+func (tc tracedDriverCollection) Remove(selector interface{}) (err error) {
+	recordSelectorUsage("MongoCollection.Remove", selector)
+	sp, ctx := startOp(tc.ctx, "remove", tc.name)
+	sp.logSelector(selector)
+	defer sp.Finish()
+	defer sp.recoverPanic(&err)
+	if err := tc.checks().guard(sp, selector); err != nil {
+		return logAndReturnErr(sp, err)
+	}
+	ctx, cancel := tc.db.ts.opContext(ctx)
+	defer cancel()
+	c, err := tc.collection(sp)
+	if err != nil {
+		return logAndReturnErr(sp, err)
+	}
+
+	return sp.done(sp.intercept(OpInfo{Selector: selector}, func(op *OpInfo) error {
+		filter, err := tc.selector(op.Selector)
+		if err != nil {
+			return err
+		}
+		res, err := c.DeleteOne(ctx, filter)
+		if unacknowledged(err) {
+			return nil
+		}
+		if err != nil {
+			return mgoError(err)
+		}
+		if res.DeletedCount == 0 {
+			return mgo.ErrNotFound
+		}
+		return nil
+	}))
+}
+
+func (tc tracedDriverCollection) RemoveAll(selector interface{}) (info *mgo.ChangeInfo, err error) {
+	recordSelectorUsage("MongoCollection.RemoveAll", selector)
+	sp, ctx := startOp(tc.ctx, "removeall", tc.name)
+	sp.logSelector(selector)
+	defer sp.Finish()
+	defer sp.recoverPanic(&err)
+	if err := tc.checks().guard(sp, selector); err != nil {
+		return nil, logAndReturnErr(sp, err)
+	}
+	ctx, cancel := tc.db.ts.opContext(ctx)
+	defer cancel()
+	c, err := tc.collection(sp)
+	if err != nil {
+		return nil, logAndReturnErr(sp, err)
+	}
+
+	err = sp.intercept(OpInfo{Selector: selector}, func(op *OpInfo) error {
+		filter, err := tc.selector(op.Selector)
+		if err != nil {
+			return err
+		}
+		res, err := c.DeleteMany(ctx, filter)
+		if unacknowledged(err) {
+			return nil
+		}
+		if err != nil {
+			return mgoError(err)
+		}
+		info = &mgo.ChangeInfo{Removed: int(res.DeletedCount), Matched: int(res.DeletedCount)}
+		return nil
+	})
+	return info, sp.done(err)
+}
+
+// runCommand runs cmd on the collection's database, for the operations the driver has no
+// method for that takes mgo's types, e.g. the indexes.
+func (tc tracedDriverCollection) runCommand(ctx context.Context, cmd, result interface{}) error {
+	ctx, cancel := tc.db.ts.opContext(ctx)
+	defer cancel()
+	// admin commands go to the primary
+	ts := tc.db.ts
+	ts.pref = nil
+	return ts.runCommand(ctx, tc.db.name, cmd, result)
+}
+
+func (tc tracedDriverCollection) DropCollection() (err error) {
+	recordUsage("MongoCollection.DropCollection")
+	sp, ctx := startOp(tc.ctx, "drop-collection", tc.name)
+	defer sp.Finish()
+	defer sp.recoverPanic(&err)
+	if err := tc.checks().guard(sp, nil); err != nil {
+		return logAndReturnErr(sp, err)
+	}
+
+	return sp.done(sp.intercept(OpInfo{}, func(*OpInfo) error {
+		return tc.runCommand(ctx, bson.D{{Name: "drop", Value: tc.name}}, nil)
+	}))
+}
+
+func (tc tracedDriverCollection) Create(info *mgo.CollectionInfo) (err error) {
+	recordUsage("MongoCollection.Create")
+	sp, ctx := startOp(tc.ctx, "create-collection", tc.name)
+	defer sp.Finish()
+	defer sp.recoverPanic(&err)
+	if info.Capped {
+		sp.LogFields(
+			opentracinglog.Int(LogCappedMaxBytes, info.MaxBytes),
+			opentracinglog.Int(LogCappedMaxDocs, info.MaxDocs),
+		)
+	}
+	if err := tc.checks().guard(sp, nil); err != nil {
+		return logAndReturnErr(sp, err)
+	}
+
+	return sp.done(sp.intercept(OpInfo{}, func(*OpInfo) error {
+		cmd, err := createCommand(tc.name, info)
+		if err != nil {
+			return err
+		}
+		return tc.runCommand(ctx, cmd, nil)
+	}))
+}
+
+// createCommand is the create command of mgo.Collection.Create.
+func createCommand(collection string, info *mgo.CollectionInfo) (bson.D, error) {
+	cmd := bson.D{{Name: "create", Value: collection}}
+	if info.Capped {
+		if info.MaxBytes < 1 {
+			return nil, errors.New("Collection.Create: with Capped, MaxBytes must also be set")
+		}
+		cmd = append(cmd, bson.DocElem{Name: "capped", Value: true}, bson.DocElem{Name: "size", Value: info.MaxBytes})
+		if info.MaxDocs > 0 {
+			cmd = append(cmd, bson.DocElem{Name: "max", Value: info.MaxDocs})
+		}
+	}
+	if info.DisableIdIndex {
+		cmd = append(cmd, bson.DocElem{Name: "autoIndexId", Value: false})
+	}
+	if info.ForceIdIndex {
+		cmd = append(cmd, bson.DocElem{Name: "autoIndexId", Value: true})
+	}
+	if info.Validator != nil {
+		cmd = append(cmd, bson.DocElem{Name: "validator", Value: info.Validator})
+	}
+	if info.ValidationLevel != "" {
+		cmd = append(cmd, bson.DocElem{Name: "validationLevel", Value: info.ValidationLevel})
+	}
+	if info.ValidationAction != "" {
+		cmd = append(cmd, bson.DocElem{Name: "validationAction", Value: info.ValidationAction})
+	}
+	if info.StorageEngine != nil {
+		cmd = append(cmd, bson.DocElem{Name: "storageEngine", Value: info.StorageEngine})
+	}
+	return cmd, nil
+}
+
+func (tc tracedDriverCollection) Stats() (stats CollectionStats, err error) {
+	recordUsage("MongoCollection.Stats")
+	sp, ctx := startOp(tc.ctx, "coll-stats", tc.name)
+	defer sp.Finish()
+	defer sp.recoverPanic(&err)
+	if err := tc.checks().guard(sp, nil); err != nil {
+		return CollectionStats{}, logAndReturnErr(sp, err)
+	}
+
+	err = sp.intercept(OpInfo{}, func(*OpInfo) error {
+		return tc.runCommand(ctx, bson.D{{Name: "collStats", Value: tc.name}}, &stats)
+	})
+	if err != nil {
+		return CollectionStats{}, sp.done(err)
+	}
+	sp.LogFields(opentracinglog.Int64(LogCollectionCount, stats.Count), opentracinglog.Int64(LogCollectionSize, stats.Size))
+	return stats, sp.done(nil)
+}
+
+// indexSpec is the specification of an index, as sent with createIndexes and listed by
+// listIndexes, the same as mgo's.
+type indexSpec struct {
+	Name             string         `bson:"name"`
+	Key              bson.D         `bson:"key"`
+	Unique           bool           `bson:"unique,omitempty"`
+	DropDups         bool           `bson:"dropDups,omitempty"`
+	Background       bool           `bson:"background,omitempty"`
+	Sparse           bool           `bson:"sparse,omitempty"`
+	Bits             int            `bson:"bits,omitempty"`
+	Min              float64        `bson:"min,omitempty"`
+	Max              float64        `bson:"max,omitempty"`
+	BucketSize       float64        `bson:"bucketSize,omitempty"`
+	ExpireAfter      int            `bson:"expireAfterSeconds,omitempty"`
+	Weights          bson.D         `bson:"weights,omitempty"`
+	DefaultLanguage  string         `bson:"default_language,omitempty"`
+	LanguageOverride string         `bson:"language_override,omitempty"`
+	TextIndexVersion int            `bson:"textIndexVersion,omitempty"`
+	Collation        *mgo.Collation `bson:"collation,omitempty"`
+}
+
+// indexKey parses the key of an index, in the syntax of mgo's, e.g. "-created" or
+// "$text:title", into the key document of its specification, along with its default name
+// and the weights of its text fields.
+func indexKey(key []string) (doc bson.D, name string, weights bson.D, err error) {
+	names := []string{}
+	text := false
+	for _, field := range key {
+		raw := field
+		var kind string
+		if strings.HasPrefix(field, "$") {
+			c := strings.Index(field, ":")
+			if c <= 1 || c == len(field)-1 {
+				return nil, "", nil, fmt.Errorf(`invalid index key: want "[$<kind>:][-]<field name>", got %q`, raw)
+			}
+			kind, field = field[1:c], field[c+1:]
+		}
+		var order interface{} = 1
+		switch {
+		case kind != "":
+			order = kind
+			names = append(names, field+"_"+kind)
+		case strings.HasPrefix(field, "-"):
+			order, field = -1, field[1:]
+			names = append(names, field+"_-1")
+		default:
+			field = strings.TrimPrefix(field, "+")
+			names = append(names, field+"_1")
+		}
+		if field == "" {
+			return nil, "", nil, fmt.Errorf(`invalid index key: want "[$<kind>:][-]<field name>", got %q`, raw)
+		}
+		if kind == "text" {
+			if !text {
+				doc = append(doc, bson.DocElem{Name: "_fts", Value: "text"}, bson.DocElem{Name: "_ftsx", Value: 1})
+				text = true
+			}
+			weights = append(weights, bson.DocElem{Name: field, Value: 1})
+			continue
+		}
+		doc = append(doc, bson.DocElem{Name: field, Value: order})
+	}
+	if len(names) == 0 {
+		return nil, "", nil, errors.New("invalid index key: no fields provided")
+	}
+	return doc, strings.Join(names, "_"), weights, nil
+}
+
+// newIndexSpec returns the specification of index.
+func newIndexSpec(index mgo.Index) (indexSpec, error) {
+	key, name, weights, err := indexKey(index.Key)
+	if err != nil {
+		return indexSpec{}, err
+	}
+	spec := indexSpec{
+		Name:             name,
+		Key:              key,
+		Unique:           index.Unique,
+		DropDups:         index.DropDups,
+		Background:       index.Background,
+		Sparse:           index.Sparse,
+		Bits:             index.Bits,
+		Min:              index.Minf,
+		Max:              index.Maxf,
+		BucketSize:       index.BucketSize,
+		ExpireAfter:      int(index.ExpireAfter / time.Second),
+		Weights:          weights,
+		DefaultLanguage:  index.DefaultLanguage,
+		LanguageOverride: index.LanguageOverride,
+		Collation:        index.Collation,
+	}
+	if spec.Min == 0 && spec.Max == 0 {
+		spec.Min, spec.Max = float64(index.Min), float64(index.Max)
+	}
+	if index.Name != "" {
+		spec.Name = index.Name
+	}
+	for field, weight := range index.Weights {
+		found := false
+		for i := range spec.Weights {
+			if spec.Weights[i].Name == field {
+				spec.Weights[i].Value, found = weight, true
+			}
+		}
+		if !found {
+			return indexSpec{}, fmt.Errorf("invalid index weights: %s isn't a text field of the key", field)
+		}
+	}
+	return spec, nil
+}
+
+// index returns the mgo.Index of the specification.
+func (spec indexSpec) index() mgo.Index {
+	index := mgo.Index{
+		Name:             spec.Name,
+		Unique:           spec.Unique,
+		DropDups:         spec.DropDups,
+		Background:       spec.Background,
+		Sparse:           spec.Sparse,
+		Minf:             spec.Min,
+		Maxf:             spec.Max,
+		Bits:             spec.Bits,
+		BucketSize:       spec.BucketSize,
+		DefaultLanguage:  spec.DefaultLanguage,
+		LanguageOverride: spec.LanguageOverride,
+		ExpireAfter:      time.Duration(spec.ExpireAfter) * time.Second,
+		Collation:        spec.Collation,
+	}
+	if float64(int(spec.Min)) == spec.Min && float64(int(spec.Max)) == spec.Max {
+		index.Min, index.Max = int(spec.Min), int(spec.Max)
+	}
+	if spec.TextIndexVersion > 0 {
+		index.Weights = map[string]int{}
+		for _, elem := range spec.Weights {
+			index.Key = append(index.Key, "$text:"+elem.Name)
+			index.Weights[elem.Name] = toInt(elem.Value)
+		}
+		return index
+	}
+	for _, elem := range spec.Key {
+		switch v := elem.Value.(type) {
+		case string:
+			index.Key = append(index.Key, "$"+v+":"+elem.Name)
+		default:
+			if toInt(v) < 0 {
+				index.Key = append(index.Key, "-"+elem.Name)
+			} else {
+				index.Key = append(index.Key, elem.Name)
+			}
+		}
+	}
+	return index
+}
+
+func (tc tracedDriverCollection) EnsureIndex(index mgo.Index) (err error) {
+	recordUsage("MongoCollection.EnsureIndex")
+	sp, ctx := startOp(tc.ctx, "ensure-index", tc.name)
+	defer sp.Finish()
+	defer sp.recoverPanic(&err)
+	if err := tc.checks().guard(sp, nil); err != nil {
+		sp.LogFields(indexFields(index)...)
+		return logAndReturnErr(sp, err)
+	}
+	release, err := tc.checks().applyIndexPolicy(sp, &index)
+	sp.LogFields(indexFields(index)...)
+	if err != nil {
+		return logAndReturnErr(sp, err)
+	}
+	defer release()
+
+	return sp.done(sp.intercept(OpInfo{}, func(*OpInfo) error {
+		spec, err := newIndexSpec(index)
+		if err != nil {
+			return err
+		}
+		cmd := bson.D{{Name: "createIndexes", Value: tc.name}, {Name: "indexes", Value: []indexSpec{spec}}}
+		return tc.runCommand(ctx, cmd, nil)
+	}))
+}
+
+func (tc tracedDriverCollection) EnsureIndexKey(key ...string) error {
+	recordUsage("MongoCollection.EnsureIndexKey")
+	return tc.EnsureIndex(mgo.Index{Key: key})
+}
+
+func (tc tracedDriverCollection) DropIndex(key ...string) (err error) {
+	recordUsage("MongoCollection.DropIndex")
+	sp, ctx := startOp(tc.ctx, "drop-index", tc.name)
+	defer sp.Finish()
+	defer sp.recoverPanic(&err)
+	sp.LogFields(opentracinglog.String(LogIndexKey, strings.Join(key, "|")))
+	if err := tc.checks().guard(sp, nil); err != nil {
+		return logAndReturnErr(sp, err)
+	}
+
+	return sp.done(sp.intercept(OpInfo{}, func(*OpInfo) error {
+		_, name, _, err := indexKey(key)
+		if err != nil {
+			return err
+		}
+		return tc.runCommand(ctx, bson.D{{Name: "dropIndexes", Value: tc.name}, {Name: "index", Value: name}}, nil)
+	}))
+}
+
+func (tc tracedDriverCollection) DropIndexName(name string) (err error) {
+	recordUsage("MongoCollection.DropIndexName")
+	sp, ctx := startOp(tc.ctx, "drop-index", tc.name)
+	defer sp.Finish()
+	defer sp.recoverPanic(&err)
+	sp.LogFields(opentracinglog.String(LogIndexName, name))
+	if err := tc.checks().guard(sp, nil); err != nil {
+		return logAndReturnErr(sp, err)
+	}
+
+	return sp.done(sp.intercept(OpInfo{}, func(*OpInfo) error {
+		return tc.runCommand(ctx, bson.D{{Name: "dropIndexes", Value: tc.name}, {Name: "index", Value: name}}, nil)
+	}))
+}
+
+func (tc tracedDriverCollection) Indexes() (indexes []mgo.Index, err error) {
+	recordUsage("MongoCollection.Indexes")
+	sp, ctx := startOp(tc.ctx, "indexes", tc.name)
+	defer sp.Finish()
+	defer sp.recoverPanic(&err)
+	if err := tc.checks().guard(sp, nil); err != nil {
+		return nil, logAndReturnErr(sp, err)
+	}
+	ctx, cancel := tc.db.ts.opContext(ctx)
+	defer cancel()
+	c, err := tc.collection(sp)
+	if err != nil {
+		return nil, logAndReturnErr(sp, err)
+	}
+
+	err = sp.intercept(OpInfo{}, func(*OpInfo) (err error) {
+		indexes, err = listIndexes(ctx, c)
+		return err
+	})
+	// sorted by name, like mgo's
+	sort.Slice(indexes, func(i, j int) bool { return indexes[i].Name < indexes[j].Name })
+	sp.LogFields(opentracinglog.Int(LogNumIndexes, len(indexes)))
+	return indexes, sp.done(err)
+}
+
+// listIndexes lists the indexes of c.
+func listIndexes(ctx context.Context, c *mongo.Collection) ([]mgo.Index, error) {
+	cur, err := c.Indexes().List(ctx)
+	if err != nil {
+		return nil, mgoError(err)
+	}
+	defer cur.Close(ctx)
+	var indexes []mgo.Index
+	for cur.Next(ctx) {
+		var spec indexSpec
+		if err := unmarshalDriverDoc(cur.Current, &spec); err != nil {
+			return indexes, err
+		}
+		indexes = append(indexes, spec.index())
+	}
+	return indexes, mgoError(cur.Err())
+}
+
+// tracedDriverBulk queues operations as the write models of a BulkWrite of the official
+// driver, traced as a single "bulk" span when they're run, like tracedMgoBulk.
+type tracedDriverBulk struct {
+	tc        tracedDriverCollection
+	queue     []func() ([]mongo.WriteModel, error)
+	ops       map[string]int // number of queued operations per kind
+	selectors []interface{}  // the selectors of the queued operations, for the pre-flight checks
+	unordered bool
+}
+
+func (tc tracedDriverCollection) Bulk() MongoBulk {
+	recordUsage("MongoCollection.Bulk")
+	return &tracedDriverBulk{
+		tc:  tc,
+		ops: map[string]int{},
+	}
+}
+
+func (b *tracedDriverBulk) Insert(docs ...interface{}) {
+	recordUsage("MongoBulk.Insert")
+	b.queue = append(b.queue, func() ([]mongo.WriteModel, error) {
+		models := []mongo.WriteModel{}
+		for _, doc := range docs {
+			raw, err := driverDoc(doc)
+			if err != nil {
+				return nil, err
+			}
+			models = append(models, mongo.NewInsertOneModel().SetDocument(raw))
+		}
+		return models, nil
+	})
+	b.ops["insert"] += len(docs)
+}
+
+// queuePairs queues the selector/update pairs as the models of model, and records their
+// selectors.
+func (b *tracedDriverBulk) queuePairs(kind string, pairs []interface{}, model func(filter, update driverbson.Raw) mongo.WriteModel) {
+	if len(pairs)%2 != 0 {
+		panic("Bulk." + kind + " requires an even number of parameters")
+	}
+	for i := 0; i+1 < len(pairs); i += 2 {
+		b.selectors = append(b.selectors, pairs[i])
+	}
+	b.ops[kind] += len(pairs) / 2
+	b.queue = append(b.queue, func() ([]mongo.WriteModel, error) {
+		models := []mongo.WriteModel{}
+		for i := 0; i+1 < len(pairs); i += 2 {
+			filter, err := b.tc.selector(pairs[i])
+			if err != nil {
+				return nil, err
+			}
+			update, err := driverDoc(pairs[i+1])
+			if err != nil {
+				return nil, err
+			}
+			models = append(models, model(filter, update))
+		}
+		return models, nil
+	})
+}
+
+// updateOne is the model of a single update, with update operators or a replacement
+// document alike.
+func updateOne(filter, update driverbson.Raw, upsert bool) mongo.WriteModel {
+	if isUpdateDoc(update) {
+		return mongo.NewUpdateOneModel().SetFilter(filter).SetUpdate(update).SetUpsert(upsert)
+	}
+	return mongo.NewReplaceOneModel().SetFilter(filter).SetReplacement(update).SetUpsert(upsert)
+}
+
+func (b *tracedDriverBulk) Update(pairs ...interface{}) {
+	recordSelectorUsage("MongoBulk.Update", pairs...)
+	b.queuePairs("update", pairs, func(filter, update driverbson.Raw) mongo.WriteModel {
+		return updateOne(filter, update, false)
+	})
+}
+
+func (b *tracedDriverBulk) UpdateAll(pairs ...interface{}) {
+	recordSelectorUsage("MongoBulk.UpdateAll", pairs...)
+	b.queuePairs("update-all", pairs, func(filter, update driverbson.Raw) mongo.WriteModel {
+		return mongo.NewUpdateManyModel().SetFilter(filter).SetUpdate(update)
+	})
+}
+
+func (b *tracedDriverBulk) Upsert(pairs ...interface{}) {
+	recordSelectorUsage("MongoBulk.Upsert", pairs...)
+	b.queuePairs("upsert", pairs, func(filter, update driverbson.Raw) mongo.WriteModel {
+		return updateOne(filter, update, true)
+	})
+}
+
+// queueRemoves queues the removal of the documents matching selectors, as the models of
+// model.
+func (b *tracedDriverBulk) queueRemoves(kind string, selectors []interface{}, model func(filter driverbson.Raw) mongo.WriteModel) {
+	b.selectors = append(b.selectors, selectors...)
+	b.ops[kind] += len(selectors)
+	b.queue = append(b.queue, func() ([]mongo.WriteModel, error) {
+		models := []mongo.WriteModel{}
+		for _, selector := range selectors {
+			filter, err := b.tc.selector(selector)
+			if err != nil {
+				return nil, err
+			}
+			models = append(models, model(filter))
+		}
+		return models, nil
+	})
+}
+
+func (b *tracedDriverBulk) Remove(selectors ...interface{}) {
+	recordSelectorUsage("MongoBulk.Remove", selectors...)
+	b.queueRemoves("remove", selectors, func(filter driverbson.Raw) mongo.WriteModel {
+		return mongo.NewDeleteOneModel().SetFilter(filter)
+	})
+}
+
+func (b *tracedDriverBulk) RemoveAll(selectors ...interface{}) {
+	recordSelectorUsage("MongoBulk.RemoveAll", selectors...)
+	b.queueRemoves("removeall", selectors, func(filter driverbson.Raw) mongo.WriteModel {
+		return mongo.NewDeleteManyModel().SetFilter(filter)
+	})
+}
+
+func (b *tracedDriverBulk) Unordered() {
+	recordUsage("MongoBulk.Unordered")
+	b.unordered = true
+}
+
+// run runs the queued operations on c.
+func (b *tracedDriverBulk) run(ctx context.Context, c *mongo.Collection) (*mgo.BulkResult, error) {
+	models := []mongo.WriteModel{}
+	for _, queued := range b.queue {
+		m, err := queued()
+		if err != nil {
+			return nil, err
+		}
+		models = append(models, m...)
+	}
+	if len(models) == 0 {
+		// like mgo's, running an empty bulk is a no-op
+		return &mgo.BulkResult{}, nil
+	}
+	r, err := c.BulkWrite(ctx, models, options.BulkWrite().SetOrdered(!b.unordered))
+	if unacknowledged(err) {
+		return &mgo.BulkResult{}, nil
+	}
+	if err != nil {
+		return nil, mgoError(err)
+	}
+	// mgo counts the upserted and removed documents as matched
+	return &mgo.BulkResult{Matched: int(r.MatchedCount + r.UpsertedCount + r.DeletedCount), Modified: int(r.ModifiedCount)}, nil
+}
+
+func (b *tracedDriverBulk) Run() (res *mgo.BulkResult, err error) {
+	recordUsage("MongoBulk.Run")
+	sp, ctx := startOp(b.tc.ctx, "bulk", b.tc.name)
+	defer sp.Finish()
+	defer sp.recoverPanic(&err)
+	sp.SetTag(TagBulkUnordered, b.unordered)
+	total := 0
+	fields := []opentracinglog.Field{}
+	for kind, n := range b.ops {
+		total += n
+		fields = append(fields, opentracinglog.Int(LogBulkOpsPrefix+kind, n))
+	}
+	sp.LogFields(append(fields, opentracinglog.Int(LogBulkOps, total))...)
+
+	checks := b.tc.checks()
+	if err := checks.guard(sp, nil); err != nil {
+		return nil, logAndReturnErr(sp, err)
+	}
+	for _, selector := range b.selectors {
+		if err := checks.guard(sp, selector); err != nil {
+			return nil, logAndReturnErr(sp, err)
+		}
+	}
+	ctx, cancel := b.tc.db.ts.opContext(ctx)
+	defer cancel()
+	c, err := b.tc.collection(sp)
+	if err != nil {
+		return nil, logAndReturnErr(sp, err)
+	}
+
+	err = sp.intercept(OpInfo{}, func(*OpInfo) (err error) {
+		res, err = b.run(ctx, c)
+		return err
+	})
+	if res != nil {
+		sp.LogFields(
+			opentracinglog.Int(LogBulkMatched, res.Matched),
+			opentracinglog.Int(LogBulkModified, res.Modified),
+		)
+	}
+	return res, sp.done(err)
+}
@@ -0,0 +1,773 @@
+package mgohttp
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	opentracing "github.com/opentracing/opentracing-go"
+	opentracinglog "github.com/opentracing/opentracing-go/log"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	mgo "gopkg.in/mgo.v2"
+	bson "gopkg.in/mgo.v2/bson"
+)
+
+// runCursor runs cmd, a command returning a cursor such as find or aggregate, on database and
+// returns its cursor, which the driver drives with getMore commands sent to the same server.
+func (ts tracedDriverSession) runCursor(ctx context.Context, database string, cmd bson.D) (*mongo.Cursor, error) {
+	doc, err := driverDoc(cmd)
+	if err != nil {
+		return nil, err
+	}
+	db, err := ts.database(database)
+	if err != nil {
+		return nil, err
+	}
+	rp, err := driverReadPref(ts.pref)
+	if err != nil {
+		return nil, err
+	}
+	cur, err := db.RunCommandCursor(ctx, doc, options.RunCmd().SetReadPreference(rp))
+	return cur, mgoError(err)
+}
+
+func (tc tracedDriverCollection) Find(selector interface{}) MongoQuery {
+	recordSelectorUsage("MongoCollection.Find", selector)
+	sp, ctx := startOp(tc.ctx, "find", tc.name)
+
+	// NOTE: Find just starts the trace, the finishing call on the MongoQuery must
+	// finish it.
+	sp.logSelector(selector)
+	checks := tc.checks()
+	if err := checks.guard(sp, selector); err != nil {
+		logAndReturnErr(sp, err)
+		sp.Finish()
+		return failedMongoQuery{err: err}
+	}
+	return tracedDriverQuery{
+		tc:   tc,
+		ts:   tc.db.ts,
+		ctx:  ctx,
+		op:   sp,
+		spec: querySpec{collection: checks.collection, filter: selector, comment: opCommentFromContext(ctx)},
+	}
+}
+
+// tracedDriverQuery is the query of a collection of the official driver. Its access methods
+// run the commands the mgo queries emulate their options with, e.g. find or count, which take
+// every option of MongoQuery natively since the driver requires MongoDB 3.6.
+type tracedDriverQuery struct {
+	tc   tracedDriverCollection
+	ts   tracedDriverSession // reading according to the query's read preference, see bind
+	ctx  context.Context
+	op   *opSpan // started by Find, finished by the access method
+	spec querySpec
+	// bound is the context of the access method's commands, see bind
+	bound context.Context
+}
+
+// bind binds the commands of the query to the session, reading according to the query's read
+// preference, under the context of its operation. The returned func ends that context.
+func (q tracedDriverQuery) bind() (tracedDriverQuery, func()) {
+	if q.spec.readPref != nil {
+		q.ts.pref = q.spec.readPref
+	}
+	ctx, cancel := q.ts.opContext(q.ctx)
+	q.bound = ctx
+	ts, database := q.ts, q.tc.db.name
+	q.spec.run = func(cmd, result interface{}) error {
+		return ts.runCommand(ctx, database, cmd, result)
+	}
+	return q, cancel
+}
+
+// admit takes a slot of the handler's OpLimiter for the query and binds it, reading at the
+// request's snapshot when it asked for snapshot reads. When it's rejected, the query's span is
+// finished with the error.
+func (q tracedDriverQuery) admit() (tracedDriverQuery, func(), error) {
+	release, err := q.op.limit(q.op.name, q.tc.name)
+	if err != nil {
+		err = logAndReturnErr(q.op, err)
+		q.op.Finish()
+		return q, nil, err
+	}
+	q, cancel := q.bind()
+	if snapshotReads(q.ctx, q.spec) {
+		q.op.SetTag(TagReadConcern, "snapshot")
+		at, err := q.ts.s.snapshotTime(q.bound, q.ts)
+		if err != nil {
+			cancel()
+			release()
+			err = q.op.done(err)
+			q.op.Finish()
+			return q, nil, err
+		}
+		q.spec.readConcern, q.spec.atClusterTime = "snapshot", at
+	}
+	return q, func() {
+		cancel()
+		release()
+	}, nil
+}
+
+// intercept runs an access method of the query through the handler's Interceptors, with
+// the selector they rewrote, if they did.
+func (q tracedDriverQuery) intercept(method string, update interface{}, run func(q tracedDriverQuery, op *OpInfo) error) error {
+	info := OpInfo{Method: method, Selector: q.spec.filter, Update: update}
+	return q.op.intercept(info, func(op *OpInfo) error {
+		q.spec.filter = op.Selector
+		return run(q, op)
+	})
+}
+
+// cursor runs the find command of the query, with limit, and returns its cursor.
+func (q tracedDriverQuery) cursor(limit int, tail bool) (*mongo.Cursor, error) {
+	cmd := q.spec.findCommand(limit, false)
+	if tail {
+		cmd = append(cmd, bson.DocElem{Name: "tailable", Value: true}, bson.DocElem{Name: "awaitData", Value: true})
+	}
+	return q.ts.runCursor(q.bound, q.tc.db.name, cmd)
+}
+
+func (q tracedDriverQuery) All(result interface{}) (err error) {
+	recordUsage("MongoQuery.All")
+	n, err := enforcedLimit(q.ctx, q.op, q.spec)
+	if err != nil {
+		defer q.op.Finish()
+		return logAndReturnErr(q.op, err)
+	}
+	if n != 0 {
+		q = q.Limit(n).(tracedDriverQuery)
+	}
+	q, release, err := q.admit()
+	if err != nil {
+		return err
+	}
+	defer release()
+	sp := q.op
+	defer sp.Finish()
+	defer sp.recoverPanic(&err)
+
+	sp.SetTag(TagAccessMethod, "All")
+	defer logResultBytes(sp, result)
+	err = q.intercept("All", nil, func(q tracedDriverQuery, _ *OpInfo) error {
+		cur, err := q.cursor(q.spec.limit, false)
+		if err != nil {
+			return err
+		}
+		defer cur.Close(q.bound)
+		return cursorAll(q.bound, cur, result)
+	})
+	digestFromContext(q.ctx).add(q.tc.name, "All", result, err)
+	return sp.done(err)
+}
+
+// cursorAll reads the documents of cur into result, a pointer to a slice.
+func cursorAll(ctx context.Context, cur *mongo.Cursor, result interface{}) error {
+	var err error
+	if rerr := readAll(result, func(doc interface{}) bool {
+		if !cur.Next(ctx) {
+			return false
+		}
+		err = unmarshalDriverDoc(cur.Current, doc)
+		return err == nil
+	}); rerr != nil {
+		return rerr
+	}
+	if err != nil {
+		return err
+	}
+	return mgoError(cur.Err())
+}
+
+func (q tracedDriverQuery) One(result interface{}) (err error) {
+	recordUsage("MongoQuery.One")
+	q, release, err := q.admit()
+	if err != nil {
+		return err
+	}
+	defer release()
+	sp := q.op
+	defer sp.Finish()
+	defer sp.recoverPanic(&err)
+
+	sp.SetTag(TagAccessMethod, "One")
+	defer logResultBytes(sp, result)
+	err = q.intercept("One", nil, func(q tracedDriverQuery, _ *OpInfo) error {
+		return q.spec.one(result)
+	})
+	digestFromContext(q.ctx).add(q.tc.name, "One", result, err)
+	return sp.done(err)
+}
+
+func (q tracedDriverQuery) OneRaw() (bson.Raw, error) {
+	recordUsage("MongoQuery.OneRaw")
+	var raw bson.Raw
+	err := q.One(&raw)
+	return raw, err
+}
+
+func (q tracedDriverQuery) AllRaw() ([]bson.Raw, error) {
+	recordUsage("MongoQuery.AllRaw")
+	docs := []bson.Raw{}
+	if err := q.All(&docs); err != nil {
+		return nil, err
+	}
+	return docs, nil
+}
+
+func (q tracedDriverQuery) Count() (n int, err error) {
+	recordUsage("MongoQuery.Count")
+	q, release, err := q.admit()
+	if err != nil {
+		return 0, err
+	}
+	defer release()
+	sp := q.op
+	defer sp.Finish()
+	defer sp.recoverPanic(&err)
+
+	sp.SetTag(TagAccessMethod, "Count")
+	err = q.intercept("Count", nil, func(q tracedDriverQuery, _ *OpInfo) (err error) {
+		n, err = q.spec.count()
+		return err
+	})
+	digestFromContext(q.ctx).add(q.tc.name, "Count", n, err)
+	return n, sp.done(err)
+}
+
+func (q tracedDriverQuery) Apply(change mgo.Change, result interface{}) (info *mgo.ChangeInfo, err error) {
+	recordApplyUsage(change)
+	q, release, err := q.admit()
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	sp := q.op
+	defer sp.Finish()
+	defer sp.recoverPanic(&err)
+
+	sp.SetTag(TagAccessMethod, "apply")
+	sp.LogFields(bsonToKeys(q.ctx, LogUpdate, change.Update))
+	sp.LogFields(
+		opentracinglog.Bool(LogRemove, change.Remove),
+		opentracinglog.Bool(LogReturnNew, change.ReturnNew),
+		opentracinglog.Bool(LogUpsert, change.Upsert),
+	)
+
+	err = q.intercept("Apply", change.Update, func(q tracedDriverQuery, op *OpInfo) (err error) {
+		change.Update = op.Update
+		info, err = q.spec.apply(change, result)
+		return err
+	})
+	return info, sp.done(err)
+}
+
+func (q tracedDriverQuery) Explain(result interface{}) (err error) {
+	recordUsage("MongoQuery.Explain")
+	q, release := q.bind()
+	defer release()
+	sp := q.op
+	defer sp.Finish()
+	defer sp.recoverPanic(&err)
+
+	sp.SetTag(TagAccessMethod, "Explain")
+	return sp.done(q.intercept("Explain", nil, func(q tracedDriverQuery, _ *OpInfo) error {
+		return q.spec.explain(result)
+	}))
+}
+
+func (q tracedDriverQuery) Iter() MongoIter {
+	recordUsage("MongoQuery.Iter")
+	q, release, err := q.admit()
+	if err != nil {
+		return failedMongoIter{err: err}
+	}
+	sp := q.op
+	defer sp.Finish()
+
+	sp.SetTag(TagAccessMethod, "Iter")
+	var cur *mongo.Cursor
+	err = q.intercept("Iter", nil, func(q tracedDriverQuery, _ *OpInfo) (err error) {
+		cur, err = q.cursor(q.spec.limit, false)
+		return err
+	})
+	if err = sp.done(err); err != nil {
+		release()
+		return failedMongoIter{err: err}
+	}
+	sp.SetTag(TagCursorID, cur.ID())
+	_, ctx := startSpan(q.ctx, "iter")
+	t := newDriverIter(ctx, q.bound, cur, q.tc.name, sp.fingerprint, release)
+	t.digest = digestFromContext(ctx).iter(q.tc.name)
+	return t
+}
+
+func (q tracedDriverQuery) Tail(timeout time.Duration) MongoIter {
+	recordUsage("MongoQuery.Tail")
+	q, release, err := q.admit()
+	if err != nil {
+		return failedMongoIter{err: err}
+	}
+	sp := q.op
+	sp.SetTag(TagAccessMethod, "Tail")
+	sp.LogFields(opentracinglog.Int64(LogTailTimeoutMillis, timeout.Milliseconds()))
+	if q.spec.collation != nil {
+		release()
+		logAndReturnErr(sp, ErrCollatedTail)
+		sp.Finish()
+		return failedMongoIter{err: ErrCollatedTail}
+	}
+	cur, err := q.cursor(q.spec.limit, true)
+	if err != nil {
+		release()
+		err = sp.done(err)
+		sp.Finish()
+		return failedMongoIter{err: err}
+	}
+	return &tracedDriverTailIter{cur: cur, op: sp, ctx: q.bound, release: release, timeout: timeout}
+}
+
+func (q tracedDriverQuery) Limit(n int) MongoQuery {
+	recordUsage("MongoQuery.Limit")
+	q.op.LogFields(opentracinglog.Int(LogQueryLimit, n))
+	q.spec.limit = n
+	return q
+}
+
+func (q tracedDriverQuery) Select(selector interface{}) MongoQuery {
+	recordUsage("MongoQuery.Select")
+	q.op.LogFields(bsonToKeys(q.ctx, LogSelect, selector))
+	q.spec.projection = selector
+	return q
+}
+
+func (q tracedDriverQuery) Hint(indexKey ...string) MongoQuery {
+	recordUsage("MongoQuery.Hint")
+	for i, hint := range indexKey {
+		q.op.LogFields(opentracinglog.String(fmt.Sprintf(LogHintPrefix+"%d", i), hint))
+	}
+	q.spec.hint = indexKey
+	return q
+}
+
+func (q tracedDriverQuery) Sort(fields ...string) MongoQuery {
+	recordUsage("MongoQuery.Sort")
+	q.op.SetTag(TagSort, strings.Join(fields, "|"))
+	q.spec.sort = fields
+	return q
+}
+
+func (q tracedDriverQuery) And(selector interface{}) MongoQuery {
+	recordUsage("MongoQuery.And")
+	q.spec.filter = andSelectors(q.spec.filter, selector)
+	return q
+}
+
+func (q tracedDriverQuery) Skip(n int) MongoQuery {
+	recordUsage("MongoQuery.Skip")
+	q.op.LogFields(opentracinglog.Int(LogQuerySkip, n))
+	q.spec.skip = n
+	return q
+}
+
+func (q tracedDriverQuery) Batch(n int) MongoQuery {
+	recordUsage("MongoQuery.Batch")
+	q.op.LogFields(opentracinglog.Int(LogQueryBatch, n))
+	q.spec.batch = n
+	return q
+}
+
+// Prefetch is logged but has no effect: the driver requests the next batch once the current
+// one is read.
+func (q tracedDriverQuery) Prefetch(p float64) MongoQuery {
+	recordUsage("MongoQuery.Prefetch")
+	q.op.LogFields(opentracinglog.Float64(LogQueryPrefetch, p))
+	q.spec.prefetch = &p
+	return q
+}
+
+func (q tracedDriverQuery) SetMaxTime(d time.Duration) MongoQuery {
+	recordUsage("MongoQuery.SetMaxTime")
+	q.op.LogFields(opentracinglog.Int64(LogQueryMaxTimeMillis, d.Milliseconds()))
+	q.spec.maxTime = d
+	return q
+}
+
+func (q tracedDriverQuery) WithReadPreference(p ReadPreference) MongoQuery {
+	recordUsage("MongoQuery.WithReadPreference")
+	p.tag(q.op)
+	q.spec.readPref = &p
+	return q
+}
+
+func (q tracedDriverQuery) WithCollation(c Collation) MongoQuery {
+	recordUsage("MongoQuery.WithCollation")
+	q.op.SetTag(TagCollation, c.Locale)
+	q.op.LogFields(opentracinglog.Int(LogCollationStrength, c.Strength))
+	q.spec.collation = &c
+	return q
+}
+
+// WithSnapshot reads at the snapshot of the request, see WithSnapshotReads: the snapshot reads
+// of a request on a database all read from the same one.
+func (q tracedDriverQuery) WithSnapshot() MongoQuery {
+	recordUsage("MongoQuery.WithSnapshot")
+	q.spec.snapshot = true
+	return q
+}
+
+func (q tracedDriverQuery) WithReadConcern(level string) MongoQuery {
+	recordUsage("MongoQuery.WithReadConcern")
+	if level == "snapshot" {
+		return q.WithSnapshot()
+	}
+	q.op.SetTag(TagReadConcern, level)
+	q.spec.readConcern = level
+	return q
+}
+
+// tracedDriverIter is the cursor of a query or a pipeline of the official driver, traced as a
+// span from the time it's opened until it's closed, with a span per getMore.
+type tracedDriverIter struct {
+	cur *mongo.Cursor
+	// ctx carries the span of the cursor, bound is the context of its commands
+	ctx         context.Context
+	bound       context.Context
+	collection  string
+	fingerprint string
+	// release gives back the op limiter slot of the cursor and ends bound, once it's closed
+	release   func()
+	err       error
+	closed    bool
+	heartbeat *iterHeartbeat
+	digest    *iterDigest // nil unless the request's results are digested
+	stats     *cursorStats
+}
+
+// newDriverIter returns the traced cursor of cur, whose span is in ctx.
+func newDriverIter(ctx, bound context.Context, cur *mongo.Cursor, collection, fingerprint string, release func()) *tracedDriverIter {
+	t := &tracedDriverIter{
+		cur:         cur,
+		ctx:         ctx,
+		bound:       bound,
+		collection:  collection,
+		fingerprint: fingerprint,
+		release:     sync.OnceFunc(release),
+		heartbeat:   newIterHeartbeat(ctx),
+		stats:       newPipeCursorStats(ctx, collection),
+	}
+	t.stats.received(cur.RemainingBatchLength(), false)
+	return t
+}
+
+func (t *tracedDriverIter) Next(result interface{}) bool {
+	recordUsage("MongoIter.Next")
+	if t.closed || t.err != nil || BudgetExpired(t.ctx) {
+		return false
+	}
+	if !t.next() {
+		t.err = t.wrapErr(t.err)
+		t.end()
+		return false
+	}
+	if err := unmarshalDriverDoc(t.cur.Current, result); err != nil {
+		t.err = err
+		t.end()
+		return false
+	}
+	t.digest.next(result)
+	t.heartbeat.read(t.ctx, t.collection, t.fingerprint)
+	return true
+}
+
+// next moves the cursor to its next document, tracing the getMore when it fetches the next
+// batch.
+func (t *tracedDriverIter) next() bool {
+	if t.cur.RemainingBatchLength() > 0 || t.cur.ID() == 0 {
+		ok := t.cur.Next(t.bound)
+		t.err = mgoError(t.cur.Err())
+		return ok
+	}
+	sp, _ := startOp(t.ctx, "getmore", t.collection)
+	defer sp.Finish()
+	sp.SetTag(TagCursorID, t.cur.ID())
+	ok := t.cur.Next(t.bound)
+	n := t.cur.RemainingBatchLength()
+	if ok {
+		n++
+	}
+	sp.LogFields(opentracinglog.Int(LogBatchDocs, n))
+	t.stats.received(n, true)
+	// the errors of the cursor are wrapped by its Err
+	sp.done(mgoError(t.cur.Err()))
+	t.err = mgoError(t.cur.Err())
+	return ok
+}
+
+func (t *tracedDriverIter) All(result interface{}) error {
+	recordUsage("MongoIter.All")
+	if err := readAll(result, t.Next); err != nil {
+		t.Close()
+		return err
+	}
+	return t.Close()
+}
+
+// end closes the cursor, gives back its slot and finishes its span, the first time it's
+// called.
+func (t *tracedDriverIter) end() {
+	if t.closed {
+		return
+	}
+	t.closed = true
+	t.cur.Close(t.bound)
+	t.release()
+	t.digest.close(t.err)
+	t.stats.report()
+	sp := opentracing.SpanFromContext(t.ctx)
+	if t.err != nil {
+		logAndReturnErr(sp, t.err)
+	}
+	sp.Finish()
+}
+
+func (t *tracedDriverIter) Close() error {
+	recordUsage("MongoIter.Close")
+	if t.err == nil && !t.closed && BudgetExpired(t.ctx) && !t.exhausted() {
+		t.err = ErrBudgetExpired
+	}
+	t.end()
+	return t.err
+}
+
+// wrapErr wraps the errors of the cursor in an OpError.
+func (t *tracedDriverIter) wrapErr(err error) error {
+	return withFingerprint(wrapOpErr(t.ctx, "iter", t.collection, err), t.fingerprint)
+}
+
+// exhausted reports whether the cursor has no documents left.
+func (t *tracedDriverIter) exhausted() bool {
+	return t.cur.ID() == 0 && t.cur.RemainingBatchLength() == 0
+}
+
+func (t *tracedDriverIter) Done() bool {
+	recordUsage("MongoIter.Done")
+	return t.closed || t.err != nil || t.exhausted()
+}
+
+func (t *tracedDriverIter) Err() error {
+	recordUsage("MongoIter.Err")
+	return t.err
+}
+
+// Timeout is always false: the cursors of tailable queries are tracedDriverTailIters.
+func (t *tracedDriverIter) Timeout() bool {
+	recordUsage("MongoIter.Timeout")
+	return false
+}
+
+// tracedDriverTailIter traces a tailable cursor of the official driver as a single span, from
+// Tail to Close, like tracedTailIter.
+type tracedDriverTailIter struct {
+	cur     *mongo.Cursor
+	op      *opSpan
+	ctx     context.Context // the context of the cursor's commands
+	release func()
+	// timeout is how long Next waits for a document, forever when negative
+	timeout time.Duration
+
+	err      error
+	timedOut bool
+	docs     int
+	timeouts int
+}
+
+// Next waits for the next document up to the timeout of the cursor. The server waits for new
+// documents a second at most per getMore, so Next may wait up to a second longer.
+func (t *tracedDriverTailIter) Next(result interface{}) bool {
+	recordUsage("MongoIter.Next")
+	t.timedOut = false
+	if t.err != nil || BudgetExpired(t.op.ctx) {
+		return false
+	}
+	start := time.Now()
+	for {
+		if t.cur.TryNext(t.ctx) {
+			if t.err = unmarshalDriverDoc(t.cur.Current, result); t.err != nil {
+				return false
+			}
+			t.docs++
+			return true
+		}
+		if err := t.cur.Err(); err != nil {
+			t.err = mgoError(err)
+			return false
+		}
+		if t.cur.ID() == 0 {
+			return false
+		}
+		if t.timeout >= 0 && time.Since(start) >= t.timeout {
+			t.timedOut = true
+			t.timeouts++
+			return false
+		}
+	}
+}
+
+func (t *tracedDriverTailIter) All(result interface{}) error {
+	recordUsage("MongoIter.All")
+	if err := readAll(result, t.Next); err != nil {
+		return err
+	}
+	return t.err
+}
+
+func (t *tracedDriverTailIter) Close() error {
+	recordUsage("MongoIter.Close")
+	defer t.op.Finish()
+	defer t.release()
+	t.op.LogFields(
+		opentracinglog.Int(LogNumDocs, t.docs),
+		opentracinglog.Int(LogTailTimeouts, t.timeouts),
+	)
+	t.cur.Close(t.ctx)
+	return t.op.done(t.Err())
+}
+
+func (t *tracedDriverTailIter) Done() bool {
+	return t.err != nil || (t.cur.ID() == 0 && t.cur.RemainingBatchLength() == 0)
+}
+
+func (t *tracedDriverTailIter) Err() error {
+	if t.err == nil && BudgetExpired(t.op.ctx) && !t.Done() {
+		return ErrBudgetExpired
+	}
+	return t.err
+}
+
+func (t *tracedDriverTailIter) Timeout() bool { return t.timedOut }
+
+// tracedDriverPipe is an aggregation pipeline of the official driver, run as the same
+// aggregate command as tracedPipe's, whose cursor the driver drives.
+type tracedDriverPipe struct {
+	tc           tracedDriverCollection
+	pipeline     interface{}
+	batch        int
+	allowDiskUse bool
+}
+
+func (tc tracedDriverCollection) Pipe(pipeline interface{}) MongoPipe {
+	recordUsage("MongoCollection.Pipe")
+	return tracedDriverPipe{tc: tc, pipeline: pipeline}
+}
+
+func (p tracedDriverPipe) AllowDiskUse() MongoPipe {
+	recordUsage("MongoPipe.AllowDiskUse")
+	p.allowDiskUse = true
+	return p
+}
+
+func (p tracedDriverPipe) Batch(n int) MongoPipe {
+	recordUsage("MongoPipe.Batch")
+	p.batch = n
+	return p
+}
+
+// command returns the aggregate command, see tracedPipe.command.
+func (p tracedDriverPipe) command(batch int) bson.D {
+	return tracedPipe{tc: p.tc.checks(), pipeline: p.pipeline, allowDiskUse: p.allowDiskUse}.command(batch)
+}
+
+func (p tracedDriverPipe) All(result interface{}) error {
+	recordUsage("MongoPipe.All")
+	return p.iter(p.batch).All(result)
+}
+
+func (p tracedDriverPipe) One(result interface{}) error {
+	recordUsage("MongoPipe.One")
+	it := p.iter(1)
+	if it.Next(result) {
+		return it.Close()
+	}
+	if err := it.Close(); err != nil {
+		return err
+	}
+	return mgo.ErrNotFound
+}
+
+func (p tracedDriverPipe) Iter() MongoIter {
+	recordUsage("MongoPipe.Iter")
+	return p.iter(p.batch)
+}
+
+func (p tracedDriverPipe) Explain(result interface{}) (err error) {
+	recordUsage("MongoPipe.Explain")
+	sp, ctx := startOp(p.tc.ctx, "aggregate-explain", p.tc.name)
+	defer sp.Finish()
+	defer sp.recoverPanic(&err)
+	if err := p.tc.checks().guard(sp, nil); err != nil {
+		return logAndReturnErr(sp, err)
+	}
+	ctx, cancel := p.tc.db.ts.opContext(ctx)
+	defer cancel()
+	cmd := bson.D{
+		{Name: "aggregate", Value: p.tc.name},
+		{Name: "pipeline", Value: p.pipeline},
+		{Name: "explain", Value: true},
+	}
+	return sp.done(sp.intercept(OpInfo{Selector: p.pipeline}, func(op *OpInfo) error {
+		cmd[1].Value = op.Selector
+		return p.tc.db.ts.runCommand(ctx, p.tc.db.name, cmd, result)
+	}))
+}
+
+// iter runs the aggregate command and returns the cursor on its results, traced as a span
+// from now until it's closed.
+func (p tracedDriverPipe) iter(batch int) MongoIter {
+	_, ctx := startSpan(p.tc.ctx, "aggregate-cursor")
+	t, err := p.aggregate(ctx, batch)
+	if err != nil {
+		sp := opentracing.SpanFromContext(ctx)
+		logAndReturnErr(sp, err)
+		sp.Finish()
+		return failedMongoIter{err: err}
+	}
+	return t
+}
+
+// aggregate runs the aggregate command, as the first batch of the cursor whose span is in
+// ctx.
+func (p tracedDriverPipe) aggregate(ctx context.Context, batch int) (t *tracedDriverIter, err error) {
+	sp, _ := startOp(ctx, "aggregate", p.tc.name)
+	defer sp.Finish()
+	defer sp.recoverPanic(&err)
+	sp.setFingerprint(p.pipeline)
+	if err := p.tc.checks().guard(sp, nil); err != nil {
+		return nil, logAndReturnErr(sp, err)
+	}
+	release, err := sp.limit("aggregate", p.tc.name)
+	if err != nil {
+		return nil, logAndReturnErr(sp, err)
+	}
+	defer release()
+
+	// the cursor's commands run until it's closed, past the operation's span
+	bound, cancel := p.tc.db.ts.opContext(ctx)
+	var cur *mongo.Cursor
+	err = sp.intercept(OpInfo{Selector: p.pipeline}, func(op *OpInfo) (err error) {
+		p.pipeline = op.Selector
+		cur, err = p.tc.db.ts.runCursor(bound, p.tc.db.name, p.command(batch))
+		return err
+	})
+	if err = sp.done(err); err != nil {
+		cancel()
+		return nil, err
+	}
+	sp.SetTag(TagCursorID, cur.ID())
+	sp.LogFields(opentracinglog.Int(LogBatchDocs, cur.RemainingBatchLength()))
+	return newDriverIter(ctx, bound, cur, p.tc.name, sp.fingerprint, cancel), nil
+}
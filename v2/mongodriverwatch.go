@@ -0,0 +1,188 @@
+package mgohttp
+
+import (
+	"context"
+
+	opentracinglog "github.com/opentracing/opentracing-go/log"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	bson "gopkg.in/mgo.v2/bson"
+)
+
+func (t tracedDriverDatabase) Watch(pipeline interface{}, opts ChangeStreamOptions) ChangeStream {
+	recordUsage("MongoDatabase.Watch")
+	sp, _ := startOp(t.ctx, "watch", "")
+	return t.ts.watch(sp, t.name, "", pipeline, opts)
+}
+
+func (tc tracedDriverCollection) Watch(pipeline interface{}, opts ChangeStreamOptions) ChangeStream {
+	recordUsage("MongoCollection.Watch")
+	sp, _ := startOp(tc.ctx, "watch", tc.name)
+	if err := tc.checks().checkDisabled(sp); err != nil {
+		logAndReturnErr(sp, err)
+		sp.Finish()
+		return failedChangeStream{err: err}
+	}
+	return tc.db.ts.watch(sp, tc.db.name, tc.name, pipeline, opts)
+}
+
+// watch opens a change stream on collection in database, or on every collection of database
+// when empty, with the driver's $changeStream rather than the oplog: watching a database
+// takes MongoDB 4.0, a collection 3.6. The pipeline is the same as the one of the change
+// streams of mgo's sessions, and so are the events and their resume tokens, the cluster time
+// of the changes. The span of sp lasts until the change stream is closed.
+func (ts tracedDriverSession) watch(sp *opSpan, database, collection string, pipeline interface{}, opts ChangeStreamOptions) ChangeStream {
+	sp.SetTag(TagAccessMethod, "Watch")
+	types, err := watchedTypes(pipeline)
+	if err != nil {
+		logAndReturnErr(sp, err)
+		sp.Finish()
+		return failedChangeStream{err: err}
+	}
+	await := opts.MaxAwaitTime
+	if await <= 0 {
+		await = defaultWatchAwait
+	}
+	sp.LogFields(opentracinglog.Int64(LogTailTimeoutMillis, await.Milliseconds()))
+
+	streamOpts := options.ChangeStream().SetMaxAwaitTime(await)
+	if after := opts.ResumeAfter.Timestamp; after != 0 {
+		// the change stream starts at a cluster time, while ResumeAfter is the one of the last
+		// change returned
+		streamOpts.SetStartAtOperationTime(&primitive.Timestamp{T: uint32(after >> 32), I: uint32(after) + 1})
+	}
+	ctx, cancel := ts.opContext(sp.ctx)
+	stream, err := ts.openChangeStream(ctx, sp, database, collection, types, streamOpts)
+	if err != nil {
+		cancel()
+		sp.Finish()
+		return failedChangeStream{err: err}
+	}
+	return &tracedDriverChangeStream{
+		stream: stream,
+		op:     sp,
+		ctx:    ctx,
+		cancel: cancel,
+		types:  types,
+		token:  opts.ResumeAfter,
+	}
+}
+
+// openChangeStream opens the driver's change stream of the operation types on collection in
+// database, or on every collection of database when empty.
+func (ts tracedDriverSession) openChangeStream(ctx context.Context, sp *opSpan, database, collection string, types map[string]bool, opts *options.ChangeStreamOptions) (stream *mongo.ChangeStream, err error) {
+	defer sp.recoverPanic(&err)
+	watched := []string{}
+	for _, t := range []string{"insert", "update", "replace", "delete"} {
+		if types[t] {
+			watched = append(watched, t)
+		}
+	}
+	match := []interface{}{bson.M{"$match": bson.M{"operationType": bson.M{"$in": watched}}}}
+	err = sp.intercept(OpInfo{Selector: match}, func(op *OpInfo) error {
+		p, err := driverPipeline(op.Selector)
+		if err != nil {
+			return err
+		}
+		db, err := ts.database(database)
+		if err != nil {
+			return err
+		}
+		if collection == "" {
+			stream, err = db.Watch(ctx, p, opts)
+		} else {
+			stream, err = db.Collection(collection).Watch(ctx, p, opts)
+		}
+		return mgoError(err)
+	})
+	return stream, sp.done(err)
+}
+
+// driverChangeEvent is the subset of the events of the driver's change streams a
+// ChangeEvent is made of.
+type driverChangeEvent struct {
+	ClusterTime   bson.MongoTimestamp `bson:"clusterTime"`
+	OperationType string              `bson:"operationType"`
+	NS            struct {
+		DB   string `bson:"db"`
+		Coll string `bson:"coll"`
+	} `bson:"ns"`
+	DocumentKey       bson.M             `bson:"documentKey"`
+	FullDocument      bson.M             `bson:"fullDocument,omitempty"`
+	UpdateDescription *UpdateDescription `bson:"updateDescription,omitempty"`
+}
+
+// tracedDriverChangeStream is the change stream of the driver's Watch, traced like
+// tracedChangeStream: a single span from Watch to Close.
+type tracedDriverChangeStream struct {
+	stream *mongo.ChangeStream
+	op     *opSpan
+	ctx    context.Context // the context of the change stream's commands
+	cancel context.CancelFunc
+	types  map[string]bool
+	token  ResumeToken
+
+	err      error
+	timedOut bool
+	docs     int
+	timeouts int
+}
+
+// Next waits for the next change, up to the MaxAwaitTime of the change stream.
+func (cs *tracedDriverChangeStream) Next(event *ChangeEvent) bool {
+	recordUsage("ChangeStream.Next")
+	cs.timedOut = false
+	if cs.err != nil || BudgetExpired(cs.op.ctx) {
+		return false
+	}
+	for {
+		if !cs.stream.TryNext(cs.ctx) {
+			if cs.err = mgoError(cs.stream.Err()); cs.err == nil {
+				cs.timedOut = true
+				cs.timeouts++
+			}
+			return false
+		}
+		var e driverChangeEvent
+		if cs.err = unmarshalDriverDoc(cs.stream.Current, &e); cs.err != nil {
+			return false
+		}
+		cs.token = ResumeToken{e.ClusterTime}
+		if cs.types[e.OperationType] {
+			*event = ChangeEvent{
+				ID:                cs.token,
+				OperationType:     e.OperationType,
+				Database:          e.NS.DB,
+				Collection:        e.NS.Coll,
+				DocumentKey:       e.DocumentKey,
+				FullDocument:      e.FullDocument,
+				UpdateDescription: e.UpdateDescription,
+			}
+			cs.docs++
+			return true
+		}
+	}
+}
+
+func (cs *tracedDriverChangeStream) Err() error {
+	if cs.err == nil && BudgetExpired(cs.op.ctx) {
+		return ErrBudgetExpired
+	}
+	return cs.err
+}
+
+func (cs *tracedDriverChangeStream) Timeout() bool            { return cs.timedOut }
+func (cs *tracedDriverChangeStream) ResumeToken() ResumeToken { return cs.token }
+
+func (cs *tracedDriverChangeStream) Close() error {
+	recordUsage("ChangeStream.Close")
+	defer cs.op.Finish()
+	defer cs.cancel()
+	cs.op.LogFields(
+		opentracinglog.Int(LogNumDocs, cs.docs),
+		opentracinglog.Int(LogTailTimeouts, cs.timeouts),
+	)
+	cs.stream.Close(cs.ctx)
+	return cs.op.done(cs.Err())
+}
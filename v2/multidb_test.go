@@ -0,0 +1,84 @@
+package mgohttp
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	opentracing "github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/mocktracer"
+	"github.com/stretchr/testify/assert"
+	mgo "gopkg.in/mgo.v2"
+)
+
+func TestMultipleDatabases(t *testing.T) {
+	tracer := mocktracer.New()
+	opentracing.SetGlobalTracer(tracer)
+	defer opentracing.SetGlobalTracer(opentracing.NoopTracer{})
+
+	created := []string{}
+	newSession := func(name string) func(ctx context.Context) (*mgo.Session, error) {
+		return func(ctx context.Context) (*mgo.Session, error) {
+			created = append(created, name)
+			return &mgo.Session{}, nil
+		}
+	}
+	handler := NewSessionHandler(SessionHandlerConfig{
+		Database:   "users",
+		NewSession: newSession("users"),
+		Databases: []DatabaseConfig{
+			{Database: "billing", NewSession: newSession("billing")},
+			{Database: "events"},
+		},
+		Timeout: handlerTimeout,
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			FromContext(r.Context(), "users")
+			FromContext(r.Context(), "billing")
+			FromContext(r.Context(), "billing")
+			FromContext(r.Context(), "events")
+		}),
+	})
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+
+	// events has no session of its own, so it's created with the handler's NewSession
+	assert.Equal(t, []string{"users", "billing", "users"}, created)
+	roots := 0
+	for _, sp := range tracer.FinishedSpans() {
+		if sp.OperationName == "mgohttp" {
+			roots++
+		}
+	}
+	assert.Equal(t, 1, roots)
+}
+
+func TestDatabaseSessionsAreCreatedConcurrently(t *testing.T) {
+	started, unblock := make(chan struct{}), make(chan struct{})
+	handler := NewSessionHandler(SessionHandlerConfig{
+		Database:   "users",
+		NewSession: func(ctx context.Context) (*mgo.Session, error) { return &mgo.Session{}, nil },
+		Databases: []DatabaseConfig{{Database: "billing", NewSession: func(ctx context.Context) (*mgo.Session, error) {
+			close(started)
+			<-unblock
+			return &mgo.Session{}, nil
+		}}},
+		Timeout: time.Second,
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			billing := make(chan MongoSession)
+			go func() { billing <- FromContext(r.Context(), "billing") }()
+			<-started
+			users := make(chan MongoSession)
+			go func() { users <- FromContext(r.Context(), "users") }()
+			select {
+			case sess := <-users:
+				assert.IsType(t, tracedMgoSession{}, sess)
+			case <-time.After(time.Second):
+				t.Error("the session of users waits for the one of billing")
+			}
+			close(unblock)
+			assert.IsType(t, tracedMgoSession{}, <-billing)
+		}),
+	})
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+}
@@ -0,0 +1,240 @@
+package mgohttp
+
+import (
+	"sync"
+	"time"
+
+	"gopkg.in/Clever/kayvee-go.v6/logger"
+	mgo "gopkg.in/mgo.v2"
+)
+
+// NearestReadsConfig configures a NearestRouter.
+type NearestReadsConfig struct {
+	// Sess is used to discover the members of the replica set.
+	Sess *mgo.Session
+	// DialInfo is the template for the direct connections to each member, carrying the
+	// credentials, dialer and timeouts. Its Addrs and Direct fields are overwritten.
+	DialInfo mgo.DialInfo
+	// ProbeInterval is how often member latencies are measured. Defaults to 10s.
+	ProbeInterval time.Duration
+}
+
+type nearestMember struct {
+	sess    *mgo.Session
+	rtt     time.Duration // moving average of the probe round trip times
+	healthy bool
+	tags    ReadTags // the replica set tags of the member
+}
+
+// NearestRouterStats describes the routing decisions of a NearestRouter.
+type NearestRouterStats struct {
+	// RTTs is the current latency estimate of every healthy member.
+	RTTs map[string]time.Duration
+	// Routed counts the reads routed to each member.
+	Routed map[string]int64
+	// Fallbacks counts the reads that weren't routed because no healthy member matched their
+	// tag sets.
+	Fallbacks int64
+	// ProbeFailures counts failed latency probes.
+	ProbeFailures int64
+}
+
+// NearestRouter probes the latency of every replica set member periodically and routes
+// eligible reads to the member with the lowest latency. Reads are eligible when their
+// read preference mode is mgo.Nearest, either from SessionHandlerConfig.ReadPreference or
+// per query with MongoQuery.WithReadPreference, and only go to the members matching their
+// TagSets. It's meant for multi-region deployments, where mgo's own nearest selection
+// doesn't distinguish members in the next region over.
+//
+// A request's reads routed to a member share a copy of its connection, which takes one of
+// the handler's MaxConcurrentSessions.
+type NearestRouter struct {
+	cfg NearestReadsConfig
+
+	mu            sync.Mutex
+	members       map[string]*nearestMember
+	routed        map[string]int64
+	fallbacks     int64
+	probeFailures int64
+
+	stop      chan struct{}
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// NewNearestRouter starts probing the members of the replica set behind cfg.Sess. Set it as
+// SessionHandlerConfig.NearestRouter and Close it on shutdown.
+func NewNearestRouter(cfg NearestReadsConfig) *NearestRouter {
+	if cfg.ProbeInterval <= 0 {
+		cfg.ProbeInterval = 10 * time.Second
+	}
+	r := &NearestRouter{
+		cfg:     cfg,
+		members: map[string]*nearestMember{},
+		routed:  map[string]int64{},
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	go r.run()
+	return r
+}
+
+func (r *NearestRouter) run() {
+	defer close(r.done)
+	ticker := time.NewTicker(r.cfg.ProbeInterval)
+	defer ticker.Stop()
+	for {
+		r.probe()
+		select {
+		case <-ticker.C:
+		case <-r.stop:
+			return
+		}
+	}
+}
+
+// probe measures the latency of every live member, dialing new members as they appear and
+// dropping those that left the replica set.
+func (r *NearestRouter) probe() {
+	live := r.cfg.Sess.LiveServers()
+	r.prune(live)
+	for _, addr := range live {
+		r.mu.Lock()
+		m, ok := r.members[addr]
+		r.mu.Unlock()
+		if !ok {
+			info := r.cfg.DialInfo
+			info.Addrs = []string{addr}
+			info.Direct = true
+			sess, err := mgo.DialWithInfo(&info)
+			if err != nil {
+				r.probeFailed(addr, err)
+				continue
+			}
+			sess.SetMode(mgo.Nearest, true)
+			m = &nearestMember{sess: sess}
+			r.mu.Lock()
+			r.members[addr] = m
+			r.mu.Unlock()
+		}
+
+		var res struct {
+			Tags map[string]string `bson:"tags"`
+		}
+		start := time.Now()
+		err := m.sess.Run("isMaster", &res)
+		rtt := time.Since(start)
+		if err != nil {
+			r.probeFailed(addr, err)
+			m.sess.Refresh()
+			continue
+		}
+		r.mu.Lock()
+		if m.healthy {
+			m.rtt = (7*m.rtt + 3*rtt) / 10
+		} else {
+			m.rtt = rtt
+		}
+		m.healthy = true
+		m.tags = res.Tags
+		r.mu.Unlock()
+	}
+}
+
+// prune closes and forgets the members that aren't in live anymore, so reads stop going to
+// the members removed from the replica set.
+func (r *NearestRouter) prune(live []string) {
+	isLive := map[string]bool{}
+	for _, addr := range live {
+		isLive[addr] = true
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for addr, m := range r.members {
+		if !isLive[addr] {
+			m.sess.Close()
+			delete(r.members, addr)
+		}
+	}
+}
+
+func (r *NearestRouter) probeFailed(addr string, err error) {
+	r.mu.Lock()
+	r.probeFailures++
+	if m, ok := r.members[addr]; ok {
+		m.healthy = false
+	}
+	r.mu.Unlock()
+	logger.New("mgohttp").WarnD("mgohttp-nearest-probe-failed", logger.M{
+		"member": addr,
+		"error":  err.Error(),
+	})
+}
+
+// nearest picks the healthy member with the lowest latency among those matching the first
+// of tagSets that any healthy member matches. No tag sets match every member.
+func (r *NearestRouter) nearest(tagSets []ReadTags) (string, *nearestMember) {
+	if len(tagSets) == 0 {
+		tagSets = []ReadTags{{}}
+	}
+	for _, set := range tagSets {
+		bestAddr := ""
+		var best *nearestMember
+		for addr, m := range r.members {
+			if m.healthy && m.tags.carries(set) && (best == nil || m.rtt < best.rtt) {
+				bestAddr, best = addr, m
+			}
+		}
+		if best != nil {
+			return bestAddr, best
+		}
+	}
+	return "", nil
+}
+
+// member returns the session connected to the nearest member matching tagSets, or nil when
+// none is healthy and the read should go through the regular session.
+func (r *NearestRouter) member(tagSets []ReadTags) (*mgo.Session, string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	addr, m := r.nearest(tagSets)
+	if m == nil {
+		r.fallbacks++
+		return nil, ""
+	}
+	r.routed[addr]++
+	return m.sess, addr
+}
+
+// Stats returns the current latency estimates and routing counts.
+func (r *NearestRouter) Stats() NearestRouterStats {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	stats := NearestRouterStats{
+		RTTs:          map[string]time.Duration{},
+		Routed:        map[string]int64{},
+		Fallbacks:     r.fallbacks,
+		ProbeFailures: r.probeFailures,
+	}
+	for addr, m := range r.members {
+		if m.healthy {
+			stats.RTTs[addr] = m.rtt
+		}
+	}
+	for addr, n := range r.routed {
+		stats.Routed[addr] = n
+	}
+	return stats
+}
+
+// Close stops probing and closes the member connections. Later calls do nothing.
+func (r *NearestRouter) Close() {
+	r.closeOnce.Do(func() { close(r.stop) })
+	<-r.done
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, m := range r.members {
+		m.sess.Close()
+	}
+	r.members = map[string]*nearestMember{}
+}
@@ -0,0 +1,77 @@
+package mgohttp
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	mgo "gopkg.in/mgo.v2"
+)
+
+func TestNearestRouterPicksLowestLatency(t *testing.T) {
+	r := &NearestRouter{
+		members: map[string]*nearestMember{
+			"us-west-1a:27017": {rtt: 2 * time.Millisecond, healthy: true},
+			"us-east-1a:27017": {rtt: 70 * time.Millisecond, healthy: true},
+			"us-west-1b:27017": {rtt: time.Millisecond, healthy: false},
+		},
+		routed: map[string]int64{},
+	}
+	addr, _ := r.nearest(nil)
+	assert.Equal(t, "us-west-1a:27017", addr, "unhealthy members are skipped")
+
+	r.members["us-west-1a:27017"].healthy = false
+	addr, _ = r.nearest(nil)
+	assert.Equal(t, "us-east-1a:27017", addr)
+
+	r.members["us-east-1a:27017"].healthy = false
+	sess, addr := r.member(nil)
+	assert.Nil(t, sess)
+	assert.Empty(t, addr)
+	assert.Equal(t, NearestRouterStats{
+		RTTs:      map[string]time.Duration{},
+		Routed:    map[string]int64{},
+		Fallbacks: 1,
+	}, r.Stats())
+}
+
+func TestNearestRouterTagSets(t *testing.T) {
+	r := &NearestRouter{
+		members: map[string]*nearestMember{
+			"us-west-1a:27017": {rtt: 2 * time.Millisecond, healthy: true, tags: ReadTags{"use": "serving"}},
+			"us-east-1a:27017": {rtt: 70 * time.Millisecond, healthy: true, tags: ReadTags{"use": "reporting"}},
+			"us-east-1b:27017": {rtt: time.Millisecond, healthy: false, tags: ReadTags{"use": "reporting"}},
+		},
+		routed: map[string]int64{},
+	}
+	addr, _ := r.nearest([]ReadTags{{"use": "reporting"}})
+	assert.Equal(t, "us-east-1a:27017", addr, "the nearest of the members matching the tags")
+	addr, _ = r.nearest([]ReadTags{{"use": "analytics"}, {}})
+	assert.Equal(t, "us-west-1a:27017", addr, "the next tag set is tried when none matches")
+	addr, _ = r.nearest([]ReadTags{{"use": "analytics"}})
+	assert.Empty(t, addr)
+}
+
+func TestNearestRouterPrune(t *testing.T) {
+	r := &NearestRouter{
+		members: map[string]*nearestMember{
+			"a:27017": {sess: &mgo.Session{}, rtt: time.Millisecond, healthy: true},
+			"b:27017": {sess: &mgo.Session{}, rtt: 2 * time.Millisecond, healthy: true},
+		},
+		routed: map[string]int64{},
+	}
+	r.prune([]string{"b:27017"})
+	addr, _ := r.nearest(nil)
+	assert.Equal(t, "b:27017", addr, "members removed from the replica set aren't read from")
+	assert.Len(t, r.members, 1)
+}
+
+func TestNearestRouterCloseTwice(t *testing.T) {
+	r := &NearestRouter{members: map[string]*nearestMember{}, stop: make(chan struct{}), done: make(chan struct{})}
+	go func() {
+		<-r.stop
+		close(r.done)
+	}()
+	r.Close()
+	assert.NotPanics(t, r.Close)
+}
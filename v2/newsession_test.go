@@ -0,0 +1,62 @@
+package mgohttp
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	mgo "gopkg.in/mgo.v2"
+	bson "gopkg.in/mgo.v2/bson"
+)
+
+type tenantKeyType struct{}
+
+func TestNewSession(t *testing.T) {
+	var tenants []interface{}
+	handler := NewSessionHandler(SessionHandlerConfig{
+		Database: testDBName,
+		Timeout:  handlerTimeout,
+		NewSession: func(ctx context.Context) (*mgo.Session, error) {
+			tenants = append(tenants, ctx.Value(tenantKeyType{}))
+			return &mgo.Session{}, nil
+		},
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			FromContext(r.Context(), testDBName)
+			FromContext(r.Context(), testDBName)
+		}),
+	})
+	r := httptest.NewRequest("GET", "/", nil)
+	r = r.WithContext(context.WithValue(r.Context(), tenantKeyType{}, "acme"))
+	handler.ServeHTTP(httptest.NewRecorder(), r)
+	// the session is created once per request, with the request's context
+	assert.Equal(t, []interface{}{"acme"}, tenants)
+}
+
+func TestNewSessionError(t *testing.T) {
+	errNoCredentials := errors.New("no credentials for tenant")
+	calls := 0
+	var opErr, secondErr error
+	handler := NewSessionHandler(SessionHandlerConfig{
+		Database: testDBName,
+		Timeout:  handlerTimeout,
+		NewSession: func(ctx context.Context) (*mgo.Session, error) {
+			calls++
+			return nil, errNoCredentials
+		},
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			c := FromContext(r.Context(), testDBName).DB(testDBName).C("users")
+			opErr = c.Find(bson.M{}).One(&bson.M{})
+			secondErr = FromContext(r.Context(), testDBName).Ping()
+			w.WriteHeader(http.StatusTeapot)
+		}),
+	})
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+	assert.Equal(t, http.StatusTeapot, rec.Code)
+	assert.True(t, errors.Is(opErr, errNoCredentials))
+	assert.True(t, errors.Is(secondErr, errNoCredentials))
+	assert.Equal(t, 1, calls)
+}
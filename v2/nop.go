@@ -0,0 +1,132 @@
+package mgohttp
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	mgo "gopkg.in/mgo.v2"
+	bson "gopkg.in/mgo.v2/bson"
+)
+
+// ErrNopSession is returned by every operation of the NopSession.
+var ErrNopSession = errors.New("mgohttp: no-op session")
+
+// NopSession returns a MongoSession that never touches a database: databases, collections
+// and queries can be derived from it as usual, but every operation fails with ErrNopSession.
+// It's meant for optional database dependencies, code paths that are disabled by a feature
+// flag, and tests that assert no database access happens.
+func NopSession() MongoSession {
+	return failedSession{err: ErrNopSession}
+}
+
+// failedSession is a session on which every operation fails with err, without touching a
+// database. It stands in for the request session when it can't be created.
+type failedSession struct {
+	err error
+}
+
+func (f failedSession) DB(name string) MongoDatabase { return failedDatabase{err: f.err} }
+func (f failedSession) Ping() error                  { return f.err }
+func (f failedSession) PingWithInfo(ctx context.Context) (PingInfo, error) {
+	return PingInfo{}, f.err
+}
+func (f failedSession) ServerVersion(ctx context.Context) (mgo.BuildInfo, error) {
+	return mgo.BuildInfo{}, f.err
+}
+func (f failedSession) SetSafe(safe *mgo.Safe)                   {}
+func (f failedSession) WithTimeout(d time.Duration) MongoSession { return f }
+func (f failedSession) WithTransaction(ctx context.Context, fn func(tx MongoSession) error) error {
+	return f.err
+}
+
+type failedDatabase struct {
+	err error
+}
+
+func (f failedDatabase) C(collection string) MongoCollection           { return failedCollection{err: f.err} }
+func (f failedDatabase) Run(cmd interface{}, result interface{}) error { return f.err }
+func (f failedDatabase) GridFS(prefix string) MongoGridFS              { return failedGridFS{err: f.err} }
+func (f failedDatabase) CollectionNames() ([]string, error)            { return nil, f.err }
+func (f failedDatabase) DropDatabase() error                           { return f.err }
+func (f failedDatabase) Watch(pipeline interface{}, opts ChangeStreamOptions) ChangeStream {
+	return failedChangeStream{err: f.err}
+}
+
+type failedCollection struct {
+	err error
+}
+
+func (f failedCollection) Find(query interface{}) MongoQuery {
+	return failedMongoQuery{err: f.err}
+}
+func (f failedCollection) FindId(id bson.ObjectId) MongoQuery {
+	return failedMongoQuery{err: f.err}
+}
+func (f failedCollection) Insert(docs ...interface{}) error  { return f.err }
+func (f failedCollection) Remove(selector interface{}) error { return f.err }
+func (f failedCollection) RemoveId(id bson.ObjectId) error   { return f.err }
+func (f failedCollection) RemoveAll(selector interface{}) (*mgo.ChangeInfo, error) {
+	return nil, f.err
+}
+func (f failedCollection) Update(selector interface{}, update interface{}) error { return f.err }
+func (f failedCollection) UpdateId(id bson.ObjectId, update interface{}) error   { return f.err }
+func (f failedCollection) UpdateAll(selector interface{}, update interface{}) (*mgo.ChangeInfo, error) {
+	return nil, f.err
+}
+func (f failedCollection) Upsert(selector interface{}, update interface{}) (*mgo.ChangeInfo, error) {
+	return nil, f.err
+}
+func (f failedCollection) Bulk() MongoBulk                       { return failedBulk{err: f.err} }
+func (f failedCollection) EnsureIndex(index mgo.Index) error     { return f.err }
+func (f failedCollection) EnsureIndexKey(key ...string) error    { return f.err }
+func (f failedCollection) DropIndex(key ...string) error         { return f.err }
+func (f failedCollection) DropIndexName(name string) error       { return f.err }
+func (f failedCollection) Indexes() ([]mgo.Index, error)         { return nil, f.err }
+func (f failedCollection) DropCollection() error                 { return f.err }
+func (f failedCollection) Create(info *mgo.CollectionInfo) error { return f.err }
+func (f failedCollection) Stats() (CollectionStats, error)       { return CollectionStats{}, f.err }
+func (f failedCollection) Watch(pipeline interface{}, opts ChangeStreamOptions) ChangeStream {
+	return failedChangeStream{err: f.err}
+}
+func (f failedCollection) WithWriteConcern(safe *mgo.Safe) MongoCollection {
+	return f
+}
+func (f failedCollection) Pipe(pipeline interface{}) MongoPipe { return failedPipe{err: f.err} }
+
+type failedPipe struct {
+	err error
+}
+
+func (f failedPipe) All(result interface{}) error     { return f.err }
+func (f failedPipe) One(result interface{}) error     { return f.err }
+func (f failedPipe) Iter() MongoIter                  { return failedMongoIter{err: f.err} }
+func (f failedPipe) Explain(result interface{}) error { return f.err }
+func (f failedPipe) AllowDiskUse() MongoPipe          { return f }
+func (f failedPipe) Batch(n int) MongoPipe            { return f }
+
+type failedBulk struct {
+	err error
+}
+
+func (f failedBulk) Insert(docs ...interface{})         {}
+func (f failedBulk) Update(pairs ...interface{})        {}
+func (f failedBulk) UpdateAll(pairs ...interface{})     {}
+func (f failedBulk) Upsert(pairs ...interface{})        {}
+func (f failedBulk) Remove(selectors ...interface{})    {}
+func (f failedBulk) RemoveAll(selectors ...interface{}) {}
+func (f failedBulk) Unordered()                         {}
+func (f failedBulk) Run() (*mgo.BulkResult, error)      { return nil, f.err }
+
+type failedGridFS struct {
+	err error
+}
+
+func (f failedGridFS) Create(name string) (MongoGridFile, error)    { return nil, f.err }
+func (f failedGridFS) Open(name string) (MongoGridFile, error)      { return nil, f.err }
+func (f failedGridFS) OpenId(id interface{}) (MongoGridFile, error) { return nil, f.err }
+func (f failedGridFS) Remove(name string) error                     { return f.err }
+func (f failedGridFS) RemoveId(id interface{}) error                { return f.err }
+func (f failedGridFS) Find(query interface{}) MongoQuery {
+	return failedMongoQuery{err: f.err}
+}
@@ -0,0 +1,24 @@
+package mgohttp
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	bson "gopkg.in/mgo.v2/bson"
+)
+
+func TestNopSession(t *testing.T) {
+	c := NopSession().DB(testDBName).C("users")
+	var docs []bson.M
+	assert.Equal(t, ErrNopSession, c.Find(bson.M{"a": 1}).Sort("a").Limit(1).All(&docs))
+	assert.Equal(t, ErrNopSession, c.Insert(bson.M{"a": 1}))
+
+	iter := c.Find(nil).Iter()
+	assert.False(t, iter.Next(&docs))
+	assert.Equal(t, ErrNopSession, iter.Close())
+
+	bulk := c.Bulk()
+	bulk.Insert(bson.M{"a": 1})
+	_, err := bulk.Run()
+	assert.Equal(t, ErrNopSession, err)
+}
@@ -0,0 +1,111 @@
+package mgohttp
+
+import (
+	"context"
+	"time"
+
+	opentracing "github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/ext"
+	"gopkg.in/Clever/kayvee-go.v6/logger"
+	mgo "gopkg.in/mgo.v2"
+)
+
+// opSpan is the span of a single Mongo operation. It embeds the opentracing.Span so it's
+// tagged and logged as usual, and additionally records the outcome of the operation with the
+// SessionHandler that issued the session once it's done.
+type opSpan struct {
+	opentracing.Span
+	ctx        context.Context
+	name       string
+	collection string
+	start      time.Time
+	// spec is the query run by the operation, if it's a query, for ExplainSlowQueries.
+	spec *querySpec
+	// fingerprint identifies the shape of the operation, see QueryFingerprint.
+	fingerprint string
+	// sess is the session the operation runs on, see withOpSession.
+	sess *mgo.Session
+}
+
+// startOp starts the span of a Mongo operation. collection is empty for database and session
+// level operations.
+func startOp(ctx context.Context, name, collection string) (*opSpan, context.Context) {
+	sp, ctx := startSpan(ctx, name)
+	if collection != "" {
+		sp.SetTag(TagCollection, collection)
+	}
+	setSemanticTags(sp, ctx, name, collection)
+	for k, v := range queryTags(ctx) {
+		sp.SetTag(k, v)
+	}
+	o := &opSpan{
+		Span:       sp,
+		ctx:        ctx,
+		name:       name,
+		collection: collection,
+		start:      time.Now(),
+	}
+	o.sess, _ = ctx.Value(opSessionKey).(*mgo.Session)
+	if collection != "" {
+		// operations with a selector replace it with logSelector
+		o.fingerprint = QueryFingerprint(name, collection, nil)
+		sp.SetTag(TagQueryFingerprint, o.fingerprint)
+	}
+	ext.DBStatement.Set(sp, dbStatement(name, collection, ""))
+	return o, ctx
+}
+
+// done records the outcome of the operation that reached Mongo, returning err wrapped in an
+// OpError so it can be used inline like logAndReturnErr.
+func (o *opSpan) done(err error) error {
+	err = abortedErr(o.ctx, err)
+	logAndReturnErr(o.Span, err)
+	h := handlerFromContext(o.ctx)
+	if h == nil {
+		return withFingerprint(wrapOpErr(o.ctx, o.name, o.collection, err), o.fingerprint)
+	}
+	elapsed := time.Since(o.start)
+	if isHealthError(err) {
+		markSessionFailed(o.ctx)
+	}
+	if h.cfg.RefreshOnSocketErrors {
+		o.refreshAfterSocketError(err)
+	}
+	if p, ok := h.parentSession.(*dialedParent); ok && h.usesParent(handlerDatabaseFromContext(o.ctx)) {
+		p.observe(err)
+	}
+	h.cfg.Metrics.observeOp(o.collection, o.name, elapsed)
+	observeStats(o.ctx, o.collection, o.name, elapsed)
+	if h.cfg.HealthMonitor != nil {
+		h.cfg.HealthMonitor.Observe(elapsed, err)
+	}
+	debug := debugging(o.ctx)
+	slow := h.cfg.SlowQueryThreshold > 0 && elapsed > h.cfg.SlowQueryThreshold
+	explain := debug || (slow && h.cfg.ExplainSlowQueries && rolledOut(o.ctx, RolloutExplainSlowQueries))
+	if explain && o.spec != nil && err == nil {
+		o.explainSlow()
+	}
+	if slow {
+		o.logSlow(elapsed)
+	}
+	if debug {
+		o.logDebug(elapsed, err)
+	}
+	return withFingerprint(wrapOpErr(o.ctx, o.name, o.collection, err), o.fingerprint)
+}
+
+// logSlow logs the operation as a slow query, along with the request's query tags.
+func (o *opSpan) logSlow(elapsed time.Duration) {
+	data := logger.M{
+		"op":          o.name,
+		"collection":  o.collection,
+		"duration-ms": elapsed.Milliseconds(),
+	}
+	if o.fingerprint != "" {
+		data["fingerprint"] = o.fingerprint
+	}
+	for k, v := range queryTags(o.ctx) {
+		data[k] = v
+	}
+	logger.FromContext(o.ctx).WarnD("mgohttp-slow-query", data)
+}
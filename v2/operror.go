@@ -0,0 +1,75 @@
+package mgohttp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// OpError wraps the errors returned by Mongo operations with the operation, database and
+// collection, so they're actionable in logs, e.g. "find app.users: no reachable servers".
+// errors.Is and errors.As see through it, so errors.Is(err, mgo.ErrNotFound) keeps working.
+// mgo.IsDup doesn't unwrap errors: use IsDuplicateKey instead.
+type OpError struct {
+	// Op is the operation, e.g. "find" or "update".
+	Op         string
+	Database   string
+	Collection string
+	Err        error
+	// Fingerprint identifies the shape of the operation, see QueryFingerprint, so the errors
+	// of the same query can be grouped. It's empty for the operations without a collection.
+	Fingerprint string
+}
+
+func (e OpError) Error() string {
+	target := e.Collection
+	if e.Database != "" && e.Collection != "" {
+		target = e.Database + "." + e.Collection
+	} else if e.Database != "" {
+		target = e.Database
+	}
+	if target == "" {
+		return fmt.Sprintf("%s: %s", e.Op, e.Err)
+	}
+	return fmt.Sprintf("%s %s: %s", e.Op, target, e.Err)
+}
+
+// Unwrap returns the error of the driver.
+func (e OpError) Unwrap() error {
+	return e.Err
+}
+
+type databaseKeyType struct{}
+
+// databaseKey is used to hand the name of the database down to the operations, for OpError.
+var databaseKey = databaseKeyType{}
+
+func databaseFromContext(ctx context.Context) string {
+	name, _ := ctx.Value(databaseKey).(string)
+	return name
+}
+
+type handlerDatabaseKeyType struct{}
+
+// handlerDatabaseKey is the handler's database the request's session was got for, which
+// may differ from the database of the operations, see MongoSession.DB.
+var handlerDatabaseKey = handlerDatabaseKeyType{}
+
+func handlerDatabaseFromContext(ctx context.Context) string {
+	name, _ := ctx.Value(handlerDatabaseKey).(string)
+	return name
+}
+
+// wrapOpErr wraps err, if any, in an OpError. Errors that are already wrapped are returned
+// as is.
+func wrapOpErr(ctx context.Context, op, collection string, err error) error {
+	if err == nil || errors.As(err, &OpError{}) {
+		return err
+	}
+	return OpError{
+		Op:         op,
+		Database:   databaseFromContext(ctx),
+		Collection: collection,
+		Err:        err,
+	}
+}
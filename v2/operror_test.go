@@ -0,0 +1,32 @@
+package mgohttp
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	mgo "gopkg.in/mgo.v2"
+)
+
+func TestWrapOpErr(t *testing.T) {
+	ctx := context.WithValue(context.Background(), databaseKey, "app")
+
+	err := wrapOpErr(ctx, "find", "users", mgo.ErrNotFound)
+	assert.EqualError(t, err, "find app.users: not found")
+	assert.True(t, errors.Is(err, mgo.ErrNotFound))
+
+	qerr := &mgo.QueryError{Code: 50, Message: "operation exceeded time limit"}
+	err = wrapOpErr(ctx, "count", "users", qerr)
+	var target *mgo.QueryError
+	assert.True(t, errors.As(err, &target))
+	assert.Equal(t, 50, target.Code)
+
+	// already wrapped errors are left alone
+	assert.Equal(t, err, wrapOpErr(ctx, "iter", "users", err))
+
+	assert.EqualError(t, wrapOpErr(ctx, "run", "", errors.New("unauthorized")), "run app: unauthorized")
+	assert.EqualError(t, wrapOpErr(context.Background(), "ping", "", errors.New("no reachable servers")),
+		"ping: no reachable servers")
+	assert.NoError(t, wrapOpErr(ctx, "find", "users", nil))
+}
@@ -0,0 +1,134 @@
+package mgohttp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	bson "gopkg.in/mgo.v2/bson"
+)
+
+// ErrOpLimited is the sentinel wrapped by every OpLimitError.
+var ErrOpLimited = errors.New("too many concurrent operations")
+
+// OpLimitError is returned by an operation the OpLimiter rejected because as many are
+// already running. DefaultErrorMapper maps it to 503.
+type OpLimitError struct {
+	Op         string
+	Collection string
+}
+
+func (e OpLimitError) Error() string {
+	return fmt.Sprintf("mgohttp: %s %s: %s", e.Op, e.Collection, ErrOpLimited)
+}
+
+// Unwrap allows errors.Is(err, ErrOpLimited).
+func (e OpLimitError) Unwrap() error {
+	return ErrOpLimited
+}
+
+// OpLimit caps the concurrent executions of an expensive operation.
+type OpLimit struct {
+	// Op is the operation: "find" for the queries run with All, One, Count, Apply or Iter, or
+	// the name of a command run with MongoDatabase.Run, e.g. "aggregate".
+	Op string
+	// Collection the limit applies to, every collection when empty. For commands, it's the
+	// value of the command, e.g. bson.D{{"aggregate", "events"}, ...}.
+	Collection string
+	// Max is the number of operations that may run at once.
+	Max int
+}
+
+// OpLimiterConfig configures an OpLimiter.
+type OpLimiterConfig struct {
+	Limits []OpLimit
+	// MaxWait is how long an operation over its limit waits for another one to finish,
+	// bounded by the request. It's rejected right away when zero.
+	MaxWait time.Duration
+}
+
+// OpLimiter caps the concurrent executions of designated expensive operations across the
+// handlers it's set on, see SessionHandlerConfig.OpLimiter, protecting Mongo from thundering
+// herds such as the one following a cache expiry.
+type OpLimiter struct {
+	maxWait time.Duration
+	limits  []OpLimit
+	slots   []chan struct{}
+}
+
+// NewOpLimiter returns an OpLimiter enforcing cfg.
+func NewOpLimiter(cfg OpLimiterConfig) *OpLimiter {
+	l := &OpLimiter{maxWait: cfg.MaxWait, limits: cfg.Limits}
+	for _, limit := range cfg.Limits {
+		l.slots = append(l.slots, make(chan struct{}, limit.Max))
+	}
+	return l
+}
+
+// acquire takes a slot for the operation, if it's limited, and returns the function that
+// gives it back. The first matching limit applies.
+func (l *OpLimiter) acquire(ctx context.Context, op, collection string) (func(), error) {
+	if l == nil {
+		return func() {}, nil
+	}
+	for i, limit := range l.limits {
+		if limit.Op != op || (limit.Collection != "" && limit.Collection != collection) {
+			continue
+		}
+		slots := l.slots[i]
+		release := func() { <-slots }
+		select {
+		case slots <- struct{}{}:
+			return release, nil
+		default:
+		}
+		if l.maxWait > 0 {
+			timer := time.NewTimer(l.maxWait)
+			defer timer.Stop()
+			select {
+			case slots <- struct{}{}:
+				return release, nil
+			case <-timer.C:
+			case <-ctx.Done():
+			}
+		}
+		return nil, OpLimitError{Op: op, Collection: collection}
+	}
+	return func() {}, nil
+}
+
+// limit takes a slot of the handler's OpLimiter for the operation, op on collection.
+func (o *opSpan) limit(op, collection string) (func(), error) {
+	h := handlerFromContext(o.ctx)
+	if h == nil {
+		return func() {}, nil
+	}
+	release, err := h.cfg.OpLimiter.acquire(o.ctx, op, collection)
+	if err != nil {
+		o.SetTag(TagOpLimited, true)
+	}
+	return release, err
+}
+
+// commandTarget returns the name of cmd and its value when it's a string, usually the
+// collection the command runs on.
+func commandTarget(cmd interface{}) (name, collection string) {
+	switch c := cmd.(type) {
+	case string:
+		return c, ""
+	case bson.D:
+		if len(c) > 0 {
+			collection, _ := c[0].Value.(string)
+			return c[0].Name, collection
+		}
+	case bson.M:
+		if len(c) == 1 {
+			for k, v := range c {
+				collection, _ := v.(string)
+				return k, collection
+			}
+		}
+	}
+	return "", ""
+}
@@ -0,0 +1,137 @@
+package mgohttp
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	opentracing "github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/mocktracer"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	mgo "gopkg.in/mgo.v2"
+	bson "gopkg.in/mgo.v2/bson"
+)
+
+func TestOpLimiter(t *testing.T) {
+	l := NewOpLimiter(OpLimiterConfig{Limits: []OpLimit{
+		{Op: "aggregate", Collection: "events", Max: 1},
+		{Op: "find", Max: 2},
+	}})
+	ctx := context.Background()
+
+	release, err := l.acquire(ctx, "aggregate", "events")
+	require.NoError(t, err)
+	_, err = l.acquire(ctx, "aggregate", "events")
+	assert.Equal(t, OpLimitError{Op: "aggregate", Collection: "events"}, err)
+	assert.True(t, errors.Is(err, ErrOpLimited))
+	_, err = l.acquire(ctx, "aggregate", "users")
+	assert.NoError(t, err, "users isn't limited")
+	release()
+	release, err = l.acquire(ctx, "aggregate", "events")
+	require.NoError(t, err)
+	release()
+
+	// the find limit applies to every collection
+	_, err = l.acquire(ctx, "find", "users")
+	require.NoError(t, err)
+	_, err = l.acquire(ctx, "find", "events")
+	require.NoError(t, err)
+	_, err = l.acquire(ctx, "find", "orgs")
+	assert.True(t, errors.Is(err, ErrOpLimited))
+
+	var nilLimiter *OpLimiter
+	_, err = nilLimiter.acquire(ctx, "find", "users")
+	assert.NoError(t, err)
+}
+
+func TestOpLimiterWaits(t *testing.T) {
+	l := NewOpLimiter(OpLimiterConfig{Limits: []OpLimit{{Op: "find", Max: 1}}, MaxWait: time.Second})
+	release, err := l.acquire(context.Background(), "find", "users")
+	require.NoError(t, err)
+	time.AfterFunc(10*time.Millisecond, release)
+	release, err = l.acquire(context.Background(), "find", "users")
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err = l.acquire(ctx, "find", "users")
+	assert.True(t, errors.Is(err, ErrOpLimited), "the wait is bounded by the request")
+	release()
+}
+
+func TestOpLimiterOperations(t *testing.T) {
+	h := &SessionHandler{cfg: SessionHandlerConfig{OpLimiter: NewOpLimiter(OpLimiterConfig{Limits: []OpLimit{
+		{Op: "find", Collection: "events", Max: 0},
+		{Op: "aggregate", Collection: "events", Max: 0},
+	}})}}
+	ctx := context.WithValue(context.Background(), handlerKey, h)
+	// the session isn't connected, the operations must be rejected before they reach it
+	db := tracedMgoDatabase{db: &mgo.Database{Name: testDBName, Session: &mgo.Session{}}, ctx: ctx}
+
+	err := db.C("events").Find(nil).One(&bson.M{})
+	assert.True(t, errors.Is(err, ErrOpLimited))
+	_, err = db.C("events").Find(nil).Count()
+	assert.True(t, errors.Is(err, ErrOpLimited))
+	assert.True(t, errors.Is(db.C("events").Find(nil).Iter().Close(), ErrOpLimited))
+	err = db.Run(bson.D{{Name: "aggregate", Value: "events"}, {Name: "pipeline", Value: []bson.M{}}}, nil)
+	assert.True(t, errors.Is(err, ErrOpLimited))
+}
+
+func TestOpLimiterIterAll(t *testing.T) {
+	l := NewOpLimiter(OpLimiterConfig{Limits: []OpLimit{{Op: "find", Collection: "events", Max: 1}}})
+	tracer := mocktracer.New()
+	// a cursor holding a single document, read without a server
+	sess := &mgo.Session{}
+	sess.SetMode(mgo.Strong, false)
+	doc, err := bson.Marshal(bson.M{"n": 1})
+	require.NoError(t, err)
+	collection := &mgo.Collection{Name: "events", FullName: testDBName + ".events", Database: &mgo.Database{Name: testDBName, Session: sess}}
+	iter := func(release func()) tracedMongoIter {
+		ctx := opentracing.ContextWithSpan(context.Background(), tracer.StartSpan("iter"))
+		return tracedMongoIter{
+			i:          collection.NewIter(nil, []bson.Raw{{Kind: 0x03, Data: doc}}, 0, nil),
+			ctx:        ctx,
+			collection: "events",
+			release:    sync.OnceFunc(release),
+			ended:      new(sync.Once),
+		}
+	}
+
+	for i := 0; i < 3; i++ {
+		release, err := l.acquire(context.Background(), "find", "events")
+		require.NoError(t, err, "All gave back the slot of the previous cursor")
+		var docs []bson.M
+		iter(release).All(&docs)
+		assert.Len(t, docs, 1)
+	}
+
+	released := 0
+	it := iter(func() { released++ })
+	it.All(&[]bson.M{})
+	it.Close()
+	assert.Equal(t, 1, released, "a Close after All doesn't release the cursor again")
+
+	released = 0
+	it = iter(func() { released++ })
+	for it.Next(&bson.M{}) {
+	}
+	assert.Equal(t, 1, released, "the last Next releases the cursor")
+	it.Close()
+	assert.Equal(t, 1, released)
+
+	assert.Len(t, tracer.FinishedSpans(), 5, "each iter span is finished once")
+}
+
+func TestCommandTarget(t *testing.T) {
+	name, collection := commandTarget(bson.D{{Name: "aggregate", Value: "events"}})
+	assert.Equal(t, "aggregate", name)
+	assert.Equal(t, "events", collection)
+	name, collection = commandTarget("ping")
+	assert.Equal(t, "ping", name)
+	assert.Equal(t, "", collection)
+	name, _ = commandTarget(bson.M{"count": "users"})
+	assert.Equal(t, "count", name)
+}
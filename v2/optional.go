@@ -0,0 +1,49 @@
+package mgohttp
+
+import (
+	"context"
+
+	opentracing "github.com/opentracing/opentracing-go"
+)
+
+// Optional runs fn, a nice-to-have lookup such as an enrichment, on the request's Database
+// only when it isn't likely to hurt the request, and reports whether it ran and succeeded.
+// It's skipped while the HealthMonitor reports Mongo as degraded, and when the request's
+// budget expired or has less than SessionHandlerConfig.OptionalMinBudget left. Callers can
+// then leave out what they couldn't look up rather than fail the request:
+//
+//	var org Org
+//	if !mgohttp.Optional(ctx, func(db mgohttp.MongoDatabase) error {
+//		return db.C("orgs").FindId(user.OrgID).One(&org)
+//	}) {
+//		org = Org{ID: user.OrgID}
+//	}
+//
+// It returns false outside of a SessionHandler.
+func Optional(ctx context.Context, fn func(db MongoDatabase) error) bool {
+	h := handlerFromContext(ctx)
+	if h == nil {
+		return false
+	}
+	if reason := h.skipOptional(ctx); reason != "" {
+		logDecision(opentracing.SpanFromContext(ctx), DecisionOptionalSkipped, reason)
+		return false
+	}
+	return fn(FromContext(ctx, h.cfg.Database).DB(h.cfg.Database)) == nil
+}
+
+// skipOptional returns why Optional should skip its query, if it should.
+func (c *SessionHandler) skipOptional(ctx context.Context) string {
+	if c.cfg.HealthMonitor != nil && c.cfg.HealthMonitor.Degraded() {
+		return "degraded"
+	}
+	if BudgetExpired(ctx) {
+		return "budget-expired"
+	}
+	if b, ok := ctx.Value(budgetKey).(*requestBudget); ok {
+		if remaining, started := b.remaining(); started && remaining < c.cfg.OptionalMinBudget {
+			return "budget-low"
+		}
+	}
+	return ""
+}
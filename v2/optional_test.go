@@ -0,0 +1,73 @@
+package mgohttp
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	opentracing "github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/mocktracer"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	mgo "gopkg.in/mgo.v2"
+)
+
+func TestOptional(t *testing.T) {
+	assert.False(t, Optional(context.Background(), func(db MongoDatabase) error {
+		t.Fatal("Optional ran outside of a SessionHandler")
+		return nil
+	}))
+
+	monitor := NewHealthMonitor(HealthMonitorConfig{MinSamples: 1})
+	serve := func(cfg SessionHandlerConfig, fn func(db MongoDatabase) error) (ran, ok bool) {
+		cfg.Database = testDBName
+		cfg.Timeout = handlerTimeout
+		cfg.NewSession = func(ctx context.Context) (*mgo.Session, error) { return &mgo.Session{}, nil }
+		cfg.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ok = Optional(r.Context(), func(db MongoDatabase) error {
+				ran = true
+				return fn(db)
+			})
+		})
+		NewSessionHandler(cfg).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+		return ran, ok
+	}
+
+	ran, ok := serve(SessionHandlerConfig{HealthMonitor: monitor}, func(db MongoDatabase) error {
+		assert.Equal(t, testDBName, db.(tracedMgoDatabase).db.Name)
+		return nil
+	})
+	assert.True(t, ran)
+	assert.True(t, ok)
+
+	ran, ok = serve(SessionHandlerConfig{}, func(db MongoDatabase) error { return mgo.ErrNotFound })
+	assert.True(t, ran)
+	assert.False(t, ok)
+
+	ran, _ = serve(SessionHandlerConfig{OptionalMinBudget: time.Minute}, func(db MongoDatabase) error { return nil })
+	assert.False(t, ran, "the request has less than OptionalMinBudget left")
+
+	monitor.Observe(time.Millisecond, errors.New("no reachable servers"))
+	ran, _ = serve(SessionHandlerConfig{HealthMonitor: monitor}, func(db MongoDatabase) error { return nil })
+	assert.False(t, ran, "Mongo is degraded")
+}
+
+func TestOptionalLogsDecision(t *testing.T) {
+	tracer := mocktracer.New()
+	sp := tracer.StartSpan("request")
+	h := &SessionHandler{cfg: SessionHandlerConfig{OptionalMinBudget: time.Minute}}
+	budget := &requestBudget{}
+	budget.deadline.Store(time.Now().Add(time.Second).UnixNano())
+	ctx := context.WithValue(context.Background(), handlerKey, h)
+	ctx = context.WithValue(ctx, budgetKey, budget)
+
+	assert.False(t, Optional(opentracing.ContextWithSpan(ctx, sp), func(db MongoDatabase) error { return nil }))
+	sp.Finish()
+	logs := tracer.FinishedSpans()[0].Logs()
+	require.Len(t, logs, 1)
+	assert.Equal(t, DecisionOptionalSkipped, logs[0].Fields[0].ValueString)
+	assert.Equal(t, "budget-low", logs[0].Fields[1].ValueString)
+}
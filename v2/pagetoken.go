@@ -0,0 +1,134 @@
+package mgohttp
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	bson "gopkg.in/mgo.v2/bson"
+)
+
+// ErrInvalidPageToken is the sentinel wrapped by every InvalidPageTokenError.
+var ErrInvalidPageToken = errors.New("invalid page token")
+
+// InvalidPageTokenError is returned by PageTokenSigner.Decode for a token it didn't sign, that
+// was tampered with, or that belongs to another query.
+type InvalidPageTokenError struct {
+	Reason string
+}
+
+func (e InvalidPageTokenError) Error() string {
+	return fmt.Sprintf("mgohttp: %s: %s", ErrInvalidPageToken, e.Reason)
+}
+
+// Unwrap allows errors.Is(err, ErrInvalidPageToken).
+func (e InvalidPageTokenError) Unwrap() error {
+	return ErrInvalidPageToken
+}
+
+// PageToken is the position of a page in the results of a query sorted on a field and _id:
+// the values of the last document of the previous page.
+type PageToken struct {
+	// SortKey is the value of the sort field, nil when the query is only sorted on _id.
+	SortKey interface{}
+	ID      interface{}
+	// Fingerprint identifies the query the token belongs to, e.g. its QueryFingerprint, so a
+	// token can't be replayed against another query.
+	Fingerprint string
+}
+
+// Selector returns the selector of the documents after the token in the order of the sort
+// field, or of _id only when field is empty, to add to the query's selector with $and.
+func (t PageToken) Selector(field string, descending bool) bson.M {
+	op := "$gt"
+	if descending {
+		op = "$lt"
+	}
+	if field == "" || field == "_id" {
+		return bson.M{"_id": bson.M{op: t.ID}}
+	}
+	return bson.M{"$or": []bson.M{
+		{field: bson.M{op: t.SortKey}},
+		{field: t.SortKey, "_id": bson.M{op: t.ID}},
+	}}
+}
+
+// pageTokenDoc is the signed payload of a token, BSON so the sort keys and ids keep their
+// types, e.g. ObjectIds and dates.
+type pageTokenDoc struct {
+	SortKey     interface{} `bson:"k,omitempty"`
+	ID          interface{} `bson:"i"`
+	Fingerprint string      `bson:"f,omitempty"`
+}
+
+// PageTokenSigner encodes PageTokens into opaque strings signed with HMAC-SHA256, and decodes
+// only the strings it signed. Encoding the same position always gives the same string, so a
+// retried request hands out the same token.
+type PageTokenSigner struct {
+	// keys are the key signing the tokens, then the previous ones still accepted
+	keys [][]byte
+}
+
+// NewPageTokenSigner returns a PageTokenSigner signing with key. The tokens signed with the
+// previous keys are still accepted, to rotate keys without breaking the cursors of the
+// clients.
+func NewPageTokenSigner(key []byte, previous ...[]byte) *PageTokenSigner {
+	return &PageTokenSigner{keys: append([][]byte{key}, previous...)}
+}
+
+// Encode returns the signed token of t, safe to use in URLs.
+func (s *PageTokenSigner) Encode(t PageToken) (string, error) {
+	payload, err := bson.Marshal(pageTokenDoc{SortKey: t.SortKey, ID: t.ID, Fingerprint: t.Fingerprint})
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(payload) + "." +
+		base64.RawURLEncoding.EncodeToString(sign(s.keys[0], payload)), nil
+}
+
+// Decode returns the PageToken of token, checking its signature and that it belongs to the
+// query identified by fingerprint. It returns an InvalidPageTokenError otherwise.
+func (s *PageTokenSigner) Decode(token, fingerprint string) (PageToken, error) {
+	encoded, encodedSig, ok := strings.Cut(token, ".")
+	if !ok {
+		return PageToken{}, InvalidPageTokenError{Reason: "malformed"}
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return PageToken{}, InvalidPageTokenError{Reason: "malformed"}
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(encodedSig)
+	if err != nil {
+		return PageToken{}, InvalidPageTokenError{Reason: "malformed"}
+	}
+	if !s.verify(payload, sig) {
+		return PageToken{}, InvalidPageTokenError{Reason: "bad signature"}
+	}
+	var doc pageTokenDoc
+	if err := bson.Unmarshal(payload, &doc); err != nil {
+		return PageToken{}, InvalidPageTokenError{Reason: "malformed"}
+	}
+	if doc.Fingerprint != fingerprint {
+		return PageToken{}, InvalidPageTokenError{Reason: "issued for another query"}
+	}
+	return PageToken{SortKey: doc.SortKey, ID: doc.ID, Fingerprint: doc.Fingerprint}, nil
+}
+
+// verify reports whether sig is the signature of payload with any of the keys.
+func (s *PageTokenSigner) verify(payload, sig []byte) bool {
+	for _, key := range s.keys {
+		if hmac.Equal(sig, sign(key, payload)) {
+			return true
+		}
+	}
+	return false
+}
+
+func sign(key, payload []byte) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write(payload)
+	return mac.Sum(nil)
+}
@@ -0,0 +1,76 @@
+package mgohttp
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	bson "gopkg.in/mgo.v2/bson"
+)
+
+func TestPageTokenRoundTrip(t *testing.T) {
+	s := NewPageTokenSigner([]byte("secret"))
+	fingerprint := QueryFingerprint("find", "users", bson.M{"org": 1})
+	id := bson.NewObjectId()
+	created := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	token, err := s.Encode(PageToken{SortKey: created, ID: id, Fingerprint: fingerprint})
+	require.NoError(t, err)
+	again, err := s.Encode(PageToken{SortKey: created, ID: id, Fingerprint: fingerprint})
+	require.NoError(t, err)
+	assert.Equal(t, token, again, "retries get the same token")
+
+	decoded, err := s.Decode(token, fingerprint)
+	require.NoError(t, err)
+	assert.Equal(t, id, decoded.ID)
+	assert.True(t, created.Equal(decoded.SortKey.(time.Time)))
+}
+
+func TestPageTokenRejected(t *testing.T) {
+	s := NewPageTokenSigner([]byte("secret"))
+	token, err := s.Encode(PageToken{ID: 42, Fingerprint: "a"})
+	require.NoError(t, err)
+
+	payload, sig, _ := strings.Cut(token, ".")
+	tampered, err := NewPageTokenSigner([]byte("other")).Encode(PageToken{ID: 43, Fingerprint: "a"})
+	require.NoError(t, err)
+	otherPayload, _, _ := strings.Cut(tampered, ".")
+
+	for desc, tc := range map[string]struct{ token, fingerprint string }{
+		"other query":  {token, "b"},
+		"other key":    {tampered, "a"},
+		"tampered":     {otherPayload + "." + sig, "a"},
+		"no signature": {payload, "a"},
+		"not base64":   {"!!." + sig, "a"},
+	} {
+		_, err := s.Decode(tc.token, tc.fingerprint)
+		assert.True(t, errors.Is(err, ErrInvalidPageToken), desc)
+	}
+	status, _ := DefaultErrorMapper(InvalidPageTokenError{Reason: "bad signature"})
+	assert.Equal(t, 400, status)
+}
+
+func TestPageTokenKeyRotation(t *testing.T) {
+	token, err := NewPageTokenSigner([]byte("old")).Encode(PageToken{ID: 1})
+	require.NoError(t, err)
+	rotated := NewPageTokenSigner([]byte("new"), []byte("old"))
+	decoded, err := rotated.Decode(token, "")
+	require.NoError(t, err)
+	assert.Equal(t, 1, decoded.ID)
+
+	reissued, err := rotated.Encode(decoded)
+	require.NoError(t, err)
+	assert.NotEqual(t, token, reissued, "new tokens are signed with the new key")
+}
+
+func TestPageTokenSelector(t *testing.T) {
+	tok := PageToken{SortKey: 5, ID: 7}
+	assert.Equal(t, bson.M{"_id": bson.M{"$gt": 7}}, tok.Selector("", false))
+	assert.Equal(t, bson.M{"$or": []bson.M{
+		{"score": bson.M{"$lt": 5}},
+		{"score": 5, "_id": bson.M{"$lt": 7}},
+	}}, tok.Selector("score", true))
+}
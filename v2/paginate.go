@@ -0,0 +1,156 @@
+package mgohttp
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	bson "gopkg.in/mgo.v2/bson"
+)
+
+// DefaultPageLimit is the number of documents per page when PageOptions has no Limit.
+const DefaultPageLimit = 20
+
+// PageOptions configures Paginate.
+type PageOptions struct {
+	// After is the NextToken of the previous page, empty for the first page.
+	After string
+	// Limit is the number of documents per page, DefaultPageLimit when not positive.
+	Limit int
+	// SortField is the field the pages are sorted on, then _id to break ties. The pages are
+	// sorted on _id only when empty. The field must be in the documents the query returns.
+	SortField string
+	// Descending sorts the pages in descending order.
+	Descending bool
+	// Signer signs the tokens. Without one, they're only checksummed: clients can't corrupt
+	// them by accident but can forge positions, which is harmless unless the position itself
+	// is sensitive.
+	Signer *PageTokenSigner
+	// Fingerprint identifies the query the tokens are handed out for, so they're rejected
+	// by other queries, e.g. "users-by-org:" + orgID.
+	Fingerprint string
+}
+
+// Page is a page of the documents of a query, see Paginate.
+type Page[T any] struct {
+	Items []T
+	// NextToken is the PageOptions.After of the next page, empty on the last page.
+	NextToken string
+}
+
+// unsignedPages checksums the tokens of the PageOptions without a Signer.
+var unsignedPages = NewPageTokenSigner(nil)
+
+// Paginate returns the page of the documents of query after opts.After, decoded as Ts. It
+// sorts the query on opts.SortField and _id, and narrows it to the documents after the
+// token's position with And, which holds up as documents are inserted and deleted, unlike
+// Skip. It returns an InvalidPageTokenError for a token it didn't hand out. The page is
+// recorded on a "paginate" span, e.g.
+//
+//	page, err := mgohttp.Paginate[User](ctx, users.Find(bson.M{"org": org}), mgohttp.PageOptions{
+//		After:  r.URL.Query().Get("after"),
+//		Signer: signer,
+//	})
+func Paginate[T any](ctx context.Context, query MongoQuery, opts PageOptions) (page Page[T], err error) {
+	sp, _ := startSpan(ctx, "paginate")
+	defer sp.Finish()
+	defer func() { logAndReturnErr(sp, err) }()
+
+	limit := opts.Limit
+	if limit <= 0 {
+		limit = DefaultPageLimit
+	}
+	signer := opts.Signer
+	if signer == nil {
+		signer = unsignedPages
+	}
+	sort := pageSort(opts.SortField, opts.Descending)
+	sp.SetTag(TagPageLimit, limit)
+	sp.SetTag(TagPageSort, strings.Join(sort, "|"))
+	sp.SetTag(TagPageResumed, opts.After != "")
+
+	if opts.After != "" {
+		token, err := signer.Decode(opts.After, opts.Fingerprint)
+		if err != nil {
+			return Page[T]{}, err
+		}
+		query = query.And(token.Selector(opts.SortField, opts.Descending))
+	}
+	// one more than the page, to know whether there's a next one
+	raws, err := query.Sort(sort...).Limit(limit + 1).AllRaw()
+	if err != nil {
+		return Page[T]{}, err
+	}
+	more := len(raws) > limit
+	if more {
+		raws = raws[:limit]
+	}
+	page.Items = make([]T, len(raws))
+	for i, raw := range raws {
+		if err := raw.Unmarshal(&page.Items[i]); err != nil {
+			return Page[T]{}, err
+		}
+	}
+	sp.SetTag(TagPageDocs, len(raws))
+	sp.SetTag(TagPageHasNext, more)
+	if !more {
+		return page, nil
+	}
+	token, err := pageTokenOf(raws[len(raws)-1], opts.SortField)
+	if err != nil {
+		return Page[T]{}, err
+	}
+	token.Fingerprint = opts.Fingerprint
+	page.NextToken, err = signer.Encode(token)
+	return page, err
+}
+
+// pageSort returns the sort of the pages on field, then _id.
+func pageSort(field string, descending bool) []string {
+	prefix := ""
+	if descending {
+		prefix = "-"
+	}
+	if field == "" || field == "_id" {
+		return []string{prefix + "_id"}
+	}
+	return []string{prefix + field, prefix + "_id"}
+}
+
+// pageTokenOf returns the position of the last document of a page sorted on field.
+func pageTokenOf(raw bson.Raw, field string) (PageToken, error) {
+	var doc bson.M
+	if err := raw.Unmarshal(&doc); err != nil {
+		return PageToken{}, err
+	}
+	id, ok := doc["_id"]
+	if !ok {
+		return PageToken{}, errors.New("mgohttp: paginated documents must have their _id")
+	}
+	token := PageToken{ID: id}
+	if field == "" || field == "_id" {
+		return token, nil
+	}
+	var value interface{} = doc
+	for _, key := range strings.Split(field, ".") {
+		sub, ok := value.(bson.M)
+		if !ok {
+			value = nil
+			break
+		}
+		value = sub[key]
+	}
+	token.SortKey = value
+	return token, nil
+}
+
+// andSelectors combines the selectors with $and, skipping an empty selector.
+func andSelectors(selector, other interface{}) interface{} {
+	if selector == nil {
+		return other
+	}
+	if m, ok := selector.(bson.M); ok && len(m) == 0 {
+		return other
+	}
+	return bson.M{"$and": []interface{}{selector, other}}
+}
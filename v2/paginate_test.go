@@ -0,0 +1,40 @@
+package mgohttp
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	bson "gopkg.in/mgo.v2/bson"
+)
+
+func TestPageSort(t *testing.T) {
+	assert.Equal(t, []string{"_id"}, pageSort("", false))
+	assert.Equal(t, []string{"-_id"}, pageSort("_id", true))
+	assert.Equal(t, []string{"-createdAt", "-_id"}, pageSort("createdAt", true))
+}
+
+func TestPageTokenOf(t *testing.T) {
+	raw := func(doc interface{}) bson.Raw {
+		data, err := bson.Marshal(doc)
+		require.NoError(t, err)
+		return bson.Raw{Kind: 3, Data: data}
+	}
+	token, err := pageTokenOf(raw(bson.M{"_id": 7, "meta": bson.M{"rank": 3}}), "meta.rank")
+	require.NoError(t, err)
+	assert.Equal(t, PageToken{ID: 7, SortKey: 3}, token)
+
+	token, err = pageTokenOf(raw(bson.M{"_id": 7}), "meta.rank")
+	require.NoError(t, err)
+	assert.Nil(t, token.SortKey, "documents without the field sort first")
+
+	_, err = pageTokenOf(raw(bson.M{"name": "a"}), "")
+	assert.Error(t, err, "projected out _id")
+}
+
+func TestAndSelectors(t *testing.T) {
+	page := bson.M{"_id": bson.M{"$gt": 1}}
+	assert.Equal(t, page, andSelectors(nil, page))
+	assert.Equal(t, page, andSelectors(bson.M{}, page))
+	assert.Equal(t, bson.M{"$and": []interface{}{bson.M{"org": "a"}, page}}, andSelectors(bson.M{"org": "a"}, page))
+}
@@ -0,0 +1,64 @@
+package mgohttp
+
+import (
+	"errors"
+	"fmt"
+	"runtime/debug"
+
+	"gopkg.in/Clever/kayvee-go.v6/logger"
+)
+
+// ErrDriverPanic is the sentinel wrapped by every DriverPanicError.
+var ErrDriverPanic = errors.New("mongo driver panicked")
+
+// DriverPanicError is returned in place of a panic raised by mgo during an operation, e.g.
+// when a session is used after it was closed, see SessionHandlerConfig.RecoverDriverPanics.
+type DriverPanicError struct {
+	// Op is the operation, e.g. "find" or "update".
+	Op         string
+	Collection string
+	// Value is the value the driver panicked with.
+	Value interface{}
+	// Stack is the stack trace of the panic.
+	Stack []byte
+}
+
+func (e DriverPanicError) Error() string {
+	op := e.Op
+	if e.Collection != "" {
+		op += " " + e.Collection
+	}
+	return fmt.Sprintf("mgohttp: %s: %s: %v", op, ErrDriverPanic, e.Value)
+}
+
+// Unwrap allows errors.Is(err, ErrDriverPanic).
+func (e DriverPanicError) Unwrap() error {
+	return ErrDriverPanic
+}
+
+// recoverPanic is deferred by the operations to turn a panic of the driver into a
+// DriverPanicError returned through errp, when the handler is configured to. Otherwise the
+// panic goes on.
+func (o *opSpan) recoverPanic(errp *error) {
+	h := handlerFromContext(o.ctx)
+	if h == nil || !h.cfg.RecoverDriverPanics || !rolledOut(o.ctx, RolloutRecoverDriverPanics) {
+		return
+	}
+	p := recover()
+	if p == nil {
+		return
+	}
+	err := DriverPanicError{
+		Op:         o.name,
+		Collection: o.collection,
+		Value:      p,
+		Stack:      debug.Stack(),
+	}
+	logger.FromContext(o.ctx).ErrorD("mgohttp-driver-panic", logger.M{
+		"op":         o.name,
+		"collection": o.collection,
+		"panic":      fmt.Sprint(p),
+		"stack":      string(err.Stack),
+	})
+	*errp = logAndReturnErr(o.Span, abortedErr(o.ctx, err))
+}
@@ -0,0 +1,33 @@
+package mgohttp
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	mgo "gopkg.in/mgo.v2"
+	bson "gopkg.in/mgo.v2/bson"
+)
+
+func TestRecoverDriverPanics(t *testing.T) {
+	// the collection has no session, so mgo panics on any operation
+	c := tracedMgoCollection{
+		collectionName: "events",
+		collection:     &mgo.Collection{Name: "events", Database: &mgo.Database{Name: testDBName}},
+		ctx:            context.WithValue(context.Background(), handlerKey, &SessionHandler{cfg: SessionHandlerConfig{RecoverDriverPanics: true}}),
+	}
+	err := c.Insert(bson.M{"a": 1})
+	require.Error(t, err)
+	assert.True(t, errors.Is(err, ErrDriverPanic))
+	var perr DriverPanicError
+	require.True(t, errors.As(err, &perr))
+	assert.Equal(t, "insert", perr.Op)
+	assert.Equal(t, "events", perr.Collection)
+	assert.NotEmpty(t, perr.Stack)
+	assert.False(t, isHealthError(err))
+
+	c.ctx = context.WithValue(context.Background(), handlerKey, &SessionHandler{})
+	assert.Panics(t, func() { c.Insert(bson.M{"a": 1}) })
+}
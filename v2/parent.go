@@ -0,0 +1,298 @@
+package mgohttp
+
+import (
+	"errors"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"gopkg.in/Clever/kayvee-go.v6/logger"
+	mgo "gopkg.in/mgo.v2"
+)
+
+const (
+	// redialAfterErrors is the number of operations in a row that must lose their connection
+	// before the parent session is re-dialed.
+	redialAfterErrors = 5
+	// redialInterval is the minimum time between two dials of the parent session, so that the
+	// requests of a handler that can't reach Mongo don't each wait for a dial to time out.
+	redialInterval = 5 * time.Second
+)
+
+// dialedParent is the parent session of a handler dialed from a URL, see
+// SessionHandlerConfig.URL and NewSessionHandlerFromURL. It's dialed by the first request
+// that needs it, and re-dialed when the operations keep losing their connection, e.g. once
+// the session got "Closed explicitly" or every server was replaced, which a Refresh of the
+// session can't recover from. With WithSRVRefresh, it's also re-dialed when the hosts of
+// the SRV records change.
+type dialedParent struct {
+	rawURL  string
+	opts    []DialOption
+	dial    func(info *mgo.DialInfo) (*mgo.Session, error)
+	log     logger.KayveeLogger
+	metrics *Metrics
+
+	mu    sync.Mutex
+	sess  *mgo.Session // nil until dialed
+	hosts []string
+	// lastDial is when the session was last dialed, dialErr the error of the last dial if it
+	// failed
+	lastDial time.Time
+	dialErr  error
+	// dialing is closed once the dial in progress is done, nil when there's none: the dial
+	// runs without holding mu, so the operations observed meanwhile don't wait for it
+	dialing chan struct{}
+	// connErrs counts the operations in a row that lost their connection
+	connErrs  int
+	redialing bool
+	closed    bool
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+func newDialedParent(rawURL string, opts []DialOption) *dialedParent {
+	p := &dialedParent{
+		rawURL: rawURL,
+		opts:   opts,
+		dial:   mgo.DialWithInfo,
+		log:    logger.New("mgohttp"),
+		stop:   make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+	if cfg := newDialConfig(opts); cfg.srvRefresh > 0 && isSRVURL(rawURL) {
+		go p.run(cfg.srvRefresh)
+	} else {
+		close(p.done)
+	}
+	return p
+}
+
+// connect dials the session unless it's already dialed, failing right away with the error
+// of the previous dial if it was less than redialInterval ago. Concurrent callers wait for a
+// single dial.
+func (p *dialedParent) connect() error {
+	p.mu.Lock()
+	for p.dialing != nil {
+		dialing := p.dialing
+		p.mu.Unlock()
+		<-dialing
+		p.mu.Lock()
+	}
+	var err error
+	switch {
+	case p.closed:
+		err = ErrShuttingDown
+	case p.sess != nil:
+	case p.dialErr != nil && time.Since(p.lastDial) < redialInterval:
+		err = p.dialErr
+	default:
+		dialing := make(chan struct{})
+		p.dialing = dialing
+		p.mu.Unlock()
+		sess, hosts, dialErr := p.dialSession()
+		p.mu.Lock()
+		p.dialing = nil
+		close(dialing)
+		err = p.dialed(sess, hosts, dialErr)
+	}
+	p.mu.Unlock()
+	return err
+}
+
+// dialed records the outcome of the dial of connect, with p.mu held.
+func (p *dialedParent) dialed(sess *mgo.Session, hosts []string, err error) error {
+	p.lastDial = time.Now()
+	if err != nil {
+		p.dialErr = err
+		p.log.WarnD("mgohttp-dial-failed", logger.M{"error": err.Error()})
+		return err
+	}
+	if p.closed {
+		// closed while dialing
+		sess.Close()
+		return ErrShuttingDown
+	}
+	p.sess, p.hosts, p.dialErr = sess, hosts, nil
+	return nil
+}
+
+func (p *dialedParent) dialSession() (*mgo.Session, []string, error) {
+	info, hosts, err := dialInfoHosts(p.rawURL, p.opts...)
+	if err != nil {
+		return nil, nil, err
+	}
+	if hosts == nil {
+		hosts = info.Addrs
+	}
+	sess, err := p.dial(info)
+	return sess, hosts, err
+}
+
+// peerAddress returns the host the session was dialed with, empty unless it's dialed with a
+// single one.
+func (p *dialedParent) peerAddress() string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.sess == nil || len(p.hosts) != 1 {
+		return ""
+	}
+	return p.hosts[0]
+}
+
+// copySession copies the parent session for a request, dialing it first if needed.
+func (p *dialedParent) copySession() (*mgo.Session, error) {
+	if err := p.connect(); err != nil {
+		return nil, err
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed {
+		return nil, ErrShuttingDown
+	}
+	return p.sess.Copy(), nil
+}
+
+// Copy is copySession, returning nil when the session can't be dialed.
+func (p *dialedParent) Copy() *mgo.Session {
+	sess, _ := p.copySession()
+	return sess
+}
+
+// observe records the outcome of an operation of a session copied from the parent, and
+// re-dials the parent in the background once redialAfterErrors operations in a row lost
+// their connection.
+func (p *dialedParent) observe(err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	switch {
+	case !IsNetworkError(err):
+		// the server answered
+		p.connErrs = 0
+		return
+	case !connectionLost(err):
+		return
+	}
+	p.connErrs++
+	if p.connErrs < redialAfterErrors || p.redialing || p.closed || p.sess == nil ||
+		time.Since(p.lastDial) < redialInterval {
+		return
+	}
+	p.redialing = true
+	go p.redial(p.connErrs)
+}
+
+// redial dials a new parent session in place of the current one. The sessions copied from
+// the previous one are left to their requests.
+func (p *dialedParent) redial(errs int) {
+	sess, hosts, err := p.dialSession()
+	p.mu.Lock()
+	p.redialing = false
+	p.lastDial = time.Now()
+	if err != nil {
+		p.mu.Unlock()
+		p.log.WarnD("mgohttp-parent-redial-failed", logger.M{"error": err.Error(), "errors": errs})
+		p.metrics.parentRedialed("failed")
+		return
+	}
+	old := p.replace(sess, hosts)
+	p.connErrs = 0
+	p.mu.Unlock()
+	old.Close()
+	p.log.InfoD("mgohttp-parent-redialed", logger.M{"errors": errs, "hosts": strings.Join(hosts, ",")})
+	p.metrics.parentRedialed("redialed")
+}
+
+// replace swaps the session for sess, returning the one to close: the previous session, or
+// sess itself once the parent is closed.
+func (p *dialedParent) replace(sess *mgo.Session, hosts []string) *mgo.Session {
+	if p.closed {
+		return sess
+	}
+	old := p.sess
+	p.sess, p.hosts = sess, hosts
+	return old
+}
+
+func (p *dialedParent) run(interval time.Duration) {
+	defer close(p.done)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			p.refresh()
+		case <-p.stop:
+			return
+		}
+	}
+}
+
+// refresh re-resolves the SRV records, and dials a new parent session if the hosts changed.
+func (p *dialedParent) refresh() {
+	info, hosts, err := dialInfoHosts(p.rawURL, p.opts...)
+	if err != nil {
+		p.log.WarnD("mgohttp-srv-resolve-failed", logger.M{"error": err.Error()})
+		return
+	}
+	p.mu.Lock()
+	previous := p.hosts
+	changed := p.sess != nil && !slices.Equal(hosts, previous)
+	p.mu.Unlock()
+	if !changed {
+		return
+	}
+	sess, err := p.dial(info)
+	if err != nil {
+		p.log.WarnD("mgohttp-srv-redial-failed", logger.M{"error": err.Error(), "hosts": strings.Join(hosts, ",")})
+		return
+	}
+	p.mu.Lock()
+	old := p.replace(sess, hosts)
+	p.mu.Unlock()
+	old.Close()
+	p.log.InfoD("mgohttp-srv-hosts-changed", logger.M{
+		"previous": strings.Join(previous, ","),
+		"hosts":    strings.Join(hosts, ","),
+	})
+}
+
+// Close stops the resolutions and closes the parent session.
+func (p *dialedParent) Close() error {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return nil
+	}
+	p.closed = true
+	p.mu.Unlock()
+	close(p.stop)
+	<-p.done
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.sess != nil {
+		p.sess.Close()
+	}
+	return nil
+}
+
+// connectionLost reports whether the operation failed because its connection to the
+// servers was lost, rather than timed out or closed by the handler.
+func connectionLost(err error) bool {
+	return IsNetworkError(err) && !IsTimeout(err) && !errors.As(err, &RequestAbortedError{})
+}
+
+// usesParent reports whether the sessions of database are copied from the handler's parent
+// session.
+func (c *SessionHandler) usesParent(database string) bool {
+	if c.cfg.NewSession != nil || c.cfg.SessionPool != nil {
+		return false
+	}
+	for _, db := range c.databases {
+		if db.name == database {
+			return db.parentSession == nil && db.newSession == nil && db.driver == nil
+		}
+	}
+	return false
+}
@@ -0,0 +1,172 @@
+package mgohttp
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	opentracing "github.com/opentracing/opentracing-go"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	mgo "gopkg.in/mgo.v2"
+	bson "gopkg.in/mgo.v2/bson"
+)
+
+func TestLazyDial(t *testing.T) {
+	dials := 0
+	var sessErr error
+	handler := NewSessionHandler(SessionHandlerConfig{
+		Database: testDBName,
+		Timeout:  handlerTimeout,
+		URL:      "mongodb://db1:27017/app",
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			sessErr = FromContext(r.Context(), testDBName).Ping()
+		}),
+	}).(*SessionHandler)
+	parent := handler.parentSession.(*dialedParent)
+	parent.dial = func(info *mgo.DialInfo) (*mgo.Session, error) {
+		dials++
+		assert.Equal(t, []string{"db1:27017"}, info.Addrs)
+		return nil, errors.New("no reachable servers")
+	}
+	parent.log.SetOutput(io.Discard)
+	assert.Equal(t, 0, dials, "nothing is dialed until a request needs the session")
+
+	for i := 0; i < 2; i++ {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+		assert.ErrorContains(t, sessErr, "no reachable servers")
+	}
+	assert.Equal(t, 1, dials, "the requests don't each dial again")
+
+	parent.lastDial = time.Now().Add(-redialInterval)
+	parent.dial = func(info *mgo.DialInfo) (*mgo.Session, error) {
+		dials++
+		return &mgo.Session{}, nil
+	}
+	require.NoError(t, parent.connect())
+	assert.Equal(t, 2, dials)
+	assert.NoError(t, handler.Shutdown(context.Background()))
+	assert.ErrorIs(t, parent.connect(), ErrShuttingDown)
+}
+
+func TestParentRedialsOnLostConnections(t *testing.T) {
+	metrics, err := NewMetrics(prometheus.NewRegistry())
+	require.NoError(t, err)
+	var logs bytes.Buffer
+	parent := newDialedParent("mongodb://db1/app", nil)
+	parent.metrics = metrics
+	parent.log.SetOutput(&logs)
+	redialed := make(chan *mgo.Session, 1)
+	parent.dial = func(info *mgo.DialInfo) (*mgo.Session, error) {
+		sess := &mgo.Session{}
+		redialed <- sess
+		return sess, nil
+	}
+	require.NoError(t, parent.connect())
+	first := <-redialed
+	parent.lastDial = time.Now().Add(-redialInterval)
+
+	for i := 0; i < redialAfterErrors-1; i++ {
+		parent.observe(io.EOF)
+	}
+	parent.observe(mgo.ErrNotFound)
+	for i := 0; i < redialAfterErrors-1; i++ {
+		parent.observe(errors.New("Closed explicitly"))
+	}
+	parent.observe(RequestAbortedError{Cause: ErrRequestTimeout, Err: io.EOF})
+	assert.Len(t, redialed, 0, "the server answered in between")
+
+	parent.observe(io.EOF)
+	select {
+	case sess := <-redialed:
+		assert.Eventually(t, func() bool {
+			parent.mu.Lock()
+			defer parent.mu.Unlock()
+			return parent.sess == sess && parent.sess != first && !parent.redialing
+		}, time.Second, time.Millisecond)
+	case <-time.After(time.Second):
+		t.Fatal("the parent wasn't re-dialed")
+	}
+	assert.Equal(t, 1.0, testutil.ToFloat64(metrics.parentRedials.WithLabelValues("redialed")))
+	assert.Contains(t, logs.String(), `"title":"mgohttp-parent-redialed"`)
+
+	for i := 0; i < redialAfterErrors; i++ {
+		parent.observe(io.EOF)
+	}
+	assert.Len(t, redialed, 0, "it was just re-dialed")
+	parent.Close()
+}
+
+func TestParentDialsOnce(t *testing.T) {
+	parent := newDialedParent("mongodb://db1/app", nil)
+	dials := 0
+	dialing, dialed := make(chan struct{}), make(chan struct{})
+	parent.dial = func(info *mgo.DialInfo) (*mgo.Session, error) {
+		dials++
+		close(dialing)
+		<-dialed
+		return &mgo.Session{}, nil
+	}
+	errs := make(chan error, 2)
+	go func() { errs <- parent.connect() }()
+	<-dialing
+	go func() { errs <- parent.connect() }()
+
+	observed := make(chan struct{})
+	go func() {
+		parent.observe(io.EOF)
+		close(observed)
+	}()
+	select {
+	case <-observed:
+	case <-time.After(time.Second):
+		t.Fatal("the operations wait for the dial")
+	}
+	close(dialed)
+	require.NoError(t, <-errs)
+	require.NoError(t, <-errs)
+	assert.Equal(t, 1, dials, "the second caller waits for the first one's dial")
+	parent.Close()
+}
+
+func TestOperationsOfOtherDatabasesObserveTheParent(t *testing.T) {
+	h := NewSessionHandler(SessionHandlerConfig{
+		Database: testDBName,
+		URL:      "mongodb://db1/app",
+		// the session isn't connected, the operations must not reach it
+		Interceptors: []Interceptor{func(ctx context.Context, op *OpInfo, next func() error) error {
+			return io.EOF
+		}},
+	}).(*SessionHandler)
+	parent := h.parentSession.(*dialedParent)
+	defer parent.Close()
+	s := &requestSession{c: h}
+	ctx := opentracing.ContextWithSpan(context.WithValue(context.Background(), handlerKey, h), opentracing.NoopTracer{}.StartSpan("mgohttp"))
+	ctx = s.opContext(ctx, testDBName)
+	sess := tracedMgoSession{sess: &mgo.Session{}, ctx: ctx, databases: newWrapperCache[MongoDatabase]()}
+
+	// the session of the handler's database, used for another one
+	err := sess.DB("other").C("users").Remove(bson.M{"_id": 1})
+	assert.ErrorIs(t, err, io.EOF)
+	parent.mu.Lock()
+	defer parent.mu.Unlock()
+	assert.Equal(t, 1, parent.connErrs, "the session was copied from the parent")
+}
+
+func TestUsesParent(t *testing.T) {
+	h := NewSessionHandler(SessionHandlerConfig{
+		Database:  testDBName,
+		URL:       "mongodb://db1/app",
+		Databases: []DatabaseConfig{{Database: "other", Sess: &mgo.Session{}}},
+	}).(*SessionHandler)
+	assert.True(t, h.usesParent(testDBName))
+	assert.False(t, h.usesParent("other"))
+	assert.False(t, h.usesParent("unknown"))
+}
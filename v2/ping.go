@@ -0,0 +1,85 @@
+package mgohttp
+
+import (
+	"context"
+	"time"
+
+	mgo "gopkg.in/mgo.v2"
+)
+
+// PingInfo describes the server that answered a PingWithInfo call.
+type PingInfo struct {
+	// RTT is the round trip time of the ping command.
+	RTT time.Duration
+	// Address is the host:port of the responding server, as it reports itself.
+	Address string
+	// State is one of "primary", "secondary", "arbiter", "mongos", "standalone" or "other".
+	State string
+	// ReplicaSet is the replica set name, empty when not connected to a replica set.
+	ReplicaSet string
+}
+
+// isMasterResult is the subset of the isMaster command response used by PingWithInfo.
+type isMasterResult struct {
+	IsMaster    bool     `bson:"ismaster"`
+	Secondary   bool     `bson:"secondary"`
+	ArbiterOnly bool     `bson:"arbiterOnly"`
+	Msg         string   `bson:"msg"`
+	SetName     string   `bson:"setName"`
+	Me          string   `bson:"me"`
+	Hosts       []string `bson:"hosts"`
+}
+
+func (r isMasterResult) state() string {
+	switch {
+	case r.Msg == "isdbgrid":
+		return "mongos"
+	case r.SetName == "" && r.IsMaster:
+		return "standalone"
+	case r.IsMaster:
+		return "primary"
+	case r.Secondary:
+		return "secondary"
+	case r.ArbiterOnly:
+		return "arbiter"
+	}
+	return "other"
+}
+
+// pingWithInfo runs isMaster against the session, which doubles as a ping that tells us who
+// answered.
+func pingWithInfo(sess *mgo.Session) (PingInfo, error) {
+	var res isMasterResult
+	start := time.Now()
+	if err := sess.Run("isMaster", &res); err != nil {
+		return PingInfo{RTT: time.Since(start)}, err
+	}
+	info := PingInfo{
+		RTT:        time.Since(start),
+		Address:    res.Me,
+		State:      res.state(),
+		ReplicaSet: res.SetName,
+	}
+	if info.Address == "" {
+		// standalone servers and mongos don't report "me"
+		if servers := sess.LiveServers(); len(servers) > 0 {
+			info.Address = servers[0]
+		}
+	}
+	return info, nil
+}
+
+// runWithContext runs fn, returning early with ctx.Err() if ctx is done first. mgo has no
+// notion of a Context, so fn keeps running in the background until the socket timeout.
+func runWithContext(ctx context.Context, fn func() error) error {
+	done := make(chan error, 1)
+	go func() {
+		done <- fn()
+	}()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,273 @@
+package mgohttp
+
+import (
+	"context"
+	"errors"
+	"reflect"
+
+	opentracing "github.com/opentracing/opentracing-go"
+	opentracinglog "github.com/opentracing/opentracing-go/log"
+	mgo "gopkg.in/mgo.v2"
+	bson "gopkg.in/mgo.v2/bson"
+)
+
+// tracedPipe runs an aggregation pipeline as the aggregate command, and drives its cursor
+// with getMore commands, so each batch is traced rather than each document.
+type tracedPipe struct {
+	tc           tracedMgoCollection
+	pipeline     interface{}
+	batch        int
+	allowDiskUse bool
+}
+
+func (tc tracedMgoCollection) Pipe(pipeline interface{}) MongoPipe {
+	recordUsage("MongoCollection.Pipe")
+	return tracedPipe{tc: tc, pipeline: pipeline}
+}
+
+func (p tracedPipe) AllowDiskUse() MongoPipe {
+	recordUsage("MongoPipe.AllowDiskUse")
+	p.allowDiskUse = true
+	return p
+}
+
+func (p tracedPipe) Batch(n int) MongoPipe {
+	recordUsage("MongoPipe.Batch")
+	p.batch = n
+	return p
+}
+
+// command returns the aggregate command, with a cursor of batch documents per batch, the
+// server's default when zero.
+func (p tracedPipe) command(batch int) bson.D {
+	cursor := bson.M{}
+	if batch > 0 {
+		cursor["batchSize"] = batch
+	}
+	cmd := bson.D{
+		{Name: "aggregate", Value: p.tc.collectionName},
+		{Name: "pipeline", Value: p.pipeline},
+		{Name: "cursor", Value: cursor},
+	}
+	if p.allowDiskUse {
+		cmd = append(cmd, bson.DocElem{Name: "allowDiskUse", Value: true})
+	}
+	return cmd
+}
+
+func (p tracedPipe) All(result interface{}) error {
+	recordUsage("MongoPipe.All")
+	return p.iter(p.batch).All(result)
+}
+
+func (p tracedPipe) One(result interface{}) error {
+	recordUsage("MongoPipe.One")
+	it := p.iter(1)
+	if it.Next(result) {
+		return it.Close()
+	}
+	if err := it.Close(); err != nil {
+		return err
+	}
+	return mgo.ErrNotFound
+}
+
+func (p tracedPipe) Iter() MongoIter {
+	recordUsage("MongoPipe.Iter")
+	return p.iter(p.batch)
+}
+
+func (p tracedPipe) Explain(result interface{}) (err error) {
+	recordUsage("MongoPipe.Explain")
+	sp, _ := startOp(p.tc.ctx, "aggregate-explain", p.tc.collectionName)
+	defer sp.Finish()
+	defer sp.recoverPanic(&err)
+	if err := p.tc.guard(sp, nil); err != nil {
+		return logAndReturnErr(sp, err)
+	}
+	cmd := bson.D{
+		{Name: "aggregate", Value: p.tc.collectionName},
+		{Name: "pipeline", Value: p.pipeline},
+		{Name: "explain", Value: true},
+	}
+	return sp.done(sp.intercept(OpInfo{Selector: p.pipeline}, func(op *OpInfo) error {
+		cmd[1].Value = op.Selector
+		return p.tc.collection.Database.Run(cmd, result)
+	}))
+}
+
+// iter runs the aggregate command and returns the cursor on its results, traced as a span
+// from now until it's closed.
+func (p tracedPipe) iter(batch int) *tracedPipeIter {
+	_, ctx := startSpan(p.tc.ctx, "aggregate-cursor")
+	t := &tracedPipeIter{p: p, ctx: ctx, batch: batch, stats: newPipeCursorStats(ctx, p.tc.collectionName)}
+	var res cursorResult
+	t.err = p.aggregate(ctx, batch, &res)
+	t.docs, t.id = res.Cursor.FirstBatch, res.Cursor.ID
+	t.stats.received(len(t.docs), false)
+	return t
+}
+
+// aggregate runs the aggregate command, as the first batch of the cursor.
+func (p tracedPipe) aggregate(ctx context.Context, batch int, res *cursorResult) (err error) {
+	sp, _ := startOp(ctx, "aggregate", p.tc.collectionName)
+	defer sp.Finish()
+	defer sp.recoverPanic(&err)
+	sp.setFingerprint(p.pipeline)
+	if err := p.tc.guard(sp, nil); err != nil {
+		return logAndReturnErr(sp, err)
+	}
+	release, err := sp.limit("aggregate", p.tc.collectionName)
+	if err != nil {
+		return logAndReturnErr(sp, err)
+	}
+	defer release()
+
+	err = sp.intercept(OpInfo{Selector: p.pipeline}, func(op *OpInfo) error {
+		p.pipeline = op.Selector
+		return p.tc.collection.Database.Run(p.command(batch), res)
+	})
+	sp.SetTag(TagCursorID, res.Cursor.ID)
+	sp.LogFields(opentracinglog.Int(LogBatchDocs, len(res.Cursor.FirstBatch)))
+	return sp.done(err)
+}
+
+// tracedPipeIter is the cursor of a pipeline. The span of the cursor, in ctx, is the parent
+// of the spans of its batches.
+type tracedPipeIter struct {
+	p      tracedPipe
+	ctx    context.Context
+	batch  int
+	docs   []bson.Raw // left in the current batch
+	id     int64      // zero once the server is done with the cursor
+	err    error
+	closed bool
+	stats  *cursorStats
+}
+
+func (t *tracedPipeIter) Next(result interface{}) bool {
+	recordUsage("MongoIter.Next")
+	for len(t.docs) == 0 {
+		if t.closed || t.err != nil || t.id == 0 || BudgetExpired(t.p.tc.ctx) {
+			return false
+		}
+		t.getMore()
+	}
+	doc := t.docs[0]
+	t.docs = t.docs[1:]
+	if err := doc.Unmarshal(result); err != nil {
+		t.err = err
+		return false
+	}
+	return true
+}
+
+// getMore fetches the next batch of the cursor.
+func (t *tracedPipeIter) getMore() {
+	collection := t.p.tc.collectionName
+	sp, _ := startOp(t.ctx, "getmore", collection)
+	defer sp.Finish()
+	sp.setFingerprint(t.p.pipeline)
+	sp.SetTag(TagCursorID, t.id)
+	cmd := bson.D{
+		{Name: "getMore", Value: t.id},
+		{Name: "collection", Value: collection},
+	}
+	if t.batch > 0 {
+		cmd = append(cmd, bson.DocElem{Name: "batchSize", Value: t.batch})
+	}
+	var res struct {
+		Cursor struct {
+			NextBatch []bson.Raw `bson:"nextBatch"`
+			ID        int64      `bson:"id"`
+		} `bson:"cursor"`
+	}
+	var err error
+	func() {
+		defer sp.recoverPanic(&err)
+		err = t.p.tc.collection.Database.Run(cmd, &res)
+	}()
+	sp.LogFields(opentracinglog.Int(LogBatchDocs, len(res.Cursor.NextBatch)))
+	if t.err = sp.done(err); t.err == nil {
+		t.docs, t.id = res.Cursor.NextBatch, res.Cursor.ID
+		t.stats.received(len(t.docs), true)
+	}
+}
+
+func (t *tracedPipeIter) All(result interface{}) error {
+	recordUsage("MongoIter.All")
+	if err := readAll(result, t.Next); err != nil {
+		t.Close()
+		return err
+	}
+	return t.Close()
+}
+
+// readAll reads the documents next returns into result, a pointer to a slice, like the All of
+// mgo's iterators.
+func readAll(result interface{}, next func(result interface{}) bool) error {
+	resultv := reflect.ValueOf(result)
+	if resultv.Kind() != reflect.Ptr || resultv.Elem().Kind() != reflect.Slice {
+		return errors.New("result argument must be a slice address")
+	}
+	slicev := resultv.Elem()
+	slicev = slicev.Slice(0, slicev.Cap())
+	elemt := slicev.Type().Elem()
+	i := 0
+	for ; ; i++ {
+		if slicev.Len() == i {
+			elemp := reflect.New(elemt)
+			if !next(elemp.Interface()) {
+				break
+			}
+			slicev = reflect.Append(slicev, elemp.Elem())
+			slicev = slicev.Slice(0, slicev.Cap())
+		} else if !next(slicev.Index(i).Addr().Interface()) {
+			break
+		}
+	}
+	resultv.Elem().Set(slicev.Slice(0, i))
+	return nil
+}
+
+// Close kills the cursor if the server still holds it, and finishes its span.
+func (t *tracedPipeIter) Close() error {
+	recordUsage("MongoIter.Close")
+	if t.closed {
+		return t.err
+	}
+	t.closed = true
+	t.docs = nil
+	if t.id != 0 {
+		cmd := bson.D{
+			{Name: "killCursors", Value: t.p.tc.collectionName},
+			{Name: "cursors", Value: []int64{t.id}},
+		}
+		sp, _ := startSpan(t.ctx, "killcursors")
+		sp.SetTag(TagCursorID, t.id)
+		if err := t.p.tc.collection.Database.Run(cmd, nil); err != nil {
+			logAndReturnErr(sp, err)
+		}
+		sp.Finish()
+		t.id = 0
+	}
+	t.stats.report()
+	opentracing.SpanFromContext(t.ctx).Finish()
+	return t.err
+}
+
+func (t *tracedPipeIter) Done() bool {
+	recordUsage("MongoIter.Done")
+	return len(t.docs) == 0 && (t.closed || t.err != nil || t.id == 0)
+}
+
+func (t *tracedPipeIter) Err() error {
+	recordUsage("MongoIter.Err")
+	return t.err
+}
+
+// Timeout is always false: aggregation cursors aren't tailable.
+func (t *tracedPipeIter) Timeout() bool {
+	recordUsage("MongoIter.Timeout")
+	return false
+}
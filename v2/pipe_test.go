@@ -0,0 +1,64 @@
+package mgohttp
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/opentracing/opentracing-go/mocktracer"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	mgo "gopkg.in/mgo.v2"
+	bson "gopkg.in/mgo.v2/bson"
+)
+
+func TestPipeCommand(t *testing.T) {
+	pipeline := []bson.M{{"$match": bson.M{"a": 1}}}
+	p := tracedPipe{tc: tracedMgoCollection{collectionName: "events"}, pipeline: pipeline}
+	assert.Equal(t, bson.D{
+		{Name: "aggregate", Value: "events"},
+		{Name: "pipeline", Value: pipeline},
+		{Name: "cursor", Value: bson.M{}},
+	}, p.command(0))
+
+	p = p.AllowDiskUse().Batch(50).(tracedPipe)
+	assert.Equal(t, bson.D{
+		{Name: "aggregate", Value: "events"},
+		{Name: "pipeline", Value: pipeline},
+		{Name: "cursor", Value: bson.M{"batchSize": 50}},
+		{Name: "allowDiskUse", Value: true},
+	}, p.command(p.batch))
+}
+
+func TestPipeDisabledCollection(t *testing.T) {
+	DisableCollection(testDBName, "events")
+	defer EnableCollection(testDBName, "events")
+
+	tracer := mocktracer.New()
+	// The collection has no session behind it: any call that reaches mgo would panic.
+	c := tracedMgoCollection{
+		collectionName: "events",
+		collection:     &mgo.Collection{Name: "events", Database: &mgo.Database{Name: testDBName}},
+		ctx:            context.WithValue(context.Background(), handlerKey, &SessionHandler{cfg: SessionHandlerConfig{Tracer: tracer}}),
+	}
+
+	it := c.Pipe([]bson.M{{"$match": bson.M{"a": 1}}}).Batch(2).Iter()
+	var doc bson.M
+	assert.False(t, it.Next(&doc))
+	assert.True(t, it.Done())
+	assert.True(t, errors.Is(it.Close(), ErrCollectionDisabled))
+
+	ops := map[string]*mocktracer.MockSpan{}
+	for _, sp := range tracer.FinishedSpans() {
+		ops[sp.OperationName] = sp
+	}
+	require.Contains(t, ops, "aggregate")
+	require.Contains(t, ops, "aggregate-cursor")
+	assert.NotContains(t, ops, "killcursors", "the cursor was never opened")
+	assert.Equal(t, ops["aggregate-cursor"].SpanContext.SpanID, ops["aggregate"].ParentID)
+
+	assert.True(t, errors.Is(c.Pipe(nil).One(&doc), ErrCollectionDisabled))
+	var docs []bson.M
+	assert.True(t, errors.Is(c.Pipe(nil).All(&docs), ErrCollectionDisabled))
+	assert.True(t, errors.Is(c.Pipe(nil).Explain(&doc), ErrCollectionDisabled))
+}
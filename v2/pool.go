@@ -0,0 +1,133 @@
+package mgohttp
+
+import (
+	"context"
+	"sync/atomic"
+
+	mgo "gopkg.in/mgo.v2"
+)
+
+// SessionPoolConfig configures a SessionPool.
+type SessionPoolConfig struct {
+	// Size is the number of idle sessions the pool keeps. Defaults to 16.
+	Size int
+	// Warm pings every session when the pool is created, so each one holds a socket before
+	// the first request checks it out.
+	Warm bool
+}
+
+// SessionPool keeps copies of a parent session for the requests of a SessionHandler to check
+// out, sparing each request the Copy and the new socket of its first query, see
+// SessionHandlerConfig.SessionPool. A request that finds the pool empty copies the parent as
+// usual, and its session joins the pool when it's done.
+type SessionPool struct {
+	parent *mgo.Session
+	mode   mgo.Mode
+	safe   *mgo.Safe
+	idle   chan *mgo.Session
+
+	closed    atomic.Bool
+	checkouts int64
+	misses    int64
+}
+
+// NewSessionPool fills a SessionPool with copies of parent. The sessions checked back in are
+// reset to the mode and safety parent has now.
+func NewSessionPool(parent *mgo.Session, cfg SessionPoolConfig) *SessionPool {
+	if cfg.Size <= 0 {
+		cfg.Size = 16
+	}
+	p := &SessionPool{
+		parent: parent,
+		mode:   parent.Mode(),
+		safe:   parent.Safe(),
+		idle:   make(chan *mgo.Session, cfg.Size),
+	}
+	for i := 0; i < cfg.Size; i++ {
+		sess := parent.Copy()
+		if cfg.Warm && sess.Ping() != nil {
+			sess.Refresh()
+		}
+		p.idle <- sess
+	}
+	return p
+}
+
+// checkout returns an idle session, or a new copy of the parent if there's none.
+func (p *SessionPool) checkout() *mgo.Session {
+	atomic.AddInt64(&p.checkouts, 1)
+	select {
+	case sess := <-p.idle:
+		return sess
+	default:
+		atomic.AddInt64(&p.misses, 1)
+		return p.parent.Copy()
+	}
+}
+
+// checkin returns sess to the pool once its request is done with it, undoing the changes the
+// request made. A session that saw a failure is refreshed, dropping its sockets.
+func (p *SessionPool) checkin(sess *mgo.Session, failed bool) {
+	if p.closed.Load() {
+		sess.Close()
+		return
+	}
+	if failed {
+		sess.Refresh()
+	}
+	if sess.Mode() != p.mode {
+		sess.SetMode(p.mode, true)
+	}
+	sess.SetSafe(p.safe)
+	sess.SelectServers()
+	select {
+	case p.idle <- sess:
+	default:
+		// the pool is full
+		sess.Close()
+	}
+}
+
+// Close closes the idle sessions. Sessions checked back in later are closed as well.
+func (p *SessionPool) Close() {
+	p.closed.Store(true)
+	for {
+		select {
+		case sess := <-p.idle:
+			sess.Close()
+		default:
+			return
+		}
+	}
+}
+
+// SessionPoolStats counts the checkouts of a SessionPool.
+type SessionPoolStats struct {
+	// Idle is the number of sessions in the pool.
+	Idle int
+	// Checkouts counts the sessions requests asked for, and Misses those copied because the
+	// pool was empty.
+	Checkouts int64
+	Misses    int64
+}
+
+// Stats returns the current counts of the pool.
+func (p *SessionPool) Stats() SessionPoolStats {
+	return SessionPoolStats{
+		Idle:      len(p.idle),
+		Checkouts: atomic.LoadInt64(&p.checkouts),
+		Misses:    atomic.LoadInt64(&p.misses),
+	}
+}
+
+type sessionFailedKeyType struct{}
+
+var sessionFailedKey = sessionFailedKeyType{}
+
+// markSessionFailed records that an operation on the request's session failed in a way that
+// may have broken its socket, so it's refreshed before it goes back to the pool.
+func markSessionFailed(ctx context.Context) {
+	if failed, ok := ctx.Value(sessionFailedKey).(*atomic.Bool); ok {
+		failed.Store(true)
+	}
+}
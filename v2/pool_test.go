@@ -0,0 +1,70 @@
+package mgohttp
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	mgo "gopkg.in/mgo.v2"
+)
+
+// testSessionPool returns a pool holding a single session that isn't connected, and no
+// parent to copy: the tests must not check out more sessions than the pool holds.
+func testSessionPool() (*SessionPool, *mgo.Session) {
+	sess := &mgo.Session{}
+	sess.SetMode(mgo.Strong, true)
+	p := &SessionPool{mode: mgo.Strong, safe: &mgo.Safe{}, idle: make(chan *mgo.Session, 1)}
+	p.idle <- sess
+	return p, sess
+}
+
+func TestSessionPool(t *testing.T) {
+	pool, pooled := testSessionPool()
+	handler := NewSessionHandler(SessionHandlerConfig{
+		Database:    testDBName,
+		Timeout:     handlerTimeout,
+		SessionPool: pool,
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			sess := FromContext(WithMode(r.Context(), mgo.Eventual), testDBName).(tracedMgoSession)
+			assert.Equal(t, pooled, sess.sess)
+			assert.Equal(t, mgo.Eventual, pooled.Mode())
+		}),
+	})
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+
+	assert.Equal(t, SessionPoolStats{Idle: 1, Checkouts: 1}, pool.Stats())
+	assert.Equal(t, mgo.Strong, pooled.Mode(), "the request's changes are undone")
+}
+
+func TestSessionPoolTimeout(t *testing.T) {
+	pool, _ := testSessionPool()
+	release := make(chan struct{})
+	defer close(release)
+	handler := NewSessionHandler(SessionHandlerConfig{
+		Database:    testDBName,
+		Timeout:     handlerTimeout,
+		SessionPool: pool,
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			FromContext(r.Context(), testDBName)
+			<-release
+		}),
+	})
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+
+	assert.Equal(t, SessionPoolStats{Idle: 0, Checkouts: 1}, pool.Stats(),
+		"the handler may still use the session, it's closed rather than returned")
+}
+
+func TestMarkSessionFailed(t *testing.T) {
+	s := &requestSession{c: &SessionHandler{}}
+	ctx := s.newContext(context.Background())
+	sp, _ := startOp(context.WithValue(ctx, handlerKey, &SessionHandler{}), "find", "users")
+	sp.done(mgo.ErrNotFound)
+	assert.False(t, s.failed.Load())
+	sp.done(io.EOF)
+	require.True(t, s.failed.Load())
+}
@@ -0,0 +1,62 @@
+package mgohttp
+
+import (
+	"errors"
+	"fmt"
+
+	"gopkg.in/Clever/kayvee-go.v6/logger"
+)
+
+// ErrQueryBudgetExceeded is the sentinel wrapped by every QueryBudgetExceededError.
+var ErrQueryBudgetExceeded = errors.New("mgohttp: query budget exceeded")
+
+// QueryBudgetExceededError is returned by the operations a request runs past its
+// SessionHandlerConfig.MaxQueriesPerRequest when AbortOverQueryBudget is set.
+type QueryBudgetExceededError struct {
+	Op         string
+	Collection string
+	// Max is the number of operations the request was allowed.
+	Max int
+}
+
+func (e QueryBudgetExceededError) Error() string {
+	return fmt.Sprintf("mgohttp: %s %s: %s (%d operations)", e.Op, e.Collection, ErrQueryBudgetExceeded, e.Max)
+}
+
+// Unwrap allows errors.Is(err, ErrQueryBudgetExceeded).
+func (e QueryBudgetExceededError) Unwrap() error {
+	return ErrQueryBudgetExceeded
+}
+
+// countQuery counts the operation against the request's query budget. The first operation
+// over it is logged and tagged on the request's root span, and every one of them is failed
+// with a QueryBudgetExceededError when the handler aborts them.
+func (o *opSpan) countQuery() error {
+	h := handlerFromContext(o.ctx)
+	s, _ := o.ctx.Value(requestSessionKey).(*requestSession)
+	if h == nil || s == nil || h.cfg.MaxQueriesPerRequest <= 0 {
+		return nil
+	}
+	n := s.queries.Add(1)
+	if n <= int64(h.cfg.MaxQueriesPerRequest) {
+		return nil
+	}
+	o.SetTag(TagQueryBudgetExceeded, true)
+	if n == int64(h.cfg.MaxQueriesPerRequest)+1 {
+		s.mu.Lock()
+		if s.libSpan != nil {
+			s.libSpan.SetTag(TagQueryBudgetExceeded, true)
+		}
+		s.mu.Unlock()
+		logger.FromContext(o.ctx).ErrorD("mgohttp-query-budget-exceeded", logger.M{
+			"op":         o.name,
+			"collection": o.collection,
+			"max":        h.cfg.MaxQueriesPerRequest,
+			"path":       s.r.URL.Path,
+		})
+	}
+	if !h.cfg.AbortOverQueryBudget {
+		return nil
+	}
+	return QueryBudgetExceededError{Op: o.name, Collection: o.collection, Max: h.cfg.MaxQueriesPerRequest}
+}
@@ -0,0 +1,71 @@
+package mgohttp
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/opentracing/opentracing-go/mocktracer"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/Clever/kayvee-go.v6/logger"
+	mgo "gopkg.in/mgo.v2"
+	bson "gopkg.in/mgo.v2/bson"
+)
+
+func TestQueryBudget(t *testing.T) {
+	serve := func(abort bool) ([]error, *mocktracer.MockSpan, string) {
+		tracer := mocktracer.New()
+		var errs []error
+		handler := NewSessionHandler(SessionHandlerConfig{
+			Database:   testDBName,
+			Timeout:    handlerTimeout,
+			NewSession: func(ctx context.Context) (*mgo.Session, error) { return &mgo.Session{}, nil },
+			// the session isn't connected, the operations must not reach it
+			Interceptors: []Interceptor{func(ctx context.Context, op *OpInfo, next func() error) error {
+				return errors.New("rejected")
+			}},
+			Tracer:               tracer,
+			MaxQueriesPerRequest: 2,
+			AbortOverQueryBudget: abort,
+			Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				users := FromContext(r.Context(), testDBName).DB("app").C("users")
+				for i := 0; i < 4; i++ {
+					errs = append(errs, users.Remove(bson.M{"_id": i}))
+				}
+			}),
+		})
+		var logs bytes.Buffer
+		log := logger.New("mgohttp-test")
+		log.SetOutput(&logs)
+		r := httptest.NewRequest("GET", "/users", nil)
+		r = r.WithContext(logger.NewContext(r.Context(), log))
+		handler.ServeHTTP(httptest.NewRecorder(), r)
+		var root *mocktracer.MockSpan
+		for _, sp := range tracer.FinishedSpans() {
+			if sp.OperationName == "mgohttp" {
+				root = sp
+			}
+		}
+		return errs, root, logs.String()
+	}
+
+	errs, root, logs := serve(false)
+	for _, err := range errs {
+		assert.False(t, errors.Is(err, ErrQueryBudgetExceeded), "the operations still run")
+	}
+	assert.Equal(t, true, root.Tag(TagQueryBudgetExceeded))
+	assert.Equal(t, 1, strings.Count(logs, "mgohttp-query-budget-exceeded"), "logged once per request")
+	assert.Contains(t, logs, `"path":"/users"`)
+
+	errs, _, _ = serve(true)
+	assert.False(t, errors.Is(errs[1], ErrQueryBudgetExceeded))
+	var budgetErr QueryBudgetExceededError
+	if assert.True(t, errors.As(errs[2], &budgetErr)) {
+		assert.Equal(t, QueryBudgetExceededError{Op: "remove", Collection: "users", Max: 2}, budgetErr)
+	}
+	assert.True(t, errors.Is(errs[3], ErrQueryBudgetExceeded))
+}
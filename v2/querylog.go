@@ -0,0 +1,200 @@
+package mgohttp
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	bson "gopkg.in/mgo.v2/bson"
+)
+
+// QueryLogMode is how the fields of selectors, updates and projections are logged on spans.
+type QueryLogMode int
+
+const (
+	// QueryLogKeys logs the field names only. This is the default.
+	QueryLogKeys QueryLogMode = iota
+	// QueryLogValues logs the field names with their values.
+	QueryLogValues
+	// QueryLogHashed logs the field names with a hash of their values, so equal values can be
+	// correlated without being disclosed.
+	QueryLogHashed
+)
+
+// QueryLogging configures how much of the documents sent to Mongo is logged on the spans.
+type QueryLogging struct {
+	// Mode applies to the fields not listed in Fields.
+	Mode QueryLogMode
+	// Fields overrides Mode for fields by name, e.g. {"email": QueryLogHashed}. A name matches
+	// a dotted path ("address.zip") or its last element ("zip").
+	Fields map[string]QueryLogMode
+	// HashKey, when set, keys the hashes of QueryLogHashed (HMAC-SHA256), so low entropy
+	// values like emails can't be recovered by hashing guesses.
+	HashKey []byte
+	// MaxPayloadBytes, when set, caps each logged selector, update or projection, so tracing
+	// backends don't drop the spans for their size. Longer ones go through Compactor.
+	MaxPayloadBytes int
+	// Compactor shortens the payloads longer than MaxPayloadBytes, TruncatePayload when nil.
+	Compactor PayloadCompactor
+	// TruncationMarker, when set, replaces the "...[truncated N bytes]" marker of the
+	// payloads TruncatePayload cut, the default Compactor. A %d in it is the size of the
+	// payload, e.g. "…(%d bytes)".
+	TruncationMarker string
+}
+
+// mode returns the mode of the field at path.
+func (l *QueryLogging) mode(path string) QueryLogMode {
+	if l == nil {
+		return QueryLogKeys
+	}
+	if m, ok := l.Fields[path]; ok {
+		return m
+	}
+	if i := strings.LastIndex(path, "."); i >= 0 {
+		if m, ok := l.Fields[path[i+1:]]; ok {
+			return m
+		}
+	}
+	return l.Mode
+}
+
+// format renders the field at path according to its mode.
+func (l *QueryLogging) format(path string, value interface{}) string {
+	switch l.mode(path) {
+	case QueryLogValues:
+		return fmt.Sprintf("%s=%v", path, value)
+	case QueryLogHashed:
+		return fmt.Sprintf("%s=%s", path, l.hash(value))
+	}
+	return path
+}
+
+func (l *QueryLogging) hash(value interface{}) string {
+	data := []byte(fmt.Sprintf("%#v", value))
+	if len(l.HashKey) == 0 {
+		sum := sha256.Sum256(data)
+		return "sha256:" + hex.EncodeToString(sum[:8])
+	}
+	mac := hmac.New(sha256.New, l.HashKey)
+	mac.Write(data)
+	return "hmac:" + hex.EncodeToString(mac.Sum(nil)[:8])
+}
+
+// queryLogging returns the QueryLogging of the handler that issued the session of ctx, or
+// the one logging every value for the requests with verbose diagnostics.
+func queryLogging(ctx context.Context) *QueryLogging {
+	if h := handlerFromContext(ctx); h != nil {
+		if debugging(ctx) {
+			return debugQueryLogging(h.cfg.QueryLogging)
+		}
+		return h.cfg.QueryLogging
+	}
+	return nil
+}
+
+// getFields lists the fields of doc, recursing into sub-documents and arrays of documents,
+// as formatted by l. doc may be a bson.M, a bson.D, a map or a struct, anything else has no
+// fields. The fields of maps are sorted, the elements of arrays are numbered like in dotted
+// paths, e.g. "$or.1.email".
+func getFields(l *QueryLogging, prefix string, doc interface{}) []string {
+	elems, ok := docElems(doc)
+	if !ok {
+		return []string{}
+	}
+	fields := []string{}
+	for _, elem := range elems {
+		fields = append(fields, getValueFields(l, joinPath(prefix, elem.Name), elem.Value)...)
+	}
+	return fields
+}
+
+// getValueFields lists the fields of the value at path: its own when it's a scalar or an
+// array of scalars, those of its documents otherwise.
+func getValueFields(l *QueryLogging, path string, value interface{}) []string {
+	if _, ok := docElems(value); ok {
+		return getFields(l, path, value)
+	}
+	rv := reflect.ValueOf(value)
+	if (rv.Kind() == reflect.Slice || rv.Kind() == reflect.Array) && rv.Len() > 0 && rv.Type().Elem().Kind() != reflect.Uint8 {
+		fields := []string{}
+		for i := 0; i < rv.Len(); i++ {
+			elem := rv.Index(i).Interface()
+			if _, ok := docElems(elem); !ok {
+				// an array of scalars, e.g. the values of $in, is logged as a whole
+				return []string{l.format(path, value)}
+			}
+			fields = append(fields, getFields(l, joinPath(path, strconv.Itoa(i)), elem)...)
+		}
+		return fields
+	}
+	return []string{l.format(path, value)}
+}
+
+func joinPath(prefix, key string) string {
+	if prefix == "" {
+		return key
+	}
+	return prefix + "." + key
+}
+
+// docElems returns the fields of v if it's a document. Structs are documents but for the
+// values of time.Time and the types of the bson package, e.g. bson.RegEx.
+func docElems(v interface{}) (bson.D, bool) {
+	switch d := v.(type) {
+	case nil:
+		return nil, false
+	case bson.D:
+		return d, true
+	case bson.M:
+		return sortedElems(d), true
+	case map[string]interface{}:
+		return sortedElems(d), true
+	case time.Time:
+		return nil, false
+	}
+	rv := reflect.ValueOf(v)
+	for rv.Kind() == reflect.Ptr {
+		if rv.IsNil() {
+			return nil, false
+		}
+		rv = rv.Elem()
+	}
+	if rv.Kind() != reflect.Struct && rv.Kind() != reflect.Map {
+		return nil, false
+	}
+	if rv.Type().PkgPath() == bsonPkgPath {
+		return nil, false
+	}
+	// the fields as stored, with their bson tags
+	data, err := bson.Marshal(v)
+	if err != nil {
+		return nil, false
+	}
+	var d bson.D
+	if err := bson.Unmarshal(data, &d); err != nil {
+		return nil, false
+	}
+	return d, true
+}
+
+var bsonPkgPath = reflect.TypeOf(bson.RegEx{}).PkgPath()
+
+func sortedElems(m map[string]interface{}) bson.D {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	d := make(bson.D, 0, len(keys))
+	for _, k := range keys {
+		d = append(d, bson.DocElem{Name: k, Value: m[k]})
+	}
+	return d
+}
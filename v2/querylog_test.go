@@ -0,0 +1,75 @@
+package mgohttp
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	bson "gopkg.in/mgo.v2/bson"
+)
+
+func TestQueryLogging(t *testing.T) {
+	selector := bson.M{
+		"name":    "ada",
+		"email":   "ada@example.com",
+		"address": bson.M{"zip": "94107"},
+		"age":     bson.M{"$gt": 30},
+	}
+	fields := func(l *QueryLogging) []string {
+		f := getFields(l, "", selector)
+		sort.Strings(f)
+		return f
+	}
+
+	assert.Equal(t, []string{"address.zip", "age.$gt", "email", "name"}, fields(nil))
+
+	l := &QueryLogging{
+		Mode:   QueryLogValues,
+		Fields: map[string]QueryLogMode{"email": QueryLogHashed, "address.zip": QueryLogKeys},
+	}
+	logged := fields(l)
+	assert.Equal(t, "address.zip", logged[0])
+	assert.Equal(t, "age.$gt=30", logged[1])
+	assert.True(t, strings.HasPrefix(logged[2], "email=sha256:"), logged[2])
+	assert.NotContains(t, logged[2], "ada@example.com")
+	assert.Equal(t, "name=ada", logged[3])
+
+	// equal values hash equally, and the key changes the hash
+	assert.Equal(t, logged[2], fields(l)[2])
+	keyed := &QueryLogging{Mode: QueryLogHashed, HashKey: []byte("secret")}
+	assert.True(t, strings.HasPrefix(keyed.format("email", "ada@example.com"), "email=hmac:"))
+
+	ctx := context.WithValue(context.Background(), handlerKey, &SessionHandler{cfg: SessionHandlerConfig{QueryLogging: l}})
+	assert.Equal(t, "name=ada", bsonToKeys(ctx, LogSelector, bson.M{"name": "ada"}).Value())
+}
+
+func TestQueryLoggingDocuments(t *testing.T) {
+	type selector struct {
+		Org   string `bson:"org"`
+		Email string `bson:"email,omitempty"`
+		Since bson.M `bson:"since"`
+	}
+	when := time.Date(2020, 1, 2, 0, 0, 0, 0, time.UTC)
+	l := &QueryLogging{Mode: QueryLogValues}
+	for _, tc := range []struct {
+		doc    interface{}
+		fields []string
+	}{
+		{bson.D{{Name: "b", Value: 1}, {Name: "a", Value: bson.D{{Name: "$gt", Value: 2}}}}, []string{"b=1", "a.$gt=2"}},
+		{bson.M{"$or": []bson.M{{"email": "a"}, {"name": "b"}}}, []string{"$or.0.email=a", "$or.1.name=b"}},
+		{bson.M{"$and": []interface{}{bson.M{"a": 1}, bson.D{{Name: "b", Value: 2}}}}, []string{"$and.0.a=1", "$and.1.b=2"}},
+		{bson.M{"_id": bson.M{"$in": []int{1, 2}}}, []string{"_id.$in=[1 2]"}},
+		{bson.M{"tags": bson.M{"$all": []string{}}}, []string{"tags.$all=[]"}},
+		{selector{Org: "o", Since: bson.M{"$gte": when}}, []string{"org=o", "since.$gte=" + when.String()}},
+		{&selector{Org: "o"}, []string{"org=o"}},
+		{bson.M{"name": bson.RegEx{Pattern: "^a"}}, []string{"name={^a }"}},
+		{"not a document", []string{}},
+		{nil, []string{}},
+	} {
+		assert.Equal(t, tc.fields, getFields(l, "", tc.doc), "%#v", tc.doc)
+	}
+	assert.Equal(t, []string{"$or.0.email", "$or.1.name"}, getFields(nil, "", bson.M{"$or": []bson.M{{"email": "a"}, {"name": "b"}}}))
+}
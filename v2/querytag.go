@@ -0,0 +1,30 @@
+package mgohttp
+
+import (
+	"context"
+)
+
+type queryTagsKeyType struct{}
+
+var queryTagsKey = queryTagsKeyType{}
+
+// WithQueryTag returns a copy of ctx whose Mongo operations are tagged with key and value,
+// e.g. WithQueryTag(ctx, "feature", "report-export"), so database load can be attributed to
+// product features. The tags are set on the span of every operation of sessions retrieved
+// with FromContext(ctx, ...) and added to their slow query logs. Tags accumulate, a later
+// tag with the same key replaces the earlier one.
+func WithQueryTag(ctx context.Context, key, value string) context.Context {
+	parent := queryTags(ctx)
+	tags := make(map[string]string, len(parent)+1)
+	for k, v := range parent {
+		tags[k] = v
+	}
+	tags[key] = value
+	return context.WithValue(ctx, queryTagsKey, tags)
+}
+
+// queryTags returns the tags added to ctx with WithQueryTag.
+func queryTags(ctx context.Context) map[string]string {
+	tags, _ := ctx.Value(queryTagsKey).(map[string]string)
+	return tags
+}
@@ -0,0 +1,28 @@
+package mgohttp
+
+import (
+	"context"
+	"testing"
+
+	opentracing "github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/mocktracer"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWithQueryTag(t *testing.T) {
+	tracer := mocktracer.New()
+	opentracing.SetGlobalTracer(tracer)
+	defer opentracing.SetGlobalTracer(opentracing.NoopTracer{})
+
+	ctx := WithQueryTag(context.Background(), "feature", "report-export")
+	ctx = WithQueryTag(ctx, "org", "123")
+	overridden := WithQueryTag(ctx, "org", "456")
+	assert.Equal(t, map[string]string{"feature": "report-export", "org": "123"}, queryTags(ctx))
+	assert.Equal(t, map[string]string{"feature": "report-export", "org": "456"}, queryTags(overridden))
+
+	sp, _ := startOp(ctx, "find", "reports")
+	sp.Finish()
+	tags := tracer.FinishedSpans()[0].Tags()
+	assert.Equal(t, "report-export", tags["feature"])
+	assert.Equal(t, "123", tags["org"])
+}
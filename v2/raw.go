@@ -0,0 +1,40 @@
+package mgohttp
+
+import (
+	opentracing "github.com/opentracing/opentracing-go"
+	opentracinglog "github.com/opentracing/opentracing-go/log"
+	bson "gopkg.in/mgo.v2/bson"
+)
+
+func (q tracedMongoQuery) OneRaw() (bson.Raw, error) {
+	recordUsage("MongoQuery.OneRaw")
+	var raw bson.Raw
+	err := q.One(&raw)
+	return raw, err
+}
+
+func (q tracedMongoQuery) AllRaw() ([]bson.Raw, error) {
+	recordUsage("MongoQuery.AllRaw")
+	docs := []bson.Raw{}
+	if err := q.All(&docs); err != nil {
+		return nil, err
+	}
+	return docs, nil
+}
+
+// logResultBytes logs the size of the documents read into result, when they were read as
+// raw BSON.
+func logResultBytes(sp opentracing.Span, result interface{}) {
+	size := 0
+	switch r := result.(type) {
+	case *bson.Raw:
+		size = len(r.Data)
+	case *[]bson.Raw:
+		for _, raw := range *r {
+			size += len(raw.Data)
+		}
+	default:
+		return
+	}
+	sp.LogFields(opentracinglog.Int(LogResultBytes, size))
+}
@@ -0,0 +1,29 @@
+package mgohttp
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/opentracing/opentracing-go/mocktracer"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	bson "gopkg.in/mgo.v2/bson"
+)
+
+func TestLogResultBytes(t *testing.T) {
+	tracer := mocktracer.New()
+	one, err := bson.Marshal(bson.M{"a": 1})
+	require.NoError(t, err)
+
+	sp := tracer.StartSpan("find")
+	logResultBytes(sp, &bson.Raw{Kind: 0x03, Data: one})
+	logResultBytes(sp, &[]bson.Raw{{Kind: 0x03, Data: one}, {Kind: 0x03, Data: one}})
+	logResultBytes(sp, &bson.M{})
+	sp.Finish()
+
+	logs := tracer.FinishedSpans()[0].Logs()
+	require.Len(t, logs, 2, "decoded results aren't measured")
+	assert.Equal(t, LogResultBytes, logs[0].Fields[0].Key)
+	assert.Equal(t, strconv.Itoa(len(one)), logs[0].Fields[0].ValueString)
+	assert.Equal(t, strconv.Itoa(2*len(one)), logs[1].Fields[0].ValueString)
+}
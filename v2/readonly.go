@@ -0,0 +1,36 @@
+package mgohttp
+
+import (
+	"net/http"
+	"strings"
+
+	mgo "gopkg.in/mgo.v2"
+)
+
+// ReadOnlyRoutes gives the sessions of read-only requests a consistency mode of their own,
+// e.g. mgo.SecondaryPreferred, so that the endpoints don't each have to call WithMode. A
+// request is read-only when its method is GET or HEAD and its path has one of the prefixes.
+// Other requests keep the handler's mode, primary by default.
+type ReadOnlyRoutes struct {
+	// PathPrefixes are the prefixes of the read-only paths, e.g. "/reports/". Every GET and
+	// HEAD request is read-only when empty.
+	PathPrefixes []string
+	// Mode is the consistency mode of the read-only requests' sessions.
+	Mode mgo.Mode
+}
+
+// readOnly reports whether r is a read-only request.
+func (o ReadOnlyRoutes) readOnly(r *http.Request) bool {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		return false
+	}
+	if len(o.PathPrefixes) == 0 {
+		return true
+	}
+	for _, prefix := range o.PathPrefixes {
+		if strings.HasPrefix(r.URL.Path, prefix) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,59 @@
+package mgohttp
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/opentracing/opentracing-go/mocktracer"
+	"github.com/stretchr/testify/assert"
+	mgo "gopkg.in/mgo.v2"
+)
+
+func TestReadOnlyRoutes(t *testing.T) {
+	routes := ReadOnlyRoutes{PathPrefixes: []string{"/reports/", "/search"}, Mode: mgo.SecondaryPreferred}
+	for _, tc := range []struct {
+		method, path string
+		readOnly     bool
+	}{
+		{"GET", "/reports/daily", true},
+		{"HEAD", "/search?q=a", true},
+		{"POST", "/reports/daily", false},
+		{"GET", "/users/1", false},
+	} {
+		r := httptest.NewRequest(tc.method, tc.path, nil)
+		assert.Equal(t, tc.readOnly, routes.readOnly(r), "%s %s", tc.method, tc.path)
+	}
+	assert.True(t, ReadOnlyRoutes{}.readOnly(httptest.NewRequest("GET", "/users/1", nil)))
+	assert.False(t, ReadOnlyRoutes{}.readOnly(httptest.NewRequest("DELETE", "/users/1", nil)))
+
+	serve := func(method string) (mgo.Mode, *mocktracer.MockSpan) {
+		tracer := mocktracer.New()
+		var sess *mgo.Session
+		handler := NewSessionHandler(SessionHandlerConfig{
+			Database: testDBName,
+			Timeout:  handlerTimeout,
+			NewSession: func(ctx context.Context) (*mgo.Session, error) {
+				sess = &mgo.Session{}
+				sess.SetMode(mgo.Primary, true)
+				return sess, nil
+			},
+			ReadOnlyRoutes: &routes,
+			Tracer:         tracer,
+			Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				FromContext(r.Context(), testDBName)
+			}),
+		})
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(method, "/reports/daily", nil))
+		spans := tracer.FinishedSpans()
+		return sess.Mode(), spans[len(spans)-1]
+	}
+	mode, root := serve("GET")
+	assert.Equal(t, mgo.SecondaryPreferred, mode)
+	assert.Equal(t, true, root.Tag(TagReadOnlyRoute))
+	assert.Equal(t, "secondaryPreferred", root.Tag(TagReadMode))
+	mode, root = serve("POST")
+	assert.Equal(t, mgo.Primary, mode)
+	assert.Nil(t, root.Tag(TagReadOnlyRoute))
+}
@@ -0,0 +1,229 @@
+package mgohttp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	opentracing "github.com/opentracing/opentracing-go"
+	mgo "gopkg.in/mgo.v2"
+	bson "gopkg.in/mgo.v2/bson"
+)
+
+// ReadTags is a replica set tag set, e.g. ReadTags{"use": "reporting"}. A server matches when
+// it carries all of the tags.
+type ReadTags map[string]string
+
+func (t ReadTags) doc() bson.D {
+	keys := make([]string, 0, len(t))
+	for k := range t {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	doc := bson.D{}
+	for _, k := range keys {
+		doc = append(doc, bson.DocElem{Name: k, Value: t[k]})
+	}
+	return doc
+}
+
+// carries reports whether the tags of a member include all of set.
+func (t ReadTags) carries(set ReadTags) bool {
+	for k, v := range set {
+		if t[k] != v {
+			return false
+		}
+	}
+	return true
+}
+
+func (t ReadTags) String() string {
+	pairs := []string{}
+	for _, elem := range t.doc() {
+		pairs = append(pairs, elem.Name+":"+elem.Value.(string))
+	}
+	return strings.Join(pairs, ",")
+}
+
+// ReadPreference pins reads to replica set members, see
+// https://docs.mongodb.com/manual/core/read-preference/.
+type ReadPreference struct {
+	// Mode is the consistency mode, e.g. mgo.SecondaryPreferred. Tag sets only apply to the
+	// modes that may read from secondaries.
+	Mode mgo.Mode
+	// TagSets are tried in order, the first one that matches a reachable member wins. An
+	// empty ReadTags as the last entry falls back to any member.
+	TagSets []ReadTags
+}
+
+// apply configures sess to read according to the preference.
+func (p ReadPreference) apply(sess *mgo.Session) {
+	sess.SetMode(p.Mode, true)
+	tags := make([]bson.D, 0, len(p.TagSets))
+	for _, t := range p.TagSets {
+		tags = append(tags, t.doc())
+	}
+	sess.SelectServers(tags...)
+}
+
+type readPrefKeyType struct{}
+
+var readPrefKey = readPrefKeyType{}
+
+// WithRequestReadPreference routes the reads of the sessions retrieved with FromContext(ctx,
+// ...) to the replica set members matching p, overriding the handler's ReadPreference, e.g.
+// ReadTags{"workload": "analytics"} for reporting endpoints. Like WithMode, only the request's
+// copy is changed and the preference sticks to the request's session. Queries can still
+// override it with MongoQuery.WithReadPreference.
+func WithRequestReadPreference(ctx context.Context, p ReadPreference) context.Context {
+	return context.WithValue(ctx, readPrefKey, p)
+}
+
+// readPreferenceFromContext returns the preference set with WithRequestReadPreference, if any.
+func readPreferenceFromContext(ctx context.Context) *ReadPreference {
+	if p, ok := ctx.Value(readPrefKey).(ReadPreference); ok {
+		return &p
+	}
+	return nil
+}
+
+// applyReadPreference applies the preference set with WithRequestReadPreference on sess, if
+// any, and records it on the caller's span.
+func applyReadPreference(ctx context.Context, sess *mgo.Session) {
+	p := readPreferenceFromContext(ctx)
+	if p == nil {
+		return
+	}
+	p.apply(sess)
+	if sp := opentracing.SpanFromContext(ctx); sp != nil {
+		p.tag(sp)
+	}
+}
+
+// tag records the preference on the span.
+func (p ReadPreference) tag(sp opentracing.Span) {
+	sp.SetTag(TagReadMode, modeName(p.Mode))
+	if len(p.TagSets) > 0 {
+		sp.SetTag(TagReadTags, p.tagSets())
+	}
+}
+
+// tagSets describes the tag sets of the preference, e.g. "{use:reporting}|{}".
+func (p ReadPreference) tagSets() string {
+	sets := []string{}
+	for _, t := range p.TagSets {
+		sets = append(sets, "{"+t.String()+"}")
+	}
+	return strings.Join(sets, "|")
+}
+
+// routeKey identifies a routed copy of a request's session: the session it copies, and the
+// read preference applied to it, if any.
+type routeKey struct {
+	sess *mgo.Session
+	pref string
+}
+
+// routedSession returns the copy of sess reading according to pref, made the first time one of
+// the request's queries asks for it. Like a child session, it takes one of the handler's
+// MaxConcurrentSessions, and it's closed along with the request's sessions.
+func (s *requestSession) routedSession(ctx context.Context, sess *mgo.Session, pref *ReadPreference) (*mgo.Session, error) {
+	key := routeKey{sess: sess}
+	if pref != nil {
+		key.pref = modeName(pref.Mode) + "|" + pref.tagSets()
+	}
+	c := s.c
+	s.mu.Lock()
+	cs := s.routes[key]
+	s.mu.Unlock()
+	if cs != nil {
+		if c.cfg.SocketTimeoutFunc != nil {
+			s.setSocketTimeout(cs.sess)
+		}
+		return cs.sess, nil
+	}
+
+	err := c.sessionTracker.add()
+	if err == nil {
+		if err = c.acquireSession(ctx, s.deadline, s.libSpan); err != nil {
+			c.sessionTracker.done()
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("mgohttp: creating routed session: %w", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if cs := s.routes[key]; cs != nil || s.closed {
+		// another query of the request made it meanwhile, or the request is done
+		c.releaseSession()
+		c.sessionTracker.done()
+		if cs == nil {
+			return nil, errors.New("mgohttp: creating routed session: the request's sessions are closed")
+		}
+		return cs.sess, nil
+	}
+	cs = &childSession{sess: sess.Copy(), c: c}
+	if pref != nil {
+		pref.apply(cs.sess)
+	}
+	s.setSocketTimeout(cs.sess)
+	if s.routes == nil {
+		s.routes = map[routeKey]*childSession{}
+	}
+	s.routes[key] = cs
+	s.children = append(s.children, cs)
+	c.cfg.Metrics.sessionOpened()
+	return cs.sess, nil
+}
+
+func modeName(m mgo.Mode) string {
+	switch m {
+	case mgo.Primary:
+		return "primary"
+	case mgo.PrimaryPreferred:
+		return "primaryPreferred"
+	case mgo.Secondary:
+		return "secondary"
+	case mgo.SecondaryPreferred:
+		return "secondaryPreferred"
+	case mgo.Nearest:
+		return "nearest"
+	case mgo.Eventual:
+		return "eventual"
+	case mgo.Monotonic:
+		return "monotonic"
+	}
+	return "unknown"
+}
+
+// safeName describes the write concern safe, e.g. "w=majority,j=true".
+func safeName(safe *mgo.Safe) string {
+	if safe == nil {
+		return "unacknowledged"
+	}
+	parts := []string{}
+	switch {
+	case safe.WMode != "":
+		parts = append(parts, "w="+safe.WMode)
+	case safe.W > 0:
+		parts = append(parts, "w="+strconv.Itoa(safe.W))
+	}
+	if safe.J {
+		parts = append(parts, "j=true")
+	}
+	if safe.FSync {
+		parts = append(parts, "fsync=true")
+	}
+	if safe.WTimeout > 0 {
+		parts = append(parts, "wtimeout="+strconv.Itoa(safe.WTimeout))
+	}
+	if len(parts) == 0 {
+		return "acknowledged"
+	}
+	return strings.Join(parts, ",")
+}
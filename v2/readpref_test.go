@@ -0,0 +1,118 @@
+package mgohttp
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/opentracing/opentracing-go/mocktracer"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	mgo "gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+func TestReadPreferenceTags(t *testing.T) {
+	tags := ReadTags{"use": "reporting", "region": "us-west-1"}
+	assert.Equal(t, bson.D{{Name: "region", Value: "us-west-1"}, {Name: "use", Value: "reporting"}}, tags.doc())
+	assert.Equal(t, "region:us-west-1,use:reporting", tags.String())
+
+	sp := mocktracer.New().StartSpan("find").(*mocktracer.MockSpan)
+	ReadPreference{Mode: mgo.SecondaryPreferred, TagSets: []ReadTags{tags, {}}}.tag(sp)
+	assert.Equal(t, "secondaryPreferred", sp.Tag("read-mode"))
+	assert.Equal(t, "{region:us-west-1,use:reporting}|{}", sp.Tag("read-tags"))
+}
+
+func TestWithMode(t *testing.T) {
+	tracer := mocktracer.New()
+	var sess *mgo.Session
+	handler := NewSessionHandler(SessionHandlerConfig{
+		Database: testDBName,
+		Timeout:  handlerTimeout,
+		NewSession: func(ctx context.Context) (*mgo.Session, error) {
+			sess = &mgo.Session{}
+			sess.SetMode(mgo.Strong, true)
+			return sess, nil
+		},
+		Tracer: tracer,
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			FromContext(r.Context(), testDBName)
+			assert.Equal(t, mgo.Strong, sess.Mode())
+			FromContext(WithMode(r.Context(), mgo.SecondaryPreferred), testDBName)
+			assert.Equal(t, mgo.SecondaryPreferred, sess.Mode())
+		}),
+	})
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	require.NotNil(t, sess)
+
+	tagged := 0
+	for _, sp := range tracer.FinishedSpans() {
+		if sp.Tag(TagReadMode) == "secondaryPreferred" {
+			tagged++
+		}
+	}
+	assert.Equal(t, 1, tagged)
+}
+
+func TestWithRequestReadPreference(t *testing.T) {
+	tracer := mocktracer.New()
+	var sess *mgo.Session
+	handler := NewSessionHandler(SessionHandlerConfig{
+		Database: testDBName,
+		Timeout:  handlerTimeout,
+		NewSession: func(ctx context.Context) (*mgo.Session, error) {
+			sess = &mgo.Session{}
+			return sess, nil
+		},
+		ReadPreference: &ReadPreference{Mode: mgo.PrimaryPreferred},
+		Tracer:         tracer,
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			FromContext(r.Context(), testDBName)
+			assert.Equal(t, mgo.PrimaryPreferred, sess.Mode())
+			ctx := WithRequestReadPreference(r.Context(), ReadPreference{
+				Mode:    mgo.Secondary,
+				TagSets: []ReadTags{{"workload": "analytics"}},
+			})
+			FromContext(ctx, testDBName)
+			assert.Equal(t, mgo.Secondary, sess.Mode())
+			assert.Equal(t, &ReadPreference{Mode: mgo.Secondary, TagSets: []ReadTags{{"workload": "analytics"}}},
+				readPreferenceFromContext(ctx))
+		}),
+	})
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	require.NotNil(t, sess)
+
+	tags := map[interface{}]int{}
+	for _, sp := range tracer.FinishedSpans() {
+		tags[sp.Tag(TagReadTags)]++
+	}
+	assert.Equal(t, 1, tags["{workload:analytics}"])
+	assert.Nil(t, readPreferenceFromContext(context.Background()))
+}
+
+func TestRoutedSessionCountsAgainstMaxConcurrentSessions(t *testing.T) {
+	var errRouted error
+	var reused, routed *mgo.Session
+	handler := sessionLimitTestHandler(true, time.Second, nil, make(chan error, 1))
+	inner := handler.cfg.Handler
+	handler.cfg.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		inner.ServeHTTP(w, r)
+		s := r.Context().Value(requestSessionKey).(*requestSession)
+		sess := FromContext(r.Context(), testDBName).(tracedMgoSession).sess
+		_, errRouted = s.routedSession(r.Context(), sess, &ReadPreference{Mode: mgo.Secondary})
+
+		// the copy of a preference is made once per request
+		routed = &mgo.Session{}
+		s.routes = map[routeKey]*childSession{{sess: sess, pref: "secondary|{use:reporting}"}: {sess: routed, c: handler}}
+		reused, _ = s.routedSession(r.Context(), sess,
+			&ReadPreference{Mode: mgo.Secondary, TagSets: []ReadTags{{"use": "reporting"}}})
+	})
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+
+	assert.True(t, errors.Is(errRouted, ErrTooManySessions), "the request's session holds the only slot")
+	assert.Same(t, routed, reused)
+	assert.Empty(t, handler.sessionSlots)
+}
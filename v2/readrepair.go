@@ -0,0 +1,432 @@
+package mgohttp
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	opentracing "github.com/opentracing/opentracing-go"
+	"gopkg.in/Clever/kayvee-go.v6/logger"
+	mgo "gopkg.in/mgo.v2"
+	bson "gopkg.in/mgo.v2/bson"
+)
+
+// RepairRule describes a field documents of a collection are required to have.
+type RepairRule struct {
+	Collection string
+	// Field is the required field, dotted for nested fields.
+	Field string
+	// Compute returns the value of Field for a document that's missing it.
+	Compute func(doc bson.M) (interface{}, error)
+}
+
+// ReadRepairConfig configures a ReadRepairer.
+type ReadRepairConfig struct {
+	// Sess is copied to write the repairs, which outlive the requests that read the
+	// documents.
+	Sess     *mgo.Session
+	Database string
+	Rules    []RepairRule
+	// MaxConcurrent is the number of repairs written at once. Defaults to 4.
+	MaxConcurrent int
+	// QueueSize is the number of repairs waiting to be written, further repairs are dropped
+	// until the queue drains. Defaults to 1000.
+	QueueSize int
+}
+
+// ReadRepairStats counts the repairs of a ReadRepairer.
+type ReadRepairStats struct {
+	// Detected counts the documents read without a required field.
+	Detected int64
+	Repaired int64
+	Failed   int64
+	// Dropped counts the repairs not queued because the queue was full or the document
+	// was already queued.
+	Dropped int64
+	// Pending is the number of repairs queued or being written.
+	Pending int64
+}
+
+type repairJob struct {
+	rule RepairRule
+	doc  bson.M
+	key  string
+	// read is the span of the operation that read the document, if it's known.
+	read opentracing.SpanContext
+}
+
+// ReadRepairer runs lazy migrations through normal traffic: documents read through the
+// collections it wraps that miss a field required by one of the rules get the field computed
+// and written in the background. The write only sets the field if it's still missing, so it
+// never clobbers a concurrent update.
+type ReadRepairer struct {
+	cfg   ReadRepairConfig
+	rules map[string][]RepairRule
+	// update writes a repair, it's only overridden by the tests.
+	update func(collection string, selector, update bson.M) error
+
+	mu      sync.Mutex
+	stats   ReadRepairStats
+	pending map[string]bool
+	closed  bool
+	jobs    chan repairJob
+	wg      sync.WaitGroup
+}
+
+// NewReadRepairer starts the workers of a ReadRepairer. Call Close on shutdown to let the
+// queued repairs finish.
+func NewReadRepairer(cfg ReadRepairConfig) *ReadRepairer {
+	if cfg.MaxConcurrent <= 0 {
+		cfg.MaxConcurrent = 4
+	}
+	if cfg.QueueSize <= 0 {
+		cfg.QueueSize = 1000
+	}
+	rr := &ReadRepairer{
+		cfg:     cfg,
+		rules:   map[string][]RepairRule{},
+		pending: map[string]bool{},
+		jobs:    make(chan repairJob, cfg.QueueSize),
+	}
+	for _, rule := range cfg.Rules {
+		rr.rules[rule.Collection] = append(rr.rules[rule.Collection], rule)
+	}
+	rr.update = rr.updateMissing
+	for i := 0; i < cfg.MaxConcurrent; i++ {
+		rr.wg.Add(1)
+		go rr.run()
+	}
+	return rr
+}
+
+// Wrap returns db with the reads of the collections that have rules checked for missing
+// fields.
+func (rr *ReadRepairer) Wrap(db MongoDatabase) MongoDatabase {
+	var read opentracing.SpanContext
+	if tdb, ok := db.(tracedMgoDatabase); ok {
+		if sp := opentracing.SpanFromContext(tdb.ctx); sp != nil {
+			read = sp.Context()
+		}
+	}
+	return readRepairDatabase{MongoDatabase: db, rr: rr, read: read}
+}
+
+// Stats returns the current repair counts.
+func (rr *ReadRepairer) Stats() ReadRepairStats {
+	rr.mu.Lock()
+	defer rr.mu.Unlock()
+	stats := rr.stats
+	stats.Pending = int64(len(rr.pending))
+	return stats
+}
+
+// Close stops accepting repairs and waits for the queued ones to be written.
+func (rr *ReadRepairer) Close() {
+	rr.mu.Lock()
+	if !rr.closed {
+		rr.closed = true
+		close(rr.jobs)
+	}
+	rr.mu.Unlock()
+	rr.wg.Wait()
+}
+
+// check queues repairs for the fields doc is missing. read is the span of the request that
+// read it, if it's known.
+func (rr *ReadRepairer) check(collection string, raw bson.Raw, read opentracing.SpanContext) {
+	rules := rr.rules[collection]
+	if len(rules) == 0 {
+		return
+	}
+	var doc bson.M
+	if err := raw.Unmarshal(&doc); err != nil {
+		return
+	}
+	for _, rule := range rules {
+		if hasField(doc, rule.Field) {
+			continue
+		}
+		rr.enqueue(repairJob{
+			rule: rule,
+			doc:  doc,
+			key:  fmt.Sprintf("%s|%v|%s", collection, doc["_id"], rule.Field),
+			read: read,
+		})
+	}
+}
+
+func (rr *ReadRepairer) enqueue(job repairJob) {
+	rr.mu.Lock()
+	defer rr.mu.Unlock()
+	rr.stats.Detected++
+	if rr.closed || rr.pending[job.key] {
+		rr.stats.Dropped++
+		return
+	}
+	select {
+	case rr.jobs <- job:
+		rr.pending[job.key] = true
+	default:
+		rr.stats.Dropped++
+	}
+}
+
+func (rr *ReadRepairer) run() {
+	defer rr.wg.Done()
+	for job := range rr.jobs {
+		err := rr.repair(job)
+		rr.mu.Lock()
+		delete(rr.pending, job.key)
+		if err != nil {
+			rr.stats.Failed++
+		} else {
+			rr.stats.Repaired++
+		}
+		rr.mu.Unlock()
+	}
+}
+
+func (rr *ReadRepairer) repair(job repairJob) error {
+	opts := []opentracing.StartSpanOption{}
+	if job.read != nil {
+		// the repair outlives the request that triggered it, which doesn't wait for it
+		opts = append(opts, opentracing.FollowsFrom(job.read))
+	}
+	sp := opentracing.StartSpan("read-repair", opts...)
+	defer sp.Finish()
+	sp.SetTag(TagCollection, job.rule.Collection)
+	sp.SetTag(TagRepairField, job.rule.Field)
+
+	value, err := job.rule.Compute(job.doc)
+	if err == nil {
+		err = rr.update(job.rule.Collection,
+			bson.M{"_id": job.doc["_id"], job.rule.Field: bson.M{"$exists": false}},
+			bson.M{"$set": bson.M{job.rule.Field: value}})
+	}
+	if err == mgo.ErrNotFound {
+		// the field was set since we read the document
+		err = nil
+	}
+	if err != nil {
+		logAndReturnErr(sp, err)
+		logger.New("mgohttp").ErrorD("mgohttp-read-repair-failed", logger.M{
+			"database":   rr.cfg.Database,
+			"collection": job.rule.Collection,
+			"field":      job.rule.Field,
+			"id":         fmt.Sprint(job.doc["_id"]),
+			"error":      err.Error(),
+		})
+	}
+	return err
+}
+
+func (rr *ReadRepairer) updateMissing(collection string, selector, update bson.M) error {
+	sess := rr.cfg.Sess.Copy()
+	defer sess.Close()
+	return sess.DB(rr.cfg.Database).C(collection).Update(selector, update)
+}
+
+// hasField reports whether doc has the dotted field.
+func hasField(doc bson.M, field string) bool {
+	parts := strings.Split(field, ".")
+	for i, part := range parts {
+		v, ok := doc[part]
+		if !ok {
+			return false
+		}
+		if i == len(parts)-1 {
+			return true
+		}
+		if doc, ok = v.(bson.M); !ok {
+			return false
+		}
+	}
+	return false
+}
+
+type readRepairDatabase struct {
+	MongoDatabase
+	rr   *ReadRepairer
+	read opentracing.SpanContext
+}
+
+func (d readRepairDatabase) C(name string) MongoCollection {
+	c := d.MongoDatabase.C(name)
+	if len(d.rr.rules[name]) == 0 {
+		return c
+	}
+	return readRepairCollection{MongoCollection: c, rr: d.rr, name: name, read: d.read}
+}
+
+type readRepairCollection struct {
+	MongoCollection
+	rr   *ReadRepairer
+	name string
+	read opentracing.SpanContext
+}
+
+func (c readRepairCollection) Find(query interface{}) MongoQuery {
+	return c.wrap(c.MongoCollection.Find(query))
+}
+
+func (c readRepairCollection) FindId(id bson.ObjectId) MongoQuery {
+	return c.wrap(c.MongoCollection.FindId(id))
+}
+
+func (c readRepairCollection) WithWriteConcern(safe *mgo.Safe) MongoCollection {
+	c.MongoCollection = c.MongoCollection.WithWriteConcern(safe)
+	return c
+}
+
+func (c readRepairCollection) wrap(q MongoQuery) MongoQuery {
+	return readRepairQuery{MongoQuery: q, rr: c.rr, collection: c.name, read: c.read}
+}
+
+// readRepairQuery reads the documents as raw BSON to see which fields they actually have,
+// before unmarshaling them into the caller's result. Queries with a projection aren't
+// checked, as the missing fields may just not be selected.
+type readRepairQuery struct {
+	MongoQuery
+	rr         *ReadRepairer
+	collection string
+	read       opentracing.SpanContext
+	projected  bool
+}
+
+func (q readRepairQuery) wrap(mq MongoQuery) MongoQuery {
+	q.MongoQuery = mq
+	return q
+}
+
+func (q readRepairQuery) Hint(indexKey ...string) MongoQuery {
+	return q.wrap(q.MongoQuery.Hint(indexKey...))
+}
+func (q readRepairQuery) Limit(n int) MongoQuery { return q.wrap(q.MongoQuery.Limit(n)) }
+func (q readRepairQuery) Skip(n int) MongoQuery  { return q.wrap(q.MongoQuery.Skip(n)) }
+func (q readRepairQuery) Batch(n int) MongoQuery { return q.wrap(q.MongoQuery.Batch(n)) }
+func (q readRepairQuery) Prefetch(p float64) MongoQuery {
+	return q.wrap(q.MongoQuery.Prefetch(p))
+}
+func (q readRepairQuery) SetMaxTime(d time.Duration) MongoQuery {
+	return q.wrap(q.MongoQuery.SetMaxTime(d))
+}
+func (q readRepairQuery) Select(selector interface{}) MongoQuery {
+	q.projected = true
+	return q.wrap(q.MongoQuery.Select(selector))
+}
+func (q readRepairQuery) Sort(fields ...string) MongoQuery {
+	return q.wrap(q.MongoQuery.Sort(fields...))
+}
+func (q readRepairQuery) And(selector interface{}) MongoQuery {
+	return q.wrap(q.MongoQuery.And(selector))
+}
+func (q readRepairQuery) WithCollation(c Collation) MongoQuery {
+	return q.wrap(q.MongoQuery.WithCollation(c))
+}
+
+func (q readRepairQuery) WithSnapshot() MongoQuery {
+	return q.wrap(q.MongoQuery.WithSnapshot())
+}
+func (q readRepairQuery) WithReadConcern(level string) MongoQuery {
+	return q.wrap(q.MongoQuery.WithReadConcern(level))
+}
+func (q readRepairQuery) WithReadPreference(p ReadPreference) MongoQuery {
+	return q.wrap(q.MongoQuery.WithReadPreference(p))
+}
+
+func (q readRepairQuery) One(result interface{}) error {
+	if q.projected {
+		return q.MongoQuery.One(result)
+	}
+	var raw bson.Raw
+	if err := q.MongoQuery.One(&raw); err != nil {
+		return err
+	}
+	q.rr.check(q.collection, raw, q.read)
+	return raw.Unmarshal(result)
+}
+
+func (q readRepairQuery) OneRaw() (bson.Raw, error) {
+	raw, err := q.MongoQuery.OneRaw()
+	if err == nil && !q.projected {
+		q.rr.check(q.collection, raw, q.read)
+	}
+	return raw, err
+}
+
+func (q readRepairQuery) AllRaw() ([]bson.Raw, error) {
+	docs, err := q.MongoQuery.AllRaw()
+	if err == nil && !q.projected {
+		for _, raw := range docs {
+			q.rr.check(q.collection, raw, q.read)
+		}
+	}
+	return docs, err
+}
+
+func (q readRepairQuery) All(result interface{}) error {
+	if q.projected {
+		return q.MongoQuery.All(result)
+	}
+	docs := []bson.Raw{}
+	if err := q.MongoQuery.All(&docs); err != nil {
+		return err
+	}
+	for _, raw := range docs {
+		q.rr.check(q.collection, raw, q.read)
+	}
+	return unmarshalAll(docs, result)
+}
+
+func (q readRepairQuery) Iter() MongoIter {
+	if q.projected {
+		return q.MongoQuery.Iter()
+	}
+	return readRepairIter{MongoIter: q.MongoQuery.Iter(), q: q}
+}
+
+type readRepairIter struct {
+	MongoIter
+	q readRepairQuery
+}
+
+func (i readRepairIter) Next(result interface{}) bool {
+	var raw bson.Raw
+	if !i.MongoIter.Next(&raw) {
+		return false
+	}
+	i.q.rr.check(i.q.collection, raw, i.q.read)
+	return raw.Unmarshal(result) == nil
+}
+
+func (i readRepairIter) All(result interface{}) error {
+	docs := []bson.Raw{}
+	if err := i.MongoIter.All(&docs); err != nil {
+		return err
+	}
+	for _, raw := range docs {
+		i.q.rr.check(i.q.collection, raw, i.q.read)
+	}
+	return unmarshalAll(docs, result)
+}
+
+// unmarshalAll unmarshals docs into the slice result points to, like mgo.Iter.All.
+func unmarshalAll(docs []bson.Raw, result interface{}) error {
+	resultv := reflect.ValueOf(result)
+	if resultv.Kind() != reflect.Ptr || resultv.Elem().Kind() != reflect.Slice {
+		panic("result argument must be a slice address")
+	}
+	slicev := resultv.Elem().Slice(0, 0)
+	elemt := slicev.Type().Elem()
+	for _, raw := range docs {
+		elemp := reflect.New(elemt)
+		if err := raw.Unmarshal(elemp.Interface()); err != nil {
+			return err
+		}
+		slicev = reflect.Append(slicev, elemp.Elem())
+	}
+	resultv.Elem().Set(slicev)
+	return nil
+}
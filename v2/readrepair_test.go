@@ -0,0 +1,102 @@
+package mgohttp
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	bson "gopkg.in/mgo.v2/bson"
+)
+
+// repairDatabase serves every collection from the same in-memory documents.
+type repairDatabase struct {
+	MongoDatabase
+	docs []bson.M
+}
+
+func (d repairDatabase) C(name string) MongoCollection { return repairCollection{docs: d.docs} }
+
+type repairCollection struct {
+	MongoCollection
+	docs []bson.M
+}
+
+func (c repairCollection) Find(query interface{}) MongoQuery { return repairQuery{docs: c.docs} }
+
+type repairQuery struct {
+	MongoQuery
+	docs []bson.M
+}
+
+func (q repairQuery) Sort(fields ...string) MongoQuery { return q }
+func (q repairQuery) One(result interface{}) error {
+	data, _ := bson.Marshal(q.docs[0])
+	return bson.Unmarshal(data, result)
+}
+func (q repairQuery) All(result interface{}) error {
+	docs := []bson.Raw{}
+	for _, doc := range q.docs {
+		data, _ := bson.Marshal(doc)
+		docs = append(docs, bson.Raw{Kind: 3, Data: data})
+	}
+	reflect.ValueOf(result).Elem().Set(reflect.ValueOf(docs))
+	return nil
+}
+
+func TestReadRepair(t *testing.T) {
+	rr := NewReadRepairer(ReadRepairConfig{
+		Database: testDBName,
+		Rules: []RepairRule{{
+			Collection: "users",
+			Field:      "name.full",
+			Compute: func(doc bson.M) (interface{}, error) {
+				name := doc["name"].(bson.M)
+				return name["first"].(string) + " " + name["last"].(string), nil
+			},
+		}},
+	})
+	updates := make(chan bson.M, 10)
+	release := make(chan struct{})
+	rr.update = func(collection string, selector, update bson.M) error {
+		<-release
+		assert.Equal(t, "users", collection)
+		assert.Equal(t, bson.M{"$exists": false}, selector["name.full"])
+		updates <- bson.M{"_id": selector["_id"], "update": update}
+		return nil
+	}
+
+	db := rr.Wrap(repairDatabase{docs: []bson.M{
+		{"_id": 1, "name": bson.M{"first": "Ada", "last": "Lovelace"}},
+		{"_id": 2, "name": bson.M{"first": "Alan", "last": "Turing", "full": "Alan Turing"}},
+	}})
+	type user struct {
+		ID   int `bson:"_id"`
+		Name struct {
+			First string `bson:"first"`
+		} `bson:"name"`
+	}
+	users := []user{}
+	require.NoError(t, db.C("users").Find(nil).Sort("_id").All(&users))
+	require.Len(t, users, 2)
+	assert.Equal(t, "Alan", users[1].Name.First)
+
+	var one user
+	require.NoError(t, db.C("users").Find(nil).One(&one))
+	assert.Equal(t, 1, one.ID)
+	assert.Equal(t, ReadRepairStats{Detected: 2, Dropped: 1, Pending: 1}, rr.Stats())
+
+	close(release)
+	rr.Close()
+	require.Len(t, updates, 1, "the second read of the pending document isn't queued again")
+	assert.Equal(t, bson.M{"_id": 1, "update": bson.M{"$set": bson.M{"name.full": "Ada Lovelace"}}}, <-updates)
+	assert.Equal(t, ReadRepairStats{Detected: 2, Dropped: 1, Repaired: 1}, rr.Stats())
+}
+
+func TestHasField(t *testing.T) {
+	doc := bson.M{"a": bson.M{"b": nil}, "c": 1}
+	assert.True(t, hasField(doc, "a.b"))
+	assert.True(t, hasField(doc, "c"))
+	assert.False(t, hasField(doc, "a.c"))
+	assert.False(t, hasField(doc, "c.d"))
+}
@@ -0,0 +1,41 @@
+package mgohttp
+
+import (
+	"context"
+	"errors"
+
+	mgo "gopkg.in/mgo.v2"
+)
+
+type opSessionKeyType struct{}
+
+var opSessionKey = opSessionKeyType{}
+
+// withOpSession records sess as the session the operations started from ctx run on: the
+// request's session, or one of its copies, e.g. a child session or that of WithTimeout.
+func withOpSession(ctx context.Context, sess *mgo.Session) context.Context {
+	return context.WithValue(ctx, opSessionKey, sess)
+}
+
+// refreshAfterSocketError refreshes the session the operation ran on when it lost its socket,
+// see SessionHandlerConfig.RefreshOnSocketErrors. The sockets of the requests that were
+// aborted are closed by the handler on purpose.
+func (o *opSpan) refreshAfterSocketError(err error) {
+	if !IsNetworkError(err) || errors.As(err, &RequestAbortedError{}) {
+		return
+	}
+	s, _ := o.ctx.Value(requestSessionKey).(*requestSession)
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sess := o.sess
+	if sess == nil {
+		sess = s.sessions[handlerDatabaseFromContext(o.ctx)]
+	}
+	if sess != nil && !s.closed {
+		sess.Refresh()
+		o.SetTag(TagSessionRefreshed, true)
+	}
+}
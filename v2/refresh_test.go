@@ -0,0 +1,78 @@
+package mgohttp
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/opentracing/opentracing-go/mocktracer"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	mgo "gopkg.in/mgo.v2"
+	bson "gopkg.in/mgo.v2/bson"
+)
+
+func TestRefreshOnSocketErrors(t *testing.T) {
+	serve := func(refresh bool, errs ...error) map[interface{}]int {
+		tracer := mocktracer.New()
+		handler := NewSessionHandler(SessionHandlerConfig{
+			Database:   testDBName,
+			Timeout:    handlerTimeout,
+			NewSession: func(ctx context.Context) (*mgo.Session, error) { return &mgo.Session{}, nil },
+			// the session isn't connected, the operations fail with the errors in place of mgo's
+			Interceptors: []Interceptor{func(ctx context.Context, op *OpInfo, next func() error) error {
+				err := errs[0]
+				errs = errs[1:]
+				return err
+			}},
+			Tracer:                tracer,
+			RefreshOnSocketErrors: refresh,
+			Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				users := FromContext(r.Context(), testDBName).DB("app").C("users")
+				for len(errs) > 0 {
+					users.Remove(bson.M{"_id": 1})
+				}
+			}),
+		})
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+		tags := map[interface{}]int{}
+		for _, sp := range tracer.FinishedSpans() {
+			if sp.OperationName == "remove" {
+				tags[sp.Tag(TagSessionRefreshed)]++
+			}
+		}
+		return tags
+	}
+
+	assert.Equal(t, map[interface{}]int{true: 1, nil: 2}, serve(true, io.EOF, mgo.ErrNotFound, nil))
+	assert.Equal(t, map[interface{}]int{nil: 2}, serve(false, io.EOF, nil))
+}
+
+func TestRefreshTheOperationsSession(t *testing.T) {
+	var sess *mgo.Session
+	var op *opSpan
+	handler := NewSessionHandler(SessionHandlerConfig{
+		Database:   testDBName,
+		Timeout:    handlerTimeout,
+		NewSession: func(ctx context.Context) (*mgo.Session, error) { return &mgo.Session{}, nil },
+		Tracer:     mocktracer.New(),
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ts := FromContext(r.Context(), testDBName).(tracedMgoSession)
+			sess = ts.sess
+			users := ts.DB("app").C("users").(tracedMgoCollection)
+			op, _ = startOp(users.ctx, "remove", "users")
+			assert.Same(t, sess, op.sess, "the request's own operations run on its session")
+
+			// a copy of the request's session, e.g. a child session, is the one refreshed
+			copied := &mgo.Session{}
+			op, _ = startOp(withOpSession(users.ctx, copied), "remove", "users")
+			assert.Same(t, copied, op.sess)
+			op.refreshAfterSocketError(io.EOF)
+		}),
+	})
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	require.NotNil(t, op)
+	assert.Equal(t, true, op.Span.(*mocktracer.MockSpan).Tag(TagSessionRefreshed))
+}
@@ -0,0 +1,68 @@
+package mgohttp
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	bson "gopkg.in/mgo.v2/bson"
+)
+
+// opComment returns the comment the queries of r carry: the request's own, see
+// SessionHandlerConfig.RequestComment, followed by a comment unique to the request for
+// KillOpsOnTimeout. It's empty when neither is set.
+func (c *SessionHandler) opComment(r *http.Request) string {
+	var parts []string
+	if c.cfg.RequestComment != nil {
+		if comment := c.cfg.RequestComment(r); comment != "" {
+			parts = append(parts, comment)
+		}
+	}
+	if c.cfg.KillOpsOnTimeout {
+		parts = append(parts, newOpComment())
+	}
+	return strings.Join(parts, " ")
+}
+
+// commentSelector returns selector with the $comment of ctx's operations, for the writes,
+// which mgo can't attach a comment to: the $comment query operator is reported by currentOp
+// and the profiler like the comment of a query. selector is returned as is without a comment
+// or when it already has one, and isn't modified.
+func commentSelector(ctx context.Context, selector interface{}) interface{} {
+	comment := opCommentFromContext(ctx)
+	if comment == "" {
+		return selector
+	}
+	switch sel := selector.(type) {
+	case nil:
+		return bson.M{"$comment": comment}
+	case bson.M:
+		return commentMap(selector, sel, comment)
+	case map[string]interface{}:
+		return commentMap(selector, sel, comment)
+	case bson.D:
+		for _, elem := range sel {
+			if elem.Name == "$comment" {
+				return selector
+			}
+		}
+		commented := make(bson.D, len(sel), len(sel)+1)
+		copy(commented, sel)
+		return append(commented, bson.DocElem{Name: "$comment", Value: comment})
+	default:
+		// a struct, or a document the $comment can't be added to without marshaling it
+		return bson.M{"$and": []interface{}{selector}, "$comment": comment}
+	}
+}
+
+func commentMap(selector interface{}, sel map[string]interface{}, comment string) interface{} {
+	if _, ok := sel["$comment"]; ok {
+		return selector
+	}
+	commented := make(bson.M, len(sel)+1)
+	for k, v := range sel {
+		commented[k] = v
+	}
+	commented["$comment"] = comment
+	return commented
+}
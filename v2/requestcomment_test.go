@@ -0,0 +1,54 @@
+package mgohttp
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	bson "gopkg.in/mgo.v2/bson"
+)
+
+func TestRequestComment(t *testing.T) {
+	var q tracedMongoQuery
+	handler := newDeferredTestHandler(func(w http.ResponseWriter, r *http.Request) {
+		q = FromContext(r.Context(), testDBName).DB(testDBName).C("users").Find(bson.M{"a": 1}).(tracedMongoQuery)
+	})
+	handler.cfg.RequestComment = func(r *http.Request) string { return r.Header.Get("X-Request-ID") }
+
+	r := httptest.NewRequest("GET", "/", nil)
+	r.Header.Set("X-Request-ID", "req-1")
+	handler.ServeHTTP(httptest.NewRecorder(), r)
+	assert.Equal(t, "req-1", q.spec.comment)
+	assert.Contains(t, q.spec.findCommand(0, false), bson.DocElem{Name: "comment", Value: "req-1"})
+
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	assert.Empty(t, q.spec.comment, "the request has no ID")
+
+	handler.cfg.KillOpsOnTimeout = true
+	handler.ServeHTTP(httptest.NewRecorder(), r)
+	assert.True(t, strings.HasPrefix(q.spec.comment, "req-1 mgohttp-"), q.spec.comment)
+}
+
+func TestCommentSelector(t *testing.T) {
+	assert.Equal(t, bson.M{"a": 1}, commentSelector(context.Background(), bson.M{"a": 1}), "no comment")
+
+	ctx := withOpComment(context.Background(), "req-1")
+	selector := bson.M{"a": 1}
+	assert.Equal(t, bson.M{"a": 1, "$comment": "req-1"}, commentSelector(ctx, selector))
+	assert.Equal(t, bson.M{"a": 1}, selector, "the caller's selector isn't modified")
+	assert.Equal(t, bson.M{"$comment": "req-1"}, commentSelector(ctx, nil))
+	assert.Equal(t, bson.M{"$comment": "mine"}, commentSelector(ctx, bson.M{"$comment": "mine"}))
+	assert.Equal(t,
+		bson.D{{Name: "a", Value: 1}, {Name: "$comment", Value: "req-1"}},
+		commentSelector(ctx, bson.D{{Name: "a", Value: 1}}))
+
+	type byName struct{ Name string }
+	commented, ok := commentSelector(ctx, byName{"ada"}).(bson.M)
+	require.True(t, ok)
+	assert.Equal(t, "req-1", commented["$comment"])
+	assert.Equal(t, []interface{}{byName{"ada"}}, commented["$and"])
+}
@@ -0,0 +1,92 @@
+package mgohttp
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// OpStats are the number and cumulative duration of operations.
+type OpStats struct {
+	Count    int
+	Duration time.Duration
+}
+
+// OpKey identifies the operations op on collection, e.g. {"users", "find"}. Collection is
+// empty for database and session level operations.
+type OpKey struct {
+	Collection string
+	Op         string
+}
+
+// RequestStats are the operations a request ran so far, see StatsFromContext.
+type RequestStats struct {
+	// OpStats are the totals of the request.
+	OpStats
+	// Ops breaks down the totals by collection and operation.
+	Ops map[OpKey]OpStats
+}
+
+// requestStats collects the RequestStats of a request.
+type requestStats struct {
+	mu    sync.Mutex
+	stats RequestStats
+}
+
+func (s *requestStats) observe(collection, op string, elapsed time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.stats.Count++
+	s.stats.Duration += elapsed
+	if s.stats.Ops == nil {
+		s.stats.Ops = map[OpKey]OpStats{}
+	}
+	key := OpKey{Collection: collection, Op: op}
+	ops := s.stats.Ops[key]
+	ops.Count++
+	ops.Duration += elapsed
+	s.stats.Ops[key] = ops
+}
+
+type statsKeyType struct{}
+
+var statsKey = statsKeyType{}
+
+// WithStats returns a context collecting the RequestStats of the request it's the context
+// of, for middlewares wrapping the SessionHandler, which can't see the context it gives the
+// handlers, e.g. access logs:
+//
+//	r = r.WithContext(mgohttp.WithStats(r.Context()))
+//	next.ServeHTTP(w, r)
+//	stats := mgohttp.StatsFromContext(r.Context())
+//	log.InfoD("request", logger.M{"mongo_ops": stats.Count, "mongo_ms": stats.Duration.Milliseconds()})
+func WithStats(ctx context.Context) context.Context {
+	if _, ok := ctx.Value(statsKey).(*requestStats); ok {
+		return ctx
+	}
+	return context.WithValue(ctx, statsKey, &requestStats{})
+}
+
+// StatsFromContext returns the counts and cumulative durations of the operations the request
+// of ctx ran so far, by collection and operation, to spot N+1 query patterns. They're empty
+// when ctx comes neither from a SessionHandler nor from WithStats.
+func StatsFromContext(ctx context.Context) RequestStats {
+	s, _ := ctx.Value(statsKey).(*requestStats)
+	if s == nil {
+		return RequestStats{}
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stats := RequestStats{OpStats: s.stats.OpStats, Ops: make(map[OpKey]OpStats, len(s.stats.Ops))}
+	for k, v := range s.stats.Ops {
+		stats.Ops[k] = v
+	}
+	return stats
+}
+
+// observeStats records the operation in the stats of the request of ctx, if any.
+func observeStats(ctx context.Context, collection, op string, elapsed time.Duration) {
+	if s, _ := ctx.Value(statsKey).(*requestStats); s != nil {
+		s.observe(collection, op, elapsed)
+	}
+}
@@ -0,0 +1,46 @@
+package mgohttp
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	mgo "gopkg.in/mgo.v2"
+	bson "gopkg.in/mgo.v2/bson"
+)
+
+func TestStatsFromContext(t *testing.T) {
+	var inner RequestStats
+	handler := NewSessionHandler(SessionHandlerConfig{
+		Database:   testDBName,
+		Timeout:    handlerTimeout,
+		NewSession: func(ctx context.Context) (*mgo.Session, error) { return &mgo.Session{}, nil },
+		// the session isn't connected, the operations must not reach it
+		Interceptors: []Interceptor{func(ctx context.Context, op *OpInfo, next func() error) error {
+			return errors.New("rejected")
+		}},
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			db := FromContext(r.Context(), testDBName).DB("app")
+			for i := 0; i < 3; i++ {
+				db.C("users").Remove(bson.M{"_id": i})
+			}
+			db.C("orgs").Remove(bson.M{"_id": 1})
+			inner = StatsFromContext(r.Context())
+		}),
+	})
+
+	r := httptest.NewRequest("GET", "/", nil)
+	r = r.WithContext(WithStats(r.Context()))
+	handler.ServeHTTP(httptest.NewRecorder(), r)
+	outer := StatsFromContext(r.Context())
+
+	assert.Equal(t, 4, inner.Count)
+	assert.Equal(t, 3, inner.Ops[OpKey{Collection: "users", Op: "remove"}].Count)
+	assert.Equal(t, 1, inner.Ops[OpKey{Collection: "orgs", Op: "remove"}].Count)
+	assert.Equal(t, inner, outer, "the middleware sees the handler's operations")
+
+	assert.Equal(t, RequestStats{}, StatsFromContext(context.Background()))
+}
@@ -0,0 +1,108 @@
+package mgohttp
+
+import (
+	"context"
+	"math/rand"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Rollout names a wrapper behavior that Rollouts can restrict to a share of the requests.
+type Rollout string
+
+// The behaviors that can be rolled out gradually. Each still has to be enabled in the
+// SessionHandlerConfig.
+const (
+	RolloutDeferUntilSession   Rollout = "defer-until-session"
+	RolloutInSplit             Rollout = "in-split"
+	RolloutExplainSlowQueries  Rollout = "explain-slow-queries"
+	RolloutRecoverDriverPanics Rollout = "recover-driver-panics"
+)
+
+// Rollouts restricts behaviors enabled in the SessionHandlerConfig to a percentage of the
+// requests, so they can be rolled out safely. Each request is sampled once, when it starts.
+// Behaviors without a percentage apply to every request. The percentages can be changed at
+// runtime with Set, e.g. from an admin endpoint.
+type Rollouts struct {
+	mu      sync.RWMutex
+	percent map[Rollout]int
+}
+
+// NewRollouts returns Rollouts applying each behavior to percent (0 to 100) of the requests.
+func NewRollouts(percent map[Rollout]int) *Rollouts {
+	r := &Rollouts{percent: map[Rollout]int{}}
+	for b, p := range percent {
+		r.Set(b, p)
+	}
+	return r
+}
+
+// Set applies the behavior to percent (0 to 100) of the requests that start from now on.
+func (r *Rollouts) Set(b Rollout, percent int) {
+	if percent < 0 {
+		percent = 0
+	} else if percent > 100 {
+		percent = 100
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.percent[b] = percent
+}
+
+// Percent returns the percentage of the requests the behavior applies to.
+func (r *Rollouts) Percent(b Rollout) int {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if p, ok := r.percent[b]; ok {
+		return p
+	}
+	return 100
+}
+
+// rolloutSample records the behaviors a request was sampled out of.
+type rolloutSample map[Rollout]bool
+
+// sample decides which behaviors apply to a new request. It's safe to call on nil Rollouts.
+func (r *Rollouts) sample() rolloutSample {
+	if r == nil {
+		return nil
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	var excluded rolloutSample
+	for b, p := range r.percent {
+		if p < 100 && rand.Intn(100) >= p {
+			if excluded == nil {
+				excluded = rolloutSample{}
+			}
+			excluded[b] = true
+		}
+	}
+	return excluded
+}
+
+func (s rolloutSample) applies(b Rollout) bool {
+	return !s[b]
+}
+
+// String lists the excluded behaviors, for the span tag.
+func (s rolloutSample) String() string {
+	names := make([]string, 0, len(s))
+	for b := range s {
+		names = append(names, string(b))
+	}
+	sort.Strings(names)
+	return strings.Join(names, "|")
+}
+
+type rolloutKeyType struct{}
+
+// rolloutKey is used to hand the request's rolloutSample down to the traced wrappers.
+var rolloutKey = rolloutKeyType{}
+
+// rolledOut reports whether the behavior applies to the request of ctx.
+func rolledOut(ctx context.Context, b Rollout) bool {
+	s, _ := ctx.Value(rolloutKey).(rolloutSample)
+	return s.applies(b)
+}
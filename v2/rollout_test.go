@@ -0,0 +1,50 @@
+package mgohttp
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	mgo "gopkg.in/mgo.v2"
+	bson "gopkg.in/mgo.v2/bson"
+)
+
+func TestRollouts(t *testing.T) {
+	r := NewRollouts(map[Rollout]int{RolloutInSplit: 150, RolloutExplainSlowQueries: 0})
+	assert.Equal(t, 100, r.Percent(RolloutInSplit))
+	assert.Equal(t, 0, r.Percent(RolloutExplainSlowQueries))
+	assert.Equal(t, 100, r.Percent(RolloutRecoverDriverPanics))
+
+	s := r.sample()
+	assert.True(t, s.applies(RolloutInSplit))
+	assert.False(t, s.applies(RolloutExplainSlowQueries))
+	assert.True(t, s.applies(RolloutRecoverDriverPanics))
+	assert.Equal(t, "explain-slow-queries", s.String())
+
+	r.Set(RolloutExplainSlowQueries, 100)
+	assert.Empty(t, r.sample())
+
+	r.Set(RolloutInSplit, 50)
+	sampledIn := 0
+	for i := 0; i < 1000; i++ {
+		if r.sample().applies(RolloutInSplit) {
+			sampledIn++
+		}
+	}
+	assert.InDelta(t, 500, sampledIn, 150)
+
+	var none *Rollouts
+	assert.True(t, none.sample().applies(RolloutInSplit))
+}
+
+func TestRolloutExcludesRequest(t *testing.T) {
+	ctx := context.WithValue(context.Background(), handlerKey, &SessionHandler{cfg: SessionHandlerConfig{RecoverDriverPanics: true}})
+	ctx = context.WithValue(ctx, rolloutKey, rolloutSample{RolloutRecoverDriverPanics: true})
+	// the collection has no session, so mgo panics on any operation
+	c := tracedMgoCollection{
+		collectionName: "events",
+		collection:     &mgo.Collection{Name: "events", Database: &mgo.Database{Name: testDBName}},
+		ctx:            ctx,
+	}
+	assert.Panics(t, func() { c.Insert(bson.M{"a": 1}) })
+}
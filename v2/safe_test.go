@@ -0,0 +1,60 @@
+package mgohttp
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/opentracing/opentracing-go/mocktracer"
+	"github.com/stretchr/testify/assert"
+	mgo "gopkg.in/mgo.v2"
+)
+
+func TestSafe(t *testing.T) {
+	tracer := mocktracer.New()
+	sessions := map[string]*mgo.Session{}
+	newSession := func(name string) func(ctx context.Context) (*mgo.Session, error) {
+		return func(ctx context.Context) (*mgo.Session, error) {
+			sessions[name] = &mgo.Session{}
+			return sessions[name], nil
+		}
+	}
+	majority := &mgo.Safe{WMode: "majority"}
+	journaled := &mgo.Safe{J: true}
+	handler := NewSessionHandler(SessionHandlerConfig{
+		Database:   testDBName,
+		Timeout:    handlerTimeout,
+		NewSession: newSession(testDBName),
+		Databases: []DatabaseConfig{
+			{Database: "audit", NewSession: newSession("audit"), Safe: journaled},
+			{Database: "cache", NewSession: newSession("cache")},
+		},
+		Safe:   majority,
+		Tracer: tracer,
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			FromContext(r.Context(), testDBName)
+			FromContext(r.Context(), "audit")
+			FromContext(r.Context(), "cache").SetSafe(&mgo.Safe{W: 2, WTimeout: 100})
+		}),
+	})
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+
+	assert.Equal(t, "majority", sessions[testDBName].Safe().WMode)
+	assert.True(t, sessions["audit"].Safe().J)
+	assert.Equal(t, 2, sessions["cache"].Safe().W)
+
+	concerns := []interface{}{}
+	for _, sp := range tracer.FinishedSpans() {
+		if c := sp.Tag(TagWriteConcern); c != nil {
+			concerns = append(concerns, c)
+		}
+	}
+	assert.ElementsMatch(t, []interface{}{"w=majority", "j=true", "w=2,wtimeout=100"}, concerns)
+}
+
+func TestSafeName(t *testing.T) {
+	assert.Equal(t, "unacknowledged", safeName(nil))
+	assert.Equal(t, "acknowledged", safeName(&mgo.Safe{}))
+	assert.Equal(t, "w=majority,j=true,fsync=true", safeName(&mgo.Safe{WMode: "majority", J: true, FSync: true}))
+}
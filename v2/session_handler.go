@@ -0,0 +1,1067 @@
+package mgohttp
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"runtime"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/Clever/mgohttp/v2/internal"
+	opentracing "github.com/opentracing/opentracing-go"
+	ext "github.com/opentracing/opentracing-go/ext"
+	"gopkg.in/Clever/kayvee-go.v6/logger"
+	mgo "gopkg.in/mgo.v2"
+)
+
+// SessionHandlerConfig dictates how we inject mongo sessions into the context
+// of the HTTP request.
+type SessionHandlerConfig struct {
+	Sess     *mgo.Session
+	Database string
+	// Timeout bounds each request's use of Mongo. It's shortened to the request's context
+	// deadline when that's earlier, and can be overridden per request with WithRequestTimeout.
+	Timeout time.Duration
+	Handler http.Handler
+
+	// URL, when Sess isn't set, is the mongodb:// or mongodb+srv:// URL of the servers the
+	// handler dials with DialOptions, see Dial. It's dialed by the first request rather than
+	// by NewSessionHandler, so the handler can be built while Mongo is down, the requests
+	// failing to get their session until it's up. The session is re-dialed once the
+	// operations keep losing their connection. Shutdown closes it.
+	URL         string
+	DialOptions []DialOption
+
+	// NewSession, when set, creates the session of each request in place of copying Sess,
+	// e.g. to pick per-tenant credentials or to hand out pre-warmed sessions. The session is
+	// closed once the request is done. When it fails, every operation on the request's
+	// session returns the error.
+	NewSession func(ctx context.Context) (*mgo.Session, error)
+	// Databases are served alongside Database by the same middleware, sharing its timeout
+	// and the request's root span. Use FromContext with their name to get their session.
+	Databases []DatabaseConfig
+	// Driver, when set, opens the sessions of the handler's databases in place of mgo, e.g.
+	// the official driver with NewMongoDriver, so handlers can be moved off mgo without being
+	// rewritten. Sess, URL, NewSession and SessionPool are left unused, and so are the
+	// settings specific to mgo's sessions: NearestRouter, SocketTimeoutFunc,
+	// RefreshOnSocketErrors, InSplitSize, KillOpsOnTimeout and Mirror. The Databases with their
+	// own Sess or NewSession keep using mgo, and the ones with their own Driver use it.
+	Driver Driver
+
+	// SelectorLimits optionally guards against pathologically complex selectors.
+	SelectorLimits SelectorLimits
+	// InSplitSize, when set, splits queries with an $in on _id of more than InSplitSize
+	// elements into several queries of at most InSplitSize elements each and merges the
+	// results. Applies to Find (except when sorted), Count, UpdateAll and RemoveAll. The $in
+	// of other fields isn't split: a document whose array field has values in several chunks
+	// would be read, counted and updated once per chunk.
+	InSplitSize int
+	// WarnOnUnanchoredRegex logs a warning, with the calling function, for every query that
+	// filters on a case-insensitive regex not anchored with "^". These are always tagged on
+	// the span.
+	WarnOnUnanchoredRegex bool
+	// HealthMonitor, when set, is fed the latency and outcome of every operation.
+	HealthMonitor *HealthMonitor
+	// ReadPreference, when set, routes the reads of every session to the matching replica
+	// set members. It can be overridden per request with WithRequestReadPreference and per
+	// query with MongoQuery.WithReadPreference.
+	ReadPreference *ReadPreference
+	// NearestRouter, when set, routes reads with the mgo.Nearest mode to the replica set
+	// member matching their tag sets it measured the lowest latency to.
+	NearestRouter *NearestRouter
+	// ReadOnlyRoutes, when set, gives the sessions of the GET and HEAD requests on its paths
+	// their own consistency mode, e.g. mgo.SecondaryPreferred, while the others keep the
+	// handler's. It takes precedence over ReadPreference's mode, not over ConsistencyOverride.
+	ReadOnlyRoutes *ReadOnlyRoutes
+	// ConsistencyOverride, when set, allows callers to pick the session's consistency mode
+	// with a request header.
+	ConsistencyOverride *ConsistencyOverride
+	// DeferUntilSession serves requests on the calling goroutine, without buffering the
+	// response, and only starts the timeout when the handler first calls FromContext, so
+	// requests that never use Mongo pay next to nothing. When the timeout hits, the session is
+	// closed and the error status is written if the handler hasn't written its status yet, but
+	// the handler isn't preempted: the response is only complete once it returns.
+	DeferUntilSession bool
+	// SlowQueryThreshold, when set, logs every operation that takes longer, with the tags
+	// added to the request with WithQueryTag.
+	SlowQueryThreshold time.Duration
+	// ExplainSlowQueries runs explain for the queries slower than SlowQueryThreshold, and
+	// tags their span with the plan used (index or collection scan) and the number of
+	// documents examined. The explain runs after the query, within the request.
+	ExplainSlowQueries bool
+	// RecoverDriverPanics turns panics raised by mgo during an operation (e.g. using a
+	// session after the timeout closed it) into DriverPanicErrors returned by the operation,
+	// with the stack logged, rather than panicking the handler. Panics elsewhere in the
+	// handler are left alone.
+	RecoverDriverPanics bool
+	// RefreshOnSocketErrors refreshes the request's session after an operation lost its
+	// socket, e.g. to a connection reset, so that the request's next operations get a new
+	// one rather than failing on the dead socket as well. The operations of a child session,
+	// or of a session of WithTimeout or of a read preference, refresh that session instead.
+	RefreshOnSocketErrors bool
+	// LimitPolicy, when set, requires a Limit on Find().All() queries.
+	LimitPolicy *LimitPolicy
+	// Rollouts, when set, restricts the behaviors enabled above to a share of the requests.
+	Rollouts *Rollouts
+	// Tracer, when set, records the spans of the handler's sessions in place of the global
+	// tracer. To emit them with OpenTelemetry, use the tracer of its OpenTracing bridge
+	// (go.opentelemetry.io/otel/bridge/opentracing).
+	Tracer opentracing.Tracer
+	// ErrorMapper, when set, writes the response when the handler has to answer a request
+	// itself, e.g. with ErrRequestTimeout. Otherwise it answers 503 with an empty body.
+	// Handlers can answer their own errors in the same way with WriteError.
+	ErrorMapper ErrorMapper
+	// SocketTimeoutFunc, when set, picks the socket timeout of the request's session each time
+	// the handler gets it with FromContext, from the time remaining until the request times
+	// out. E.g. returning remaining keeps a run of sequential queries within the request's
+	// budget. Otherwise every query may take up to the full timeout.
+	SocketTimeoutFunc func(r *http.Request, remaining time.Duration) time.Duration
+	// Metrics, when set, exports Prometheus metrics for the handler's sessions and operations.
+	Metrics *Metrics
+	// PartialResponseGrace, when set, lets handlers answer with partial results when the
+	// timeout hits: BudgetExpired turns true, iterators stop returning documents, and the
+	// handler has the grace period to write its response before the handler times out as
+	// usual.
+	PartialResponseGrace time.Duration
+	// QueryLogging, when set, logs the values of the selectors, updates and projections on
+	// the spans, in full or hashed per field. By default only the field names are logged.
+	QueryLogging *QueryLogging
+	// IndexPolicy, when set, forces the index builds started during requests to run in the
+	// background, limits how many run at once, or defers them to startup.
+	IndexPolicy *IndexPolicy
+	// ConvertHexIDs has FindId, UpdateId and RemoveId convert ids built from their hex
+	// representation with bson.ObjectId(s), which would otherwise match no document.
+	ConvertHexIDs bool
+	// Safe, when set, is the write concern of the request's sessions, e.g. majority or
+	// journaled writes. Otherwise they keep the one of the session they were copied from.
+	// Handlers can change it for a request with MongoSession.SetSafe.
+	Safe *mgo.Safe
+	// MaxConcurrentSessions, when set, caps the sessions open at once across the handler's
+	// requests, against connection storms in load spikes. Requests beyond it wait for a
+	// session until they time out, then get ErrTooManySessions in place of their session.
+	// The sessions of NewChildSession count against it.
+	MaxConcurrentSessions int
+	// FailFastWhenThrottled has requests beyond MaxConcurrentSessions get ErrTooManySessions
+	// right away rather than wait.
+	FailFastWhenThrottled bool
+	// SessionPool, when set, provides the sessions that would otherwise be copied from Sess:
+	// requests check one out of the pool and return it when they're done, rather than copy
+	// and close one each time. The sessions of requests that time out are closed rather than
+	// returned, since their handler may still be using them.
+	SessionPool *SessionPool
+	// OpLimiter, when set, caps the concurrent executions of expensive operations.
+	OpLimiter *OpLimiter
+	// StreamResponses has the response written through as soon as the handler writes its
+	// status, rather than buffered until the handler returns, so large responses take constant
+	// memory. A request that times out once its status is written can't be answered with
+	// ErrRequestTimeout anymore: the response is cut short instead.
+	StreamResponses bool
+	// TimeoutStatus, when set, is the status of the response to requests that time out, e.g.
+	// 504. Otherwise it's the one ErrorMapper maps ErrRequestTimeout to, or 503.
+	TimeoutStatus int
+	// TimeoutResponse, when set, writes the response to requests that time out in place of
+	// the ErrorMapper, e.g. the service's JSON error envelope and a Retry-After header. The
+	// status is the TimeoutStatus unless it writes its own.
+	TimeoutResponse func(w http.ResponseWriter, r *http.Request)
+	// OptionalMinBudget is the time a request must have left for Optional to run its query.
+	OptionalMinBudget time.Duration
+	// IterationHeartbeat, when set, has the cursors of MongoQuery.Iter that run longer log
+	// their progress every IterationHeartbeat, the documents read so far and the elapsed time,
+	// on their span and as mgohttp-iteration-heartbeat logs. A cursor that's making progress
+	// keeps logging, a hung one goes quiet.
+	IterationHeartbeat time.Duration
+	// DocumentSizeCheck, when set, checks that updates don't grow their document past Mongo's
+	// size limit before they're sent.
+	DocumentSizeCheck *DocumentSizeCheck
+	// Interceptors run around every operation of the traced wrappers, the first one
+	// outermost. See Interceptor.
+	Interceptors []Interceptor
+	// KillOpsOnTimeout kills the queries a request left running on the servers when it times
+	// out, rather than let them run until their socket times out. The request's queries are
+	// tagged with a comment, and the operations carrying it are found with currentOp and
+	// killed with killOp, which need the clusterMonitor and killop privileges. Counts and
+	// aggregations can't carry a comment with mgo, and writes only in their selector, where
+	// currentOp isn't searched: they're left running.
+	KillOpsOnTimeout bool
+	// RequestComment, when set, returns the comment of the operations of a request, e.g. its
+	// request ID or trace ID, so db.currentOp and the profiler's entries can be traced back to
+	// it. Queries carry it as their comment, updates and removes as the $comment of their
+	// selector; counts and aggregations can't carry one with mgo. With KillOpsOnTimeout, the
+	// comment unique to the request follows it.
+	RequestComment func(r *http.Request) string
+	// Mirror, when set, replays a sample of the reads on a shadow cluster, see Mirror.
+	Mirror *Mirror
+	// SpanNamer, when set, names the span of each caller of FromContext after the request,
+	// e.g. its route, in place of the calling function. Returning "" falls back on the
+	// calling function.
+	SpanNamer func(r *http.Request) string
+	// CallerSkipPrefixes are the prefixes of the functions skipped when looking for the
+	// function calling mgohttp, e.g. "github.com/acme/svc/db." for a service's own helpers
+	// around mgohttp, so the spans and logs name the application's functions instead. The
+	// functions of mgohttp and of the runtime are always skipped.
+	CallerSkipPrefixes []string
+	// OpSpanSampling, when set, is the share of the requests, from 0 to 1, whose operations get
+	// spans, to cut the cost of tracing high-traffic endpoints. The other requests only get
+	// their "mgohttp" span, tagged with TagOpSpansSampledOut. By default every request's
+	// operations get spans.
+	OpSpanSampling float64
+	// DisableOpSpans only records the "mgohttp" span of the requests, never the spans of the
+	// callers and operations.
+	DisableOpSpans bool
+	// ETagRoutes, when set, picks the GET endpoints whose responses get a weak ETag computed
+	// from the results their queries read, e.g. with PathPrefix, and answers 304 Not Modified
+	// when the request's If-None-Match matches, for polling clients. The response is still
+	// built: only its transfer is saved. Responses that ran a write or another operation whose
+	// result isn't digested (only the One, All, Count and Iter of queries are), that aren't
+	// 200s, or whose handler set its own ETag are left alone. Doesn't apply to
+	// StreamResponses or DeferUntilSession.
+	ETagRoutes func(r *http.Request) bool
+	// DebugHeader, when set, names the request header that turns on verbose diagnostics for
+	// that request only, to inspect one production request without changing the handler's
+	// settings: the values of its queries are logged on the spans, every query is explained,
+	// each operation is logged, and its operations get spans whatever the OpSpanSampling.
+	// The header's value must be one of DebugTokens.
+	DebugHeader string
+	// DebugTokens are the values of the DebugHeader allowed to turn on verbose diagnostics.
+	DebugTokens []string
+	// MaxQueriesPerRequest, when positive, is the number of operations a request may run
+	// before it's over its query budget, e.g. a handler querying in a loop. The first
+	// operation over it is logged as mgohttp-query-budget-exceeded and tags the root span.
+	MaxQueriesPerRequest int
+	// AbortOverQueryBudget fails the operations over MaxQueriesPerRequest with a
+	// QueryBudgetExceededError rather than running them.
+	AbortOverQueryBudget bool
+}
+
+// DatabaseConfig is an additional database served by a SessionHandler. Its session is opened
+// by its Driver, created with NewSession or copied from Sess, or else in the same way as the
+// handler's Database.
+type DatabaseConfig struct {
+	Database   string
+	Sess       *mgo.Session
+	NewSession func(ctx context.Context) (*mgo.Session, error)
+	// Driver, when set, opens the sessions of the database in place of mgo, see
+	// SessionHandlerConfig.Driver.
+	Driver Driver
+	// Safe, when set, overrides the handler's Safe for the database.
+	Safe *mgo.Safe
+}
+
+// handlerDatabase is a database served by a SessionHandler. Its session is created by the
+// handler's parent session or NewSession when it has neither.
+type handlerDatabase struct {
+	name          string
+	parentSession mgoSessionCopier
+	newSession    func(ctx context.Context) (*mgo.Session, error)
+	// driver opens the sessions of the database in place of mgo, when set
+	driver Driver
+	safe   *mgo.Safe
+	// buildInfo caches the version of the cluster behind parentSession or newSession, nil
+	// when the database uses the handler's sessions, see SessionHandler.buildInfoCache
+	buildInfo *buildInfoCache
+}
+
+type mgoSessionCopier interface {
+	Copy() *mgo.Session
+}
+
+// SessionHandler is an HTTP middleware that injects a new copied mongo session
+// into the Context of the request.
+// This middleware handles timing out inflight Mongo requests.
+type SessionHandler struct {
+	// cfg is the configuration the handler was created with, the fields below are derived
+	// from it
+	cfg           SessionHandlerConfig
+	parentSession mgoSessionCopier
+	databases     []handlerDatabase // database first
+	errorCode     int               // this is defaulted to 503, only the tests can override
+	sessionSlots  chan struct{}
+
+	buildInfo      buildInfoCache
+	stats          handlerStats
+	sessionTracker sessionTracker
+}
+
+type handlerStats struct {
+	inFlight  int64
+	timedOut  int64
+	cancelled int64
+	abandoned int64
+	throttled int64
+}
+
+// SessionHandlerStats counts the requests served by a SessionHandler.
+type SessionHandlerStats struct {
+	// InFlight is the number of requests being served.
+	InFlight int64
+	// TimedOut counts the requests that hit the timeout.
+	TimedOut int64
+	// Cancelled counts the requests whose client went away before they were served.
+	Cancelled int64
+	// Abandoned is the number of wrapped handlers still running after their request timed
+	// out or was cancelled. Each holds a goroutine: a number that keeps growing means
+	// handlers don't return.
+	Abandoned int64
+	// Throttled counts the requests that had to wait for a session, or didn't get one,
+	// because of MaxConcurrentSessions.
+	Throttled int64
+}
+
+// Stats returns the current request counts of the handler.
+func (c *SessionHandler) Stats() SessionHandlerStats {
+	return SessionHandlerStats{
+		InFlight:  atomic.LoadInt64(&c.stats.inFlight),
+		TimedOut:  atomic.LoadInt64(&c.stats.timedOut),
+		Cancelled: atomic.LoadInt64(&c.stats.cancelled),
+		Abandoned: atomic.LoadInt64(&c.stats.abandoned),
+		Throttled: atomic.LoadInt64(&c.stats.throttled),
+	}
+}
+
+type handlerKeyType struct{}
+
+// handlerKey is used to hand the SessionHandler that created a session down to the traced
+// wrappers, for access to per-handler state.
+var handlerKey = handlerKeyType{}
+
+// handlerFromContext returns the SessionHandler that injected the session in use, or nil when
+// the session came from elsewhere (e.g. mgohttptest).
+func handlerFromContext(ctx context.Context) *SessionHandler {
+	h, _ := ctx.Value(handlerKey).(*SessionHandler)
+	return h
+}
+
+// NewSessionHandler returns a new SessionHandler, the http.Handler injecting the sessions of
+// cfg's databases into the context of the requests.
+func NewSessionHandler(cfg SessionHandlerConfig) http.Handler {
+	databases := []handlerDatabase{{name: cfg.Database, driver: cfg.Driver, safe: cfg.Safe}}
+	for _, db := range cfg.Databases {
+		safe := db.Safe
+		if safe == nil {
+			safe = cfg.Safe
+		}
+		hdb := handlerDatabase{name: db.Database, newSession: db.NewSession, driver: db.Driver, safe: safe}
+		if db.Sess != nil {
+			hdb.parentSession = db.Sess
+		}
+		if db.Sess != nil || db.NewSession != nil {
+			// it may be another cluster, of another version
+			hdb.buildInfo = &buildInfoCache{}
+		} else if db.Driver == nil {
+			hdb.driver = cfg.Driver
+		}
+		databases = append(databases, hdb)
+	}
+	var sessionSlots chan struct{}
+	if cfg.MaxConcurrentSessions > 0 {
+		sessionSlots = make(chan struct{}, cfg.MaxConcurrentSessions)
+	}
+	var parentSession mgoSessionCopier = cfg.Sess
+	if cfg.Sess == nil && cfg.URL != "" {
+		parent := newDialedParent(cfg.URL, cfg.DialOptions)
+		parent.metrics = cfg.Metrics
+		parentSession = parent
+	}
+	return &SessionHandler{
+		cfg:           cfg,
+		databases:     databases,
+		parentSession: parentSession,
+		errorCode:     http.StatusServiceUnavailable,
+		sessionSlots:  sessionSlots,
+	}
+}
+
+// callerName is getCallerName, also skipping the handler's CallerSkipPrefixes. c may be nil.
+func (c *SessionHandler) callerName() string {
+	if c == nil {
+		return getCallerName()
+	}
+	return getCallerName(c.cfg.CallerSkipPrefixes...)
+}
+
+// getCallerName retrieves the name of the calling function, skipping the functions with one
+// of skipPrefixes.
+// rough source: https://golang.org/pkg/runtime/#example_Frames
+func getCallerName(skipPrefixes ...string) string {
+	// Ask runtime.Callers for up to 10 pcs, including runtime.Callers itself.
+	pc := make([]uintptr, 10)
+	n := runtime.Callers(0, pc)
+	if n == 0 {
+		// No pcs available. Stop now.
+		// This can happen if the first argument to runtime.Callers is large.
+		return ""
+	}
+
+	pc = pc[:n] // pass only valid pcs to runtime.CallersFrames
+	frames := runtime.CallersFrames(pc)
+
+	// Loop to get frames.
+	// A fixed number of pcs can expand to an indefinite number of Frames.
+	for {
+		frame, more := frames.Next()
+		if strings.Contains(frame.Function, "mgohttp") || strings.Contains(frame.Function, "runtime") ||
+			hasAnyPrefix(frame.Function, skipPrefixes) {
+			continue
+		} else if !more {
+			break
+		}
+		return frame.Function
+	}
+	return "mgohttp-default-fn"
+}
+
+// requestSession is the session of a single request, copied from the parent session the
+// first time the request asks for it.
+type requestSession struct {
+	c        *SessionHandler
+	r        *http.Request
+	rollouts rolloutSample // the behaviors the request was sampled out of
+	timeout  time.Duration // the effective timeout of the request
+	deadline time.Time     // when the request times out
+	budget   requestBudget
+	onCopy   func() // called once the first session is copied, may be nil
+
+	// failed is set when an operation failed in a way that may have broken its socket
+	failed atomic.Bool
+
+	mu sync.Mutex
+	// handlerDone is set once the handler returned, so the sessions can go back to the pool
+	handlerDone bool
+	sessions    map[string]*mgo.Session
+	pooled      map[string]bool  // the databases whose session was checked out of the pool
+	errs        map[string]error // the databases whose session couldn't be created
+	closed      bool
+	// creating are closed once the session of their database is created, or failed to be:
+	// it's created without holding mu, which the request's other callers can't wait for
+	creating map[string]chan struct{}
+	// libSpan is the root span of every session of the request, callerSpans the spans of the
+	// callers that asked for one, its children.
+	libSpan     opentracing.Span
+	callerSpans []opentracing.Span
+	// drivers are the sessions of the databases with a Driver
+	drivers map[string]*driverSession
+	// opComment tags the request's operations, see RequestComment and KillOpsOnTimeout
+	opComment string
+	// opSpansOff is set when the request's callers and operations get no spans
+	opSpansOff bool
+	// debug is set when the request asked for verbose diagnostics, see DebugHeader
+	debug bool
+	// digest digests the results read by the request for its ETag, see ETagRoutes
+	digest *resultDigest
+	// children are the sessions of NewChildSession, and the copies of routes and timeouts
+	children []*childSession
+	// routes are the copies of the sessions routed by the queries' read preferences and the
+	// NearestRouter, see routedSession
+	routes map[routeKey]*childSession
+	// timeouts are the copies of the sessions made by MongoSession.WithTimeout, see
+	// timeoutSession
+	timeouts map[timeoutKey]*childSession
+	// queries counts the operations of the request, see MaxQueriesPerRequest
+	queries atomic.Int64
+}
+
+// newContext injects the getters of the handler's databases into ctx, along with the handler
+// for WriteError.
+func (s *requestSession) newContext(ctx context.Context) context.Context {
+	ctx = context.WithValue(ctx, handlerKey, s.c)
+	ctx = context.WithValue(ctx, budgetKey, &s.budget)
+	ctx = context.WithValue(ctx, sessionFailedKey, &s.failed)
+	ctx = context.WithValue(ctx, requestSessionKey, s)
+	ctx = WithStats(ctx)
+	if s.digest != nil {
+		ctx = context.WithValue(ctx, resultDigestKey, s.digest)
+	}
+	for _, db := range s.c.databases {
+		db := db
+		if db.driver != nil {
+			ctx = s.newDriverContext(ctx, db)
+			continue
+		}
+		ctx = internal.NewContext(ctx, db.name, func(ctx context.Context) (*mgo.Session, context.Context, error) {
+			return s.get(ctx, db)
+		})
+	}
+	return ctx
+}
+
+// get is injected into the Context, repeated calls by the same request will return the same
+// session.
+func (s *requestSession) get(ctx context.Context, db handlerDatabase) (*mgo.Session, context.Context, error) {
+	c := s.c
+	ctx = context.WithValue(ctx, handlerKey, c)
+	ctx = context.WithValue(ctx, rolloutKey, s.rollouts)
+	if s.r.Context().Err() == context.Canceled {
+		// the sessions were closed, or are about to be: fail fast rather than hand them out
+		return nil, ctx, fmt.Errorf("mgohttp: creating session for %s: %w", db.name, ErrClientDisconnected)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.waitCreating(db.name)
+	if err := s.errs[db.name]; err != nil {
+		return nil, ctx, err
+	}
+	// we've already created a session for this request, shortcircuit and return that session.
+	if sess := s.sessions[db.name]; sess != nil {
+		ctx = s.startCallerSpan(ctx)
+		if c.cfg.SocketTimeoutFunc != nil {
+			s.setSocketTimeout(sess)
+		}
+		applyReadPreference(ctx, sess)
+		applyMode(ctx, sess)
+		return sess, s.opContext(ctx, db.name), nil
+	}
+
+	ctx = s.startLibSpan(ctx)
+	sess, pooled, err := s.create(ctx, db, s.sessionDeadline())
+	if err == nil && s.closed {
+		// the request's sessions were closed while it was being created
+		sess.Close()
+		c.releaseSession()
+		c.sessionTracker.done()
+		return nil, ctx, fmt.Errorf("mgohttp: creating session for %s: the request's sessions are closed", db.name)
+	}
+	if err != nil {
+		return nil, ctx, s.createFailed(ctx, db, err)
+	}
+	if s.sessions == nil {
+		s.sessions = map[string]*mgo.Session{}
+	}
+	s.sessions[db.name] = sess
+	if pooled {
+		if s.pooled == nil {
+			s.pooled = map[string]bool{}
+		}
+		s.pooled[db.name] = true
+	}
+	s.opened()
+	ctx = s.startCallerSpan(ctx)
+
+	// SetSocketTimeout guarantees that no individual query to mongo can take longer than
+	// the request's timeout.
+	s.setSocketTimeout(sess)
+	if c.cfg.ReadPreference != nil {
+		c.cfg.ReadPreference.apply(sess)
+		c.cfg.ReadPreference.tag(s.libSpan)
+	}
+	if c.cfg.ReadOnlyRoutes != nil && c.cfg.ReadOnlyRoutes.readOnly(s.r) {
+		sess.SetMode(c.cfg.ReadOnlyRoutes.Mode, true)
+		s.libSpan.SetTag(TagReadOnlyRoute, true)
+		s.libSpan.SetTag(TagReadMode, modeName(c.cfg.ReadOnlyRoutes.Mode))
+	}
+	if c.cfg.ConsistencyOverride != nil {
+		if value, mode, ok := c.cfg.ConsistencyOverride.mode(s.r); ok {
+			sess.SetMode(mode, true)
+			s.libSpan.SetTag(TagReadConsistency, value)
+		}
+	}
+	if db.safe != nil {
+		sess.SetSafe(db.safe)
+		// the caller's span rather than the root one, which the databases share
+		opentracing.SpanFromContext(ctx).SetTag(TagWriteConcern, safeName(db.safe))
+	}
+	applyReadPreference(ctx, sess)
+	applyMode(ctx, sess)
+	return sess, s.opContext(ctx, db.name), nil
+}
+
+// waitCreating waits, with s.mu held, until the session of database being created by another
+// caller is, or failed to be.
+func (s *requestSession) waitCreating(database string) {
+	for s.creating[database] != nil {
+		creating := s.creating[database]
+		s.mu.Unlock()
+		<-creating
+		s.mu.Lock()
+	}
+}
+
+// opened records that a session was opened for the request, with s.mu held: the first one
+// starts the timeout of deferred requests.
+func (s *requestSession) opened() {
+	s.c.cfg.Metrics.sessionOpened()
+	if s.onCopy != nil && len(s.sessions)+len(s.drivers) == 1 {
+		s.onCopy()
+	}
+}
+
+// startLibSpan starts the request's root span the first time one of its databases gets a
+// session, and returns ctx carrying it.
+func (s *requestSession) startLibSpan(ctx context.Context) context.Context {
+	c := s.c
+	if s.libSpan == nil {
+		s.libSpan, ctx = startSpan(ctx, "mgohttp")
+		// set the service as the database - this will convey that it is a dependency of the service
+		ext.PeerService.Set(s.libSpan, c.cfg.Database)
+		ext.SpanKind.Set(s.libSpan, ext.SpanKindRPCClientEnum)
+		ext.Component.Set(s.libSpan, "mgohttp")
+		ext.DBType.Set(s.libSpan, "mongodb")
+		if len(s.rollouts) > 0 {
+			s.libSpan.SetTag(TagRolloutsExcluded, s.rollouts.String())
+		}
+		if s.opComment = c.opComment(s.r); s.opComment != "" {
+			s.libSpan.SetTag(TagOpComment, s.opComment)
+		}
+		if c.debugRequested(s.r) {
+			s.debug = true
+			s.libSpan.SetTag(TagDebug, true)
+		}
+		if !s.debug && !c.opSpansSampled() {
+			s.opSpansOff = true
+			s.libSpan.SetTag(TagOpSpansSampledOut, true)
+		}
+		return ctx
+	}
+	// the sessions of all the databases share the request's root span
+	return opentracing.ContextWithSpan(ctx, s.libSpan)
+}
+
+// sessionDeadline is when the sessions of the request time out.
+func (s *requestSession) sessionDeadline() time.Time {
+	if s.deadline.IsZero() {
+		// deferred requests only start their timeout with the first session
+		return time.Now().Add(s.c.requestTimeout(s.r.Context()))
+	}
+	return s.deadline
+}
+
+// createFailed records that the session of db couldn't be created, for the request's later
+// calls to get, and returns the error they get.
+func (s *requestSession) createFailed(ctx context.Context, db handlerDatabase, err error) error {
+	err = fmt.Errorf("mgohttp: creating session for %s: %w", db.name, err)
+	if s.errs == nil {
+		s.errs = map[string]error{}
+	}
+	s.errs[db.name] = err
+	logAndReturnErr(s.libSpan, err)
+	logger.FromContext(ctx).ErrorD("mgohttp-new-session-failed", logger.M{
+		"database": db.name,
+		"error":    err.Error(),
+	})
+	return err
+}
+
+// create creates the session of db, once one of the handler's MaxConcurrentSessions is free.
+// It's called with s.mu held, which it releases meanwhile: waiting for a session, or dialing
+// the parent, doesn't hold up the request's other callers.
+func (s *requestSession) create(ctx context.Context, db handlerDatabase, deadline time.Time) (sess *mgo.Session, pooled bool, err error) {
+	err = s.acquire(ctx, db, deadline, func() (err error) {
+		sess, pooled, err = s.c.createSession(ctx, db)
+		return err
+	})
+	return sess, pooled, err
+}
+
+// acquire runs open, which opens the session of db, once one of the handler's
+// MaxConcurrentSessions is free. It's called with s.mu held, which it releases meanwhile.
+// The slot is released when open fails.
+func (s *requestSession) acquire(ctx context.Context, db handlerDatabase, deadline time.Time, open func() error) error {
+	c := s.c
+	creating := make(chan struct{})
+	if s.creating == nil {
+		s.creating = map[string]chan struct{}{}
+	}
+	s.creating[db.name] = creating
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		delete(s.creating, db.name)
+		close(creating)
+	}()
+
+	if err := c.sessionTracker.add(); err != nil {
+		return err
+	}
+	if err := c.acquireSession(ctx, deadline, s.libSpan); err != nil {
+		c.sessionTracker.done()
+		return err
+	}
+	if err := open(); err != nil {
+		c.releaseSession()
+		c.sessionTracker.done()
+		return err
+	}
+	return nil
+}
+
+// hasAnyPrefix reports whether s starts with one of prefixes.
+func hasAnyPrefix(s string, prefixes []string) bool {
+	for _, p := range prefixes {
+		if strings.HasPrefix(s, p) {
+			return true
+		}
+	}
+	return false
+}
+
+// startCallerSpan starts the span of the caller asking for a session, as a child of the
+// request's root span, so the operations of concurrent callers hang off the same parent. The
+// spans are finished with the request: a caller may still be using its session when another
+// asks for one.
+func (s *requestSession) startCallerSpan(ctx context.Context) context.Context {
+	name := ""
+	if s.c.cfg.SpanNamer != nil {
+		name = s.c.cfg.SpanNamer(s.r)
+	}
+	if name == "" {
+		name = s.c.callerName()
+	}
+	t := tracer(ctx)
+	if s.opSpansOff {
+		t = opentracing.NoopTracer{}
+	}
+	sp := t.StartSpan(name, opentracing.ChildOf(s.libSpan.Context()))
+	s.callerSpans = append(s.callerSpans, sp)
+	return opentracing.ContextWithSpan(ctx, sp)
+}
+
+// setSocketTimeout sets the socket timeout of sess to the request's timeout, or to the one
+// picked by the handler's SocketTimeoutFunc.
+func (s *requestSession) setSocketTimeout(sess *mgo.Session) {
+	timeout := s.timeout
+	if s.c.cfg.SocketTimeoutFunc != nil {
+		timeout = s.c.cfg.SocketTimeoutFunc(s.r, time.Until(s.deadline))
+	}
+	if timeout < time.Millisecond {
+		// the budget is spent, a zero socket timeout would mean none
+		timeout = time.Millisecond
+	}
+	sess.SetSocketTimeout(timeout)
+}
+
+// createSession creates the session of a request for db with its NewSession or by copying
+// its parent session, falling back on the handler's. pooled is whether the session was checked
+// out of the handler's SessionPool.
+func (c *SessionHandler) createSession(ctx context.Context, db handlerDatabase) (sess *mgo.Session, pooled bool, err error) {
+	switch {
+	case db.newSession != nil:
+		sess, err = db.newSession(ctx)
+		return sess, false, err
+	case db.parentSession != nil:
+		return db.parentSession.Copy(), false, nil
+	case c.cfg.NewSession != nil:
+		sess, err = c.cfg.NewSession(ctx)
+		return sess, false, err
+	case c.cfg.SessionPool != nil:
+		return c.cfg.SessionPool.checkout(), true, nil
+	}
+	// We prefer Copy over Clone because opening new sockets allows for greater throughput to
+	// the database. Sessions created using Clone queue all requests through the parent
+	// connection's socket. This creates a slow bottleneck when expensive queries appear.
+	if p, ok := c.parentSession.(*dialedParent); ok {
+		sess, err = p.copySession()
+		return sess, false, err
+	}
+	return c.parentSession.Copy(), false, nil
+}
+
+// close closes the sessions and finishes their spans, if the request asked for a session.
+// Later calls to get return the closed sessions.
+func (s *requestSession) close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// if we didn't open a session, we don't care about closing the spans
+	if s.libSpan == nil || s.closed {
+		return
+	}
+	s.closed = true
+	for name, sess := range s.sessions {
+		if s.pooled[name] && s.handlerDone {
+			s.c.cfg.SessionPool.checkin(sess, s.failed.Load())
+		} else {
+			sess.Close()
+		}
+		s.c.cfg.Metrics.sessionClosed()
+		s.c.releaseSession()
+		s.c.sessionTracker.done()
+	}
+	for _, ds := range s.drivers {
+		ds.close()
+		s.c.cfg.Metrics.sessionClosed()
+		s.c.releaseSession()
+		s.c.sessionTracker.done()
+	}
+	for _, child := range s.children {
+		child.close()
+	}
+	for _, sp := range s.callerSpans {
+		sp.Finish()
+	}
+	s.libSpan.Finish()
+}
+
+// setHandlerDone records that the handler returned, before close.
+func (s *requestSession) setHandlerDone() {
+	s.mu.Lock()
+	s.handlerDone = true
+	s.mu.Unlock()
+}
+
+// recoverSessionClosed recovers the panic mgo raises when a handler keeps using its session
+// after the SessionHandler timeout closed it, returning any other panic.
+func recoverSessionClosed(r *http.Request, err interface{}) interface{} {
+	if err == "Session already closed" {
+		logger.FromContext(r.Context()).Error("mgo-session-already-closed-panic-caught")
+		return nil
+	}
+	return err
+}
+
+// ServeHTTP injects a "getter" to the HTTP request context that allows any wrapped hTTP handler
+// to retrieve a new database connection
+func (c *SessionHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	atomic.AddInt64(&c.stats.inFlight, 1)
+	defer atomic.AddInt64(&c.stats.inFlight, -1)
+
+	rollouts := c.cfg.Rollouts.sample()
+	if c.cfg.DeferUntilSession && rollouts.applies(RolloutDeferUntilSession) {
+		c.serveDeferred(w, r, rollouts)
+		return
+	}
+
+	// The session is lazily instantiated if the request handler asks for one.
+	timeout := c.requestTimeout(r.Context())
+	sessionTimer := time.NewTimer(timeout)
+	// stop the timer once we're done rather than leaving it to fire, at high QPS the pending
+	// timers add up
+	defer sessionTimer.Stop()
+
+	// At the end, if we instantiated a session (and inherently a tracing span), close/finish
+	// them to clean up.
+	sess := &requestSession{
+		c:        c,
+		r:        r,
+		rollouts: rollouts,
+		timeout:  timeout,
+		deadline: time.Now().Add(timeout),
+	}
+	sess.budget.deadline.Store(sess.deadline.UnixNano())
+	if c.digestsResults(r) {
+		sess.digest = &resultDigest{}
+	}
+	defer sess.close()
+
+	// Create a timeoutWriter to avoid races on the http.ResponseWriter.
+	tw := &timeoutWriter{
+		w:      w,
+		h:      make(http.Header),
+		stream: c.cfg.StreamResponses,
+	}
+
+	done := make(chan struct{}) // done signifies the end of the HTTP request when closed
+	panicChan := make(chan interface{}, 1)
+
+	go func() {
+		defer func() {
+			timedOut := tw.setHandlerDone(&c.stats.abandoned)
+			// If the SessionHandler timeout is hit, we close the mgo session. But server handler
+			// code may continue executing (even if the server timeout is the same as the
+			// SessionHandler timeout). If another DB operation is attempted, mgo will panic with a
+			// "Session already closed" error. Let's catch these panics to prevent server crashes.
+			if err := recoverSessionClosed(r, recover()); err != nil {
+				if timedOut {
+					// nobody is left to re-panic in, don't take the process down
+					logger.FromContext(r.Context()).ErrorD("mgohttp-panic-after-timeout", logger.M{
+						"panic": fmt.Sprint(err),
+					})
+				} else {
+					// re-panic in ServeHTTP's goroutine, where net/http recovers it
+					panicChan <- err
+					return
+				}
+			}
+			close(done)
+		}()
+
+		// amend the request context with the database connection then serve the wrapped
+		// HTTP handler
+		newCtx := sess.newContext(r.Context())
+		c.cfg.Handler.ServeHTTP(tw.exposed(), r.WithContext(newCtx))
+	}()
+
+	// graceC fires at the end of the PartialResponseGrace, once the timeout hit
+	var graceC <-chan time.Time
+
+	// this select guarantees that we only write to the ResponseWriter a single time
+	for {
+		select {
+		case <-done:
+			// If we served the request without being preempted by the timer, copy over all the
+			// writes from the timeout handler to the actual http.ResponseWriter.
+			sess.setHandlerDone()
+			if sess.digest != nil {
+				tw.applyETag(r, sess.digest.etag())
+			}
+			if n, buffered := tw.copyToResponseWriter(w); buffered {
+				c.cfg.Metrics.observeBufferedResponse(n)
+				sess.tagBufferedResponse(r.Context(), n)
+			}
+		case p := <-panicChan:
+			panic(p)
+		case <-sessionTimer.C:
+			if c.cfg.PartialResponseGrace > 0 {
+				// give the handler a chance to answer with what it has
+				sess.budget.expired.Store(true)
+				graceTimer := time.NewTimer(c.cfg.PartialResponseGrace)
+				defer graceTimer.Stop()
+				graceC = graceTimer.C
+				continue
+			}
+			sess.killOps()
+			c.timeOut(w, r, tw)
+		case <-graceC:
+			sess.killOps()
+			c.timeOut(w, r, tw)
+		case <-r.Context().Done():
+			if r.Context().Err() == context.DeadlineExceeded {
+				// the deadline was the request's timeout, the client may still be waiting for
+				// the response
+				sess.killOps()
+				c.timeOut(w, r, tw)
+				return
+			}
+			// the client went away, nobody is left to write the response to
+			tw.setTimedOut(&c.stats.abandoned)
+			atomic.AddInt64(&c.stats.cancelled, 1)
+			sess.markCancelled(r.Context())
+		}
+		return
+	}
+}
+
+// timeOut abandons the handler of a request that hit its timeout and writes the error status.
+func (c *SessionHandler) timeOut(w http.ResponseWriter, r *http.Request, tw *timeoutWriter) {
+	committed := tw.setTimedOut(&c.stats.abandoned)
+	atomic.AddInt64(&c.stats.timedOut, 1)
+	c.cfg.Metrics.sessionTimedOut()
+	if !committed {
+		c.writeTimeout(w, r)
+	}
+	logger.FromContext(r.Context()).Error("mongo-session-killed")
+}
+
+// cancellationReason describes why ctx is done, for the cancellation tags.
+func cancellationReason(ctx context.Context) string {
+	if ctx.Err() == context.DeadlineExceeded {
+		return "deadline-exceeded"
+	}
+	return "client-disconnect"
+}
+
+// markCancelled tags the request's root span, and the session's span if the request asked
+// for a session, as cancelled. Cancellations are the client's doing, so they're not tagged
+// as errors.
+func (s *requestSession) markCancelled(ctx context.Context) {
+	reason := cancellationReason(ctx)
+	spans := []opentracing.Span{opentracing.SpanFromContext(ctx)}
+	s.mu.Lock()
+	if s.libSpan != nil && !s.closed {
+		spans = append(spans, s.libSpan)
+	}
+	for _, sp := range spans {
+		if sp != nil {
+			sp.SetTag(TagCancelled, true)
+			sp.SetTag(TagCancellationReason, reason)
+		}
+	}
+	s.mu.Unlock()
+}
+
+// tagBufferedResponse records the size of the buffered response on the request's spans, to
+// find the endpoints whose responses are worth streaming.
+func (s *requestSession) tagBufferedResponse(ctx context.Context, n int) {
+	spans := []opentracing.Span{opentracing.SpanFromContext(ctx)}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.libSpan != nil && !s.closed {
+		spans = append(spans, s.libSpan)
+	}
+	for _, sp := range spans {
+		if sp != nil {
+			sp.SetTag(TagBufferedResponseBytes, n)
+		}
+	}
+}
+
+// serveDeferred serves the request on the calling goroutine, writing straight through to w,
+// and only starts the timeout once the handler asks for a session. When the timeout hits,
+// the session is closed and the error status is written unless the handler already wrote
+// its own, but the request isn't done until the handler returns.
+func (c *SessionHandler) serveDeferred(w http.ResponseWriter, r *http.Request, rollouts rolloutSample) {
+	dw := &deferredWriter{w: w, h: make(http.Header)}
+	sess := &requestSession{c: c, r: r, rollouts: rollouts}
+	var sessionTimer, budgetTimer *time.Timer
+	sess.onCopy = func() {
+		// the deadline of the request, if any, is measured from the first session on
+		sess.timeout = c.requestTimeout(r.Context())
+		sess.deadline = time.Now().Add(sess.timeout)
+		sess.budget.deadline.Store(sess.deadline.UnixNano())
+		if c.cfg.PartialResponseGrace > 0 {
+			budgetTimer = time.AfterFunc(sess.timeout, func() { sess.budget.expired.Store(true) })
+		}
+		sessionTimer = time.AfterFunc(sess.timeout+c.cfg.PartialResponseGrace, func() {
+			dw.setTimedOut(func(w http.ResponseWriter) { c.writeTimeout(w, r) })
+			atomic.AddInt64(&c.stats.timedOut, 1)
+			c.cfg.Metrics.sessionTimedOut()
+			logger.FromContext(r.Context()).Error("mongo-session-killed")
+			sess.killOps()
+			sess.close()
+		})
+	}
+	defer func() {
+		if budgetTimer != nil {
+			budgetTimer.Stop()
+		}
+		timedOut := sessionTimer != nil && !sessionTimer.Stop()
+		// the timer closed the sessions when the request timed out, they're only left open
+		// otherwise
+		sess.setHandlerDone()
+		if r.Context().Err() != nil && !timedOut {
+			atomic.AddInt64(&c.stats.cancelled, 1)
+			sess.markCancelled(r.Context())
+		}
+		sess.close()
+		if err := recoverSessionClosed(r, recover()); err != nil {
+			panic(err)
+		}
+	}()
+
+	// a disconnected client is only noticed once the handler returns: close the sessions
+	// right away instead, so the handler's operations fail fast
+	stop := context.AfterFunc(r.Context(), func() {
+		if r.Context().Err() == context.Canceled {
+			sess.close()
+		}
+	})
+	defer stop()
+
+	newCtx := sess.newContext(r.Context())
+	c.cfg.Handler.ServeHTTP(dw, r.WithContext(newCtx))
+}
+
+// FromContext retrieves a *mgo.Session from the request context.
+func FromContext(ctx context.Context, database string) MongoSession {
+	getSessionBlob := ctx.Value(internal.GetMgoSessionKey(database))
+	if getSession, ok := getSessionBlob.(internal.SessionGetter); ok {
+		sess, ctx, err := getSession(ctx)
+		if err != nil {
+			return failedSession{err: err}
+		}
+		return tracedMgoSession{
+			sess:      sess,
+			ctx:       withOpSession(ctx, sess),
+			databases: newWrapperCache[MongoDatabase](),
+		}
+	}
+	if provide, ok := getSessionBlob.(internal.SessionProvider); ok {
+		if sess, ok := provide(ctx).(MongoSession); ok {
+			return sess
+		}
+	}
+
+	panic(fmt.Sprintf("SessionFromContext must receive a valid database name: %s not found", database))
+}
@@ -0,0 +1,15 @@
+package mgohttp
+
+import (
+	"net/http"
+	"time"
+)
+
+const (
+	testMongoURL      = "127.0.0.1:27017"
+	testDBName        = "mgohttp-test"
+	handlerTimeout    = 50 * time.Millisecond
+	testingStatusCode = http.StatusTeapot
+	// sleepCollection holds the single document queried with mgohttptest.SlowSelector.
+	sleepCollection = "sleep"
+)
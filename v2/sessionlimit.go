@@ -0,0 +1,59 @@
+package mgohttp
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"time"
+
+	opentracing "github.com/opentracing/opentracing-go"
+)
+
+// ErrTooManySessions is returned in place of the request's session when the handler already
+// has MaxConcurrentSessions open and the request couldn't get one in time. DefaultErrorMapper
+// maps it to 503.
+var ErrTooManySessions = errors.New("mgohttp: too many concurrent sessions")
+
+// acquireSession takes one of the handler's session slots, when it limits concurrent sessions.
+// It waits until deadline unless the handler fails fast, and tags sp when the request was
+// throttled.
+func (c *SessionHandler) acquireSession(ctx context.Context, deadline time.Time, sp opentracing.Span) error {
+	if c.sessionSlots == nil {
+		return nil
+	}
+	select {
+	case c.sessionSlots <- struct{}{}:
+		return nil
+	default:
+	}
+
+	atomic.AddInt64(&c.stats.throttled, 1)
+	sp.SetTag(TagSessionThrottled, true)
+	if c.cfg.FailFastWhenThrottled {
+		c.cfg.Metrics.sessionThrottled("rejected")
+		logDecision(sp, DecisionSessionRejected, "max concurrent sessions reached, failing fast")
+		return ErrTooManySessions
+	}
+	logDecision(sp, DecisionSessionWait, "max concurrent sessions reached")
+	timer := time.NewTimer(time.Until(deadline))
+	defer timer.Stop()
+	reason := "request timed out waiting"
+	select {
+	case c.sessionSlots <- struct{}{}:
+		c.cfg.Metrics.sessionThrottled("waited")
+		return nil
+	case <-timer.C:
+	case <-ctx.Done():
+		reason = "request done waiting: " + ctx.Err().Error()
+	}
+	c.cfg.Metrics.sessionThrottled("rejected")
+	logDecision(sp, DecisionSessionRejected, reason)
+	return ErrTooManySessions
+}
+
+// releaseSession gives back the slot taken by acquireSession.
+func (c *SessionHandler) releaseSession() {
+	if c.sessionSlots != nil {
+		<-c.sessionSlots
+	}
+}
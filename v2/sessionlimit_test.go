@@ -0,0 +1,82 @@
+package mgohttp
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	mgo "gopkg.in/mgo.v2"
+)
+
+func sessionLimitTestHandler(failFast bool, timeout time.Duration, hold <-chan struct{}, errs chan<- error) *SessionHandler {
+	return NewSessionHandler(SessionHandlerConfig{
+		Database: testDBName,
+		Timeout:  timeout,
+		NewSession: func(ctx context.Context) (*mgo.Session, error) {
+			return &mgo.Session{}, nil
+		},
+		MaxConcurrentSessions: 1,
+		FailFastWhenThrottled: failFast,
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			// the session isn't connected, only a failed one has an error to report
+			var err error
+			if f, ok := FromContext(r.Context(), testDBName).(failedSession); ok {
+				err = f.err
+			}
+			if err != nil {
+				errs <- err
+				WriteError(w, r, err)
+				return
+			}
+			errs <- nil
+			if r.URL.Path == "/hold" {
+				<-hold
+			}
+		}),
+	}).(*SessionHandler)
+}
+
+func TestMaxConcurrentSessionsFailFast(t *testing.T) {
+	hold := make(chan struct{})
+	errs := make(chan error, 2)
+	handler := sessionLimitTestHandler(true, time.Second, hold, errs)
+	go handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/hold", nil))
+	assert.Equal(t, nil, <-errs)
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+	assert.True(t, errors.Is(<-errs, ErrTooManySessions))
+	assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+	assert.Equal(t, int64(1), handler.Stats().Throttled)
+	close(hold)
+}
+
+func TestMaxConcurrentSessionsWaits(t *testing.T) {
+	hold := make(chan struct{})
+	errs := make(chan error, 2)
+	handler := sessionLimitTestHandler(false, time.Second, hold, errs)
+	go handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/hold", nil))
+	assert.Equal(t, nil, <-errs)
+
+	time.AfterFunc(10*time.Millisecond, func() { close(hold) })
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+	assert.Equal(t, nil, <-errs, "the session is released when the first request is done")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, int64(1), handler.Stats().Throttled)
+}
+
+func TestMaxConcurrentSessionsTimesOut(t *testing.T) {
+	hold := make(chan struct{})
+	defer close(hold)
+	errs := make(chan error, 2)
+	handler := sessionLimitTestHandler(false, handlerTimeout, hold, errs)
+	handler.sessionSlots <- struct{}{}
+
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	assert.True(t, errors.Is(<-errs, ErrTooManySessions))
+}
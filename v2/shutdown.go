@@ -0,0 +1,88 @@
+package mgohttp
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sync"
+
+	mgo "gopkg.in/mgo.v2"
+)
+
+// ErrShuttingDown is returned in place of the request's session once Shutdown was called.
+// DefaultErrorMapper maps it to 503.
+var ErrShuttingDown = errors.New("mgohttp: session handler is shutting down")
+
+// sessionTracker counts the open sessions of a handler, so Shutdown can wait for them.
+type sessionTracker struct {
+	mu      sync.Mutex
+	closing bool
+	open    int
+	drained chan struct{} // closed once closing and no session is open
+}
+
+// add counts a session about to be created, unless the handler is shutting down.
+func (t *sessionTracker) add() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.closing {
+		return ErrShuttingDown
+	}
+	t.open++
+	return nil
+}
+
+// done uncounts a session once it's closed, or couldn't be created.
+func (t *sessionTracker) done() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.open--
+	if t.closing && t.open == 0 {
+		close(t.drained)
+	}
+}
+
+// close stops new sessions, and returns a channel closed once the open ones are.
+func (t *sessionTracker) close() <-chan struct{} {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if !t.closing {
+		t.closing = true
+		t.drained = make(chan struct{})
+		if t.open == 0 {
+			close(t.drained)
+		}
+	}
+	return t.drained
+}
+
+// Shutdown drains the handler before the process exits: requests can't get a session anymore
+// (they get ErrShuttingDown instead), and once the sessions of the requests in flight are
+// closed, the parent sessions and the SessionPool are closed. It returns ctx.Err() if ctx is
+// done first, leaving the parent sessions open. It doesn't stop the handler from serving
+// requests, which is up to the http.Server's own Shutdown.
+func (c *SessionHandler) Shutdown(ctx context.Context) error {
+	select {
+	case <-c.sessionTracker.close():
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	if c.cfg.SessionPool != nil {
+		c.cfg.SessionPool.Close()
+	}
+	for _, db := range c.databases {
+		if sess, ok := db.parentSession.(*mgo.Session); ok && sess != nil {
+			sess.Close()
+		}
+	}
+	switch parent := c.parentSession.(type) {
+	case *mgo.Session:
+		if parent != nil {
+			parent.Close()
+		}
+	case io.Closer:
+		parent.Close()
+	}
+	return nil
+}
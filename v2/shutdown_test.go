@@ -0,0 +1,63 @@
+package mgohttp
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	mgo "gopkg.in/mgo.v2"
+)
+
+func TestShutdown(t *testing.T) {
+	hold := make(chan struct{})
+	copied := make(chan struct{}, 1)
+	errs := make(chan error, 1)
+	handler := NewSessionHandler(SessionHandlerConfig{
+		Database: testDBName,
+		Timeout:  time.Second,
+		NewSession: func(ctx context.Context) (*mgo.Session, error) {
+			return &mgo.Session{}, nil
+		},
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			sess := FromContext(r.Context(), testDBName)
+			if f, ok := sess.(failedSession); ok {
+				errs <- f.err
+				WriteError(w, r, f.err)
+				return
+			}
+			copied <- struct{}{}
+			<-hold
+		}),
+	}).(*SessionHandler)
+
+	served := make(chan struct{})
+	go func() {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+		close(served)
+	}()
+	<-copied
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	assert.Equal(t, context.DeadlineExceeded, handler.Shutdown(ctx), "a session is still open")
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+	assert.True(t, errors.Is(<-errs, ErrShuttingDown))
+	assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+
+	close(hold)
+	<-served
+	require.NoError(t, handler.Shutdown(context.Background()))
+}
+
+func TestShutdownIdle(t *testing.T) {
+	handler := newLeakTestHandler(func(w http.ResponseWriter, r *http.Request) {})
+	assert.NoError(t, handler.Shutdown(context.Background()))
+	assert.NoError(t, handler.Shutdown(context.Background()), "Shutdown can be called again")
+}
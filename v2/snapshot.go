@@ -0,0 +1,39 @@
+package mgohttp
+
+import (
+	"context"
+	"errors"
+)
+
+// ErrSnapshotReadsUnsupported is returned by the queries of mgo's sessions that ask for
+// snapshot reads, with MongoQuery.WithSnapshot or WithSnapshotReads. Reading at a snapshot
+// (readConcern "snapshot") takes the logical sessions of MongoDB 4.0, which mgo doesn't
+// implement, so the queries fail rather than silently read without a consistent view. The
+// sessions of NewMongoDriver support them.
+var ErrSnapshotReadsUnsupported = errors.New("mgohttp: snapshot reads aren't supported by the mgo driver")
+
+type snapshotKeyType struct{}
+
+var snapshotKey = snapshotKeyType{}
+
+// WithSnapshotReads asks for every query of the sessions retrieved with FromContext(ctx, ...)
+// to read from the same snapshot, e.g. for reports that need a consistent view across
+// collections. With NewMongoDriver, the snapshot is the majority committed data when the
+// request's first snapshot read on the database runs, and takes replica sets of MongoDB 5.0
+// or later: older servers fail with an UnsupportedFeatureError. mgo's sessions fail with
+// ErrSnapshotReadsUnsupported.
+func WithSnapshotReads(ctx context.Context) context.Context {
+	return context.WithValue(ctx, snapshotKey, true)
+}
+
+// snapshotReads reports whether the query asked for snapshot reads, itself or through its
+// request.
+func (q tracedMongoQuery) snapshotReads() bool {
+	return snapshotReads(q.ctx, q.spec)
+}
+
+// snapshotReads reports whether the query of spec, run with ctx, asked for snapshot reads.
+func snapshotReads(ctx context.Context, spec querySpec) bool {
+	requested, _ := ctx.Value(snapshotKey).(bool)
+	return requested || spec.snapshot
+}
@@ -0,0 +1,90 @@
+package mgohttp
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/opentracing/opentracing-go/mocktracer"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	mgo "gopkg.in/mgo.v2"
+	bson "gopkg.in/mgo.v2/bson"
+)
+
+func TestSnapshotReadsUnsupported(t *testing.T) {
+	tracer := mocktracer.New()
+	ctx := context.WithValue(context.Background(), handlerKey, &SessionHandler{cfg: SessionHandlerConfig{Tracer: tracer}})
+	// the session isn't connected, the queries must fail before they reach it
+	db := tracedMgoDatabase{db: &mgo.Database{Name: testDBName, Session: &mgo.Session{}}, ctx: ctx}
+
+	err := db.C("events").Find(nil).WithSnapshot().One(&bson.M{})
+	assert.True(t, errors.Is(err, ErrSnapshotReadsUnsupported))
+	spans := tracer.FinishedSpans()
+	require.Len(t, spans, 1)
+	assert.Equal(t, "snapshot", spans[0].Tag(TagReadConcern))
+
+	db.ctx = WithSnapshotReads(ctx)
+	var docs []bson.M
+	assert.True(t, errors.Is(db.C("events").Find(nil).All(&docs), ErrSnapshotReadsUnsupported))
+	_, err = db.C("users").Find(nil).Count()
+	assert.True(t, errors.Is(err, ErrSnapshotReadsUnsupported))
+	assert.True(t, errors.Is(db.C("users").Find(nil).Iter().Close(), ErrSnapshotReadsUnsupported))
+}
+
+func TestSnapshotReadCommands(t *testing.T) {
+	spec := querySpec{
+		collection:    &mgo.Collection{Name: "events"},
+		filter:        bson.M{"kind": "signup"},
+		limit:         10,
+		readConcern:   "snapshot",
+		atClusterTime: bson.MongoTimestamp(42),
+	}
+	snapshot := bson.DocElem{Name: "readConcern", Value: bson.M{"level": "snapshot", "atClusterTime": bson.MongoTimestamp(42)}}
+	assert.Equal(t, snapshot, spec.findCommand(10, false)[3])
+
+	// count doesn't read at a snapshot: it's counted with aggregate
+	var cmd bson.D
+	spec.run = func(c, result interface{}) error {
+		cmd = c.(bson.D)
+		return nil
+	}
+	n, err := spec.count()
+	require.NoError(t, err)
+	assert.Equal(t, 0, n)
+	assert.Equal(t, bson.D{
+		{Name: "aggregate", Value: "events"},
+		{Name: "pipeline", Value: []bson.M{
+			{"$match": bson.M{"kind": "signup"}},
+			{"$limit": 10},
+			{"$count": "n"},
+		}},
+		{Name: "cursor", Value: bson.M{}},
+		snapshot,
+	}, cmd)
+}
+
+func TestMongoDriverSnapshotReads(t *testing.T) {
+	tracer := mocktracer.New()
+	sess := unreachableDriverSession(t, tracer)
+
+	// the snapshot reads are run, rather than rejected like mgo's
+	err := sess.DB(testDBName).C("events").Find(nil).WithSnapshot().One(&bson.M{})
+	assert.False(t, errors.Is(err, ErrSnapshotReadsUnsupported))
+	assert.True(t, IsNetworkError(err), "%v", err)
+	spans := tracer.FinishedSpans()
+	require.Len(t, spans, 1)
+	assert.Equal(t, "snapshot", spans[0].Tag(TagReadConcern))
+}
+
+func TestMongoDriverSnapshotReadsUnsupported(t *testing.T) {
+	sess := unreachableDriverSession(t, mocktracer.New())
+	sess.(tracedDriverSession).s.d.buildInfo.load(func() (mgo.BuildInfo, error) {
+		return mgo.BuildInfo{Version: "4.4.1", VersionArray: []int{4, 4, 1, 0}}, nil
+	})
+
+	err := sess.DB(testDBName).C("events").Find(nil).WithSnapshot().One(&bson.M{})
+	var unsupported UnsupportedFeatureError
+	require.True(t, errors.As(err, &unsupported), "%v", err)
+	assert.Equal(t, UnsupportedFeatureError{Feature: FeatureSnapshotReads, Version: "4.4.1"}, unsupported)
+}
@@ -0,0 +1,39 @@
+package mgohttp
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	mgo "gopkg.in/mgo.v2"
+)
+
+func TestSocketTimeoutFunc(t *testing.T) {
+	remainings := []time.Duration{}
+	handler := NewSessionHandler(SessionHandlerConfig{
+		Database: testDBName,
+		Timeout:  time.Second,
+		NewSession: func(ctx context.Context) (*mgo.Session, error) {
+			return &mgo.Session{}, nil
+		},
+		SocketTimeoutFunc: func(r *http.Request, remaining time.Duration) time.Duration {
+			remainings = append(remainings, remaining)
+			return remaining
+		},
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			FromContext(r.Context(), testDBName)
+			time.Sleep(20 * time.Millisecond)
+			FromContext(r.Context(), testDBName)
+		}),
+	})
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+
+	// the socket timeout is picked at every checkout, from the shrinking budget
+	require.Len(t, remainings, 2)
+	assert.True(t, remainings[0] <= time.Second)
+	assert.True(t, remainings[1] <= remainings[0]-20*time.Millisecond)
+}
@@ -0,0 +1,136 @@
+package mgohttp
+
+import (
+	"reflect"
+
+	mgo "gopkg.in/mgo.v2"
+	bson "gopkg.in/mgo.v2/bson"
+)
+
+// splitIn breaks a selector whose $in on _id has more than size elements into one selector per
+// chunk of at most size elements. It returns nil when there's nothing to split: only bson.M
+// selectors with an $in on _id are considered. The chunks of _id, which can't be an array,
+// match disjoint documents: a document whose array field has values in several chunks of
+// another field would be read, counted and written once per chunk.
+func splitIn(selector interface{}, size int) []bson.M {
+	sel, ok := selector.(bson.M)
+	if !ok || size <= 0 {
+		return nil
+	}
+	cond, ok := sel["_id"].(bson.M)
+	if !ok {
+		return nil
+	}
+	values := reflect.ValueOf(cond["$in"])
+	if values.Kind() != reflect.Slice || values.Len() <= size {
+		return nil
+	}
+
+	chunks := []bson.M{}
+	for start := 0; start < values.Len(); start += size {
+		end := start + size
+		if end > values.Len() {
+			end = values.Len()
+		}
+		chunkCond := bson.M{}
+		for k, v := range cond {
+			chunkCond[k] = v
+		}
+		chunkCond["$in"] = values.Slice(start, end).Interface()
+
+		chunk := bson.M{}
+		for k, v := range sel {
+			chunk[k] = v
+		}
+		chunk["_id"] = chunkCond
+		chunks = append(chunks, chunk)
+	}
+	return chunks
+}
+
+// inSplit holds the per-chunk queries of a Find whose $in was split. Like mgo.Query it's
+// modified in place by the query modifiers.
+//
+// Results are merged in chunk order, so sorted or skipped queries can't be split: they fall
+// back to the original query.
+type inSplit struct {
+	queries []*mgo.Query
+	// chunks are the selectors of the queries, to rebuild them on another session
+	chunks []bson.M
+	limit  int
+	// unsplittable is the modifier that prevents the split, if any.
+	unsplittable string
+}
+
+func (s *inSplit) all(result interface{}) error {
+	resultv := reflect.ValueOf(result)
+	if resultv.Kind() != reflect.Ptr || resultv.Elem().Kind() != reflect.Slice {
+		panic("result argument must be a slice address")
+	}
+	slicev := resultv.Elem().Slice(0, 0)
+	for _, q := range s.queries {
+		if s.limit > 0 && slicev.Len() >= s.limit {
+			break
+		}
+		chunk := reflect.New(slicev.Type())
+		if err := q.All(chunk.Interface()); err != nil {
+			return err
+		}
+		slicev = reflect.AppendSlice(slicev, chunk.Elem())
+	}
+	if s.limit > 0 && slicev.Len() > s.limit {
+		slicev = slicev.Slice(0, s.limit)
+	}
+	resultv.Elem().Set(slicev)
+	return nil
+}
+
+func (s *inSplit) one(result interface{}) error {
+	for _, q := range s.queries {
+		err := q.One(result)
+		if err == mgo.ErrNotFound {
+			continue
+		}
+		return err
+	}
+	return mgo.ErrNotFound
+}
+
+func (s *inSplit) count() (int, error) {
+	total := 0
+	for _, q := range s.queries {
+		n, err := q.Count()
+		if err != nil {
+			return 0, err
+		}
+		total += n
+	}
+	if s.limit > 0 && total > s.limit {
+		total = s.limit
+	}
+	return total, nil
+}
+
+// modify applies a query modifier to every chunk.
+func (s *inSplit) modify(fn func(*mgo.Query)) {
+	for _, q := range s.queries {
+		fn(q)
+	}
+}
+
+// splitChanges runs a multi-document write once per chunk and sums up the results.
+func splitChanges(chunks []bson.M, run func(selector interface{}) (*mgo.ChangeInfo, error)) (*mgo.ChangeInfo, error) {
+	total := &mgo.ChangeInfo{}
+	for _, chunk := range chunks {
+		info, err := run(chunk)
+		if err != nil {
+			return total, err
+		}
+		if info != nil {
+			total.Updated += info.Updated
+			total.Removed += info.Removed
+			total.Matched += info.Matched
+		}
+	}
+	return total, nil
+}
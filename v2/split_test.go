@@ -0,0 +1,54 @@
+package mgohttp
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	mgo "gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+func TestSplitIn(t *testing.T) {
+	ids := []int{1, 2, 3, 4, 5, 6, 7}
+	chunks := splitIn(bson.M{"org": "o1", "_id": bson.M{"$in": ids, "$ne": 0}}, 3)
+	assert.Equal(t, []bson.M{
+		{"org": "o1", "_id": bson.M{"$in": []int{1, 2, 3}, "$ne": 0}},
+		{"org": "o1", "_id": bson.M{"$in": []int{4, 5, 6}, "$ne": 0}},
+		{"org": "o1", "_id": bson.M{"$in": []int{7}, "$ne": 0}},
+	}, chunks)
+
+	// only the $in on _id is split, the others are sent as is
+	chunks = splitIn(bson.M{"tags": bson.M{"$in": []string{"x", "y", "z"}}, "_id": bson.M{"$in": ids}}, 2)
+	assert.Len(t, chunks, 4)
+	assert.Equal(t, []string{"x", "y", "z"}, chunks[3]["tags"].(bson.M)["$in"])
+	assert.Equal(t, []int{7}, chunks[3]["_id"].(bson.M)["$in"])
+
+	chunks = splitIn(bson.M{"_id": bson.M{"$in": ids}}, 7)
+	assert.Nil(t, chunks, "small enough")
+	chunks = splitIn(bson.M{"_id": bson.M{"$in": ids}}, 0)
+	assert.Nil(t, chunks, "splitting disabled")
+	chunks = splitIn(bson.D{{Name: "_id", Value: bson.M{"$in": ids}}}, 3)
+	assert.Nil(t, chunks, "only bson.M is split")
+}
+
+func TestSplitInArrayField(t *testing.T) {
+	// a document with tags ["a", "c"] would match the chunk of "a" and that of "c": it would
+	// be returned twice by All, and updated twice by UpdateAll
+	chunks := splitIn(bson.M{"tags": bson.M{"$in": []string{"a", "b", "c", "d"}}}, 2)
+	assert.Nil(t, chunks)
+}
+
+func TestRebindKeepsSplit(t *testing.T) {
+	c := limitTestCollection(nil, "users")
+	handlerFromContext(c.ctx).cfg.InSplitSize = 2
+	q := c.Find(bson.M{"_id": bson.M{"$in": []int{1, 2, 3}}}).Limit(5).(tracedMongoQuery)
+	require.NotNil(t, q.split)
+
+	// the queries routed to another session by their read preference are still split
+	rq := q.rebind(&mgo.Session{})
+	require.NotNil(t, rq.split)
+	assert.Len(t, rq.split.queries, 2)
+	assert.Equal(t, q.split.chunks, rq.split.chunks)
+	assert.Equal(t, 5, rq.split.limit)
+}
@@ -0,0 +1,110 @@
+package mgohttp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const srvScheme = "mongodb+srv://"
+
+// srvTXTOptions are the only URL options the TXT record of a mongodb+srv URL may set.
+var srvTXTOptions = map[string]bool{"authSource": true, "replicaSet": true}
+
+// srvResolver resolves the records of mongodb+srv URLs, a *net.Resolver but in the tests.
+type srvResolver interface {
+	LookupSRV(ctx context.Context, service, proto, name string) (string, []*net.SRV, error)
+	LookupTXT(ctx context.Context, name string) ([]string, error)
+}
+
+// WithSRVRefresh re-resolves the SRV records of a mongodb+srv URL every interval with
+// NewSessionHandlerFromURL, and dials a new parent session for the handler when the hosts
+// change, e.g. when the mongos of a sharded cluster are replaced. mgo discovers the changes of
+// a replica set's members on its own, as long as one of the hosts it knows is up.
+func WithSRVRefresh(interval time.Duration) DialOption {
+	return func(c *dialConfig) { c.srvRefresh = interval }
+}
+
+// withSRVResolver resolves the SRV and TXT records with r, for the tests.
+func withSRVResolver(r srvResolver) DialOption {
+	return func(c *dialConfig) { c.resolver = r }
+}
+
+func isSRVURL(rawURL string) bool {
+	return strings.HasPrefix(rawURL, srvScheme)
+}
+
+// expandSRV resolves a mongodb+srv URL into the mongodb URL of its hosts, with the options of
+// its TXT record, and TLS unless the URL disables it. It returns the hosts, sorted.
+func expandSRV(ctx context.Context, r srvResolver, rawURL string) (string, []string, error) {
+	rest := strings.TrimPrefix(rawURL, srvScheme)
+	userinfo := ""
+	if i := strings.LastIndex(rest, "@"); i >= 0 {
+		userinfo, rest = rest[:i+1], rest[i+1:]
+	}
+	host, path := rest, ""
+	if i := strings.IndexAny(rest, "/?"); i >= 0 {
+		host, path = rest[:i], rest[i:]
+	}
+	if strings.ContainsAny(host, ":,") || strings.Count(host, ".") < 2 {
+		return "", nil, fmt.Errorf("mgohttp: a mongodb+srv URL needs a single host name with a domain and no port, not %q", host)
+	}
+	path, query, _ := strings.Cut(path, "?")
+	options, err := url.ParseQuery(query)
+	if err != nil {
+		return "", nil, fmt.Errorf("mgohttp: parsing the options of the dial URL: %w", err)
+	}
+
+	_, records, err := r.LookupSRV(ctx, "mongodb", "tcp", host)
+	if err != nil {
+		return "", nil, fmt.Errorf("mgohttp: resolving the SRV records of %s: %w", host, err)
+	}
+	// the hosts must be in the domain of the URL's host
+	domain := host[strings.Index(host, "."):]
+	hosts := make([]string, 0, len(records))
+	for _, srv := range records {
+		target := strings.TrimSuffix(srv.Target, ".")
+		if !strings.HasSuffix(target, domain) {
+			return "", nil, fmt.Errorf("mgohttp: the SRV record %s of %s is outside its domain", target, host)
+		}
+		hosts = append(hosts, net.JoinHostPort(target, strconv.Itoa(int(srv.Port))))
+	}
+	if len(hosts) == 0 {
+		return "", nil, fmt.Errorf("mgohttp: %s has no SRV records", host)
+	}
+	sort.Strings(hosts)
+
+	txts, err := r.LookupTXT(ctx, host)
+	var dnsErr *net.DNSError
+	if err != nil && !(errors.As(err, &dnsErr) && dnsErr.IsNotFound) {
+		return "", nil, fmt.Errorf("mgohttp: resolving the TXT record of %s: %w", host, err)
+	}
+	if len(txts) > 1 {
+		return "", nil, fmt.Errorf("mgohttp: %s has more than one TXT record", host)
+	}
+	if len(txts) == 1 {
+		txtOptions, err := url.ParseQuery(txts[0])
+		if err != nil {
+			return "", nil, fmt.Errorf("mgohttp: parsing the TXT record of %s: %w", host, err)
+		}
+		for k, v := range txtOptions {
+			if !srvTXTOptions[k] {
+				return "", nil, fmt.Errorf("mgohttp: the TXT record of %s can't set %s", host, k)
+			}
+			// the URL's options take precedence
+			if _, ok := options[k]; !ok {
+				options[k] = v
+			}
+		}
+	}
+	if _, ok := options["ssl"]; !ok && options.Get("tls") == "" {
+		options.Set("tls", "true")
+	}
+	return "mongodb://" + userinfo + strings.Join(hosts, ",") + path + "?" + options.Encode(), hosts, nil
+}
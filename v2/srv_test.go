@@ -0,0 +1,75 @@
+package mgohttp
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeSRVResolver struct {
+	srvs map[string][]*net.SRV
+	txts map[string][]string
+}
+
+func (r fakeSRVResolver) LookupSRV(ctx context.Context, service, proto, name string) (string, []*net.SRV, error) {
+	srvs, ok := r.srvs["_"+service+"._"+proto+"."+name]
+	if !ok {
+		return "", nil, &net.DNSError{Err: "no such host", Name: name, IsNotFound: true}
+	}
+	return "", srvs, nil
+}
+
+func (r fakeSRVResolver) LookupTXT(ctx context.Context, name string) ([]string, error) {
+	txts, ok := r.txts[name]
+	if !ok {
+		return nil, &net.DNSError{Err: "no such host", Name: name, IsNotFound: true}
+	}
+	return txts, nil
+}
+
+func TestExpandSRV(t *testing.T) {
+	r := fakeSRVResolver{
+		srvs: map[string][]*net.SRV{
+			"_mongodb._tcp.cluster0.example.net": {
+				{Target: "shard-01.example.net.", Port: 27017},
+				{Target: "shard-00.example.net.", Port: 27017},
+			},
+			"_mongodb._tcp.rogue.example.net": {{Target: "evil.example.com.", Port: 27017}},
+		},
+		txts: map[string][]string{
+			"cluster0.example.net": {"authSource=admin&replicaSet=atlas-0"},
+			"rogue.example.net":    {"w=0"},
+		},
+	}
+	ctx := context.Background()
+
+	mongoURL, hosts, err := expandSRV(ctx, r, "mongodb+srv://user:p@ss@cluster0.example.net/app?replicaSet=override")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"shard-00.example.net:27017", "shard-01.example.net:27017"}, hosts)
+	assert.Equal(t, "mongodb://user:p@ss@shard-00.example.net:27017,shard-01.example.net:27017/app?authSource=admin&replicaSet=override&tls=true", mongoURL)
+
+	mongoURL, _, err = expandSRV(ctx, r, "mongodb+srv://cluster0.example.net/?ssl=false")
+	require.NoError(t, err)
+	assert.NotContains(t, mongoURL, "tls=true", "the URL disables TLS")
+
+	for _, bad := range []string{
+		"mongodb+srv://cluster0.example.net:27017/app",
+		"mongodb+srv://a.example.net,b.example.net/app",
+		"mongodb+srv://example.net/app",
+		"mongodb+srv://missing.example.net/app",
+		"mongodb+srv://rogue.example.net/app",
+	} {
+		_, _, err := expandSRV(ctx, r, bad)
+		assert.Error(t, err, bad)
+	}
+
+	info, err := dialInfo("mongodb+srv://cluster0.example.net/app", withSRVResolver(r))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"shard-00.example.net:27017", "shard-01.example.net:27017"}, info.Addrs)
+	assert.Equal(t, "atlas-0", info.ReplicaSetName)
+	assert.Equal(t, "admin", info.Source)
+	assert.NotNil(t, info.DialServer, "mongodb+srv defaults to TLS")
+}
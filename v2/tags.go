@@ -0,0 +1,232 @@
+package mgohttp
+
+// Span tag keys set by mgohttp. Tests and dashboards should refer to these rather than to the
+// strings, which may change.
+const (
+	// TagCollection is the collection an operation ran against.
+	TagCollection = "collection"
+	// TagDatabase is the database selected with MongoSession.DB.
+	TagDatabase = "db-name"
+	// TagAccessMethod is the query method that issued the query, e.g. "All" or "One".
+	TagAccessMethod = "access-method"
+	// TagSort is the sort of a query, as "|" separated fields.
+	TagSort = "sort"
+	// TagCollation is the locale of a query's collation.
+	TagCollation = "collation"
+	// TagCollectionDisabled is set when an operation was rejected by the kill switch.
+	TagCollectionDisabled = "collection-disabled"
+	// TagInSplitChunks is the number of chunks a large $in was split into.
+	TagInSplitChunks = "in-split-chunks"
+	// TagInSplitSkipped is the reason a large $in wasn't split.
+	TagInSplitSkipped = "in-split-skipped"
+	// TagSelectorTooComplex is set when a selector exceeded the SelectorLimits.
+	TagSelectorTooComplex = "selector-too-complex"
+	// TagSelectorTooComplexReason describes the exceeded limit.
+	TagSelectorTooComplexReason = "selector-too-complex-reason"
+	// TagSelectorUnsupported is the operator of a selector the server doesn't support.
+	TagSelectorUnsupported = "selector-unsupported"
+	// TagUnanchoredRegex lists the fields filtered with an unanchored case-insensitive regex.
+	TagUnanchoredRegex = "unanchored-regex"
+	// TagServerAddress is the server that answered MongoSession.PingWithInfo.
+	TagServerAddress = "server-address"
+	// TagServerState is the replica set state of that server.
+	TagServerState = "server-state"
+	// TagServerVersion is the version reported by MongoSession.ServerVersion.
+	TagServerVersion = "server-version"
+	// TagReadMode is the read preference mode of the session.
+	TagReadMode = "read-mode"
+	// TagWriteConcern is the write concern set on the session with MongoSession.SetSafe, or
+	// on the collection with MongoCollection.WithWriteConcern.
+	TagWriteConcern = "write-concern"
+	// TagReadTags are the read preference tag sets of the session.
+	TagReadTags = "read-tags"
+	// TagReadMember is the member a NearestRouter routed a read to.
+	TagReadMember = "read-member"
+	// TagDefaultLimit is the limit the LimitPolicy applied to a query without one.
+	TagDefaultLimit = "default-limit"
+	// TagUnboundedQuery is set when the LimitPolicy rejected a query without a limit.
+	TagUnboundedQuery = "unbounded-query"
+	// TagExplainPlan lists the collection and index scans of the plan of a slow query, see
+	// SessionHandlerConfig.ExplainSlowQueries.
+	TagExplainPlan = "explain-plan"
+	// TagExplainDocsExamined, TagExplainKeysExamined and TagExplainReturned are the
+	// execution stats of the plan of a slow query.
+	TagExplainDocsExamined = "explain-docs-examined"
+	TagExplainKeysExamined = "explain-keys-examined"
+	TagExplainReturned     = "explain-returned"
+	// TagCancelled is set on the request's root span when the client went away before the
+	// request was served. Cancelled requests aren't tagged as errors.
+	TagCancelled = "cancelled"
+	// TagCancellationReason is why the request was cancelled, "client-disconnect" or
+	// "deadline-exceeded".
+	TagCancellationReason = "cancellation-reason"
+	// TagBufferedResponseBytes is the size of the response body the handler buffered, set on
+	// the request's root span.
+	TagBufferedResponseBytes = "buffered-response-bytes"
+	// TagSessionThrottled is set on the request's root span when it had to wait for a session,
+	// or didn't get one, because of SessionHandlerConfig.MaxConcurrentSessions.
+	TagSessionThrottled = "session-throttled"
+	// TagOpLimited is set when the OpLimiter rejected an operation.
+	TagOpLimited = "op-limited"
+	// TagBulkUnordered is whether a bulk operation ran unordered.
+	TagBulkUnordered = "bulk-unordered"
+	// TagRepairField is the field written by a read repair.
+	TagRepairField = "repair-field"
+	// TagReadConcern is the read concern a query asked for, e.g. "majority" or "snapshot".
+	TagReadConcern = "read-concern"
+	// TagReadConsistency is the consistency requested with the ConsistencyOverride header.
+	TagReadConsistency = "read-consistency"
+	// TagRolloutsExcluded lists the behaviors the request was sampled out of by Rollouts.
+	TagRolloutsExcluded = "rollouts-excluded"
+	// TagIndexForcedBackground is set when the IndexPolicy forced an index build to run in
+	// the background.
+	TagIndexForcedBackground = "index-forced-background"
+	// TagQueryFingerprint identifies the shape of an operation, see QueryFingerprint.
+	TagQueryFingerprint = "query-fingerprint"
+	// TagDocumentNearLimit is the estimated size of the document an update would grow past
+	// the DocumentSizeCheck's WarnBytes.
+	TagDocumentNearLimit = "document-near-limit"
+	// TagCursorID is the id of the server-side cursor of an aggregation, see MongoPipe.
+	TagCursorID = "cursor-id"
+	// TagCursorGetMores, TagCursorAvgBatch, TagCursorDocs and TagCursorLifetimeMs are set on
+	// the span of a cursor when it's closed: its getMore round trips after the first batch,
+	// the average number of documents per batch, the documents it returned and the time it
+	// was open. mgo doesn't expose the getMores of queries, so they're estimated from the
+	// query's Batch size, and TagCursorGetMoresEstimated set, or not reported without one.
+	TagCursorGetMores          = "cursor-getmores"
+	TagCursorAvgBatch          = "cursor-avg-batch"
+	TagCursorDocs              = "cursor-docs"
+	TagCursorLifetimeMs        = "cursor-lifetime-ms"
+	TagCursorGetMoresEstimated = "cursor-getmores-estimated"
+	// TagIndexBuildDeferred is set when the IndexPolicy rejected an index build during a
+	// request.
+	TagIndexBuildDeferred = "index-build-deferred"
+	// TagOpComment is the comment the request's queries carry, set on the request's root span
+	// with SessionHandlerConfig.KillOpsOnTimeout.
+	TagOpComment = "op-comment"
+	// TagOpSpansSampledOut is set on the request's root span when its operations got no
+	// spans, see SessionHandlerConfig.OpSpanSampling.
+	TagOpSpansSampledOut = "op-spans-sampled-out"
+	// TagDebug is set on the request's root span when it asked for verbose diagnostics, see
+	// SessionHandlerConfig.DebugHeader.
+	TagDebug = "debug"
+	// TagReadOnlyRoute is set on the request's root span when its session got the mode of
+	// SessionHandlerConfig.ReadOnlyRoutes.
+	TagReadOnlyRoute = "read-only-route"
+	// TagQueryBudgetExceeded is set on the request's root span, and the spans of the
+	// operations over the budget, when the request ran more operations than
+	// SessionHandlerConfig.MaxQueriesPerRequest.
+	TagQueryBudgetExceeded = "query-budget-exceeded"
+	// TagSessionRefreshed is set on the span of an operation that lost its socket when its
+	// session was refreshed, see SessionHandlerConfig.RefreshOnSocketErrors.
+	TagSessionRefreshed = "session-refreshed"
+	// TagChildSession is set on the span of a caller of NewChildSession.
+	TagChildSession = "child-session"
+
+	// TagPageLimit, TagPageSort and TagPageResumed are the parameters of a page of Paginate,
+	// TagPageResumed whether it followed a token. TagPageDocs and TagPageHasNext are the
+	// number of documents of the page and whether there's a next one.
+	TagPageLimit   = "page-limit"
+	TagPageSort    = "page-sort"
+	TagPageResumed = "page-resumed"
+	TagPageDocs    = "page-docs"
+	TagPageHasNext = "page-has-next"
+
+	// TagDBSystem, TagDBName, TagDBOperation and TagDBMongoDBCollection are the OpenTelemetry
+	// semantic convention attributes set on every operation.
+	TagDBSystem            = "db.system"
+	TagDBName              = "db.name"
+	TagDBOperation         = "db.operation"
+	TagDBMongoDBCollection = "db.mongodb.collection"
+)
+
+// Span log field keys used by mgohttp.
+const (
+	// LogSelector lists the fields of an operation's selector.
+	LogSelector = "selector"
+	// LogUpdate lists the fields of an operation's update document.
+	LogUpdate = "update"
+	// LogSelect lists the fields of a query's projection.
+	LogSelect = "select"
+	// LogHintPrefix prefixes the index keys of a query's hint, followed by their position.
+	LogHintPrefix = "hint."
+	// LogQueryLimit is the limit of a query.
+	LogQueryLimit = "query-limit"
+	// LogQuerySkip, LogQueryBatch and LogQueryPrefetch are the skip, batch size and prefetch
+	// of a query.
+	LogQuerySkip     = "query-skip"
+	LogQueryBatch    = "query-batch"
+	LogQueryPrefetch = "query-prefetch"
+	// LogQueryMaxTimeMillis is the server-side time limit of a query.
+	LogQueryMaxTimeMillis = "query-max-time-ms"
+	// LogTailTimeoutMillis is the timeout of a tailable cursor.
+	LogTailTimeoutMillis = "tail-timeout-ms"
+	// LogSocketTimeoutMillis is the socket timeout of a session derived with
+	// MongoSession.WithTimeout.
+	LogSocketTimeoutMillis = "socket-timeout-ms"
+	// LogTailTimeouts counts the times a tailable cursor timed out waiting for documents.
+	LogTailTimeouts = "tail-timeouts"
+	// LogTransactionAttempts is the number of times the func of a transaction ran, more than
+	// once when it was retried after a transient transaction error.
+	LogTransactionAttempts = "transaction-attempts"
+	// LogNumDocs is the number of documents inserted.
+	LogNumDocs = "num-docs"
+	// LogCommand is the command passed to MongoDatabase.Run.
+	LogCommand = "cmd"
+	// LogRTTMillis is the round trip time measured by MongoSession.PingWithInfo.
+	LogRTTMillis = "rtt-ms"
+	// LogCollationStrength is the strength of a query's collation.
+	LogCollationStrength = "collation-strength"
+	// LogRemove, LogReturnNew and LogUpsert describe the change passed to MongoQuery.Apply.
+	LogRemove    = "remove"
+	LogReturnNew = "return-new"
+	LogUpsert    = "upsert"
+	// LogBulkOps is the total number of operations run by a bulk operation.
+	LogBulkOps = "bulk-ops"
+	// LogBulkOpsPrefix prefixes the number of operations of each kind run by a bulk operation,
+	// e.g. "bulk-ops.update".
+	LogBulkOpsPrefix = "bulk-ops."
+	// LogBulkMatched and LogBulkModified are the results of a bulk operation.
+	LogBulkMatched  = "bulk-matched"
+	LogBulkModified = "bulk-modified"
+	// LogIterDocs and LogIterElapsedMillis are the documents read by a cursor so far and the
+	// time since it was opened, logged by its heartbeats, see IterationHeartbeat.
+	LogIterDocs          = "iter-docs"
+	LogIterElapsedMillis = "iter-elapsed-ms"
+	// LogBatchDocs is the number of documents of a batch of an aggregation cursor.
+	LogBatchDocs = "batch-docs"
+	// LogResultBytes is the size of the raw documents read by MongoQuery.OneRaw and AllRaw.
+	LogResultBytes = "result-bytes"
+	// LogDecisionReason is why a decision logged as a span event was made, e.g. DecisionShed.
+	LogDecisionReason = "decision-reason"
+	// LogIndexKey is the key of an index, as "|" separated fields.
+	LogIndexKey = "index-key"
+	// LogIndexName is the name of an index.
+	LogIndexName = "index-name"
+	// LogIndexUnique, LogIndexSparse, LogIndexBackground and LogIndexExpireAfter are the
+	// options of an index passed to MongoCollection.EnsureIndex, logged when set.
+	LogIndexUnique      = "index-unique"
+	LogIndexSparse      = "index-sparse"
+	LogIndexBackground  = "index-background"
+	LogIndexExpireAfter = "index-expire-after"
+	// LogNumIndexes is the number of indexes returned by MongoCollection.Indexes.
+	LogNumIndexes = "num-indexes"
+	// LogFileName is the name of a GridFS file.
+	LogFileName = "file-name"
+	// LogBytesRead and LogBytesWritten count the bytes transferred to and from a GridFS file.
+	LogBytesRead    = "bytes-read"
+	LogBytesWritten = "bytes-written"
+	// LogNumCollections is the number of collections returned by
+	// MongoDatabase.CollectionNames.
+	LogNumCollections = "num-collections"
+	// LogCappedMaxBytes and LogCappedMaxDocs are the limits of a capped collection created
+	// with MongoCollection.Create.
+	LogCappedMaxBytes = "capped-max-bytes"
+	LogCappedMaxDocs  = "capped-max-docs"
+	// LogCollectionCount and LogCollectionSize are the number of documents of a collection
+	// and their size in bytes, as reported by MongoCollection.Stats.
+	LogCollectionCount = "collection-count"
+	LogCollectionSize  = "collection-size"
+	// LogError is the error an operation failed with.
+	LogError = "error"
+)
@@ -0,0 +1,103 @@
+package mgohttp
+
+import (
+	"errors"
+	"time"
+
+	opentracinglog "github.com/opentracing/opentracing-go/log"
+	mgo "gopkg.in/mgo.v2"
+)
+
+// ErrCollatedTail is returned by the iterator of a tailable query with a collation, which
+// can't be emulated.
+var ErrCollatedTail = errors.New("mgohttp: collation isn't supported on tailable cursors")
+
+// ErrReadConcernTail is returned by the iterator of a tailable query with a read concern,
+// which can't be emulated either.
+var ErrReadConcernTail = errors.New("mgohttp: read concern isn't supported on tailable cursors")
+
+func (q tracedMongoQuery) Tail(timeout time.Duration) MongoIter {
+	recordUsage("MongoQuery.Tail")
+	unlimit, err := q.admit()
+	if err != nil {
+		return failedMongoIter{err: err}
+	}
+	sp := q.op
+	sp.SetTag(TagAccessMethod, "Tail")
+	sp.LogFields(opentracinglog.Int64(LogTailTimeoutMillis, timeout.Milliseconds()))
+	switch {
+	case q.spec.collation != nil:
+		err = ErrCollatedTail
+	case q.spec.readConcern != "":
+		err = ErrReadConcernTail
+	}
+	if err != nil {
+		unlimit()
+		err = logAndReturnErr(sp, err)
+		sp.Finish()
+		return failedMongoIter{err: err}
+	}
+	q, routedRelease, err := q.routed()
+	if err != nil {
+		unlimit()
+		err = logAndReturnErr(q.op, err)
+		q.op.Finish()
+		return failedMongoIter{err: err}
+	}
+	// a tailing loop can run for a long time, don't explain it
+	q.op.spec = nil
+	return &tracedTailIter{
+		i:  q.q.Tail(timeout),
+		op: q.op,
+		release: func() {
+			routedRelease()
+			unlimit()
+		},
+	}
+}
+
+// tracedTailIter traces a tailable cursor as a single span, from Tail to Close, counting the
+// documents and timeouts rather than tracing every Next.
+type tracedTailIter struct {
+	i       *mgo.Iter
+	op      *opSpan
+	release func()
+
+	docs     int
+	timeouts int
+}
+
+func (t *tracedTailIter) Next(result interface{}) bool {
+	recordUsage("MongoIter.Next")
+	if BudgetExpired(t.op.ctx) {
+		return false
+	}
+	if t.i.Next(result) {
+		t.docs++
+		return true
+	}
+	if t.i.Timeout() {
+		t.timeouts++
+	}
+	return false
+}
+
+func (t *tracedTailIter) All(result interface{}) error {
+	recordUsage("MongoIter.All")
+	return t.i.All(result)
+}
+
+func (t *tracedTailIter) Close() error {
+	recordUsage("MongoIter.Close")
+	defer t.op.Finish()
+	defer t.release()
+	t.op.LogFields(
+		opentracinglog.Int(LogNumDocs, t.docs),
+		opentracinglog.Int(LogTailTimeouts, t.timeouts),
+	)
+	return t.op.done(budgetErr(t.op.ctx, t.i, t.i.Close()))
+}
+
+func (t *tracedTailIter) Done() bool    { return t.i.Done() }
+func (t *tracedTailIter) Err() error    { return budgetErr(t.op.ctx, t.i, t.i.Err()) }
+func (t *tracedTailIter) Timeout() bool { return t.i.Timeout() }
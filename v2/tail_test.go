@@ -0,0 +1,28 @@
+package mgohttp
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTailRejectsCollation(t *testing.T) {
+	c := limitTestCollection(nil, "events")
+	iter := c.Find(nil).WithCollation(Collation{Locale: "en"}).Tail(time.Second)
+	var doc map[string]interface{}
+	assert.False(t, iter.Next(&doc))
+	assert.False(t, iter.Timeout())
+	assert.Equal(t, ErrCollatedTail, iter.Close())
+}
+
+func TestTailRejectsReadConcern(t *testing.T) {
+	c := limitTestCollection(nil, "events")
+	iter := c.Find(nil).WithReadConcern("majority").Tail(time.Second)
+	assert.False(t, iter.Next(&map[string]interface{}{}))
+	assert.Equal(t, ErrReadConcernTail, iter.Close())
+
+	// snapshot reads are rejected like on the other access methods
+	iter = c.Find(nil).WithSnapshot().Tail(time.Second)
+	assert.Equal(t, ErrSnapshotReadsUnsupported, iter.Close())
+}
@@ -0,0 +1,176 @@
+package mgohttp
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	opentracing "github.com/opentracing/opentracing-go"
+	opentracinglog "github.com/opentracing/opentracing-go/log"
+	mgo "gopkg.in/mgo.v2"
+)
+
+type requestTimeoutKeyType struct{}
+
+var requestTimeoutKey = requestTimeoutKeyType{}
+
+// WithRequestTimeout overrides the SessionHandler's Timeout for the request of ctx. It's meant
+// for middleware in front of the SessionHandler that knows the latency budget of a route. The
+// request's deadline, if any, still applies when it's earlier.
+func WithRequestTimeout(ctx context.Context, d time.Duration) context.Context {
+	return context.WithValue(ctx, requestTimeoutKey, d)
+}
+
+// requestTimeout is the effective timeout of a request: the handler's Timeout, or the one set
+// with WithRequestTimeout, capped by the time left until the deadline of ctx.
+func (c *SessionHandler) requestTimeout(ctx context.Context) time.Duration {
+	timeout := c.cfg.Timeout
+	if d, ok := ctx.Value(requestTimeoutKey).(time.Duration); ok && d > 0 {
+		timeout = d
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		if remaining := time.Until(deadline); remaining < timeout {
+			timeout = remaining
+		}
+	}
+	if timeout < time.Millisecond {
+		// the deadline has passed, time out right away (a zero socket timeout would mean none)
+		timeout = time.Millisecond
+	}
+	return timeout
+}
+
+// writeTimeout answers a request that timed out, with the TimeoutResponse and TimeoutStatus if
+// set, or else like any other error the handler fails itself.
+func (c *SessionHandler) writeTimeout(w http.ResponseWriter, r *http.Request) {
+	if c.cfg.TimeoutResponse == nil && c.cfg.TimeoutStatus == 0 {
+		c.writeError(w, ErrRequestTimeout)
+		return
+	}
+	status := c.cfg.TimeoutStatus
+	var body []byte
+	if c.cfg.ErrorMapper != nil {
+		mapped, mappedBody := c.cfg.ErrorMapper(ErrRequestTimeout)
+		if status == 0 {
+			status = mapped
+		}
+		body = mappedBody
+	} else if status == 0 {
+		status = c.errorCode
+	}
+	sw := &timeoutStatusWriter{ResponseWriter: w, status: status}
+	if c.cfg.TimeoutResponse != nil {
+		c.cfg.TimeoutResponse(sw, r)
+	} else {
+		sw.Write(body)
+	}
+	if !sw.wroteHeader {
+		sw.WriteHeader(status)
+	}
+}
+
+// timeoutStatusWriter writes the timeout status unless the TimeoutResponse writes its own.
+type timeoutStatusWriter struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+}
+
+func (w *timeoutStatusWriter) WriteHeader(code int) {
+	if w.wroteHeader {
+		return
+	}
+	w.wroteHeader = true
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *timeoutStatusWriter) Write(p []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(w.status)
+	}
+	return w.ResponseWriter.Write(p)
+}
+
+type requestSessionKeyType struct{}
+
+var requestSessionKey = requestSessionKeyType{}
+
+func (ts tracedMgoSession) WithTimeout(d time.Duration) MongoSession {
+	recordUsage("MongoSession.WithTimeout")
+	if d <= 0 {
+		return ts
+	}
+	if sp := opentracing.SpanFromContext(ts.ctx); sp != nil {
+		sp.LogFields(opentracinglog.Int64(LogSocketTimeoutMillis, d.Milliseconds()))
+	}
+	var sess *mgo.Session
+	if s, _ := ts.ctx.Value(requestSessionKey).(*requestSession); s != nil {
+		var err error
+		if sess, err = s.timeoutSession(ts.ctx, ts.sess, d); err != nil {
+			return failedSession{err: err}
+		}
+	} else {
+		// outside of a SessionHandler, the copy lasts as long as the caller's context
+		sess = ts.sess.Copy()
+		sess.SetSocketTimeout(d)
+		context.AfterFunc(ts.ctx, sess.Close)
+	}
+	return tracedMgoSession{
+		sess:      sess,
+		ctx:       withOpSession(ts.ctx, sess),
+		databases: newWrapperCache[MongoDatabase](),
+	}
+}
+
+// timeoutKey identifies a copy of a request's session made by MongoSession.WithTimeout: the
+// session it copies, and its socket timeout.
+type timeoutKey struct {
+	sess    *mgo.Session
+	timeout time.Duration
+}
+
+// timeoutSession returns the copy of sess with the socket timeout d, made the first time one of
+// the request's callers asks for it. Like a routed session, it takes one of the handler's
+// MaxConcurrentSessions, and it's closed along with the request's sessions.
+func (s *requestSession) timeoutSession(ctx context.Context, sess *mgo.Session, d time.Duration) (*mgo.Session, error) {
+	key := timeoutKey{sess: sess, timeout: d}
+	c := s.c
+	s.mu.Lock()
+	cs := s.timeouts[key]
+	s.mu.Unlock()
+	if cs != nil {
+		return cs.sess, nil
+	}
+
+	err := c.sessionTracker.add()
+	if err == nil {
+		if err = c.acquireSession(ctx, s.deadline, s.libSpan); err != nil {
+			c.sessionTracker.done()
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("mgohttp: creating session with a timeout of %s: %w", d, err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if cs := s.timeouts[key]; cs != nil || s.closed {
+		// another caller of the request made it meanwhile, or the request is done
+		c.releaseSession()
+		c.sessionTracker.done()
+		if cs == nil {
+			return nil, fmt.Errorf("mgohttp: creating session with a timeout of %s: the request's sessions are closed", d)
+		}
+		return cs.sess, nil
+	}
+	cs = &childSession{sess: sess.Copy(), c: c}
+	cs.sess.SetSocketTimeout(d)
+	if s.timeouts == nil {
+		s.timeouts = map[timeoutKey]*childSession{}
+	}
+	s.timeouts[key] = cs
+	s.children = append(s.children, cs)
+	c.cfg.Metrics.sessionOpened()
+	return cs.sess, nil
+}
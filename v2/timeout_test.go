@@ -0,0 +1,138 @@
+package mgohttp
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	mgo "gopkg.in/mgo.v2"
+)
+
+func TestRequestTimeout(t *testing.T) {
+	c := &SessionHandler{cfg: SessionHandlerConfig{Timeout: time.Minute}}
+	ctx := context.Background()
+	assert.Equal(t, time.Minute, c.requestTimeout(ctx))
+	assert.Equal(t, time.Second, c.requestTimeout(WithRequestTimeout(ctx, time.Second)))
+
+	deadlineCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	assert.InDelta(t, 10*time.Second, c.requestTimeout(deadlineCtx), float64(time.Second))
+	// the earlier of the override and the deadline wins
+	assert.Equal(t, time.Second, c.requestTimeout(WithRequestTimeout(deadlineCtx, time.Second)))
+
+	pastCtx, cancelPast := context.WithTimeout(ctx, -time.Second)
+	defer cancelPast()
+	assert.Equal(t, time.Millisecond, c.requestTimeout(pastCtx))
+}
+
+func TestServeHTTPHonorsDeadline(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+	handler := newLeakTestHandler(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	})
+	handler.cfg.Timeout = time.Minute
+
+	for _, newCtx := range []func() (context.Context, context.CancelFunc){
+		func() (context.Context, context.CancelFunc) {
+			return context.WithTimeout(context.Background(), handlerTimeout)
+		},
+		func() (context.Context, context.CancelFunc) {
+			return WithRequestTimeout(context.Background(), handlerTimeout), func() {}
+		},
+	} {
+		ctx, cancel := newCtx()
+		rec := httptest.NewRecorder()
+		start := time.Now()
+		handler.ServeHTTP(rec, httptest.NewRequest("GET", "/", nil).WithContext(ctx))
+		cancel()
+		assert.Equal(t, testingStatusCode, rec.Code)
+		assert.Less(t, time.Since(start), time.Second)
+	}
+	assert.Equal(t, int64(2), handler.Stats().TimedOut)
+	assert.Equal(t, int64(0), handler.Stats().Cancelled)
+}
+
+func TestTimeoutResponse(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+	newHandler := func(cfg SessionHandlerConfig) http.Handler {
+		cfg.Database = testDBName
+		cfg.Timeout = handlerTimeout
+		cfg.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			<-release
+		})
+		return NewSessionHandler(cfg)
+	}
+	serve := func(h http.Handler) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest("GET", "/reports", nil))
+		return rec
+	}
+
+	rec := serve(newHandler(SessionHandlerConfig{
+		TimeoutStatus: http.StatusGatewayTimeout,
+		TimeoutResponse: func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			w.Header().Set("Retry-After", "1")
+			w.Write([]byte(`{"error":"timeout","path":"` + r.URL.Path + `"}`))
+		},
+	}))
+	assert.Equal(t, http.StatusGatewayTimeout, rec.Code)
+	assert.Equal(t, "1", rec.Header().Get("Retry-After"))
+	assert.Equal(t, `{"error":"timeout","path":"/reports"}`, rec.Body.String())
+
+	// the ErrorMapper still provides the body
+	rec = serve(newHandler(SessionHandlerConfig{
+		TimeoutStatus: http.StatusGatewayTimeout,
+		ErrorMapper:   DefaultErrorMapper,
+	}))
+	assert.Equal(t, http.StatusGatewayTimeout, rec.Code)
+	assert.Equal(t, "Service Unavailable", rec.Body.String())
+
+	// the response can pick its own status
+	rec = serve(newHandler(SessionHandlerConfig{
+		TimeoutResponse: func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusTooManyRequests)
+		},
+	}))
+	assert.Equal(t, http.StatusTooManyRequests, rec.Code)
+
+	rec = serve(newHandler(SessionHandlerConfig{
+		TimeoutResponse: func(w http.ResponseWriter, r *http.Request) {},
+	}))
+	assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+}
+
+func TestTimeoutSessionCountsAgainstMaxConcurrentSessions(t *testing.T) {
+	var withTimeout MongoSession
+	var reused, copied *mgo.Session
+	handler := sessionLimitTestHandler(true, time.Second, nil, make(chan error, 1))
+	inner := handler.cfg.Handler
+	handler.cfg.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		inner.ServeHTTP(w, r)
+		withTimeout = FromContext(r.Context(), testDBName).WithTimeout(time.Second)
+
+		// the copy of a timeout is made once per request
+		s := r.Context().Value(requestSessionKey).(*requestSession)
+		sess := FromContext(r.Context(), testDBName).(tracedMgoSession).sess
+		copied = &mgo.Session{}
+		s.timeouts = map[timeoutKey]*childSession{{sess: sess, timeout: time.Minute}: {sess: copied, c: handler}}
+		reused, _ = s.timeoutSession(r.Context(), sess, time.Minute)
+	})
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+
+	f, ok := withTimeout.(failedSession)
+	if assert.True(t, ok, "the request's session holds the only slot") {
+		assert.True(t, errors.Is(f.err, ErrTooManySessions), f.err)
+	}
+	assert.Same(t, copied, reused)
+	assert.Empty(t, handler.sessionSlots)
+
+	sess := tracedMgoSession{ctx: context.Background()}
+	assert.Equal(t, sess, sess.WithTimeout(0), "no timeout keeps the request's")
+}
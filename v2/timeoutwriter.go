@@ -0,0 +1,309 @@
+package mgohttp
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"net"
+	"net/http"
+	"sync"
+	"sync/atomic"
+)
+
+// setTimedOut marks the request as timed out, counting the handler as abandoned if it's
+// still running. It reports whether the response was already committed, flushed or hijacked,
+// in which case it's too late to write the error response.
+func (tw *timeoutWriter) setTimedOut(abandoned *int64) bool {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	tw.timedOut = true
+	// nothing buffered will be written anymore
+	tw.wbuf = bytes.Buffer{}
+	if !tw.handlerDone {
+		atomic.AddInt64(abandoned, 1)
+	}
+	return tw.streaming || tw.hijacked
+}
+
+// setHandlerDone records that the wrapped handler returned, uncounting it as abandoned if the
+// request timed out first. It reports whether the request timed out.
+func (tw *timeoutWriter) setHandlerDone(abandoned *int64) bool {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	tw.handlerDone = true
+	if tw.timedOut {
+		atomic.AddInt64(abandoned, -1)
+	}
+	return tw.timedOut
+}
+
+// copyToResponseWriter writes the buffered response to w, and returns the size of its body.
+// Nothing is left to write once the response was streamed or hijacked, in which case it
+// reports that the response wasn't buffered.
+func (tw *timeoutWriter) copyToResponseWriter(w http.ResponseWriter) (int, bool) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	if tw.streaming || tw.hijacked {
+		return 0, false
+	}
+	dst := w.Header()
+	for k, vv := range tw.h {
+		dst[k] = vv
+	}
+	if !tw.wroteHeader {
+		tw.code = http.StatusOK
+	}
+	w.WriteHeader(tw.code)
+	n := tw.wbuf.Len()
+	w.Write(tw.wbuf.Bytes())
+	// release the buffer, the handler may hold on to the writer longer than we need it
+	tw.wbuf = bytes.Buffer{}
+	return n, true
+}
+
+// commit writes the status, headers and buffered body to the underlying ResponseWriter, after
+// which the response is streamed: writes go straight through, and a timeout can only cut the
+// response short rather than replace it with the error status.
+func (tw *timeoutWriter) commit() {
+	if tw.streaming {
+		return
+	}
+	if !tw.wroteHeader {
+		tw.wroteHeader = true
+		tw.code = http.StatusOK
+	}
+	dst := tw.w.Header()
+	for k, vv := range tw.h {
+		dst[k] = vv
+	}
+	tw.w.WriteHeader(tw.code)
+	tw.w.Write(tw.wbuf.Bytes())
+	tw.wbuf = bytes.Buffer{}
+	tw.streaming = true
+}
+
+// exposed returns tw as the http.ResponseWriter handed to the handler, implementing
+// http.Flusher, http.Hijacker and http.Pusher only when the underlying ResponseWriter does, so
+// handlers that check for them (server-sent events, websockets) keep working.
+func (tw *timeoutWriter) exposed() http.ResponseWriter {
+	_, canFlush := tw.w.(http.Flusher)
+	_, canHijack := tw.w.(http.Hijacker)
+	_, canPush := tw.w.(http.Pusher)
+	f, h, p := timeoutFlusher{tw}, timeoutHijacker{tw}, timeoutPusher{tw}
+	switch {
+	case canFlush && canHijack && canPush:
+		return struct {
+			*timeoutWriter
+			http.Flusher
+			http.Hijacker
+			http.Pusher
+		}{tw, f, h, p}
+	case canFlush && canHijack:
+		return struct {
+			*timeoutWriter
+			http.Flusher
+			http.Hijacker
+		}{tw, f, h}
+	case canFlush && canPush:
+		return struct {
+			*timeoutWriter
+			http.Flusher
+			http.Pusher
+		}{tw, f, p}
+	case canHijack && canPush:
+		return struct {
+			*timeoutWriter
+			http.Hijacker
+			http.Pusher
+		}{tw, h, p}
+	case canFlush:
+		return struct {
+			*timeoutWriter
+			http.Flusher
+		}{tw, f}
+	case canHijack:
+		return struct {
+			*timeoutWriter
+			http.Hijacker
+		}{tw, h}
+	case canPush:
+		return struct {
+			*timeoutWriter
+			http.Pusher
+		}{tw, p}
+	}
+	return tw
+}
+
+// timeoutFlusher flushes a timeoutWriter, committing the response on the first flush.
+// Flushing after the timeout does nothing.
+type timeoutFlusher struct {
+	tw *timeoutWriter
+}
+
+func (f timeoutFlusher) Flush() {
+	tw := f.tw
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	if tw.timedOut || tw.hijacked {
+		return
+	}
+	tw.commit()
+	tw.w.(http.Flusher).Flush()
+}
+
+// timeoutHijacker hijacks the connection of a timeoutWriter, which is the handler's from then
+// on: nothing buffered is written, and the timeout only closes the request's sessions.
+// Hijacking after the timeout fails with http.ErrHandlerTimeout.
+type timeoutHijacker struct {
+	tw *timeoutWriter
+}
+
+func (h timeoutHijacker) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	tw := h.tw
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	if tw.timedOut {
+		return nil, nil, http.ErrHandlerTimeout
+	}
+	conn, rw, err := tw.w.(http.Hijacker).Hijack()
+	if err == nil {
+		tw.hijacked = true
+	}
+	return conn, rw, err
+}
+
+// timeoutPusher initiates HTTP/2 server pushes, failing with http.ErrHandlerTimeout after the
+// timeout.
+type timeoutPusher struct {
+	tw *timeoutWriter
+}
+
+func (p timeoutPusher) Push(target string, opts *http.PushOptions) error {
+	tw := p.tw
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	if tw.timedOut {
+		return http.ErrHandlerTimeout
+	}
+	return tw.w.(http.Pusher).Push(target, opts)
+}
+
+// ReadFrom copies r to the response through Write, so it honors the buffering and the timeout
+// like any other write.
+func (tw *timeoutWriter) ReadFrom(r io.Reader) (int64, error) {
+	// hide ReadFrom from io.Copy, which would call it back
+	return io.Copy(struct{ io.Writer }{tw}, r)
+}
+
+// deferredWriter passes writes through to the http.ResponseWriter until the request times out
+// while the handler keeps running, see SessionHandlerConfig.DeferUntilSession. Headers are
+// kept apart until the status is written so the timeout doesn't race with the handler.
+type deferredWriter struct {
+	w http.ResponseWriter
+	h http.Header
+
+	mu          sync.Mutex
+	timedOut    bool
+	wroteHeader bool
+}
+
+func (dw *deferredWriter) Header() http.Header { return dw.h }
+
+func (dw *deferredWriter) Write(p []byte) (int, error) {
+	dw.mu.Lock()
+	defer dw.mu.Unlock()
+	if dw.timedOut {
+		return 0, http.ErrHandlerTimeout
+	}
+	if !dw.wroteHeader {
+		dw.writeHeader(http.StatusOK)
+	}
+	return dw.w.Write(p)
+}
+
+func (dw *deferredWriter) WriteHeader(code int) {
+	dw.mu.Lock()
+	defer dw.mu.Unlock()
+	if dw.timedOut || dw.wroteHeader {
+		return
+	}
+	dw.writeHeader(code)
+}
+
+func (dw *deferredWriter) writeHeader(code int) {
+	dst := dw.w.Header()
+	for k, vv := range dw.h {
+		dst[k] = vv
+	}
+	dw.wroteHeader = true
+	dw.w.WriteHeader(code)
+}
+
+// setTimedOut writes the error response with writeError unless the handler already wrote its
+// status, and fails later writes.
+func (dw *deferredWriter) setTimedOut(writeError func(w http.ResponseWriter)) {
+	dw.mu.Lock()
+	defer dw.mu.Unlock()
+	dw.timedOut = true
+	if !dw.wroteHeader {
+		dw.wroteHeader = true
+		writeError(dw.w)
+	}
+}
+
+// NOTE: below is copied from net/http's TimeoutHandler code
+
+// timeoutWriter is borrowed from the net/http package to help prevent data races.
+type timeoutWriter struct {
+	w    http.ResponseWriter
+	h    http.Header
+	wbuf bytes.Buffer
+
+	mu          sync.Mutex
+	timedOut    bool
+	handlerDone bool
+	wroteHeader bool
+	code        int
+	// stream commits the response as soon as its status is written, see
+	// SessionHandlerConfig.StreamResponses
+	stream bool
+	// streaming is set once the response was committed, hijacked once the handler took over
+	// the connection
+	streaming bool
+	hijacked  bool
+}
+
+func (tw *timeoutWriter) Header() http.Header { return tw.h }
+
+func (tw *timeoutWriter) Write(p []byte) (int, error) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	if tw.timedOut {
+		return 0, http.ErrHandlerTimeout
+	}
+	if !tw.wroteHeader {
+		tw.writeHeader(http.StatusOK)
+	}
+	if tw.streaming {
+		return tw.w.Write(p)
+	}
+	return tw.wbuf.Write(p)
+}
+
+func (tw *timeoutWriter) WriteHeader(code int) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	if tw.timedOut || tw.wroteHeader {
+		return
+	}
+	tw.writeHeader(code)
+}
+
+func (tw *timeoutWriter) writeHeader(code int) {
+	tw.wroteHeader = true
+	tw.code = code
+	if tw.stream {
+		tw.commit()
+	}
+}
@@ -0,0 +1,151 @@
+package mgohttp
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// plainWriter hides the optional interfaces of the recorder.
+type plainWriter struct {
+	http.ResponseWriter
+}
+
+// hijackWriter is a ResponseWriter that can be hijacked, but not flushed.
+type hijackWriter struct {
+	http.ResponseWriter
+	conn net.Conn
+}
+
+func (w hijackWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return w.conn, bufio.NewReadWriter(bufio.NewReader(w.conn), bufio.NewWriter(w.conn)), nil
+}
+
+func TestTimeoutWriterExposesInterfaces(t *testing.T) {
+	var flusher, hijacker, pusher bool
+	handler := newLeakTestHandler(func(w http.ResponseWriter, r *http.Request) {
+		_, flusher = w.(http.Flusher)
+		_, hijacker = w.(http.Hijacker)
+		_, pusher = w.(http.Pusher)
+	})
+
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	assert.True(t, flusher)
+	assert.False(t, hijacker)
+	assert.False(t, pusher)
+
+	handler.ServeHTTP(plainWriter{httptest.NewRecorder()}, httptest.NewRequest("GET", "/", nil))
+	assert.False(t, flusher)
+	assert.False(t, hijacker)
+
+	handler.ServeHTTP(hijackWriter{ResponseWriter: httptest.NewRecorder()}, httptest.NewRequest("GET", "/", nil))
+	assert.False(t, flusher)
+	assert.True(t, hijacker)
+}
+
+func TestTimeoutWriterFlush(t *testing.T) {
+	timedOut := make(chan struct{})
+	done := make(chan error)
+	handler := newLeakTestHandler(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Write([]byte("data: 1\n\n"))
+		w.(http.Flusher).Flush()
+		w.Write([]byte("data: 2\n\n"))
+		<-timedOut
+		_, err := w.Write([]byte("data: 3\n\n"))
+		w.(http.Flusher).Flush()
+		done <- err
+	})
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+	close(timedOut)
+	assert.Equal(t, http.ErrHandlerTimeout, <-done)
+
+	// the streamed response was cut short, not replaced by the timeout's error status
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "text/event-stream", rec.Header().Get("Content-Type"))
+	assert.Equal(t, "data: 1\n\ndata: 2\n\n", rec.Body.String())
+	assert.True(t, rec.Flushed)
+}
+
+func TestTimeoutWriterHijack(t *testing.T) {
+	server, client := net.Pipe()
+	defer client.Close()
+	hijacked := make(chan net.Conn, 1)
+	timedOut := make(chan struct{})
+	handler := newLeakTestHandler(func(w http.ResponseWriter, r *http.Request) {
+		conn, _, err := w.(http.Hijacker).Hijack()
+		assert.NoError(t, err)
+		hijacked <- conn
+		<-timedOut
+	})
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(hijackWriter{ResponseWriter: rec, conn: server}, httptest.NewRequest("GET", "/", nil))
+	close(timedOut)
+	assert.Equal(t, server, <-hijacked)
+	// the connection is the handler's, the timeout doesn't write its error status
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Empty(t, rec.Body.String())
+
+	tw := &timeoutWriter{w: hijackWriter{ResponseWriter: rec}, h: http.Header{}}
+	var abandoned int64
+	tw.setTimedOut(&abandoned)
+	_, _, err := tw.exposed().(http.Hijacker).Hijack()
+	assert.Equal(t, http.ErrHandlerTimeout, err)
+}
+
+func TestTimeoutWriterReadFrom(t *testing.T) {
+	tw := &timeoutWriter{w: plainWriter{httptest.NewRecorder()}, h: http.Header{}}
+	rf, ok := tw.exposed().(io.ReaderFrom)
+	require.True(t, ok)
+	n, err := rf.ReadFrom(strings.NewReader("hello"))
+	require.NoError(t, err)
+	assert.EqualValues(t, 5, n)
+	assert.Equal(t, "hello", tw.wbuf.String())
+
+	var abandoned int64
+	tw.setTimedOut(&abandoned)
+	_, err = rf.ReadFrom(strings.NewReader("hello"))
+	assert.Equal(t, http.ErrHandlerTimeout, err)
+}
+
+func TestStreamResponses(t *testing.T) {
+	rec := httptest.NewRecorder()
+	written := make(chan string)
+	timedOut := make(chan struct{})
+	done := make(chan error)
+	handler := NewSessionHandler(SessionHandlerConfig{
+		Database:        testDBName,
+		Timeout:         handlerTimeout,
+		StreamResponses: true,
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/x-ndjson")
+			w.Write([]byte("{}\n"))
+			// the write went through before the handler returned
+			written <- rec.Body.String()
+			<-timedOut
+			_, err := w.Write([]byte("{}\n"))
+			done <- err
+		}),
+	})
+
+	go func() {
+		assert.Equal(t, "{}\n", <-written)
+	}()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+	close(timedOut)
+	assert.Equal(t, http.ErrHandlerTimeout, <-done)
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "application/x-ndjson", rec.Header().Get("Content-Type"))
+	assert.Equal(t, "{}\n", rec.Body.String())
+}
@@ -0,0 +1,107 @@
+package mgohttp
+
+import (
+	"context"
+	"math/rand"
+
+	opentracing "github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/ext"
+)
+
+// tracer returns the tracer of the handler that issued the session of ctx, or the global
+// tracer.
+func tracer(ctx context.Context) opentracing.Tracer {
+	if h := handlerFromContext(ctx); h != nil && h.cfg.Tracer != nil {
+		return h.cfg.Tracer
+	}
+	return opentracing.GlobalTracer()
+}
+
+// startSpan starts a span as a child of the span of ctx, with the tracer for ctx. The span
+// is a no-op when the request's operations get no spans.
+func startSpan(ctx context.Context, name string) (opentracing.Span, context.Context) {
+	t := tracer(ctx)
+	if off, _ := ctx.Value(opSpansOffKey).(bool); off {
+		t = opentracing.NoopTracer{}
+	}
+	return opentracing.StartSpanFromContextWithTracer(ctx, t, name)
+}
+
+type opSpansOffKeyType struct{}
+
+var opSpansOffKey = opSpansOffKeyType{}
+
+// opSpansSampled picks whether a request's callers and operations get spans.
+func (c *SessionHandler) opSpansSampled() bool {
+	switch {
+	case c.cfg.DisableOpSpans:
+		return false
+	case c.cfg.OpSpanSampling <= 0 || c.cfg.OpSpanSampling >= 1:
+		return true
+	}
+	return rand.Float64() < c.cfg.OpSpanSampling
+}
+
+// opContext carries the request's settings of its operations to the sessions it hands out
+// for the handler's database db.
+func (s *requestSession) opContext(ctx context.Context, db string) context.Context {
+	ctx = context.WithValue(ctx, handlerDatabaseKey, db)
+	ctx = withOpComment(ctx, s.opComment)
+	if s.opSpansOff {
+		ctx = context.WithValue(ctx, opSpansOffKey, true)
+	}
+	if s.debug {
+		ctx = context.WithValue(ctx, debugKey, true)
+	}
+	if addr := s.c.peerAddress(db); addr != "" {
+		ctx = context.WithValue(ctx, peerAddressKey, addr)
+	}
+	return ctx
+}
+
+// setSemanticTags sets the OpenTelemetry semantic convention attributes of a database
+// operation, so spans exported through the OpenTelemetry bridge are recognized as such, and
+// the OpenTracing ones for the APMs that group the spans of clients by them. db.statement is
+// set once the selector is known, see setFingerprint.
+func setSemanticTags(sp opentracing.Span, ctx context.Context, op, collection string) {
+	sp.SetTag(TagDBSystem, "mongodb")
+	sp.SetTag(TagDBOperation, op)
+	ext.SpanKindRPCClient.Set(sp)
+	ext.DBType.Set(sp, "mongodb")
+	if db := databaseFromContext(ctx); db != "" {
+		sp.SetTag(TagDBName, db)
+		ext.DBInstance.Set(sp, db)
+	}
+	if collection != "" {
+		sp.SetTag(TagDBMongoDBCollection, collection)
+	}
+	if addr, _ := ctx.Value(peerAddressKey).(string); addr != "" {
+		ext.PeerAddress.Set(sp, addr)
+	}
+}
+
+// dbStatement is the db.statement of an operation: its name, collection and the shape of
+// its selector, without the values, e.g. "find users {email:?}".
+func dbStatement(op, collection, shape string) string {
+	statement := op
+	for _, part := range []string{collection, shape} {
+		if part != "" {
+			statement += " " + part
+		}
+	}
+	return statement
+}
+
+type peerAddressKeyType struct{}
+
+var peerAddressKey = peerAddressKeyType{}
+
+// peerAddress is the peer.address of the operations on the sessions of database. mgo doesn't
+// tell which server an operation went to, so it's only known when the sessions are copies of
+// a parent session dialed from a URL with a single host, e.g. a mongos.
+func (c *SessionHandler) peerAddress(database string) string {
+	if p, ok := c.parentSession.(*dialedParent); ok && c.usesParent(database) {
+		return p.peerAddress()
+	}
+	return ""
+}
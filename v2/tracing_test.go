@@ -0,0 +1,195 @@
+package mgohttp
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/opentracing/opentracing-go/ext"
+	"github.com/opentracing/opentracing-go/mocktracer"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	mgo "gopkg.in/mgo.v2"
+	bson "gopkg.in/mgo.v2/bson"
+)
+
+func TestHandlerTracer(t *testing.T) {
+	tracer := mocktracer.New()
+	handler := NewSessionHandler(SessionHandlerConfig{
+		Database: testDBName,
+		Timeout:  handlerTimeout,
+		NewSession: func(ctx context.Context) (*mgo.Session, error) {
+			return &mgo.Session{}, nil
+		},
+		// the session isn't connected, so the insert fails with a DriverPanicError
+		RecoverDriverPanics: true,
+		Tracer:              tracer,
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			users := FromContext(r.Context(), testDBName).DB("app").C("users")
+			users.Insert(bson.M{"a": 1})
+			var user bson.M
+			users.Find(bson.M{"email": "ada@example.com"}).One(&user)
+		}),
+	})
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+
+	ops := map[string]*mocktracer.MockSpan{}
+	for _, sp := range tracer.FinishedSpans() {
+		ops[sp.OperationName] = sp
+	}
+	require.Contains(t, ops, "mgohttp")
+	require.Contains(t, ops, "insert")
+	tags := ops["insert"].Tags()
+	assert.Equal(t, "mongodb", tags[TagDBSystem])
+	assert.Equal(t, "insert", tags[TagDBOperation])
+	assert.Equal(t, "app", tags[TagDBName])
+	assert.Equal(t, "users", tags[TagDBMongoDBCollection])
+	assert.Equal(t, ext.SpanKindRPCClientEnum, tags[string(ext.SpanKind)])
+	assert.Equal(t, "mongodb", tags[string(ext.DBType)])
+	assert.Equal(t, "app", tags[string(ext.DBInstance)])
+	assert.Equal(t, "insert users", tags[string(ext.DBStatement)])
+	assert.NotContains(t, tags, string(ext.PeerAddress), "the session isn't a copy of a dialed parent")
+
+	require.Contains(t, ops, "find")
+	assert.Equal(t, "find users {email:?}", ops["find"].Tags()[string(ext.DBStatement)], "the values are redacted")
+}
+
+func TestPeerAddress(t *testing.T) {
+	p := newDialedParent("mongodb://mongos.example.net:27017/app", nil)
+	h := &SessionHandler{parentSession: p, databases: []handlerDatabase{{name: testDBName}}}
+	assert.Empty(t, h.peerAddress(testDBName), "not dialed yet")
+
+	p.sess, p.hosts = &mgo.Session{}, []string{"mongos.example.net:27017"}
+	assert.Equal(t, "mongos.example.net:27017", h.peerAddress(testDBName))
+	assert.Empty(t, h.peerAddress("other"))
+
+	p.hosts = []string{"a.example.net:27017", "b.example.net:27017"}
+	assert.Empty(t, h.peerAddress(testDBName), "the server of an operation isn't known")
+}
+
+func TestHandlerConcurrentSpans(t *testing.T) {
+	tracer := mocktracer.New()
+	handler := NewSessionHandler(SessionHandlerConfig{
+		Database: testDBName,
+		Timeout:  handlerTimeout,
+		NewSession: func(ctx context.Context) (*mgo.Session, error) {
+			return &mgo.Session{}, nil
+		},
+		Tracer: tracer,
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var wg sync.WaitGroup
+			for i := 0; i < 8; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					FromContext(r.Context(), testDBName)
+				}()
+			}
+			wg.Wait()
+		}),
+	})
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+
+	var root *mocktracer.MockSpan
+	var callers []*mocktracer.MockSpan
+	for _, sp := range tracer.FinishedSpans() {
+		if sp.OperationName == "mgohttp" {
+			require.Nil(t, root, "one root span per request")
+			root = sp
+		} else {
+			callers = append(callers, sp)
+		}
+	}
+	require.NotNil(t, root)
+	assert.Len(t, callers, 8)
+	for _, sp := range callers {
+		assert.Equal(t, root.SpanContext.SpanID, sp.ParentID)
+		assert.Equal(t, root.SpanContext.TraceID, sp.SpanContext.TraceID)
+	}
+}
+
+func callerSpanNames(t *testing.T, cfg SessionHandlerConfig) []string {
+	tracer := mocktracer.New()
+	cfg.Database = testDBName
+	cfg.Timeout = handlerTimeout
+	cfg.NewSession = func(ctx context.Context) (*mgo.Session, error) { return &mgo.Session{}, nil }
+	cfg.Tracer = tracer
+	cfg.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		FromContext(r.Context(), testDBName)
+	})
+	NewSessionHandler(cfg).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/users", nil))
+
+	var names []string
+	for _, sp := range tracer.FinishedSpans() {
+		if sp.OperationName != "mgohttp" {
+			names = append(names, sp.OperationName)
+		}
+	}
+	return names
+}
+
+func TestCallerSpanNames(t *testing.T) {
+	// the functions of this package are skipped, net/http calls the handler
+	assert.Equal(t, []string{"net/http.HandlerFunc.ServeHTTP"}, callerSpanNames(t, SessionHandlerConfig{}))
+
+	names := callerSpanNames(t, SessionHandlerConfig{CallerSkipPrefixes: []string{"net/http."}})
+	require.Len(t, names, 1)
+	assert.NotContains(t, names[0], "net/http")
+
+	names = callerSpanNames(t, SessionHandlerConfig{
+		SpanNamer: func(r *http.Request) string { return r.Method + " " + r.URL.Path },
+	})
+	assert.Equal(t, []string{"GET /users"}, names)
+
+	names = callerSpanNames(t, SessionHandlerConfig{
+		SpanNamer: func(r *http.Request) string { return "" },
+	})
+	assert.Equal(t, []string{"net/http.HandlerFunc.ServeHTTP"}, names)
+}
+
+func serveInsert(t *testing.T, tracer *mocktracer.MockTracer, cfg SessionHandlerConfig) {
+	cfg.Database = testDBName
+	cfg.Timeout = handlerTimeout
+	cfg.NewSession = func(ctx context.Context) (*mgo.Session, error) { return &mgo.Session{}, nil }
+	// the session isn't connected, so the insert fails with a DriverPanicError
+	cfg.RecoverDriverPanics = true
+	cfg.Tracer = tracer
+	cfg.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		FromContext(r.Context(), testDBName).DB("app").C("users").Insert(bson.M{"a": 1})
+	})
+	NewSessionHandler(cfg).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+}
+
+func TestDisableOpSpans(t *testing.T) {
+	tracer := mocktracer.New()
+	serveInsert(t, tracer, SessionHandlerConfig{DisableOpSpans: true})
+
+	spans := tracer.FinishedSpans()
+	require.Len(t, spans, 1)
+	assert.Equal(t, "mgohttp", spans[0].OperationName)
+	assert.Equal(t, true, spans[0].Tag(TagOpSpansSampledOut))
+}
+
+func TestOpSpanSampling(t *testing.T) {
+	tracer := mocktracer.New()
+	for i := 0; i < 200; i++ {
+		serveInsert(t, tracer, SessionHandlerConfig{OpSpanSampling: 0.5})
+	}
+	roots, sampledOut, inserts := 0, 0, 0
+	for _, sp := range tracer.FinishedSpans() {
+		switch sp.OperationName {
+		case "mgohttp":
+			roots++
+			if sp.Tag(TagOpSpansSampledOut) == true {
+				sampledOut++
+			}
+		case "insert":
+			inserts++
+		}
+	}
+	assert.Equal(t, 200, roots)
+	assert.Equal(t, roots-sampledOut, inserts)
+	assert.InDelta(t, 100, sampledOut, 50)
+}
@@ -0,0 +1,23 @@
+package mgohttp
+
+import (
+	"context"
+	"errors"
+)
+
+// ErrTransactionsUnsupported is returned by the WithTransaction of mgo's sessions.
+// Multi-document transactions take the logical sessions of MongoDB 4.0, which mgo doesn't
+// implement, so the transaction fails before running its func rather than run its operations
+// one by one, without atomicity. The sessions of NewMongoDriver support them.
+var ErrTransactionsUnsupported = errors.New("mgohttp: transactions aren't supported by the mgo driver")
+
+// ErrNestedTransaction is returned by the WithTransaction of the session of a transaction:
+// MongoDB doesn't nest them.
+var ErrNestedTransaction = errors.New("mgohttp: transactions can't be nested")
+
+func (ts tracedMgoSession) WithTransaction(ctx context.Context, fn func(tx MongoSession) error) error {
+	recordUsage("MongoSession.WithTransaction")
+	sp, _ := startSpan(ts.ctx, "transaction")
+	defer sp.Finish()
+	return logAndReturnErr(sp, ErrTransactionsUnsupported)
+}
@@ -0,0 +1,76 @@
+package mgohttp
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/opentracing/opentracing-go/mocktracer"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/mongo"
+	mgo "gopkg.in/mgo.v2"
+)
+
+func TestWithTransactionUnsupported(t *testing.T) {
+	tracer := mocktracer.New()
+	ctx := context.WithValue(context.Background(), handlerKey, &SessionHandler{cfg: SessionHandlerConfig{Tracer: tracer}})
+	// the session isn't connected, the transaction must fail before it reaches it
+	sess := tracedMgoSession{sess: &mgo.Session{}, ctx: ctx, databases: newWrapperCache[MongoDatabase]()}
+
+	ran := false
+	err := sess.WithTransaction(ctx, func(tx MongoSession) error {
+		ran = true
+		return nil
+	})
+	assert.True(t, errors.Is(err, ErrTransactionsUnsupported))
+	assert.False(t, ran, "the operations aren't run without a transaction")
+	spans := tracer.FinishedSpans()
+	require.Len(t, spans, 1)
+	assert.Equal(t, "transaction", spans[0].OperationName)
+	assert.NotEmpty(t, spans[0].Logs(), "the error is logged on the span")
+}
+
+func TestMongoDriverTransaction(t *testing.T) {
+	tracer := mocktracer.New()
+	sess := unreachableDriverSession(t, tracer)
+
+	errAborted := errors.New("aborted")
+	var nested error
+	err := sess.WithTransaction(context.Background(), func(tx MongoSession) error {
+		ctx, cancel := tx.(tracedDriverSession).opContext(context.Background())
+		defer cancel()
+		assert.NotNil(t, mongo.SessionFromContext(ctx), "the operations of tx run in the transaction")
+		nested = tx.WithTransaction(context.Background(), func(MongoSession) error { return nil })
+		return errAborted
+	})
+	assert.Equal(t, errAborted, err)
+	assert.Equal(t, ErrNestedTransaction, nested)
+
+	spans := tracer.FinishedSpans()
+	require.Len(t, spans, 2)
+	assert.Equal(t, "transaction", spans[1].OperationName)
+	assert.Equal(t, spans[1].SpanContext.SpanID, spans[0].ParentID, "nested under the transaction's span")
+	fields := map[string]interface{}{}
+	for _, l := range spans[1].Logs() {
+		for _, f := range l.Fields {
+			fields[f.Key] = f.ValueString
+		}
+	}
+	assert.Equal(t, "1", fields[LogTransactionAttempts])
+}
+
+func TestMongoDriverTransactionUnsupported(t *testing.T) {
+	sess := unreachableDriverSession(t, mocktracer.New())
+	sess.(tracedDriverSession).s.d.buildInfo.load(func() (mgo.BuildInfo, error) {
+		return mgo.BuildInfo{Version: "3.6.8", VersionArray: []int{3, 6, 8, 0}}, nil
+	})
+
+	ran := false
+	err := sess.WithTransaction(context.Background(), func(MongoSession) error {
+		ran = true
+		return nil
+	})
+	assert.Equal(t, UnsupportedFeatureError{Feature: FeatureTransactions, Version: "3.6.8"}, err)
+	assert.False(t, ran)
+}
@@ -0,0 +1,195 @@
+package mgohttp
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	mgo "gopkg.in/mgo.v2"
+	bson "gopkg.in/mgo.v2/bson"
+)
+
+// usageRecording is 1 while the usage analyzer is on. It's checked on every traced call so
+// it's kept outside of the recorder's mutex.
+var usageRecording int32
+
+var usage = struct {
+	sync.Mutex
+	start    time.Time
+	methods  map[string]int64
+	features map[string]int64
+}{}
+
+// UsageReport is a machine-readable summary of which wrapper methods and mgo features a
+// service exercised while the usage analyzer was on. It's meant to be collected over a soak
+// window to plan (and later verify) a migration off of mgo.
+type UsageReport struct {
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+	// Methods counts calls per interface method, e.g. "MongoCollection.Find".
+	Methods map[string]int64 `json:"methods"`
+	// Features counts use of mgo behaviors that don't map 1:1 onto a method, e.g. the
+	// database commands sent through Run ("command:eval") or query operators found in
+	// selectors ("operator:$where").
+	Features map[string]int64 `json:"features"`
+}
+
+// StartUsageRecording turns on the usage analyzer and resets any previously recorded usage.
+func StartUsageRecording() {
+	usage.Lock()
+	defer usage.Unlock()
+	usage.start = time.Now()
+	usage.methods = map[string]int64{}
+	usage.features = map[string]int64{}
+	atomic.StoreInt32(&usageRecording, 1)
+}
+
+// StopUsageRecording turns off the usage analyzer and returns the final report.
+func StopUsageRecording() UsageReport {
+	atomic.StoreInt32(&usageRecording, 0)
+	return CurrentUsageReport()
+}
+
+// CurrentUsageReport returns a snapshot of the usage recorded so far.
+func CurrentUsageReport() UsageReport {
+	usage.Lock()
+	defer usage.Unlock()
+	report := UsageReport{
+		Start:    usage.start,
+		End:      time.Now(),
+		Methods:  map[string]int64{},
+		Features: map[string]int64{},
+	}
+	for k, v := range usage.methods {
+		report.Methods[k] = v
+	}
+	for k, v := range usage.features {
+		report.Features[k] = v
+	}
+	return report
+}
+
+// Names returns the sorted list of every method and feature in the report.
+func (r UsageReport) Names() []string {
+	names := make([]string, 0, len(r.Methods)+len(r.Features))
+	for k := range r.Methods {
+		names = append(names, k)
+	}
+	for k := range r.Features {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// UsageReportHandler serves the current usage report as JSON, so it can be mounted on an
+// internal route and scraped at the end of a soak window.
+func UsageReportHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(CurrentUsageReport())
+	})
+}
+
+// recordUsage counts a call to method, along with any mgo features it used.
+func recordUsage(method string, features ...string) {
+	if atomic.LoadInt32(&usageRecording) == 0 {
+		return
+	}
+	usage.Lock()
+	defer usage.Unlock()
+	if usage.methods == nil {
+		return
+	}
+	usage.methods[method]++
+	for _, f := range features {
+		usage.features[f]++
+	}
+}
+
+// recordSelectorUsage counts a call to method along with every operator used in its
+// selector/update documents.
+func recordSelectorUsage(method string, docs ...interface{}) {
+	if atomic.LoadInt32(&usageRecording) == 0 {
+		return
+	}
+	features := []string{}
+	for _, doc := range docs {
+		features = append(features, selectorOperators(doc)...)
+	}
+	recordUsage(method, features...)
+}
+
+// recordCommandUsage counts a database command run through MongoDatabase.Run.
+func recordCommandUsage(cmd interface{}) {
+	if atomic.LoadInt32(&usageRecording) == 0 {
+		return
+	}
+	features := []string{}
+	switch c := cmd.(type) {
+	case string:
+		features = append(features, "command:"+c)
+	case bson.D:
+		if len(c) > 0 {
+			features = append(features, "command:"+c[0].Name)
+		}
+	case bson.M:
+		// a bson.M command is only well defined with a single key
+		for k := range c {
+			features = append(features, "command:"+k)
+		}
+	}
+	recordUsage("MongoDatabase.Run", features...)
+}
+
+// recordApplyUsage counts a findAndModify issued through MongoQuery.Apply.
+func recordApplyUsage(change mgo.Change) {
+	if atomic.LoadInt32(&usageRecording) == 0 {
+		return
+	}
+	features := selectorOperators(change.Update)
+	if change.Upsert {
+		features = append(features, "apply:upsert")
+	}
+	if change.Remove {
+		features = append(features, "apply:remove")
+	}
+	recordUsage("MongoQuery.Apply", features...)
+}
+
+// selectorOperators walks a selector and returns an "operator:$name" entry for every $-key.
+func selectorOperators(selector interface{}) []string {
+	ops := []string{}
+	var walk func(v interface{})
+	walk = func(v interface{}) {
+		switch val := v.(type) {
+		case bson.M:
+			for k, sub := range val {
+				if len(k) > 0 && k[0] == '$' {
+					ops = append(ops, "operator:"+k)
+				}
+				walk(sub)
+			}
+		case bson.D:
+			for _, elem := range val {
+				if len(elem.Name) > 0 && elem.Name[0] == '$' {
+					ops = append(ops, "operator:"+elem.Name)
+				}
+				walk(elem.Value)
+			}
+		case []interface{}:
+			for _, sub := range val {
+				walk(sub)
+			}
+		case []bson.M:
+			for _, sub := range val {
+				walk(sub)
+			}
+		}
+	}
+	walk(selector)
+	return ops
+}
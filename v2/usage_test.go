@@ -0,0 +1,52 @@
+package mgohttp
+
+import (
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	mgo "gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+func TestUsageReport(t *testing.T) {
+	// Run against a disabled collection so the calls never need a live session.
+	DisableCollection(testDBName, "usage")
+	defer EnableCollection(testDBName, "usage")
+	c := tracedMgoCollection{
+		collectionName: "usage",
+		collection:     &mgo.Collection{Name: "usage", Database: &mgo.Database{Name: testDBName}},
+		ctx:            context.Background(),
+	}
+
+	// the report of an earlier recording stays around until the next one starts
+	before := CurrentUsageReport()
+	c.Insert(bson.M{"a": 1})
+	assert.Equal(t, before.Methods, CurrentUsageReport().Methods, "nothing is recorded until the analyzer is on")
+
+	StartUsageRecording()
+	c.Find(bson.M{"$or": []bson.M{{"a": bson.M{"$gt": 1}}, {"$where": "true"}}}).All(nil)
+	c.Update(bson.M{"a": 1}, bson.M{"$set": bson.M{"b": 2}})
+	c.Update(bson.M{"a": 2}, bson.M{"$set": bson.M{"b": 3}})
+	report := StopUsageRecording()
+
+	assert.Equal(t, int64(2), report.Methods["MongoCollection.Update"])
+	assert.Equal(t, int64(1), report.Methods["MongoCollection.Find"])
+	assert.Equal(t, int64(1), report.Features["operator:$or"])
+	assert.Equal(t, int64(1), report.Features["operator:$gt"])
+	assert.Equal(t, int64(1), report.Features["operator:$where"])
+	assert.Equal(t, int64(2), report.Features["operator:$set"])
+
+	c.Insert(bson.M{"a": 1})
+	assert.Zero(t, CurrentUsageReport().Methods["MongoCollection.Insert"], "recording stopped")
+
+	rec := httptest.NewRecorder()
+	UsageReportHandler().ServeHTTP(rec, httptest.NewRequest("GET", "/mgohttp/usage", nil))
+	var served UsageReport
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&served))
+	assert.Equal(t, report.Methods, served.Methods)
+	assert.Equal(t, report.Features, served.Features)
+}
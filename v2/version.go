@@ -0,0 +1,127 @@
+package mgohttp
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/Clever/mgohttp/v2/internal"
+	mgo "gopkg.in/mgo.v2"
+)
+
+// buildInfoTTL bounds how long a cached server version is trusted, so that rolling upgrades
+// are picked up without a restart.
+const buildInfoTTL = 10 * time.Minute
+
+// ServerFeature is a server capability that only exists from a given MongoDB version on.
+type ServerFeature struct {
+	Name  string
+	Major int
+	Minor int
+}
+
+// Server features that the wrappers gate on.
+var (
+	FeatureMaxTimeMS   = ServerFeature{Name: "maxTimeMS", Major: 2, Minor: 6}
+	FeatureReadConcern = ServerFeature{Name: "readConcern", Major: 3, Minor: 2}
+	FeatureCollation   = ServerFeature{Name: "collation", Major: 3, Minor: 4}
+	FeatureExpr        = ServerFeature{Name: "$expr", Major: 3, Minor: 6}
+	// The features of the sessions of NewMongoDriver, which mgo's don't have.
+	FeatureTransactions  = ServerFeature{Name: "transactions", Major: 4, Minor: 0}
+	FeatureSnapshotReads = ServerFeature{Name: "snapshot reads", Major: 5, Minor: 0}
+)
+
+// SupportedBy reports whether a server with the given build info supports the feature.
+func (f ServerFeature) SupportedBy(info mgo.BuildInfo) bool {
+	return info.VersionAtLeast(f.Major, f.Minor)
+}
+
+// buildInfoCache caches the buildInfo of the cluster behind a parent session.
+type buildInfoCache struct {
+	mu      sync.Mutex
+	info    mgo.BuildInfo
+	fetched time.Time
+	// fetching is closed once the fetch in progress is done, nil when there's none: the
+	// buildInfo command runs without holding mu, and concurrent callers wait for it
+	fetching chan struct{}
+}
+
+// get returns the cached build info, fetching it with sess if it's missing or stale.
+func (c *buildInfoCache) get(sess *mgo.Session) (mgo.BuildInfo, error) {
+	return c.load(sess.BuildInfo)
+}
+
+// load returns the cached build info, fetching it if it's missing or stale.
+func (c *buildInfoCache) load(fetch func() (mgo.BuildInfo, error)) (mgo.BuildInfo, error) {
+	c.mu.Lock()
+	for c.fetching != nil {
+		fetching := c.fetching
+		c.mu.Unlock()
+		<-fetching
+		c.mu.Lock()
+	}
+	if c.fresh() {
+		info := c.info
+		c.mu.Unlock()
+		return info, nil
+	}
+	fetching := make(chan struct{})
+	c.fetching = fetching
+	c.mu.Unlock()
+	defer func() {
+		c.mu.Lock()
+		c.fetching = nil
+		close(fetching)
+		c.mu.Unlock()
+	}()
+
+	info, err := fetch()
+	if err != nil {
+		return mgo.BuildInfo{}, err
+	}
+	c.mu.Lock()
+	c.info = info
+	c.fetched = time.Now()
+	c.mu.Unlock()
+	return info, nil
+}
+
+// fresh reports whether the cached build info can be trusted, with c.mu held.
+func (c *buildInfoCache) fresh() bool {
+	return !c.fetched.IsZero() && time.Since(c.fetched) < buildInfoTTL
+}
+
+// serverBuildInfo returns the build info for the server behind sess. It's cached per parent
+// session when sess came from a SessionHandler, and per getter outside of one when the getter
+// carries an internal.SessionCache, e.g. mgohttptest's.
+func serverBuildInfo(ctx context.Context, sess *mgo.Session) (mgo.BuildInfo, error) {
+	if h := handlerFromContext(ctx); h != nil {
+		return h.buildInfoCache(handlerDatabaseFromContext(ctx)).get(sess)
+	}
+	if c := internal.SessionCacheFromContext(ctx); c != nil {
+		return c.Load(func() interface{} { return &buildInfoCache{} }).(*buildInfoCache).get(sess)
+	}
+	return sess.BuildInfo()
+}
+
+// buildInfoCache returns the build info cache of the cluster behind the sessions of database:
+// its own when it has its own parent session or NewSession, the handler's otherwise.
+func (c *SessionHandler) buildInfoCache(database string) *buildInfoCache {
+	for _, db := range c.databases {
+		if db.name == database && db.buildInfo != nil {
+			return db.buildInfo
+		}
+	}
+	return &c.buildInfo
+}
+
+// checkServerFeature returns an UnsupportedFeatureError when the server behind sess doesn't
+// support f. When the version can't be determined we assume it's supported and let the
+// server reject the request, rather than silently changing the behavior of the query.
+func checkServerFeature(ctx context.Context, sess *mgo.Session, f ServerFeature) error {
+	info, err := serverBuildInfo(ctx, sess)
+	if err != nil || f.SupportedBy(info) {
+		return nil
+	}
+	return UnsupportedFeatureError{Feature: f, Version: info.Version}
+}
@@ -0,0 +1,105 @@
+package mgohttp
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/Clever/mgohttp/v2/internal"
+	"github.com/stretchr/testify/assert"
+	mgo "gopkg.in/mgo.v2"
+	bson "gopkg.in/mgo.v2/bson"
+)
+
+func TestServerFeatureSupportedBy(t *testing.T) {
+	v32 := mgo.BuildInfo{Version: "3.2.20", VersionArray: []int{3, 2, 20, 0}}
+	v36 := mgo.BuildInfo{Version: "3.6.0", VersionArray: []int{3, 6, 0, 0}}
+	v44 := mgo.BuildInfo{Version: "4.4.1", VersionArray: []int{4, 4, 1, 0}}
+
+	assert.True(t, FeatureMaxTimeMS.SupportedBy(v32))
+	assert.False(t, FeatureCollation.SupportedBy(v32))
+	assert.True(t, FeatureCollation.SupportedBy(v36))
+	assert.False(t, FeatureExpr.SupportedBy(v32))
+	assert.True(t, FeatureExpr.SupportedBy(v36))
+	assert.True(t, FeatureExpr.SupportedBy(v44))
+	assert.False(t, FeatureTransactions.SupportedBy(v36))
+	assert.True(t, FeatureTransactions.SupportedBy(v44))
+	assert.False(t, FeatureSnapshotReads.SupportedBy(v44))
+}
+
+func TestBuildInfoCacheFetchesOnce(t *testing.T) {
+	var c buildInfoCache
+	fetches := 0
+	fetching, fetched := make(chan struct{}), make(chan struct{})
+	fetch := func() (mgo.BuildInfo, error) {
+		fetches++
+		close(fetching)
+		<-fetched
+		return mgo.BuildInfo{Version: "3.6.0"}, nil
+	}
+	infos := make(chan mgo.BuildInfo, 2)
+	go func() {
+		info, _ := c.load(fetch)
+		infos <- info
+	}()
+	<-fetching
+	go func() {
+		info, _ := c.load(fetch)
+		infos <- info
+	}()
+	assert.True(t, c.mu.TryLock(), "the fetch doesn't hold the lock")
+	c.mu.Unlock()
+	close(fetched)
+	assert.Equal(t, "3.6.0", (<-infos).Version)
+	assert.Equal(t, "3.6.0", (<-infos).Version)
+	assert.Equal(t, 1, fetches, "the second caller waits for the first one's fetch")
+
+	_, err := c.load(func() (mgo.BuildInfo, error) { return mgo.BuildInfo{}, errors.New("unreachable") })
+	assert.NoError(t, err, "cached")
+}
+
+func TestBuildInfoCachePerParentSession(t *testing.T) {
+	h := NewSessionHandler(SessionHandlerConfig{
+		Database: testDBName,
+		Sess:     &mgo.Session{},
+		Databases: []DatabaseConfig{
+			{Database: "events", Sess: &mgo.Session{}},
+			{Database: "reports"},
+		},
+		Handler: http.NotFoundHandler(),
+	}).(*SessionHandler)
+	assert.Same(t, &h.buildInfo, h.buildInfoCache(testDBName))
+	assert.Same(t, &h.buildInfo, h.buildInfoCache("reports"), "the handler's parent session")
+	assert.NotSame(t, &h.buildInfo, h.buildInfoCache("events"), "a parent session of its own")
+}
+
+func TestServerBuildInfoSessionCache(t *testing.T) {
+	cache := &internal.SessionCache{}
+	ctx := internal.WithSessionCache(context.Background(), cache)
+	c := cache.Load(func() interface{} { return &buildInfoCache{} }).(*buildInfoCache)
+	c.load(func() (mgo.BuildInfo, error) { return mgo.BuildInfo{Version: "3.6.0"}, nil })
+
+	// the session isn't connected: the build info must come from the getter's cache
+	info, err := serverBuildInfo(ctx, &mgo.Session{})
+	assert.NoError(t, err)
+	assert.Equal(t, "3.6.0", info.Version)
+}
+
+func TestMaxTimeGate(t *testing.T) {
+	h := &SessionHandler{}
+	// a 2.4 server, cached: the collection has no session behind it
+	h.buildInfo.info = mgo.BuildInfo{Version: "2.4.14", VersionArray: []int{2, 4, 14, 0}}
+	h.buildInfo.fetched = time.Now()
+	c := tracedMgoCollection{
+		collectionName: "users",
+		collection:     &mgo.Collection{Name: "users", Database: &mgo.Database{Name: testDBName, Session: &mgo.Session{}}},
+		ctx:            context.WithValue(context.Background(), handlerKey, h),
+	}
+
+	err := c.Find(bson.M{"org": 1}).SetMaxTime(time.Second).One(&bson.M{})
+	var unsupported UnsupportedFeatureError
+	assert.True(t, errors.As(err, &unsupported), "%v", err)
+	assert.Equal(t, UnsupportedFeatureError{Feature: FeatureMaxTimeMS, Version: "2.4.14"}, unsupported)
+}
@@ -0,0 +1,316 @@
+package mgohttp
+
+import (
+	"errors"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	opentracinglog "github.com/opentracing/opentracing-go/log"
+	mgo "gopkg.in/mgo.v2"
+	bson "gopkg.in/mgo.v2/bson"
+)
+
+// defaultWatchAwait is how long the Next of a change stream waits for a change when its
+// ChangeStreamOptions have no MaxAwaitTime.
+const defaultWatchAwait = time.Second
+
+// ErrWatchPipelineUnsupported is returned by the change streams of Watch for a pipeline with
+// other stages than a $match on operationType, which the oplog can't be filtered with.
+var ErrWatchPipelineUnsupported = errors.New("mgohttp: Watch only supports $match stages on operationType")
+
+// ResumeToken is the position of a change stream in the oplog, the timestamp of a change: the
+// same on the sessions of mgo and NewMongoDriver. The zero ResumeToken starts a change stream
+// from the current end of the oplog.
+type ResumeToken struct {
+	Timestamp bson.MongoTimestamp `bson:"ts"`
+}
+
+// ChangeEvent is a change of a watched collection, shaped after the events of MongoDB's
+// change streams.
+type ChangeEvent struct {
+	// ID is the position of the change, to resume the change stream after it.
+	ID ResumeToken `bson:"_id"`
+	// OperationType is "insert", "update", "replace" or "delete".
+	OperationType string `bson:"operationType"`
+	Database      string `bson:"db"`
+	Collection    string `bson:"coll"`
+	// DocumentKey is the _id of the changed document.
+	DocumentKey bson.M `bson:"documentKey"`
+	// FullDocument is the document inserted or replaced, nil for updates and deletes.
+	FullDocument bson.M `bson:"fullDocument,omitempty"`
+	// UpdateDescription are the fields changed by an update.
+	UpdateDescription *UpdateDescription `bson:"updateDescription,omitempty"`
+}
+
+// UpdateDescription are the fields set, and removed, by an update.
+type UpdateDescription struct {
+	UpdatedFields bson.M   `bson:"updatedFields"`
+	RemovedFields []string `bson:"removedFields"`
+}
+
+// ChangeStreamOptions configure Watch.
+type ChangeStreamOptions struct {
+	// ResumeAfter starts the change stream after a change it returned, e.g. one recorded
+	// before a restart, rather than at the current end of the oplog.
+	ResumeAfter ResumeToken
+	// MaxAwaitTime is how long Next waits for a change before it returns false with Timeout
+	// set, one second by default.
+	MaxAwaitTime time.Duration
+}
+
+// oplogEntry is the subset of the entries of the oplog a change stream reads.
+type oplogEntry struct {
+	TS bson.MongoTimestamp `bson:"ts"`
+	Op string              `bson:"op"`
+	NS string              `bson:"ns"`
+	O  bson.M              `bson:"o"`
+	O2 bson.M              `bson:"o2"`
+}
+
+// oplogOps are the oplog operations of the change events.
+var oplogOps = map[string]string{"insert": "i", "update": "u", "replace": "u", "delete": "d"}
+
+func (t tracedMgoDatabase) Watch(pipeline interface{}, opts ChangeStreamOptions) ChangeStream {
+	recordUsage("MongoDatabase.Watch")
+	sp, _ := startOp(t.ctx, "watch", "")
+	return watch(sp, t.db, "", pipeline, opts)
+}
+
+func (tc tracedMgoCollection) Watch(pipeline interface{}, opts ChangeStreamOptions) ChangeStream {
+	recordUsage("MongoCollection.Watch")
+	sp, _ := startOp(tc.ctx, "watch", tc.collectionName)
+	if err := tc.checkDisabled(sp); err != nil {
+		logAndReturnErr(sp, err)
+		sp.Finish()
+		return failedChangeStream{err: err}
+	}
+	return watch(sp, tc.collection.Database, tc.collection.Name, pipeline, opts)
+}
+
+// watch tails the oplog for the changes of collection in db, or of every collection of db
+// when empty. mgo doesn't implement the $changeStream stage of MongoDB 3.6, so the changes
+// are read from the oplog, which takes a replica set and the privilege to read the local
+// database. The span of sp lasts until the change stream is closed.
+func watch(sp *opSpan, db *mgo.Database, collection string, pipeline interface{}, opts ChangeStreamOptions) ChangeStream {
+	sp.SetTag(TagAccessMethod, "Watch")
+	types, err := watchedTypes(pipeline)
+	if err != nil {
+		logAndReturnErr(sp, err)
+		sp.Finish()
+		return failedChangeStream{err: err}
+	}
+	await := opts.MaxAwaitTime
+	if await <= 0 {
+		await = defaultWatchAwait
+	}
+	sp.LogFields(opentracinglog.Int64(LogTailTimeoutMillis, await.Milliseconds()))
+
+	selector := bson.M{"op": bson.M{"$in": oplogOpsOf(types)}}
+	if collection != "" {
+		selector["ns"] = db.Name + "." + collection
+	} else {
+		selector["ns"] = bson.RegEx{Pattern: "^" + regexp.QuoteMeta(db.Name+".")}
+	}
+	from, iter, err := tailOplog(sp, db.Session, selector, opts.ResumeAfter, await)
+	if err != nil {
+		sp.Finish()
+		return failedChangeStream{err: err}
+	}
+	return &tracedChangeStream{
+		tail:  &tracedTailIter{i: iter, op: sp, release: func() {}},
+		types: types,
+		token: from,
+	}
+}
+
+// tailOplog starts tailing the entries of the oplog matching selector after from, or after
+// the last one when from is zero.
+func tailOplog(sp *opSpan, sess *mgo.Session, selector bson.M, from ResumeToken, await time.Duration) (_ ResumeToken, iter *mgo.Iter, err error) {
+	defer sp.recoverPanic(&err)
+	oplog := sess.DB("local").C("oplog.rs")
+	err = sp.intercept(OpInfo{Selector: selector}, func(op *OpInfo) error {
+		if from.Timestamp == 0 {
+			var last oplogEntry
+			if err := oplog.Find(nil).Sort("-$natural").One(&last); err != nil {
+				return err
+			}
+			from.Timestamp = last.TS
+		}
+		// LogReplay needs the condition on ts at the top level
+		selector := bson.M{"ts": bson.M{"$gt": from.Timestamp}, "$and": []interface{}{op.Selector}}
+		iter = oplog.Find(selector).LogReplay().Tail(await)
+		return nil
+	})
+	if err != nil {
+		return ResumeToken{}, nil, sp.done(err)
+	}
+	return from, iter, nil
+}
+
+// watchedTypes returns the operation types pipeline matches on.
+func watchedTypes(pipeline interface{}) (map[string]bool, error) {
+	types := map[string]bool{"insert": true, "update": true, "replace": true, "delete": true}
+	var stages []interface{}
+	switch p := pipeline.(type) {
+	case nil:
+	case []bson.M:
+		for _, stage := range p {
+			stages = append(stages, stage)
+		}
+	case []interface{}:
+		stages = p
+	default:
+		return nil, ErrWatchPipelineUnsupported
+	}
+	for _, stage := range stages {
+		s, ok := stage.(bson.M)
+		if !ok || len(s) != 1 {
+			return nil, ErrWatchPipelineUnsupported
+		}
+		match, ok := s["$match"].(bson.M)
+		if !ok || len(match) != 1 {
+			return nil, ErrWatchPipelineUnsupported
+		}
+		matched, err := matchedTypes(match["operationType"])
+		if err != nil {
+			return nil, err
+		}
+		for t := range types {
+			types[t] = types[t] && matched[t]
+		}
+	}
+	return types, nil
+}
+
+// matchedTypes returns the operation types cond, the $match of operationType, matches.
+func matchedTypes(cond interface{}) (map[string]bool, error) {
+	var values []interface{}
+	switch c := cond.(type) {
+	case string:
+		values = []interface{}{c}
+	case bson.M:
+		in, ok := c["$in"]
+		if !ok || len(c) != 1 {
+			return nil, ErrWatchPipelineUnsupported
+		}
+		switch in := in.(type) {
+		case []string:
+			for _, v := range in {
+				values = append(values, v)
+			}
+		case []interface{}:
+			values = in
+		default:
+			return nil, ErrWatchPipelineUnsupported
+		}
+	default:
+		return nil, ErrWatchPipelineUnsupported
+	}
+	matched := map[string]bool{}
+	for _, v := range values {
+		t, ok := v.(string)
+		if !ok || oplogOps[t] == "" {
+			return nil, ErrWatchPipelineUnsupported
+		}
+		matched[t] = true
+	}
+	return matched, nil
+}
+
+// oplogOpsOf returns the oplog operations of the operation types, sorted.
+func oplogOpsOf(types map[string]bool) []string {
+	ops := []string{}
+	for _, op := range []string{"i", "u", "d"} {
+		for t, watched := range types {
+			if watched && oplogOps[t] == op {
+				ops = append(ops, op)
+				break
+			}
+		}
+	}
+	return ops
+}
+
+// changeEvent returns the change event of an entry of the oplog, false for the entries that
+// aren't changes of a collection's documents.
+func changeEvent(entry oplogEntry) (ChangeEvent, bool) {
+	database, collection, ok := strings.Cut(entry.NS, ".")
+	if !ok || strings.HasPrefix(collection, "system.") {
+		return ChangeEvent{}, false
+	}
+	event := ChangeEvent{ID: ResumeToken{entry.TS}, Database: database, Collection: collection}
+	switch entry.Op {
+	case "i":
+		event.OperationType = "insert"
+		event.DocumentKey = bson.M{"_id": entry.O["_id"]}
+		event.FullDocument = entry.O
+	case "u":
+		event.DocumentKey = entry.O2
+		set, hasSet := entry.O["$set"].(bson.M)
+		unset, hasUnset := entry.O["$unset"].(bson.M)
+		if !hasSet && !hasUnset {
+			event.OperationType = "replace"
+			event.FullDocument = entry.O
+			break
+		}
+		event.OperationType = "update"
+		event.UpdateDescription = &UpdateDescription{UpdatedFields: set, RemovedFields: []string{}}
+		if event.UpdateDescription.UpdatedFields == nil {
+			event.UpdateDescription.UpdatedFields = bson.M{}
+		}
+		for field := range unset {
+			event.UpdateDescription.RemovedFields = append(event.UpdateDescription.RemovedFields, field)
+		}
+		sort.Strings(event.UpdateDescription.RemovedFields)
+	case "d":
+		event.OperationType = "delete"
+		event.DocumentKey = entry.O
+	default:
+		return ChangeEvent{}, false
+	}
+	return event, true
+}
+
+// tracedChangeStream is the change stream of Watch, traced like a tailable cursor: a single
+// span from Watch to Close.
+type tracedChangeStream struct {
+	tail  *tracedTailIter
+	types map[string]bool
+	token ResumeToken
+}
+
+func (cs *tracedChangeStream) Next(event *ChangeEvent) bool {
+	recordUsage("ChangeStream.Next")
+	for {
+		var entry oplogEntry
+		if !cs.tail.Next(&entry) {
+			return false
+		}
+		cs.token = ResumeToken{entry.TS}
+		if e, ok := changeEvent(entry); ok && cs.types[e.OperationType] {
+			*event = e
+			return true
+		}
+	}
+}
+
+func (cs *tracedChangeStream) Err() error               { return cs.tail.Err() }
+func (cs *tracedChangeStream) Timeout() bool            { return cs.tail.Timeout() }
+func (cs *tracedChangeStream) ResumeToken() ResumeToken { return cs.token }
+func (cs *tracedChangeStream) Close() error {
+	recordUsage("ChangeStream.Close")
+	return cs.tail.Close()
+}
+
+// failedChangeStream is a change stream that couldn't be started.
+type failedChangeStream struct {
+	err error
+}
+
+func (f failedChangeStream) Next(event *ChangeEvent) bool { return false }
+func (f failedChangeStream) Err() error                   { return f.err }
+func (f failedChangeStream) Timeout() bool                { return false }
+func (f failedChangeStream) ResumeToken() ResumeToken     { return ResumeToken{} }
+func (f failedChangeStream) Close() error                 { return f.err }
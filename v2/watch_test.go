@@ -0,0 +1,99 @@
+package mgohttp
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/opentracing/opentracing-go/mocktracer"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	mgo "gopkg.in/mgo.v2"
+	bson "gopkg.in/mgo.v2/bson"
+)
+
+func TestWatchedTypes(t *testing.T) {
+	types, err := watchedTypes(nil)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"i", "u", "d"}, oplogOpsOf(types))
+
+	types, err = watchedTypes([]bson.M{
+		{"$match": bson.M{"operationType": bson.M{"$in": []string{"insert", "replace", "delete"}}}},
+		{"$match": bson.M{"operationType": bson.M{"$in": []interface{}{"insert", "replace"}}}},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]bool{"insert": true, "update": false, "replace": true, "delete": false}, types)
+	assert.Equal(t, []string{"i", "u"}, oplogOpsOf(types), "replacements are updates in the oplog")
+
+	types, err = watchedTypes([]interface{}{bson.M{"$match": bson.M{"operationType": "delete"}}})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"d"}, oplogOpsOf(types))
+
+	for _, pipeline := range []interface{}{
+		bson.M{"$match": bson.M{"operationType": "insert"}},
+		[]bson.M{{"$project": bson.M{"fullDocument": 1}}},
+		[]bson.M{{"$match": bson.M{"fullDocument.name": "ada"}}},
+		[]bson.M{{"$match": bson.M{"operationType": "drop"}}},
+		[]bson.M{{"$match": bson.M{"operationType": bson.M{"$ne": "insert"}}}},
+	} {
+		_, err := watchedTypes(pipeline)
+		assert.True(t, errors.Is(err, ErrWatchPipelineUnsupported), "%v", pipeline)
+	}
+}
+
+func TestChangeEvent(t *testing.T) {
+	id := bson.NewObjectId()
+	ts := bson.MongoTimestamp(42)
+
+	event, ok := changeEvent(oplogEntry{TS: ts, Op: "i", NS: "app.users", O: bson.M{"_id": id, "name": "ada"}})
+	require.True(t, ok)
+	assert.Equal(t, ChangeEvent{
+		ID:            ResumeToken{ts},
+		OperationType: "insert",
+		Database:      "app",
+		Collection:    "users",
+		DocumentKey:   bson.M{"_id": id},
+		FullDocument:  bson.M{"_id": id, "name": "ada"},
+	}, event)
+
+	event, ok = changeEvent(oplogEntry{TS: ts, Op: "u", NS: "app.users", O: bson.M{
+		"$set":   bson.M{"name": "grace"},
+		"$unset": bson.M{"nick": true, "age": true},
+	}, O2: bson.M{"_id": id}})
+	require.True(t, ok)
+	assert.Equal(t, "update", event.OperationType)
+	assert.Equal(t, bson.M{"_id": id}, event.DocumentKey)
+	assert.Nil(t, event.FullDocument)
+	assert.Equal(t, &UpdateDescription{UpdatedFields: bson.M{"name": "grace"}, RemovedFields: []string{"age", "nick"}}, event.UpdateDescription)
+
+	event, ok = changeEvent(oplogEntry{TS: ts, Op: "u", NS: "app.users", O: bson.M{"_id": id, "name": "grace"}, O2: bson.M{"_id": id}})
+	require.True(t, ok)
+	assert.Equal(t, "replace", event.OperationType)
+	assert.Equal(t, bson.M{"_id": id, "name": "grace"}, event.FullDocument)
+
+	event, ok = changeEvent(oplogEntry{TS: ts, Op: "d", NS: "app.users", O: bson.M{"_id": id}})
+	require.True(t, ok)
+	assert.Equal(t, "delete", event.OperationType)
+	assert.Equal(t, bson.M{"_id": id}, event.DocumentKey)
+
+	_, ok = changeEvent(oplogEntry{TS: ts, Op: "i", NS: "app.system.indexes", O: bson.M{"name": "a_1"}})
+	assert.False(t, ok, "not a change of a collection's documents")
+	_, ok = changeEvent(oplogEntry{TS: ts, Op: "n", NS: "", O: bson.M{"msg": "periodic noop"}})
+	assert.False(t, ok)
+}
+
+func TestWatchUnsupportedPipeline(t *testing.T) {
+	tracer := mocktracer.New()
+	ctx := context.WithValue(context.Background(), handlerKey, &SessionHandler{cfg: SessionHandlerConfig{Tracer: tracer}})
+	// the session isn't connected, the change stream must fail before it reaches it
+	db := tracedMgoDatabase{db: &mgo.Database{Name: testDBName, Session: &mgo.Session{}}, ctx: ctx, collections: newWrapperCache[MongoCollection]()}
+
+	stream := db.C("users").Watch([]bson.M{{"$project": bson.M{"_id": 1}}}, ChangeStreamOptions{})
+	assert.False(t, stream.Next(&ChangeEvent{}))
+	assert.True(t, errors.Is(stream.Err(), ErrWatchPipelineUnsupported))
+	assert.True(t, errors.Is(stream.Close(), ErrWatchPipelineUnsupported))
+	spans := tracer.FinishedSpans()
+	require.Len(t, spans, 1)
+	assert.Equal(t, "watch", spans[0].OperationName)
+	assert.Equal(t, "Watch", spans[0].Tag(TagAccessMethod))
+}
@@ -0,0 +1,33 @@
+package mgohttp
+
+import "sync"
+
+// wrapperCache memoizes the wrappers of a session's databases, or of a database's
+// collections, by name. Handlers tend to look them up again for every operation, e.g.
+// sess.DB(name).C("users").Find(...), which would otherwise allocate new mgo values and
+// wrappers on every call. The wrappers are immutable values, so they're safe to hand out
+// again for as long as their session is used, from any goroutine.
+type wrapperCache[T any] struct {
+	mu       sync.Mutex
+	wrappers map[string]T
+}
+
+func newWrapperCache[T any]() *wrapperCache[T] {
+	return &wrapperCache[T]{wrappers: map[string]T{}}
+}
+
+// get returns the wrapper of name, creating it with create the first time. A nil cache
+// creates a new wrapper every time.
+func (c *wrapperCache[T]) get(name string, create func() T) T {
+	if c == nil {
+		return create()
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	w, ok := c.wrappers[name]
+	if !ok {
+		w = create()
+		c.wrappers[name] = w
+	}
+	return w
+}
@@ -0,0 +1,29 @@
+package mgohttp
+
+import (
+	"context"
+	"testing"
+
+	opentracing "github.com/opentracing/opentracing-go"
+	"github.com/stretchr/testify/assert"
+	mgo "gopkg.in/mgo.v2"
+)
+
+func TestWrapperCache(t *testing.T) {
+	ctx := opentracing.ContextWithSpan(context.Background(), opentracing.NoopTracer{}.StartSpan("caller"))
+	sess := tracedMgoSession{sess: &mgo.Session{}, ctx: ctx, databases: newWrapperCache[MongoDatabase]()}
+
+	users := sess.DB(testDBName).C("users")
+	assert.Equal(t, users, sess.DB(testDBName).C("users"))
+	assert.Equal(t, "users", users.(tracedMgoCollection).collectionName)
+	assert.Equal(t, "events", sess.DB(testDBName).C("events").(tracedMgoCollection).collectionName)
+	other := sess.DB("other").C("users").(tracedMgoCollection)
+	assert.Equal(t, "other", other.collection.Database.Name)
+	assert.Equal(t, "other", databaseFromContext(other.ctx))
+
+	allocs := testing.AllocsPerRun(100, func() {
+		sess.DB(testDBName).C("users")
+	})
+	// only the tag of the database on the caller's span allocates
+	assert.Equal(t, 1.0, allocs, "the wrappers are memoized")
+}